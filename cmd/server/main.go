@@ -16,6 +16,7 @@ import (
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/nmslite/nmslite/internal/api"
 	auth2 "github.com/nmslite/nmslite/internal/api/auth"
+	"github.com/nmslite/nmslite/internal/collectors"
 	"github.com/nmslite/nmslite/internal/database"
 	"github.com/nmslite/nmslite/internal/database/dbgen"
 	"github.com/nmslite/nmslite/internal/discovery"
@@ -40,7 +41,7 @@ func main() {
 	cfg := globals.InitGlobal() // Initialize global config singleton
 	logger := initLogger()
 	logger.Info("Starting NMS Lite Server",
-		"version", "1.0.0",
+		"version", globals.Version,
 		"host", cfg.Server.Host,
 		"port", cfg.Server.Port,
 	)
@@ -49,8 +50,8 @@ func main() {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	// Initialize database with single pool
-	pool := initDatabase(ctx)
+	// Initialize database; discovery writes get their own pool so they cannot starve polling
+	pool, discoveryPool := initDatabase(ctx)
 	defer database.Close()
 
 	authService := initAuthService()
@@ -59,20 +60,26 @@ func main() {
 
 	// Initialize BatchWriter for metrics
 	batchWriter := initBatchWriter(ctx, pool)
+	startRetentionWorker(ctx, pool)
+	startRollupWorker(ctx, pool)
+	startArchiveWorker(ctx, pool, events)
+	startStateHistoryWorker(ctx, pool, events)
+	pipelineCheck := startPipelineCheck(ctx, pool)
 
 	// Initialize and start workers
-	pluginManager, credService := startDiscoveryWorker(ctx, pool, events, authService)
-	startScheduler(ctx, pool, pluginManager, credService, events, batchWriter)
+	pluginManager, credService, discoveryWorker := startDiscoveryWorker(ctx, pool, discoveryPool, events, authService)
+	scheduler, schedulerStopped := startScheduler(ctx, pool, pluginManager, credService, events, batchWriter)
+	startTrapListener(ctx, pool, events)
 
 	// Initialize Provisioner
-	provisioner := discovery.NewProvisioner(dbgen.New(pool), events, pluginManager, logger)
+	provisioner := discovery.NewProvisioner(dbgen.New(discoveryPool), discovery.PoolTx(discoveryPool), events, pluginManager, logger)
 
 	// Start Discovery Handlers
-	discovery.StartProvisionHandler(ctx, events, dbgen.New(pool), logger, provisioner)
+	provisionHandler := discovery.StartProvisionHandler(ctx, events, discovery.PoolTx(discoveryPool), logger, provisioner)
 	discovery.StartDiscoveryCompletionLogger(ctx, events, slog.Default())
 
 	// Start HTTP server
-	srv := initHTTPServer(authService, pool, events, provisioner)
+	srv := initHTTPServer(authService, pool, events, provisioner, pluginManager, batchWriter, scheduler, discoveryWorker, pipelineCheck)
 	go startServer(srv)
 
 	// Wait for shutdown signal
@@ -80,11 +87,28 @@ func main() {
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
 
-	// Graceful shutdown
-	shutdownServer(cancel, srv)
+	// Graceful shutdown; the scheduler drains concurrently once ctx is cancelled
+	shutdownServer(cancel, srv, cfg.Server.ShutdownTimeout())
+
+	// Bounded by the same timeout: the scheduler abandons batches still running after it
+	<-schedulerStopped
+
+	// No more batches are sent, so long-running plugin daemons can exit
+	pluginManager.Close()
+
+	// The scheduler no longer submits, so whatever the BatchWriter still holds is final
+	flushCtx, flushCancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout())
+	unflushed, err := batchWriter.Shutdown(flushCtx)
+	flushCancel()
+	if err != nil || unflushed > 0 {
+		slog.Error("BatchWriter shutdown lost metrics", "unflushed", unflushed, "error", err)
+	}
+
+	// Finish provisioning already-validated devices before the pool closes
+	provisionHandler.Wait()
 }
 
-func initDatabase(ctx context.Context) *pgxpool.Pool {
+func initDatabase(ctx context.Context) (*pgxpool.Pool, *pgxpool.Pool) {
 	if err := database.InitDB(ctx); err != nil {
 		log.Fatalf("DB init failed: %v", err)
 	}
@@ -94,12 +118,14 @@ func initDatabase(ctx context.Context) *pgxpool.Pool {
 	}
 
 	pool := database.GetPool()
+	discoveryPool := database.GetDiscoveryPool()
 
-	slog.Info("Database pool initialized",
-		"max_conns", globals.GetConfig().Database.Pool.MaxConns,
+	slog.Info("Database pools initialized",
+		"max_conns", pool.Config().MaxConns,
+		"discovery_max_conns", discoveryPool.Config().MaxConns,
 	)
 
-	return pool
+	return pool, discoveryPool
 }
 
 func initAuthService() *auth2.Service {
@@ -133,15 +159,29 @@ func initEventChannels(ctx context.Context) *globals.EventChannels {
 		"monitor_state_buffer", cfg.Channel.StateSignalChannelSize,
 	)
 
-	// Note: Discovery Completion Logger is now started later with the Hub
+	// Fan out state events to subscribers (completion logger, SSE clients)
+	go func() {
+		if err := events.RunFanOut(ctx); err != nil && !errors.Is(err, context.Canceled) {
+			slog.Error("Event fan-out error", "error", err)
+		}
+	}()
+
+	// Warn when a channel's consumer falls behind, before events start dropping
+	go func() {
+		if err := events.RunSlowConsumerWatch(ctx); err != nil && !errors.Is(err, context.Canceled) {
+			slog.Error("Slow consumer watch error", "error", err)
+		}
+	}()
+
 	return events
 }
 
 func initBatchWriter(ctx context.Context, pool *pgxpool.Pool) *poller.BatchWriter {
-	batchWriter := poller.NewBatchWriter(pool)
+	batchWriter := poller.NewBatchWriter(poller.NewPostgresSink(pool))
 
+	// Run outlives ctx: Shutdown stops it once the scheduler has finished submitting
 	go func() {
-		if err := batchWriter.Run(ctx); err != nil && !errors.Is(err, context.Canceled) {
+		if err := batchWriter.Run(context.WithoutCancel(ctx)); err != nil && !errors.Is(err, context.Canceled) {
 			slog.Error("BatchWriter error", "error", err)
 		}
 	}()
@@ -156,7 +196,99 @@ func initBatchWriter(ctx context.Context, pool *pgxpool.Pool) *poller.BatchWrite
 	return batchWriter
 }
 
-func startDiscoveryWorker(ctx context.Context, db *pgxpool.Pool, events *globals.EventChannels, authService *auth2.Service) (*poller.PluginManager, *auth2.CredentialService) {
+func startRetentionWorker(ctx context.Context, pool *pgxpool.Pool) {
+	retentionWorker := poller.NewRetentionWorker(dbgen.New(pool))
+
+	go func() {
+		if err := retentionWorker.Run(ctx); err != nil && !errors.Is(err, context.Canceled) {
+			slog.Error("Retention worker error", "error", err)
+		}
+	}()
+
+	cfg := globals.GetConfig().Metrics
+	slog.Info("Retention worker started",
+		"retention_days", cfg.RetentionDays,
+		"rollup_retention_days", cfg.RollupRetentionDays,
+		"batch_size", cfg.RetentionBatchSize,
+		"interval_minutes", cfg.RetentionIntervalMinutes,
+	)
+}
+
+func startRollupWorker(ctx context.Context, pool *pgxpool.Pool) {
+	rollupWorker := poller.NewRollupWorker(pool)
+
+	go func() {
+		if err := rollupWorker.Run(ctx); err != nil && !errors.Is(err, context.Canceled) {
+			slog.Error("Rollup worker error", "error", err)
+		}
+	}()
+
+	cfg := globals.GetConfig().Metrics
+	slog.Info("Rollup worker started",
+		"rollup_after_hours", cfg.RollupAfterHours,
+		"interval_minutes", cfg.RollupIntervalMinutes,
+	)
+}
+
+func startPipelineCheck(ctx context.Context, pool *pgxpool.Pool) *poller.PipelineCheck {
+	pipelineCheck := poller.NewPipelineCheck(dbgen.New(pool))
+
+	go func() {
+		if err := pipelineCheck.Run(ctx); err != nil && !errors.Is(err, context.Canceled) {
+			slog.Error("Pipeline check error", "error", err)
+		}
+	}()
+
+	slog.Info("Metrics pipeline check started",
+		"interval_seconds", globals.GetConfig().Metrics.PipelineCheckIntervalSeconds,
+	)
+	return pipelineCheck
+}
+
+func startTrapListener(ctx context.Context, pool *pgxpool.Pool, events *globals.EventChannels) {
+	if !globals.GetConfig().Traps.Enabled {
+		return
+	}
+	trapListener := poller.NewTrapListener(dbgen.New(pool), events)
+
+	go func() {
+		if err := trapListener.Run(ctx); err != nil && !errors.Is(err, context.Canceled) {
+			slog.Error("Trap listener error", "error", err)
+		}
+	}()
+}
+
+func startArchiveWorker(ctx context.Context, pool *pgxpool.Pool, events *globals.EventChannels) {
+	archiveWorker := poller.NewArchiveWorker(dbgen.New(pool), events)
+
+	go func() {
+		if err := archiveWorker.Run(ctx); err != nil && !errors.Is(err, context.Canceled) {
+			slog.Error("Archive worker error", "error", err)
+		}
+	}()
+
+	cfg := globals.GetConfig().Scheduler
+	slog.Info("Archive worker started",
+		"archive_after_hours", cfg.ArchiveAfterHours,
+		"interval_minutes", cfg.ArchiveIntervalMinutes,
+	)
+}
+
+func startStateHistoryWorker(ctx context.Context, pool *pgxpool.Pool, events *globals.EventChannels) {
+	stateHistoryWorker := poller.NewStateHistoryWorker(dbgen.New(pool), events)
+
+	go func() {
+		if err := stateHistoryWorker.Run(ctx); err != nil && !errors.Is(err, context.Canceled) {
+			slog.Error("State history worker error", "error", err)
+		}
+	}()
+
+	slog.Info("State history worker started",
+		"retention_days", globals.GetConfig().Scheduler.StateHistoryRetentionDays,
+	)
+}
+
+func startDiscoveryWorker(ctx context.Context, db, discoveryDB *pgxpool.Pool, events *globals.EventChannels, authService *auth2.Service) (*poller.PluginManager, *auth2.CredentialService, *discovery.Worker) {
 	cfg := globals.GetConfig()
 	logger := slog.Default()
 
@@ -164,7 +296,12 @@ func startDiscoveryWorker(ctx context.Context, db *pgxpool.Pool, events *globals
 	pluginManager := poller.NewPluginManager(
 		cfg.Plugins.Directory,
 		time.Duration(cfg.Poller.PluginTimeoutMS)*time.Millisecond,
+		cfg.Plugins.MaxOutputBytes,
+		cfg.Plugins.GzipMinTasks(),
 	)
+	pluginManager.SetSpawnRetry(cfg.Plugins.SpawnRetry())
+	pluginManager.SetResourceLimits(cfg.Plugins.ResourceLimits())
+	pluginManager.SetDaemonsEnabled(!cfg.Plugins.DisableDaemons)
 
 	if err := pluginManager.Scan(); err != nil {
 		logger.Error("Failed to scan plugins", "error", err)
@@ -177,17 +314,26 @@ func startDiscoveryWorker(ctx context.Context, db *pgxpool.Pool, events *globals
 				"protocol", p.Protocol,
 			)
 		}
+
+		if cfg.Plugins.SelfTest {
+			failures := pluginManager.SelfTest(ctx, cfg.Plugins.SelfTestTimeout(), cfg.Plugins.SelfTestUnregister)
+			logger.Info("Plugin self-test completed",
+				"tested", len(pluginList),
+				"failed", len(failures),
+			)
+		}
 	}
 
-	// Initialize services
+	// Initialize services; the credential service is shared with the scheduler and stays on the main pool
 	credentialService := auth2.NewCredentialService(authService, dbgen.New(db))
+	discoveryLogger := logger.With("component", "discovery")
 	discoveryWorker := discovery.NewWorker(
 		events,
-		dbgen.New(db),
+		dbgen.New(discoveryDB),
 		pluginManager,
 		credentialService,
 		authService,
-		logger,
+		discoveryLogger,
 	)
 
 	// Start Discovery Worker
@@ -197,7 +343,23 @@ func startDiscoveryWorker(ctx context.Context, db *pgxpool.Pool, events *globals
 		}
 	}()
 
-	return pluginManager, credentialService
+	// Start recurring discovery scheduler
+	discoveryScheduler := discovery.NewScheduler(events, dbgen.New(discoveryDB), discoveryWorker, discoveryLogger)
+	go func() {
+		if err := discoveryScheduler.Run(ctx); err != nil && !errors.Is(err, context.Canceled) {
+			logger.Error("Discovery scheduler error", "error", err)
+		}
+	}()
+
+	// Verify SSH host keys of monitors opted in to host key checks
+	hostKeyVerifier := discovery.NewHostKeyVerifier(dbgen.New(discoveryDB), events, logger)
+	go func() {
+		if err := hostKeyVerifier.Run(ctx); err != nil && !errors.Is(err, context.Canceled) {
+			logger.Error("Host key verifier error", "error", err)
+		}
+	}()
+
+	return pluginManager, credentialService, discoveryWorker
 }
 
 func startScheduler(
@@ -207,18 +369,26 @@ func startScheduler(
 	credService *auth2.CredentialService,
 	events *globals.EventChannels,
 	batchWriter *poller.BatchWriter,
-) {
+) (*poller.SchedulerImpl, <-chan struct{}) {
 	resultWriter := poller.NewPollResultWriter(batchWriter)
 
+	queries := dbgen.New(db) // Wrap pool with sqlc querier - pool is still shared
 	scheduler := poller.NewSchedulerImpl(
-		dbgen.New(db), // Wrap pool with sqlc querier - pool is still shared
+		queries,
 		events,
 		pluginManager,
 		credService,
 		resultWriter,
 	)
+	// In-process collectors for protocols shipped without a plugin binary
+	scheduler.RegisterCollector("ssh", collectors.NewSSHCollector(queries))
+	scheduler.RegisterCollector("snmp-v1", collectors.NewSNMPCollector("snmp-v1"))
+	scheduler.RegisterCollector("snmp-v2c", collectors.NewSNMPCollector("snmp-v2c"))
+	scheduler.RegisterCollector("snmp-v3", collectors.NewSNMPCollector("snmp-v3"))
 
+	stopped := make(chan struct{})
 	go func() {
+		defer close(stopped)
 		if err := scheduler.Run(ctx); err != nil && !errors.Is(err, context.Canceled) {
 			slog.Error("Scheduler error", "error", err)
 		}
@@ -230,17 +400,21 @@ func startScheduler(
 		"liveness_workers", cfg.LivenessWorkers,
 		"plugin_workers", cfg.PluginWorkers,
 	)
+	return scheduler, stopped
 }
 
-func initHTTPServer(authService *auth2.Service, db *pgxpool.Pool, events *globals.EventChannels, provisioner *discovery.Provisioner) *http.Server {
+func initHTTPServer(authService *auth2.Service, db *pgxpool.Pool, events *globals.EventChannels, provisioner *discovery.Provisioner, pluginManager *poller.PluginManager, batchWriter *poller.BatchWriter, scheduler *poller.SchedulerImpl, discoveryWorker *discovery.Worker, pipelineCheck *poller.PipelineCheck) *http.Server {
 	cfg := globals.GetConfig()
-	router := api.NewRouter(authService, db, events, provisioner)
-	return &http.Server{
+	router, closeRouter := api.NewRouter(authService, db, events, provisioner, pluginManager, batchWriter, scheduler, discoveryWorker, pipelineCheck)
+	srv := &http.Server{
 		Addr:         fmt.Sprintf("%s:%d", cfg.Server.Host, cfg.Server.Port),
 		Handler:      router,
 		ReadTimeout:  cfg.Server.ReadTimeout(),
 		WriteTimeout: cfg.Server.WriteTimeout(),
 	}
+	// Stops the rate limiter's cleanup routine once Shutdown is called
+	srv.RegisterOnShutdown(closeRouter)
+	return srv
 }
 
 func startServer(srv *http.Server) {
@@ -260,11 +434,11 @@ func startServer(srv *http.Server) {
 	}
 }
 
-func shutdownServer(cancel context.CancelFunc, srv *http.Server) {
-	slog.Info("Shutting down server...")
+func shutdownServer(cancel context.CancelFunc, srv *http.Server, timeout time.Duration) {
+	slog.Info("Shutting down server...", "timeout", timeout)
 	cancel()
 
-	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 30*time.Second)
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), timeout)
 	defer shutdownCancel()
 
 	if err := srv.Shutdown(shutdownCtx); err != nil {
@@ -275,5 +449,9 @@ func shutdownServer(cancel context.CancelFunc, srv *http.Server) {
 }
 
 func initLogger() *slog.Logger {
-	return globals.InitLogger(globals.GetConfig().Logging)
+	logger, err := globals.InitLogger(globals.GetConfig().Logging)
+	if err != nil {
+		log.Fatalf("Logger init failed: %v", err)
+	}
+	return logger
 }
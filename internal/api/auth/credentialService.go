@@ -15,6 +15,11 @@ type Credentials struct {
 	Password string `json:"password"`
 	Domain   string `json:"domain,omitempty"`
 
+	// WinRM transport (optional; plain HTTP otherwise)
+	UseHTTPS           bool   `json:"use_https,omitempty"`
+	InsecureSkipVerify bool   `json:"insecure_skip_verify,omitempty"`
+	CACert             string `json:"ca_cert,omitempty"`
+
 	// SSH specific
 	PrivateKey string `json:"private_key,omitempty"`
 	Passphrase string `json:"passphrase,omitempty"`
@@ -29,6 +34,14 @@ type Credentials struct {
 	AuthPassword  string `json:"auth_password,omitempty"`
 	PrivProtocol  string `json:"priv_protocol,omitempty"`
 	PrivPassword  string `json:"priv_password,omitempty"`
+
+	// SNMP v3 scoped-PDU context (optional)
+	ContextName     string `json:"context_name,omitempty"`
+	ContextEngineID string `json:"context_engine_id,omitempty"`
+
+	// SNMP transport overrides (optional; config defaults apply otherwise)
+	Retries   *int `json:"retries,omitempty"`
+	TimeoutMS int  `json:"timeout_ms,omitempty"`
 }
 
 // CredentialService handles credential decryption operations
@@ -90,6 +103,17 @@ func (s *CredentialService) DecryptContainer(container []byte) (*Credentials, er
 		creds.Domain = domain
 	}
 
+	// WinRM
+	if https, ok := credMap["use_https"].(bool); ok {
+		creds.UseHTTPS = https
+	}
+	if insecure, ok := credMap["insecure_skip_verify"].(bool); ok {
+		creds.InsecureSkipVerify = insecure
+	}
+	if ca, ok := credMap["ca_cert"].(string); ok {
+		creds.CACert = ca
+	}
+
 	// SSH
 	if pk, ok := credMap["private_key"].(string); ok {
 		creds.PrivateKey = pk
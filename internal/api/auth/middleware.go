@@ -5,13 +5,17 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"io"
 	"log/slog"
 	"net"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/nmslite/nmslite/internal/database/dbgen"
 )
 
 type contextKey string
@@ -19,6 +23,10 @@ type contextKey string
 const (
 	RequestIDKey contextKey = "request_id"
 	UsernameKey  contextKey = "username"
+	RoleKey      contextKey = "role"
+
+	// originalBodyKey holds the request body as received, before any BodyLimit wrapping
+	originalBodyKey contextKey = "original_body"
 )
 
 // ErrorResponse represents a standard error response
@@ -43,13 +51,55 @@ func RequestID(next http.Handler) http.Handler {
 	})
 }
 
-// Logger middleware logs HTTP requests
-func Logger(logger *slog.Logger) func(http.Handler) http.Handler {
+// BodyLimit middleware caps request bodies at limit bytes (0 leaves them unlimited).
+// Applied again on a route it replaces the outer limit, so bulk endpoints can accept more
+// than the default. Declared oversized bodies are rejected with 413 up front; others fail
+// with *http.MaxBytesError when read past the limit.
+func BodyLimit(limit int64) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, ok := r.Context().Value(originalBodyKey).(io.ReadCloser)
+			if !ok {
+				body = r.Body
+				r = r.WithContext(context.WithValue(r.Context(), originalBodyKey, body))
+			}
+
+			if limit > 0 && r.ContentLength > limit {
+				sendError(w, r, http.StatusRequestEntityTooLarge, "PAYLOAD_TOO_LARGE",
+					"Request body exceeds "+strconv.FormatInt(limit, 10)+" bytes", nil)
+				return
+			}
+
+			if body != nil && body != http.NoBody {
+				if limit > 0 {
+					r.Body = http.MaxBytesReader(w, body, limit)
+				} else {
+					r.Body = body
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Logger middleware writes one access log line per request at the given level.
+// 5xx responses are always logged at warn; requests to skipPaths are not logged.
+func Logger(logger *slog.Logger, level slog.Level, skipPaths []string) func(http.Handler) http.Handler {
+	skip := make(map[string]struct{}, len(skipPaths))
+	for _, p := range skipPaths {
+		skip[p] = struct{}{}
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if _, ok := skip[r.URL.Path]; ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+
 			start := time.Now()
 
-			// Wrap response writer to capture status code
+			// Wrap response writer to capture status code and size
 			wrapped := &responseWriter{ResponseWriter: w, statusCode: http.StatusOK}
 
 			next.ServeHTTP(wrapped, r)
@@ -59,11 +109,17 @@ func Logger(logger *slog.Logger) func(http.Handler) http.Handler {
 			requestID, _ := r.Context().Value(RequestIDKey).(string)
 			username, _ := r.Context().Value(UsernameKey).(string)
 
-			logger.Info("Request completed",
+			logLevel := level
+			if wrapped.statusCode >= http.StatusInternalServerError {
+				logLevel = slog.LevelWarn
+			}
+
+			logger.Log(r.Context(), logLevel, "Request completed",
 				"request_id", requestID,
 				"method", r.Method,
 				"path", r.URL.Path,
 				"status", wrapped.statusCode,
+				"bytes", wrapped.bytes,
 				"duration_ms", duration.Milliseconds(),
 				"user", username,
 				"ip", r.RemoteAddr,
@@ -72,11 +128,19 @@ func Logger(logger *slog.Logger) func(http.Handler) http.Handler {
 	}
 }
 
-// CORS middleware handles CORS headers
+// CORS middleware handles CORS headers.
+// Requests without an Origin header (non-browser clients) pass through untouched;
+// requests from origins not in allowedOrigins are rejected with 403.
 func CORS(allowedOrigins, allowedMethods, allowedHeaders []string, maxAge int) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			origin := r.Header.Get("Origin")
+			if origin == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			w.Header().Add("Vary", "Origin")
 
 			// Check if origin is allowed
 			allowed := false
@@ -87,15 +151,20 @@ func CORS(allowedOrigins, allowedMethods, allowedHeaders []string, maxAge int) f
 				}
 			}
 
-			if allowed {
-				w.Header().Set("Access-Control-Allow-Origin", origin)
-				w.Header().Set("Access-Control-Allow-Methods", strings.Join(allowedMethods, ", "))
-				w.Header().Set("Access-Control-Allow-Headers", strings.Join(allowedHeaders, ", "))
-				w.Header().Set("Access-Control-Max-Age", string(rune(maxAge)))
+			if !allowed {
+				sendError(w, r, http.StatusForbidden, "CORS_ORIGIN_DENIED", "Origin not allowed", nil)
+				return
 			}
 
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+
 			// Handle preflight
-			if r.Method == "OPTIONS" {
+			if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+				w.Header().Set("Access-Control-Allow-Methods", strings.Join(allowedMethods, ", "))
+				w.Header().Set("Access-Control-Allow-Headers", strings.Join(allowedHeaders, ", "))
+				if maxAge > 0 {
+					w.Header().Set("Access-Control-Max-Age", strconv.Itoa(maxAge))
+				}
 				w.WriteHeader(http.StatusNoContent)
 				return
 			}
@@ -105,8 +174,16 @@ func CORS(allowedOrigins, allowedMethods, allowedHeaders []string, maxAge int) f
 	}
 }
 
-// JWTAuth middleware validates JWT tokens
-func JWTAuth(authService *Service) func(http.Handler) http.Handler {
+// UserStore looks up stored users; dbgen.Querier satisfies it
+type UserStore interface {
+	GetUserByUsername(ctx context.Context, username string) (dbgen.User, error)
+}
+
+// JWTAuth middleware validates JWT tokens. The role a stored user's token was issued with
+// is not trusted: each request takes the user's current role from users, so a role change
+// or deletion applies to tokens already issued. The configured admin is not stored and
+// keeps the admin role. With nil users (no database) token roles are used as issued.
+func JWTAuth(authService *Service, users UserStore) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			// Extract token from Authorization header
@@ -132,8 +209,23 @@ func JWTAuth(authService *Service) func(http.Handler) http.Handler {
 				return
 			}
 
-			// Add username to context
+			role := claims.Role
+			if users != nil && !authService.IsAdminUsername(claims.Username) {
+				user, err := users.GetUserByUsername(r.Context(), claims.Username)
+				if errors.Is(err, pgx.ErrNoRows) {
+					sendError(w, r, http.StatusUnauthorized, "UNAUTHORIZED", "Invalid or expired token", nil)
+					return
+				}
+				if err != nil {
+					sendError(w, r, http.StatusServiceUnavailable, "DB_UNAVAILABLE", "User could not be verified", nil)
+					return
+				}
+				role = user.Role
+			}
+
+			// Add username and role to context
 			ctx := context.WithValue(r.Context(), UsernameKey, claims.Username)
+			ctx = context.WithValue(ctx, RoleKey, role)
 			next.ServeHTTP(w, r.WithContext(ctx))
 		})
 	}
@@ -161,10 +253,11 @@ func Recovery(logger *slog.Logger) func(http.Handler) http.Handler {
 	}
 }
 
-// responseWriter wraps http.ResponseWriter to capture status code
+// responseWriter wraps http.ResponseWriter to capture status code and response size
 type responseWriter struct {
 	http.ResponseWriter
 	statusCode int
+	bytes      int
 }
 
 func (rw *responseWriter) WriteHeader(code int) {
@@ -172,6 +265,23 @@ func (rw *responseWriter) WriteHeader(code int) {
 	rw.ResponseWriter.WriteHeader(code)
 }
 
+func (rw *responseWriter) Write(b []byte) (int, error) {
+	n, err := rw.ResponseWriter.Write(b)
+	rw.bytes += n
+	return n, err
+}
+
+func (rw *responseWriter) Flush() {
+	if flusher, ok := rw.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
 func (rw *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
 	if hijacker, ok := rw.ResponseWriter.(http.Hijacker); ok {
 		return hijacker.Hijack()
@@ -0,0 +1,168 @@
+package auth
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestLoggerAccessLog(t *testing.T) {
+	testCases := []struct {
+		name      string
+		path      string
+		status    int
+		body      string
+		wantLevel string
+		wantLog   bool
+	}{
+		{"Success at configured level", "/api/v1/monitors", http.StatusOK, `{"ok":true}`, "INFO", true},
+		{"Client error at configured level", "/api/v1/monitors/9", http.StatusNotFound, "", "INFO", true},
+		{"Server error at warn", "/api/v1/monitors", http.StatusInternalServerError, "boom", "WARN", true},
+		{"Skipped path", "/health", http.StatusOK, "ok", "", false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			logger := slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+			handler := RequestID(Logger(logger, slog.LevelInfo, []string{"/health", "/metrics"})(
+				http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					w.WriteHeader(tc.status)
+					w.Write([]byte(tc.body))
+				}),
+			))
+
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tc.path, nil))
+
+			if !tc.wantLog {
+				if buf.Len() != 0 {
+					t.Errorf("Expected no access log, got %s", buf.String())
+				}
+				return
+			}
+
+			var entry map[string]interface{}
+			if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+				t.Fatalf("Failed to decode log line %q: %v", buf.String(), err)
+			}
+			if entry["level"] != tc.wantLevel {
+				t.Errorf("Expected level %s, got %v", tc.wantLevel, entry["level"])
+			}
+			if int(entry["status"].(float64)) != tc.status {
+				t.Errorf("Expected status %d, got %v", tc.status, entry["status"])
+			}
+			if int(entry["bytes"].(float64)) != len(tc.body) {
+				t.Errorf("Expected bytes %d, got %v", len(tc.body), entry["bytes"])
+			}
+			if entry["request_id"] != rec.Header().Get("X-Request-ID") {
+				t.Errorf("Expected request_id %q, got %v", rec.Header().Get("X-Request-ID"), entry["request_id"])
+			}
+		})
+	}
+}
+
+func TestCORS(t *testing.T) {
+	cors := CORS(
+		[]string{"https://app.example.com"},
+		[]string{"GET", "POST"},
+		[]string{"Authorization", "Content-Type"},
+		600,
+	)
+	handler := cors(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	testCases := []struct {
+		name        string
+		method      string
+		origin      string
+		preflight   bool
+		wantStatus  int
+		wantOrigin  string
+		wantMaxAge  string
+		wantMethods string
+	}{
+		{"Preflight allowed origin", http.MethodOptions, "https://app.example.com", true, http.StatusNoContent, "https://app.example.com", "600", "GET, POST"},
+		{"Preflight disallowed origin", http.MethodOptions, "https://evil.example.com", true, http.StatusForbidden, "", "", ""},
+		{"Simple request allowed origin", http.MethodGet, "https://app.example.com", false, http.StatusOK, "https://app.example.com", "", ""},
+		{"Simple request disallowed origin", http.MethodGet, "https://evil.example.com", false, http.StatusForbidden, "", "", ""},
+		{"No origin passes through", http.MethodGet, "", false, http.StatusOK, "", "", ""},
+		{"OPTIONS without preflight passes through", http.MethodOptions, "", false, http.StatusOK, "", "", ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, "/api/v1/monitors", nil)
+			if tc.origin != "" {
+				req.Header.Set("Origin", tc.origin)
+			}
+			if tc.preflight {
+				req.Header.Set("Access-Control-Request-Method", "POST")
+			}
+
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tc.wantStatus {
+				t.Errorf("Expected status %d, got %d", tc.wantStatus, rec.Code)
+			}
+			if got := rec.Header().Get("Access-Control-Allow-Origin"); got != tc.wantOrigin {
+				t.Errorf("Expected Allow-Origin %q, got %q", tc.wantOrigin, got)
+			}
+			if got := rec.Header().Get("Access-Control-Max-Age"); got != tc.wantMaxAge {
+				t.Errorf("Expected Max-Age %q, got %q", tc.wantMaxAge, got)
+			}
+			if got := rec.Header().Get("Access-Control-Allow-Methods"); got != tc.wantMethods {
+				t.Errorf("Expected Allow-Methods %q, got %q", tc.wantMethods, got)
+			}
+		})
+	}
+}
+
+func TestBodyLimitOverride(t *testing.T) {
+	read := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var tooLarge *http.MaxBytesError
+		if _, err := io.ReadAll(r.Body); errors.As(err, &tooLarge) {
+			w.WriteHeader(http.StatusRequestEntityTooLarge)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+
+	testCases := []struct {
+		name       string
+		handler    http.Handler
+		size       int
+		wantStatus int
+	}{
+		{"Within default", BodyLimit(16)(read), 16, http.StatusOK},
+		{"Over default", BodyLimit(16)(read), 17, http.StatusRequestEntityTooLarge},
+		{"Route override raises the limit", BodyLimit(16)(BodyLimit(64)(read)), 64, http.StatusOK},
+		{"Route override still caps", BodyLimit(16)(BodyLimit(64)(read)), 65, http.StatusRequestEntityTooLarge},
+		{"Unlimited", BodyLimit(0)(read), 1 << 20, http.StatusOK},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// Unknown length, so the limit is enforced while reading
+			req := httptest.NewRequest(http.MethodPost, "/", nil)
+			req.Body = io.NopCloser(strings.NewReader(strings.Repeat("x", tc.size)))
+			req.ContentLength = -1
+
+			rec := httptest.NewRecorder()
+			tc.handler.ServeHTTP(rec, req)
+
+			if rec.Code != tc.wantStatus {
+				t.Errorf("Expected status %d, got %d", tc.wantStatus, rec.Code)
+			}
+		})
+	}
+}
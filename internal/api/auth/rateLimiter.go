@@ -0,0 +1,214 @@
+package auth
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// RouteLimit overrides the default rate for a single "METHOD /path" endpoint. Path is
+// the chi route pattern, so templated endpoints are named as routed ("/api/v1/monitors/{id}")
+// and every ID shares the one bucket.
+type RouteLimit struct {
+	Method            string
+	Path              string
+	RequestsPerSecond float64
+	Burst             int
+}
+
+// tokenBucket is a classic token bucket refilled lazily on each take
+type tokenBucket struct {
+	tokens   float64
+	rate     float64
+	burst    float64
+	lastSeen time.Time
+}
+
+// take consumes one token if available, otherwise returns how long until one is
+func (b *tokenBucket) take(now time.Time) (bool, time.Duration) {
+	elapsed := now.Sub(b.lastSeen).Seconds()
+	b.tokens = math.Min(b.burst, b.tokens+elapsed*b.rate)
+	b.lastSeen = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+
+	wait := (1 - b.tokens) / b.rate
+	return false, time.Duration(wait * float64(time.Second))
+}
+
+// RateLimiter is an in-memory, goroutine-safe token-bucket limiter keyed by
+// caller identity (username, falling back to client IP) and endpoint.
+type RateLimiter struct {
+	defaultRate  float64
+	defaultBurst int
+	routes       map[string]RouteLimit
+	idleTTL      time.Duration
+
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+
+	now  func() time.Time
+	done chan struct{}
+	once sync.Once
+}
+
+// NewRateLimiter creates a limiter and starts its idle-bucket cleanup routine.
+// Call Close to stop the cleanup routine.
+func NewRateLimiter(requestsPerSecond float64, burst int, routes []RouteLimit, idleTTL time.Duration) *RateLimiter {
+	if requestsPerSecond <= 0 {
+		requestsPerSecond = 10
+	}
+	if burst <= 0 {
+		burst = int(math.Ceil(requestsPerSecond))
+	}
+	if idleTTL <= 0 {
+		idleTTL = 10 * time.Minute
+	}
+
+	routeMap := make(map[string]RouteLimit, len(routes))
+	for _, rt := range routes {
+		if rt.RequestsPerSecond <= 0 {
+			continue
+		}
+		if rt.Burst <= 0 {
+			rt.Burst = int(math.Ceil(rt.RequestsPerSecond))
+		}
+		routeMap[rt.Method+" "+rt.Path] = rt
+	}
+
+	rl := &RateLimiter{
+		defaultRate:  requestsPerSecond,
+		defaultBurst: burst,
+		routes:       routeMap,
+		idleTTL:      idleTTL,
+		buckets:      make(map[string]*tokenBucket),
+		now:          time.Now,
+		done:         make(chan struct{}),
+	}
+
+	go rl.cleanupLoop()
+
+	return rl
+}
+
+// Close stops the cleanup routine
+func (rl *RateLimiter) Close() {
+	rl.once.Do(func() { close(rl.done) })
+}
+
+// Allow reports whether a request for identity on the given endpoint (method and route
+// pattern) may proceed, and if not, how long the caller should wait before retrying.
+func (rl *RateLimiter) Allow(identity, method, path string) (bool, time.Duration) {
+	rate, burst := rl.defaultRate, rl.defaultBurst
+	key := identity
+
+	// Configured routes get their own bucket; everything else shares the identity's default bucket
+	if rt, ok := rl.routes[method+" "+path]; ok {
+		rate, burst = rt.RequestsPerSecond, rt.Burst
+		key = identity + "|" + method + " " + path
+	}
+
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	now := rl.now()
+	b, ok := rl.buckets[key]
+	if !ok {
+		b = &tokenBucket{tokens: float64(burst), rate: rate, burst: float64(burst), lastSeen: now}
+		rl.buckets[key] = b
+	}
+
+	return b.take(now)
+}
+
+// Middleware returns the HTTP middleware enforcing the limiter.
+// It must run after JWTAuth for per-user keying; otherwise the client IP is used.
+func (rl *RateLimiter) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		identity, _ := r.Context().Value(UsernameKey).(string)
+		if identity == "" {
+			identity = clientIP(r)
+		} else {
+			identity = "user:" + identity
+		}
+
+		allowed, retryAfter := rl.Allow(identity, r.Method, routePattern(r))
+		if !allowed {
+			seconds := int(math.Ceil(retryAfter.Seconds()))
+			if seconds < 1 {
+				seconds = 1
+			}
+			w.Header().Set("Retry-After", strconv.Itoa(seconds))
+			sendError(w, r, http.StatusTooManyRequests, "RATE_LIMITED", "Too many requests", map[string]interface{}{
+				"retry_after_seconds": seconds,
+			})
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// routePattern returns the chi route pattern that will serve r. The middleware runs before
+// the subrouters have matched, so the full path is matched against the top-level router.
+// Outside chi, or when nothing matches, it is the literal path.
+func routePattern(r *http.Request) string {
+	rctx := chi.RouteContext(r.Context())
+	if rctx == nil || rctx.Routes == nil {
+		return r.URL.Path
+	}
+	path := r.URL.RawPath
+	if path == "" {
+		path = r.URL.Path
+	}
+	match := chi.NewRouteContext()
+	if !rctx.Routes.Match(match, r.Method, path) {
+		return r.URL.Path
+	}
+	return match.RoutePattern()
+}
+
+// cleanupLoop periodically evicts buckets that have been idle longer than idleTTL
+func (rl *RateLimiter) cleanupLoop() {
+	ticker := time.NewTicker(rl.idleTTL / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-rl.done:
+			return
+		case <-ticker.C:
+			rl.cleanup()
+		}
+	}
+}
+
+// cleanup removes idle buckets; an idle bucket is full again, so dropping it is lossless
+func (rl *RateLimiter) cleanup() {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	cutoff := rl.now().Add(-rl.idleTTL)
+	for key, b := range rl.buckets {
+		if b.lastSeen.Before(cutoff) {
+			delete(rl.buckets, key)
+		}
+	}
+}
+
+// clientIP extracts the remote IP without the port
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return "ip:" + r.RemoteAddr
+	}
+	return "ip:" + host
+}
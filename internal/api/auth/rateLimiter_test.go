@@ -0,0 +1,170 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// newTestLimiter returns a limiter driven by a manually advanced clock
+func newTestLimiter(t *testing.T, rps float64, burst int, routes []RouteLimit) (*RateLimiter, *time.Time) {
+	t.Helper()
+	rl := NewRateLimiter(rps, burst, routes, time.Minute)
+	t.Cleanup(rl.Close)
+
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	rl.now = func() time.Time { return now }
+	return rl, &now
+}
+
+func TestRateLimiterBurst(t *testing.T) {
+	rl, now := newTestLimiter(t, 1, 3, nil)
+
+	for i := 0; i < 3; i++ {
+		if ok, _ := rl.Allow("user:alice", "GET", "/api/v1/monitors"); !ok {
+			t.Fatalf("Request %d within burst should be allowed", i+1)
+		}
+	}
+
+	ok, retryAfter := rl.Allow("user:alice", "GET", "/api/v1/monitors")
+	if ok {
+		t.Fatal("Request beyond burst should be throttled")
+	}
+	if retryAfter <= 0 || retryAfter > time.Second {
+		t.Errorf("Expected retry-after in (0, 1s], got %v", retryAfter)
+	}
+
+	// Another identity has its own bucket
+	if ok, _ := rl.Allow("user:bob", "GET", "/api/v1/monitors"); !ok {
+		t.Error("Different user should not share the throttled bucket")
+	}
+
+	// Refill after one token interval
+	*now = now.Add(time.Second)
+	if ok, _ := rl.Allow("user:alice", "GET", "/api/v1/monitors"); !ok {
+		t.Error("Request should be allowed after refill")
+	}
+}
+
+func TestRateLimiterRouteOverride(t *testing.T) {
+	rl, _ := newTestLimiter(t, 100, 100, []RouteLimit{
+		{Method: "POST", Path: "/api/v1/metrics/query", RequestsPerSecond: 1, Burst: 1},
+	})
+
+	if ok, _ := rl.Allow("user:alice", "POST", "/api/v1/metrics/query"); !ok {
+		t.Fatal("First metrics query should be allowed")
+	}
+	if ok, _ := rl.Allow("user:alice", "POST", "/api/v1/metrics/query"); ok {
+		t.Error("Second metrics query should be throttled by the route limit")
+	}
+
+	// Other endpoints use the default bucket and are unaffected
+	if ok, _ := rl.Allow("user:alice", "GET", "/api/v1/monitors"); !ok {
+		t.Error("Default-limited endpoint should not be throttled by the route limit")
+	}
+}
+
+func TestRateLimiterMiddleware(t *testing.T) {
+	rl, _ := newTestLimiter(t, 1, 2, nil)
+
+	handler := rl.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	testCases := []struct {
+		name       string
+		user       string
+		remoteAddr string
+		wantStatus int
+	}{
+		{"User first", "alice", "10.0.0.1:1000", http.StatusOK},
+		{"User second", "alice", "10.0.0.2:1000", http.StatusOK},
+		{"User throttled", "alice", "10.0.0.3:1000", http.StatusTooManyRequests},
+		{"Anonymous by IP", "", "10.0.0.1:2000", http.StatusOK},
+		{"Anonymous same IP", "", "10.0.0.1:3000", http.StatusOK},
+		{"Anonymous throttled", "", "10.0.0.1:4000", http.StatusTooManyRequests},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/monitors", nil)
+			req.RemoteAddr = tc.remoteAddr
+			if tc.user != "" {
+				req = req.WithContext(context.WithValue(req.Context(), UsernameKey, tc.user))
+			}
+
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tc.wantStatus {
+				t.Errorf("Expected status %d, got %d", tc.wantStatus, rec.Code)
+			}
+			if tc.wantStatus == http.StatusTooManyRequests && rec.Header().Get("Retry-After") == "" {
+				t.Error("Throttled response should include Retry-After header")
+			}
+		})
+	}
+}
+
+func TestRateLimiterTemplatedRoute(t *testing.T) {
+	rl, _ := newTestLimiter(t, 100, 100, []RouteLimit{
+		{Method: "POST", Path: "/api/v1/monitors/{id}/poll", RequestsPerSecond: 1, Burst: 1},
+	})
+
+	// Mounted like the API: the limiter runs in a subrouter before the route has matched
+	r := chi.NewRouter()
+	r.Route("/api/v1", func(r chi.Router) {
+		r.Use(rl.Middleware)
+		r.Route("/monitors", func(r chi.Router) {
+			r.Get("/{id}", func(w http.ResponseWriter, r *http.Request) {})
+			r.Post("/{id}/poll", func(w http.ResponseWriter, r *http.Request) {})
+		})
+	})
+
+	testCases := []struct {
+		name       string
+		method     string
+		path       string
+		wantStatus int
+	}{
+		{"First poll", http.MethodPost, "/api/v1/monitors/1/poll", http.StatusOK},
+		{"Another monitor shares the route bucket", http.MethodPost, "/api/v1/monitors/2/poll", http.StatusTooManyRequests},
+		{"Other routes use the default bucket", http.MethodGet, "/api/v1/monitors/1", http.StatusOK},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, tc.path, nil)
+			req.RemoteAddr = "10.0.0.1:1000"
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, req)
+
+			if rec.Code != tc.wantStatus {
+				t.Errorf("Expected status %d, got %d", tc.wantStatus, rec.Code)
+			}
+		})
+	}
+}
+
+func TestRateLimiterCleanup(t *testing.T) {
+	rl, now := newTestLimiter(t, 1, 1, nil)
+
+	rl.Allow("user:alice", "GET", "/")
+	*now = now.Add(2 * time.Minute)
+	rl.Allow("user:bob", "GET", "/")
+
+	rl.cleanup()
+
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	if _, ok := rl.buckets["user:alice"]; ok {
+		t.Error("Idle bucket should have been evicted")
+	}
+	if _, ok := rl.buckets["user:bob"]; !ok {
+		t.Error("Active bucket should have been kept")
+	}
+}
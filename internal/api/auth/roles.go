@@ -0,0 +1,68 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+)
+
+// Roles, from least to most privileged. Each role may do everything the roles below it can:
+// viewers read, operators also run discovery and manage monitors, admins also manage
+// credentials, users and the scheduler.
+const (
+	RoleViewer   = "viewer"
+	RoleOperator = "operator"
+	RoleAdmin    = "admin"
+)
+
+// Roles lists every role, least privileged first
+var Roles = []string{RoleViewer, RoleOperator, RoleAdmin}
+
+// roleRank orders roles by privilege; unknown roles rank 0 and are granted nothing
+var roleRank = map[string]int{RoleViewer: 1, RoleOperator: 2, RoleAdmin: 3}
+
+// ValidRole reports whether role is one of Roles
+func ValidRole(role string) bool {
+	return roleRank[role] > 0
+}
+
+// HasRole reports whether a caller with role have may act as role need
+func HasRole(have, need string) bool {
+	return roleRank[have] > 0 && roleRank[have] >= roleRank[need]
+}
+
+// RoleFromContext returns the role JWTAuth stored for the request ("" when unauthenticated)
+func RoleFromContext(ctx context.Context) string {
+	role, _ := ctx.Value(RoleKey).(string)
+	return role
+}
+
+// RequireRole middleware rejects requests whose caller lacks role with 403.
+// It must run after JWTAuth.
+func RequireRole(role string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !HasRole(RoleFromContext(r.Context()), role) {
+				sendError(w, r, http.StatusForbidden, "FORBIDDEN", "This action requires the "+role+" role", nil)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireRoleToWrite is RequireRole for mutating requests only; GET, HEAD and OPTIONS
+// pass for any authenticated caller
+func RequireRoleToWrite(role string) func(http.Handler) http.Handler {
+	require := RequireRole(role)
+	return func(next http.Handler) http.Handler {
+		guarded := require(next)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.Method {
+			case http.MethodGet, http.MethodHead, http.MethodOptions:
+				next.ServeHTTP(w, r)
+			default:
+				guarded.ServeHTTP(w, r)
+			}
+		})
+	}
+}
@@ -0,0 +1,158 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/jackc/pgx/v5"
+	"github.com/nmslite/nmslite/internal/database/dbgen"
+)
+
+func TestHasRole(t *testing.T) {
+	testCases := []struct {
+		have, need string
+		want       bool
+	}{
+		{RoleViewer, RoleViewer, true},
+		{RoleViewer, RoleOperator, false},
+		{RoleOperator, RoleViewer, true},
+		{RoleOperator, RoleAdmin, false},
+		{RoleAdmin, RoleOperator, true},
+		{"", RoleViewer, false},
+		{"root", RoleViewer, false},
+	}
+
+	for _, tc := range testCases {
+		if got := HasRole(tc.have, tc.need); got != tc.want {
+			t.Errorf("HasRole(%q, %q): Expected %v, got %v", tc.have, tc.need, tc.want, got)
+		}
+	}
+}
+
+func TestValidateTokenRole(t *testing.T) {
+	s, err := NewService("0123456789abcdef0123456789abcdef", "0123456789abcdef0123456789abcdef", "admin", "secret", time.Hour)
+	if err != nil {
+		t.Fatalf("Failed to create service: %v", err)
+	}
+
+	// sign builds a token as older releases did, without a role claim
+	sign := func(claims *Claims) string {
+		claims.ExpiresAt = jwt.NewNumericDate(time.Now().Add(time.Hour))
+		token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(s.jwtSecret)
+		if err != nil {
+			t.Fatalf("Failed to sign token: %v", err)
+		}
+		return token
+	}
+
+	login, err := s.Login("admin", "secret")
+	if err != nil {
+		t.Fatalf("Expected admin login to succeed, got %v", err)
+	}
+
+	testCases := []struct {
+		name     string
+		token    string
+		wantRole string
+		wantErr  bool
+	}{
+		{"Configured admin", login.Token, RoleAdmin, false},
+		{"Legacy admin token", sign(&Claims{Username: "admin"}), RoleAdmin, false},
+		{"Roleless token for another user", sign(&Claims{Username: "alice"}), "", true},
+		{"Unknown role", sign(&Claims{Username: "alice", Role: "root"}), "", true},
+		{"Viewer", sign(&Claims{Username: "alice", Role: RoleViewer}), RoleViewer, false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			claims, err := s.ValidateToken(tc.token)
+			if tc.wantErr {
+				if err == nil {
+					t.Errorf("Expected an error, got role %q", claims.Role)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if claims.Role != tc.wantRole {
+				t.Errorf("Expected role %q, got %q", tc.wantRole, claims.Role)
+			}
+		})
+	}
+
+	if _, err := s.IssueToken("alice", "root"); err == nil {
+		t.Error("Expected IssueToken to reject an unknown role")
+	}
+}
+
+// userMap is a UserStore over a fixed set of users; err, when set, fails every lookup
+type userMap struct {
+	users map[string]dbgen.User
+	err   error
+}
+
+func (m userMap) GetUserByUsername(ctx context.Context, username string) (dbgen.User, error) {
+	if m.err != nil {
+		return dbgen.User{}, m.err
+	}
+	u, ok := m.users[username]
+	if !ok {
+		return dbgen.User{}, pgx.ErrNoRows
+	}
+	return u, nil
+}
+
+func TestJWTAuthUsesCurrentRole(t *testing.T) {
+	s, err := NewService("0123456789abcdef0123456789abcdef", "0123456789abcdef0123456789abcdef", "admin", "secret", time.Hour)
+	if err != nil {
+		t.Fatalf("Failed to create service: %v", err)
+	}
+	token := func(username, role string) string {
+		resp, err := s.IssueToken(username, role)
+		if err != nil {
+			t.Fatalf("Failed to issue token: %v", err)
+		}
+		return resp.Token
+	}
+	demoted := userMap{users: map[string]dbgen.User{"alice": {Username: "alice", Role: RoleViewer}}}
+
+	testCases := []struct {
+		name       string
+		users      UserStore
+		token      string
+		wantStatus int
+		wantRole   string
+	}{
+		{"Demoted user gets the stored role", demoted, token("alice", RoleAdmin), http.StatusOK, RoleViewer},
+		{"Deleted user is rejected", demoted, token("bob", RoleOperator), http.StatusUnauthorized, ""},
+		{"Configured admin is not looked up", userMap{err: errors.New("down")}, token("admin", RoleAdmin), http.StatusOK, RoleAdmin},
+		{"Lookup failure", userMap{err: errors.New("down")}, token("alice", RoleViewer), http.StatusServiceUnavailable, ""},
+		{"No store trusts the token", nil, token("alice", RoleOperator), http.StatusOK, RoleOperator},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var role string
+			handler := JWTAuth(s, tc.users)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				role = RoleFromContext(r.Context())
+			}))
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/monitors", nil)
+			req.Header.Set("Authorization", "Bearer "+tc.token)
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tc.wantStatus {
+				t.Fatalf("Expected status %d, got %d (body: %s)", tc.wantStatus, rec.Code, rec.Body.String())
+			}
+			if role != tc.wantRole {
+				t.Errorf("Expected role %q, got %q", tc.wantRole, role)
+			}
+		})
+	}
+}
@@ -26,6 +26,7 @@ type Service struct {
 // Claims represents JWT token claims
 type Claims struct {
 	Username string `json:"username"`
+	Role     string `json:"role"`
 	jwt.RegisteredClaims
 }
 
@@ -59,17 +60,34 @@ func NewService(jwtSecret, encryptionKey, adminUsername, adminPassword string, t
 	}, nil
 }
 
-// Login authenticates a user and returns a JWT token
+// Login authenticates the configured admin and returns a JWT token with the admin role.
+// Other users are checked against the users table by the login handler, which then
+// calls IssueToken.
 func (s *Service) Login(username, password string) (*LoginResponse, error) {
 	// Simple authentication against configured admin credentials
 	if username != s.adminUsername || password != s.adminPassword {
 		return nil, errors.New("invalid credentials")
 	}
 
+	return s.IssueToken(username, RoleAdmin)
+}
+
+// IsAdminUsername reports whether username is the configured admin, which no stored user may shadow
+func (s *Service) IsAdminUsername(username string) bool {
+	return username == s.adminUsername
+}
+
+// IssueToken returns a signed JWT for an authenticated user with the given role
+func (s *Service) IssueToken(username, role string) (*LoginResponse, error) {
+	if !ValidRole(role) {
+		return nil, fmt.Errorf("invalid role %q", role)
+	}
+
 	// Generate JWT token
 	expiresAt := time.Now().Add(s.tokenExpiry)
 	claims := &Claims{
 		Username: username,
+		Role:     role,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(expiresAt),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
@@ -107,6 +125,14 @@ func (s *Service) ValidateToken(tokenString string) (*Claims, error) {
 		return nil, errors.New("invalid token")
 	}
 
+	// Tokens issued before roles existed carry none and were only ever issued to the admin
+	if claims.Role == "" && claims.Username == s.adminUsername {
+		claims.Role = RoleAdmin
+	}
+	if !ValidRole(claims.Role) {
+		return nil, errors.New("invalid role in token")
+	}
+
 	return claims, nil
 }
 
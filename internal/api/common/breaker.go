@@ -0,0 +1,235 @@
+package common
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Breaker states
+const (
+	BreakerClosed   = "closed"
+	BreakerOpen     = "open"
+	BreakerHalfOpen = "half_open"
+)
+
+// DBBreaker is a circuit breaker for API database reads. After threshold consecutive
+// failures it opens and guarded requests fail fast with 503 for the cooldown. It then
+// lets a single probe request through (half-open): a database success closes it, a
+// database failure reopens it, and a probe that never reached the database (a 400 from
+// validation, a cancelled client) just frees the probe slot for the next request.
+// Replica reads reach it only when the primary fallback fails too; a failing replica is
+// skipped by database.ReadRouter's own breaker.
+type DBBreaker struct {
+	threshold int
+	cooldown  time.Duration
+	now       func() time.Time
+
+	mu       sync.Mutex
+	state    string
+	failures int
+	openedAt time.Time
+	probing  bool
+	gen      uint64 // bumped on every state change so stale outcomes are ignored
+
+	trips    atomic.Int64
+	rejected atomic.Int64
+}
+
+// breakerTicket ties a request's outcome to the breaker state that admitted it
+type breakerTicket struct {
+	gen   uint64
+	probe bool
+}
+
+// NewDBBreaker creates a closed breaker (threshold <= 0 uses 5, cooldown <= 0 uses 30s)
+func NewDBBreaker(threshold int, cooldown time.Duration) *DBBreaker {
+	if threshold <= 0 {
+		threshold = 5
+	}
+	if cooldown <= 0 {
+		cooldown = 30 * time.Second
+	}
+	return &DBBreaker{threshold: threshold, cooldown: cooldown, now: time.Now, state: BreakerClosed}
+}
+
+func (b *DBBreaker) setStateLocked(state string) {
+	b.state = state
+	b.gen++
+}
+
+// allow reports whether a request may touch the database
+func (b *DBBreaker) allow() (breakerTicket, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == BreakerOpen && b.now().Sub(b.openedAt) >= b.cooldown {
+		b.setStateLocked(BreakerHalfOpen)
+		b.probing = false
+	}
+
+	switch b.state {
+	case BreakerClosed:
+		return breakerTicket{gen: b.gen}, true
+	case BreakerHalfOpen:
+		if !b.probing {
+			b.probing = true
+			return breakerTicket{gen: b.gen, probe: true}, true
+		}
+	}
+	b.rejected.Add(1)
+	return breakerTicket{}, false
+}
+
+// dbResult is what a guarded request learned about database health
+type dbResult int
+
+const (
+	dbUnknown dbResult = iota // the request never reached the database, or gave up on it
+	dbSucceeded
+	dbFailed
+)
+
+// record applies the outcome of a request admitted by allow
+func (b *DBBreaker) record(t breakerTicket, result dbResult) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if t.gen != b.gen {
+		return
+	}
+
+	switch {
+	case b.state == BreakerHalfOpen && t.probe:
+		b.probing = false
+		switch result {
+		case dbFailed:
+			b.openLocked()
+		case dbSucceeded:
+			b.failures = 0
+			b.setStateLocked(BreakerClosed)
+		}
+	case b.state == BreakerClosed && result == dbFailed:
+		b.failures++
+		if b.failures >= b.threshold {
+			b.openLocked()
+		}
+	case b.state == BreakerClosed && result == dbSucceeded:
+		b.failures = 0
+	}
+}
+
+func (b *DBBreaker) openLocked() {
+	b.openedAt = b.now()
+	b.setStateLocked(BreakerOpen)
+	b.trips.Add(1)
+}
+
+// State returns "closed", "open" or "half_open". An open breaker whose cooldown has
+// elapsed still reports open until the next request probes it.
+func (b *DBBreaker) State() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+// Trips returns how many times the breaker has opened
+func (b *DBBreaker) Trips() int64 {
+	return b.trips.Load()
+}
+
+// Rejected returns how many requests were failed fast while the breaker was open
+func (b *DBBreaker) Rejected() int64 {
+	return b.rejected.Load()
+}
+
+// dbOutcomeKey carries a *dbOutcome through a guarded request's context
+type dbOutcomeKey struct{}
+
+// dbOutcome collects what a guarded request reported about its database access:
+// QueryContext and WriteContext mark it reached, HandleDBError marks failures and
+// cancellations.
+type dbOutcome struct {
+	reached      atomic.Bool
+	failed       atomic.Bool
+	inconclusive atomic.Bool
+}
+
+func (o *dbOutcome) result() dbResult {
+	switch {
+	case o.failed.Load():
+		return dbFailed
+	case o.inconclusive.Load():
+		return dbUnknown
+	case o.reached.Load():
+		return dbSucceeded
+	}
+	return dbUnknown
+}
+
+func requestOutcome(r *http.Request) *dbOutcome {
+	o, _ := r.Context().Value(dbOutcomeKey{}).(*dbOutcome)
+	return o
+}
+
+// markDBReached flags that the current request went to the database, if it is guarded
+func markDBReached(r *http.Request) {
+	if o := requestOutcome(r); o != nil {
+		o.reached.Store(true)
+	}
+}
+
+// markDBFailure flags the current request's database access as failed, if it is guarded
+func markDBFailure(r *http.Request) {
+	if o := requestOutcome(r); o != nil {
+		o.failed.Store(true)
+	}
+}
+
+// markDBInconclusive flags that the request gave up before the database answered
+func markDBInconclusive(r *http.Request) {
+	if o := requestOutcome(r); o != nil {
+		o.inconclusive.Store(true)
+	}
+}
+
+// Guard fails requests fast with 503 while the breaker is open and feeds the database
+// outcome of admitted requests back to it. A handler that panics counts as a failure.
+func (b *DBBreaker) Guard(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ticket, ok := b.allow()
+		if !ok {
+			w.Header().Set("Retry-After", strconv.Itoa(int(b.cooldown.Seconds())))
+			SendError(w, r, http.StatusServiceUnavailable, "DB_UNAVAILABLE",
+				"Database is unavailable, try again later", nil)
+			return
+		}
+
+		outcome := &dbOutcome{}
+		completed := false
+		defer func() {
+			if !completed {
+				b.record(ticket, dbFailed)
+				return
+			}
+			b.record(ticket, outcome.result())
+		}()
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), dbOutcomeKey{}, outcome)))
+		completed = true
+	})
+}
+
+// GuardReads is Guard for GET and HEAD requests; other methods pass straight through
+func (b *DBBreaker) GuardReads(next http.Handler) http.Handler {
+	guarded := b.Guard(next)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			guarded.ServeHTTP(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
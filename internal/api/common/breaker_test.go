@@ -0,0 +1,195 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+func TestDBBreakerTripsAndResets(t *testing.T) {
+	now := time.Now()
+	b := NewDBBreaker(3, 10*time.Second)
+	b.now = func() time.Time { return now }
+
+	var dbErr error
+	handler := b.Guard(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if HandleDBError(w, r, dbErr, "Monitor") {
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	call := func() int {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/monitors", nil))
+		return rec.Code
+	}
+
+	// Not-found and client cancellations are not database failures
+	for _, err := range []error{pgx.ErrNoRows, context.Canceled, pgx.ErrNoRows, context.Canceled} {
+		dbErr = err
+		call()
+	}
+	if b.State() != BreakerClosed {
+		t.Fatalf("Expected breaker to stay closed, got %s", b.State())
+	}
+
+	dbErr = context.DeadlineExceeded
+	for i := 0; i < 3; i++ {
+		if code := call(); code != http.StatusGatewayTimeout {
+			t.Fatalf("Call %d: expected 504 from the handler, got %d", i, code)
+		}
+	}
+	if b.State() != BreakerOpen || b.Trips() != 1 {
+		t.Fatalf("Expected breaker open after 3 failures, got %s (trips %d)", b.State(), b.Trips())
+	}
+
+	dbErr = nil
+	if code := call(); code != http.StatusServiceUnavailable {
+		t.Fatalf("Expected fast 503 while open, got %d", code)
+	}
+	if b.Rejected() != 1 {
+		t.Errorf("Expected 1 rejected request, got %d", b.Rejected())
+	}
+
+	// Failed probe reopens for another cooldown
+	now = now.Add(10 * time.Second)
+	dbErr = errors.New("connection refused")
+	if code := call(); code != http.StatusInternalServerError {
+		t.Fatalf("Expected probe to reach the handler, got %d", code)
+	}
+	if b.State() != BreakerOpen || b.Trips() != 2 {
+		t.Fatalf("Expected failed probe to reopen, got %s (trips %d)", b.State(), b.Trips())
+	}
+
+	// Successful probe closes
+	now = now.Add(10 * time.Second)
+	dbErr = nil
+	if code := call(); code != http.StatusOK {
+		t.Fatalf("Expected probe to succeed, got %d", code)
+	}
+	if b.State() != BreakerClosed {
+		t.Fatalf("Expected successful probe to close the breaker, got %s", b.State())
+	}
+}
+
+func TestDBBreakerSingleProbe(t *testing.T) {
+	now := time.Now()
+	b := NewDBBreaker(1, time.Second)
+	b.now = func() time.Time { return now }
+
+	ticket, _ := b.allow()
+	b.record(ticket, dbFailed)
+	now = now.Add(time.Second)
+
+	probe, ok := b.allow()
+	if !ok || !probe.probe {
+		t.Fatal("Expected the first request after cooldown to probe")
+	}
+	if _, ok := b.allow(); ok {
+		t.Error("Expected requests during the probe to fail fast")
+	}
+
+	// An outcome from before the trip must not close the breaker
+	b.record(ticket, dbSucceeded)
+	if b.State() != BreakerHalfOpen {
+		t.Errorf("Expected stale outcome to be ignored, got %s", b.State())
+	}
+	b.record(probe, dbSucceeded)
+	if b.State() != BreakerClosed {
+		t.Errorf("Expected probe success to close, got %s", b.State())
+	}
+}
+
+func TestDBBreakerGuardReadsSkipsWrites(t *testing.T) {
+	b := NewDBBreaker(1, time.Minute)
+	ticket, _ := b.allow()
+	b.record(ticket, dbFailed)
+
+	handler := b.GuardReads(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	for method, want := range map[string]int{
+		http.MethodGet:    http.StatusServiceUnavailable,
+		http.MethodDelete: http.StatusNoContent,
+	} {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(method, "/", nil))
+		if rec.Code != want {
+			t.Errorf("%s: expected %d, got %d", method, want, rec.Code)
+		}
+	}
+}
+
+func TestDBBreakerProbeNeedsDatabaseOutcome(t *testing.T) {
+	now := time.Now()
+	b := NewDBBreaker(1, time.Second)
+	b.now = func() time.Time { return now }
+	ticket, _ := b.allow()
+	b.record(ticket, dbFailed)
+	now = now.Add(time.Second)
+
+	var dbErr error
+	reachDB := false
+	handler := b.Guard(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !reachDB {
+			SendError(w, r, http.StatusBadRequest, "INVALID_REQUEST", "bad limit", nil)
+			return
+		}
+		if HandleDBError(w, r, dbErr, "Monitor") {
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	call := func() int {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/monitors", nil))
+		return rec.Code
+	}
+
+	// A validation error never reached the database: the probe slot is freed, nothing more
+	if code := call(); code != http.StatusBadRequest {
+		t.Fatalf("Expected the probe to reach the handler, got %d", code)
+	}
+	if b.State() != BreakerHalfOpen {
+		t.Fatalf("Expected a non-database 400 to leave the breaker half-open, got %s", b.State())
+	}
+
+	// A cancelled client is just as inconclusive
+	reachDB, dbErr = true, context.Canceled
+	call()
+	if b.State() != BreakerHalfOpen {
+		t.Fatalf("Expected a cancelled probe to leave the breaker half-open, got %s", b.State())
+	}
+
+	dbErr = nil
+	if code := call(); code != http.StatusOK {
+		t.Fatalf("Expected the next probe to run, got %d", code)
+	}
+	if b.State() != BreakerClosed {
+		t.Fatalf("Expected a database success to close the breaker, got %s", b.State())
+	}
+}
+
+func TestDBBreakerCountsPanicAsFailure(t *testing.T) {
+	b := NewDBBreaker(1, time.Minute)
+	handler := b.Guard(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	}))
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("Expected the panic to propagate")
+			}
+		}()
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	}()
+	if b.State() != BreakerOpen {
+		t.Errorf("Expected a panicking handler to trip the breaker, got %s", b.State())
+	}
+}
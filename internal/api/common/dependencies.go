@@ -1,21 +1,100 @@
 package common
 
 import (
+	"context"
 	"log/slog"
 
+	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/nmslite/nmslite/internal/api/auth"
 	"github.com/nmslite/nmslite/internal/database/dbgen"
 	"github.com/nmslite/nmslite/internal/globals"
 	"github.com/nmslite/nmslite/internal/protocols"
 )
 
+// PluginLister lists the plugins loaded by the running plugin manager
+type PluginLister interface {
+	List() []*globals.PluginInfo
+	Stats() map[string]globals.PluginStats
+}
+
+// CollectorLister lists the protocols the scheduler polls in-process, without a plugin
+type CollectorLister interface {
+	CollectorProtocols() []string
+}
+
+// MetricSubmitter queues metric records for storage, blocking while its queue is full
+type MetricSubmitter interface {
+	Submit(ctx context.Context, record globals.MetricRecord) error
+}
+
+// SchedulerInspector exposes the running poll scheduler's state for administration
+type SchedulerInspector interface {
+	Snapshot() globals.SchedulerSnapshot
+	LoadActiveMonitors(ctx context.Context) error
+	EffectiveConfig(monitor dbgen.Monitor) globals.EffectiveMonitorConfig
+}
+
+// MetricQueue reports the metric writer's backlog
+type MetricQueue interface {
+	QueueDepth() int
+}
+
+// DiscoveryInspector reports the discovery worker's state
+type DiscoveryInspector interface {
+	Active() bool
+	RunningProfiles() int
+}
+
+// PipelineInspector reports the result of the latest metrics pipeline check
+type PipelineInspector interface {
+	PipelineHealth() globals.PipelineHealth
+}
+
+// DatabasePool is a connection pool whose connectivity and usage can be inspected
+type DatabasePool interface {
+	Ping(ctx context.Context) error
+	Stat() *pgxpool.Stat
+}
+
+// ReadPreference selects where a read-only handler's queries run
+type ReadPreference int
+
+const (
+	// ReadPrimary reads from the primary, for reads that must see the latest writes
+	ReadPrimary ReadPreference = iota
+	// ReadReplica reads from the replica when one is configured, falling back to the
+	// primary on connection errors; results may lag recent writes slightly
+	ReadReplica
+)
+
 // Dependencies holds common dependencies for API handlers
 type Dependencies struct {
-	Q        dbgen.Querier
+	Q dbgen.Querier
+	// ReplicaQ runs ReadReplica queries; nil sends them to Q
+	ReplicaQ dbgen.Querier
 	Auth     *auth.Service
 	Registry *protocols.Registry
-	Events   *globals.EventChannels
-	Logger   *slog.Logger
+	Plugins  PluginLister
+	// Collectors is nil when the API runs without a poll scheduler
+	Collectors CollectorLister
+	Metrics    MetricSubmitter
+	// Scheduler is nil when the API runs without a poll scheduler
+	Scheduler SchedulerInspector
+	// MetricQueue, Discovery, Pipeline and Pools feed the status report; each may be unset
+	MetricQueue MetricQueue
+	Discovery   DiscoveryInspector
+	Pipeline    PipelineInspector
+	Pools       map[string]DatabasePool
+	Events      *globals.EventChannels
+	Logger      *slog.Logger
+}
+
+// Reader returns the querier for read-only queries with the given preference
+func (d *Dependencies) Reader(pref ReadPreference) dbgen.Querier {
+	if pref == ReadReplica && d.ReplicaQ != nil {
+		return d.ReplicaQ
+	}
+	return d.Q
 }
 
 // Encrypt is a helper to encrypt data using the Auth service
@@ -1,14 +1,22 @@
 package common
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/nmslite/nmslite/internal/api/auth"
+	"github.com/nmslite/nmslite/internal/globals"
 )
 
 // SendJSON sends a JSON response
@@ -55,29 +63,164 @@ func ParseIDParam(w http.ResponseWriter, r *http.Request, param string) (int64,
 	return id, true
 }
 
+// ParseIncludeDeleted reads the optional ?include_deleted= flag used by list endpoints
+func ParseIncludeDeleted(w http.ResponseWriter, r *http.Request) (bool, bool) {
+	v := r.URL.Query().Get("include_deleted")
+	if v == "" {
+		return false, true
+	}
+	include, err := strconv.ParseBool(v)
+	if err != nil {
+		SendError(w, r, http.StatusBadRequest, "VALIDATION_ERROR", "include_deleted must be a boolean", nil)
+		return false, false
+	}
+	return include, true
+}
+
 // DecodeJSON decodes request body with error handling
 func DecodeJSON[T any](w http.ResponseWriter, r *http.Request) (T, bool) {
 	var input T
 	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
-		SendError(w, r, http.StatusBadRequest, "INVALID_BODY", "Invalid JSON body", err)
+		if !BodyTooLarge(w, r, err) {
+			SendError(w, r, http.StatusBadRequest, "INVALID_BODY", "Invalid JSON body", err)
+		}
 		return input, false
 	}
 	return input, true
 }
 
+// BodyTooLarge sends 413 if err came from reading past the request body limit
+func BodyTooLarge(w http.ResponseWriter, r *http.Request, err error) bool {
+	var tooLarge *http.MaxBytesError
+	if !errors.As(err, &tooLarge) {
+		return false
+	}
+	SendError(w, r, http.StatusRequestEntityTooLarge, "PAYLOAD_TOO_LARGE",
+		fmt.Sprintf("Request body exceeds %d bytes", tooLarge.Limit), nil)
+	return true
+}
+
 // HandleDBError sends appropriate error response for DB errors
 func HandleDBError(w http.ResponseWriter, r *http.Request, err error, entityName string) bool {
 	if err == nil {
+		markDBReached(r)
 		return false
 	}
 	if errors.Is(err, pgx.ErrNoRows) {
+		markDBReached(r)
 		SendError(w, r, http.StatusNotFound, "NOT_FOUND", entityName+" not found", nil)
+		return true
+	}
+
+	// A client that went away says nothing about database health
+	if errors.Is(err, context.Canceled) {
+		markDBInconclusive(r)
+	} else {
+		markDBFailure(r)
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		SendError(w, r, http.StatusGatewayTimeout, "QUERY_TIMEOUT", entityName+" query timed out", nil)
 	} else {
 		SendError(w, r, http.StatusInternalServerError, "DB_ERROR", "Database error", err)
 	}
 	return true
 }
 
+// QueryContext wraps the request context with the configured per-query timeout.
+// Callers must defer the returned cancel func.
+func QueryContext(r *http.Request) (context.Context, context.CancelFunc) {
+	markDBReached(r)
+	timeout := globals.GetConfig().Database.QueryTimeout()
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+	return context.WithTimeout(r.Context(), timeout)
+}
+
+// WriteContext wraps the request context with the configured timeout for writes that span
+// many statements, which the per-query read timeout would cut short.
+// Callers must defer the returned cancel func.
+func WriteContext(r *http.Request) (context.Context, context.CancelFunc) {
+	markDBReached(r)
+	timeout := globals.GetConfig().Database.WriteTimeout()
+	if timeout <= 0 {
+		timeout = 20 * time.Second
+	}
+	return context.WithTimeout(r.Context(), timeout)
+}
+
+// ExpectedVersion resolves the optimistic-concurrency precondition for an update.
+// A body version (the updated_at value the client last read) takes precedence over
+// the If-Unmodified-Since header. Returns an invalid Timestamptz when neither is set.
+func ExpectedVersion(r *http.Request, version *time.Time) (pgtype.Timestamptz, error) {
+	if version != nil {
+		return pgtype.Timestamptz{Time: *version, Valid: true}, nil
+	}
+
+	header := r.Header.Get("If-Unmodified-Since")
+	if header == "" {
+		return pgtype.Timestamptz{}, nil
+	}
+
+	t, err := http.ParseTime(header)
+	if err != nil {
+		return pgtype.Timestamptz{}, err
+	}
+	// HTTP dates have second precision; accept anything within that second
+	return pgtype.Timestamptz{Time: t.Add(time.Second - time.Microsecond), Valid: true}, nil
+}
+
+// SendVersionConflict sends a 409 carrying the entity's current version
+func SendVersionConflict(w http.ResponseWriter, r *http.Request, entityName string, current pgtype.Timestamptz) {
+	SendError(w, r, http.StatusConflict, "VERSION_CONFLICT",
+		entityName+" was modified by another request", map[string]interface{}{
+			"current_version": current.Time,
+		})
+}
+
+// SetLastModified exposes an entity's version for use with If-Unmodified-Since
+func SetLastModified(w http.ResponseWriter, updatedAt pgtype.Timestamptz) {
+	if updatedAt.Valid {
+		w.Header().Set("Last-Modified", updatedAt.Time.UTC().Format(http.TimeFormat))
+	}
+}
+
+// ETag builds a weak validator from the values identifying a representation's version,
+// e.g. an entity's ID and updated_at
+func ETag(parts ...interface{}) string {
+	h := sha256.New()
+	for _, p := range parts {
+		fmt.Fprintf(h, "%v\x00", p)
+	}
+	return `W/"` + hex.EncodeToString(h.Sum(nil)[:12]) + `"`
+}
+
+// NotModified sets the ETag header and, when the request's If-None-Match already holds
+// etag, writes a 304 and returns true. Callers must not write a body in that case.
+func NotModified(w http.ResponseWriter, r *http.Request, etag string) bool {
+	w.Header().Set("ETag", etag)
+	if !etagMatches(r.Header.Get("If-None-Match"), etag) {
+		return false
+	}
+	w.WriteHeader(http.StatusNotModified)
+	return true
+}
+
+// etagMatches applies the weak comparison If-None-Match calls for
+func etagMatches(header, etag string) bool {
+	if header == "" {
+		return false
+	}
+	want := strings.TrimPrefix(etag, "W/")
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || strings.TrimPrefix(tag, "W/") == want {
+			return true
+		}
+	}
+	return false
+}
+
 // SendListResponse sends a standardized list response
 func SendListResponse(w http.ResponseWriter, data interface{}, total int) {
 	SendJSON(w, http.StatusOK, map[string]interface{}{
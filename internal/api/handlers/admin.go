@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/nmslite/nmslite/internal/api/common"
+	"github.com/nmslite/nmslite/internal/globals"
+)
+
+// AdminHandler exposes runtime internals for operators debugging the poller
+type AdminHandler struct {
+	Deps *common.Dependencies
+}
+
+func NewAdminHandler(deps *common.Dependencies) *AdminHandler {
+	return &AdminHandler{Deps: deps}
+}
+
+// SchedulerState handles GET /api/v1/admin/scheduler
+func (h *AdminHandler) SchedulerState(w http.ResponseWriter, r *http.Request) {
+	if h.Deps.Scheduler == nil {
+		common.SendError(w, r, http.StatusServiceUnavailable, "SCHEDULER_UNAVAILABLE", "Scheduler not running", nil)
+		return
+	}
+	common.SendJSON(w, http.StatusOK, h.Deps.Scheduler.Snapshot())
+}
+
+// ReloadScheduler handles POST /api/v1/admin/scheduler/reload. It re-reads the active
+// monitors from the database and returns the resulting snapshot.
+func (h *AdminHandler) ReloadScheduler(w http.ResponseWriter, r *http.Request) {
+	if h.Deps.Scheduler == nil {
+		common.SendError(w, r, http.StatusServiceUnavailable, "SCHEDULER_UNAVAILABLE", "Scheduler not running", nil)
+		return
+	}
+	ctx, cancel := common.QueryContext(r)
+	defer cancel()
+
+	if common.HandleDBError(w, r, h.Deps.Scheduler.LoadActiveMonitors(ctx), "Active monitors") {
+		return
+	}
+	common.SendJSON(w, http.StatusOK, h.Deps.Scheduler.Snapshot())
+}
+
+// DroppedEventsResponse lists the most recent events producers could not deliver
+type DroppedEventsResponse struct {
+	// Enabled is false when channel.record_dropped_events is off; drops are then only
+	// counted (see the channels in GET /api/v1/status)
+	Enabled bool                   `json:"enabled"`
+	Events  []globals.DroppedEvent `json:"events"`
+}
+
+// DroppedEvents handles GET /api/v1/admin/events/dropped
+func (h *AdminHandler) DroppedEvents(w http.ResponseWriter, r *http.Request) {
+	if h.Deps.Events == nil {
+		common.SendError(w, r, http.StatusServiceUnavailable, "EVENTS_UNAVAILABLE", "Event bus not running", nil)
+		return
+	}
+	events, enabled := h.Deps.Events.DroppedEvents()
+	common.SendJSON(w, http.StatusOK, DroppedEventsResponse{Enabled: enabled, Events: events})
+}
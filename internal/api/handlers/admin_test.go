@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/nmslite/nmslite/internal/api/common"
+	"github.com/nmslite/nmslite/internal/database/dbgen"
+	"github.com/nmslite/nmslite/internal/globals"
+)
+
+// fakeScheduler reports a fixed snapshot and counts reloads
+type fakeScheduler struct {
+	reloads   int
+	reloadErr error
+}
+
+func (s *fakeScheduler) Snapshot() globals.SchedulerSnapshot {
+	return globals.SchedulerSnapshot{Running: true, TrackedMonitors: 4 + s.reloads, HeapSize: 4}
+}
+
+func (s *fakeScheduler) EffectiveConfig(monitor dbgen.Monitor) globals.EffectiveMonitorConfig {
+	return globals.EffectiveMonitorConfig{MonitorID: monitor.ID, PluginID: monitor.PluginID, Port: 22, PortSource: "protocol_default"}
+}
+
+func (s *fakeScheduler) LoadActiveMonitors(ctx context.Context) error {
+	if s.reloadErr != nil {
+		return s.reloadErr
+	}
+	s.reloads++
+	return nil
+}
+
+func TestAdminHandlerScheduler(t *testing.T) {
+	globals.SetGlobalConfigForTests(&globals.Config{})
+
+	testCases := []struct {
+		name        string
+		scheduler   *fakeScheduler
+		reload      bool
+		wantStatus  int
+		wantTracked int
+	}{
+		{"Snapshot", &fakeScheduler{}, false, http.StatusOK, 4},
+		{"Reload returns refreshed snapshot", &fakeScheduler{}, true, http.StatusOK, 5},
+		{"Reload failure", &fakeScheduler{reloadErr: errors.New("connection refused")}, true, http.StatusInternalServerError, 0},
+		{"No scheduler", nil, false, http.StatusServiceUnavailable, 0},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			deps := &common.Dependencies{}
+			if tc.scheduler != nil {
+				deps.Scheduler = tc.scheduler
+			}
+			h := NewAdminHandler(deps)
+
+			rec := httptest.NewRecorder()
+			if tc.reload {
+				h.ReloadScheduler(rec, httptest.NewRequest(http.MethodPost, "/api/v1/admin/scheduler/reload", nil))
+			} else {
+				h.SchedulerState(rec, httptest.NewRequest(http.MethodGet, "/api/v1/admin/scheduler", nil))
+			}
+
+			if rec.Code != tc.wantStatus {
+				t.Fatalf("Expected status %d, got %d (body: %s)", tc.wantStatus, rec.Code, rec.Body.String())
+			}
+			if tc.wantStatus != http.StatusOK {
+				return
+			}
+			var snap globals.SchedulerSnapshot
+			if err := json.Unmarshal(rec.Body.Bytes(), &snap); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if snap.TrackedMonitors != tc.wantTracked {
+				t.Errorf("Expected %d tracked monitors, got %d", tc.wantTracked, snap.TrackedMonitors)
+			}
+		})
+	}
+}
+
+func TestAdminHandlerDroppedEvents(t *testing.T) {
+	testCases := []struct {
+		name        string
+		record      bool
+		noEvents    bool
+		wantStatus  int
+		wantEnabled bool
+		wantEvents  int
+	}{
+		{"Recording on", true, false, http.StatusOK, true, 1},
+		{"Recording off", false, false, http.StatusOK, false, 0},
+		{"No event bus", false, true, http.StatusServiceUnavailable, false, 0},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			globals.SetGlobalConfigForTests(&globals.Config{Channel: globals.EventBusConfig{RecordDroppedEvents: tc.record}})
+			deps := &common.Dependencies{}
+			if !tc.noEvents {
+				deps.Events = globals.NewEventChannels()
+				deps.Events.RecordDropped(globals.ChannelMonitorState, globals.DropChannelFull, globals.MonitorStateEvent{MonitorID: 4})
+			}
+
+			rec := httptest.NewRecorder()
+			NewAdminHandler(deps).DroppedEvents(rec, httptest.NewRequest(http.MethodGet, "/api/v1/admin/events/dropped", nil))
+
+			if rec.Code != tc.wantStatus {
+				t.Fatalf("Expected status %d, got %d (body: %s)", tc.wantStatus, rec.Code, rec.Body.String())
+			}
+			if tc.wantStatus != http.StatusOK {
+				return
+			}
+			var resp DroppedEventsResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if resp.Enabled != tc.wantEnabled || len(resp.Events) != tc.wantEvents {
+				t.Errorf("Expected enabled=%v with %d events, got enabled=%v with %d", tc.wantEnabled, tc.wantEvents, resp.Enabled, len(resp.Events))
+			}
+			if tc.wantEvents > 0 && resp.Events[0].Channel != globals.ChannelMonitorState {
+				t.Errorf("Expected a %s event, got %+v", globals.ChannelMonitorState, resp.Events[0])
+			}
+		})
+	}
+}
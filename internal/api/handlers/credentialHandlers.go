@@ -1,31 +1,52 @@
 package handlers
 
 import (
-	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"time"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/nmslite/nmslite/internal/api/common"
 	"github.com/nmslite/nmslite/internal/database/dbgen"
+	"github.com/nmslite/nmslite/internal/discovery"
 	"github.com/nmslite/nmslite/internal/globals"
 	"github.com/nmslite/nmslite/internal/protocols"
 )
 
 // CredentialHandler handles credential profile endpoints
 type CredentialHandler struct {
-	Deps *common.Dependencies
+	Deps   *common.Dependencies
+	tester *discovery.CredentialTester
 }
 
 func NewCredentialHandler(deps *common.Dependencies) *CredentialHandler {
 	return &CredentialHandler{
-		Deps: deps,
+		Deps:   deps,
+		tester: discovery.NewCredentialTester(),
 	}
 }
 
-// List handles GET requests
+// List handles GET requests; ?include_deleted=true also returns soft-deleted profiles
 func (h *CredentialHandler) List(w http.ResponseWriter, r *http.Request) {
-	profiles, err := h.Deps.Q.ListCredentialProfiles(r.Context())
+	includeDeleted, ok := common.ParseIncludeDeleted(w, r)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := common.QueryContext(r)
+	defer cancel()
+
+	version, err := h.Deps.Q.GetCredentialProfilesVersion(ctx, includeDeleted)
+	if common.HandleDBError(w, r, err, "Credential Profile") {
+		return
+	}
+	if common.NotModified(w, r, common.ETag("credential_profiles", includeDeleted, version.Total, version.LastModified.UnixNano())) {
+		return
+	}
+
+	profiles, err := h.Deps.Q.ListCredentialProfiles(ctx, includeDeleted)
 	if common.HandleDBError(w, r, err, "Credential Profile") {
 		return
 	}
@@ -87,10 +108,17 @@ func (h *CredentialHandler) Get(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	profile, err := h.Deps.Q.GetCredentialProfile(r.Context(), id)
+	ctx, cancel := common.QueryContext(r)
+	defer cancel()
+
+	profile, err := h.Deps.Q.GetCredentialProfile(ctx, id)
 	if common.HandleDBError(w, r, err, "Credential Profile") {
 		return
 	}
+	common.SetLastModified(w, profile.UpdatedAt)
+	if common.NotModified(w, r, common.ETag("credential_profile", profile.ID, profile.UpdatedAt.Time.UnixNano())) {
+		return
+	}
 	// Decrypt
 	var encryptedStr string
 	if err := json.Unmarshal(profile.Payload, &encryptedStr); err == nil {
@@ -101,62 +129,141 @@ func (h *CredentialHandler) Get(w http.ResponseWriter, r *http.Request) {
 	common.SendJSON(w, http.StatusOK, profile)
 }
 
-// Update handles PUT/PATCH /{id} requests
+// Update handles PUT/PATCH /{id} requests. Omitted fields keep their current values; in
+// particular, leaving out payload keeps the stored secret, so a profile can be renamed
+// without resending it. A new payload, or the kept one under a new protocol, is validated.
 func (h *CredentialHandler) Update(w http.ResponseWriter, r *http.Request) {
 	id, ok := common.ParseIDParam(w, r, "id")
 	if !ok {
 		return
 	}
 
-	input, ok := common.DecodeJSON[dbgen.CredentialProfile](w, r)
+	body, ok := common.DecodeJSON[credentialUpdateRequest](w, r)
 	if !ok {
 		return
 	}
+	input := body.CredentialProfile
 
-	// Validate if protocol/data provided
-	if input.Protocol != "" && len(input.Payload) > 0 {
-		if err := validateCredentials(h.Deps.Registry, input.Protocol, input.Payload); err != nil {
+	expected, err := common.ExpectedVersion(r, body.Version)
+	if err != nil {
+		common.SendError(w, r, http.StatusBadRequest, "INVALID_PRECONDITION", "Invalid If-Unmodified-Since header", err)
+		return
+	}
+
+	existing, err := h.Deps.Q.GetCredentialProfile(r.Context(), id)
+	if common.HandleDBError(w, r, err, "Credential Profile") {
+		return
+	}
+	if expected.Valid && existing.UpdatedAt.Time.After(expected.Time) {
+		common.SendVersionConflict(w, r, "Credential Profile", existing.UpdatedAt)
+		return
+	}
+	// The merge below rewrites every column, so it only applies to the version it was
+	// built from; a concurrent update in between is reported as a conflict
+	if !expected.Valid {
+		expected = existing.UpdatedAt
+	}
+
+	// Merge: fields present in the request replace the stored ones
+	params := dbgen.UpdateCredentialProfileParams{
+		ID:              id,
+		Name:            existing.Name,
+		Description:     existing.Description,
+		Protocol:        existing.Protocol,
+		Payload:         existing.Payload,
+		UnmodifiedSince: expected,
+	}
+	if input.Name != "" {
+		params.Name = input.Name
+	}
+	if input.Description.Valid {
+		params.Description = input.Description
+	}
+	if input.Protocol != "" {
+		params.Protocol = input.Protocol
+	}
+
+	if len(input.Payload) > 0 && string(input.Payload) != "null" {
+		if err := validateCredentials(h.Deps.Registry, params.Protocol, input.Payload); err != nil {
 			common.SendError(w, r, http.StatusBadRequest, "VALIDATION_ERROR", err.Error(), nil)
 			return
 		}
-	}
-
-	// Encrypt if present
-	if len(input.Payload) > 0 {
 		encrypted, err := h.Deps.Encrypt(input.Payload)
 		if err != nil {
 			common.SendError(w, r, http.StatusInternalServerError, "ENCRYPTION_ERROR", "Failed to encrypt payload", err)
 			return
 		}
-		input.Payload = json.RawMessage(fmt.Sprintf("%q", encrypted))
+		params.Payload = json.RawMessage(fmt.Sprintf("%q", encrypted))
+	} else if params.Protocol != existing.Protocol {
+		// The stored secret must also suit the new protocol. Legacy payloads stored before
+		// encryption are plain JSON and are validated as they are.
+		stored := existing.Payload
+		var encryptedStr string
+		if err := json.Unmarshal(existing.Payload, &encryptedStr); err == nil {
+			decrypted, err := h.Deps.Decrypt(encryptedStr)
+			if err != nil {
+				common.SendError(w, r, http.StatusInternalServerError, "DECRYPTION_ERROR", "Failed to decrypt stored payload", err)
+				return
+			}
+			stored = decrypted
+		}
+		if err := validateCredentials(h.Deps.Registry, params.Protocol, stored); err != nil {
+			common.SendError(w, r, http.StatusBadRequest, "VALIDATION_ERROR",
+				fmt.Sprintf("stored payload is not valid for protocol %s, send a new payload: %v", params.Protocol, err), nil)
+			return
+		}
 	}
 
-	params := dbgen.UpdateCredentialProfileParams{
-		ID:          id,
-		Name:        input.Name,
-		Description: input.Description,
-		Protocol:    input.Protocol,
-		Payload:     input.Payload,
-	}
 	profile, err := h.Deps.Q.UpdateCredentialProfile(r.Context(), params)
+	if errors.Is(err, pgx.ErrNoRows) {
+		// Distinguish a failed version check from a missing profile
+		current, getErr := h.Deps.Q.GetCredentialProfile(r.Context(), id)
+		if getErr == nil {
+			common.SendVersionConflict(w, r, "Credential Profile", current.UpdatedAt)
+			return
+		}
+	}
 	if common.HandleDBError(w, r, err, "Credential Profile") {
 		return
 	}
 
 	// Push update to monitors
-	h.pushUpdate(r.Context(), id)
+	h.pushUpdate(r, id)
 
 	common.SendJSON(w, http.StatusOK, profile)
 }
 
-// Delete handles DELETE /{id} requests
+// credentialUpdateRequest is a credential profile update with an optional optimistic-concurrency version
+type credentialUpdateRequest struct {
+	dbgen.CredentialProfile
+	Version *time.Time `json:"version,omitempty"`
+}
+
+// Delete handles DELETE /{id} requests. The profile is soft-deleted, and only once no
+// live monitor or discovery profile still uses it.
 func (h *CredentialHandler) Delete(w http.ResponseWriter, r *http.Request) {
 	id, ok := common.ParseIDParam(w, r, "id")
 	if !ok {
 		return
 	}
 
-	err := h.Deps.Q.DeleteCredentialProfile(r.Context(), id)
+	refs, err := h.Deps.Q.CountCredentialProfileReferences(r.Context(), id)
+	if common.HandleDBError(w, r, err, "Credential Profile") {
+		return
+	}
+	if refs.Monitors > 0 || refs.DiscoveryProfiles > 0 {
+		common.SendError(w, r, http.StatusConflict, "CREDENTIAL_IN_USE",
+			"Credential Profile is still used by monitors or discovery profiles", map[string]interface{}{
+				"monitors":           refs.Monitors,
+				"discovery_profiles": refs.DiscoveryProfiles,
+			})
+		return
+	}
+
+	deleted, err := h.Deps.Q.DeleteCredentialProfile(r.Context(), id)
+	if err == nil && deleted == 0 {
+		err = pgx.ErrNoRows
+	}
 	if common.HandleDBError(w, r, err, "Credential Profile") {
 		return
 	}
@@ -164,12 +271,41 @@ func (h *CredentialHandler) Delete(w http.ResponseWriter, r *http.Request) {
 	common.SendJSON(w, http.StatusNoContent, nil)
 }
 
+// Restore handles POST /{id}/restore, undoing a soft delete
+func (h *CredentialHandler) Restore(w http.ResponseWriter, r *http.Request) {
+	id, ok := common.ParseIDParam(w, r, "id")
+	if !ok {
+		return
+	}
+
+	profile, err := h.Deps.Q.RestoreCredentialProfile(r.Context(), id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		common.SendError(w, r, http.StatusNotFound, "NOT_FOUND", "Deleted Credential Profile not found", nil)
+		return
+	}
+	if common.HandleDBError(w, r, err, "Credential Profile") {
+		return
+	}
+	var encryptedStr string
+	if err := json.Unmarshal(profile.Payload, &encryptedStr); err == nil {
+		if decrypted, err := h.Deps.Decrypt(encryptedStr); err == nil {
+			profile.Payload = decrypted
+		}
+	}
+
+	common.SendJSON(w, http.StatusOK, profile)
+}
+
 // pushUpdate fetches all monitors using this credential profile and pushes them to scheduler
-func (h *CredentialHandler) pushUpdate(ctx context.Context, credentialID int64) {
+// as one event
+func (h *CredentialHandler) pushUpdate(r *http.Request, credentialID int64) {
 	if h.Deps.Events == nil {
 		return
 	}
+	ctx, cancel := cachePushContext(r)
+	defer cancel()
 
+	seq := globals.NextCacheInvalidateSeq()
 	monitors, err := h.Deps.Q.GetMonitorsWithCredentialsByCredentialID(ctx, credentialID)
 	if err != nil {
 		if h.Deps.Logger != nil {
@@ -197,14 +333,18 @@ func (h *CredentialHandler) pushUpdate(ctx context.Context, credentialID int64)
 			Status:                 m.Status,
 			CreatedAt:              m.CreatedAt,
 			UpdatedAt:              m.UpdatedAt,
+			Collectors:             m.Collectors,
+			KeepPollingWhenDown:    m.KeepPollingWhenDown,
+			Tags:                   m.Tags,
 			Payload:                m.Payload,
 		})
 	}
 
-	h.Deps.Events.CacheInvalidate <- globals.CacheInvalidateEvent{
+	pushCacheInvalidate(ctx, h.Deps, globals.CacheInvalidateEvent{
 		UpdateType: "update",
 		Monitors:   updates,
-	}
+		Seq:        seq,
+	})
 }
 
 func validateCredentials(registry *protocols.Registry, protocol string, data json.RawMessage) error {
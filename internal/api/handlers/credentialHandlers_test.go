@@ -0,0 +1,275 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/nmslite/nmslite/internal/api/auth"
+	"github.com/nmslite/nmslite/internal/api/common"
+	"github.com/nmslite/nmslite/internal/database/dbgen"
+	"github.com/nmslite/nmslite/internal/globals"
+	"github.com/nmslite/nmslite/internal/protocols"
+)
+
+func TestCredentialHandlerDelete(t *testing.T) {
+	globals.SetGlobalConfigForTests(&globals.Config{})
+
+	testCases := []struct {
+		name       string
+		path       string
+		wantStatus int
+		wantCode   string
+	}{
+		{"Unused profile soft-deleted", "/1", http.StatusNoContent, ""},
+		{"Profile in use", "/2", http.StatusConflict, "CREDENTIAL_IN_USE"},
+		{"Unknown or already deleted profile", "/3", http.StatusNotFound, "NOT_FOUND"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			q := newFakeQuerier()
+			q.credentials[1] = dbgen.CredentialProfile{ID: 1, Protocol: "ssh"}
+			q.credentials[2] = dbgen.CredentialProfile{ID: 2, Protocol: "ssh"}
+			for id := int64(1); id <= 3; id++ {
+				q.monitors[id] = dbgen.Monitor{ID: id, CredentialProfileID: 2}
+			}
+			q.discoveryProfiles[1] = dbgen.DiscoveryProfile{ID: 1, CredentialProfileID: 2}
+			h := NewCredentialHandler(&common.Dependencies{Q: q})
+
+			r := chi.NewRouter()
+			r.Delete("/{id}", h.Delete)
+
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, tc.path, nil))
+
+			if rec.Code != tc.wantStatus {
+				t.Fatalf("Expected status %d, got %d (body: %s)", tc.wantStatus, rec.Code, rec.Body.String())
+			}
+			if tc.wantCode == "" {
+				return
+			}
+			var resp struct {
+				Error struct {
+					Code    string         `json:"code"`
+					Details map[string]int `json:"details"`
+				} `json:"error"`
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if resp.Error.Code != tc.wantCode {
+				t.Errorf("Expected code %s, got %s", tc.wantCode, resp.Error.Code)
+			}
+			if tc.wantCode == "CREDENTIAL_IN_USE" {
+				if resp.Error.Details["monitors"] != 3 || resp.Error.Details["discovery_profiles"] != 1 {
+					t.Errorf("Expected reference counts in details, got %v", resp.Error.Details)
+				}
+				if q.credentials[2].DeletedAt.Valid {
+					t.Error("Expected profile in use to stay live")
+				}
+			}
+		})
+	}
+}
+
+func TestCredentialHandlerListIncludeDeleted(t *testing.T) {
+	globals.SetGlobalConfigForTests(&globals.Config{})
+
+	testCases := []struct {
+		name        string
+		query       string
+		wantStatus  int
+		wantInclude bool
+	}{
+		{"Default hides deleted", "", http.StatusOK, false},
+		{"Include deleted", "?include_deleted=true", http.StatusOK, true},
+		{"Invalid flag", "?include_deleted=maybe", http.StatusBadRequest, false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			q := newFakeQuerier()
+			h := NewCredentialHandler(&common.Dependencies{Q: q})
+
+			rec := httptest.NewRecorder()
+			h.List(rec, httptest.NewRequest(http.MethodGet, "/"+tc.query, nil))
+
+			if rec.Code != tc.wantStatus {
+				t.Fatalf("Expected status %d, got %d (body: %s)", tc.wantStatus, rec.Code, rec.Body.String())
+			}
+			if include := lastArgs[bool](q, "ListCredentialProfiles"); include != tc.wantInclude {
+				t.Errorf("Expected include_deleted=%v, got %v", tc.wantInclude, include)
+			}
+		})
+	}
+}
+
+func TestCredentialHandlerUpdateMergesPayload(t *testing.T) {
+	globals.SetGlobalConfigForTests(&globals.Config{})
+
+	authService, err := auth.NewService("0123456789abcdef0123456789abcdef", "0123456789abcdef0123456789abcdef", "admin", "admin", time.Hour)
+	if err != nil {
+		t.Fatalf("Failed to create auth service: %v", err)
+	}
+	const secret = `{"username":"nms","password":"secret"}`
+	encrypted, err := authService.Encrypt([]byte(secret))
+	if err != nil {
+		t.Fatalf("Failed to encrypt: %v", err)
+	}
+	stored, _ := json.Marshal(encrypted)
+
+	testCases := []struct {
+		name         string
+		method       string
+		body         string
+		wantStatus   int
+		wantName     string
+		wantProtocol string
+		wantSecret   string // decrypted payload after the update, "" when unchanged
+	}{
+		{"Rename keeps secret", http.MethodPatch, `{"name":"renamed"}`, http.StatusOK, "renamed", "ssh", ""},
+		{"Null payload keeps secret", http.MethodPut, `{"name":"renamed","payload":null}`, http.StatusOK, "renamed", "ssh", ""},
+		{"New payload replaces secret", http.MethodPut, `{"payload":{"username":"nms","password":"rotated"}}`, http.StatusOK, "linux", "ssh", `{"username":"nms","password":"rotated"}`},
+		{"New payload validated against stored protocol", http.MethodPut, `{"payload":{"community":"public"}}`, http.StatusBadRequest, "linux", "ssh", ""},
+		{"Protocol change keeps compatible secret", http.MethodPatch, `{"protocol":"windows-winrm"}`, http.StatusOK, "linux", "windows-winrm", ""},
+		{"Protocol change rejects incompatible secret", http.MethodPatch, `{"protocol":"snmp-v2c"}`, http.StatusBadRequest, "linux", "ssh", ""},
+		{"Protocol change accepts legacy plaintext secret", http.MethodPatch, `{"protocol":"windows-winrm"}`, http.StatusOK, "linux", "windows-winrm", ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			stored := stored
+			if strings.Contains(tc.name, "plaintext") {
+				stored = json.RawMessage(secret)
+			}
+			q := newFakeQuerier()
+			q.credentials[1] = dbgen.CredentialProfile{ID: 1, Name: "linux", Protocol: "ssh", Payload: stored}
+			h := NewCredentialHandler(&common.Dependencies{Q: q, Auth: authService, Registry: protocols.GetRegistry()})
+
+			r := chi.NewRouter()
+			r.Put("/{id}", h.Update)
+			r.Patch("/{id}", h.Update)
+
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, httptest.NewRequest(tc.method, "/1", strings.NewReader(tc.body)))
+
+			if rec.Code != tc.wantStatus {
+				t.Fatalf("Expected status %d, got %d (body: %s)", tc.wantStatus, rec.Code, rec.Body.String())
+			}
+			if updates := q.calls["UpdateCredentialProfile"]; tc.wantStatus != http.StatusOK && updates != 0 {
+				t.Errorf("Expected no update on a rejected request, got %d", updates)
+			}
+			profile := q.credentials[1]
+			if profile.Name != tc.wantName || profile.Protocol != tc.wantProtocol {
+				t.Errorf("Expected %s/%s, got %s/%s", tc.wantName, tc.wantProtocol, profile.Name, profile.Protocol)
+			}
+
+			if tc.wantSecret == "" {
+				if string(profile.Payload) != string(stored) {
+					t.Errorf("Expected the stored secret to be kept, got %s", profile.Payload)
+				}
+				return
+			}
+			var encryptedStr string
+			if err := json.Unmarshal(profile.Payload, &encryptedStr); err != nil {
+				t.Fatalf("Expected an encrypted payload, got %s", profile.Payload)
+			}
+			decrypted, err := authService.Decrypt(encryptedStr)
+			if err != nil {
+				t.Fatalf("Failed to decrypt stored payload: %v", err)
+			}
+			if string(decrypted) != tc.wantSecret {
+				t.Errorf("Expected secret %s, got %s", tc.wantSecret, decrypted)
+			}
+		})
+	}
+
+	// A concurrent update between the read and the write is a conflict, not a silent overwrite
+	updatedAt := pgtype.Timestamptz{Time: time.Now().Add(-time.Minute), Valid: true}
+	q := newFakeQuerier()
+	q.credentials[1] = dbgen.CredentialProfile{ID: 1, Name: "linux", Protocol: "ssh", Payload: stored, UpdatedAt: updatedAt}
+	q.racer = func(q *fakeQuerier) {
+		p := q.credentials[1]
+		p.Description = text("set concurrently")
+		p.UpdatedAt = pgtype.Timestamptz{Time: updatedAt.Time.Add(time.Second), Valid: true}
+		q.credentials[1] = p
+	}
+	h := NewCredentialHandler(&common.Dependencies{Q: q, Auth: authService, Registry: protocols.GetRegistry()})
+	r := chi.NewRouter()
+	r.Patch("/{id}", h.Update)
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodPatch, "/1", strings.NewReader(`{"name":"renamed"}`)))
+	if rec.Code != http.StatusConflict {
+		t.Errorf("Expected status 409 for a concurrent update, got %d (body: %s)", rec.Code, rec.Body.String())
+	}
+	if p := q.credentials[1]; p.Name != "linux" || p.Description.String != "set concurrently" {
+		t.Errorf("Expected the concurrent update to be kept, got %+v", p)
+	}
+
+	// Unknown profiles are still reported as missing
+	h = NewCredentialHandler(&common.Dependencies{Q: newFakeQuerier(), Auth: authService, Registry: protocols.GetRegistry()})
+	r = chi.NewRouter()
+	r.Put("/{id}", h.Update)
+	rec = httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/9", strings.NewReader(`{"name":"renamed"}`)))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for an unknown profile, got %d", rec.Code)
+	}
+}
+
+func TestCredentialHandlerUpdateVersionConflict(t *testing.T) {
+	globals.SetGlobalConfigForTests(&globals.Config{})
+	updatedAt := time.Date(2025, 12, 17, 10, 30, 15, 250000000, time.UTC)
+
+	testCases := []struct {
+		name       string
+		body       string
+		header     string
+		wantStatus int
+	}{
+		{"No precondition", `{"name": "renamed"}`, "", http.StatusOK},
+		{"Matching body version", `{"name": "renamed", "version": "2025-12-17T10:30:15.25Z"}`, "", http.StatusOK},
+		{"Stale body version", `{"name": "renamed", "version": "2025-12-17T10:30:15Z"}`, "", http.StatusConflict},
+		{"Matching If-Unmodified-Since", `{"name": "renamed"}`, "Wed, 17 Dec 2025 10:30:15 GMT", http.StatusOK},
+		{"Stale If-Unmodified-Since", `{"name": "renamed"}`, "Wed, 17 Dec 2025 10:30:14 GMT", http.StatusConflict},
+		{"Malformed If-Unmodified-Since", `{"name": "renamed"}`, "yesterday", http.StatusBadRequest},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			q := newFakeQuerier()
+			q.credentials[1] = dbgen.CredentialProfile{ID: 1, Name: "linux", Protocol: "ssh", UpdatedAt: pgtype.Timestamptz{Time: updatedAt, Valid: true}}
+			h := NewCredentialHandler(&common.Dependencies{Q: q, Registry: protocols.GetRegistry()})
+
+			r := chi.NewRouter()
+			r.Patch("/{id}", h.Update)
+
+			req := httptest.NewRequest(http.MethodPatch, "/1", strings.NewReader(tc.body))
+			if tc.header != "" {
+				req.Header.Set("If-Unmodified-Since", tc.header)
+			}
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, req)
+
+			if rec.Code != tc.wantStatus {
+				t.Fatalf("Expected status %d, got %d (body: %s)", tc.wantStatus, rec.Code, rec.Body.String())
+			}
+			if tc.wantStatus == http.StatusOK {
+				return
+			}
+			if q.credentials[1].Name != "linux" {
+				t.Errorf("Expected a rejected update to keep the stored profile, got %+v", q.credentials[1])
+			}
+			if tc.wantStatus == http.StatusConflict && (!strings.Contains(rec.Body.String(), `"code":"VERSION_CONFLICT"`) ||
+				!strings.Contains(rec.Body.String(), `"current_version":"2025-12-17T10:30:15.25Z"`)) {
+				t.Errorf("Expected a version conflict carrying the current version, got %s", rec.Body.String())
+			}
+		})
+	}
+}
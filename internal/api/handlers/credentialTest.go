@@ -0,0 +1,151 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/nmslite/nmslite/internal/api/auth"
+	"github.com/nmslite/nmslite/internal/api/common"
+	"github.com/nmslite/nmslite/internal/discovery"
+	"github.com/nmslite/nmslite/internal/globals"
+	"github.com/nmslite/nmslite/internal/protocols"
+)
+
+// maxCredentialTestTargets bounds how many targets one credential test may contact
+const maxCredentialTestTargets = 256
+
+// CredentialTestRequest is the body of POST /api/v1/credentials/{id}/test
+type CredentialTestRequest struct {
+	Targets []string `json:"targets"`
+	// Port overrides the protocol's default port for every target
+	Port int `json:"port,omitempty"`
+}
+
+// CredentialTestResult is the handshake outcome for one target
+type CredentialTestResult struct {
+	Target     string `json:"target"`
+	Port       int    `json:"port"`
+	Success    bool   `json:"success"`
+	Hostname   string `json:"hostname,omitempty"`
+	Error      string `json:"error,omitempty"`
+	DurationMS int64  `json:"duration_ms"`
+}
+
+// CredentialTestResponse lists results in the order the handshakes completed
+type CredentialTestResponse struct {
+	CredentialProfileID int64                  `json:"credential_profile_id"`
+	Protocol            string                 `json:"protocol"`
+	Results             []CredentialTestResult `json:"results"`
+	Succeeded           int                    `json:"succeeded"`
+	Failed              int                    `json:"failed"`
+}
+
+// Test handles POST /{id}/test. It decrypts the profile and handshakes with each target
+// on a bounded pool (discovery.credential_test_workers at once, each within
+// discovery.credential_test_timeout_ms), so one unreachable target does not hold up the
+// rest. If the client disconnects, targets not yet contacted are reported as cancelled.
+func (h *CredentialHandler) Test(w http.ResponseWriter, r *http.Request) {
+	id, ok := common.ParseIDParam(w, r, "id")
+	if !ok {
+		return
+	}
+	input, ok := common.DecodeJSON[CredentialTestRequest](w, r)
+	if !ok {
+		return
+	}
+
+	var targets []string
+	for _, target := range input.Targets {
+		target = strings.TrimSpace(target)
+		if target != "" && !slices.Contains(targets, target) {
+			targets = append(targets, target)
+		}
+	}
+	switch {
+	case len(targets) == 0:
+		common.SendError(w, r, http.StatusBadRequest, "VALIDATION_ERROR", "At least one target is required", nil)
+		return
+	case len(targets) > maxCredentialTestTargets:
+		common.SendError(w, r, http.StatusBadRequest, "VALIDATION_ERROR",
+			fmt.Sprintf("At most %d targets per test", maxCredentialTestTargets), nil)
+		return
+	case input.Port < 0 || input.Port > 65535:
+		common.SendError(w, r, http.StatusBadRequest, "VALIDATION_ERROR", globals.PortRangeMessage, nil)
+		return
+	}
+	if h.Deps.Auth == nil {
+		common.SendError(w, r, http.StatusServiceUnavailable, "CREDENTIAL_TEST_UNAVAILABLE", "Credential decryption is not available", nil)
+		return
+	}
+
+	ctx, cancel := common.QueryContext(r)
+	defer cancel()
+
+	profile, err := h.Deps.Q.GetCredentialProfile(ctx, id)
+	if common.HandleDBError(w, r, err, "Credential Profile") {
+		return
+	}
+	creds, err := auth.NewCredentialService(h.Deps.Auth, h.Deps.Q).DecryptContainer(profile.Payload)
+	if err != nil {
+		common.SendError(w, r, http.StatusInternalServerError, "DECRYPT_FAILED", "Credential profile could not be decrypted", nil)
+		return
+	}
+
+	port := input.Port
+	if port == 0 {
+		port = h.defaultPort(profile.Protocol, creds.UseHTTPS)
+	}
+
+	checks := make([]discovery.HandshakeCheck, 0, len(targets))
+	for _, target := range targets {
+		checks = append(checks, discovery.HandshakeCheck{Target: target, Port: port, Protocol: profile.Protocol, Creds: creds})
+	}
+
+	// Handshakes run for as long as the client waits, not the query timeout
+	resp := CredentialTestResponse{
+		CredentialProfileID: id,
+		Protocol:            profile.Protocol,
+		Results:             make([]CredentialTestResult, 0, len(checks)),
+	}
+	for outcome := range h.tester.Run(r.Context(), checks) {
+		result := CredentialTestResult{
+			Target:     outcome.Target,
+			Port:       outcome.Port,
+			Success:    outcome.Success,
+			Hostname:   outcome.Hostname,
+			DurationMS: outcome.Duration.Milliseconds(),
+		}
+		if outcome.Err != nil {
+			result.Error = outcome.Err.Error()
+		}
+		if result.Success {
+			resp.Succeeded++
+		} else {
+			resp.Failed++
+		}
+		resp.Results = append(resp.Results, result)
+	}
+
+	common.SendJSON(w, http.StatusOK, resp)
+}
+
+// defaultPort is the loaded plugin's manifest default_port for protocol, falling back to
+// the protocol's well-known port, as discovery uses. With tls the protocol's well-known
+// TLS port comes first.
+func (h *CredentialHandler) defaultPort(protocol string, tls bool) int {
+	if tls {
+		if port := protocols.GetRegistry().DefaultTLSPort(protocol); port > 0 {
+			return port
+		}
+	}
+	if h.Deps.Plugins != nil {
+		for _, p := range h.Deps.Plugins.List() {
+			if p.Protocol == protocol && p.DefaultPort > 0 {
+				return p.DefaultPort
+			}
+		}
+	}
+	return protocols.GetRegistry().DefaultPort(protocol)
+}
@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/nmslite/nmslite/internal/api/auth"
+	"github.com/nmslite/nmslite/internal/api/common"
+	"github.com/nmslite/nmslite/internal/database/dbgen"
+	"github.com/nmslite/nmslite/internal/globals"
+)
+
+// closedPort returns a local port with nothing listening on it
+func closedPort(t *testing.T) int {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	port := l.Addr().(*net.TCPAddr).Port
+	l.Close()
+	return port
+}
+
+func TestCredentialHandlerTest(t *testing.T) {
+	globals.SetGlobalConfigForTests(&globals.Config{Discovery: globals.DiscoveryConfig{CredentialTestWorkers: 2, CredentialTestTimeoutMS: 1000}})
+
+	authService, err := auth.NewService("0123456789abcdef0123456789abcdef", "0123456789abcdef0123456789abcdef", "admin", "admin", time.Hour)
+	if err != nil {
+		t.Fatalf("Failed to create auth service: %v", err)
+	}
+	encrypted, err := authService.Encrypt([]byte(`{"username":"nms","password":"secret"}`))
+	if err != nil {
+		t.Fatalf("Failed to encrypt: %v", err)
+	}
+	payload, _ := json.Marshal(encrypted)
+	port := strconv.Itoa(closedPort(t))
+
+	tooMany := make([]string, maxCredentialTestTargets+1)
+	for i := range tooMany {
+		tooMany[i] = fmt.Sprintf("10.0.%d.%d", i/256, i%256)
+	}
+	tooManyBody, _ := json.Marshal(CredentialTestRequest{Targets: tooMany})
+
+	testCases := []struct {
+		name       string
+		path       string
+		body       string
+		noAuth     bool
+		wantStatus int
+		wantFailed int
+	}{
+		{"Unreachable targets", "/1/test", `{"targets":["127.0.0.1"," 127.0.0.1 ","127.0.0.2"],"port":` + port + `}`, false, http.StatusOK, 2},
+		{"No targets", "/1/test", `{"targets":[" "]}`, false, http.StatusBadRequest, 0},
+		{"Too many targets", "/1/test", string(tooManyBody), false, http.StatusBadRequest, 0},
+		{"Invalid port", "/1/test", `{"targets":["127.0.0.1"],"port":70000}`, false, http.StatusBadRequest, 0},
+		{"Unknown profile", "/9/test", `{"targets":["127.0.0.1"]}`, false, http.StatusNotFound, 0},
+		{"Without decryption", "/1/test", `{"targets":["127.0.0.1"]}`, true, http.StatusServiceUnavailable, 0},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			q := newFakeQuerier()
+			q.credentials[1] = dbgen.CredentialProfile{ID: 1, Protocol: "ssh", Payload: payload}
+			deps := &common.Dependencies{Q: q, Auth: authService}
+			if tc.noAuth {
+				deps.Auth = nil
+			}
+			h := NewCredentialHandler(deps)
+			r := chi.NewRouter()
+			r.Post("/{id}/test", h.Test)
+
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, tc.path, strings.NewReader(tc.body)))
+
+			if rec.Code != tc.wantStatus {
+				t.Fatalf("Expected status %d, got %d (body: %s)", tc.wantStatus, rec.Code, rec.Body.String())
+			}
+			if rec.Code != http.StatusOK {
+				return
+			}
+			var resp CredentialTestResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if resp.Failed != tc.wantFailed || len(resp.Results) != tc.wantFailed || resp.Succeeded != 0 {
+				t.Errorf("Expected %d failed results, got %+v", tc.wantFailed, resp)
+			}
+			for _, result := range resp.Results {
+				if result.Error == "" {
+					t.Errorf("Expected an error for %s, got none", result.Target)
+				}
+			}
+			if strings.Contains(rec.Body.String(), "secret") {
+				t.Errorf("Response must not expose credentials, got %s", rec.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,161 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/nmslite/nmslite/internal/api/common"
+	"github.com/nmslite/nmslite/internal/database/dbgen"
+	"github.com/nmslite/nmslite/internal/discovery"
+)
+
+// Page sizes for POST /api/v1/admin/credentials/verify, per kind of secret
+const (
+	defaultVerifyLimit = 500
+	maxVerifyLimit     = 5000
+)
+
+// Reasons a stored secret fails verification. Errors are reduced to these so no part of
+// a ciphertext or plaintext reaches the response. Unencrypted marks a discovery target
+// stored in plaintext by an older release: discovery still uses it, but it should be
+// saved again to encrypt it.
+const (
+	verifyDecryptFailed  = "decrypt_failed"
+	verifyInvalidPayload = "invalid_payload"
+	verifyUnencrypted    = "unencrypted"
+)
+
+// VerifyFailure names a stored secret that no longer decrypts or was never encrypted
+type VerifyFailure struct {
+	ID     int64  `json:"id"`
+	Name   string `json:"name"`
+	Reason string `json:"reason"`
+}
+
+// VerifySection reports one page of a kind of secret. NextAfter is set when the page was
+// full; pass it back as the matching *_after parameter to continue.
+type VerifySection struct {
+	Checked   int             `json:"checked"`
+	Failed    []VerifyFailure `json:"failed"`
+	NextAfter *int64          `json:"next_after,omitempty"`
+}
+
+// CredentialVerifyResponse is the result of POST /api/v1/admin/credentials/verify
+type CredentialVerifyResponse struct {
+	CredentialProfiles VerifySection `json:"credential_profiles"`
+	DiscoveryProfiles  VerifySection `json:"discovery_profiles"`
+}
+
+// VerifyCredentials handles POST /api/v1/admin/credentials/verify. It decrypts a page of
+// credential profile payloads and discovery profile targets with the current encryption
+// key and reports the IDs that fail, e.g. after a key rotation. Query parameters:
+// limit (per kind, default 500, at most 5000), credential_after and discovery_after
+// (resume after these IDs).
+func (h *AdminHandler) VerifyCredentials(w http.ResponseWriter, r *http.Request) {
+	limit, ok := verifyParam(w, r, "limit", defaultVerifyLimit, 1, maxVerifyLimit)
+	if !ok {
+		return
+	}
+	credentialAfter, ok := verifyParam(w, r, "credential_after", 0, 0, -1)
+	if !ok {
+		return
+	}
+	discoveryAfter, ok := verifyParam(w, r, "discovery_after", 0, 0, -1)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := common.QueryContext(r)
+	defer cancel()
+
+	credentials, err := h.Deps.Q.ListCredentialPayloadsPage(ctx, dbgen.ListCredentialPayloadsPageParams{
+		AfterID:    int64(credentialAfter),
+		LimitCount: int32(limit),
+	})
+	if common.HandleDBError(w, r, err, "Credential profiles") {
+		return
+	}
+	targets, err := h.Deps.Q.ListDiscoveryTargetsPage(ctx, dbgen.ListDiscoveryTargetsPageParams{
+		AfterID:    int64(discoveryAfter),
+		LimitCount: int32(limit),
+	})
+	if common.HandleDBError(w, r, err, "Discovery profiles") {
+		return
+	}
+
+	resp := CredentialVerifyResponse{
+		CredentialProfiles: VerifySection{Checked: len(credentials), Failed: []VerifyFailure{}},
+		DiscoveryProfiles:  VerifySection{Checked: len(targets), Failed: []VerifyFailure{}},
+	}
+	for _, c := range credentials {
+		if reason := h.verifyPayload(c.Payload); reason != "" {
+			resp.CredentialProfiles.Failed = append(resp.CredentialProfiles.Failed, VerifyFailure{ID: c.ID, Name: c.Name, Reason: reason})
+		}
+	}
+	for _, t := range targets {
+		if reason := h.verifyTarget(t.TargetValue); reason != "" {
+			resp.DiscoveryProfiles.Failed = append(resp.DiscoveryProfiles.Failed, VerifyFailure{ID: t.ID, Name: t.Name, Reason: reason})
+		}
+	}
+	if len(credentials) == limit {
+		resp.CredentialProfiles.NextAfter = &credentials[len(credentials)-1].ID
+	}
+	if len(targets) == limit {
+		resp.DiscoveryProfiles.NextAfter = &targets[len(targets)-1].ID
+	}
+
+	common.SendJSON(w, http.StatusOK, resp)
+}
+
+// verifyPayload decrypts a credential payload the way the poller does (a JSON string
+// holding the ciphertext) and checks it holds a JSON object. It returns the failure
+// reason, or "" when the payload is usable.
+func (h *AdminHandler) verifyPayload(payload json.RawMessage) string {
+	var encrypted string
+	if err := json.Unmarshal(payload, &encrypted); err != nil {
+		encrypted = string(payload)
+	}
+	decrypted, err := h.Deps.Decrypt(encrypted)
+	if err != nil {
+		return verifyDecryptFailed
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(decrypted, &fields); err != nil {
+		return verifyInvalidPayload
+	}
+	return ""
+}
+
+// verifyTarget decrypts a discovery target value. A value that does not decrypt but has a
+// target's format (IP, CIDR or range) is a legacy plaintext target, which discovery accepts as is. It
+// returns the failure reason, or "" when the target decrypts.
+func (h *AdminHandler) verifyTarget(value string) string {
+	if _, err := h.Deps.Decrypt(value); err == nil {
+		return ""
+	}
+	if discovery.DetectTargetType(value) != discovery.TargetTypeUnknown {
+		return verifyUnencrypted
+	}
+	return verifyDecryptFailed
+}
+
+// verifyParam parses an optional integer query parameter within [lo, hi] (hi < 0 means
+// no upper bound), writing a 400 and returning false when it is invalid
+func verifyParam(w http.ResponseWriter, r *http.Request, name string, def, lo, hi int) (int, bool) {
+	v := r.URL.Query().Get(name)
+	if v == "" {
+		return def, true
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < lo || (hi >= 0 && n > hi) {
+		msg := fmt.Sprintf("%s must be an integer of at least %d", name, lo)
+		if hi >= 0 {
+			msg = fmt.Sprintf("%s must be between %d and %d", name, lo, hi)
+		}
+		common.SendError(w, r, http.StatusBadRequest, "INVALID_REQUEST", msg, nil)
+		return 0, false
+	}
+	return n, true
+}
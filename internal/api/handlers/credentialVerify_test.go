@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nmslite/nmslite/internal/api/auth"
+	"github.com/nmslite/nmslite/internal/api/common"
+	"github.com/nmslite/nmslite/internal/database/dbgen"
+	"github.com/nmslite/nmslite/internal/globals"
+)
+
+func TestAdminHandlerVerifyCredentials(t *testing.T) {
+	globals.SetGlobalConfigForTests(&globals.Config{})
+
+	current, err := auth.NewService("0123456789abcdef0123456789abcdef", "0123456789abcdef0123456789abcdef", "admin", "admin", time.Hour)
+	if err != nil {
+		t.Fatalf("Failed to create auth service: %v", err)
+	}
+	previous, err := auth.NewService("0123456789abcdef0123456789abcdef", "fedcba9876543210fedcba9876543210", "admin", "admin", time.Hour)
+	if err != nil {
+		t.Fatalf("Failed to create auth service: %v", err)
+	}
+	payload := func(s *auth.Service, plaintext string) json.RawMessage {
+		encrypted, err := s.Encrypt([]byte(plaintext))
+		if err != nil {
+			t.Fatalf("Failed to encrypt: %v", err)
+		}
+		raw, _ := json.Marshal(encrypted)
+		return raw
+	}
+	target := func(s *auth.Service, plaintext string) string {
+		encrypted, err := s.Encrypt([]byte(plaintext))
+		if err != nil {
+			t.Fatalf("Failed to encrypt: %v", err)
+		}
+		return encrypted
+	}
+
+	q := newFakeQuerier()
+	q.credentials[1] = dbgen.CredentialProfile{ID: 1, Name: "ok", Payload: payload(current, `{"username":"nms","password":"secret"}`)}
+	q.credentials[2] = dbgen.CredentialProfile{ID: 2, Name: "old key", Payload: payload(previous, `{"username":"nms","password":"secret"}`)}
+	q.credentials[3] = dbgen.CredentialProfile{ID: 3, Name: "not an object", Payload: payload(current, `secret`)}
+	q.discoveryProfiles[4] = dbgen.DiscoveryProfile{ID: 4, Name: "ok", TargetValue: target(current, "192.0.2.0/24")}
+	q.discoveryProfiles[5] = dbgen.DiscoveryProfile{ID: 5, Name: "old key", TargetValue: target(previous, "192.0.2.0/24")}
+	q.discoveryProfiles[6] = dbgen.DiscoveryProfile{ID: 6, Name: "legacy", TargetValue: "192.0.2.0/24"}
+	h := NewAdminHandler(&common.Dependencies{Q: q, Auth: current})
+
+	verify := func(query string) (*httptest.ResponseRecorder, CredentialVerifyResponse) {
+		rec := httptest.NewRecorder()
+		h.VerifyCredentials(rec, httptest.NewRequest(http.MethodPost, "/api/v1/admin/credentials/verify"+query, nil))
+		var resp CredentialVerifyResponse
+		if rec.Code == http.StatusOK {
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+		}
+		return rec, resp
+	}
+
+	rec, resp := verify("")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d (body: %s)", rec.Code, rec.Body.String())
+	}
+	if resp.CredentialProfiles.Checked != 3 || resp.DiscoveryProfiles.Checked != 3 {
+		t.Errorf("Expected 3 credentials and 3 targets checked, got %d and %d", resp.CredentialProfiles.Checked, resp.DiscoveryProfiles.Checked)
+	}
+	wantFailed := []VerifyFailure{{2, "old key", verifyDecryptFailed}, {3, "not an object", verifyInvalidPayload}}
+	if len(resp.CredentialProfiles.Failed) != 2 || resp.CredentialProfiles.Failed[0] != wantFailed[0] || resp.CredentialProfiles.Failed[1] != wantFailed[1] {
+		t.Errorf("Expected failures %v, got %v", wantFailed, resp.CredentialProfiles.Failed)
+	}
+	wantTargets := []VerifyFailure{{5, "old key", verifyDecryptFailed}, {6, "legacy", verifyUnencrypted}}
+	if len(resp.DiscoveryProfiles.Failed) != 2 || resp.DiscoveryProfiles.Failed[0] != wantTargets[0] || resp.DiscoveryProfiles.Failed[1] != wantTargets[1] {
+		t.Errorf("Expected target failures %v, got %v", wantTargets, resp.DiscoveryProfiles.Failed)
+	}
+	if resp.CredentialProfiles.NextAfter != nil || resp.DiscoveryProfiles.NextAfter != nil {
+		t.Error("Expected no next page when everything fit")
+	}
+	if strings.Contains(rec.Body.String(), "secret") || strings.Contains(rec.Body.String(), "192.0.2") {
+		t.Errorf("Response must not expose plaintext, got %s", rec.Body.String())
+	}
+
+	// Paging: one of each per request, resuming after the returned IDs
+	_, resp = verify("?limit=1")
+	if resp.CredentialProfiles.NextAfter == nil || *resp.CredentialProfiles.NextAfter != 1 {
+		t.Fatalf("Expected credential paging to resume after 1, got %v", resp.CredentialProfiles.NextAfter)
+	}
+	_, resp = verify("?limit=1&credential_after=1&discovery_after=4")
+	if len(resp.CredentialProfiles.Failed) != 1 || resp.CredentialProfiles.Failed[0].ID != 2 {
+		t.Errorf("Expected the second page to report credential 2, got %v", resp.CredentialProfiles.Failed)
+	}
+	if len(resp.DiscoveryProfiles.Failed) != 1 || resp.DiscoveryProfiles.Failed[0].ID != 5 {
+		t.Errorf("Expected the second page to report discovery profile 5, got %v", resp.DiscoveryProfiles.Failed)
+	}
+
+	for _, query := range []string{"?limit=0", "?limit=5001", "?credential_after=-1", "?discovery_after=x"} {
+		if rec, _ := verify(query); rec.Code != http.StatusBadRequest {
+			t.Errorf("Expected status 400 for %s, got %d", query, rec.Code)
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"net/netip"
+	"strconv"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/nmslite/nmslite/internal/api/common"
+	"github.com/nmslite/nmslite/internal/database/dbgen"
+	"github.com/nmslite/nmslite/internal/discovery"
+	"github.com/nmslite/nmslite/internal/protocols"
+)
+
+// Page sizes for GET /api/v1/discovered-devices
+const (
+	defaultDeviceListLimit = 100
+	maxDeviceListLimit     = 1000
+)
+
+// maxBulkProvision caps the device_ids of one bulk provision request (one inventory page)
+const maxBulkProvision = maxDeviceListLimit
+
+// BulkProvisionRequest is the body of POST /api/v1/discovered-devices/provision
+type BulkProvisionRequest struct {
+	DeviceIDs []int64 `json:"device_ids"`
+	// Overrides applied to every monitor created
+	PollingIntervalSeconds pgtype.Int4 `json:"polling_interval_seconds"`
+	KeepPollingWhenDown    bool        `json:"keep_polling_when_down"`
+}
+
+// BulkProvisionResponse reports the outcome for each requested device
+type BulkProvisionResponse struct {
+	Results          []discovery.ProvisionResult `json:"results"`
+	Provisioned      int                         `json:"provisioned"`
+	AlreadyMonitored int                         `json:"already_monitored"`
+	Failed           int                         `json:"failed"`
+}
+
+// DiscoveredDeviceList is one page of the fleet-wide discovered device inventory
+type DiscoveredDeviceList struct {
+	Data  []dbgen.ListDiscoveredDevicesFilteredRow `json:"data"`
+	Total int64                                    `json:"total"` // matching devices across all pages
+	// NextBefore is set when the page was full; pass it back as ?before= to continue
+	NextBefore *int64 `json:"next_before,omitempty"`
+}
+
+// ListDevices handles GET /api/v1/discovered-devices: the devices found by every
+// discovery profile, newest first. Optional filters: status, profile_id, ip (an address
+// or a CIDR range) and provisioned (true or false). Pages hold limit devices (default
+// 100, at most 1000); before continues from a previous page's next_before.
+func (h *DiscoveryHandler) ListDevices(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	limit, ok := verifyParam(w, r, "limit", defaultDeviceListLimit, 1, maxDeviceListLimit)
+	if !ok {
+		return
+	}
+	before, ok := verifyParam(w, r, "before", 0, 1, -1)
+	if !ok {
+		return
+	}
+	profileID, ok := verifyParam(w, r, "profile_id", 0, 1, -1)
+	if !ok {
+		return
+	}
+
+	pluginIDs, defaultPorts := defaultPortsByPlugin()
+	filter := dbgen.CountDiscoveredDevicesFilteredParams{
+		Status:       pgtype.Text{String: query.Get("status"), Valid: query.Get("status") != ""},
+		ProfileID:    pgtype.Int8{Int64: int64(profileID), Valid: profileID > 0},
+		PluginIds:    pluginIDs,
+		DefaultPorts: defaultPorts,
+	}
+	if v := query.Get("ip"); v != "" {
+		prefix, err := parseIPFilter(v)
+		if err != nil {
+			common.SendError(w, r, http.StatusBadRequest, "INVALID_REQUEST",
+				"ip must be an IP address or CIDR range", nil)
+			return
+		}
+		filter.Ip = &prefix
+	}
+	if v := query.Get("provisioned"); v != "" {
+		provisioned, err := strconv.ParseBool(v)
+		if err != nil {
+			common.SendError(w, r, http.StatusBadRequest, "INVALID_REQUEST",
+				"provisioned must be true or false", nil)
+			return
+		}
+		filter.Provisioned = pgtype.Bool{Bool: provisioned, Valid: true}
+	}
+
+	ctx, cancel := common.QueryContext(r)
+	defer cancel()
+	q := h.Deps.Reader(common.ReadReplica)
+
+	rows, err := q.ListDiscoveredDevicesFiltered(ctx, dbgen.ListDiscoveredDevicesFilteredParams{
+		PluginIds:    filter.PluginIds,
+		DefaultPorts: filter.DefaultPorts,
+		Status:       filter.Status,
+		ProfileID:    filter.ProfileID,
+		Ip:           filter.Ip,
+		Provisioned:  filter.Provisioned,
+		BeforeID:     int64(before),
+		LimitCount:   int32(limit),
+	})
+	if common.HandleDBError(w, r, err, "Discovered devices") {
+		return
+	}
+	total, err := q.CountDiscoveredDevicesFiltered(ctx, filter)
+	if common.HandleDBError(w, r, err, "Discovered devices") {
+		return
+	}
+
+	resp := DiscoveredDeviceList{Data: rows, Total: total}
+	if resp.Data == nil {
+		resp.Data = []dbgen.ListDiscoveredDevicesFilteredRow{}
+	}
+	if len(rows) == limit {
+		resp.NextBefore = &rows[len(rows)-1].ID
+	}
+
+	common.SendJSON(w, http.StatusOK, resp)
+}
+
+// ProvisionMany handles POST /api/v1/discovered-devices/provision: creates monitors for a
+// list of discovered devices in one transaction. Devices that cannot be provisioned are
+// reported per item; a database error fails the whole request and creates nothing.
+func (h *DeviceHandler) ProvisionMany(w http.ResponseWriter, r *http.Request) {
+	input, ok := common.DecodeJSON[BulkProvisionRequest](w, r)
+	if !ok {
+		return
+	}
+	if len(input.DeviceIDs) == 0 || len(input.DeviceIDs) > maxBulkProvision {
+		common.SendError(w, r, http.StatusBadRequest, "VALIDATION_ERROR",
+			fmt.Sprintf("device_ids must list between 1 and %d devices", maxBulkProvision), nil)
+		return
+	}
+	if err := validatePollingInterval(input.PollingIntervalSeconds); err != nil {
+		common.SendError(w, r, http.StatusBadRequest, "VALIDATION_ERROR", err.Error(), nil)
+		return
+	}
+
+	ctx, cancel := common.WriteContext(r)
+	defer cancel()
+	results, err := h.provisioner.ProvisionDevices(ctx, input.DeviceIDs, discovery.ProvisionOverrides{
+		PollingIntervalSeconds: input.PollingIntervalSeconds,
+		KeepPollingWhenDown:    input.KeepPollingWhenDown,
+	})
+	if err != nil {
+		common.SendError(w, r, http.StatusInternalServerError, "PROVISION_ERROR", "Failed to provision devices", err)
+		return
+	}
+
+	resp := BulkProvisionResponse{Results: results}
+	for _, result := range results {
+		switch result.Status {
+		case discovery.ProvisionCreated:
+			resp.Provisioned++
+		case discovery.ProvisionAlreadyMonitored:
+			resp.AlreadyMonitored++
+		default:
+			resp.Failed++
+		}
+	}
+	common.SendJSON(w, http.StatusOK, resp)
+}
+
+// defaultPortsByPlugin returns each registered protocol's default port as the parallel
+// plugin_ids and default_ports arrays the inventory queries match portless monitors with
+func defaultPortsByPlugin() ([]string, []int32) {
+	var pluginIDs []string
+	var ports []int32
+	for _, p := range protocols.GetRegistry().ListProtocols() {
+		pluginIDs = append(pluginIDs, p.ID)
+		ports = append(ports, int32(p.DefaultPort))
+	}
+	return pluginIDs, ports
+}
+
+// parseIPFilter accepts a single address (matched exactly) or a CIDR range
+func parseIPFilter(v string) (netip.Prefix, error) {
+	if addr, err := netip.ParseAddr(v); err == nil {
+		return netip.PrefixFrom(addr, addr.BitLen()), nil
+	}
+	prefix, err := netip.ParsePrefix(v)
+	return prefix.Masked(), err
+}
@@ -0,0 +1,156 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/nmslite/nmslite/internal/api/common"
+	"github.com/nmslite/nmslite/internal/database/dbgen"
+	"github.com/nmslite/nmslite/internal/discovery"
+	"github.com/nmslite/nmslite/internal/globals"
+)
+
+func TestDiscoveryHandlerListDevices(t *testing.T) {
+	globals.SetGlobalConfigForTests(&globals.Config{})
+
+	device := func(id, profile int64, ip, status string) dbgen.DiscoveredDevice {
+		return dbgen.DiscoveredDevice{
+			ID:                 id,
+			DiscoveryProfileID: pgtype.Int8{Int64: profile, Valid: true},
+			IpAddress:          netip.MustParseAddr(ip),
+			Port:               22,
+			Status:             pgtype.Text{String: status, Valid: true},
+		}
+	}
+	q := newFakeQuerier()
+	for _, d := range []dbgen.DiscoveredDevice{
+		device(5, 2, "10.1.0.1", "validated"),
+		device(4, 1, "10.0.0.3", "validated"),
+		device(3, 1, "10.0.0.2", "provisioned"),
+		device(2, 2, "10.0.0.2", "validated"),
+		device(1, 1, "10.0.0.1", "provisioned"),
+	} {
+		q.devices[d.ID] = d
+	}
+	q.monitors[7] = dbgen.Monitor{ID: 7, IpAddress: netip.MustParseAddr("10.0.0.2"), Port: pgtype.Int4{Int32: 22, Valid: true}}
+	// No port: polls the ssh default, which is the device's
+	q.monitors[8] = dbgen.Monitor{ID: 8, IpAddress: netip.MustParseAddr("10.0.0.1"), PluginID: "ssh"}
+	h := NewDiscoveryHandler(&common.Dependencies{Q: q})
+
+	testCases := []struct {
+		name        string
+		query       string
+		wantStatus  int
+		wantIDs     []int64
+		wantTotal   int64
+		wantNext    int64
+		wantMonitor map[int64]int64 // device ID -> monitor ID for provisioned devices
+	}{
+		{"All devices", "", http.StatusOK, []int64{5, 4, 3, 2, 1}, 5, 0, map[int64]int64{3: 7, 2: 7, 1: 8}},
+		{"One profile", "?profile_id=2", http.StatusOK, []int64{5, 2}, 2, 0, nil},
+		{"Validated but not monitored", "?status=validated&provisioned=false", http.StatusOK, []int64{5, 4}, 2, 0, nil},
+		{"Monitored", "?provisioned=true", http.StatusOK, []int64{3, 2, 1}, 3, 0, nil},
+		{"Single address", "?ip=10.0.0.2", http.StatusOK, []int64{3, 2}, 2, 0, nil},
+		{"CIDR range", "?ip=10.0.0.0/24", http.StatusOK, []int64{4, 3, 2, 1}, 4, 0, nil},
+		{"First page", "?limit=2", http.StatusOK, []int64{5, 4}, 5, 4, nil},
+		{"Next page", "?limit=2&before=4", http.StatusOK, []int64{3, 2}, 5, 2, nil},
+		{"Invalid ip", "?ip=10.0.0", http.StatusBadRequest, nil, 0, 0, nil},
+		{"Invalid provisioned", "?provisioned=maybe", http.StatusBadRequest, nil, 0, 0, nil},
+		{"Limit too large", "?limit=5000", http.StatusBadRequest, nil, 0, 0, nil},
+		{"Invalid profile", "?profile_id=0", http.StatusBadRequest, nil, 0, 0, nil},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			h.ListDevices(rec, httptest.NewRequest(http.MethodGet, "/api/v1/discovered-devices"+tc.query, nil))
+
+			if rec.Code != tc.wantStatus {
+				t.Fatalf("Expected status %d, got %d (body: %s)", tc.wantStatus, rec.Code, rec.Body.String())
+			}
+			if tc.wantStatus != http.StatusOK {
+				return
+			}
+
+			var resp DiscoveredDeviceList
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			var ids []int64
+			for _, d := range resp.Data {
+				ids = append(ids, d.ID)
+				if tc.wantMonitor == nil {
+					continue
+				}
+				want, ok := tc.wantMonitor[d.ID]
+				if d.Provisioned != ok || d.MonitorID.Valid != ok || d.MonitorID.Int64 != want {
+					t.Errorf("Device %d: expected provisioned=%v monitor %d, got provisioned=%v monitor %v",
+						d.ID, ok, want, d.Provisioned, d.MonitorID.Int64)
+				}
+			}
+			if fmt.Sprint(ids) != fmt.Sprint(tc.wantIDs) {
+				t.Errorf("Expected devices %v, got %v", tc.wantIDs, ids)
+			}
+			if resp.Total != tc.wantTotal {
+				t.Errorf("Expected total %d, got %d", tc.wantTotal, resp.Total)
+			}
+			var next int64
+			if resp.NextBefore != nil {
+				next = *resp.NextBefore
+			}
+			if next != tc.wantNext {
+				t.Errorf("Expected next_before %d, got %d", tc.wantNext, next)
+			}
+		})
+	}
+}
+
+func TestDeviceHandlerProvisionMany(t *testing.T) {
+	globals.SetGlobalConfigForTests(&globals.Config{})
+
+	q := newFakeQuerier()
+	tx := func(ctx context.Context, fn func(q dbgen.Querier) error) error { return fn(q) }
+	h := NewDeviceHandler(nil, discovery.NewProvisioner(q, tx, globals.NewEventChannels(), nil, slog.Default()))
+
+	tooMany := strings.TrimSuffix(strings.Repeat("1,", maxBulkProvision+1), ",")
+	testCases := []struct {
+		name       string
+		body       string
+		wantStatus int
+		wantFailed int
+	}{
+		{"Unknown devices fail per item", `{"device_ids":[1,2,2]}`, http.StatusOK, 2},
+		{"No devices", `{"device_ids":[]}`, http.StatusBadRequest, 0},
+		{"Too many devices", `{"device_ids":[` + tooMany + `]}`, http.StatusBadRequest, 0},
+		{"Interval out of bounds", `{"device_ids":[1],"polling_interval_seconds":1}`, http.StatusBadRequest, 0},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			h.ProvisionMany(rec, httptest.NewRequest(http.MethodPost, "/api/v1/discovered-devices/provision", strings.NewReader(tc.body)))
+
+			if rec.Code != tc.wantStatus {
+				t.Fatalf("Expected status %d, got %d (body: %s)", tc.wantStatus, rec.Code, rec.Body.String())
+			}
+			if tc.wantStatus != http.StatusOK {
+				return
+			}
+			var resp BulkProvisionResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if resp.Failed != tc.wantFailed || len(resp.Results) != tc.wantFailed || resp.Provisioned != 0 {
+				t.Errorf("Expected %d failed results, got %+v", tc.wantFailed, resp)
+			}
+		})
+	}
+}
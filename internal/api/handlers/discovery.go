@@ -2,30 +2,55 @@ package handlers
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/nmslite/nmslite/internal/api/common"
 	"github.com/nmslite/nmslite/internal/database/dbgen"
+	"github.com/nmslite/nmslite/internal/discovery"
 	"github.com/nmslite/nmslite/internal/globals"
 )
 
 // DiscoveryHandler handles discovery profile endpoints
 type DiscoveryHandler struct {
 	Deps *common.Dependencies
+
+	// runKeys replays run responses for repeated Idempotency-Keys
+	runKeys *idempotencyCache
 }
 
 func NewDiscoveryHandler(deps *common.Dependencies) *DiscoveryHandler {
 	return &DiscoveryHandler{
-		Deps: deps,
+		Deps:    deps,
+		runKeys: newIdempotencyCache(globals.GetConfig().Discovery.IdempotencyTTL()),
 	}
 }
 
-// List handles GET requests
+// List handles GET requests; ?include_deleted=true also returns soft-deleted profiles
 func (h *DiscoveryHandler) List(w http.ResponseWriter, r *http.Request) {
-	profiles, err := h.Deps.Q.ListDiscoveryProfiles(r.Context())
+	includeDeleted, ok := common.ParseIncludeDeleted(w, r)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := common.QueryContext(r)
+	defer cancel()
+
+	version, err := h.Deps.Q.GetDiscoveryProfilesVersion(ctx, includeDeleted)
+	if common.HandleDBError(w, r, err, "Discovery Profile") {
+		return
+	}
+	if common.NotModified(w, r, common.ETag("discovery_profiles", includeDeleted, version.Total, version.LastModified.UnixNano())) {
+		return
+	}
+
+	profiles, err := h.Deps.Q.ListDiscoveryProfiles(ctx, includeDeleted)
 	if common.HandleDBError(w, r, err, "Discovery Profile") {
 		return
 	}
@@ -48,6 +73,19 @@ func (h *DiscoveryHandler) Create(w http.ResponseWriter, r *http.Request) {
 		common.SendError(w, r, http.StatusBadRequest, "VALIDATION_ERROR", "Name and TargetValue are required", nil)
 		return
 	}
+	if err := validateScheduleInterval(input.IntervalSeconds); err != nil {
+		common.SendError(w, r, http.StatusBadRequest, "VALIDATION_ERROR", err.Error(), nil)
+		return
+	}
+	if !resolvePorts(w, r, &input) {
+		return
+	}
+	if _, ok := checkTargetSize(w, r, input.TargetValue, len(input.Ports)); !ok {
+		return
+	}
+	if !h.resolveCredentialIDs(w, r, &input) {
+		return
+	}
 
 	encrypted, err := h.Deps.Encrypt([]byte(input.TargetValue))
 	if err != nil {
@@ -63,6 +101,10 @@ func (h *DiscoveryHandler) Create(w http.ResponseWriter, r *http.Request) {
 		CredentialProfileID: input.CredentialProfileID,
 		AutoProvision:       input.AutoProvision,
 		AutoRun:             input.AutoRun,
+		IntervalSeconds:     input.IntervalSeconds,
+
+		CredentialProfileIds: input.CredentialProfileIds,
+		Ports:                input.Ports,
 	}
 
 	profile, err := h.Deps.Q.CreateDiscoveryProfile(r.Context(), params)
@@ -84,10 +126,16 @@ func (h *DiscoveryHandler) Get(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	profile, err := h.Deps.Q.GetDiscoveryProfile(r.Context(), id)
+	ctx, cancel := common.QueryContext(r)
+	defer cancel()
+
+	profile, err := h.Deps.Q.GetDiscoveryProfile(ctx, id)
 	if common.HandleDBError(w, r, err, "Discovery Profile") {
 		return
 	}
+	if common.NotModified(w, r, common.ETag("discovery_profile", profile.ID, profile.UpdatedAt.Time.UnixNano())) {
+		return
+	}
 
 	if decrypted, err := h.Deps.Decrypt(profile.TargetValue); err == nil {
 		profile.TargetValue = string(decrypted)
@@ -108,17 +156,25 @@ func (h *DiscoveryHandler) Update(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// We need to re-encrypt if target value is provided (assuming full update or check logic)
-	// But generically input struct might not distinguish unset vs empty string if we rely on DecodeJSON.
-	// For simplicity, we assume frontend sends full object or we fetch and merge.
-	// The original handler didn't fetch-merge explicitly in UpdateFunc, let's see.
-	// It just did: encrypted, err := h.Deps.Encrypt([]byte(input.TargetValue))
-	// If input.TargetValue is empty, it encrypts empty byte slice. Ideally, we should fetch existing if we want partial updates,
-	// but the previous code didn't look like it did fetch-merge in UpdateFunc?
-	// Ah, wait. The previous `update` func:
-	// func (h *DiscoveryHandler) update(...) { encrypted... h.Deps.Q.UpdateDiscoveryProfile(...) }
-	// It relies on input having all fields or at least TargetValue.
-	// Let's stick to previous logic: Encrypt input.TargetValue.
+	// Updates replace the whole profile, so the target is required as on create: an empty
+	// one would be encrypted as is and wipe the stored target
+	if input.Name == "" || input.TargetValue == "" {
+		common.SendError(w, r, http.StatusBadRequest, "VALIDATION_ERROR", "Name and TargetValue are required", nil)
+		return
+	}
+	if err := validateScheduleInterval(input.IntervalSeconds); err != nil {
+		common.SendError(w, r, http.StatusBadRequest, "VALIDATION_ERROR", err.Error(), nil)
+		return
+	}
+	if !resolvePorts(w, r, &input) {
+		return
+	}
+	if _, ok := checkTargetSize(w, r, input.TargetValue, len(input.Ports)); !ok {
+		return
+	}
+	if !h.resolveCredentialIDs(w, r, &input) {
+		return
+	}
 
 	encrypted, err := h.Deps.Encrypt([]byte(input.TargetValue))
 	if err != nil {
@@ -135,6 +191,10 @@ func (h *DiscoveryHandler) Update(w http.ResponseWriter, r *http.Request) {
 		CredentialProfileID: input.CredentialProfileID,
 		AutoProvision:       input.AutoProvision,
 		AutoRun:             input.AutoRun,
+		IntervalSeconds:     input.IntervalSeconds,
+
+		CredentialProfileIds: input.CredentialProfileIds,
+		Ports:                input.Ports,
 	}
 
 	profile, err := h.Deps.Q.UpdateDiscoveryProfile(r.Context(), params)
@@ -145,14 +205,30 @@ func (h *DiscoveryHandler) Update(w http.ResponseWriter, r *http.Request) {
 	common.SendJSON(w, http.StatusOK, profile)
 }
 
-// Delete handles DELETE /{id} requests
+// Delete handles DELETE /{id} requests. The profile is soft-deleted, and only once no
+// live monitor created from it remains.
 func (h *DiscoveryHandler) Delete(w http.ResponseWriter, r *http.Request) {
 	id, ok := common.ParseIDParam(w, r, "id")
 	if !ok {
 		return
 	}
 
-	err := h.Deps.Q.DeleteDiscoveryProfile(r.Context(), id)
+	monitors, err := h.Deps.Q.CountDiscoveryProfileMonitors(r.Context(), id)
+	if common.HandleDBError(w, r, err, "Discovery Profile") {
+		return
+	}
+	if monitors > 0 {
+		common.SendError(w, r, http.StatusConflict, "DISCOVERY_PROFILE_IN_USE",
+			"Discovery Profile is still used by monitors", map[string]interface{}{
+				"monitors": monitors,
+			})
+		return
+	}
+
+	deleted, err := h.Deps.Q.DeleteDiscoveryProfile(r.Context(), id)
+	if err == nil && deleted == 0 {
+		err = pgx.ErrNoRows
+	}
 	if common.HandleDBError(w, r, err, "Discovery Profile") {
 		return
 	}
@@ -160,42 +236,420 @@ func (h *DiscoveryHandler) Delete(w http.ResponseWriter, r *http.Request) {
 	common.SendJSON(w, http.StatusNoContent, nil)
 }
 
-func triggerDiscovery(ctx context.Context, deps *common.Dependencies, id int64) {
-	if deps.Events == nil {
+// Restore handles POST /{id}/restore, undoing a soft delete. A profile whose credential
+// profile has itself been deleted cannot be restored until the credential is.
+func (h *DiscoveryHandler) Restore(w http.ResponseWriter, r *http.Request) {
+	id, ok := common.ParseIDParam(w, r, "id")
+	if !ok {
+		return
+	}
+
+	profile, err := h.Deps.Q.RestoreDiscoveryProfile(r.Context(), id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		common.SendError(w, r, http.StatusNotFound, "NOT_FOUND",
+			"Deleted Discovery Profile with a live credential profile not found", nil)
+		return
+	}
+	if common.HandleDBError(w, r, err, "Discovery Profile") {
 		return
 	}
+	if decrypted, err := h.Deps.Decrypt(profile.TargetValue); err == nil {
+		profile.TargetValue = string(decrypted)
+	}
+
+	common.SendJSON(w, http.StatusOK, profile)
+}
+
+// resolveCredentialIDs normalizes a profile's credential list. credential_profile_ids, when
+// given, is tried in order per IP and its first entry becomes credential_profile_id;
+// otherwise credential_profile_id alone is the list. Writes an error and returns false
+// if the list is too long, has duplicates, or names a missing credential profile.
+func (h *DiscoveryHandler) resolveCredentialIDs(w http.ResponseWriter, r *http.Request, input *dbgen.DiscoveryProfile) bool {
+	ids := input.CredentialProfileIds
+	if len(ids) == 0 {
+		if input.CredentialProfileID == 0 {
+			return true
+		}
+		ids = []int64{input.CredentialProfileID}
+	} else if input.CredentialProfileID != 0 && input.CredentialProfileID != ids[0] {
+		common.SendError(w, r, http.StatusBadRequest, "VALIDATION_ERROR",
+			"credential_profile_id must be the first entry of credential_profile_ids", nil)
+		return false
+	}
+
+	if limit := globals.GetConfig().Discovery.CredentialLimit(); len(ids) > limit {
+		common.SendError(w, r, http.StatusBadRequest, "VALIDATION_ERROR",
+			fmt.Sprintf("at most %d credential profiles may be listed", limit),
+			map[string]int{"limit": limit, "count": len(ids)})
+		return false
+	}
+
+	ctx, cancel := common.QueryContext(r)
+	defer cancel()
+
+	seen := make(map[int64]bool, len(ids))
+	for _, id := range ids {
+		if seen[id] {
+			common.SendError(w, r, http.StatusBadRequest, "VALIDATION_ERROR",
+				fmt.Sprintf("credential profile %d is listed more than once", id), nil)
+			return false
+		}
+		seen[id] = true
+
+		_, err := h.Deps.Q.GetCredentialProfile(ctx, id)
+		if errors.Is(err, pgx.ErrNoRows) {
+			common.SendError(w, r, http.StatusBadRequest, "VALIDATION_ERROR",
+				fmt.Sprintf("credential profile %d not found", id), nil)
+			return false
+		}
+		if common.HandleDBError(w, r, err, "Credential Profile") {
+			return false
+		}
+	}
+
+	input.CredentialProfileIds = ids
+	input.CredentialProfileID = ids[0]
+	return true
+}
+
+// resolvePorts normalizes a profile's port list. ports, when given, is probed in order per
+// address and its first entry becomes port; otherwise port alone is probed (0 = each
+// protocol's default port). Writes an error and returns false if the list has a port
+// out of range or a duplicate.
+func resolvePorts(w http.ResponseWriter, r *http.Request, input *dbgen.DiscoveryProfile) bool {
+	ports := input.Ports
+	if len(ports) == 0 {
+		if input.Port < 0 || input.Port > 65535 {
+			common.SendError(w, r, http.StatusBadRequest, "VALIDATION_ERROR", globals.PortRangeMessage, nil)
+			return false
+		}
+		input.Ports = []int32{}
+		if input.Port > 0 {
+			input.Ports = []int32{input.Port}
+		}
+		return true
+	}
+	if input.Port != 0 && input.Port != ports[0] {
+		common.SendError(w, r, http.StatusBadRequest, "VALIDATION_ERROR", "port must be the first entry of ports", nil)
+		return false
+	}
+
+	seen := make(map[int32]bool, len(ports))
+	for _, port := range ports {
+		if port < 1 || port > 65535 {
+			common.SendError(w, r, http.StatusBadRequest, "VALIDATION_ERROR",
+				fmt.Sprintf("port %d must be between 1 and 65535", port), nil)
+			return false
+		}
+		if seen[port] {
+			common.SendError(w, r, http.StatusBadRequest, "VALIDATION_ERROR",
+				fmt.Sprintf("port %d is listed more than once", port), nil)
+			return false
+		}
+		seen[port] = true
+	}
+
+	input.Port = ports[0]
+	return true
+}
+
+// validateScheduleInterval rejects negative intervals and ones shorter than the configured minimum.
+// NULL or 0 disables recurring discovery.
+func validateScheduleInterval(interval pgtype.Int4) error {
+	if !interval.Valid || interval.Int32 == 0 {
+		return nil
+	}
+	if interval.Int32 < 0 {
+		return fmt.Errorf("interval_seconds must not be negative")
+	}
+	minInterval := globals.GetConfig().Discovery.MinScheduleIntervalSeconds
+	if minInterval > 0 && int(interval.Int32) < minInterval {
+		return fmt.Errorf("interval_seconds must be at least %d", minInterval)
+	}
+	return nil
+}
+
+// checkTargetSize rejects targets that are malformed or whose addresses, probed on ports
+// ports each, exceed discovery.max_targets, so oversized profiles fail at the API instead
+// of in the worker. Returns the address count, or false after writing a 400 response.
+func checkTargetSize(w http.ResponseWriter, r *http.Request, target string, ports int) (int64, bool) {
+	count, err := discovery.CountTargets(target, targetExpandOptions(ports))
+	if err == nil {
+		return count, true
+	}
+
+	var tooLarge *discovery.TargetTooLargeError
+	if errors.As(err, &tooLarge) {
+		details := map[string]interface{}{"limit": tooLarge.Limit}
+		if ports > 1 {
+			details["ports"] = ports
+		}
+		if tooLarge.Count > 0 {
+			details["count"] = tooLarge.Count
+		}
+		common.SendError(w, r, http.StatusBadRequest, "TARGET_TOO_LARGE", tooLarge.Error(), details)
+		return 0, false
+	}
+	common.SendError(w, r, http.StatusBadRequest, "VALIDATION_ERROR", err.Error(), nil)
+	return 0, false
+}
+
+// targetExpandOptions mirrors the options the discovery worker expands targets with
+// for a profile probing ports ports per address
+func targetExpandOptions(ports int) discovery.ExpandOptions {
+	cfg := globals.GetConfig().Discovery
+	return discovery.ExpandOptions{
+		SkipIPv6SubnetRouter: cfg.SkipIPv6SubnetRouter,
+		MaxTargets:           cfg.MaxTargets,
+		Ports:                ports,
+	}
+}
+
+// triggerDiscovery records a queued job and hands the run to the discovery worker.
+// Returns the job ID (0 if it could not be recorded; the worker then creates one)
+// and whether the run was queued. A job that could not be queued is marked failed.
+func triggerDiscovery(ctx context.Context, deps *common.Dependencies, id int64) (int64, bool) {
+	if deps.Events == nil {
+		return 0, false
+	}
+
+	var jobID int64
+	// The request is queued to this process's discovery worker, so the job is ours
+	instance := globals.GetConfig().Server.Instance()
+	job, err := deps.Q.CreateDiscoveryJob(ctx, dbgen.CreateDiscoveryJobParams{
+		ProfileID:  id,
+		Status:     "queued",
+		InstanceID: pgtype.Text{String: instance, Valid: instance != ""},
+	})
+	if err != nil {
+		if deps.Logger != nil {
+			deps.Logger.Warn("failed to create discovery job", "profile_id", id, "error", err)
+		}
+	} else {
+		jobID = job.ID
+	}
+
 	select {
 	case deps.Events.DiscoveryRequest <- globals.DiscoveryRequestEvent{
 		ProfileID: id,
+		JobID:     jobID,
 		StartedAt: time.Now(),
 	}:
+		return jobID, true
 	case <-ctx.Done():
 	case <-deps.Events.Done():
 	default:
-		// Log full?
 	}
+
+	if jobID != 0 {
+		err := deps.Q.CompleteDiscoveryJob(context.WithoutCancel(ctx), dbgen.CompleteDiscoveryJobParams{
+			ID:            jobID,
+			Status:        "failed",
+			Error:         pgtype.Text{String: "discovery queue full", Valid: true},
+			ResultsStatus: pgtype.Text{String: "incomplete", Valid: true},
+		})
+		if err != nil && deps.Logger != nil {
+			deps.Logger.Warn("failed to mark unqueued discovery job failed", "job_id", jobID, "error", err)
+		}
+	}
+	return jobID, false
 }
 
-// Run handles POST /api/v1/discoveries/{id}/run
+// Run handles POST /api/v1/discoveries/{id}/run.
+// With an Idempotency-Key header, repeats of the same key by the same user for the same
+// profile within discovery.idempotency_ttl_seconds return the original 202 without
+// queueing another run. Failed requests are not remembered, so a retry runs again.
 func (h *DiscoveryHandler) Run(w http.ResponseWriter, r *http.Request) {
 	id, ok := common.ParseIDParam(w, r, "id")
 	if !ok {
 		return
 	}
 
+	var response map[string]interface{}
+	if key := strings.TrimSpace(r.Header.Get("Idempotency-Key")); key != "" {
+		if len(key) > maxIdempotencyKeyLen {
+			common.SendError(w, r, http.StatusBadRequest, "VALIDATION_ERROR",
+				fmt.Sprintf("Idempotency-Key must be at most %d characters", maxIdempotencyKeyLen), nil)
+			return
+		}
+		scoped := idempotencyScope(r, id, key)
+		replay, owner, err := h.runKeys.reserve(r.Context(), scoped)
+		if err != nil {
+			return // client went away while an identical request was in flight
+		}
+		if !owner {
+			w.Header().Set("Idempotent-Replayed", "true")
+			common.SendJSON(w, http.StatusAccepted, replay)
+			return
+		}
+		// Stores response on success; releases the key on any other outcome
+		defer func() { h.runKeys.complete(scoped, response) }()
+	}
+
 	// Validate existence
-	_, err := h.Deps.Q.GetDiscoveryProfile(r.Context(), id)
+	profile, err := h.Deps.Q.GetDiscoveryProfile(r.Context(), id)
 	if common.HandleDBError(w, r, err, "Discovery profile") {
 		return
 	}
 
-	triggerDiscovery(r.Context(), h.Deps, id)
+	// Profiles saved before the limit was lowered must not reach the worker
+	target, err := h.Deps.Decrypt(profile.TargetValue)
+	if err != nil {
+		common.SendError(w, r, http.StatusInternalServerError, "DECRYPT_FAILED", "Discovery profile target could not be decrypted", nil)
+		return
+	}
+	if _, ok := checkTargetSize(w, r, string(target), len(discovery.ProfilePorts(profile))); !ok {
+		return
+	}
+
+	jobID, queued := triggerDiscovery(r.Context(), h.Deps, id)
+	if !queued {
+		common.SendError(w, r, http.StatusServiceUnavailable, "DISCOVERY_QUEUE_FULL", "Discovery queue is full, try again later", nil)
+		return
+	}
 
-	common.SendJSON(w, http.StatusAccepted, map[string]interface{}{
+	response = map[string]interface{}{
 		"status":     "accepted",
 		"message":    "Discovery started",
 		"profile_id": strconv.FormatInt(id, 10),
+		"job_id":     strconv.FormatInt(jobID, 10),
+	}
+	common.SendJSON(w, http.StatusAccepted, response)
+}
+
+// GetJob handles GET /api/v1/discoveries/jobs/{jobID}
+func (h *DiscoveryHandler) GetJob(w http.ResponseWriter, r *http.Request) {
+	jobID, ok := common.ParseIDParam(w, r, "jobID")
+	if !ok {
+		return
+	}
+
+	ctx, cancel := common.QueryContext(r)
+	defer cancel()
+
+	job, err := h.Deps.Q.GetDiscoveryJob(ctx, jobID)
+	if common.HandleDBError(w, r, err, "Discovery job") {
+		return
+	}
+
+	common.SendJSON(w, http.StatusOK, job)
+}
+
+// defaultRunsLimit is how many runs GET /discoveries/{id}/runs returns without ?limit=
+const defaultRunsLimit = 20
+
+// Runs handles GET /api/v1/discoveries/{id}/runs.
+// It lists the profile's runs newest first, each with its summary; ?limit= may ask for
+// up to discovery.run_history_limit runs.
+func (h *DiscoveryHandler) Runs(w http.ResponseWriter, r *http.Request) {
+	id, ok := common.ParseIDParam(w, r, "id")
+	if !ok {
+		return
+	}
+
+	maxRuns := globals.GetConfig().Discovery.RunHistory()
+	limit := min(defaultRunsLimit, maxRuns)
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n > maxRuns {
+			common.SendError(w, r, http.StatusBadRequest, "INVALID_REQUEST",
+				fmt.Sprintf("limit must be between 1 and %d", maxRuns), nil)
+			return
+		}
+		limit = n
+	}
+
+	ctx, cancel := common.QueryContext(r)
+	defer cancel()
+
+	if _, err := h.Deps.Q.GetDiscoveryProfile(ctx, id); common.HandleDBError(w, r, err, "Discovery profile") {
+		return
+	}
+
+	runs, err := h.Deps.Q.ListDiscoveryJobsByProfile(ctx, dbgen.ListDiscoveryJobsByProfileParams{
+		ProfileID: id,
+		Limit:     int32(limit),
 	})
+	if common.HandleDBError(w, r, err, "Discovery runs") {
+		return
+	}
+
+	common.SendListResponse(w, runs, len(runs))
+}
+
+// TargetPreviewRequest is the body of a target expansion preview
+type TargetPreviewRequest struct {
+	TargetValue string `json:"target_value"`
+	// Limit is how many expanded IPs to return (default 20, at most 1000)
+	Limit     int  `json:"limit,omitempty"`
+	CountOnly bool `json:"count_only,omitempty"`
+}
+
+// TargetPreviewResponse describes what a target expands to
+type TargetPreviewResponse struct {
+	TargetValue string   `json:"target_value"`
+	Type        string   `json:"type"`
+	Count       int64    `json:"count"`
+	Info        string   `json:"info"`
+	IPs         []string `json:"ips"`
+	Truncated   bool     `json:"truncated"`
+}
+
+const (
+	defaultPreviewIPs = 20
+	maxPreviewIPs     = 1000
+)
+
+// Preview handles POST /api/v1/discoveries/preview.
+// It expands a target the way a discovery run would, without touching the database.
+func (h *DiscoveryHandler) Preview(w http.ResponseWriter, r *http.Request) {
+	req, ok := common.DecodeJSON[TargetPreviewRequest](w, r)
+	if !ok {
+		return
+	}
+
+	target := strings.TrimSpace(req.TargetValue)
+	if target == "" {
+		common.SendError(w, r, http.StatusBadRequest, "VALIDATION_ERROR", "target_value is required", nil)
+		return
+	}
+	if req.Limit < 0 {
+		common.SendError(w, r, http.StatusBadRequest, "VALIDATION_ERROR", "limit must not be negative", nil)
+		return
+	}
+
+	count, ok := checkTargetSize(w, r, target, 1)
+	if !ok {
+		return
+	}
+
+	resp := TargetPreviewResponse{
+		TargetValue: target,
+		Type:        string(discovery.DetectTargetType(target)),
+		Count:       count,
+		Info:        discovery.GetTargetInfo(target),
+		IPs:         []string{},
+	}
+
+	limit := req.Limit
+	if limit == 0 {
+		limit = defaultPreviewIPs
+	}
+	limit = min(limit, maxPreviewIPs)
+
+	if !req.CountOnly {
+		// Only the addresses shown are generated, however large the target
+		ips, total, err := discovery.FirstTargets(target, targetExpandOptions(1), limit)
+		if err != nil {
+			common.SendError(w, r, http.StatusBadRequest, "VALIDATION_ERROR", err.Error(), nil)
+			return
+		}
+		resp.Count = total
+		resp.IPs = ips
+	}
+	resp.Truncated = int64(len(resp.IPs)) < resp.Count
+
+	common.SendJSON(w, http.StatusOK, resp)
 }
 
 // GetResults handles GET /api/v1/discoveries/{id}/results
@@ -205,7 +659,10 @@ func (h *DiscoveryHandler) GetResults(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	results, err := h.Deps.Q.ListDiscoveredDevices(r.Context(), pgtype.Int8{Int64: id, Valid: true})
+	ctx, cancel := common.QueryContext(r)
+	defer cancel()
+
+	results, err := h.Deps.Q.ListDiscoveredDevices(ctx, pgtype.Int8{Int64: id, Valid: true})
 	if common.HandleDBError(w, r, err, "Discovery results") {
 		return
 	}
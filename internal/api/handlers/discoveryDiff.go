@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"net/netip"
+	"strconv"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/nmslite/nmslite/internal/api/common"
+	"github.com/nmslite/nmslite/internal/database/dbgen"
+)
+
+// DiscoveryDiffResponse compares the devices found by a discovery run with the run before it
+type DiscoveryDiffResponse struct {
+	ProfileID int64 `json:"profile_id"`
+	JobID     int64 `json:"job_id"`
+	// PreviousJobID is nil for a profile's first run; every device is then "added"
+	PreviousJobID *int64 `json:"previous_job_id"`
+	// Added responded in this run only, Removed in the previous run only
+	Added     []string `json:"added"`
+	Removed   []string `json:"removed"`
+	Unchanged []string `json:"unchanged"`
+}
+
+// diffDeviceIPs splits two runs' addresses into added, removed and unchanged, each sorted
+// in the order of the inputs (both sorted ascending by the query)
+func diffDeviceIPs(current, previous []netip.Addr) (added, removed, unchanged []string) {
+	added, removed, unchanged = []string{}, []string{}, []string{}
+
+	seen := make(map[netip.Addr]bool, len(previous))
+	for _, ip := range previous {
+		seen[ip] = false
+	}
+	for _, ip := range current {
+		if _, ok := seen[ip]; ok {
+			seen[ip] = true
+			unchanged = append(unchanged, ip.String())
+		} else {
+			added = append(added, ip.String())
+		}
+	}
+	for _, ip := range previous {
+		if !seen[ip] {
+			removed = append(removed, ip.String())
+		}
+	}
+	return added, removed, unchanged
+}
+
+// Diff handles GET /api/v1/discoveries/{id}/diff.
+// It compares the latest finished run (or ?job=) with the finished run before it. Only
+// runs whose results are complete (discovery_jobs.results_status) are compared: failed and
+// cancelled runs, and runs whose devices were not all recorded, are skipped.
+func (h *DiscoveryHandler) Diff(w http.ResponseWriter, r *http.Request) {
+	id, ok := common.ParseIDParam(w, r, "id")
+	if !ok {
+		return
+	}
+
+	var jobID int64
+	if v := r.URL.Query().Get("job"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n <= 0 {
+			common.SendError(w, r, http.StatusBadRequest, "INVALID_REQUEST", "job must be a positive integer", nil)
+			return
+		}
+		jobID = n
+	}
+
+	ctx, cancel := common.QueryContext(r)
+	defer cancel()
+
+	if _, err := h.Deps.Q.GetDiscoveryProfile(ctx, id); common.HandleDBError(w, r, err, "Discovery profile") {
+		return
+	}
+
+	var job dbgen.DiscoveryJob
+	var err error
+	if jobID != 0 {
+		job, err = h.Deps.Q.GetDiscoveryJob(ctx, jobID)
+		if err == nil && job.ProfileID != id {
+			err = pgx.ErrNoRows
+		}
+		if common.HandleDBError(w, r, err, "Discovery job") {
+			return
+		}
+		if !job.CompletedAt.Valid {
+			common.SendError(w, r, http.StatusConflict, "JOB_NOT_FINISHED", "Discovery job has not finished", map[string]interface{}{
+				"status": job.Status,
+			})
+			return
+		}
+	} else {
+		job, err = h.Deps.Q.GetLastFinishedDiscoveryJob(ctx, dbgen.GetLastFinishedDiscoveryJobParams{
+			ProfileID: id,
+			BeforeID:  math.MaxInt64,
+		})
+		if errors.Is(err, pgx.ErrNoRows) {
+			common.SendError(w, r, http.StatusNotFound, "NO_FINISHED_RUNS", "Discovery profile has no finished runs", nil)
+			return
+		}
+		if common.HandleDBError(w, r, err, "Discovery job") {
+			return
+		}
+	}
+
+	resp := DiscoveryDiffResponse{ProfileID: id, JobID: job.ID}
+
+	var previousIPs []netip.Addr
+	previous, err := h.Deps.Q.GetLastFinishedDiscoveryJob(ctx, dbgen.GetLastFinishedDiscoveryJobParams{
+		ProfileID: id,
+		BeforeID:  job.ID,
+	})
+	switch {
+	case err == nil:
+		resp.PreviousJobID = &previous.ID
+		previousIPs, err = h.Deps.Q.ListDiscoveryJobDeviceIPs(ctx, pgtype.Int8{Int64: previous.ID, Valid: true})
+		if common.HandleDBError(w, r, err, "Discovery results") {
+			return
+		}
+	case !errors.Is(err, pgx.ErrNoRows):
+		common.HandleDBError(w, r, err, "Discovery job")
+		return
+	}
+
+	currentIPs, err := h.Deps.Q.ListDiscoveryJobDeviceIPs(ctx, pgtype.Int8{Int64: job.ID, Valid: true})
+	if common.HandleDBError(w, r, err, "Discovery results") {
+		return
+	}
+
+	resp.Added, resp.Removed, resp.Unchanged = diffDeviceIPs(currentIPs, previousIPs)
+	common.SendJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/nmslite/nmslite/internal/api/common"
+	"github.com/nmslite/nmslite/internal/database/dbgen"
+	"github.com/nmslite/nmslite/internal/globals"
+)
+
+func TestDiscoveryHandlerDiff(t *testing.T) {
+	globals.SetGlobalConfigForTests(&globals.Config{})
+
+	done := pgtype.Timestamptz{Valid: true}
+	complete := pgtype.Text{String: "complete", Valid: true}
+	incomplete := pgtype.Text{String: "incomplete", Valid: true}
+	q := newFakeQuerier()
+	q.discoveryProfiles[1] = dbgen.DiscoveryProfile{ID: 1}
+	q.discoveryProfiles[2] = dbgen.DiscoveryProfile{ID: 2}
+	for _, job := range []dbgen.DiscoveryJob{
+		{ID: 1, ProfileID: 1, Status: "success", CompletedAt: done, ResultsStatus: complete},
+		{ID: 2, ProfileID: 1, Status: "partial", CompletedAt: done, ResultsStatus: complete},
+		{ID: 3, ProfileID: 2, Status: "success", CompletedAt: done, ResultsStatus: complete},
+		{ID: 4, ProfileID: 1, Status: "failed", CompletedAt: done, ResultsStatus: incomplete},
+		{ID: 5, ProfileID: 1, Status: "partial", CompletedAt: done, ResultsStatus: complete},
+		{ID: 6, ProfileID: 1, Status: "running"},
+		// Finished, but some of its devices were never recorded
+		{ID: 7, ProfileID: 1, Status: "partial", CompletedAt: done, ResultsStatus: incomplete},
+	} {
+		q.jobs[job.ID] = job
+	}
+	for job, ips := range map[int64][]string{
+		1: {"10.0.0.1", "10.0.0.2"},
+		2: {"10.0.0.1", "10.0.0.2", "10.0.0.3"},
+		3: {"10.1.0.1"},
+		5: {"10.0.0.2", "10.0.0.3", "10.0.0.9"},
+	} {
+		for _, ip := range ips {
+			id := nextID(q.devices)
+			q.devices[id] = dbgen.DiscoveredDevice{ID: id, IpAddress: netip.MustParseAddr(ip), DiscoveryJobID: pgtype.Int8{Int64: job, Valid: true}}
+		}
+	}
+	h := NewDiscoveryHandler(&common.Dependencies{Q: q})
+
+	r := chi.NewRouter()
+	r.Get("/{id}/diff", h.Diff)
+
+	testCases := []struct {
+		name          string
+		path          string
+		wantStatus    int
+		wantJob       int64
+		wantPrevious  int64
+		wantAdded     string
+		wantRemoved   string
+		wantUnchanged string
+	}{
+		{"Latest run skips incomplete runs", "/1/diff", http.StatusOK, 5, 2, "10.0.0.9", "10.0.0.1", "10.0.0.2,10.0.0.3"},
+		{"Explicit job", "/1/diff?job=2", http.StatusOK, 2, 1, "10.0.0.3", "", "10.0.0.1,10.0.0.2"},
+		{"First run", "/2/diff", http.StatusOK, 3, 0, "10.1.0.1", "", ""},
+		{"Unfinished job", "/1/diff?job=6", http.StatusConflict, 0, 0, "", "", ""},
+		{"Job of another profile", "/1/diff?job=3", http.StatusNotFound, 0, 0, "", "", ""},
+		{"Invalid job", "/1/diff?job=latest", http.StatusBadRequest, 0, 0, "", "", ""},
+		{"Unknown profile", "/9/diff", http.StatusNotFound, 0, 0, "", "", ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tc.path, nil))
+
+			if rec.Code != tc.wantStatus {
+				t.Fatalf("Expected status %d, got %d (body: %s)", tc.wantStatus, rec.Code, rec.Body.String())
+			}
+			if tc.wantStatus != http.StatusOK {
+				return
+			}
+
+			var resp DiscoveryDiffResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if resp.JobID != tc.wantJob {
+				t.Errorf("Expected job %d, got %d", tc.wantJob, resp.JobID)
+			}
+			var previous int64
+			if resp.PreviousJobID != nil {
+				previous = *resp.PreviousJobID
+			}
+			if previous != tc.wantPrevious {
+				t.Errorf("Expected previous job %d, got %d", tc.wantPrevious, previous)
+			}
+			if got := strings.Join(resp.Added, ","); got != tc.wantAdded {
+				t.Errorf("Expected added %q, got %q", tc.wantAdded, got)
+			}
+			if got := strings.Join(resp.Removed, ","); got != tc.wantRemoved {
+				t.Errorf("Expected removed %q, got %q", tc.wantRemoved, got)
+			}
+			if got := strings.Join(resp.Unchanged, ","); got != tc.wantUnchanged {
+				t.Errorf("Expected unchanged %q, got %q", tc.wantUnchanged, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,568 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/nmslite/nmslite/internal/api/auth"
+	"github.com/nmslite/nmslite/internal/api/common"
+	"github.com/nmslite/nmslite/internal/database/dbgen"
+	"github.com/nmslite/nmslite/internal/globals"
+)
+
+// discoveryStore holds discovery profile 1 targeting target, or 10.0.0.0/24 if empty
+func discoveryStore(target string) *fakeQuerier {
+	if target == "" {
+		target = "10.0.0.0/24"
+	}
+	q := newFakeQuerier()
+	q.discoveryProfiles[1] = dbgen.DiscoveryProfile{ID: 1, TargetValue: target}
+	return q
+}
+
+func TestDiscoveryHandlerRunTracksJob(t *testing.T) {
+	globals.SetGlobalConfigForTests(&globals.Config{Server: globals.ServerConfig{InstanceID: "nms-a"}})
+
+	testCases := []struct {
+		name       string
+		queueSize  int
+		wantStatus int
+		wantJob    string
+	}{
+		{"Queued run", 1, http.StatusAccepted, "queued"},
+		{"Queue full", 0, http.StatusServiceUnavailable, "failed"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			q := discoveryStore("")
+			events := &globals.EventChannels{DiscoveryRequest: make(chan globals.DiscoveryRequestEvent, tc.queueSize)}
+			h := NewDiscoveryHandler(&common.Dependencies{Q: q, Events: events})
+
+			r := chi.NewRouter()
+			r.Post("/{id}/run", h.Run)
+			r.Get("/jobs/{jobID}", h.GetJob)
+
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/1/run", nil))
+			if rec.Code != tc.wantStatus {
+				t.Fatalf("Expected status %d, got %d (body: %s)", tc.wantStatus, rec.Code, rec.Body.String())
+			}
+
+			if job := q.jobs[1]; job.InstanceID.String != "nms-a" {
+				t.Errorf("Expected the job to belong to instance nms-a, got %q", job.InstanceID.String)
+			}
+
+			if tc.queueSize > 0 {
+				event := <-events.DiscoveryRequest
+				if event.JobID != 1 {
+					t.Errorf("Expected queued event to carry job 1, got %d", event.JobID)
+				}
+			}
+
+			rec = httptest.NewRecorder()
+			r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/jobs/1", nil))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("Expected job lookup to succeed, got %d", rec.Code)
+			}
+			if !strings.Contains(rec.Body.String(), `"status":"`+tc.wantJob+`"`) {
+				t.Errorf("Expected job status %q, got %s", tc.wantJob, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestDiscoveryHandlerRunUndecryptableTarget(t *testing.T) {
+	globals.SetGlobalConfigForTests(&globals.Config{})
+	authService, err := auth.NewService("0123456789abcdef0123456789abcdef", "0123456789abcdef0123456789abcdef", "admin", "admin", time.Hour)
+	if err != nil {
+		t.Fatalf("Failed to create auth service: %v", err)
+	}
+
+	// Plaintext stored where ciphertext belongs, as after a key mix-up
+	q := discoveryStore("10.0.0.0/24")
+	events := &globals.EventChannels{DiscoveryRequest: make(chan globals.DiscoveryRequestEvent, 1)}
+	h := NewDiscoveryHandler(&common.Dependencies{Q: q, Auth: authService, Events: events})
+
+	r := chi.NewRouter()
+	r.Post("/{id}/run", h.Run)
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/1/run", nil))
+
+	if rec.Code != http.StatusInternalServerError || !strings.Contains(rec.Body.String(), "DECRYPT_FAILED") {
+		t.Fatalf("Expected a 500 DECRYPT_FAILED, got %d (body: %s)", rec.Code, rec.Body.String())
+	}
+	if len(events.DiscoveryRequest) != 0 || q.calls["CreateDiscoveryJob"] != 0 {
+		t.Error("Expected no discovery run for an undecryptable target")
+	}
+}
+
+func TestDiscoveryHandlerRunIdempotencyKey(t *testing.T) {
+	globals.SetGlobalConfigForTests(&globals.Config{})
+
+	q := discoveryStore("")
+	deps := &common.Dependencies{Q: q, Events: &globals.EventChannels{DiscoveryRequest: make(chan globals.DiscoveryRequestEvent)}}
+	h := NewDiscoveryHandler(deps)
+
+	r := chi.NewRouter()
+	r.Post("/{id}/run", h.Run)
+
+	run := func(key, user string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/1/run", nil)
+		if key != "" {
+			req.Header.Set("Idempotency-Key", key)
+		}
+		if user != "" {
+			req = req.WithContext(context.WithValue(req.Context(), auth.UsernameKey, user))
+		}
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// A failed run (queue full) is not remembered: the retry with the same key runs
+	if rec := run("k1", "alice"); rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("Expected 503 with an unbuffered queue, got %d", rec.Code)
+	}
+	deps.Events = &globals.EventChannels{DiscoveryRequest: make(chan globals.DiscoveryRequestEvent, 10)}
+
+	// Concurrent duplicates: exactly one run is queued and all callers see its job
+	const dupes = 8
+	codes := make(chan *httptest.ResponseRecorder, dupes)
+	for i := 0; i < dupes; i++ {
+		go func() { codes <- run("k1", "alice") }()
+	}
+	var bodies []string
+	replayed := 0
+	for i := 0; i < dupes; i++ {
+		rec := <-codes
+		if rec.Code != http.StatusAccepted {
+			t.Fatalf("Expected 202, got %d (body: %s)", rec.Code, rec.Body.String())
+		}
+		if rec.Header().Get("Idempotent-Replayed") == "true" {
+			replayed++
+		}
+		bodies = append(bodies, rec.Body.String())
+	}
+	if got := len(deps.Events.DiscoveryRequest); got != 1 {
+		t.Fatalf("Expected 1 queued run for duplicate keys, got %d", got)
+	}
+	if replayed != dupes-1 {
+		t.Errorf("Expected %d replayed responses, got %d", dupes-1, replayed)
+	}
+	for _, body := range bodies[1:] {
+		if body != bodies[0] {
+			t.Errorf("Replayed response differs: %s vs %s", body, bodies[0])
+		}
+	}
+
+	// Another key, another user, or no key at all each queue a new run
+	run("k2", "alice")
+	run("k1", "bob")
+	run("", "alice")
+	if got := len(deps.Events.DiscoveryRequest); got != 4 {
+		t.Errorf("Expected 4 queued runs, got %d", got)
+	}
+
+	long := strings.Repeat("x", maxIdempotencyKeyLen+1)
+	if rec := run(long, "alice"); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an oversized key, got %d", rec.Code)
+	}
+}
+
+func TestDiscoveryHandlerGetJobNotFound(t *testing.T) {
+	globals.SetGlobalConfigForTests(&globals.Config{})
+
+	h := NewDiscoveryHandler(&common.Dependencies{Q: discoveryStore("")})
+
+	r := chi.NewRouter()
+	r.Get("/jobs/{jobID}", h.GetJob)
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/jobs/42", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d, got %d", http.StatusNotFound, rec.Code)
+	}
+}
+
+func TestDiscoveryHandlerRuns(t *testing.T) {
+	globals.SetGlobalConfigForTests(&globals.Config{
+		Discovery: globals.DiscoveryConfig{RunHistoryLimit: 30},
+	})
+
+	testCases := []struct {
+		name       string
+		path       string
+		wantStatus int
+		wantLimit  int32
+		wantRuns   int
+	}{
+		{"Default limit", "/1/runs", http.StatusOK, 20, 20},
+		{"Explicit limit", "/1/runs?limit=5", http.StatusOK, 5, 5},
+		{"Limit at history cap", "/1/runs?limit=30", http.StatusOK, 30, 25},
+		{"Limit above history cap", "/1/runs?limit=31", http.StatusBadRequest, 0, 0},
+		{"Invalid limit", "/1/runs?limit=all", http.StatusBadRequest, 0, 0},
+		{"Unknown profile", "/9/runs", http.StatusNotFound, 0, 0},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			q := discoveryStore("")
+			for id := int64(1); id <= 25; id++ {
+				q.jobs[id] = dbgen.DiscoveryJob{
+					ID:        id,
+					ProfileID: 1,
+					Status:    "success",
+					Summary:   json.RawMessage(`{"status":"success","total_targets":4,"validated":4}`),
+				}
+			}
+			r := chi.NewRouter()
+			r.Get("/{id}/runs", NewDiscoveryHandler(&common.Dependencies{Q: q}).Runs)
+
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tc.path, nil))
+			if rec.Code != tc.wantStatus {
+				t.Fatalf("Expected status %d, got %d (body: %s)", tc.wantStatus, rec.Code, rec.Body.String())
+			}
+			if tc.wantStatus != http.StatusOK {
+				return
+			}
+			if limit := lastArgs[dbgen.ListDiscoveryJobsByProfileParams](q, "ListDiscoveryJobsByProfile").Limit; limit != tc.wantLimit {
+				t.Errorf("Expected limit %d, got %d", tc.wantLimit, limit)
+			}
+
+			var resp struct {
+				Data []struct {
+					ID      int64 `json:"id"`
+					Summary struct {
+						Status    string `json:"status"`
+						Validated int    `json:"validated"`
+					} `json:"summary"`
+				} `json:"data"`
+				Total int `json:"total"`
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if resp.Total != tc.wantRuns || len(resp.Data) != tc.wantRuns {
+				t.Fatalf("Expected %d runs, got %d (total %d)", tc.wantRuns, len(resp.Data), resp.Total)
+			}
+			if resp.Data[0].ID != 25 || resp.Data[0].Summary.Status != "success" || resp.Data[0].Summary.Validated != 4 {
+				t.Errorf("Expected newest run with its summary first, got %+v", resp.Data[0])
+			}
+		})
+	}
+}
+
+func TestDiscoveryHandlerDelete(t *testing.T) {
+	globals.SetGlobalConfigForTests(&globals.Config{})
+
+	testCases := []struct {
+		name       string
+		path       string
+		wantStatus int
+		wantCode   string
+	}{
+		{"Unused profile soft-deleted", "/1", http.StatusNoContent, ""},
+		{"Profile in use", "/2", http.StatusConflict, "DISCOVERY_PROFILE_IN_USE"},
+		{"Unknown or already deleted profile", "/3", http.StatusNotFound, "NOT_FOUND"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			q := newFakeQuerier()
+			q.discoveryProfiles[1] = dbgen.DiscoveryProfile{ID: 1}
+			q.discoveryProfiles[2] = dbgen.DiscoveryProfile{ID: 2}
+			q.monitors[1] = dbgen.Monitor{ID: 1, DiscoveryProfileID: 2}
+			q.monitors[2] = dbgen.Monitor{ID: 2, DiscoveryProfileID: 2}
+			q.monitors[3] = dbgen.Monitor{ID: 3, DiscoveryProfileID: 1, DeletedAt: now()}
+			h := NewDiscoveryHandler(&common.Dependencies{Q: q})
+
+			r := chi.NewRouter()
+			r.Delete("/{id}", h.Delete)
+
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, tc.path, nil))
+
+			if rec.Code != tc.wantStatus {
+				t.Fatalf("Expected status %d, got %d (body: %s)", tc.wantStatus, rec.Code, rec.Body.String())
+			}
+			if tc.wantCode != "" && !strings.Contains(rec.Body.String(), `"code":"`+tc.wantCode+`"`) {
+				t.Errorf("Expected error code %s, got %s", tc.wantCode, rec.Body.String())
+			}
+			if tc.wantCode == "DISCOVERY_PROFILE_IN_USE" {
+				if !strings.Contains(rec.Body.String(), `"monitors":2`) {
+					t.Errorf("Expected the monitor count in details, got %s", rec.Body.String())
+				}
+				if q.discoveryProfiles[2].DeletedAt.Valid {
+					t.Error("Expected profile in use to stay live")
+				}
+			}
+		})
+	}
+}
+
+func TestDiscoveryHandlerTargetTooLarge(t *testing.T) {
+	globals.SetGlobalConfigForTests(&globals.Config{Discovery: globals.DiscoveryConfig{MaxTargets: 256}})
+
+	testCases := []struct {
+		name       string
+		method     string
+		path       string
+		body       string
+		target     string
+		wantStatus int
+		wantCode   string
+	}{
+		{"Create within limit", http.MethodPost, "/", `{"name":"lan","target_value":"10.0.0.0/24"}`, "", http.StatusCreated, ""},
+		{"Create over limit", http.MethodPost, "/", `{"name":"lan","target_value":"10.0.0.0/23"}`, "", http.StatusBadRequest, "TARGET_TOO_LARGE"},
+		{"Create huge IPv6", http.MethodPost, "/", `{"name":"lan","target_value":"2001:db8::/32"}`, "", http.StatusBadRequest, "TARGET_TOO_LARGE"},
+		{"Create invalid target", http.MethodPost, "/", `{"name":"lan","target_value":"not-an-ip"}`, "", http.StatusBadRequest, "VALIDATION_ERROR"},
+		{"Update over limit", http.MethodPut, "/1", `{"name":"lan","target_value":"10.0.0.1-10.0.1.1"}`, "", http.StatusBadRequest, "TARGET_TOO_LARGE"},
+		{"Update without target", http.MethodPut, "/1", `{"name":"lan"}`, "", http.StatusBadRequest, "VALIDATION_ERROR"},
+		{"Run stored profile over limit", http.MethodPost, "/1/run", "", "10.0.0.0/16", http.StatusBadRequest, "TARGET_TOO_LARGE"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			q := discoveryStore(tc.target)
+			events := &globals.EventChannels{DiscoveryRequest: make(chan globals.DiscoveryRequestEvent, 1)}
+			h := NewDiscoveryHandler(&common.Dependencies{Q: q, Events: events})
+
+			r := chi.NewRouter()
+			r.Post("/", h.Create)
+			r.Put("/{id}", h.Update)
+			r.Post("/{id}/run", h.Run)
+
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, httptest.NewRequest(tc.method, tc.path, strings.NewReader(tc.body)))
+			if rec.Code != tc.wantStatus {
+				t.Fatalf("Expected status %d, got %d (body: %s)", tc.wantStatus, rec.Code, rec.Body.String())
+			}
+			if tc.wantCode != "" && !strings.Contains(rec.Body.String(), `"code":"`+tc.wantCode+`"`) {
+				t.Errorf("Expected error code %s, got %s", tc.wantCode, rec.Body.String())
+			}
+			if tc.wantCode == "TARGET_TOO_LARGE" && !strings.Contains(rec.Body.String(), `"limit":256`) {
+				t.Errorf("Expected limit in error details, got %s", rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestDiscoveryHandlerPorts(t *testing.T) {
+	globals.SetGlobalConfigForTests(&globals.Config{Discovery: globals.DiscoveryConfig{MaxTargets: 256}})
+
+	testCases := []struct {
+		name       string
+		body       string
+		wantStatus int
+		wantPort   int32
+		wantPorts  []int32
+	}{
+		{"Single port becomes the list", `{"port":22}`, http.StatusCreated, 22, []int32{22}},
+		{"No port probes protocol defaults", `{}`, http.StatusCreated, 0, []int32{}},
+		{"List sets port", `{"ports":[2222,22]}`, http.StatusCreated, 2222, []int32{2222, 22}},
+		{"Port matching first entry", `{"port":2222,"ports":[2222,22]}`, http.StatusCreated, 2222, []int32{2222, 22}},
+		{"Port not first entry", `{"port":22,"ports":[2222,22]}`, http.StatusBadRequest, 0, nil},
+		{"Duplicate port", `{"ports":[22,22]}`, http.StatusBadRequest, 0, nil},
+		{"Port zero in list", `{"ports":[0]}`, http.StatusBadRequest, 0, nil},
+		{"Port out of range", `{"ports":[70000]}`, http.StatusBadRequest, 0, nil},
+		{"Single port out of range", `{"port":-1}`, http.StatusBadRequest, 0, nil},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			q := newFakeQuerier()
+			r := chi.NewRouter()
+			r.Post("/", NewDiscoveryHandler(&common.Dependencies{Q: q}).Create)
+
+			var body map[string]interface{}
+			json.Unmarshal([]byte(tc.body), &body)
+			body["name"], body["target_value"] = "lan", "10.0.0.0/25"
+			data, _ := json.Marshal(body)
+
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(string(data))))
+			if rec.Code != tc.wantStatus {
+				t.Fatalf("Expected status %d, got %d (body: %s)", tc.wantStatus, rec.Code, rec.Body.String())
+			}
+			if tc.wantStatus != http.StatusCreated {
+				return
+			}
+			created := lastArgs[dbgen.CreateDiscoveryProfileParams](q, "CreateDiscoveryProfile")
+			if created.Port != tc.wantPort {
+				t.Errorf("Expected port %d, got %d", tc.wantPort, created.Port)
+			}
+			if created.Ports == nil || !slices.Equal(created.Ports, tc.wantPorts) {
+				t.Errorf("Expected ports %v, got %v", tc.wantPorts, created.Ports)
+			}
+		})
+	}
+
+	// 126 addresses on 3 ports exceed 256 probes
+	r := chi.NewRouter()
+	r.Post("/", NewDiscoveryHandler(&common.Dependencies{Q: newFakeQuerier()}).Create)
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/",
+		strings.NewReader(`{"name":"lan","target_value":"10.0.0.0/25","ports":[22,2222,8022]}`)))
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), `"code":"TARGET_TOO_LARGE"`) {
+		t.Fatalf("Expected TARGET_TOO_LARGE, got %d (body: %s)", rec.Code, rec.Body.String())
+	}
+	if !strings.Contains(rec.Body.String(), `"ports":3`) {
+		t.Errorf("Expected port count in error details, got %s", rec.Body.String())
+	}
+}
+
+func TestDiscoveryHandlerScheduleInterval(t *testing.T) {
+	globals.SetGlobalConfigForTests(&globals.Config{Discovery: globals.DiscoveryConfig{MaxTargets: 256, MinScheduleIntervalSeconds: 300}})
+
+	testCases := []struct {
+		name         string
+		method       string
+		path         string
+		interval     string
+		wantStatus   int
+		wantInterval pgtype.Int4
+	}{
+		{"Create without schedule", http.MethodPost, "/", "", http.StatusCreated, pgtype.Int4{}},
+		{"Create with schedule", http.MethodPost, "/", `,"interval_seconds":3600`, http.StatusCreated, pgtype.Int4{Int32: 3600, Valid: true}},
+		{"Create with zero disables schedule", http.MethodPost, "/", `,"interval_seconds":0`, http.StatusCreated, pgtype.Int4{Int32: 0, Valid: true}},
+		{"Create below minimum", http.MethodPost, "/", `,"interval_seconds":60`, http.StatusBadRequest, pgtype.Int4{}},
+		{"Create negative", http.MethodPost, "/", `,"interval_seconds":-1`, http.StatusBadRequest, pgtype.Int4{}},
+		{"Update at minimum", http.MethodPut, "/1", `,"interval_seconds":300`, http.StatusOK, pgtype.Int4{Int32: 300, Valid: true}},
+		{"Update below minimum", http.MethodPut, "/1", `,"interval_seconds":299`, http.StatusBadRequest, pgtype.Int4{}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			q := discoveryStore("")
+			r := chi.NewRouter()
+			h := NewDiscoveryHandler(&common.Dependencies{Q: q})
+			r.Post("/", h.Create)
+			r.Put("/{id}", h.Update)
+
+			body := `{"name":"lan","target_value":"10.0.0.0/25"` + tc.interval + `}`
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, httptest.NewRequest(tc.method, tc.path, strings.NewReader(body)))
+			if rec.Code != tc.wantStatus {
+				t.Fatalf("Expected status %d, got %d (body: %s)", tc.wantStatus, rec.Code, rec.Body.String())
+			}
+			if tc.wantStatus == http.StatusBadRequest {
+				if !strings.Contains(rec.Body.String(), "interval_seconds") {
+					t.Errorf("Expected the error to name interval_seconds, got %s", rec.Body.String())
+				}
+				if q.calls["CreateDiscoveryProfile"]+q.calls["UpdateDiscoveryProfile"] != 0 {
+					t.Error("Expected a rejected interval not to reach the database")
+				}
+				return
+			}
+			if stored := q.discoveryProfiles[nextID(q.discoveryProfiles)-1]; stored.IntervalSeconds != tc.wantInterval {
+				t.Errorf("Expected interval %+v, got %+v", tc.wantInterval, stored.IntervalSeconds)
+			}
+		})
+	}
+}
+
+func TestDiscoveryHandlerCredentialList(t *testing.T) {
+	globals.SetGlobalConfigForTests(&globals.Config{Discovery: globals.DiscoveryConfig{MaxCredentialsPerProfile: 3}})
+
+	testCases := []struct {
+		name        string
+		credentials string
+		wantStatus  int
+		wantPrimary int64
+		wantIDs     []int64
+	}{
+		{"Single credential becomes the list", `"credential_profile_id":2`, http.StatusCreated, 2, []int64{2}},
+		{"List order kept, first is primary", `"credential_profile_ids":[3,1,2]`, http.StatusCreated, 3, []int64{3, 1, 2}},
+		{"Matching primary and list", `"credential_profile_id":1,"credential_profile_ids":[1,2]`, http.StatusCreated, 1, []int64{1, 2}},
+		{"Primary not first", `"credential_profile_id":2,"credential_profile_ids":[1,2]`, http.StatusBadRequest, 0, nil},
+		{"Duplicate credential", `"credential_profile_ids":[1,2,1]`, http.StatusBadRequest, 0, nil},
+		{"Unknown credential", `"credential_profile_ids":[1,9]`, http.StatusBadRequest, 0, nil},
+		{"Over the limit", `"credential_profile_ids":[1,2,3,4]`, http.StatusBadRequest, 0, nil},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			q := newFakeQuerier()
+			for id := int64(1); id <= 4; id++ {
+				q.credentials[id] = dbgen.CredentialProfile{ID: id, Protocol: "ssh"}
+			}
+			h := NewDiscoveryHandler(&common.Dependencies{Q: q})
+
+			body := `{"name":"lan","target_value":"10.0.0.0/24",` + tc.credentials + `}`
+			rec := httptest.NewRecorder()
+			h.Create(rec, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body)))
+
+			if rec.Code != tc.wantStatus {
+				t.Fatalf("Expected status %d, got %d (body: %s)", tc.wantStatus, rec.Code, rec.Body.String())
+			}
+			if tc.wantStatus != http.StatusCreated {
+				return
+			}
+			created := lastArgs[dbgen.CreateDiscoveryProfileParams](q, "CreateDiscoveryProfile")
+			if created.CredentialProfileID != tc.wantPrimary {
+				t.Errorf("Expected primary credential %d, got %d", tc.wantPrimary, created.CredentialProfileID)
+			}
+			if !slices.Equal(created.CredentialProfileIds, tc.wantIDs) {
+				t.Errorf("Expected credential list %v, got %v", tc.wantIDs, created.CredentialProfileIds)
+			}
+		})
+	}
+}
+
+func TestDiscoveryHandlerPreview(t *testing.T) {
+	globals.SetGlobalConfigForTests(&globals.Config{Discovery: globals.DiscoveryConfig{MaxTargets: 1024}})
+
+	testCases := []struct {
+		name       string
+		body       string
+		wantStatus int
+		wantCount  int64
+		wantIPs    int
+		wantType   string
+	}{
+		{"CIDR default limit", `{"target_value":"10.0.0.0/24"}`, http.StatusOK, 254, 20, "cidr"},
+		{"Range custom limit", `{"target_value":"10.0.0.1-10.0.0.10","limit":3}`, http.StatusOK, 10, 3, "range"},
+		{"Single IP", `{"target_value":"10.0.0.1"}`, http.StatusOK, 1, 1, "ip"},
+		{"Count only", `{"target_value":"10.0.0.0/23","count_only":true}`, http.StatusOK, 510, 0, "cidr"},
+		{"Over max targets", `{"target_value":"10.0.0.0/16"}`, http.StatusBadRequest, 0, 0, ""},
+		{"Invalid target", `{"target_value":"example.com"}`, http.StatusBadRequest, 0, 0, ""},
+		{"Missing target", `{}`, http.StatusBadRequest, 0, 0, ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			h := NewDiscoveryHandler(&common.Dependencies{})
+
+			rec := httptest.NewRecorder()
+			h.Preview(rec, httptest.NewRequest(http.MethodPost, "/preview", strings.NewReader(tc.body)))
+			if rec.Code != tc.wantStatus {
+				t.Fatalf("Expected status %d, got %d (body: %s)", tc.wantStatus, rec.Code, rec.Body.String())
+			}
+			if tc.wantStatus != http.StatusOK {
+				return
+			}
+
+			var resp TargetPreviewResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if resp.Count != tc.wantCount || len(resp.IPs) != tc.wantIPs || resp.Type != tc.wantType {
+				t.Errorf("Expected count=%d ips=%d type=%s, got count=%d ips=%d type=%s",
+					tc.wantCount, tc.wantIPs, tc.wantType, resp.Count, len(resp.IPs), resp.Type)
+			}
+			if resp.Truncated != (int64(tc.wantIPs) < tc.wantCount) {
+				t.Errorf("Unexpected truncated=%v", resp.Truncated)
+			}
+		})
+	}
+}
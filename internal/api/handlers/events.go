@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/nmslite/nmslite/internal/api/common"
+	"github.com/nmslite/nmslite/internal/globals"
+)
+
+// sseHeartbeatInterval keeps idle streams alive through proxies that close silent connections
+const sseHeartbeatInterval = 15 * time.Second
+
+// sseSubscriberBuffer is how many events a slow client may lag behind before events are dropped
+const sseSubscriberBuffer = 64
+
+type EventsHandler struct {
+	Deps *common.Dependencies
+}
+
+func NewEventsHandler(deps *common.Dependencies) *EventsHandler {
+	return &EventsHandler{Deps: deps}
+}
+
+// Stream handles GET /api/v1/events/stream as a Server-Sent Events stream.
+// Optional ?types=monitor_state,discovery_status,discovery_progress,host_key_changed limits the event types sent.
+func (h *EventsHandler) Stream(w http.ResponseWriter, r *http.Request) {
+	var types []string
+	if v := r.URL.Query().Get("types"); v != "" {
+		for _, t := range strings.Split(v, ",") {
+			t = strings.TrimSpace(t)
+			if !slices.Contains(globals.StreamEventTypes, t) {
+				common.SendError(w, r, http.StatusBadRequest, "INVALID_REQUEST", "Unknown event type: "+t, map[string]interface{}{
+					"allowed": globals.StreamEventTypes,
+				})
+				return
+			}
+			types = append(types, t)
+		}
+	}
+
+	if h.Deps.Events == nil {
+		common.SendError(w, r, http.StatusServiceUnavailable, "EVENTS_UNAVAILABLE", "Event stream is not available", nil)
+		return
+	}
+
+	rc := http.NewResponseController(w)
+	// The server's write timeout would otherwise cut long-lived streams
+	_ = rc.SetWriteDeadline(time.Time{})
+
+	events, unsubscribe := h.Deps.Events.Subscribe(sseSubscriberBuffer, types...)
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	heartbeat := time.NewTicker(sseHeartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			data, err := json.Marshal(event.Data)
+			if err != nil {
+				continue
+			}
+			if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, data); err != nil {
+				return
+			}
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
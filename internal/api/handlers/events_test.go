@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nmslite/nmslite/internal/api/common"
+	"github.com/nmslite/nmslite/internal/globals"
+)
+
+func TestEventsHandlerStream(t *testing.T) {
+	events := &globals.EventChannels{
+		MonitorState:      make(chan globals.MonitorStateEvent, 4),
+		DiscoveryStatus:   make(chan globals.DiscoveryStatusEvent, 4),
+		DiscoveryProgress: make(chan globals.DiscoveryProgressEvent, 4),
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go events.RunFanOut(ctx)
+
+	h := NewEventsHandler(&common.Dependencies{Events: events})
+	srv := httptest.NewServer(http.HandlerFunc(h.Stream))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "?types=monitor_state")
+	if err != nil {
+		t.Fatalf("Failed to open stream: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("Expected text/event-stream, got %q", ct)
+	}
+
+	// Filtered out, then delivered
+	events.DiscoveryStatus <- globals.DiscoveryStatusEvent{ProfileID: 9, Status: "success"}
+	events.MonitorState <- globals.MonitorStateEvent{MonitorID: 7, EventType: "down", Timestamp: time.Now()}
+
+	lines := make(chan string)
+	go func() {
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+		close(lines)
+	}()
+
+	var got []string
+	timeout := time.After(2 * time.Second)
+	for len(got) < 2 {
+		select {
+		case line, ok := <-lines:
+			if !ok {
+				t.Fatalf("Stream closed early, got %v", got)
+			}
+			if line != "" {
+				got = append(got, line)
+			}
+		case <-timeout:
+			t.Fatalf("Timed out waiting for event, got %v", got)
+		}
+	}
+
+	if got[0] != "event: monitor_state" {
+		t.Errorf("Expected monitor_state event, got %q", got[0])
+	}
+	if !strings.Contains(got[1], `"monitor_id":7`) {
+		t.Errorf("Expected monitor payload, got %q", got[1])
+	}
+}
+
+func TestEventsHandlerStreamInvalidType(t *testing.T) {
+	h := NewEventsHandler(&common.Dependencies{Events: &globals.EventChannels{}})
+
+	rec := httptest.NewRecorder()
+	h.Stream(rec, httptest.NewRequest(http.MethodGet, "/?types=bogus", nil))
+
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d, got %d", http.StatusBadRequest, rec.Code)
+	}
+}
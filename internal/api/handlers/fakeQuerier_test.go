@@ -0,0 +1,1224 @@
+package handlers
+
+import (
+	"cmp"
+	"context"
+	"maps"
+	"net/netip"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/nmslite/nmslite/internal/database/dbgen"
+)
+
+// fakeQuerier is the in-memory database behind the handler tests. Tests fill the tables
+// directly; queries read and write them the way the SQL does, as far as the handlers can
+// tell. Queries no test needs panic via the nil embedded interface.
+type fakeQuerier struct {
+	dbgen.Querier
+
+	mu sync.Mutex
+
+	monitors          map[int64]dbgen.Monitor
+	hostKeys          map[int64]dbgen.MonitorHostKey
+	groups            map[int64][]string // monitor ID -> group names
+	history           []dbgen.MonitorStateHistory
+	metrics           []dbgen.Metric
+	rollups           []dbgen.MetricsRollup
+	credentials       map[int64]dbgen.CredentialProfile
+	discoveryProfiles map[int64]dbgen.DiscoveryProfile
+	jobs              map[int64]dbgen.DiscoveryJob
+	devices           map[int64]dbgen.DiscoveredDevice
+	users             map[string]dbgen.User
+
+	// delay holds every query back, bounded by its context
+	delay time.Duration
+	// fail makes the named queries return the error instead of running
+	fail map[string]error
+	// racer, when set, runs once just before the first write, as a concurrent writer
+	// that wins the race against the request under test
+	racer func(q *fakeQuerier)
+
+	// calls counts queries and args keeps the arguments of the latest call, by name
+	calls map[string]int
+	args  map[string]any
+}
+
+func newFakeQuerier() *fakeQuerier {
+	return &fakeQuerier{
+		monitors:          make(map[int64]dbgen.Monitor),
+		hostKeys:          make(map[int64]dbgen.MonitorHostKey),
+		groups:            make(map[int64][]string),
+		credentials:       make(map[int64]dbgen.CredentialProfile),
+		discoveryProfiles: make(map[int64]dbgen.DiscoveryProfile),
+		jobs:              make(map[int64]dbgen.DiscoveryJob),
+		devices:           make(map[int64]dbgen.DiscoveredDevice),
+		users:             make(map[string]dbgen.User),
+		fail:              make(map[string]error),
+		calls:             make(map[string]int),
+		args:              make(map[string]any),
+	}
+}
+
+// lastArgs returns the arguments of the latest call to query
+func lastArgs[T any](q *fakeQuerier, query string) T {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	arg, _ := q.args[query].(T)
+	return arg
+}
+
+// read waits out the delay, locks the tables and records the call. The caller unlocks.
+func (q *fakeQuerier) read(ctx context.Context, query string, arg any) error {
+	if q.delay > 0 {
+		select {
+		case <-time.After(q.delay):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	q.mu.Lock()
+	q.calls[query]++
+	q.args[query] = arg
+	if err := q.fail[query]; err != nil {
+		q.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// write is read for statements that change the tables, letting the racer in first
+func (q *fakeQuerier) write(ctx context.Context, query string, arg any) error {
+	if err := q.read(ctx, query, arg); err != nil {
+		return err
+	}
+	if q.racer != nil {
+		q.racer(q)
+		q.racer = nil
+	}
+	return nil
+}
+
+// nextID returns the ID the next row inserted into table gets
+func nextID[V any](table map[int64]V) int64 {
+	var id int64
+	for k := range table {
+		id = max(id, k)
+	}
+	return id + 1
+}
+
+func now() pgtype.Timestamptz {
+	return pgtype.Timestamptz{Time: time.Now(), Valid: true}
+}
+
+func text(s string) pgtype.Text {
+	return pgtype.Text{String: s, Valid: true}
+}
+
+// Monitors
+
+// addMonitors stores live monitors on credential profile 1, by ID with the given statuses
+func (q *fakeQuerier) addMonitors(statuses map[int64]string) *fakeQuerier {
+	for id, status := range statuses {
+		q.monitors[id] = dbgen.Monitor{ID: id, CredentialProfileID: 1, Status: text(status), CreatedAt: now(), UpdatedAt: now()}
+	}
+	return q
+}
+
+// softDeleteMonitors marks stored monitors as deleted
+func (q *fakeQuerier) softDeleteMonitors(ids ...int64) *fakeQuerier {
+	for _, id := range ids {
+		m := q.monitors[id]
+		m.DeletedAt = now()
+		q.monitors[id] = m
+	}
+	return q
+}
+
+func (q *fakeQuerier) liveMonitor(id int64) (dbgen.Monitor, bool) {
+	m, ok := q.monitors[id]
+	return m, ok && !m.DeletedAt.Valid
+}
+
+func (q *fakeQuerier) listedMonitors(includeDeleted bool) []dbgen.Monitor {
+	var monitors []dbgen.Monitor
+	for _, id := range slices.Backward(slices.Sorted(maps.Keys(q.monitors))) {
+		m := q.monitors[id]
+		if m.Status.String != "archived" && (includeDeleted || !m.DeletedAt.Valid) {
+			monitors = append(monitors, m)
+		}
+	}
+	return monitors
+}
+
+func (q *fakeQuerier) ListArchivedMonitors(ctx context.Context) ([]dbgen.Monitor, error) {
+	if err := q.read(ctx, "ListArchivedMonitors", nil); err != nil {
+		return nil, err
+	}
+	defer q.mu.Unlock()
+	var monitors []dbgen.Monitor
+	for _, m := range q.monitors {
+		if m.Status.String == "archived" && !m.DeletedAt.Valid {
+			monitors = append(monitors, m)
+		}
+	}
+	slices.SortFunc(monitors, func(a, b dbgen.Monitor) int {
+		if c := b.ArchivedAt.Time.Compare(a.ArchivedAt.Time); c != 0 {
+			return c
+		}
+		return cmp.Compare(b.ID, a.ID)
+	})
+	return monitors, nil
+}
+
+func (q *fakeQuerier) ListMonitors(ctx context.Context, includeDeleted bool) ([]dbgen.Monitor, error) {
+	if err := q.read(ctx, "ListMonitors", includeDeleted); err != nil {
+		return nil, err
+	}
+	defer q.mu.Unlock()
+	return q.listedMonitors(includeDeleted), nil
+}
+
+func (q *fakeQuerier) GetMonitorsVersion(ctx context.Context, includeDeleted bool) (dbgen.GetMonitorsVersionRow, error) {
+	if err := q.read(ctx, "GetMonitorsVersion", includeDeleted); err != nil {
+		return dbgen.GetMonitorsVersionRow{}, err
+	}
+	defer q.mu.Unlock()
+	var version dbgen.GetMonitorsVersionRow
+	for _, m := range q.listedMonitors(includeDeleted) {
+		version.Total++
+		for _, t := range []pgtype.Timestamptz{m.UpdatedAt, m.DeletedAt} {
+			if t.Valid && t.Time.After(version.LastModified) {
+				version.LastModified = t.Time
+			}
+		}
+	}
+	return version, nil
+}
+
+func (q *fakeQuerier) GetMonitor(ctx context.Context, id int64) (dbgen.Monitor, error) {
+	if err := q.read(ctx, "GetMonitor", id); err != nil {
+		return dbgen.Monitor{}, err
+	}
+	defer q.mu.Unlock()
+	m, ok := q.liveMonitor(id)
+	if !ok {
+		return dbgen.Monitor{}, pgx.ErrNoRows
+	}
+	return m, nil
+}
+
+func (q *fakeQuerier) GetMonitorIncludingDeleted(ctx context.Context, id int64) (dbgen.Monitor, error) {
+	if err := q.read(ctx, "GetMonitorIncludingDeleted", id); err != nil {
+		return dbgen.Monitor{}, err
+	}
+	defer q.mu.Unlock()
+	m, ok := q.monitors[id]
+	if !ok {
+		return dbgen.Monitor{}, pgx.ErrNoRows
+	}
+	return m, nil
+}
+
+func (q *fakeQuerier) GetMonitorByIPAndPlugin(ctx context.Context, arg dbgen.GetMonitorByIPAndPluginParams) (dbgen.Monitor, error) {
+	if err := q.read(ctx, "GetMonitorByIPAndPlugin", arg); err != nil {
+		return dbgen.Monitor{}, err
+	}
+	defer q.mu.Unlock()
+	for _, id := range slices.Sorted(maps.Keys(q.monitors)) {
+		m, ok := q.liveMonitor(id)
+		if ok && m.IpAddress == arg.IpAddress && m.PluginID == arg.PluginID {
+			return m, nil
+		}
+	}
+	return dbgen.Monitor{}, pgx.ErrNoRows
+}
+
+func (q *fakeQuerier) GetExistingMonitorIDs(ctx context.Context, monitorIds []int64) ([]int64, error) {
+	if err := q.read(ctx, "GetExistingMonitorIDs", monitorIds); err != nil {
+		return nil, err
+	}
+	defer q.mu.Unlock()
+	var ids []int64
+	for _, id := range monitorIds {
+		if _, ok := q.liveMonitor(id); ok {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+func (q *fakeQuerier) GetMonitorWithCredentials(ctx context.Context, id int64) (dbgen.GetMonitorWithCredentialsRow, error) {
+	if err := q.read(ctx, "GetMonitorWithCredentials", id); err != nil {
+		return dbgen.GetMonitorWithCredentialsRow{}, err
+	}
+	defer q.mu.Unlock()
+	m, ok := q.liveMonitor(id)
+	c, joined := q.credentials[m.CredentialProfileID]
+	if !ok || !joined {
+		return dbgen.GetMonitorWithCredentialsRow{}, pgx.ErrNoRows
+	}
+	return dbgen.GetMonitorWithCredentialsRow{
+		ID:                     m.ID,
+		DisplayName:            m.DisplayName,
+		Hostname:               m.Hostname,
+		IpAddress:              m.IpAddress,
+		PluginID:               m.PluginID,
+		CredentialProfileID:    m.CredentialProfileID,
+		DiscoveryProfileID:     m.DiscoveryProfileID,
+		Port:                   m.Port,
+		PollingIntervalSeconds: m.PollingIntervalSeconds,
+		Status:                 m.Status,
+		CreatedAt:              m.CreatedAt,
+		UpdatedAt:              m.UpdatedAt,
+		Collectors:             m.Collectors,
+		KeepPollingWhenDown:    m.KeepPollingWhenDown,
+		Tags:                   m.Tags,
+		Payload:                c.Payload,
+	}, nil
+}
+
+func (q *fakeQuerier) CreateMonitor(ctx context.Context, arg dbgen.CreateMonitorParams) (dbgen.Monitor, error) {
+	if err := q.write(ctx, "CreateMonitor", arg); err != nil {
+		return dbgen.Monitor{}, err
+	}
+	defer q.mu.Unlock()
+	if arg.RejectDuplicate {
+		for _, d := range q.monitors {
+			if !d.DeletedAt.Valid && d.IpAddress == arg.IpAddress && d.PluginID == arg.PluginID {
+				return dbgen.Monitor{}, pgx.ErrNoRows
+			}
+		}
+	}
+	m := dbgen.Monitor{
+		ID:                     nextID(q.monitors),
+		DisplayName:            arg.DisplayName,
+		Hostname:               arg.Hostname,
+		IpAddress:              arg.IpAddress,
+		PluginID:               arg.PluginID,
+		CredentialProfileID:    arg.CredentialProfileID,
+		DiscoveryProfileID:     arg.DiscoveryProfileID,
+		Port:                   arg.Port,
+		PollingIntervalSeconds: arg.PollingIntervalSeconds,
+		Status:                 arg.Status,
+		CreatedAt:              now(),
+		UpdatedAt:              now(),
+		Collectors:             arg.Collectors,
+		KeepPollingWhenDown:    arg.KeepPollingWhenDown,
+		Tags:                   arg.Tags,
+	}
+	q.monitors[m.ID] = m
+	return m, nil
+}
+
+func (q *fakeQuerier) UpdateMonitor(ctx context.Context, arg dbgen.UpdateMonitorParams) (dbgen.Monitor, error) {
+	if err := q.write(ctx, "UpdateMonitor", arg); err != nil {
+		return dbgen.Monitor{}, err
+	}
+	defer q.mu.Unlock()
+	m, ok := q.liveMonitor(arg.ID)
+	if !ok || (arg.UnmodifiedSince.Valid && m.UpdatedAt.Time.After(arg.UnmodifiedSince.Time)) {
+		return dbgen.Monitor{}, pgx.ErrNoRows
+	}
+	if arg.RejectDuplicate {
+		for _, d := range q.monitors {
+			if d.ID != arg.ID && !d.DeletedAt.Valid && d.IpAddress == arg.IpAddress && d.PluginID == arg.PluginID {
+				return dbgen.Monitor{}, pgx.ErrNoRows
+			}
+		}
+	}
+	m.DisplayName = arg.DisplayName
+	m.Hostname = arg.Hostname
+	m.IpAddress = arg.IpAddress
+	m.PluginID = arg.PluginID
+	m.CredentialProfileID = arg.CredentialProfileID
+	m.PollingIntervalSeconds = arg.PollingIntervalSeconds
+	m.Port = arg.Port
+	m.Status = arg.Status
+	if s := arg.Status.String; s != "down" && s != "archived" {
+		m.DownSince = pgtype.Timestamptz{}
+	} else if !m.DownSince.Valid {
+		m.DownSince = now()
+	}
+	if arg.Status.String != "archived" {
+		m.ArchivedAt = pgtype.Timestamptz{}
+	} else if !m.ArchivedAt.Valid {
+		m.ArchivedAt = now()
+	}
+	m.Collectors = arg.Collectors
+	m.KeepPollingWhenDown = arg.KeepPollingWhenDown
+	m.Tags = arg.Tags
+	m.UpdatedAt = now()
+	q.monitors[m.ID] = m
+	return m, nil
+}
+
+func (q *fakeQuerier) DeleteMonitor(ctx context.Context, id int64) (int64, error) {
+	if err := q.write(ctx, "DeleteMonitor", id); err != nil {
+		return 0, err
+	}
+	defer q.mu.Unlock()
+	m, ok := q.liveMonitor(id)
+	if !ok {
+		return 0, nil
+	}
+	m.DeletedAt = now()
+	q.monitors[id] = m
+	return 1, nil
+}
+
+func (q *fakeQuerier) RestoreDeletedMonitor(ctx context.Context, id int64) (dbgen.Monitor, error) {
+	if err := q.write(ctx, "RestoreDeletedMonitor", id); err != nil {
+		return dbgen.Monitor{}, err
+	}
+	defer q.mu.Unlock()
+	m, ok := q.monitors[id]
+	if !ok || !m.DeletedAt.Valid {
+		return dbgen.Monitor{}, pgx.ErrNoRows
+	}
+	m.DeletedAt = pgtype.Timestamptz{}
+	m.UpdatedAt = now()
+	q.monitors[id] = m
+	return m, nil
+}
+
+func (q *fakeQuerier) RestoreArchivedMonitor(ctx context.Context, id int64) (dbgen.Monitor, error) {
+	if err := q.write(ctx, "RestoreArchivedMonitor", id); err != nil {
+		return dbgen.Monitor{}, err
+	}
+	defer q.mu.Unlock()
+	m, ok := q.liveMonitor(id)
+	if !ok || m.Status.String != "archived" {
+		return dbgen.Monitor{}, pgx.ErrNoRows
+	}
+	m.Status = text("active")
+	m.DownSince = pgtype.Timestamptz{}
+	m.ArchivedAt = pgtype.Timestamptz{}
+	m.UpdatedAt = now()
+	q.monitors[id] = m
+	return m, nil
+}
+
+// Monitor state history and metrics
+
+func (q *fakeQuerier) InsertMonitorStateChange(ctx context.Context, arg dbgen.InsertMonitorStateChangeParams) error {
+	if err := q.write(ctx, "InsertMonitorStateChange", arg); err != nil {
+		return err
+	}
+	defer q.mu.Unlock()
+	q.history = append(q.history, dbgen.MonitorStateHistory{
+		ID:         int64(len(q.history) + 1),
+		MonitorID:  arg.MonitorID,
+		EventType:  arg.EventType,
+		Failures:   arg.Failures,
+		OccurredAt: arg.OccurredAt,
+	})
+	return nil
+}
+
+// stateChanges returns one monitor's transitions in [start, end), oldest first
+func (q *fakeQuerier) stateChanges(monitorID int64, start, end time.Time) []dbgen.MonitorStateHistory {
+	var rows []dbgen.MonitorStateHistory
+	for _, h := range q.history {
+		if h.MonitorID == monitorID && !h.OccurredAt.Before(start) && h.OccurredAt.Before(end) {
+			rows = append(rows, h)
+		}
+	}
+	slices.SortStableFunc(rows, func(a, b dbgen.MonitorStateHistory) int { return a.OccurredAt.Compare(b.OccurredAt) })
+	return rows
+}
+
+func (q *fakeQuerier) ListMonitorStateHistory(ctx context.Context, arg dbgen.ListMonitorStateHistoryParams) ([]dbgen.MonitorStateHistory, error) {
+	if err := q.read(ctx, "ListMonitorStateHistory", arg); err != nil {
+		return nil, err
+	}
+	defer q.mu.Unlock()
+	rows := q.stateChanges(arg.MonitorID, arg.StartTime, arg.EndTime)
+	slices.Reverse(rows)
+	return rows[:min(len(rows), int(arg.RowLimit))], nil
+}
+
+func (q *fakeQuerier) ListMonitorStateChanges(ctx context.Context, arg dbgen.ListMonitorStateChangesParams) ([]dbgen.MonitorStateHistory, error) {
+	if err := q.read(ctx, "ListMonitorStateChanges", arg); err != nil {
+		return nil, err
+	}
+	defer q.mu.Unlock()
+	return q.stateChanges(arg.MonitorID, arg.StartTime, arg.EndTime), nil
+}
+
+func (q *fakeQuerier) GetLastMonitorStateChangeBefore(ctx context.Context, arg dbgen.GetLastMonitorStateChangeBeforeParams) (dbgen.MonitorStateHistory, error) {
+	if err := q.read(ctx, "GetLastMonitorStateChangeBefore", arg); err != nil {
+		return dbgen.MonitorStateHistory{}, err
+	}
+	defer q.mu.Unlock()
+	rows := q.stateChanges(arg.MonitorID, time.Time{}, arg.Before)
+	if len(rows) == 0 {
+		return dbgen.MonitorStateHistory{}, pgx.ErrNoRows
+	}
+	return rows[len(rows)-1], nil
+}
+
+// latestMetrics returns the newest sample of every metric name per device among the
+// metrics that match
+func (q *fakeQuerier) latestMetrics(match func(dbgen.Metric) bool) []dbgen.Metric {
+	type series struct {
+		device int64
+		name   string
+	}
+	latest := make(map[series]dbgen.Metric)
+	for _, m := range q.metrics {
+		key := series{m.DeviceID, m.Name}
+		if match(m) && (latest[key].Timestamp.IsZero() || m.Timestamp.After(latest[key].Timestamp)) {
+			latest[key] = m
+		}
+	}
+	rows := slices.Collect(maps.Values(latest))
+	slices.SortFunc(rows, func(a, b dbgen.Metric) int {
+		if a.DeviceID != b.DeviceID {
+			return int(a.DeviceID - b.DeviceID)
+		}
+		return strings.Compare(a.Name, b.Name)
+	})
+	return rows
+}
+
+func (q *fakeQuerier) GetLatestMetricsByDevice(ctx context.Context, arg dbgen.GetLatestMetricsByDeviceParams) ([]dbgen.Metric, error) {
+	if err := q.read(ctx, "GetLatestMetricsByDevice", arg); err != nil {
+		return nil, err
+	}
+	defer q.mu.Unlock()
+	return q.latestMetrics(func(m dbgen.Metric) bool {
+		return m.DeviceID == arg.DeviceID && !m.Timestamp.Before(arg.Since)
+	}), nil
+}
+
+func (q *fakeQuerier) GetLatestMetricsByDeviceAndPrefix(ctx context.Context, arg dbgen.GetLatestMetricsByDeviceAndPrefixParams) ([]dbgen.Metric, error) {
+	if err := q.read(ctx, "GetLatestMetricsByDeviceAndPrefix", arg); err != nil {
+		return nil, err
+	}
+	defer q.mu.Unlock()
+	prefix := strings.TrimSuffix(arg.MetricNamePattern, "%")
+	return q.latestMetrics(func(m dbgen.Metric) bool {
+		return slices.Contains(arg.DeviceIds, m.DeviceID) && strings.HasPrefix(m.Name, prefix) &&
+			!m.Timestamp.Before(arg.StartTime) && !m.Timestamp.After(arg.EndTime)
+	}), nil
+}
+
+// newestPerSeries orders rows by device, name and newest first, keeping at most limit
+// rows of each series, as the LATERAL JOIN metric queries do
+func newestPerSeries[T any](rows []T, series func(T) (int64, string), at func(T) time.Time, limit int32) []T {
+	slices.SortFunc(rows, func(a, b T) int {
+		aDevice, aName := series(a)
+		bDevice, bName := series(b)
+		return cmp.Or(cmp.Compare(aDevice, bDevice), strings.Compare(aName, bName), at(b).Compare(at(a)))
+	})
+	kept := rows[:0]
+	var n int32
+	for i, row := range rows {
+		if i > 0 {
+			prevDevice, prevName := series(rows[i-1])
+			if device, name := series(row); device != prevDevice || name != prevName {
+				n = 0
+			}
+		}
+		if n < limit {
+			kept = append(kept, row)
+		}
+		n++
+	}
+	return kept
+}
+
+func (q *fakeQuerier) GetMetricsByDeviceAndPrefix(ctx context.Context, arg dbgen.GetMetricsByDeviceAndPrefixParams) ([]dbgen.Metric, error) {
+	if err := q.read(ctx, "GetMetricsByDeviceAndPrefix", arg); err != nil {
+		return nil, err
+	}
+	defer q.mu.Unlock()
+	prefix := strings.TrimSuffix(arg.MetricNamePattern, "%")
+	var rows []dbgen.Metric
+	for _, m := range q.metrics {
+		if slices.Contains(arg.DeviceIds, m.DeviceID) && strings.HasPrefix(m.Name, prefix) &&
+			!m.Timestamp.Before(arg.StartTime) && !m.Timestamp.After(arg.EndTime) {
+			rows = append(rows, m)
+		}
+	}
+	return newestPerSeries(rows, func(m dbgen.Metric) (int64, string) { return m.DeviceID, m.Name },
+		func(m dbgen.Metric) time.Time { return m.Timestamp }, arg.LimitCount), nil
+}
+
+func (q *fakeQuerier) GetRollupMetricsByDeviceAndPrefix(ctx context.Context, arg dbgen.GetRollupMetricsByDeviceAndPrefixParams) ([]dbgen.MetricsRollup, error) {
+	if err := q.read(ctx, "GetRollupMetricsByDeviceAndPrefix", arg); err != nil {
+		return nil, err
+	}
+	defer q.mu.Unlock()
+	prefix := strings.TrimSuffix(arg.MetricNamePattern, "%")
+	var rows []dbgen.MetricsRollup
+	for _, r := range q.rollups {
+		if slices.Contains(arg.DeviceIds, r.DeviceID) && strings.HasPrefix(r.Name, prefix) &&
+			!r.Bucket.Before(arg.StartTime) && !r.Bucket.After(arg.EndTime) {
+			rows = append(rows, r)
+		}
+	}
+	return newestPerSeries(rows, func(r dbgen.MetricsRollup) (int64, string) { return r.DeviceID, r.Name },
+		func(r dbgen.MetricsRollup) time.Time { return r.Bucket }, arg.LimitCount), nil
+}
+
+func (q *fakeQuerier) GetLatestRollupMetricsByDeviceAndPrefix(ctx context.Context, arg dbgen.GetLatestRollupMetricsByDeviceAndPrefixParams) ([]dbgen.MetricsRollup, error) {
+	if err := q.read(ctx, "GetLatestRollupMetricsByDeviceAndPrefix", arg); err != nil {
+		return nil, err
+	}
+	defer q.mu.Unlock()
+	prefix := strings.TrimSuffix(arg.MetricNamePattern, "%")
+	var rows []dbgen.MetricsRollup
+	for _, r := range q.rollups {
+		if slices.Contains(arg.DeviceIds, r.DeviceID) && strings.HasPrefix(r.Name, prefix) &&
+			!r.Bucket.Before(arg.StartTime) && !r.Bucket.After(arg.EndTime) {
+			rows = append(rows, r)
+		}
+	}
+	return newestPerSeries(rows, func(r dbgen.MetricsRollup) (int64, string) { return r.DeviceID, r.Name },
+		func(r dbgen.MetricsRollup) time.Time { return r.Bucket }, 1), nil
+}
+
+func (q *fakeQuerier) GetBucketedMetricsByDeviceAndPrefix(ctx context.Context, arg dbgen.GetBucketedMetricsByDeviceAndPrefixParams) ([]dbgen.GetBucketedMetricsByDeviceAndPrefixRow, error) {
+	if err := q.read(ctx, "GetBucketedMetricsByDeviceAndPrefix", arg); err != nil {
+		return nil, err
+	}
+	defer q.mu.Unlock()
+	loc, err := time.LoadLocation(arg.Timezone)
+	if err != nil {
+		return nil, err
+	}
+	type key struct {
+		device int64
+		name   string
+		start  int64
+	}
+	sums := make(map[key][2]float64)
+	prefix := strings.TrimSuffix(arg.MetricNamePattern, "%")
+	for _, m := range q.metrics {
+		if !slices.Contains(arg.DeviceIds, m.DeviceID) || !strings.HasPrefix(m.Name, prefix) ||
+			m.Timestamp.Before(arg.StartTime) || m.Timestamp.After(arg.EndTime) {
+			continue
+		}
+		// Wall-clock alignment, as time_bucket does with a timezone
+		local := m.Timestamp.In(loc)
+		start := time.Date(local.Year(), local.Month(), local.Day(), local.Hour(), 0, 0, 0, loc)
+		if arg.Bucket == "day" {
+			start = time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, loc)
+		}
+		k := key{m.DeviceID, m.Name, start.UnixNano()}
+		sums[k] = [2]float64{sums[k][0] + m.Value, sums[k][1] + 1}
+	}
+	var rows []dbgen.GetBucketedMetricsByDeviceAndPrefixRow
+	for k, sum := range sums {
+		rows = append(rows, dbgen.GetBucketedMetricsByDeviceAndPrefixRow{
+			Bucket:   time.Unix(0, k.start),
+			DeviceID: k.device,
+			Name:     k.name,
+			AvgValue: sum[0] / sum[1],
+		})
+	}
+	slices.SortFunc(rows, func(a, b dbgen.GetBucketedMetricsByDeviceAndPrefixRow) int {
+		return cmp.Or(cmp.Compare(a.DeviceID, b.DeviceID), strings.Compare(a.Name, b.Name), b.Bucket.Compare(a.Bucket))
+	})
+	return rows, nil
+}
+
+// Monitor groups
+
+func (q *fakeQuerier) SetMonitorGroups(ctx context.Context, arg dbgen.SetMonitorGroupsParams) error {
+	if err := q.write(ctx, "SetMonitorGroups", arg); err != nil {
+		return err
+	}
+	defer q.mu.Unlock()
+	q.groups[arg.MonitorID] = slices.Clone(arg.GroupNames)
+	return nil
+}
+
+func (q *fakeQuerier) AddMonitorToGroup(ctx context.Context, arg dbgen.AddMonitorToGroupParams) error {
+	if err := q.write(ctx, "AddMonitorToGroup", arg); err != nil {
+		return err
+	}
+	defer q.mu.Unlock()
+	if !slices.Contains(q.groups[arg.MonitorID], arg.GroupName) {
+		q.groups[arg.MonitorID] = append(q.groups[arg.MonitorID], arg.GroupName)
+	}
+	return nil
+}
+
+func (q *fakeQuerier) RemoveMonitorFromGroup(ctx context.Context, arg dbgen.RemoveMonitorFromGroupParams) (int64, error) {
+	if err := q.write(ctx, "RemoveMonitorFromGroup", arg); err != nil {
+		return 0, err
+	}
+	defer q.mu.Unlock()
+	i := slices.Index(q.groups[arg.MonitorID], arg.GroupName)
+	if i < 0 {
+		return 0, nil
+	}
+	q.groups[arg.MonitorID] = slices.Delete(q.groups[arg.MonitorID], i, i+1)
+	return 1, nil
+}
+
+func (q *fakeQuerier) ListGroupsForMonitor(ctx context.Context, monitorID int64) ([]string, error) {
+	if err := q.read(ctx, "ListGroupsForMonitor", monitorID); err != nil {
+		return nil, err
+	}
+	defer q.mu.Unlock()
+	groups := slices.Clone(q.groups[monitorID])
+	slices.Sort(groups)
+	return groups, nil
+}
+
+func (q *fakeQuerier) ListMonitorIDsByGroup(ctx context.Context, groupName string) ([]int64, error) {
+	if err := q.read(ctx, "ListMonitorIDsByGroup", groupName); err != nil {
+		return nil, err
+	}
+	defer q.mu.Unlock()
+	var ids []int64
+	for id, groups := range q.groups {
+		m, ok := q.liveMonitor(id)
+		if ok && m.Status.String != "archived" && slices.Contains(groups, groupName) {
+			ids = append(ids, id)
+		}
+	}
+	slices.Sort(ids)
+	return ids, nil
+}
+
+// Monitor host keys
+
+func (q *fakeQuerier) GetMonitorHostKey(ctx context.Context, monitorID int64) (dbgen.MonitorHostKey, error) {
+	if err := q.read(ctx, "GetMonitorHostKey", monitorID); err != nil {
+		return dbgen.MonitorHostKey{}, err
+	}
+	defer q.mu.Unlock()
+	hostKey, ok := q.hostKeys[monitorID]
+	if !ok {
+		return dbgen.MonitorHostKey{}, pgx.ErrNoRows
+	}
+	return hostKey, nil
+}
+
+func (q *fakeQuerier) SetMonitorHostKeyTracking(ctx context.Context, arg dbgen.SetMonitorHostKeyTrackingParams) (dbgen.MonitorHostKey, error) {
+	if err := q.write(ctx, "SetMonitorHostKeyTracking", arg); err != nil {
+		return dbgen.MonitorHostKey{}, err
+	}
+	defer q.mu.Unlock()
+	hostKey := q.hostKeys[arg.MonitorID]
+	hostKey.MonitorID = arg.MonitorID
+	hostKey.Enabled = arg.Enabled
+	q.hostKeys[arg.MonitorID] = hostKey
+	return hostKey, nil
+}
+
+func (q *fakeQuerier) TrustMonitorHostKey(ctx context.Context, arg dbgen.TrustMonitorHostKeyParams) (int64, error) {
+	if err := q.write(ctx, "TrustMonitorHostKey", arg); err != nil {
+		return 0, err
+	}
+	defer q.mu.Unlock()
+	hostKey, ok := q.hostKeys[arg.MonitorID]
+	if !ok {
+		return 0, nil
+	}
+	hostKey.Fingerprint = arg.Fingerprint
+	hostKey.ObservedFingerprint = pgtype.Text{}
+	hostKey.TrustedAt = now()
+	q.hostKeys[arg.MonitorID] = hostKey
+	return 1, nil
+}
+
+// Credential profiles
+
+func (q *fakeQuerier) liveCredential(id int64) (dbgen.CredentialProfile, bool) {
+	c, ok := q.credentials[id]
+	return c, ok && !c.DeletedAt.Valid
+}
+
+func (q *fakeQuerier) listedCredentials(includeDeleted bool) []dbgen.CredentialProfile {
+	var profiles []dbgen.CredentialProfile
+	for _, id := range slices.Sorted(maps.Keys(q.credentials)) {
+		if c := q.credentials[id]; includeDeleted || !c.DeletedAt.Valid {
+			profiles = append(profiles, c)
+		}
+	}
+	return profiles
+}
+
+func (q *fakeQuerier) GetCredentialProfile(ctx context.Context, id int64) (dbgen.CredentialProfile, error) {
+	if err := q.read(ctx, "GetCredentialProfile", id); err != nil {
+		return dbgen.CredentialProfile{}, err
+	}
+	defer q.mu.Unlock()
+	c, ok := q.liveCredential(id)
+	if !ok {
+		return dbgen.CredentialProfile{}, pgx.ErrNoRows
+	}
+	return c, nil
+}
+
+func (q *fakeQuerier) ListCredentialProfilesByIDs(ctx context.Context, ids []int64) ([]dbgen.CredentialProfile, error) {
+	if err := q.read(ctx, "ListCredentialProfilesByIDs", ids); err != nil {
+		return nil, err
+	}
+	defer q.mu.Unlock()
+	var profiles []dbgen.CredentialProfile
+	for _, id := range ids {
+		if c, ok := q.liveCredential(id); ok {
+			profiles = append(profiles, c)
+		}
+	}
+	return profiles, nil
+}
+
+func (q *fakeQuerier) GetCredentialProfileProtocol(ctx context.Context, id int64) (string, error) {
+	if err := q.read(ctx, "GetCredentialProfileProtocol", id); err != nil {
+		return "", err
+	}
+	defer q.mu.Unlock()
+	c, ok := q.liveCredential(id)
+	if !ok {
+		return "", pgx.ErrNoRows
+	}
+	return c.Protocol, nil
+}
+
+func (q *fakeQuerier) ListCredentialProfiles(ctx context.Context, includeDeleted bool) ([]dbgen.CredentialProfile, error) {
+	if err := q.read(ctx, "ListCredentialProfiles", includeDeleted); err != nil {
+		return nil, err
+	}
+	defer q.mu.Unlock()
+	return q.listedCredentials(includeDeleted), nil
+}
+
+func (q *fakeQuerier) GetCredentialProfilesVersion(ctx context.Context, includeDeleted bool) (dbgen.GetCredentialProfilesVersionRow, error) {
+	if err := q.read(ctx, "GetCredentialProfilesVersion", includeDeleted); err != nil {
+		return dbgen.GetCredentialProfilesVersionRow{}, err
+	}
+	defer q.mu.Unlock()
+	var version dbgen.GetCredentialProfilesVersionRow
+	for _, c := range q.listedCredentials(includeDeleted) {
+		version.Total++
+		for _, t := range []pgtype.Timestamptz{c.UpdatedAt, c.DeletedAt} {
+			if t.Valid && t.Time.After(version.LastModified) {
+				version.LastModified = t.Time
+			}
+		}
+	}
+	return version, nil
+}
+
+func (q *fakeQuerier) UpdateCredentialProfile(ctx context.Context, arg dbgen.UpdateCredentialProfileParams) (dbgen.CredentialProfile, error) {
+	if err := q.write(ctx, "UpdateCredentialProfile", arg); err != nil {
+		return dbgen.CredentialProfile{}, err
+	}
+	defer q.mu.Unlock()
+	c, ok := q.liveCredential(arg.ID)
+	if !ok || (arg.UnmodifiedSince.Valid && c.UpdatedAt.Time.After(arg.UnmodifiedSince.Time)) {
+		return dbgen.CredentialProfile{}, pgx.ErrNoRows
+	}
+	c.Name = arg.Name
+	c.Description = arg.Description
+	c.Protocol = arg.Protocol
+	c.Payload = arg.Payload
+	c.UpdatedAt = now()
+	q.credentials[c.ID] = c
+	return c, nil
+}
+
+func (q *fakeQuerier) DeleteCredentialProfile(ctx context.Context, id int64) (int64, error) {
+	if err := q.write(ctx, "DeleteCredentialProfile", id); err != nil {
+		return 0, err
+	}
+	defer q.mu.Unlock()
+	c, ok := q.liveCredential(id)
+	if !ok {
+		return 0, nil
+	}
+	c.DeletedAt = now()
+	q.credentials[id] = c
+	return 1, nil
+}
+
+func (q *fakeQuerier) CountCredentialProfileReferences(ctx context.Context, id int64) (dbgen.CountCredentialProfileReferencesRow, error) {
+	if err := q.read(ctx, "CountCredentialProfileReferences", id); err != nil {
+		return dbgen.CountCredentialProfileReferencesRow{}, err
+	}
+	defer q.mu.Unlock()
+	var refs dbgen.CountCredentialProfileReferencesRow
+	for _, m := range q.monitors {
+		if !m.DeletedAt.Valid && m.CredentialProfileID == id {
+			refs.Monitors++
+		}
+	}
+	for _, p := range q.discoveryProfiles {
+		if !p.DeletedAt.Valid && (p.CredentialProfileID == id || slices.Contains(p.CredentialProfileIds, id)) {
+			refs.DiscoveryProfiles++
+		}
+	}
+	return refs, nil
+}
+
+func (q *fakeQuerier) ListCredentialPayloadsPage(ctx context.Context, arg dbgen.ListCredentialPayloadsPageParams) ([]dbgen.ListCredentialPayloadsPageRow, error) {
+	if err := q.read(ctx, "ListCredentialPayloadsPage", arg); err != nil {
+		return nil, err
+	}
+	defer q.mu.Unlock()
+	var page []dbgen.ListCredentialPayloadsPageRow
+	for _, c := range q.listedCredentials(false) {
+		if c.ID > arg.AfterID && len(page) < int(arg.LimitCount) {
+			page = append(page, dbgen.ListCredentialPayloadsPageRow{ID: c.ID, Name: c.Name, Payload: c.Payload})
+		}
+	}
+	return page, nil
+}
+
+// Discovery profiles and runs
+
+func (q *fakeQuerier) liveDiscoveryProfile(id int64) (dbgen.DiscoveryProfile, bool) {
+	p, ok := q.discoveryProfiles[id]
+	return p, ok && !p.DeletedAt.Valid
+}
+
+func (q *fakeQuerier) GetDiscoveryProfile(ctx context.Context, id int64) (dbgen.DiscoveryProfile, error) {
+	if err := q.read(ctx, "GetDiscoveryProfile", id); err != nil {
+		return dbgen.DiscoveryProfile{}, err
+	}
+	defer q.mu.Unlock()
+	p, ok := q.liveDiscoveryProfile(id)
+	if !ok {
+		return dbgen.DiscoveryProfile{}, pgx.ErrNoRows
+	}
+	return p, nil
+}
+
+func (q *fakeQuerier) ListDiscoveryProfilesByIDs(ctx context.Context, ids []int64) ([]dbgen.DiscoveryProfile, error) {
+	if err := q.read(ctx, "ListDiscoveryProfilesByIDs", ids); err != nil {
+		return nil, err
+	}
+	defer q.mu.Unlock()
+	var profiles []dbgen.DiscoveryProfile
+	for _, id := range ids {
+		if p, ok := q.liveDiscoveryProfile(id); ok {
+			profiles = append(profiles, p)
+		}
+	}
+	return profiles, nil
+}
+
+func (q *fakeQuerier) CreateDiscoveryProfile(ctx context.Context, arg dbgen.CreateDiscoveryProfileParams) (dbgen.DiscoveryProfile, error) {
+	if err := q.write(ctx, "CreateDiscoveryProfile", arg); err != nil {
+		return dbgen.DiscoveryProfile{}, err
+	}
+	defer q.mu.Unlock()
+	p := dbgen.DiscoveryProfile{
+		ID:                   nextID(q.discoveryProfiles),
+		Name:                 arg.Name,
+		TargetValue:          arg.TargetValue,
+		Port:                 arg.Port,
+		PortScanTimeoutMs:    arg.PortScanTimeoutMs,
+		CredentialProfileID:  arg.CredentialProfileID,
+		CreatedAt:            now(),
+		UpdatedAt:            now(),
+		AutoProvision:        arg.AutoProvision,
+		AutoRun:              arg.AutoRun,
+		IntervalSeconds:      arg.IntervalSeconds,
+		CredentialProfileIds: arg.CredentialProfileIds,
+		Ports:                arg.Ports,
+	}
+	q.discoveryProfiles[p.ID] = p
+	return p, nil
+}
+
+func (q *fakeQuerier) UpdateDiscoveryProfile(ctx context.Context, arg dbgen.UpdateDiscoveryProfileParams) (dbgen.DiscoveryProfile, error) {
+	if err := q.write(ctx, "UpdateDiscoveryProfile", arg); err != nil {
+		return dbgen.DiscoveryProfile{}, err
+	}
+	defer q.mu.Unlock()
+	p, ok := q.liveDiscoveryProfile(arg.ID)
+	if !ok {
+		return dbgen.DiscoveryProfile{}, pgx.ErrNoRows
+	}
+	p.Name = arg.Name
+	p.TargetValue = arg.TargetValue
+	p.Port = arg.Port
+	p.PortScanTimeoutMs = arg.PortScanTimeoutMs
+	p.CredentialProfileID = arg.CredentialProfileID
+	p.AutoProvision = arg.AutoProvision
+	p.AutoRun = arg.AutoRun
+	p.IntervalSeconds = arg.IntervalSeconds
+	p.CredentialProfileIds = arg.CredentialProfileIds
+	p.Ports = arg.Ports
+	p.UpdatedAt = now()
+	q.discoveryProfiles[p.ID] = p
+	return p, nil
+}
+
+func (q *fakeQuerier) DeleteDiscoveryProfile(ctx context.Context, id int64) (int64, error) {
+	if err := q.write(ctx, "DeleteDiscoveryProfile", id); err != nil {
+		return 0, err
+	}
+	defer q.mu.Unlock()
+	p, ok := q.liveDiscoveryProfile(id)
+	if !ok {
+		return 0, nil
+	}
+	p.DeletedAt = now()
+	q.discoveryProfiles[id] = p
+	return 1, nil
+}
+
+func (q *fakeQuerier) CountDiscoveryProfileMonitors(ctx context.Context, id int64) (int32, error) {
+	if err := q.read(ctx, "CountDiscoveryProfileMonitors", id); err != nil {
+		return 0, err
+	}
+	defer q.mu.Unlock()
+	var monitors int32
+	for _, m := range q.monitors {
+		if !m.DeletedAt.Valid && m.DiscoveryProfileID == id {
+			monitors++
+		}
+	}
+	return monitors, nil
+}
+
+func (q *fakeQuerier) ListDiscoveryTargetsPage(ctx context.Context, arg dbgen.ListDiscoveryTargetsPageParams) ([]dbgen.ListDiscoveryTargetsPageRow, error) {
+	if err := q.read(ctx, "ListDiscoveryTargetsPage", arg); err != nil {
+		return nil, err
+	}
+	defer q.mu.Unlock()
+	var page []dbgen.ListDiscoveryTargetsPageRow
+	for _, id := range slices.Sorted(maps.Keys(q.discoveryProfiles)) {
+		p, ok := q.liveDiscoveryProfile(id)
+		if ok && id > arg.AfterID && len(page) < int(arg.LimitCount) {
+			page = append(page, dbgen.ListDiscoveryTargetsPageRow{ID: p.ID, Name: p.Name, TargetValue: p.TargetValue})
+		}
+	}
+	return page, nil
+}
+
+func (q *fakeQuerier) CreateDiscoveryJob(ctx context.Context, arg dbgen.CreateDiscoveryJobParams) (dbgen.DiscoveryJob, error) {
+	if err := q.write(ctx, "CreateDiscoveryJob", arg); err != nil {
+		return dbgen.DiscoveryJob{}, err
+	}
+	defer q.mu.Unlock()
+	job := dbgen.DiscoveryJob{ID: nextID(q.jobs), ProfileID: arg.ProfileID, Status: arg.Status, InstanceID: arg.InstanceID, CreatedAt: time.Now(), UpdatedAt: time.Now()}
+	q.jobs[job.ID] = job
+	return job, nil
+}
+
+func (q *fakeQuerier) CompleteDiscoveryJob(ctx context.Context, arg dbgen.CompleteDiscoveryJobParams) error {
+	if err := q.write(ctx, "CompleteDiscoveryJob", arg); err != nil {
+		return err
+	}
+	defer q.mu.Unlock()
+	job, ok := q.jobs[arg.ID]
+	if !ok {
+		return nil
+	}
+	job.Status, job.DevicesFound, job.Error, job.ResultsStatus = arg.Status, arg.DevicesFound, arg.Error, arg.ResultsStatus
+	job.CompletedAt = now()
+	q.jobs[arg.ID] = job
+	return nil
+}
+
+func (q *fakeQuerier) GetDiscoveryJob(ctx context.Context, id int64) (dbgen.DiscoveryJob, error) {
+	if err := q.read(ctx, "GetDiscoveryJob", id); err != nil {
+		return dbgen.DiscoveryJob{}, err
+	}
+	defer q.mu.Unlock()
+	job, ok := q.jobs[id]
+	if !ok {
+		return dbgen.DiscoveryJob{}, pgx.ErrNoRows
+	}
+	return job, nil
+}
+
+// profileJobs returns the jobs of one discovery profile, newest first
+func (q *fakeQuerier) profileJobs(profileID int64) []dbgen.DiscoveryJob {
+	var jobs []dbgen.DiscoveryJob
+	for _, id := range slices.Backward(slices.Sorted(maps.Keys(q.jobs))) {
+		if job := q.jobs[id]; job.ProfileID == profileID {
+			jobs = append(jobs, job)
+		}
+	}
+	return jobs
+}
+
+func (q *fakeQuerier) GetLastFinishedDiscoveryJob(ctx context.Context, arg dbgen.GetLastFinishedDiscoveryJobParams) (dbgen.DiscoveryJob, error) {
+	if err := q.read(ctx, "GetLastFinishedDiscoveryJob", arg); err != nil {
+		return dbgen.DiscoveryJob{}, err
+	}
+	defer q.mu.Unlock()
+	for _, job := range q.profileJobs(arg.ProfileID) {
+		if job.ID < arg.BeforeID && job.ResultsStatus.String == "complete" {
+			return job, nil
+		}
+	}
+	return dbgen.DiscoveryJob{}, pgx.ErrNoRows
+}
+
+func (q *fakeQuerier) ListDiscoveryJobsByProfile(ctx context.Context, arg dbgen.ListDiscoveryJobsByProfileParams) ([]dbgen.DiscoveryJob, error) {
+	if err := q.read(ctx, "ListDiscoveryJobsByProfile", arg); err != nil {
+		return nil, err
+	}
+	defer q.mu.Unlock()
+	jobs := q.profileJobs(arg.ProfileID)
+	return jobs[:min(len(jobs), int(arg.Limit))], nil
+}
+
+func (q *fakeQuerier) ListDiscoveryJobDeviceIPs(ctx context.Context, jobID pgtype.Int8) ([]netip.Addr, error) {
+	if err := q.read(ctx, "ListDiscoveryJobDeviceIPs", jobID); err != nil {
+		return nil, err
+	}
+	defer q.mu.Unlock()
+	var addrs []netip.Addr
+	for _, d := range q.devices {
+		if d.DiscoveryJobID == jobID && !slices.Contains(addrs, d.IpAddress) {
+			addrs = append(addrs, d.IpAddress)
+		}
+	}
+	slices.SortFunc(addrs, netip.Addr.Compare)
+	return addrs, nil
+}
+
+// Discovered devices
+
+func (q *fakeQuerier) GetDiscoveredDevice(ctx context.Context, id int64) (dbgen.DiscoveredDevice, error) {
+	if err := q.read(ctx, "GetDiscoveredDevice", id); err != nil {
+		return dbgen.DiscoveredDevice{}, err
+	}
+	defer q.mu.Unlock()
+	d, ok := q.devices[id]
+	if !ok {
+		return dbgen.DiscoveredDevice{}, pgx.ErrNoRows
+	}
+	return d, nil
+}
+
+func (q *fakeQuerier) ListDiscoveredDevicesByIDs(ctx context.Context, ids []int64) ([]dbgen.DiscoveredDevice, error) {
+	if err := q.read(ctx, "ListDiscoveredDevicesByIDs", ids); err != nil {
+		return nil, err
+	}
+	defer q.mu.Unlock()
+	var devices []dbgen.DiscoveredDevice
+	for _, id := range ids {
+		if d, ok := q.devices[id]; ok {
+			devices = append(devices, d)
+		}
+	}
+	return devices, nil
+}
+
+// inventory returns the devices matching the inventory filters, newest first, each with
+// the live monitor polling its address and port
+func (q *fakeQuerier) inventory(arg dbgen.CountDiscoveredDevicesFilteredParams) []dbgen.ListDiscoveredDevicesFilteredRow {
+	var rows []dbgen.ListDiscoveredDevicesFilteredRow
+	for _, id := range slices.Backward(slices.Sorted(maps.Keys(q.devices))) {
+		d := q.devices[id]
+		var monitorID pgtype.Int8
+		for _, mid := range slices.Sorted(maps.Keys(q.monitors)) {
+			m, ok := q.liveMonitor(mid)
+			if !ok || m.IpAddress != d.IpAddress {
+				continue
+			}
+			port := m.Port
+			if !port.Valid {
+				// COALESCE(port, default_ports[plugin_id])
+				if i := slices.Index(arg.PluginIds, m.PluginID); i >= 0 {
+					port = pgtype.Int4{Int32: arg.DefaultPorts[i], Valid: true}
+				}
+			}
+			if port.Valid && port.Int32 == d.Port {
+				monitorID = pgtype.Int8{Int64: mid, Valid: true}
+				break
+			}
+		}
+		switch {
+		case arg.Status.Valid && d.Status.String != arg.Status.String:
+			continue
+		case arg.ProfileID.Valid && d.DiscoveryProfileID != arg.ProfileID:
+			continue
+		case arg.Ip != nil && !arg.Ip.Contains(d.IpAddress):
+			continue
+		case arg.Provisioned.Valid && monitorID.Valid != arg.Provisioned.Bool:
+			continue
+		}
+		rows = append(rows, dbgen.ListDiscoveredDevicesFilteredRow{
+			ID:                  d.ID,
+			DiscoveryProfileID:  d.DiscoveryProfileID,
+			IpAddress:           d.IpAddress,
+			Port:                d.Port,
+			Status:              d.Status,
+			CreatedAt:           d.CreatedAt,
+			UpdatedAt:           d.UpdatedAt,
+			CredentialProfileID: d.CredentialProfileID,
+			DiscoveryJobID:      d.DiscoveryJobID,
+			Protocol:            d.Protocol,
+			MonitorID:           monitorID,
+			Provisioned:         monitorID.Valid,
+		})
+	}
+	return rows
+}
+
+func (q *fakeQuerier) ListDiscoveredDevicesFiltered(ctx context.Context, arg dbgen.ListDiscoveredDevicesFilteredParams) ([]dbgen.ListDiscoveredDevicesFilteredRow, error) {
+	if err := q.read(ctx, "ListDiscoveredDevicesFiltered", arg); err != nil {
+		return nil, err
+	}
+	defer q.mu.Unlock()
+	var page []dbgen.ListDiscoveredDevicesFilteredRow
+	for _, row := range q.inventory(dbgen.CountDiscoveredDevicesFilteredParams{
+		Status: arg.Status, ProfileID: arg.ProfileID, Ip: arg.Ip, Provisioned: arg.Provisioned,
+		PluginIds: arg.PluginIds, DefaultPorts: arg.DefaultPorts,
+	}) {
+		if (arg.BeforeID == 0 || row.ID < arg.BeforeID) && len(page) < int(arg.LimitCount) {
+			page = append(page, row)
+		}
+	}
+	return page, nil
+}
+
+func (q *fakeQuerier) CountDiscoveredDevicesFiltered(ctx context.Context, arg dbgen.CountDiscoveredDevicesFilteredParams) (int64, error) {
+	if err := q.read(ctx, "CountDiscoveredDevicesFiltered", arg); err != nil {
+		return 0, err
+	}
+	defer q.mu.Unlock()
+	return int64(len(q.inventory(arg))), nil
+}
+
+// Users
+
+func (q *fakeQuerier) CreateUser(ctx context.Context, arg dbgen.CreateUserParams) (dbgen.User, error) {
+	if err := q.write(ctx, "CreateUser", arg); err != nil {
+		return dbgen.User{}, err
+	}
+	defer q.mu.Unlock()
+	u := dbgen.User{
+		ID:           int64(len(q.users) + 1),
+		Username:     arg.Username,
+		PasswordHash: arg.PasswordHash,
+		Role:         arg.Role,
+		CreatedAt:    time.Now(),
+		UpdatedAt:    time.Now(),
+	}
+	q.users[arg.Username] = u
+	return u, nil
+}
+
+func (q *fakeQuerier) GetUserByUsername(ctx context.Context, username string) (dbgen.User, error) {
+	if err := q.read(ctx, "GetUserByUsername", username); err != nil {
+		return dbgen.User{}, err
+	}
+	defer q.mu.Unlock()
+	u, ok := q.users[username]
+	if !ok {
+		return dbgen.User{}, pgx.ErrNoRows
+	}
+	return u, nil
+}
@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/nmslite/nmslite/internal/api/auth"
+)
+
+// maxIdempotencyKeyLen bounds the Idempotency-Key header so keys can't bloat the cache
+const maxIdempotencyKeyLen = 255
+
+// idempotencyCache remembers recent responses by Idempotency-Key so a retried or
+// double-submitted request gets the original response instead of repeating its effect.
+//
+// A key is held from the first request's start: a duplicate arriving while the first is
+// still in flight waits for it rather than racing it. Only successful responses are kept;
+// if the first request fails, the key is released and the next duplicate runs normally.
+type idempotencyCache struct {
+	mu        sync.Mutex
+	ttl       time.Duration
+	entries   map[string]*idempotencyEntry
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+type idempotencyEntry struct {
+	done     chan struct{}          // closed once the owning request has finished
+	response map[string]interface{} // nil while in flight
+	expires  time.Time
+}
+
+func newIdempotencyCache(ttl time.Duration) *idempotencyCache {
+	return &idempotencyCache{
+		ttl:     ttl,
+		entries: make(map[string]*idempotencyEntry),
+		now:     time.Now,
+	}
+}
+
+// idempotencyScope builds the cache key for a run request. Keys are scoped to the caller
+// and the profile: the same key from another user or for another profile is unrelated.
+func idempotencyScope(r *http.Request, profileID int64, key string) string {
+	user, _ := r.Context().Value(auth.UsernameKey).(string)
+	return user + "|" + strconv.FormatInt(profileID, 10) + "|" + key
+}
+
+// reserve claims key for the caller. If key already has a stored response it is returned
+// with owner=false. If another request holds key, reserve waits for it to finish first.
+// An owner must call complete exactly once.
+func (c *idempotencyCache) reserve(ctx context.Context, key string) (response map[string]interface{}, owner bool, err error) {
+	for {
+		c.mu.Lock()
+		now := c.now()
+		c.sweepLocked(now)
+
+		e, ok := c.entries[key]
+		if !ok || e.expired(now) {
+			c.entries[key] = &idempotencyEntry{done: make(chan struct{})}
+			c.mu.Unlock()
+			return nil, true, nil
+		}
+		if e.response != nil {
+			c.mu.Unlock()
+			return e.response, false, nil
+		}
+		done := e.done
+		c.mu.Unlock()
+
+		select {
+		case <-done:
+			// Either a response is stored now or the key was released; look again
+		case <-ctx.Done():
+			return nil, false, ctx.Err()
+		}
+	}
+}
+
+// complete stores the owner's response for replay, or releases key if response is nil
+func (c *idempotencyCache) complete(key string, response map[string]interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[key]
+	if !ok {
+		return
+	}
+	if response == nil {
+		delete(c.entries, key)
+	} else {
+		e.response = response
+		e.expires = c.now().Add(c.ttl)
+	}
+	close(e.done)
+}
+
+// expired reports whether a stored response is past its ttl; in-flight entries never expire
+func (e *idempotencyEntry) expired(now time.Time) bool {
+	return e.response != nil && now.After(e.expires)
+}
+
+// sweepLocked drops expired responses, at most once per ttl. Caller must hold mu.
+func (c *idempotencyCache) sweepLocked(now time.Time) {
+	if now.Sub(c.lastSweep) < c.ttl {
+		return
+	}
+	c.lastSweep = now
+	for key, e := range c.entries {
+		if e.expired(now) {
+			delete(c.entries, key)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestIdempotencyCacheExpiry(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := newIdempotencyCache(time.Minute)
+	c.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	if _, owner, _ := c.reserve(ctx, "k"); !owner {
+		t.Fatal("First reservation should own the key")
+	}
+	c.complete("k", map[string]interface{}{"job_id": "1"})
+
+	now = now.Add(30 * time.Second)
+	resp, owner, _ := c.reserve(ctx, "k")
+	if owner || resp["job_id"] != "1" {
+		t.Fatalf("Expected replay within ttl, got owner=%v resp=%v", owner, resp)
+	}
+
+	now = now.Add(time.Minute)
+	if _, owner, _ := c.reserve(ctx, "k"); !owner {
+		t.Fatal("Expired key should be reusable")
+	}
+	c.complete("k", nil)
+	if len(c.entries) != 0 {
+		t.Errorf("Released key should be dropped, have %d entries", len(c.entries))
+	}
+}
+
+func TestIdempotencyCacheWaiterGivesUp(t *testing.T) {
+	c := newIdempotencyCache(time.Minute)
+	if _, owner, _ := c.reserve(context.Background(), "k"); !owner {
+		t.Fatal("First reservation should own the key")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, _, err := c.reserve(ctx, "k"); err == nil {
+		t.Error("Expected waiter to stop when its context ends")
+	}
+}
@@ -0,0 +1,19 @@
+package handlers
+
+import (
+	"time"
+	_ "time/tzdata" // IANA zones for validation even on hosts without zoneinfo
+)
+
+// metricBuckets are the bucket sizes accepted by the metrics query
+var metricBuckets = []string{"hour", "day"}
+
+// validQueryTimezone reports whether name is an IANA zone buckets can be aligned to;
+// empty means UTC. The database does the alignment itself (time_bucket with a timezone).
+func validQueryTimezone(name string) bool {
+	if name == "" {
+		return true
+	}
+	_, err := time.LoadLocation(name)
+	return err == nil
+}
@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nmslite/nmslite/internal/api/common"
+	"github.com/nmslite/nmslite/internal/database/dbgen"
+	"github.com/nmslite/nmslite/internal/globals"
+)
+
+func TestMonitorHandlerQueryMetricsBuckets(t *testing.T) {
+	globals.SetGlobalConfigForTests(&globals.Config{})
+
+	// 2025-11-02 in New York is 25 hours long: 04:00Z to 05:00Z the next day
+	q := newFakeQuerier().addMonitors(map[int64]string{1: "active"})
+	for _, m := range []struct {
+		ts    time.Time
+		value float64
+	}{
+		{time.Date(2025, 11, 2, 4, 0, 0, 0, time.UTC), 10},
+		{time.Date(2025, 11, 3, 4, 30, 0, 0, time.UTC), 20},
+		{time.Date(2025, 11, 3, 5, 0, 0, 0, time.UTC), 90},
+		{time.Date(2025, 11, 2, 3, 59, 0, 0, time.UTC), 70},
+	} {
+		q.metrics = append(q.metrics, dbgen.Metric{DeviceID: 1, Name: "cpu", Value: m.value, Timestamp: m.ts})
+	}
+	// More samples than the raw per-series limit, all in one day
+	for i := range 150 {
+		q.metrics = append(q.metrics, dbgen.Metric{DeviceID: 1, Name: "mem", Value: float64(i % 2), Timestamp: time.Date(2025, 11, 1, 12, 0, i, 0, time.UTC)})
+	}
+	h := NewMonitorHandler(&common.Dependencies{Q: q})
+
+	body := `{"device_ids":[1],"start":"2025-11-01T00:00:00Z","end":"2025-11-04T00:00:00Z","bucket":"day","timezone":"America/New_York"}`
+	rec := httptest.NewRecorder()
+	h.QueryMetrics(rec, httptest.NewRequest(http.MethodPost, "/metrics/query", strings.NewReader(body)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d (body: %s)", rec.Code, rec.Body.String())
+	}
+
+	args := lastArgs[dbgen.GetBucketedMetricsByDeviceAndPrefixParams](q, "GetBucketedMetricsByDeviceAndPrefix")
+	if args.Bucket != "day" || args.Timezone != "America/New_York" || !args.RollupBefore.IsZero() {
+		t.Errorf("Unexpected bucket query arguments: %+v", args)
+	}
+	if q.calls["GetMetricsByDeviceAndPrefix"] != 0 {
+		t.Error("Expected no raw per-series query for a bucketed request")
+	}
+
+	var resp MetricsQueryResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	want := []struct {
+		start string
+		value float64
+	}{
+		{"2025-11-03T05:00:00Z", 90},
+		{"2025-11-02T04:00:00Z", 15},
+		{"2025-11-01T04:00:00Z", 70},
+	}
+	cpu := resp.Data["1"]["cpu"]
+	if len(cpu) != len(want) {
+		t.Fatalf("Expected %d buckets, got %d: %+v", len(want), len(cpu), cpu)
+	}
+	for i, w := range want {
+		if cpu[i].Timestamp.UTC().Format(time.RFC3339) != w.start || cpu[i].Value != w.value {
+			t.Errorf("Bucket %d: expected %s=%v, got %s=%v", i, w.start, w.value, cpu[i].Timestamp.UTC().Format(time.RFC3339), cpu[i].Value)
+		}
+	}
+	if mem := resp.Data["1"]["mem"]; len(mem) != 1 || mem[0].Value != 0.5 {
+		t.Errorf("Expected every mem sample averaged into one bucket, got %+v", mem)
+	}
+
+	// Without a timezone buckets align to UTC
+	body = `{"device_ids":[1],"start":"2025-11-01T00:00:00Z","end":"2025-11-04T00:00:00Z","bucket":"hour"}`
+	h.QueryMetrics(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/metrics/query", strings.NewReader(body)))
+	if args := lastArgs[dbgen.GetBucketedMetricsByDeviceAndPrefixParams](q, "GetBucketedMetricsByDeviceAndPrefix"); args.Timezone != "UTC" {
+		t.Errorf("Expected UTC alignment by default, got %q", args.Timezone)
+	}
+}
+
+func TestMonitorHandlerQueryMetricsBucketValidation(t *testing.T) {
+	globals.SetGlobalConfigForTests(&globals.Config{})
+	h := NewMonitorHandler(nil)
+
+	testCases := []struct {
+		name string
+		body string
+	}{
+		{"Unknown timezone", `"bucket":"day","timezone":"Mars/Olympus"`},
+		{"Unknown bucket", `"bucket":"week"`},
+		{"Bucket with latest", `"bucket":"day","latest":true`},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			body := `{"device_ids":[1],"start":"2025-11-01T00:00:00Z","end":"2025-11-03T00:00:00Z",` + tc.body + `}`
+			rec := httptest.NewRecorder()
+			h.QueryMetrics(rec, httptest.NewRequest(http.MethodPost, "/metrics/query", strings.NewReader(body)))
+			if rec.Code != http.StatusBadRequest {
+				t.Errorf("Expected status 400, got %d (body: %s)", rec.Code, rec.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,32 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/nmslite/nmslite/internal/api/common"
+)
+
+// Effective handles GET /api/v1/monitors/{id}/effective. It reports the configuration
+// the scheduler polls the monitor with (port, interval, thresholds, liveness method,
+// collectors) after every default and bound is applied, and where the port and interval
+// come from, so "why is it polling on port 0" can be answered without reading config.
+func (h *MonitorHandler) Effective(w http.ResponseWriter, r *http.Request) {
+	id, ok := common.ParseIDParam(w, r, "id")
+	if !ok {
+		return
+	}
+	if h.Deps.Scheduler == nil {
+		common.SendError(w, r, http.StatusServiceUnavailable, "SCHEDULER_UNAVAILABLE", "Scheduler not running", nil)
+		return
+	}
+
+	ctx, cancel := common.QueryContext(r)
+	defer cancel()
+
+	monitor, err := h.Deps.Q.GetMonitor(ctx, id)
+	if common.HandleDBError(w, r, err, "Monitor") {
+		return
+	}
+
+	common.SendJSON(w, http.StatusOK, h.Deps.Scheduler.EffectiveConfig(monitor))
+}
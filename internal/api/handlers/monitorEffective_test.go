@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/nmslite/nmslite/internal/api/common"
+	"github.com/nmslite/nmslite/internal/database/dbgen"
+	"github.com/nmslite/nmslite/internal/globals"
+)
+
+func TestMonitorHandlerEffective(t *testing.T) {
+	globals.SetGlobalConfigForTests(&globals.Config{})
+
+	testCases := []struct {
+		name       string
+		path       string
+		scheduler  common.SchedulerInspector
+		wantStatus int
+	}{
+		{"Resolved", "/1/effective", &fakeScheduler{}, http.StatusOK},
+		{"Unknown monitor", "/2/effective", &fakeScheduler{}, http.StatusNotFound},
+		{"Scheduler not running", "/1/effective", nil, http.StatusServiceUnavailable},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			q := newFakeQuerier()
+			q.monitors[1] = dbgen.Monitor{ID: 1, PluginID: "ssh"}
+			h := NewMonitorHandler(&common.Dependencies{
+				Q:         q,
+				Scheduler: tc.scheduler,
+			})
+			r := chi.NewRouter()
+			r.Get("/{id}/effective", h.Effective)
+
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tc.path, nil))
+
+			if rec.Code != tc.wantStatus {
+				t.Fatalf("Expected status %d, got %d (body: %s)", tc.wantStatus, rec.Code, rec.Body.String())
+			}
+			if rec.Code != http.StatusOK {
+				return
+			}
+			var cfg globals.EffectiveMonitorConfig
+			if err := json.Unmarshal(rec.Body.Bytes(), &cfg); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if cfg.MonitorID != 1 || cfg.PluginID != "ssh" || cfg.Port != 22 {
+				t.Errorf("Expected the scheduler's resolution for monitor 1, got %+v", cfg)
+			}
+		})
+	}
+}
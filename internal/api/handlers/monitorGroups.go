@@ -0,0 +1,162 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/nmslite/nmslite/internal/api/common"
+	"github.com/nmslite/nmslite/internal/database/dbgen"
+)
+
+// maxGroupNameLength matches monitor_groups.group_name
+const maxGroupNameLength = 100
+
+// MonitorGroupsResponse lists the groups a monitor belongs to
+type MonitorGroupsResponse struct {
+	MonitorID int64    `json:"monitor_id"`
+	Groups    []string `json:"groups"`
+}
+
+// monitorGroupsRequest replaces a monitor's groups
+type monitorGroupsRequest struct {
+	Groups []string `json:"groups"`
+}
+
+// normalizeGroupName trims a group name and checks its length
+func normalizeGroupName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", fmt.Errorf("group names must not be empty")
+	}
+	if len(name) > maxGroupNameLength {
+		return "", fmt.Errorf("group name %q is longer than %d characters", name, maxGroupNameLength)
+	}
+	return name, nil
+}
+
+// ListGroups handles GET /api/v1/monitors/groups, listing every group with its size
+func (h *MonitorHandler) ListGroups(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := common.QueryContext(r)
+	defer cancel()
+
+	groups, err := h.Deps.Q.ListMonitorGroups(ctx)
+	if common.HandleDBError(w, r, err, "Monitor group") {
+		return
+	}
+	common.SendListResponse(w, groups, len(groups))
+}
+
+// GetGroups handles GET /api/v1/monitors/{id}/groups
+func (h *MonitorHandler) GetGroups(w http.ResponseWriter, r *http.Request) {
+	id, ok := common.ParseIDParam(w, r, "id")
+	if !ok {
+		return
+	}
+
+	ctx, cancel := common.QueryContext(r)
+	defer cancel()
+
+	if _, err := h.Deps.Q.GetMonitor(ctx, id); common.HandleDBError(w, r, err, "Monitor") {
+		return
+	}
+	h.sendGroups(w, r, id)
+}
+
+// SetGroups handles PUT /api/v1/monitors/{id}/groups, replacing the monitor's groups
+func (h *MonitorHandler) SetGroups(w http.ResponseWriter, r *http.Request) {
+	id, ok := common.ParseIDParam(w, r, "id")
+	if !ok {
+		return
+	}
+
+	req, ok := common.DecodeJSON[monitorGroupsRequest](w, r)
+	if !ok {
+		return
+	}
+
+	groups := make([]string, 0, len(req.Groups))
+	for _, g := range req.Groups {
+		name, err := normalizeGroupName(g)
+		if err != nil {
+			common.SendError(w, r, http.StatusBadRequest, "VALIDATION_ERROR", err.Error(), nil)
+			return
+		}
+		if !slices.Contains(groups, name) {
+			groups = append(groups, name)
+		}
+	}
+
+	if _, err := h.Deps.Q.GetMonitor(r.Context(), id); common.HandleDBError(w, r, err, "Monitor") {
+		return
+	}
+
+	err := h.Deps.Q.SetMonitorGroups(r.Context(), dbgen.SetMonitorGroupsParams{
+		MonitorID:  id,
+		GroupNames: groups,
+	})
+	if common.HandleDBError(w, r, err, "Monitor group") {
+		return
+	}
+	h.sendGroups(w, r, id)
+}
+
+// AddToGroup handles PUT /api/v1/monitors/{id}/groups/{group}
+func (h *MonitorHandler) AddToGroup(w http.ResponseWriter, r *http.Request) {
+	id, ok := common.ParseIDParam(w, r, "id")
+	if !ok {
+		return
+	}
+	group, err := normalizeGroupName(chi.URLParam(r, "group"))
+	if err != nil {
+		common.SendError(w, r, http.StatusBadRequest, "VALIDATION_ERROR", err.Error(), nil)
+		return
+	}
+
+	if _, err := h.Deps.Q.GetMonitor(r.Context(), id); common.HandleDBError(w, r, err, "Monitor") {
+		return
+	}
+
+	err = h.Deps.Q.AddMonitorToGroup(r.Context(), dbgen.AddMonitorToGroupParams{MonitorID: id, GroupName: group})
+	if common.HandleDBError(w, r, err, "Monitor group") {
+		return
+	}
+	h.sendGroups(w, r, id)
+}
+
+// RemoveFromGroup handles DELETE /api/v1/monitors/{id}/groups/{group}
+func (h *MonitorHandler) RemoveFromGroup(w http.ResponseWriter, r *http.Request) {
+	id, ok := common.ParseIDParam(w, r, "id")
+	if !ok {
+		return
+	}
+	group := strings.TrimSpace(chi.URLParam(r, "group"))
+
+	removed, err := h.Deps.Q.RemoveMonitorFromGroup(r.Context(), dbgen.RemoveMonitorFromGroupParams{
+		MonitorID: id,
+		GroupName: group,
+	})
+	if common.HandleDBError(w, r, err, "Monitor group") {
+		return
+	}
+	if removed == 0 {
+		common.SendError(w, r, http.StatusNotFound, "NOT_FOUND", "Monitor is not in group "+group, nil)
+		return
+	}
+
+	common.SendJSON(w, http.StatusNoContent, nil)
+}
+
+// sendGroups responds with the monitor's current groups
+func (h *MonitorHandler) sendGroups(w http.ResponseWriter, r *http.Request, id int64) {
+	groups, err := h.Deps.Q.ListGroupsForMonitor(r.Context(), id)
+	if common.HandleDBError(w, r, err, "Monitor group") {
+		return
+	}
+	if groups == nil {
+		groups = []string{}
+	}
+	common.SendJSON(w, http.StatusOK, MonitorGroupsResponse{MonitorID: id, Groups: groups})
+}
@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/nmslite/nmslite/internal/api/common"
+	"github.com/nmslite/nmslite/internal/database/dbgen"
+	"github.com/nmslite/nmslite/internal/globals"
+)
+
+func newGroupTestRouter(q *fakeQuerier) http.Handler {
+	h := NewMonitorHandler(&common.Dependencies{Q: q})
+	r := chi.NewRouter()
+	r.Get("/{id}/groups", h.GetGroups)
+	r.Put("/{id}/groups", h.SetGroups)
+	r.Put("/{id}/groups/{group}", h.AddToGroup)
+	r.Delete("/{id}/groups/{group}", h.RemoveFromGroup)
+	r.Post("/metrics/query", h.QueryMetrics)
+	return r
+}
+
+func TestMonitorHandlerGroups(t *testing.T) {
+	globals.SetGlobalConfigForTests(&globals.Config{})
+
+	q := newFakeQuerier().addMonitors(map[int64]string{1: "active", 2: "active"})
+	r := newGroupTestRouter(q)
+
+	testCases := []struct {
+		name       string
+		method     string
+		path       string
+		body       string
+		wantStatus int
+		wantGroups []string
+	}{
+		{"Replace trims and dedups", http.MethodPut, "/1/groups", `{"groups":[" edge-routers ","dc-1","dc-1"]}`, http.StatusOK, []string{"dc-1", "edge-routers"}},
+		{"Empty name rejected", http.MethodPut, "/1/groups", `{"groups":[" "]}`, http.StatusBadRequest, nil},
+		{"Unknown monitor", http.MethodPut, "/9/groups", `{"groups":["dc-1"]}`, http.StatusNotFound, nil},
+		{"Add one group", http.MethodPut, "/1/groups/lab", "", http.StatusOK, []string{"dc-1", "edge-routers", "lab"}},
+		{"Remove one group", http.MethodDelete, "/1/groups/edge-routers", "", http.StatusNoContent, nil},
+		{"Remove missing membership", http.MethodDelete, "/1/groups/edge-routers", "", http.StatusNotFound, nil},
+		{"Get groups", http.MethodGet, "/1/groups", "", http.StatusOK, []string{"dc-1", "lab"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, httptest.NewRequest(tc.method, tc.path, strings.NewReader(tc.body)))
+			if rec.Code != tc.wantStatus {
+				t.Fatalf("Expected status %d, got %d (body: %s)", tc.wantStatus, rec.Code, rec.Body.String())
+			}
+			if tc.wantGroups == nil {
+				return
+			}
+			var resp MonitorGroupsResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if !slices.Equal(resp.Groups, tc.wantGroups) {
+				t.Errorf("Expected groups %v, got %v", tc.wantGroups, resp.Groups)
+			}
+		})
+	}
+}
+
+func TestMonitorHandlerQueryMetricsByGroup(t *testing.T) {
+	globals.SetGlobalConfigForTests(&globals.Config{})
+
+	q := newFakeQuerier().addMonitors(map[int64]string{1: "active", 2: "active", 3: "archived", 5: "active"})
+	q.groups = map[int64][]string{1: {"dc-1"}, 2: {"dc-1"}, 3: {"dc-1"}}
+	r := newGroupTestRouter(q)
+
+	start := time.Now().Add(-time.Hour).UTC().Format(time.RFC3339)
+	end := time.Now().UTC().Format(time.RFC3339)
+	body := `{"group":"dc-1","device_ids":[2,5],"latest":true,"start":"` + start + `","end":"` + end + `"}`
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/metrics/query", strings.NewReader(body)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d (body: %s)", rec.Code, rec.Body.String())
+	}
+	queried := lastArgs[dbgen.GetLatestMetricsByDeviceAndPrefixParams](q, "GetLatestMetricsByDeviceAndPrefix").DeviceIds
+	if want := []int64{2, 5, 1}; !slices.Equal(queried, want) {
+		t.Errorf("Expected query over %v, got %v", want, queried)
+	}
+
+	// An empty group with no explicit IDs returns no data rather than an error
+	body = `{"group":"nobody","latest":true,"start":"` + start + `","end":"` + end + `"}`
+	rec = httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/metrics/query", strings.NewReader(body)))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"data":{}`) {
+		t.Errorf("Expected empty 200 for an empty group, got %d (body: %s)", rec.Code, rec.Body.String())
+	}
+}
@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/nmslite/nmslite/internal/api/common"
+	"github.com/nmslite/nmslite/internal/database/dbgen"
+	"github.com/nmslite/nmslite/internal/discovery"
+)
+
+// hostKeyTrackingRequest opts a monitor in or out of SSH host key verification
+type hostKeyTrackingRequest struct {
+	Enabled *bool `json:"enabled"`
+}
+
+// GetHostKey handles GET /api/v1/monitors/{id}/host-key. Monitors never opted in are
+// reported as disabled with no known key.
+func (h *MonitorHandler) GetHostKey(w http.ResponseWriter, r *http.Request) {
+	id, ok := common.ParseIDParam(w, r, "id")
+	if !ok {
+		return
+	}
+
+	ctx, cancel := common.QueryContext(r)
+	defer cancel()
+
+	if _, err := h.Deps.Q.GetMonitor(ctx, id); common.HandleDBError(w, r, err, "Monitor") {
+		return
+	}
+	hostKey, err := h.Deps.Q.GetMonitorHostKey(ctx, id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		hostKey, err = dbgen.MonitorHostKey{MonitorID: id}, nil
+	}
+	if common.HandleDBError(w, r, err, "Host key") {
+		return
+	}
+	common.SendJSON(w, http.StatusOK, hostKey)
+}
+
+// SetHostKeyTracking handles PUT /api/v1/monitors/{id}/host-key. Enabling verification
+// on a monitor with no known key trusts the key seen on the next check.
+func (h *MonitorHandler) SetHostKeyTracking(w http.ResponseWriter, r *http.Request) {
+	id, ok := common.ParseIDParam(w, r, "id")
+	if !ok {
+		return
+	}
+
+	req, ok := common.DecodeJSON[hostKeyTrackingRequest](w, r)
+	if !ok {
+		return
+	}
+	if req.Enabled == nil {
+		common.SendError(w, r, http.StatusBadRequest, "VALIDATION_ERROR", "enabled is required", nil)
+		return
+	}
+
+	monitor, err := h.Deps.Q.GetMonitor(r.Context(), id)
+	if common.HandleDBError(w, r, err, "Monitor") {
+		return
+	}
+	if *req.Enabled && monitor.PluginID != discovery.HostKeyPluginID {
+		common.SendError(w, r, http.StatusBadRequest, "VALIDATION_ERROR",
+			"Host key verification is only available for "+discovery.HostKeyPluginID+" monitors", nil)
+		return
+	}
+
+	hostKey, err := h.Deps.Q.SetMonitorHostKeyTracking(r.Context(), dbgen.SetMonitorHostKeyTrackingParams{
+		MonitorID: id,
+		Enabled:   *req.Enabled,
+	})
+	if common.HandleDBError(w, r, err, "Host key") {
+		return
+	}
+	common.SendJSON(w, http.StatusOK, hostKey)
+}
+
+// AcceptHostKey handles POST /api/v1/monitors/{id}/host-key/accept, trusting the changed
+// key last observed on the device (e.g. after a planned rebuild).
+func (h *MonitorHandler) AcceptHostKey(w http.ResponseWriter, r *http.Request) {
+	id, ok := common.ParseIDParam(w, r, "id")
+	if !ok {
+		return
+	}
+
+	hostKey, err := h.Deps.Q.GetMonitorHostKey(r.Context(), id)
+	if common.HandleDBError(w, r, err, "Host key") {
+		return
+	}
+	if !hostKey.ObservedFingerprint.Valid {
+		common.SendError(w, r, http.StatusConflict, "NO_HOST_KEY_CHANGE", "No changed host key is pending for this monitor", nil)
+		return
+	}
+
+	if _, err := h.Deps.Q.TrustMonitorHostKey(r.Context(), dbgen.TrustMonitorHostKeyParams{
+		MonitorID:   id,
+		Fingerprint: hostKey.ObservedFingerprint,
+	}); common.HandleDBError(w, r, err, "Host key") {
+		return
+	}
+
+	hostKey, err = h.Deps.Q.GetMonitorHostKey(r.Context(), id)
+	if common.HandleDBError(w, r, err, "Host key") {
+		return
+	}
+	common.SendJSON(w, http.StatusOK, hostKey)
+}
@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/nmslite/nmslite/internal/api/common"
+	"github.com/nmslite/nmslite/internal/database/dbgen"
+	"github.com/nmslite/nmslite/internal/globals"
+)
+
+func TestMonitorHandlerHostKey(t *testing.T) {
+	globals.SetGlobalConfigForTests(&globals.Config{})
+
+	q := newFakeQuerier()
+	for id, plugin := range map[int64]string{1: "ssh", 2: "snmp-v2c", 3: "ssh"} {
+		q.monitors[id] = dbgen.Monitor{ID: id, PluginID: plugin}
+	}
+	q.hostKeys[3] = dbgen.MonitorHostKey{
+		MonitorID:           3,
+		Enabled:             true,
+		Fingerprint:         pgtype.Text{String: "SHA256:old", Valid: true},
+		ObservedFingerprint: pgtype.Text{String: "SHA256:new", Valid: true},
+	}
+
+	h := NewMonitorHandler(&common.Dependencies{Q: q})
+	r := chi.NewRouter()
+	r.Get("/{id}/host-key", h.GetHostKey)
+	r.Put("/{id}/host-key", h.SetHostKeyTracking)
+	r.Post("/{id}/host-key/accept", h.AcceptHostKey)
+
+	testCases := []struct {
+		name            string
+		method          string
+		path            string
+		body            string
+		wantStatus      int
+		wantEnabled     bool
+		wantFingerprint string
+	}{
+		{"Not opted in", http.MethodGet, "/1/host-key", "", http.StatusOK, false, ""},
+		{"Unknown monitor", http.MethodGet, "/9/host-key", "", http.StatusNotFound, false, ""},
+		{"Enable on ssh monitor", http.MethodPut, "/1/host-key", `{"enabled":true}`, http.StatusOK, true, ""},
+		{"Enable on non-ssh monitor", http.MethodPut, "/2/host-key", `{"enabled":true}`, http.StatusBadRequest, false, ""},
+		{"Missing enabled", http.MethodPut, "/1/host-key", `{}`, http.StatusBadRequest, false, ""},
+		{"Accept without change", http.MethodPost, "/1/host-key/accept", "", http.StatusConflict, false, ""},
+		{"Accept never tracked", http.MethodPost, "/2/host-key/accept", "", http.StatusNotFound, false, ""},
+		{"Accept changed key", http.MethodPost, "/3/host-key/accept", "", http.StatusOK, true, "SHA256:new"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, httptest.NewRequest(tc.method, tc.path, strings.NewReader(tc.body)))
+			if rec.Code != tc.wantStatus {
+				t.Fatalf("Expected status %d, got %d (body: %s)", tc.wantStatus, rec.Code, rec.Body.String())
+			}
+			if rec.Code != http.StatusOK {
+				return
+			}
+			var resp dbgen.MonitorHostKey
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if resp.Enabled != tc.wantEnabled {
+				t.Errorf("Expected enabled %v, got %v", tc.wantEnabled, resp.Enabled)
+			}
+			if resp.Fingerprint.String != tc.wantFingerprint {
+				t.Errorf("Expected fingerprint %q, got %q", tc.wantFingerprint, resp.Fingerprint.String)
+			}
+			if resp.ObservedFingerprint.Valid {
+				t.Errorf("Expected no pending key change, got %q", resp.ObservedFingerprint.String)
+			}
+		})
+	}
+}
@@ -0,0 +1,183 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/nmslite/nmslite/internal/api/common"
+	"github.com/nmslite/nmslite/internal/database/dbgen"
+)
+
+// defaultUptimeWindow is the uptime range used when ?start is omitted
+const defaultUptimeWindow = 30 * 24 * time.Hour
+
+// UptimeResponse summarizes a monitor's availability over a window.
+// Time spent paused (maintenance) is excluded from both sides of the percentage.
+type UptimeResponse struct {
+	MonitorID int64     `json:"monitor_id"`
+	Start     time.Time `json:"start"`
+	End       time.Time `json:"end"`
+	// UptimePercent is up time over monitored time (100 when nothing was monitored)
+	UptimePercent    float64 `json:"uptime_percent"`
+	MonitoredSeconds float64 `json:"monitored_seconds"`
+	ExcludedSeconds  float64 `json:"excluded_seconds"`
+	DownSeconds      float64 `json:"down_seconds"`
+	// Outages counts outages overlapping the window, including one already in progress at start
+	Outages int `json:"outages"`
+	// MTTRSeconds is the mean full duration of outages that recovered within the window
+	MTTRSeconds float64 `json:"mttr_seconds"`
+	// Ongoing reports an outage still in progress at end
+	Ongoing bool `json:"ongoing"`
+}
+
+// availability is the state a monitor is in between two transitions
+type availability int
+
+const (
+	stateUp availability = iota
+	stateDown
+	statePaused
+)
+
+// nextAvailability applies a recorded transition. Events that do not change
+// reachability (e.g. "degraded") keep the current state.
+func nextAvailability(current availability, eventType string) availability {
+	switch eventType {
+	case "down", "archived":
+		return stateDown
+	case "recovered", "resumed":
+		return stateUp
+	case "paused":
+		return statePaused
+	}
+	return current
+}
+
+// computeUptime walks transitions (oldest first, all within [start, end)) starting from
+// the state set by prior, the last transition before start (nil when there is none).
+func computeUptime(prior *dbgen.MonitorStateHistory, transitions []dbgen.MonitorStateHistory, start, end time.Time) UptimeResponse {
+	report := UptimeResponse{Start: start, End: end}
+
+	var down, excluded, repaired time.Duration
+	var recovered int
+	var outageStart time.Time
+
+	state := stateUp
+	if prior != nil {
+		state = nextAvailability(stateUp, prior.EventType)
+		if state == stateDown {
+			outageStart = prior.OccurredAt
+			report.Outages++
+		}
+	}
+
+	cursor := start
+	advance := func(to time.Time) {
+		switch state {
+		case stateDown:
+			down += to.Sub(cursor)
+		case statePaused:
+			excluded += to.Sub(cursor)
+		}
+		cursor = to
+	}
+
+	for _, t := range transitions {
+		advance(t.OccurredAt)
+
+		next := nextAvailability(state, t.EventType)
+		switch {
+		case state == stateDown && next == stateUp:
+			repaired += t.OccurredAt.Sub(outageStart)
+			recovered++
+		case state != stateDown && next == stateDown:
+			outageStart = t.OccurredAt
+			report.Outages++
+		}
+		state = next
+	}
+	advance(end)
+
+	monitored := end.Sub(start) - excluded
+	report.MonitoredSeconds = monitored.Seconds()
+	report.ExcludedSeconds = excluded.Seconds()
+	report.DownSeconds = down.Seconds()
+	report.Ongoing = state == stateDown
+
+	report.UptimePercent = 100
+	if monitored > 0 {
+		report.UptimePercent = 100 * float64(monitored-down) / float64(monitored)
+	}
+	if recovered > 0 {
+		report.MTTRSeconds = repaired.Seconds() / float64(recovered)
+	}
+	return report
+}
+
+// Uptime handles GET /api/v1/monitors/{id}/uptime.
+// Optional ?start= and ?end= (RFC3339, default the last 30 days) bound the window; it is
+// clipped to the monitor's lifetime and to now. Soft-deleted monitors still report, up to
+// their deletion.
+func (h *MonitorHandler) Uptime(w http.ResponseWriter, r *http.Request) {
+	id, ok := common.ParseIDParam(w, r, "id")
+	if !ok {
+		return
+	}
+
+	start, end, ok := parseTimeRange(w, r, defaultUptimeWindow)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := common.QueryContext(r)
+	defer cancel()
+	q := h.Deps.Reader(common.ReadReplica)
+
+	monitor, err := q.GetMonitorIncludingDeleted(ctx, id)
+	if common.HandleDBError(w, r, err, "Monitor") {
+		return
+	}
+
+	if monitor.CreatedAt.Valid && monitor.CreatedAt.Time.After(start) {
+		start = monitor.CreatedAt.Time.UTC()
+	}
+	if monitor.DeletedAt.Valid && monitor.DeletedAt.Time.Before(end) {
+		end = monitor.DeletedAt.Time.UTC()
+	}
+	if now := time.Now().UTC(); now.Before(end) {
+		end = now
+	}
+	if !start.Before(end) {
+		report := computeUptime(nil, nil, start, start)
+		report.MonitorID = id
+		common.SendJSON(w, http.StatusOK, report)
+		return
+	}
+
+	var prior *dbgen.MonitorStateHistory
+	last, err := q.GetLastMonitorStateChangeBefore(ctx, dbgen.GetLastMonitorStateChangeBeforeParams{
+		MonitorID: id,
+		Before:    start,
+	})
+	if err == nil {
+		prior = &last
+	} else if !errors.Is(err, pgx.ErrNoRows) {
+		common.HandleDBError(w, r, err, "State history")
+		return
+	}
+
+	transitions, err := q.ListMonitorStateChanges(ctx, dbgen.ListMonitorStateChangesParams{
+		MonitorID: id,
+		StartTime: start,
+		EndTime:   end,
+	})
+	if common.HandleDBError(w, r, err, "State history") {
+		return
+	}
+
+	report := computeUptime(prior, transitions, start, end)
+	report.MonitorID = id
+	common.SendJSON(w, http.StatusOK, report)
+}
@@ -0,0 +1,214 @@
+package handlers
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/nmslite/nmslite/internal/api/common"
+	"github.com/nmslite/nmslite/internal/database/dbgen"
+	"github.com/nmslite/nmslite/internal/globals"
+)
+
+func TestComputeUptime(t *testing.T) {
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	end := start.Add(10 * time.Hour)
+	at := func(hours float64, eventType string) dbgen.MonitorStateHistory {
+		return dbgen.MonitorStateHistory{EventType: eventType, OccurredAt: start.Add(time.Duration(hours * float64(time.Hour)))}
+	}
+
+	testCases := []struct {
+		name          string
+		prior         *dbgen.MonitorStateHistory
+		transitions   []dbgen.MonitorStateHistory
+		wantUptime    float64
+		wantDownHours float64
+		wantExcluded  float64
+		wantOutages   int
+		wantMTTRHours float64
+		wantOngoing   bool
+	}{
+		{
+			name:       "No history",
+			wantUptime: 100,
+		},
+		{
+			name:          "Single outage",
+			transitions:   []dbgen.MonitorStateHistory{at(2, "down"), at(3, "recovered")},
+			wantUptime:    90,
+			wantDownHours: 1,
+			wantOutages:   1,
+			wantMTTRHours: 1,
+		},
+		{
+			name:          "Degraded does not count as down",
+			transitions:   []dbgen.MonitorStateHistory{at(1, "degraded"), at(2, "down"), at(2.5, "down"), at(4, "recovered"), at(5, "degraded")},
+			wantUptime:    80,
+			wantDownHours: 2,
+			wantOutages:   1,
+			wantMTTRHours: 2,
+		},
+		{
+			name:          "Outage spanning start",
+			prior:         &dbgen.MonitorStateHistory{EventType: "down", OccurredAt: start.Add(-2 * time.Hour)},
+			transitions:   []dbgen.MonitorStateHistory{at(1, "recovered")},
+			wantUptime:    90,
+			wantDownHours: 1,
+			wantOutages:   1,
+			wantMTTRHours: 3,
+		},
+		{
+			name:          "Ongoing outage at end",
+			transitions:   []dbgen.MonitorStateHistory{at(1, "down"), at(2, "recovered"), at(8, "down")},
+			wantUptime:    70,
+			wantDownHours: 3,
+			wantOutages:   2,
+			wantMTTRHours: 1,
+			wantOngoing:   true,
+		},
+		{
+			name:          "Archived outage stays down",
+			prior:         &dbgen.MonitorStateHistory{EventType: "down", OccurredAt: start.Add(-time.Hour)},
+			transitions:   []dbgen.MonitorStateHistory{at(5, "archived")},
+			wantUptime:    0,
+			wantDownHours: 10,
+			wantOutages:   1,
+			wantOngoing:   true,
+		},
+		{
+			name:          "Maintenance excluded",
+			transitions:   []dbgen.MonitorStateHistory{at(2, "paused"), at(7, "resumed"), at(8, "down"), at(9, "recovered")},
+			wantUptime:    80,
+			wantDownHours: 1,
+			wantExcluded:  5,
+			wantOutages:   1,
+			wantMTTRHours: 1,
+		},
+		{
+			name:          "Pause during an outage ends it without a recovery",
+			transitions:   []dbgen.MonitorStateHistory{at(1, "down"), at(3, "paused"), at(4, "resumed")},
+			wantUptime:    100 * 7.0 / 9.0,
+			wantDownHours: 2,
+			wantExcluded:  1,
+			wantOutages:   1,
+		},
+		{
+			name:         "Paused through the whole window",
+			prior:        &dbgen.MonitorStateHistory{EventType: "paused", OccurredAt: start.Add(-time.Hour)},
+			wantUptime:   100,
+			wantExcluded: 10,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := computeUptime(tc.prior, tc.transitions, start, end)
+
+			if math.Abs(got.UptimePercent-tc.wantUptime) > 1e-9 {
+				t.Errorf("Expected uptime %.4f%%, got %.4f%%", tc.wantUptime, got.UptimePercent)
+			}
+			if got.DownSeconds != tc.wantDownHours*3600 {
+				t.Errorf("Expected %vh down, got %vs", tc.wantDownHours, got.DownSeconds)
+			}
+			if got.ExcludedSeconds != tc.wantExcluded*3600 {
+				t.Errorf("Expected %vh excluded, got %vs", tc.wantExcluded, got.ExcludedSeconds)
+			}
+			if got.MonitoredSeconds != (10-tc.wantExcluded)*3600 {
+				t.Errorf("Expected %vh monitored, got %vs", 10-tc.wantExcluded, got.MonitoredSeconds)
+			}
+			if got.Outages != tc.wantOutages {
+				t.Errorf("Expected %d outages, got %d", tc.wantOutages, got.Outages)
+			}
+			if got.MTTRSeconds != tc.wantMTTRHours*3600 {
+				t.Errorf("Expected MTTR %vh, got %vs", tc.wantMTTRHours, got.MTTRSeconds)
+			}
+			if got.Ongoing != tc.wantOngoing {
+				t.Errorf("Expected ongoing=%v, got %v", tc.wantOngoing, got.Ongoing)
+			}
+		})
+	}
+}
+
+func TestMonitorHandlerUptime(t *testing.T) {
+	globals.SetGlobalConfigForTests(&globals.Config{})
+
+	created := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	q := newFakeQuerier()
+	q.monitors[1] = dbgen.Monitor{ID: 1, CreatedAt: pgtype.Timestamptz{Time: created, Valid: true}}
+	q.history = []dbgen.MonitorStateHistory{
+		{MonitorID: 1, EventType: "down", OccurredAt: created.Add(22 * time.Hour)},
+		{MonitorID: 1, EventType: "recovered", OccurredAt: created.Add(26 * time.Hour)},
+	}
+	h := NewMonitorHandler(&common.Dependencies{Q: q})
+
+	r := chi.NewRouter()
+	r.Get("/{id}/uptime", h.Uptime)
+
+	get := func(path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec
+	}
+
+	// The window starts before the monitor existed and mid-outage
+	rec := get("/1/uptime?start=2024-12-31T00:00:00Z&end=2025-01-02T04:00:00Z")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d (body: %s)", rec.Code, rec.Body.String())
+	}
+	if window := lastArgs[dbgen.ListMonitorStateChangesParams](q, "ListMonitorStateChanges"); !window.StartTime.Equal(created) {
+		t.Errorf("Expected window clipped to creation %v, got %v", created, window.StartTime)
+	}
+	var report UptimeResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &report); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if report.Outages != 1 || report.DownSeconds != 4*3600 || report.MTTRSeconds != 4*3600 {
+		t.Errorf("Unexpected report: %+v", report)
+	}
+	if math.Abs(report.UptimePercent-100*24.0/28.0) > 1e-9 {
+		t.Errorf("Expected uptime %.4f%%, got %.4f%%", 100*24.0/28.0, report.UptimePercent)
+	}
+
+	// Starting mid-outage picks up the state from the prior transition
+	rec = get("/1/uptime?start=2025-01-02T00:00:00Z&end=2025-01-02T04:00:00Z")
+	report = UptimeResponse{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &report); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if report.UptimePercent != 50 || report.Outages != 1 {
+		t.Errorf("Expected 50%% uptime over 1 outage, got %+v", report)
+	}
+
+	// A deleted monitor reports up to its deletion, which here ends the outage early
+	m := q.monitors[1]
+	m.DeletedAt = pgtype.Timestamptz{Time: created.Add(24 * time.Hour), Valid: true}
+	q.monitors[1] = m
+	rec = get("/1/uptime?start=2025-01-02T00:00:00Z&end=2025-01-02T04:00:00Z")
+	report = UptimeResponse{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &report); err != nil {
+		t.Fatalf("Failed to decode response: %v (status %d)", err, rec.Code)
+	}
+	if report.MonitoredSeconds != 0 {
+		t.Errorf("Expected a window after deletion to be empty, got %+v", report)
+	}
+	rec = get("/1/uptime?start=2025-01-01T00:00:00Z&end=2025-01-03T00:00:00Z")
+	report = UptimeResponse{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &report); err != nil {
+		t.Fatalf("Failed to decode response: %v (status %d)", err, rec.Code)
+	}
+	if rec.Code != http.StatusOK || report.MonitoredSeconds != 24*3600 || report.DownSeconds != 2*3600 {
+		t.Errorf("Expected 24h monitored with 2h down up to deletion, got %d %+v", rec.Code, report)
+	}
+
+	if rec := get("/2/uptime"); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404, got %d", rec.Code)
+	}
+	if rec := get("/1/uptime?start=later"); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400, got %d", rec.Code)
+	}
+}
@@ -2,15 +2,24 @@ package handlers
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"log/slog"
 	"net/http"
+	"net/netip"
+	"slices"
 	"strconv"
+	"strings"
 	"time"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/nmslite/nmslite/internal/api/auth"
 	"github.com/nmslite/nmslite/internal/api/common"
 	"github.com/nmslite/nmslite/internal/database/dbgen"
 	"github.com/nmslite/nmslite/internal/globals"
+	"github.com/nmslite/nmslite/internal/poller"
 )
 
 type MonitorHandler struct {
@@ -21,9 +30,34 @@ func NewMonitorHandler(deps *common.Dependencies) *MonitorHandler {
 	return &MonitorHandler{Deps: deps}
 }
 
-// List handles GET requests
+// List handles GET requests; ?group= limits the list to one monitor group and
+// ?include_deleted=true also returns soft-deleted monitors
 func (h *MonitorHandler) List(w http.ResponseWriter, r *http.Request) {
-	monitors, err := h.Deps.Q.ListMonitors(r.Context())
+	includeDeleted, ok := common.ParseIncludeDeleted(w, r)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := common.QueryContext(r)
+	defer cancel()
+
+	var monitors []dbgen.Monitor
+	var err error
+	if group := strings.TrimSpace(r.URL.Query().Get("group")); group != "" {
+		monitors, err = h.Deps.Q.ListMonitorsByGroup(ctx, group)
+	} else {
+		// The validator is read before the rows, so a concurrent write can only make
+		// the ETag older than the body, never newer
+		var version dbgen.GetMonitorsVersionRow
+		version, err = h.Deps.Q.GetMonitorsVersion(ctx, includeDeleted)
+		if common.HandleDBError(w, r, err, "Monitor") {
+			return
+		}
+		if common.NotModified(w, r, common.ETag("monitors", includeDeleted, version.Total, version.LastModified.UnixNano())) {
+			return
+		}
+		monitors, err = h.Deps.Q.ListMonitors(ctx, includeDeleted)
+	}
 	if common.HandleDBError(w, r, err, "Monitor") {
 		return
 	}
@@ -42,6 +76,28 @@ func (h *MonitorHandler) Create(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if !h.checkPluginExists(w, r, input.PluginID) {
+		return
+	}
+	if !h.checkCredentialProtocol(w, r, input.PluginID, input.CredentialProfileID) {
+		return
+	}
+	collectors, ok := h.checkCollectors(w, r, input.PluginID, input.Collectors)
+	if !ok {
+		return
+	}
+	// Under the reject policy the insert itself checks for a live duplicate, so two
+	// concurrent creates cannot both get past a query before it
+	rejectDuplicate := false
+	switch globals.GetConfig().Scheduler.DuplicateMonitors() {
+	case "reject":
+		rejectDuplicate = true
+	case "warn":
+		if !h.checkDuplicateMonitor(w, r, input.IpAddress, input.PluginID) {
+			return
+		}
+	}
+
 	displayName := input.DisplayName
 	if !displayName.Valid || displayName.String == "" {
 		displayName = pgtype.Text{String: input.IpAddress.String(), Valid: true}
@@ -61,14 +117,30 @@ func (h *MonitorHandler) Create(w http.ResponseWriter, r *http.Request) {
 		Port:                   input.Port,
 		PollingIntervalSeconds: input.PollingIntervalSeconds,
 		Status:                 input.Status,
+		Collectors:             collectors,
+		KeepPollingWhenDown:    input.KeepPollingWhenDown,
+		Tags:                   input.Tags,
+		RejectDuplicate:        rejectDuplicate,
 	}
 
 	monitor, err := h.Deps.Q.CreateMonitor(r.Context(), params)
+	if rejectDuplicate && errors.Is(err, pgx.ErrNoRows) {
+		// The duplicate may be deleted again by now; report it all the same
+		var existingID int64
+		if dup, dupErr := h.Deps.Q.GetMonitorByIPAndPlugin(r.Context(), dbgen.GetMonitorByIPAndPluginParams{
+			IpAddress: params.IpAddress,
+			PluginID:  params.PluginID,
+		}); dupErr == nil {
+			existingID = dup.ID
+		}
+		sendDuplicateMonitor(w, r, existingID, params.IpAddress, params.PluginID)
+		return
+	}
 	if common.HandleDBError(w, r, err, "Monitor") {
 		return
 	}
 
-	h.pushUpdate(r.Context(), monitor.ID)
+	h.pushUpdate(r, monitor.ID)
 
 	common.SendJSON(w, http.StatusCreated, monitor)
 }
@@ -80,11 +152,18 @@ func (h *MonitorHandler) Get(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	monitor, err := h.Deps.Q.GetMonitor(r.Context(), id)
+	ctx, cancel := common.QueryContext(r)
+	defer cancel()
+
+	monitor, err := h.Deps.Q.GetMonitor(ctx, id)
 	if common.HandleDBError(w, r, err, "Monitor") {
 		return
 	}
 
+	common.SetLastModified(w, monitor.UpdatedAt)
+	if common.NotModified(w, r, common.ETag("monitor", monitor.ID, monitor.UpdatedAt.Time.UnixNano())) {
+		return
+	}
 	common.SendJSON(w, http.StatusOK, monitor)
 }
 
@@ -95,16 +174,28 @@ func (h *MonitorHandler) Update(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	input, ok := common.DecodeJSON[dbgen.Monitor](w, r)
+	body, ok := common.DecodeJSON[monitorUpdateRequest](w, r)
 	if !ok {
 		return
 	}
+	input := body.Monitor
+
+	expected, err := common.ExpectedVersion(r, body.Version)
+	if err != nil {
+		common.SendError(w, r, http.StatusBadRequest, "INVALID_PRECONDITION", "Invalid If-Unmodified-Since header", err)
+		return
+	}
 
 	existing, err := h.Deps.Q.GetMonitor(r.Context(), id)
 	if common.HandleDBError(w, r, err, "Monitor") {
 		return
 	}
 
+	if expected.Valid && existing.UpdatedAt.Time.After(expected.Time) {
+		common.SendVersionConflict(w, r, "Monitor", existing.UpdatedAt)
+		return
+	}
+
 	// Merge Logic: if input field is "Valid" (present in JSON), update it.
 	params := dbgen.UpdateMonitorParams{
 		ID:                     id,
@@ -116,6 +207,10 @@ func (h *MonitorHandler) Update(w http.ResponseWriter, r *http.Request) {
 		PollingIntervalSeconds: existing.PollingIntervalSeconds,
 		Port:                   existing.Port,
 		Status:                 existing.Status,
+		Collectors:             existing.Collectors,
+		KeepPollingWhenDown:    existing.KeepPollingWhenDown,
+		Tags:                   existing.Tags,
+		UnmodifiedSince:        expected,
 	}
 
 	if input.DisplayName.Valid {
@@ -136,25 +231,100 @@ func (h *MonitorHandler) Update(w http.ResponseWriter, r *http.Request) {
 		params.CredentialProfileID = input.CredentialProfileID
 	}
 	if input.PollingIntervalSeconds.Valid {
+		if err := validatePollingInterval(input.PollingIntervalSeconds); err != nil {
+			common.SendError(w, r, http.StatusBadRequest, "VALIDATION_ERROR", err.Error(), nil)
+			return
+		}
 		params.PollingIntervalSeconds = input.PollingIntervalSeconds
 	}
 	if input.Port.Valid {
 		params.Port = input.Port
 	}
 	if input.Status.Valid {
+		if err := validateMonitorStatus(input.Status.String); err != nil {
+			common.SendError(w, r, http.StatusBadRequest, "VALIDATION_ERROR", err.Error(), nil)
+			return
+		}
 		params.Status = input.Status
 	}
 
+	// An empty list clears the selection, going back to every collector
+	if input.Collectors != nil {
+		params.Collectors = input.Collectors
+	}
+	if body.KeepPollingWhenDown != nil {
+		params.KeepPollingWhenDown = *body.KeepPollingWhenDown
+	}
+	// Tags are replaced as a whole; {} clears them
+	if input.Tags != nil {
+		if err := validateMonitorTags(input.Tags); err != nil {
+			common.SendError(w, r, http.StatusBadRequest, "VALIDATION_ERROR", err.Error(), nil)
+			return
+		}
+		params.Tags = input.Tags
+	}
+
+	if params.PluginID != existing.PluginID && !h.checkPluginExists(w, r, params.PluginID) {
+		return
+	}
+	if params.PluginID != existing.PluginID || params.CredentialProfileID != existing.CredentialProfileID {
+		if !h.checkCredentialProtocol(w, r, params.PluginID, params.CredentialProfileID) {
+			return
+		}
+	}
+	if params.PluginID != existing.PluginID || input.Collectors != nil {
+		if params.Collectors, ok = h.checkCollectors(w, r, params.PluginID, params.Collectors); !ok {
+			return
+		}
+	}
+
+	// Moving a monitor onto another IP or plugin must not duplicate a live monitor. Under
+	// the reject policy the update statement itself checks, not a query before it.
+	if params.IpAddress != existing.IpAddress || params.PluginID != existing.PluginID {
+		switch globals.GetConfig().Scheduler.DuplicateMonitors() {
+		case "reject":
+			params.RejectDuplicate = true
+		case "warn":
+			if !h.checkDuplicateMonitor(w, r, params.IpAddress, params.PluginID) {
+				return
+			}
+		}
+	}
+
 	monitor, err := h.Deps.Q.UpdateMonitor(r.Context(), params)
+	if params.RejectDuplicate && errors.Is(err, pgx.ErrNoRows) {
+		dup, dupErr := h.Deps.Q.GetMonitorByIPAndPlugin(r.Context(), dbgen.GetMonitorByIPAndPluginParams{
+			IpAddress: params.IpAddress,
+			PluginID:  params.PluginID,
+		})
+		if dupErr == nil && dup.ID != id {
+			sendDuplicateMonitor(w, r, dup.ID, params.IpAddress, params.PluginID)
+			return
+		}
+	}
+	if expected.Valid && errors.Is(err, pgx.ErrNoRows) {
+		// Row existed above, so the version check lost a race with another writer
+		common.SendVersionConflict(w, r, "Monitor", existing.UpdatedAt)
+		return
+	}
 	if common.HandleDBError(w, r, err, "Monitor") {
 		return
 	}
 
-	h.pushUpdate(r.Context(), monitor.ID)
+	h.recordStatusChange(r.Context(), monitor.ID, existing.Status.String, monitor.Status.String)
+	h.pushUpdate(r, monitor.ID)
 
 	common.SendJSON(w, http.StatusOK, monitor)
 }
 
+// monitorUpdateRequest is a monitor patch with an optional optimistic-concurrency version
+type monitorUpdateRequest struct {
+	dbgen.Monitor
+	// KeepPollingWhenDown shadows the monitor's flag so an omitted field can be told from false
+	KeepPollingWhenDown *bool      `json:"keep_polling_when_down"`
+	Version             *time.Time `json:"version,omitempty"`
+}
+
 // Delete handles DELETE /{id} requests
 func (h *MonitorHandler) Delete(w http.ResponseWriter, r *http.Request) {
 	id, ok := common.ParseIDParam(w, r, "id")
@@ -162,21 +332,107 @@ func (h *MonitorHandler) Delete(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err := h.Deps.Q.DeleteMonitor(r.Context(), id)
+	deleted, err := h.Deps.Q.DeleteMonitor(r.Context(), id)
+	if err == nil && deleted == 0 {
+		err = pgx.ErrNoRows
+	}
 	if common.HandleDBError(w, r, err, "Monitor") {
 		return
 	}
 
-	h.pushDelete(r.Context(), id)
+	h.pushDelete(r, id)
 
 	common.SendJSON(w, http.StatusNoContent, nil)
 }
 
-// pushUpdate fetches the joined monitor data and sends it to the scheduler
-func (h *MonitorHandler) pushUpdate(ctx context.Context, id int64) {
+// ListArchived handles GET /api/v1/monitors/archived
+func (h *MonitorHandler) ListArchived(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := common.QueryContext(r)
+	defer cancel()
+
+	monitors, err := h.Deps.Q.ListArchivedMonitors(ctx)
+	if common.HandleDBError(w, r, err, "Monitor") {
+		return
+	}
+	common.SendListResponse(w, monitors, len(monitors))
+}
+
+// Restore handles POST /api/v1/monitors/{id}/restore, undeleting a soft-deleted monitor
+// or reactivating an archived one
+func (h *MonitorHandler) Restore(w http.ResponseWriter, r *http.Request) {
+	id, ok := common.ParseIDParam(w, r, "id")
+	if !ok {
+		return
+	}
+
+	monitor, err := h.Deps.Q.RestoreDeletedMonitor(r.Context(), id)
+	if err == nil {
+		h.pushUpdate(r, monitor.ID)
+		common.SendJSON(w, http.StatusOK, monitor)
+		return
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		common.HandleDBError(w, r, err, "Monitor")
+		return
+	}
+
+	existing, err := h.Deps.Q.GetMonitor(r.Context(), id)
+	if common.HandleDBError(w, r, err, "Monitor") {
+		return
+	}
+	if existing.Status.String != "archived" {
+		common.SendError(w, r, http.StatusConflict, "NOT_ARCHIVED", "Monitor is not archived", map[string]interface{}{
+			"status": existing.Status.String,
+		})
+		return
+	}
+
+	monitor, err = h.Deps.Q.RestoreArchivedMonitor(r.Context(), id)
+	if common.HandleDBError(w, r, err, "Monitor") {
+		return
+	}
+
+	// Re-add to the scheduler with fresh state
+	h.recordStatusChange(r.Context(), monitor.ID, existing.Status.String, monitor.Status.String)
+	h.pushUpdate(r, monitor.ID)
+
+	common.SendJSON(w, http.StatusOK, monitor)
+}
+
+// recordStatusChange adds operator status changes to the state history so uptime
+// reports can exclude paused (maintenance) time. The scheduler records the rest.
+func (h *MonitorHandler) recordStatusChange(ctx context.Context, id int64, from, to string) {
+	var eventType string
+	switch {
+	case from == to:
+		return
+	case to == "paused", to == "archived":
+		eventType = to
+	case to == "active":
+		eventType = "resumed"
+	default:
+		return
+	}
+
+	err := h.Deps.Q.InsertMonitorStateChange(ctx, dbgen.InsertMonitorStateChangeParams{
+		MonitorID:  id,
+		EventType:  eventType,
+		OccurredAt: time.Now().UTC(),
+	})
+	if err != nil && h.Deps.Logger != nil {
+		h.Deps.Logger.Error("failed to record monitor status change", "monitor_id", id, "event_type", eventType, "error", err)
+	}
+}
+
+// pushUpdate fetches the joined data of a changed monitor and sends it to the scheduler
+func (h *MonitorHandler) pushUpdate(r *http.Request, id int64) {
 	if h.Deps.Events == nil {
 		return
 	}
+	ctx, cancel := cachePushContext(r)
+	defer cancel()
+
+	seq := globals.NextCacheInvalidateSeq()
 	row, err := h.Deps.Q.GetMonitorWithCredentials(ctx, id)
 	if err != nil {
 		if h.Deps.Logger != nil {
@@ -184,20 +440,58 @@ func (h *MonitorHandler) pushUpdate(ctx context.Context, id int64) {
 		}
 		return
 	}
-	h.Deps.Events.CacheInvalidate <- globals.CacheInvalidateEvent{
+	pushCacheInvalidate(ctx, h.Deps, globals.CacheInvalidateEvent{
 		UpdateType: "update",
 		Monitors:   []dbgen.GetMonitorWithCredentialsRow{row},
-	}
+		Seq:        seq,
+	})
 }
 
-// pushDelete sends a delete signal to the scheduler
-func (h *MonitorHandler) pushDelete(ctx context.Context, id int64) {
+// pushDelete sends a delete signal for a deleted monitor to the scheduler
+func (h *MonitorHandler) pushDelete(r *http.Request, id int64) {
 	if h.Deps.Events == nil {
 		return
 	}
-	h.Deps.Events.CacheInvalidate <- globals.CacheInvalidateEvent{
+	ctx, cancel := cachePushContext(r)
+	defer cancel()
+
+	pushCacheInvalidate(ctx, h.Deps, globals.CacheInvalidateEvent{
 		UpdateType: "delete",
 		MonitorIDs: []int64{id},
+		Seq:        globals.NextCacheInvalidateSeq(),
+	})
+}
+
+// errCachePushTimeout is why a cache push gave up
+var errCachePushTimeout = errors.New("cache_invalidate channel stayed full")
+
+// cachePushContext returns the context a scheduler cache push runs under. The change is
+// already committed, so the push outlives the request; channel.cache_event_send_timeout_ms
+// bounds it instead.
+func cachePushContext(r *http.Request) (context.Context, context.CancelFunc) {
+	timeout := globals.GetConfig().Channel.CacheEventSendTimeout()
+	return context.WithTimeoutCause(context.WithoutCancel(r.Context()), timeout, errCachePushTimeout)
+}
+
+// pushCacheInvalidate queues a scheduler cache invalidation, giving up when ctx is done so
+// a full channel cannot hang the request. The change is already committed, so a dropped
+// event is only logged; POST /api/v1/admin/scheduler/reload resyncs the scheduler.
+func pushCacheInvalidate(ctx context.Context, deps *common.Dependencies, event globals.CacheInvalidateEvent) {
+	select {
+	case deps.Events.CacheInvalidate <- event:
+	case <-ctx.Done():
+		deps.Events.RecordDropped(globals.ChannelCacheInvalidate, globals.DropTimeout, event)
+		if deps.Logger != nil {
+			ids := event.MonitorIDs
+			for _, row := range event.Monitors {
+				ids = append(ids, row.ID)
+			}
+			deps.Logger.Error("scheduler cache invalidation dropped",
+				"type", event.UpdateType,
+				"monitor_ids", ids,
+				"error", context.Cause(ctx),
+			)
+		}
 	}
 }
 
@@ -214,24 +508,503 @@ func (h *MonitorHandler) validateMonitorInput(input dbgen.Monitor) error {
 	if input.DiscoveryProfileID == 0 {
 		return fmt.Errorf("discovery_profile_id is required")
 	}
+	if input.Status.Valid {
+		if err := validateMonitorStatus(input.Status.String); err != nil {
+			return err
+		}
+	}
+	if input.Tags != nil {
+		if err := validateMonitorTags(input.Tags); err != nil {
+			return err
+		}
+	}
+	return validatePollingInterval(input.PollingIntervalSeconds)
+}
+
+// validateMonitorTags requires tags to be a JSON object of string values
+func validateMonitorTags(raw json.RawMessage) error {
+	var tags map[string]string
+	if err := json.Unmarshal(raw, &tags); err != nil || tags == nil {
+		return fmt.Errorf("tags must be an object of string values")
+	}
+	for key := range tags {
+		if key == "" {
+			return fmt.Errorf("tag keys must not be empty")
+		}
+	}
 	return nil
 }
 
+// validatePollingInterval rejects intervals outside the scheduler's configured bounds.
+// NULL uses the default of 60 seconds.
+func validatePollingInterval(interval pgtype.Int4) error {
+	if !interval.Valid {
+		return nil
+	}
+	lo, hi := globals.GetConfig().Scheduler.PollingIntervalBounds()
+	if seconds := time.Duration(interval.Int32) * time.Second; seconds < lo || seconds > hi {
+		return fmt.Errorf("polling_interval_seconds must be between %d and %d", int(lo.Seconds()), int(hi.Seconds()))
+	}
+	return nil
+}
+
+// checkCredentialProtocol verifies the credential profile exists and its protocol is the one
+// the plugin polls. Writes a 400 (or DB error) response and returns false otherwise.
+func (h *MonitorHandler) checkCredentialProtocol(w http.ResponseWriter, r *http.Request, pluginID string, credentialID int64) bool {
+	protocol, err := h.Deps.Q.GetCredentialProfileProtocol(r.Context(), credentialID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		common.SendError(w, r, http.StatusBadRequest, "VALIDATION_ERROR",
+			fmt.Sprintf("credential_profile_id %d does not exist", credentialID), nil)
+		return false
+	}
+	if common.HandleDBError(w, r, err, "Credential profile") {
+		return false
+	}
+
+	pluginProtocol := h.pluginProtocol(pluginID)
+	if protocol != pluginProtocol {
+		common.SendError(w, r, http.StatusBadRequest, "PROTOCOL_MISMATCH",
+			fmt.Sprintf("credential profile %d is for protocol %q, but plugin %q polls %q", credentialID, protocol, pluginID, pluginProtocol),
+			map[string]interface{}{
+				"plugin_id":           pluginID,
+				"plugin_protocol":     pluginProtocol,
+				"credential_protocol": protocol,
+			})
+		return false
+	}
+	return true
+}
+
+// checkDuplicateMonitor applies scheduler.duplicate_monitor_policy to a monitor created or
+// moved onto ip and pluginID. Under "reject" it writes a 409 naming the existing monitor
+// and returns false; under "warn" it logs the duplicate and lets the write go ahead.
+func (h *MonitorHandler) checkDuplicateMonitor(w http.ResponseWriter, r *http.Request, ip netip.Addr, pluginID string) bool {
+	policy := globals.GetConfig().Scheduler.DuplicateMonitors()
+	if policy == "allow" {
+		return true
+	}
+
+	existing, err := h.Deps.Q.GetMonitorByIPAndPlugin(r.Context(), dbgen.GetMonitorByIPAndPluginParams{
+		IpAddress: ip,
+		PluginID:  pluginID,
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return true
+	}
+	if common.HandleDBError(w, r, err, "Monitor") {
+		return false
+	}
+
+	if policy == "reject" {
+		sendDuplicateMonitor(w, r, existing.ID, ip, pluginID)
+		return false
+	}
+
+	logger := h.Deps.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+	logger.Warn("duplicate monitor",
+		"ip", ip.String(),
+		"plugin_id", pluginID,
+		"existing_monitor_id", existing.ID,
+	)
+	return true
+}
+
+// sendDuplicateMonitor writes the 409 for a monitor that would duplicate existingID
+func sendDuplicateMonitor(w http.ResponseWriter, r *http.Request, existingID int64, ip netip.Addr, pluginID string) {
+	common.SendError(w, r, http.StatusConflict, "DUPLICATE_MONITOR",
+		fmt.Sprintf("monitor %d already polls %s with plugin %q", existingID, ip, pluginID),
+		map[string]interface{}{"existing_monitor_id": existingID})
+}
+
+// checkCollectors verifies every selected collector is one the plugin declares and returns
+// the selection deduplicated, or nil (every collector) when nothing is selected. Writes a
+// 400 and returns false otherwise. Plugins that are not loaded are not checked.
+func (h *MonitorHandler) checkCollectors(w http.ResponseWriter, r *http.Request, pluginID string, collectors []string) ([]string, bool) {
+	if len(collectors) == 0 {
+		return nil, true
+	}
+
+	selected := make([]string, 0, len(collectors))
+	for _, c := range collectors {
+		c = strings.TrimSpace(c)
+		if c == "" {
+			common.SendError(w, r, http.StatusBadRequest, "VALIDATION_ERROR", "collectors must not contain empty names", nil)
+			return nil, false
+		}
+		if !slices.Contains(selected, c) {
+			selected = append(selected, c)
+		}
+	}
+
+	plugin := h.pluginInfo(pluginID)
+	if plugin == nil {
+		return selected, true
+	}
+	if len(plugin.Collectors) == 0 {
+		common.SendError(w, r, http.StatusBadRequest, "VALIDATION_ERROR",
+			fmt.Sprintf("plugin %q does not support collector selection", pluginID), nil)
+		return nil, false
+	}
+	for _, c := range selected {
+		if !slices.Contains(plugin.Collectors, c) {
+			common.SendError(w, r, http.StatusBadRequest, "VALIDATION_ERROR",
+				fmt.Sprintf("plugin %q has no collector %q", pluginID, c),
+				map[string]interface{}{"available_collectors": plugin.Collectors})
+			return nil, false
+		}
+	}
+	return selected, true
+}
+
+// checkPluginExists verifies pluginID names a loaded plugin or a protocol with an
+// in-process collector, so a typo fails here instead of every poll. Otherwise it writes a
+// 400 listing the valid plugin IDs and returns false. Without a plugin manager or
+// scheduler there is nothing to check against and every ID is accepted.
+func (h *MonitorHandler) checkPluginExists(w http.ResponseWriter, r *http.Request, pluginID string) bool {
+	if h.Deps.Plugins == nil && h.Deps.Collectors == nil {
+		return true
+	}
+	if h.pluginInfo(pluginID) != nil {
+		return true
+	}
+
+	var available []string
+	if h.Deps.Collectors != nil {
+		available = h.Deps.Collectors.CollectorProtocols()
+	}
+	if h.Deps.Plugins != nil {
+		for _, p := range h.Deps.Plugins.List() {
+			available = append(available, p.Protocol)
+		}
+	}
+	slices.Sort(available)
+	available = slices.Compact(available)
+
+	if slices.Contains(available, pluginID) {
+		return true
+	}
+	common.SendError(w, r, http.StatusBadRequest, "VALIDATION_ERROR",
+		fmt.Sprintf("plugin_id %q is not a registered plugin", pluginID),
+		map[string]interface{}{"available_plugins": available})
+	return false
+}
+
+// pluginInfo returns the loaded plugin matching pluginID (by ID or protocol), or nil
+func (h *MonitorHandler) pluginInfo(pluginID string) *globals.PluginInfo {
+	if h.Deps.Plugins != nil {
+		for _, p := range h.Deps.Plugins.List() {
+			if p.ID == pluginID || p.Protocol == pluginID {
+				return p
+			}
+		}
+	}
+	return nil
+}
+
+// pluginProtocol resolves a plugin ID to the protocol it polls. Monitors normally store the
+// protocol itself as plugin_id; a loaded plugin's manifest ID is accepted as well.
+func (h *MonitorHandler) pluginProtocol(pluginID string) string {
+	if p := h.pluginInfo(pluginID); p != nil {
+		return p.Protocol
+	}
+	return pluginID
+}
+
+// validateMonitorStatus allows "active", "paused" (polling suspended, e.g. maintenance),
+// "down" and "stale" (reachable but returning no metrics; both normally set by the
+// scheduler) and "archived" (normally set by the archive reaper).
+func validateMonitorStatus(status string) error {
+	switch status {
+	case "active", "paused", "down", "stale", "archived":
+		return nil
+	}
+	return fmt.Errorf("status must be one of: active, paused, down, stale, archived")
+}
+
 // Metrics Query Logic
 
 type MetricsQueryRequest struct {
 	DeviceIDs []int64   `json:"device_ids"`
+	Group     string    `json:"group,omitempty"` // adds the group's non-archived monitors to DeviceIDs
 	Prefix    string    `json:"prefix,omitempty"`
 	Start     time.Time `json:"start"`
 	End       time.Time `json:"end"`
 	Limit     int       `json:"limit,omitempty"`
 	Latest    bool      `json:"latest,omitempty"`
+	// Bucket averages each series into "hour" or "day" buckets aligned in Timezone
+	Bucket string `json:"bucket,omitempty"`
+	// Timezone is the IANA zone buckets are aligned to (default UTC); timestamps stay UTC
+	Timezone string `json:"timezone,omitempty"`
 }
 
 // MetricDataPoint represents a single metric value at a point in time
 type MetricDataPoint struct {
 	Timestamp time.Time `json:"timestamp"`
 	Value     float64   `json:"value"`
+	// Tags are the plugin and monitor tags recorded with the value; hourly rollups and
+	// bucketed series carry none
+	Tags json.RawMessage `json:"tags,omitempty"`
+}
+
+// LatestMetricsResponse holds the most recent value of each metric for one monitor
+type LatestMetricsResponse struct {
+	MonitorID int64                      `json:"monitor_id"`
+	Metrics   map[string]MetricDataPoint `json:"metrics"`
+	Count     int                        `json:"count"`
+}
+
+// defaultLatestWindow bounds how far back the latest-metrics lookup scans
+const defaultLatestWindow = 24 * time.Hour
+
+// latestMetricsMaxAge is how long clients may cache a latest-metrics response
+const latestMetricsMaxAge = 10 * time.Second
+
+// LatestMetrics handles GET /api/v1/monitors/{id}/metrics/latest.
+// Optional ?window=<duration> (default 24h) limits how far back values are looked up; a
+// metric whose raw points in the window were all rolled up reports its newest hourly average.
+func (h *MonitorHandler) LatestMetrics(w http.ResponseWriter, r *http.Request) {
+	id, ok := common.ParseIDParam(w, r, "id")
+	if !ok {
+		return
+	}
+
+	window := defaultLatestWindow
+	if v := r.URL.Query().Get("window"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			common.SendError(w, r, http.StatusBadRequest, "INVALID_REQUEST", "window must be a positive duration (e.g. 1h)", nil)
+			return
+		}
+		window = d
+	}
+
+	ctx, cancel := common.QueryContext(r)
+	defer cancel()
+	q := h.Deps.Reader(common.ReadReplica)
+
+	if _, err := q.GetMonitor(ctx, id); common.HandleDBError(w, r, err, "Monitor") {
+		return
+	}
+
+	now := time.Now()
+	rows, err := q.GetLatestMetricsByDevice(ctx, dbgen.GetLatestMetricsByDeviceParams{
+		DeviceID: id,
+		Since:    now.Add(-window),
+	})
+	if common.HandleDBError(w, r, err, "Metrics") {
+		return
+	}
+	fallback, err := h.latestRollups(ctx, []int64{id}, "%", now.Add(-window), now, rows)
+	if common.HandleDBError(w, r, err, "Metrics") {
+		return
+	}
+	rows = append(rows, fallback...)
+
+	metrics := make(map[string]MetricDataPoint, len(rows))
+	for _, row := range rows {
+		metrics[row.Name] = MetricDataPoint{Timestamp: row.Timestamp, Value: row.Value, Tags: row.Tags}
+	}
+
+	w.Header().Set("Cache-Control", fmt.Sprintf("private, max-age=%d", int(latestMetricsMaxAge.Seconds())))
+	common.SendJSON(w, http.StatusOK, LatestMetricsResponse{
+		MonitorID: id,
+		Metrics:   metrics,
+		Count:     len(metrics),
+	})
+}
+
+// defaultHistoryWindow is the state history range returned when ?start is omitted
+const defaultHistoryWindow = 7 * 24 * time.Hour
+
+// State history row limits
+const (
+	defaultHistoryLimit = 1000
+	maxHistoryLimit     = 10000
+)
+
+// History handles GET /api/v1/monitors/{id}/history.
+// Optional ?start= and ?end= (RFC3339, default the last 7 days) bound the range and
+// ?limit= caps the number of transitions returned, newest first.
+func (h *MonitorHandler) History(w http.ResponseWriter, r *http.Request) {
+	id, ok := common.ParseIDParam(w, r, "id")
+	if !ok {
+		return
+	}
+
+	start, end, ok := parseTimeRange(w, r, defaultHistoryWindow)
+	if !ok {
+		return
+	}
+
+	limit := defaultHistoryLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n > maxHistoryLimit {
+			common.SendError(w, r, http.StatusBadRequest, "INVALID_REQUEST",
+				fmt.Sprintf("limit must be between 1 and %d", maxHistoryLimit), nil)
+			return
+		}
+		limit = n
+	}
+
+	ctx, cancel := common.QueryContext(r)
+	defer cancel()
+	q := h.Deps.Reader(common.ReadReplica)
+
+	if _, err := q.GetMonitor(ctx, id); common.HandleDBError(w, r, err, "Monitor") {
+		return
+	}
+
+	history, err := q.ListMonitorStateHistory(ctx, dbgen.ListMonitorStateHistoryParams{
+		MonitorID: id,
+		StartTime: start,
+		EndTime:   end,
+		RowLimit:  int32(limit),
+	})
+	if common.HandleDBError(w, r, err, "State history") {
+		return
+	}
+	if history == nil {
+		history = []dbgen.MonitorStateHistory{}
+	}
+
+	common.SendListResponse(w, history, len(history))
+}
+
+// parseTimeRange reads ?start= and ?end= (RFC3339, in UTC). end defaults to now and
+// start to window before end. On invalid input it sends a 400 and returns false.
+func parseTimeRange(w http.ResponseWriter, r *http.Request, window time.Duration) (time.Time, time.Time, bool) {
+	query := r.URL.Query()
+	end := time.Now().UTC()
+	if v := query.Get("end"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			common.SendError(w, r, http.StatusBadRequest, "INVALID_REQUEST", "end must be an RFC3339 timestamp", nil)
+			return time.Time{}, time.Time{}, false
+		}
+		end = t.UTC()
+	}
+	start := end.Add(-window)
+	if v := query.Get("start"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			common.SendError(w, r, http.StatusBadRequest, "INVALID_REQUEST", "start must be an RFC3339 timestamp", nil)
+			return time.Time{}, time.Time{}, false
+		}
+		start = t.UTC()
+	}
+	if !start.Before(end) {
+		common.SendError(w, r, http.StatusBadRequest, "INVALID_REQUEST", "start must be before end", nil)
+		return time.Time{}, time.Time{}, false
+	}
+	return start, end, true
+}
+
+// maxIngestRecords caps a single push so one request cannot monopolize the BatchWriter queue
+const maxIngestRecords = 10000
+
+// metricSubmitTimeout bounds how long a push waits on a full BatchWriter queue
+const metricSubmitTimeout = 5 * time.Second
+
+// Per-record outcomes of a push that hit backpressure, in request order
+const (
+	ingestAccepted = "accepted" // queued for storage
+	ingestRejected = "rejected" // dropped by metrics.timestamp_policy, do not resend
+	ingestRetry    = "retry"    // not queued, resend it
+)
+
+// IngestMetrics handles POST /api/v1/monitors/{id}/metrics for agent-pushed metrics.
+// The body is a JSON array of {"name", "value", "type"?, "unit"?, "timestamp"?} records, the
+// same shape plugins emit. metrics.timestamp_policy applies as for polled metrics; records it
+// drops are counted as rejected. Records go through the BatchWriter like polled metrics; if its
+// queue stays full past metricSubmitTimeout the remainder is refused with 503, whose details
+// give each record's outcome in request order so the client resends only the "retry" ones.
+func (h *MonitorHandler) IngestMetrics(w http.ResponseWriter, r *http.Request) {
+	id, ok := common.ParseIDParam(w, r, "id")
+	if !ok {
+		return
+	}
+
+	if h.Deps.Metrics == nil {
+		common.SendError(w, r, http.StatusServiceUnavailable, "METRICS_UNAVAILABLE", "Metric ingestion is not available", nil)
+		return
+	}
+
+	raw, ok := common.DecodeJSON[[]interface{}](w, r)
+	if !ok {
+		return
+	}
+	if len(raw) == 0 {
+		common.SendError(w, r, http.StatusBadRequest, "VALIDATION_ERROR", "At least one metric record is required", nil)
+		return
+	}
+	if len(raw) > maxIngestRecords {
+		common.SendError(w, r, http.StatusRequestEntityTooLarge, "TOO_MANY_RECORDS",
+			fmt.Sprintf("At most %d metric records per request", maxIngestRecords), nil)
+		return
+	}
+
+	ctx, cancel := common.QueryContext(r)
+	defer cancel()
+
+	monitor, err := h.Deps.Q.GetMonitor(ctx, id)
+	if common.HandleDBError(w, r, err, "Monitor") {
+		return
+	}
+
+	now := time.Now()
+	records, err := poller.ParseMetricRecords(id, now, raw)
+	if err != nil {
+		common.SendError(w, r, http.StatusBadRequest, "VALIDATION_ERROR", err.Error(), nil)
+		return
+	}
+	cfg := globals.GetConfig().Metrics
+	items := make([]string, len(records))
+	kept := make([]int, 0, len(records)) // request index of each record the policy keeps
+	for i, record := range records {
+		if poller.TimestampRejected(record.Timestamp, cfg.TimestampPolicy, cfg.MaxMetricAge(), now) {
+			items[i] = ingestRejected
+		} else {
+			items[i] = ingestRetry
+			kept = append(kept, i)
+		}
+	}
+	records, rejected := poller.ApplyTimestampPolicy(records, cfg.TimestampPolicy, cfg.MaxMetricAge(), now)
+
+	// Pushed metrics get the monitor's tags like polled ones; tags are validated on write
+	var monitorTags map[string]string
+	if len(monitor.Tags) > 0 {
+		_ = json.Unmarshal(monitor.Tags, &monitorTags)
+	}
+	for i := range records {
+		records[i].Tags = poller.MergeTags(monitorTags, records[i].Tags)
+	}
+
+	submitCtx, submitCancel := context.WithTimeout(r.Context(), metricSubmitTimeout)
+	defer submitCancel()
+
+	for i, record := range records {
+		if err := h.Deps.Metrics.Submit(submitCtx, record); err != nil {
+			w.Header().Set("Retry-After", "1")
+			common.SendError(w, r, http.StatusServiceUnavailable, "METRICS_BACKPRESSURE",
+				"Metric queue is full, retry the remaining records later", map[string]interface{}{
+					"accepted": i,
+					"rejected": rejected,
+					"total":    len(items),
+					"items":    items,
+				})
+			return
+		}
+		items[kept[i]] = ingestAccepted
+	}
+
+	common.SendJSON(w, http.StatusAccepted, map[string]interface{}{
+		"accepted": len(records),
+		"rejected": rejected,
+	})
 }
 
 type MetricsQueryResponse struct {
@@ -246,16 +1019,57 @@ func (h *MonitorHandler) QueryMetrics(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if len(req.DeviceIDs) == 0 || req.Start.IsZero() || req.End.IsZero() {
-		common.SendError(w, r, http.StatusBadRequest, "INVALID_REQUEST", "device_ids, start, and end are required", nil)
+	req.Group = strings.TrimSpace(req.Group)
+	if (len(req.DeviceIDs) == 0 && req.Group == "") || req.Start.IsZero() || req.End.IsZero() {
+		common.SendError(w, r, http.StatusBadRequest, "INVALID_REQUEST", "device_ids or group, start, and end are required", nil)
 		return
 	}
 	if req.Limit == 0 {
 		req.Limit = 100
 	}
+	if req.Latest && req.Bucket != "" {
+		common.SendError(w, r, http.StatusBadRequest, "INVALID_REQUEST", "bucket cannot be combined with latest", nil)
+		return
+	}
+	if req.Bucket != "" && !slices.Contains(metricBuckets, req.Bucket) {
+		common.SendError(w, r, http.StatusBadRequest, "INVALID_REQUEST", "bucket must be hour or day", nil)
+		return
+	}
+	if !validQueryTimezone(req.Timezone) {
+		common.SendError(w, r, http.StatusBadRequest, "INVALID_REQUEST", "timezone must be an IANA zone such as Europe/Berlin", nil)
+		return
+	}
+
+	ctx, cancel := common.QueryContext(r)
+	defer cancel()
+	q := h.Deps.Reader(common.ReadReplica)
+
+	started := time.Now()
+	rowCount := 0
+	defer func() { h.logSlowQuery(r, req, rowCount, time.Since(started)) }()
+
+	// Resolve the group server-side so clients need not track membership
+	if req.Group != "" {
+		groupIDs, err := q.ListMonitorIDsByGroup(ctx, req.Group)
+		if common.HandleDBError(w, r, err, "Monitor group") {
+			return
+		}
+		for _, id := range groupIDs {
+			if !slices.Contains(req.DeviceIDs, id) {
+				req.DeviceIDs = append(req.DeviceIDs, id)
+			}
+		}
+		if len(req.DeviceIDs) == 0 {
+			common.SendJSON(w, http.StatusOK, MetricsQueryResponse{
+				Data:  make(map[string]map[string][]MetricDataPoint),
+				Query: req,
+			})
+			return
+		}
+	}
 
 	// Validate Device IDs
-	validIDs, err := h.Deps.Q.GetExistingMonitorIDs(r.Context(), req.DeviceIDs)
+	validIDs, err := q.GetExistingMonitorIDs(ctx, req.DeviceIDs)
 	if err != nil {
 		common.HandleDBError(w, r, err, "Device IDs")
 		return
@@ -277,15 +1091,18 @@ func (h *MonitorHandler) QueryMetrics(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var dbRows []dbgen.Metric
-	if req.Latest {
-		dbRows, err = h.Deps.Q.GetLatestMetricsByDeviceAndPrefix(r.Context(), dbgen.GetLatestMetricsByDeviceAndPrefixParams{
+	switch {
+	case req.Bucket != "":
+		dbRows, err = h.queryBuckets(ctx, req, validIDs, prefix)
+	case req.Latest:
+		dbRows, err = q.GetLatestMetricsByDeviceAndPrefix(ctx, dbgen.GetLatestMetricsByDeviceAndPrefixParams{
 			DeviceIds:         validIDs,
 			MetricNamePattern: prefix,
 			StartTime:         req.Start,
 			EndTime:           req.End,
 		})
-	} else {
-		dbRows, err = h.Deps.Q.GetMetricsByDeviceAndPrefix(r.Context(), dbgen.GetMetricsByDeviceAndPrefixParams{
+	default:
+		dbRows, err = q.GetMetricsByDeviceAndPrefix(ctx, dbgen.GetMetricsByDeviceAndPrefixParams{
 			DeviceIds:         validIDs,
 			MetricNamePattern: prefix,
 			StartTime:         req.Start,
@@ -298,6 +1115,21 @@ func (h *MonitorHandler) QueryMetrics(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Raw points older than the rollup threshold only exist as hourly aggregates
+	if req.Bucket == "" {
+		var rollupRows []dbgen.Metric
+		if req.Latest {
+			rollupRows, err = h.latestRollups(ctx, validIDs, prefix, req.Start, req.End, dbRows)
+		} else {
+			rollupRows, err = h.queryRollups(ctx, req, validIDs, prefix, dbRows)
+		}
+		if common.HandleDBError(w, r, err, "Metrics") {
+			return
+		}
+		dbRows = append(dbRows, rollupRows...)
+	}
+	rowCount = len(dbRows)
+
 	// Group Data - now stores time-series arrays
 	groupedData := make(map[string]map[string][]MetricDataPoint)
 	for _, id := range req.DeviceIDs {
@@ -312,6 +1144,8 @@ func (h *MonitorHandler) QueryMetrics(w http.ResponseWriter, r *http.Request) {
 		}
 		groupedData[did][row.Name] = append(groupedData[did][row.Name], MetricDataPoint{
 			Timestamp: row.Timestamp,
+			Value:     row.Value,
+			Tags:      row.Tags,
 		})
 		count++
 	}
@@ -322,3 +1156,167 @@ func (h *MonitorHandler) QueryMetrics(w http.ResponseWriter, r *http.Request) {
 		Query: req,
 	})
 }
+
+// logSlowQuery warns about a metrics query that took longer than the configured threshold.
+// Only the query's shape is logged; the prefix and group name are left out because they
+// can carry tenant or tag data.
+func (h *MonitorHandler) logSlowQuery(r *http.Request, req MetricsQueryRequest, rows int, elapsed time.Duration) {
+	threshold := globals.GetConfig().Metrics.SlowQueryThreshold()
+	if threshold <= 0 || elapsed < threshold {
+		return
+	}
+
+	logger := h.Deps.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+	requestID, _ := r.Context().Value(auth.RequestIDKey).(string)
+	logger.Warn("slow metrics query",
+		"request_id", requestID,
+		"duration_ms", elapsed.Milliseconds(),
+		"threshold_ms", threshold.Milliseconds(),
+		"device_count", len(req.DeviceIDs),
+		"range_seconds", int64(req.End.Sub(req.Start).Seconds()),
+		"latest", req.Latest,
+		"limit", req.Limit,
+		"has_prefix", req.Prefix != "",
+		"has_group", req.Group != "",
+		"rows", rows,
+	)
+}
+
+// rollupBoundary returns the start of the newest hour still kept as raw points: earlier
+// points only exist as hourly rollups. Without rollups it is the zero time.
+func rollupBoundary() time.Time {
+	cfg := &globals.GetConfig().Metrics
+	if cfg.RollupAfter() <= 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(-cfg.RollupAfter()).Truncate(time.Hour)
+}
+
+// queryBuckets averages the whole requested range into req.Bucket buckets in the
+// database, combining raw points with the rollups older than rollupBoundary
+func (h *MonitorHandler) queryBuckets(ctx context.Context, req MetricsQueryRequest, deviceIDs []int64, prefix string) ([]dbgen.Metric, error) {
+	timezone := req.Timezone
+	if timezone == "" {
+		timezone = "UTC"
+	}
+	buckets, err := h.Deps.Reader(common.ReadReplica).GetBucketedMetricsByDeviceAndPrefix(ctx, dbgen.GetBucketedMetricsByDeviceAndPrefixParams{
+		Bucket:            req.Bucket,
+		Timezone:          timezone,
+		DeviceIds:         deviceIDs,
+		MetricNamePattern: prefix,
+		StartTime:         req.Start,
+		RollupBefore:      rollupBoundary(),
+		EndTime:           req.End,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	rows := make([]dbgen.Metric, 0, len(buckets))
+	for _, b := range buckets {
+		rows = append(rows, dbgen.Metric{
+			Timestamp: b.Bucket,
+			DeviceID:  b.DeviceID,
+			Name:      b.Name,
+			Value:     b.AvgValue,
+			Type:      b.Type,
+			Unit:      b.Unit,
+		})
+	}
+	return rows, nil
+}
+
+// metricSeries identifies one metric of one device
+type metricSeries struct {
+	deviceID int64
+	name     string
+}
+
+// rollupMetric shapes an hourly rollup like a raw metric, valued at its average
+func rollupMetric(r dbgen.MetricsRollup) dbgen.Metric {
+	return dbgen.Metric{
+		Timestamp: r.Bucket,
+		DeviceID:  r.DeviceID,
+		Name:      r.Name,
+		Value:     r.AvgValue,
+		Type:      r.Type,
+		Unit:      r.Unit,
+	}
+}
+
+// queryRollups returns hourly averages for the part of the requested range that is older
+// than the rollup threshold, shaped like raw metrics. Rows are ordered per series by
+// timestamp DESC, so appending them after the raw rows keeps each series in order. A
+// series only gets the rollups that fit in req.Limit after its raw rows, so the limit
+// holds per series across the boundary.
+func (h *MonitorHandler) queryRollups(ctx context.Context, req MetricsQueryRequest, deviceIDs []int64, prefix string, raw []dbgen.Metric) ([]dbgen.Metric, error) {
+	boundary := rollupBoundary()
+	if !req.Start.Before(boundary) {
+		return nil, nil
+	}
+
+	end := req.End
+	if end.After(boundary) {
+		end = boundary
+	}
+
+	rollups, err := h.Deps.Reader(common.ReadReplica).GetRollupMetricsByDeviceAndPrefix(ctx, dbgen.GetRollupMetricsByDeviceAndPrefixParams{
+		DeviceIds:         deviceIDs,
+		MetricNamePattern: prefix,
+		StartTime:         req.Start,
+		EndTime:           end,
+		LimitCount:        int32(req.Limit),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	counts := make(map[metricSeries]int)
+	for _, m := range raw {
+		counts[metricSeries{m.DeviceID, m.Name}]++
+	}
+	rows := make([]dbgen.Metric, 0, len(rollups))
+	for _, r := range rollups {
+		series := metricSeries{r.DeviceID, r.Name}
+		if counts[series] >= req.Limit {
+			continue
+		}
+		counts[series]++
+		rows = append(rows, rollupMetric(r))
+	}
+	return rows, nil
+}
+
+// latestRollups returns the newest rollup of every series that has no raw point in
+// latest, so a device silent for longer than the rollup threshold still reports its last
+// values. Nothing is read when [start, end] lies entirely after the rollup boundary.
+func (h *MonitorHandler) latestRollups(ctx context.Context, deviceIDs []int64, prefix string, start, end time.Time, latest []dbgen.Metric) ([]dbgen.Metric, error) {
+	if !start.Before(rollupBoundary()) {
+		return nil, nil
+	}
+
+	rollups, err := h.Deps.Reader(common.ReadReplica).GetLatestRollupMetricsByDeviceAndPrefix(ctx, dbgen.GetLatestRollupMetricsByDeviceAndPrefixParams{
+		DeviceIds:         deviceIDs,
+		MetricNamePattern: prefix,
+		StartTime:         start,
+		EndTime:           end,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[metricSeries]bool, len(latest))
+	for _, m := range latest {
+		seen[metricSeries{m.DeviceID, m.Name}] = true
+	}
+	var rows []dbgen.Metric
+	for _, r := range rollups {
+		if !seen[metricSeries{r.DeviceID, r.Name}] {
+			rows = append(rows, rollupMetric(r))
+		}
+	}
+	return rows, nil
+}
@@ -0,0 +1,1142 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/nmslite/nmslite/internal/api/common"
+	"github.com/nmslite/nmslite/internal/database/dbgen"
+	"github.com/nmslite/nmslite/internal/globals"
+)
+
+func TestMonitorHandlerQueryTimeout(t *testing.T) {
+	globals.SetGlobalConfigForTests(&globals.Config{
+		Database: globals.DatabaseConfig{QueryTimeoutMS: 20},
+	})
+
+	testCases := []struct {
+		name       string
+		delay      time.Duration
+		path       string
+		wantStatus int
+	}{
+		{"List within timeout", 0, "/", http.StatusOK},
+		{"List exceeds timeout", 200 * time.Millisecond, "/", http.StatusGatewayTimeout},
+		{"Get within timeout", 0, "/7", http.StatusOK},
+		{"Get exceeds timeout", 200 * time.Millisecond, "/7", http.StatusGatewayTimeout},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			q := newFakeQuerier().addMonitors(map[int64]string{7: "active"})
+			q.delay = tc.delay
+			h := NewMonitorHandler(&common.Dependencies{Q: q})
+
+			r := chi.NewRouter()
+			r.Get("/", h.List)
+			r.Get("/{id}", h.Get)
+
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tc.path, nil))
+
+			if rec.Code != tc.wantStatus {
+				t.Errorf("Expected status %d, got %d (body: %s)", tc.wantStatus, rec.Code, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestMonitorHandlerConditionalGet(t *testing.T) {
+	globals.SetGlobalConfigForTests(&globals.Config{})
+
+	for _, path := range []string{"/", "/7"} {
+		t.Run(path, func(t *testing.T) {
+			q := newFakeQuerier()
+			q.monitors[7] = dbgen.Monitor{ID: 7, UpdatedAt: pgtype.Timestamptz{Time: time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC), Valid: true}}
+			h := NewMonitorHandler(&common.Dependencies{Q: q})
+
+			r := chi.NewRouter()
+			r.Get("/", h.List)
+			r.Get("/{id}", h.Get)
+
+			get := func(ifNoneMatch string) *httptest.ResponseRecorder {
+				req := httptest.NewRequest(http.MethodGet, path, nil)
+				if ifNoneMatch != "" {
+					req.Header.Set("If-None-Match", ifNoneMatch)
+				}
+				rec := httptest.NewRecorder()
+				r.ServeHTTP(rec, req)
+				return rec
+			}
+
+			first := get("")
+			etag := first.Header().Get("ETag")
+			if first.Code != http.StatusOK || etag == "" {
+				t.Fatalf("Expected 200 with an ETag, got %d %q", first.Code, etag)
+			}
+
+			unchanged := get(`"other", ` + etag)
+			if unchanged.Code != http.StatusNotModified {
+				t.Errorf("Expected status 304, got %d", unchanged.Code)
+			}
+			if unchanged.Body.Len() != 0 {
+				t.Errorf("Expected empty 304 body, got %s", unchanged.Body.String())
+			}
+			if path == "/" && q.calls["ListMonitors"] != 1 {
+				t.Errorf("Expected the list to be fetched once, got %d", q.calls["ListMonitors"])
+			}
+
+			m := q.monitors[7]
+			m.UpdatedAt.Time = m.UpdatedAt.Time.Add(time.Millisecond)
+			q.monitors[7] = m
+			changed := get(etag)
+			if changed.Code != http.StatusOK {
+				t.Errorf("Expected status 200 after a change, got %d", changed.Code)
+			}
+			if changed.Header().Get("ETag") == etag {
+				t.Error("Expected a new ETag after a change")
+			}
+		})
+	}
+}
+
+func TestMonitorHandlerUpdateVersionConflict(t *testing.T) {
+	updatedAt := time.Date(2025, 12, 17, 10, 30, 15, 250000000, time.UTC)
+
+	testCases := []struct {
+		name       string
+		body       string
+		header     string
+		lostRace   bool
+		wantStatus int
+	}{
+		{"No precondition", `{"port": 22}`, "", false, http.StatusOK},
+		{"Matching body version", `{"port": 22, "version": "2025-12-17T10:30:15.25Z"}`, "", false, http.StatusOK},
+		{"Stale body version", `{"port": 22, "version": "2025-12-17T10:30:15Z"}`, "", false, http.StatusConflict},
+		{"Matching If-Unmodified-Since", `{"port": 22}`, "Wed, 17 Dec 2025 10:30:15 GMT", false, http.StatusOK},
+		{"Stale If-Unmodified-Since", `{"port": 22}`, "Wed, 17 Dec 2025 10:30:14 GMT", false, http.StatusConflict},
+		{"Concurrent writer wins", `{"port": 22, "version": "2025-12-17T10:30:15.25Z"}`, "", true, http.StatusConflict},
+		{"Malformed If-Unmodified-Since", `{"port": 22}`, "yesterday", false, http.StatusBadRequest},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			q := newFakeQuerier()
+			q.monitors[7] = dbgen.Monitor{ID: 7, UpdatedAt: pgtype.Timestamptz{Time: updatedAt, Valid: true}}
+			if tc.lostRace {
+				q.racer = func(q *fakeQuerier) {
+					m := q.monitors[7]
+					m.UpdatedAt.Time = updatedAt.Add(time.Second)
+					q.monitors[7] = m
+				}
+			}
+			h := NewMonitorHandler(&common.Dependencies{Q: q})
+
+			r := chi.NewRouter()
+			r.Patch("/{id}", h.Update)
+
+			req := httptest.NewRequest(http.MethodPatch, "/7", strings.NewReader(tc.body))
+			if tc.header != "" {
+				req.Header.Set("If-Unmodified-Since", tc.header)
+			}
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, req)
+
+			if rec.Code != tc.wantStatus {
+				t.Errorf("Expected status %d, got %d (body: %s)", tc.wantStatus, rec.Code, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestMonitorHandlerListArchivedOrdersByArchiveTime(t *testing.T) {
+	globals.SetGlobalConfigForTests(&globals.Config{})
+	q := newFakeQuerier().addMonitors(map[int64]string{1: "archived", 2: "archived", 3: "archived", 4: "down"})
+	for id, age := range map[int64]time.Duration{1: time.Hour, 2: 3 * time.Hour, 3: 2 * time.Hour} {
+		m := q.monitors[id]
+		m.ArchivedAt = pgtype.Timestamptz{Time: time.Now().Add(-age), Valid: true}
+		q.monitors[id] = m
+	}
+	// Editing the oldest archive must not move it to the top
+	m := q.monitors[2]
+	m.UpdatedAt = now()
+	q.monitors[2] = m
+	h := NewMonitorHandler(&common.Dependencies{Q: q})
+
+	rec := httptest.NewRecorder()
+	h.ListArchived(rec, httptest.NewRequest(http.MethodGet, "/archived", nil))
+
+	var body struct {
+		Data []struct {
+			ID int64 `json:"id"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("Expected a list, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var ids []int64
+	for _, m := range body.Data {
+		ids = append(ids, m.ID)
+	}
+	if !slices.Equal(ids, []int64{1, 3, 2}) {
+		t.Errorf("Expected most recently archived first, got %v", ids)
+	}
+}
+
+func TestMonitorHandlerRestore(t *testing.T) {
+	testCases := []struct {
+		name        string
+		path        string
+		wantStatus  int
+		wantRestore bool
+		wantEvents  string
+	}{
+		{"Archived monitor restored", "/1/restore", http.StatusOK, true, "resumed"},
+		{"Down monitor is not archived", "/2/restore", http.StatusConflict, false, ""},
+		{"Unknown monitor", "/3/restore", http.StatusNotFound, false, ""},
+		{"Deleted monitor undeleted", "/4/restore", http.StatusOK, true, ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			q := newFakeQuerier().addMonitors(map[int64]string{1: "archived", 2: "down", 4: "active"}).softDeleteMonitors(4)
+			before := maps.Clone(q.monitors)
+			h := NewMonitorHandler(&common.Dependencies{Q: q})
+
+			r := chi.NewRouter()
+			r.Post("/{id}/restore", h.Restore)
+
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, tc.path, nil))
+
+			if rec.Code != tc.wantStatus {
+				t.Errorf("Expected status %d, got %d (body: %s)", tc.wantStatus, rec.Code, rec.Body.String())
+			}
+			if restored := !reflect.DeepEqual(before, q.monitors); restored != tc.wantRestore {
+				t.Errorf("Expected restore called=%v, got %v", tc.wantRestore, restored)
+			}
+			var transitions []string
+			for _, h := range q.history {
+				transitions = append(transitions, h.EventType)
+			}
+			if events := strings.Join(transitions, ","); events != tc.wantEvents {
+				t.Errorf("Expected state history %q, got %q", tc.wantEvents, events)
+			}
+		})
+	}
+}
+
+func TestMonitorHandlerDelete(t *testing.T) {
+	testCases := []struct {
+		name       string
+		path       string
+		wantStatus int
+	}{
+		{"Live monitor soft-deleted", "/1", http.StatusNoContent},
+		{"Already deleted monitor", "/2", http.StatusNotFound},
+		{"Unknown monitor", "/3", http.StatusNotFound},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			q := newFakeQuerier().addMonitors(map[int64]string{1: "active", 2: "active"}).softDeleteMonitors(2)
+			h := NewMonitorHandler(&common.Dependencies{Q: q})
+
+			r := chi.NewRouter()
+			r.Delete("/{id}", h.Delete)
+
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, tc.path, nil))
+
+			if rec.Code != tc.wantStatus {
+				t.Errorf("Expected status %d, got %d (body: %s)", tc.wantStatus, rec.Code, rec.Body.String())
+			}
+		})
+	}
+
+	q := newFakeQuerier().addMonitors(map[int64]string{1: "active"})
+	h := NewMonitorHandler(&common.Dependencies{Q: q})
+	r := chi.NewRouter()
+	r.Delete("/{id}", h.Delete)
+	r.Post("/{id}/restore", h.Restore)
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodDelete, "/1", nil))
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/1/restore", nil))
+	if rec.Code != http.StatusOK || q.monitors[1].DeletedAt.Valid {
+		t.Errorf("Expected deleted monitor to be restorable, got %d (body: %s)", rec.Code, rec.Body.String())
+	}
+}
+
+func TestMonitorHandlerCacheInvalidate(t *testing.T) {
+	globals.SetGlobalConfigForTests(&globals.Config{Channel: globals.EventBusConfig{CacheEventSendTimeoutMS: 50}})
+
+	// A full channel: the handler must give up on the send instead of hanging
+	events := &globals.EventChannels{CacheInvalidate: make(chan globals.CacheInvalidateEvent, 1)}
+	events.CacheInvalidate <- globals.CacheInvalidateEvent{}
+	q := newFakeQuerier().addMonitors(map[int64]string{1: "active", 2: "active", 3: "active"})
+	q.credentials[1] = dbgen.CredentialProfile{ID: 1, Protocol: "ssh"}
+	h := NewMonitorHandler(&common.Dependencies{Q: q, Events: events})
+	r := chi.NewRouter()
+	r.Delete("/{id}", h.Delete)
+
+	done := make(chan int)
+	go func() {
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/1", nil))
+		done <- rec.Code
+	}()
+	select {
+	case code := <-done:
+		if code != http.StatusNoContent {
+			t.Errorf("Expected status %d, got %d", http.StatusNoContent, code)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Handler blocked on a full cache invalidation channel")
+	}
+
+	// A cancelled request still delivers its committed change; a vanished row is skipped
+	<-events.CacheInvalidate
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	h.pushUpdate(httptest.NewRequest(http.MethodPost, "/", nil).WithContext(ctx), 2)
+	h.pushUpdate(httptest.NewRequest(http.MethodPost, "/", nil), 4)
+	if len(events.CacheInvalidate) != 1 {
+		t.Fatalf("Expected one update event, got %d", len(events.CacheInvalidate))
+	}
+	event := <-events.CacheInvalidate
+	if event.UpdateType != "update" || len(event.Monitors) != 1 || event.Monitors[0].ID != 2 || event.Seq == 0 {
+		t.Errorf("Expected one sequenced update for monitor 2, got %+v", event)
+	}
+
+	h.pushDelete(httptest.NewRequest(http.MethodDelete, "/", nil), 3)
+	if event := <-events.CacheInvalidate; event.UpdateType != "delete" || !slices.Equal(event.MonitorIDs, []int64{3}) {
+		t.Errorf("Expected one delete for monitor 3, got %+v", event)
+	}
+}
+
+func TestMonitorHandlerLatestMetrics(t *testing.T) {
+	testCases := []struct {
+		name       string
+		path       string
+		wantStatus int
+		wantWindow time.Duration
+	}{
+		{"Default window", "/1/metrics/latest", http.StatusOK, defaultLatestWindow},
+		{"Custom window", "/1/metrics/latest?window=1h", http.StatusOK, time.Hour},
+		{"Invalid window", "/1/metrics/latest?window=soon", http.StatusBadRequest, 0},
+		{"Unknown monitor", "/3/metrics/latest", http.StatusNotFound, 0},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			q := newFakeQuerier().addMonitors(map[int64]string{1: "active"})
+			ts := time.Now().Add(-time.Minute)
+			q.metrics = []dbgen.Metric{
+				{Timestamp: ts.Add(-time.Minute), DeviceID: 1, Name: "cpu.usage", Value: 40},
+				{Timestamp: ts, DeviceID: 1, Name: "cpu.usage", Value: 42},
+				{Timestamp: ts, DeviceID: 1, Name: "memory.used", Value: 1024},
+				{Timestamp: ts, DeviceID: 2, Name: "cpu.usage", Value: 7},
+			}
+			h := NewMonitorHandler(&common.Dependencies{Q: q})
+
+			r := chi.NewRouter()
+			r.Get("/{id}/metrics/latest", h.LatestMetrics)
+
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tc.path, nil))
+
+			if rec.Code != tc.wantStatus {
+				t.Fatalf("Expected status %d, got %d (body: %s)", tc.wantStatus, rec.Code, rec.Body.String())
+			}
+			if tc.wantStatus != http.StatusOK {
+				return
+			}
+
+			since := lastArgs[dbgen.GetLatestMetricsByDeviceParams](q, "GetLatestMetricsByDevice").Since
+			if got := time.Since(since); got < tc.wantWindow || got > tc.wantWindow+time.Minute {
+				t.Errorf("Expected lookup window ~%v, got %v", tc.wantWindow, got)
+			}
+			if cc := rec.Header().Get("Cache-Control"); !strings.Contains(cc, "max-age=") {
+				t.Errorf("Expected Cache-Control max-age, got %q", cc)
+			}
+			body := rec.Body.String()
+			if !strings.Contains(body, `"cpu.usage"`) || !strings.Contains(body, `"count":2`) {
+				t.Errorf("Unexpected body: %s", body)
+			}
+		})
+	}
+}
+
+func TestMonitorHandlerHistory(t *testing.T) {
+	globals.SetGlobalConfigForTests(&globals.Config{})
+
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	end := time.Date(2025, 1, 2, 0, 0, 0, 0, time.UTC)
+
+	testCases := []struct {
+		name       string
+		path       string
+		wantStatus int
+		wantStart  time.Time
+		wantEnd    time.Time
+		wantLimit  int32
+	}{
+		{"Explicit range", "/1/history?start=2025-01-01T00:00:00Z&end=2025-01-02T00:00:00Z&limit=10", http.StatusOK, start, end, 10},
+		{"Offset range", "/1/history?start=2025-01-01T05:00:00%2B05:00&end=2025-01-02T00:00:00Z", http.StatusOK, start, end, defaultHistoryLimit},
+		{"Default start", "/1/history?end=2025-01-02T00:00:00Z", http.StatusOK, end.Add(-defaultHistoryWindow), end, defaultHistoryLimit},
+		{"Invalid start", "/1/history?start=yesterday", http.StatusBadRequest, time.Time{}, time.Time{}, 0},
+		{"Start after end", "/1/history?start=2025-01-02T00:00:00Z&end=2025-01-01T00:00:00Z", http.StatusBadRequest, time.Time{}, time.Time{}, 0},
+		{"Limit too large", "/1/history?limit=100000", http.StatusBadRequest, time.Time{}, time.Time{}, 0},
+		{"Unknown monitor", "/3/history", http.StatusNotFound, time.Time{}, time.Time{}, 0},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			q := newFakeQuerier().addMonitors(map[int64]string{1: "down"})
+			q.history = []dbgen.MonitorStateHistory{
+				{ID: 1, MonitorID: 1, EventType: "down", Failures: 3, OccurredAt: end.Add(-time.Hour)},
+				{ID: 2, MonitorID: 1, EventType: "recovered", OccurredAt: end.Add(-time.Minute)},
+				{ID: 3, MonitorID: 2, EventType: "down", Failures: 3, OccurredAt: end.Add(-time.Hour)},
+			}
+			h := NewMonitorHandler(&common.Dependencies{Q: q})
+
+			r := chi.NewRouter()
+			r.Get("/{id}/history", h.History)
+
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tc.path, nil))
+
+			if rec.Code != tc.wantStatus {
+				t.Fatalf("Expected status %d, got %d (body: %s)", tc.wantStatus, rec.Code, rec.Body.String())
+			}
+			if tc.wantStatus != http.StatusOK {
+				return
+			}
+
+			params := lastArgs[dbgen.ListMonitorStateHistoryParams](q, "ListMonitorStateHistory")
+			if !params.StartTime.Equal(tc.wantStart) || !params.EndTime.Equal(tc.wantEnd) {
+				t.Errorf("Expected range %v..%v, got %v..%v", tc.wantStart, tc.wantEnd, params.StartTime, params.EndTime)
+			}
+			if params.RowLimit != tc.wantLimit {
+				t.Errorf("Expected limit %d, got %d", tc.wantLimit, params.RowLimit)
+			}
+			body := rec.Body.String()
+			if !strings.Contains(body, `"event_type":"down"`) || !strings.Contains(body, `"total":2`) {
+				t.Errorf("Unexpected body: %s", body)
+			}
+		})
+	}
+}
+
+// protocolStore holds credential profiles 1 (ssh) and 2 (snmp-v2c) and an ssh monitor 1
+func protocolStore() *fakeQuerier {
+	q := newFakeQuerier()
+	q.credentials[1] = dbgen.CredentialProfile{ID: 1, Protocol: "ssh"}
+	q.credentials[2] = dbgen.CredentialProfile{ID: 2, Protocol: "snmp-v2c"}
+	q.monitors[1] = dbgen.Monitor{ID: 1, PluginID: "ssh", CredentialProfileID: 1}
+	return q
+}
+
+// wrote reports whether a monitor was created or updated
+func (q *fakeQuerier) wrote() bool {
+	return q.calls["CreateMonitor"]+q.calls["UpdateMonitor"] > 0
+}
+
+func TestMonitorHandlerCredentialProtocol(t *testing.T) {
+	testCases := []struct {
+		name       string
+		method     string
+		body       string
+		wantStatus int
+		wantCode   string
+	}{
+		{"Create matching", http.MethodPost, `{"ip_address":"192.0.2.1","plugin_id":"ssh","credential_profile_id":1,"discovery_profile_id":1}`, http.StatusCreated, ""},
+		{"Create mismatch", http.MethodPost, `{"ip_address":"192.0.2.1","plugin_id":"ssh","credential_profile_id":2,"discovery_profile_id":1}`, http.StatusBadRequest, "PROTOCOL_MISMATCH"},
+		{"Create by manifest ID", http.MethodPost, `{"ip_address":"192.0.2.1","plugin_id":"winrm","credential_profile_id":1,"discovery_profile_id":1}`, http.StatusBadRequest, "PROTOCOL_MISMATCH"},
+		{"Create unknown credential", http.MethodPost, `{"ip_address":"192.0.2.1","plugin_id":"ssh","credential_profile_id":9,"discovery_profile_id":1}`, http.StatusBadRequest, "VALIDATION_ERROR"},
+		{"Update credential mismatch", http.MethodPatch, `{"credential_profile_id":2}`, http.StatusBadRequest, "PROTOCOL_MISMATCH"},
+		{"Update plugin and credential", http.MethodPatch, `{"plugin_id":"snmp-v2c","credential_profile_id":2}`, http.StatusOK, ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			q := protocolStore()
+			h := NewMonitorHandler(&common.Dependencies{
+				Q:          q,
+				Plugins:    staticPlugins{{ID: "winrm", Protocol: "windows-winrm"}},
+				Collectors: staticCollectors{"snmp-v2c", "ssh"},
+			})
+
+			r := chi.NewRouter()
+			r.Post("/", h.Create)
+			r.Patch("/{id}", h.Update)
+
+			path := "/"
+			if tc.method == http.MethodPatch {
+				path = "/1"
+			}
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, httptest.NewRequest(tc.method, path, strings.NewReader(tc.body)))
+
+			if rec.Code != tc.wantStatus {
+				t.Fatalf("Expected status %d, got %d (body: %s)", tc.wantStatus, rec.Code, rec.Body.String())
+			}
+			if tc.wantCode != "" && !strings.Contains(rec.Body.String(), tc.wantCode) {
+				t.Errorf("Expected error code %s, got %s", tc.wantCode, rec.Body.String())
+			}
+			if tc.wantCode != "" && q.wrote() {
+				t.Error("Rejected monitor should not be written")
+			}
+		})
+	}
+}
+
+func TestMonitorHandlerDuplicatePolicy(t *testing.T) {
+	testCases := []struct {
+		name        string
+		policy      string
+		existing    bool
+		racing      bool
+		wantStatus  int
+		wantCreated bool
+	}{
+		{"Reject duplicate", "reject", true, false, http.StatusConflict, false},
+		{"Reject duplicate created concurrently", "reject", false, true, http.StatusConflict, false},
+		{"Reject without duplicate", "reject", false, false, http.StatusCreated, true},
+		{"Allow duplicate", "allow", true, false, http.StatusCreated, true},
+		{"Warn on duplicate", "", true, false, http.StatusCreated, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			globals.SetGlobalConfigForTests(&globals.Config{
+				Scheduler: globals.SchedulerConfig{DuplicateMonitorPolicy: tc.policy},
+			})
+			q := protocolStore()
+			duplicate := dbgen.Monitor{ID: 7, IpAddress: netip.MustParseAddr("192.0.2.1"), PluginID: "ssh", CredentialProfileID: 1}
+			if tc.existing {
+				q.monitors[7] = duplicate
+			}
+			if tc.racing {
+				q.racer = func(q *fakeQuerier) { q.monitors[7] = duplicate }
+			}
+			before := len(q.monitors)
+			h := NewMonitorHandler(&common.Dependencies{Q: q})
+
+			rec := httptest.NewRecorder()
+			h.Create(rec, httptest.NewRequest(http.MethodPost, "/",
+				strings.NewReader(`{"ip_address":"192.0.2.1","plugin_id":"ssh","credential_profile_id":1,"discovery_profile_id":1}`)))
+
+			if rec.Code != tc.wantStatus {
+				t.Fatalf("Expected status %d, got %d (body: %s)", tc.wantStatus, rec.Code, rec.Body.String())
+			}
+			added := len(q.monitors) - before
+			if tc.racing {
+				added-- // the racer's monitor
+			}
+			if created := added > 0; created != tc.wantCreated {
+				t.Errorf("Expected created %v, got %v", tc.wantCreated, created)
+			}
+			if tc.wantStatus == http.StatusConflict &&
+				(!strings.Contains(rec.Body.String(), "DUPLICATE_MONITOR") || !strings.Contains(rec.Body.String(), `"existing_monitor_id":7`)) {
+				t.Errorf("Expected a DUPLICATE_MONITOR error naming monitor 7, got %s", rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestMonitorHandlerUpdateDuplicatePolicy(t *testing.T) {
+	testCases := []struct {
+		name       string
+		policy     string
+		body       string
+		wantStatus int
+		wantIP     string
+	}{
+		{"Reject moving onto a duplicate", "reject", `{"ip_address":"192.0.2.9"}`, http.StatusConflict, "192.0.2.1"},
+		{"Reject moving to a free address", "reject", `{"ip_address":"192.0.2.5"}`, http.StatusOK, "192.0.2.5"},
+		{"Reject leaves unmoved monitors alone", "reject", `{"display_name":"renamed"}`, http.StatusOK, "192.0.2.1"},
+		{"Allow duplicate", "allow", `{"ip_address":"192.0.2.9"}`, http.StatusOK, "192.0.2.9"},
+		{"Warn on duplicate", "warn", `{"ip_address":"192.0.2.9"}`, http.StatusOK, "192.0.2.9"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			globals.SetGlobalConfigForTests(&globals.Config{
+				Scheduler: globals.SchedulerConfig{DuplicateMonitorPolicy: tc.policy},
+			})
+			q := protocolStore()
+			m := q.monitors[1]
+			m.IpAddress = netip.MustParseAddr("192.0.2.1")
+			q.monitors[1] = m
+			q.monitors[7] = dbgen.Monitor{ID: 7, IpAddress: netip.MustParseAddr("192.0.2.9"), PluginID: "ssh", CredentialProfileID: 1}
+			h := NewMonitorHandler(&common.Dependencies{Q: q})
+
+			r := chi.NewRouter()
+			r.Patch("/{id}", h.Update)
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, httptest.NewRequest(http.MethodPatch, "/1", strings.NewReader(tc.body)))
+
+			if rec.Code != tc.wantStatus {
+				t.Fatalf("Expected status %d, got %d (body: %s)", tc.wantStatus, rec.Code, rec.Body.String())
+			}
+			if got := q.monitors[1].IpAddress.String(); got != tc.wantIP {
+				t.Errorf("Expected monitor 1 at %s, got %s", tc.wantIP, got)
+			}
+			if tc.wantStatus == http.StatusConflict && !strings.Contains(rec.Body.String(), `"existing_monitor_id":7`) {
+				t.Errorf("Expected a DUPLICATE_MONITOR error naming monitor 7, got %s", rec.Body.String())
+			}
+		})
+	}
+}
+
+// written returns the monitor row the latest create or update wrote, or nil
+func (q *fakeQuerier) written(method string) *dbgen.Monitor {
+	if !q.wrote() {
+		return nil
+	}
+	id := int64(1)
+	if method == http.MethodPost {
+		id = nextID(q.monitors) - 1
+	}
+	m := q.monitors[id]
+	return &m
+}
+
+func TestMonitorHandlerCollectors(t *testing.T) {
+	testCases := []struct {
+		name       string
+		method     string
+		body       string
+		wantStatus int
+		want       []string
+	}{
+		{"Create with all collectors", http.MethodPost, `{"ip_address":"192.0.2.1","plugin_id":"ssh","credential_profile_id":1,"discovery_profile_id":1}`, http.StatusCreated, nil},
+		{"Create with duplicates", http.MethodPost, `{"ip_address":"192.0.2.1","plugin_id":"ssh","credential_profile_id":1,"discovery_profile_id":1,"collectors":["disk","disk"]}`, http.StatusCreated, []string{"disk"}},
+		{"Create with unknown collector", http.MethodPost, `{"ip_address":"192.0.2.1","plugin_id":"ssh","credential_profile_id":1,"discovery_profile_id":1,"collectors":["gpu"]}`, http.StatusBadRequest, nil},
+		{"Update selection", http.MethodPatch, `{"collectors":["cpu"]}`, http.StatusOK, []string{"cpu"}},
+		{"Update clears selection", http.MethodPatch, `{"collectors":[]}`, http.StatusOK, nil},
+		{"Plugin without selection", http.MethodPatch, `{"plugin_id":"snmp-v2c","credential_profile_id":2,"collectors":["cpu"]}`, http.StatusBadRequest, nil},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			q := protocolStore()
+			h := NewMonitorHandler(&common.Dependencies{
+				Q: q,
+				Plugins: staticPlugins{
+					{ID: "ssh", Protocol: "ssh", Collectors: []string{"cpu", "disk"}},
+					{ID: "snmp-v2c", Protocol: "snmp-v2c"},
+				},
+			})
+
+			r := chi.NewRouter()
+			r.Post("/", h.Create)
+			r.Patch("/{id}", h.Update)
+
+			path := "/"
+			if tc.method == http.MethodPatch {
+				path = "/1"
+			}
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, httptest.NewRequest(tc.method, path, strings.NewReader(tc.body)))
+
+			if rec.Code != tc.wantStatus {
+				t.Fatalf("Expected status %d, got %d (body: %s)", tc.wantStatus, rec.Code, rec.Body.String())
+			}
+			var written []string
+			if m := q.written(tc.method); m != nil {
+				written = m.Collectors
+			}
+			if !slices.Equal(written, tc.want) {
+				t.Errorf("Expected collectors %v, got %v", tc.want, written)
+			}
+		})
+	}
+}
+
+// staticCollectors lists fixed in-process collector protocols
+type staticCollectors []string
+
+func (c staticCollectors) CollectorProtocols() []string { return c }
+
+func TestMonitorHandlerUnknownPlugin(t *testing.T) {
+	create := func(pluginID string) string {
+		return `{"ip_address":"192.0.2.1","plugin_id":"` + pluginID + `","credential_profile_id":1,"discovery_profile_id":1}`
+	}
+
+	testCases := []struct {
+		name       string
+		method     string
+		body       string
+		wantStatus int
+	}{
+		{"Create with internal collector", http.MethodPost, create("ssh"), http.StatusCreated},
+		{"Create with unknown plugin", http.MethodPost, create("shh"), http.StatusBadRequest},
+		{"Update to loaded plugin", http.MethodPatch, `{"plugin_id":"snmp-v2c","credential_profile_id":2}`, http.StatusOK},
+		{"Update to unknown plugin", http.MethodPatch, `{"plugin_id":"snmp-v9"}`, http.StatusBadRequest},
+		{"Update without plugin change", http.MethodPatch, `{"port":2222}`, http.StatusOK},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			q := protocolStore()
+			h := NewMonitorHandler(&common.Dependencies{
+				Q:          q,
+				Plugins:    staticPlugins{{ID: "windows-winrm", Protocol: "windows-winrm"}, {ID: "snmp-v2c", Protocol: "snmp-v2c"}},
+				Collectors: staticCollectors{"snmp-v2c", "ssh"},
+			})
+
+			r := chi.NewRouter()
+			r.Post("/", h.Create)
+			r.Patch("/{id}", h.Update)
+
+			path := "/"
+			if tc.method == http.MethodPatch {
+				path = "/1"
+			}
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, httptest.NewRequest(tc.method, path, strings.NewReader(tc.body)))
+
+			if rec.Code != tc.wantStatus {
+				t.Fatalf("Expected status %d, got %d (body: %s)", tc.wantStatus, rec.Code, rec.Body.String())
+			}
+			if wrote := q.wrote(); wrote != (tc.wantStatus < 300) {
+				t.Errorf("Expected write=%v, got %v", tc.wantStatus < 300, wrote)
+			}
+		})
+	}
+
+	t.Run("Error lists valid plugins", func(t *testing.T) {
+		h := NewMonitorHandler(&common.Dependencies{
+			Q:          protocolStore(),
+			Plugins:    staticPlugins{{ID: "windows-winrm", Protocol: "windows-winrm"}, {ID: "snmp-v2c", Protocol: "snmp-v2c"}},
+			Collectors: staticCollectors{"snmp-v2c", "ssh"},
+		})
+		rec := httptest.NewRecorder()
+		h.Create(rec, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(create("shh"))))
+
+		var body struct {
+			Error struct {
+				Details struct {
+					AvailablePlugins []string `json:"available_plugins"`
+				} `json:"details"`
+			} `json:"error"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+			t.Fatalf("Failed to decode error: %v", err)
+		}
+		want := []string{"snmp-v2c", "ssh", "windows-winrm"}
+		if !slices.Equal(body.Error.Details.AvailablePlugins, want) {
+			t.Errorf("Expected available plugins %v, got %v (body: %s)", want, body.Error.Details.AvailablePlugins, rec.Body.String())
+		}
+	})
+}
+
+func TestMonitorHandlerPollingIntervalBounds(t *testing.T) {
+	globals.SetGlobalConfigForTests(&globals.Config{Scheduler: globals.SchedulerConfig{
+		MinPollingIntervalSeconds: 10,
+		MaxPollingIntervalSeconds: 3600,
+	}})
+
+	create := func(interval string) string {
+		return `{"ip_address":"192.0.2.1","plugin_id":"ssh","credential_profile_id":1,"discovery_profile_id":1` + interval + `}`
+	}
+
+	testCases := []struct {
+		name       string
+		method     string
+		body       string
+		wantStatus int
+	}{
+		{"Create with default", http.MethodPost, create(""), http.StatusCreated},
+		{"Create at minimum", http.MethodPost, create(`,"polling_interval_seconds":10`), http.StatusCreated},
+		{"Create below minimum", http.MethodPost, create(`,"polling_interval_seconds":1`), http.StatusBadRequest},
+		{"Create with zero", http.MethodPost, create(`,"polling_interval_seconds":0`), http.StatusBadRequest},
+		{"Create above maximum", http.MethodPost, create(`,"polling_interval_seconds":3601`), http.StatusBadRequest},
+		{"Update valid", http.MethodPatch, `{"polling_interval_seconds":300}`, http.StatusOK},
+		{"Update below minimum", http.MethodPatch, `{"polling_interval_seconds":5}`, http.StatusBadRequest},
+		{"Update above maximum", http.MethodPatch, `{"polling_interval_seconds":86400}`, http.StatusBadRequest},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			q := protocolStore()
+			h := NewMonitorHandler(&common.Dependencies{Q: q})
+
+			r := chi.NewRouter()
+			r.Post("/", h.Create)
+			r.Patch("/{id}", h.Update)
+
+			path := "/"
+			if tc.method == http.MethodPatch {
+				path = "/1"
+			}
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, httptest.NewRequest(tc.method, path, strings.NewReader(tc.body)))
+
+			if rec.Code != tc.wantStatus {
+				t.Fatalf("Expected status %d, got %d (body: %s)", tc.wantStatus, rec.Code, rec.Body.String())
+			}
+			if wrote := q.wrote(); wrote != (tc.wantStatus < 300) {
+				t.Errorf("Expected write=%v, got %v", tc.wantStatus < 300, wrote)
+			}
+		})
+	}
+}
+
+func TestMonitorHandlerKeepPollingWhenDown(t *testing.T) {
+	testCases := []struct {
+		name   string
+		method string
+		body   string
+		want   bool
+	}{
+		{"Create defaults off", http.MethodPost, `{"ip_address":"192.0.2.1","plugin_id":"ssh","credential_profile_id":1,"discovery_profile_id":1}`, false},
+		{"Create with flag", http.MethodPost, `{"ip_address":"192.0.2.1","plugin_id":"ssh","credential_profile_id":1,"discovery_profile_id":1,"keep_polling_when_down":true}`, true},
+		{"Update keeps flag when omitted", http.MethodPatch, `{"port":2222}`, true},
+		{"Update clears flag", http.MethodPatch, `{"keep_polling_when_down":false}`, false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			q := protocolStore()
+			m := q.monitors[1]
+			m.KeepPollingWhenDown = true
+			q.monitors[1] = m
+			h := NewMonitorHandler(&common.Dependencies{Q: q})
+
+			r := chi.NewRouter()
+			r.Post("/", h.Create)
+			r.Patch("/{id}", h.Update)
+
+			path := "/"
+			if tc.method == http.MethodPatch {
+				path = "/1"
+			}
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, httptest.NewRequest(tc.method, path, strings.NewReader(tc.body)))
+
+			if rec.Code >= 300 {
+				t.Fatalf("Expected success, got %d (body: %s)", rec.Code, rec.Body.String())
+			}
+			if m := q.written(tc.method); m == nil || m.KeepPollingWhenDown != tc.want {
+				t.Errorf("Expected keep_polling_when_down=%v to be written, got %+v", tc.want, m)
+			}
+		})
+	}
+}
+
+func TestMonitorHandlerTags(t *testing.T) {
+	create := func(tags string) string {
+		return `{"ip_address":"192.0.2.1","plugin_id":"ssh","credential_profile_id":1,"discovery_profile_id":1` + tags + `}`
+	}
+
+	testCases := []struct {
+		name       string
+		method     string
+		body       string
+		wantStatus int
+		wantTags   string
+	}{
+		{"Create without tags", http.MethodPost, create(""), http.StatusCreated, ""},
+		{"Create with tags", http.MethodPost, create(`,"tags":{"dc":"west","owner":"netops"}`), http.StatusCreated, `{"dc":"west","owner":"netops"}`},
+		{"Create with non-string value", http.MethodPost, create(`,"tags":{"rack":4}`), http.StatusBadRequest, ""},
+		{"Create with array", http.MethodPost, create(`,"tags":["dc"]`), http.StatusBadRequest, ""},
+		{"Update keeps tags when omitted", http.MethodPatch, `{"port":2222}`, http.StatusOK, `{"dc":"east"}`},
+		{"Update replaces tags", http.MethodPatch, `{"tags":{"env":"prod"}}`, http.StatusOK, `{"env":"prod"}`},
+		{"Update clears tags", http.MethodPatch, `{"tags":{}}`, http.StatusOK, `{}`},
+		{"Update with null", http.MethodPatch, `{"tags":null}`, http.StatusBadRequest, ""},
+		{"Update with empty key", http.MethodPatch, `{"tags":{"":"x"}}`, http.StatusBadRequest, ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			q := protocolStore()
+			m := q.monitors[1]
+			m.Tags = json.RawMessage(`{"dc":"east"}`)
+			q.monitors[1] = m
+			h := NewMonitorHandler(&common.Dependencies{Q: q})
+
+			r := chi.NewRouter()
+			r.Post("/", h.Create)
+			r.Patch("/{id}", h.Update)
+
+			path := "/"
+			if tc.method == http.MethodPatch {
+				path = "/1"
+			}
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, httptest.NewRequest(tc.method, path, strings.NewReader(tc.body)))
+
+			if rec.Code != tc.wantStatus {
+				t.Fatalf("Expected status %d, got %d (body: %s)", tc.wantStatus, rec.Code, rec.Body.String())
+			}
+			var written json.RawMessage
+			if m := q.written(tc.method); m != nil {
+				written = m.Tags
+			}
+			if string(written) != tc.wantTags {
+				t.Errorf("Expected tags %q to be written, got %q", tc.wantTags, written)
+			}
+		})
+	}
+}
+
+// cappedSubmitter accepts up to capacity records, then blocks until the context expires
+type cappedSubmitter struct {
+	capacity int
+	records  []globals.MetricRecord
+}
+
+func (s *cappedSubmitter) Submit(ctx context.Context, record globals.MetricRecord) error {
+	if len(s.records) >= s.capacity {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	s.records = append(s.records, record)
+	return nil
+}
+
+func TestMonitorHandlerIngestMetrics(t *testing.T) {
+	testCases := []struct {
+		name         string
+		path         string
+		body         string
+		capacity     int
+		policy       string // metrics.timestamp_policy
+		wantStatus   int
+		wantAccepted int
+	}{
+		{"Accepted", "/1/metrics", `[{"name":"cpu.usage","value":12.5},{"name":"if.in","value":"42","type":"counter","timestamp":"2025-01-01T00:00:00Z"}]`, 10, "", http.StatusAccepted, 2},
+		{"Stale timestamp rejected", "/1/metrics", `[{"name":"cpu.usage","value":12.5},{"name":"if.in","value":"42","type":"counter","timestamp":"2025-01-01T00:00:00Z"}]`, 10, "reject", http.StatusAccepted, 1},
+		{"Missing value", "/1/metrics", `[{"name":"cpu.usage"}]`, 10, "", http.StatusBadRequest, 0},
+		{"Invalid type", "/1/metrics", `[{"name":"cpu.usage","value":1,"type":"histogram"}]`, 10, "", http.StatusBadRequest, 0},
+		{"Empty batch", "/1/metrics", `[]`, 10, "", http.StatusBadRequest, 0},
+		{"Not an array", "/1/metrics", `{"name":"cpu.usage","value":1}`, 10, "", http.StatusBadRequest, 0},
+		{"Unknown monitor", "/3/metrics", `[{"name":"cpu.usage","value":1}]`, 10, "", http.StatusNotFound, 0},
+		{"Queue full", "/1/metrics", `[{"name":"a","value":1},{"name":"b","value":2}]`, 1, "", http.StatusServiceUnavailable, 1},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			globals.SetGlobalConfigForTests(&globals.Config{Metrics: globals.MetricsConfig{TimestampPolicy: tc.policy}})
+			submitter := &cappedSubmitter{capacity: tc.capacity}
+			h := NewMonitorHandler(&common.Dependencies{
+				Q:       newFakeQuerier().addMonitors(map[int64]string{1: "active"}),
+				Metrics: submitter,
+			})
+
+			r := chi.NewRouter()
+			r.Post("/{id}/metrics", h.IngestMetrics)
+
+			req := httptest.NewRequest(http.MethodPost, tc.path, strings.NewReader(tc.body))
+			if tc.wantStatus == http.StatusServiceUnavailable {
+				ctx, cancel := context.WithTimeout(req.Context(), 50*time.Millisecond)
+				defer cancel()
+				req = req.WithContext(ctx)
+			}
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, req)
+
+			if rec.Code != tc.wantStatus {
+				t.Fatalf("Expected status %d, got %d (body: %s)", tc.wantStatus, rec.Code, rec.Body.String())
+			}
+			if len(submitter.records) != tc.wantAccepted {
+				t.Errorf("Expected %d submitted records, got %d", tc.wantAccepted, len(submitter.records))
+			}
+			for _, record := range submitter.records {
+				if record.MonitorID != 1 {
+					t.Errorf("Expected records for monitor 1, got %d", record.MonitorID)
+				}
+			}
+		})
+	}
+}
+
+func TestMonitorHandlerIngestMetricsBackpressureItems(t *testing.T) {
+	globals.SetGlobalConfigForTests(&globals.Config{Metrics: globals.MetricsConfig{TimestampPolicy: "reject"}})
+	submitter := &cappedSubmitter{capacity: 1}
+	h := NewMonitorHandler(&common.Dependencies{
+		Q:       newFakeQuerier().addMonitors(map[int64]string{1: "active"}),
+		Metrics: submitter,
+	})
+	r := chi.NewRouter()
+	r.Post("/{id}/metrics", h.IngestMetrics)
+
+	body := `[{"name":"a","value":1},{"name":"b","value":2,"timestamp":"2025-01-01T00:00:00Z"},{"name":"c","value":3},{"name":"d","value":4}]`
+	req := httptest.NewRequest(http.MethodPost, "/1/metrics", strings.NewReader(body))
+	ctx, cancel := context.WithTimeout(req.Context(), 50*time.Millisecond)
+	defer cancel()
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req.WithContext(ctx))
+
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("Expected status 503, got %d (body: %s)", rec.Code, rec.Body.String())
+	}
+	var resp struct {
+		Error struct {
+			Details struct {
+				Accepted int      `json:"accepted"`
+				Rejected int      `json:"rejected"`
+				Total    int      `json:"total"`
+				Items    []string `json:"items"`
+			} `json:"details"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	details := resp.Error.Details
+	want := []string{"accepted", "rejected", "retry", "retry"}
+	if !slices.Equal(details.Items, want) || details.Accepted != 1 || details.Rejected != 1 || details.Total != 4 {
+		t.Errorf("Expected items %v (1 accepted, 1 rejected of 4), got %+v", want, details)
+	}
+}
+
+func TestMonitorHandlerSlowQueryLog(t *testing.T) {
+	testCases := []struct {
+		name        string
+		thresholdMS int
+		delay       time.Duration
+		wantLogged  bool
+	}{
+		{"Slow query logged", 1, 5 * time.Millisecond, true},
+		{"Fast query not logged", 1000, 0, false},
+		{"Logging disabled", -1, 5 * time.Millisecond, false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			globals.SetGlobalConfigForTests(&globals.Config{Metrics: globals.MetricsConfig{SlowQueryThresholdMS: tc.thresholdMS}})
+
+			var logs strings.Builder
+			q := newFakeQuerier().addMonitors(map[int64]string{1: "active"})
+			q.groups[1] = []string{"secret-tenant"}
+			q.metrics = []dbgen.Metric{{Timestamp: time.Now().Add(-time.Minute), DeviceID: 1, Name: "tenant.secret.cpu", Value: 3}}
+			q.delay = tc.delay
+			h := NewMonitorHandler(&common.Dependencies{Q: q, Logger: slog.New(slog.NewTextHandler(&logs, nil))})
+
+			start := time.Now().Add(-time.Hour).UTC().Format(time.RFC3339)
+			end := time.Now().UTC().Format(time.RFC3339)
+			body := `{"group":"secret-tenant","prefix":"tenant.secret","latest":true,"start":"` + start + `","end":"` + end + `"}`
+			rec := httptest.NewRecorder()
+			h.QueryMetrics(rec, httptest.NewRequest(http.MethodPost, "/metrics/query", strings.NewReader(body)))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("Expected status 200, got %d (body: %s)", rec.Code, rec.Body.String())
+			}
+
+			out := logs.String()
+			if logged := strings.Contains(out, "slow metrics query"); logged != tc.wantLogged {
+				t.Fatalf("Expected logged=%v, got log: %q", tc.wantLogged, out)
+			}
+			if !tc.wantLogged {
+				return
+			}
+			for _, want := range []string{"device_count=1", "range_seconds=3600", "latest=true", "has_prefix=true", "rows=1"} {
+				if !strings.Contains(out, want) {
+					t.Errorf("Expected %q in log, got %q", want, out)
+				}
+			}
+			if strings.Contains(out, "secret") {
+				t.Errorf("Slow query log leaked query values: %q", out)
+			}
+		})
+	}
+}
+
+func TestMonitorHandlerQueryMetricsRollups(t *testing.T) {
+	testCases := []struct {
+		name        string
+		rollupAfter int
+		startAgo    time.Duration
+		latest      bool
+		limit       int
+		wantRollups bool
+		wantCPU     []float64
+		wantMem     []float64
+	}{
+		{"Old range adds rollups", 24, 72 * time.Hour, false, 0, true, []float64{1, 5}, []float64{3, 4}},
+		{"Limit holds per series across the boundary", 24, 72 * time.Hour, false, 1, true, []float64{1}, []float64{3}},
+		{"Recent range stays raw", 24, 12 * time.Hour, false, 0, false, []float64{1}, nil},
+		{"Rollups disabled", 0, 72 * time.Hour, false, 0, false, []float64{1}, nil},
+		{"Latest falls back to rollups for silent metrics", 24, 72 * time.Hour, true, 0, true, []float64{1}, []float64{3}},
+		{"Latest within the raw window", 24, 12 * time.Hour, true, 0, false, []float64{1}, nil},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			globals.SetGlobalConfigForTests(&globals.Config{Metrics: globals.MetricsConfig{RollupAfterHours: tc.rollupAfter}})
+			now := time.Now()
+			q := newFakeQuerier().addMonitors(map[int64]string{1: "active"})
+			q.metrics = []dbgen.Metric{{Timestamp: now.Add(-time.Hour), DeviceID: 1, Name: "cpu", Value: 1}}
+			// The cpu bucket inside the raw window must not be returned alongside the raw
+			// points; mem has been silent since its raw points were rolled up
+			q.rollups = []dbgen.MetricsRollup{
+				{Bucket: now.Add(-48 * time.Hour).Truncate(time.Hour), DeviceID: 1, Name: "cpu", AvgValue: 5},
+				{Bucket: now.Add(-2 * time.Hour).Truncate(time.Hour), DeviceID: 1, Name: "cpu", AvgValue: 9},
+				{Bucket: now.Add(-36 * time.Hour).Truncate(time.Hour), DeviceID: 1, Name: "mem", AvgValue: 3},
+				{Bucket: now.Add(-60 * time.Hour).Truncate(time.Hour), DeviceID: 1, Name: "mem", AvgValue: 4},
+			}
+			h := NewMonitorHandler(&common.Dependencies{Q: q})
+
+			body := fmt.Sprintf(`{"device_ids":[1],"latest":%v,"limit":%d,"start":%q,"end":%q}`, tc.latest, tc.limit,
+				now.Add(-tc.startAgo).UTC().Format(time.RFC3339), now.UTC().Format(time.RFC3339))
+			rec := httptest.NewRecorder()
+			h.QueryMetrics(rec, httptest.NewRequest(http.MethodPost, "/metrics/query", strings.NewReader(body)))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("Expected status 200, got %d (body: %s)", rec.Code, rec.Body.String())
+			}
+
+			queried := q.calls["GetRollupMetricsByDeviceAndPrefix"]+q.calls["GetLatestRollupMetricsByDeviceAndPrefix"] > 0
+			if queried != tc.wantRollups {
+				t.Fatalf("Expected rollups queried=%v, got %v", tc.wantRollups, queried)
+			}
+			if tc.wantRollups && !tc.latest {
+				args := lastArgs[dbgen.GetRollupMetricsByDeviceAndPrefixParams](q, "GetRollupMetricsByDeviceAndPrefix")
+				if boundary := now.Add(-24 * time.Hour).Truncate(time.Hour); !args.EndTime.Equal(boundary) {
+					t.Errorf("Expected rollups to end at %v, got %v", boundary, args.EndTime)
+				}
+			}
+
+			var resp MetricsQueryResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			for name, want := range map[string][]float64{"cpu": tc.wantCPU, "mem": tc.wantMem} {
+				var values []float64
+				for _, p := range resp.Data["1"][name] {
+					values = append(values, p.Value)
+				}
+				if !slices.Equal(values, want) {
+					t.Errorf("Expected %s values %v newest first, got %v", name, want, values)
+				}
+			}
+		})
+	}
+
+	// The latest-metrics endpoint falls back the same way
+	globals.SetGlobalConfigForTests(&globals.Config{Metrics: globals.MetricsConfig{RollupAfterHours: 1}})
+	q := newFakeQuerier().addMonitors(map[int64]string{1: "active"})
+	q.rollups = []dbgen.MetricsRollup{{Bucket: time.Now().Add(-3 * time.Hour).Truncate(time.Hour), DeviceID: 1, Name: "cpu", AvgValue: 5}}
+	r := chi.NewRouter()
+	r.Get("/{id}/metrics/latest", NewMonitorHandler(&common.Dependencies{Q: q}).LatestMetrics)
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/1/metrics/latest", nil))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"cpu":{`) || !strings.Contains(rec.Body.String(), `"value":5`) {
+		t.Errorf("Expected the newest rollup for a silent metric, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
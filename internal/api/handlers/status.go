@@ -0,0 +1,178 @@
+package handlers
+
+import (
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/nmslite/nmslite/internal/api/common"
+	"github.com/nmslite/nmslite/internal/globals"
+)
+
+// Overall values of StatusResponse.Status
+const (
+	StatusOK       = "ok"
+	StatusDegraded = "degraded"
+)
+
+// StatusResponse is the diagnostic report served by GET /api/v1/status
+type StatusResponse struct {
+	Status        string            `json:"status"`
+	Timestamp     time.Time         `json:"timestamp"`
+	UptimeSeconds int64             `json:"uptime_seconds"`
+	Build         globals.BuildInfo `json:"build"`
+	Database      DatabaseStatus    `json:"database"`
+	Scheduler     SchedulerStatus   `json:"scheduler"`
+	Discovery     DiscoveryStatus   `json:"discovery"`
+	Metrics       MetricsStatus     `json:"metrics"`
+	Plugins       PluginsStatus     `json:"plugins"`
+	// Pipeline is the latest end-to-end check that polled metrics reach storage; a
+	// degraded pipeline marks the status degraded
+	Pipeline globals.PipelineHealth `json:"pipeline"`
+	// Channels lists event channel fill; a slow channel marks the status degraded
+	Channels []globals.ChannelStats `json:"channels"`
+}
+
+// DatabaseStatus reports connectivity and usage of each connection pool
+type DatabaseStatus struct {
+	Connected bool                  `json:"connected"`
+	Pools     map[string]PoolStatus `json:"pools"`
+}
+
+// PoolStatus is one connection pool's health and usage
+type PoolStatus struct {
+	Connected     bool   `json:"connected"`
+	Error         string `json:"error,omitempty"`
+	MaxConns      int32  `json:"max_conns"`
+	TotalConns    int32  `json:"total_conns"`
+	AcquiredConns int32  `json:"acquired_conns"`
+	IdleConns     int32  `json:"idle_conns"`
+	AcquireCount  int64  `json:"acquire_count"`
+	// EmptyAcquireCount counts acquires that had to wait for a connection
+	EmptyAcquireCount int64 `json:"empty_acquire_count"`
+}
+
+// SchedulerStatus summarizes the poll scheduler
+type SchedulerStatus struct {
+	Available       bool       `json:"available"`
+	Running         bool       `json:"running"`
+	TrackedMonitors int        `json:"tracked_monitors"`
+	PollingMonitors int        `json:"polling_monitors"`
+	InFlightBatches int        `json:"in_flight_batches"`
+	NextDue         *time.Time `json:"next_due,omitempty"`
+}
+
+// DiscoveryStatus summarizes the discovery worker
+type DiscoveryStatus struct {
+	Available      bool `json:"available"`
+	Running        bool `json:"running"`
+	ActiveProfiles int  `json:"active_profiles"`
+}
+
+// MetricsStatus summarizes the metric batch writer
+type MetricsStatus struct {
+	Available  bool `json:"available"`
+	QueueDepth int  `json:"queue_depth"`
+}
+
+// PluginsStatus summarizes the loaded plugins
+type PluginsStatus struct {
+	Count     int      `json:"count"`
+	Protocols []string `json:"protocols"`
+}
+
+// Status handles GET /api/v1/status. Unlike /health it reports on every subsystem for
+// operators; it always answers 200 and flags problems through the status field.
+func (h *SystemHandler) Status(w http.ResponseWriter, r *http.Request) {
+	resp := StatusResponse{
+		Status:        StatusOK,
+		Timestamp:     time.Now(),
+		UptimeSeconds: int64(globals.Uptime().Seconds()),
+		Build:         globals.GetBuildInfo(),
+		Database:      h.databaseStatus(r),
+		Plugins:       PluginsStatus{Protocols: []string{}},
+		Channels:      []globals.ChannelStats{},
+		Pipeline:      globals.PipelineHealth{Status: globals.PipelineUnknown},
+	}
+
+	if s := h.Deps.Scheduler; s != nil {
+		snap := s.Snapshot()
+		resp.Scheduler = SchedulerStatus{
+			Available:       true,
+			Running:         snap.Running,
+			TrackedMonitors: snap.TrackedMonitors,
+			PollingMonitors: len(snap.PollingMonitors),
+			NextDue:         snap.NextDue,
+		}
+		for _, n := range snap.InFlightBatches {
+			resp.Scheduler.InFlightBatches += n
+		}
+	}
+
+	if d := h.Deps.Discovery; d != nil {
+		resp.Discovery = DiscoveryStatus{
+			Available:      true,
+			Running:        d.Active(),
+			ActiveProfiles: d.RunningProfiles(),
+		}
+	}
+
+	if q := h.Deps.MetricQueue; q != nil {
+		resp.Metrics = MetricsStatus{Available: true, QueueDepth: q.QueueDepth()}
+	}
+
+	if p := h.Deps.Pipeline; p != nil {
+		resp.Pipeline = p.PipelineHealth()
+	}
+
+	if h.Deps.Plugins != nil {
+		for _, p := range h.Deps.Plugins.List() {
+			resp.Plugins.Protocols = append(resp.Plugins.Protocols, p.Protocol)
+		}
+		sort.Strings(resp.Plugins.Protocols)
+		resp.Plugins.Count = len(resp.Plugins.Protocols)
+	}
+
+	slowChannel := false
+	if h.Deps.Events != nil {
+		resp.Channels = h.Deps.Events.ChannelStats()
+		for _, c := range resp.Channels {
+			slowChannel = slowChannel || c.Slow
+		}
+	}
+
+	if !resp.Database.Connected || slowChannel || resp.Pipeline.Status == globals.PipelineDegraded ||
+		(resp.Scheduler.Available && !resp.Scheduler.Running) ||
+		(resp.Discovery.Available && !resp.Discovery.Running) {
+		resp.Status = StatusDegraded
+	}
+
+	common.SendJSON(w, http.StatusOK, resp)
+}
+
+// databaseStatus pings every pool within the query timeout and collects its statistics
+func (h *SystemHandler) databaseStatus(r *http.Request) DatabaseStatus {
+	status := DatabaseStatus{Connected: len(h.Deps.Pools) > 0, Pools: make(map[string]PoolStatus, len(h.Deps.Pools))}
+
+	ctx, cancel := common.QueryContext(r)
+	defer cancel()
+
+	for name, pool := range h.Deps.Pools {
+		ps := PoolStatus{Connected: true}
+		if err := pool.Ping(ctx); err != nil {
+			ps.Connected = false
+			ps.Error = err.Error()
+			status.Connected = false
+		}
+		if stat := pool.Stat(); stat != nil {
+			ps.MaxConns = stat.MaxConns()
+			ps.TotalConns = stat.TotalConns()
+			ps.AcquiredConns = stat.AcquiredConns()
+			ps.IdleConns = stat.IdleConns()
+			ps.AcquireCount = stat.AcquireCount()
+			ps.EmptyAcquireCount = stat.EmptyAcquireCount()
+		}
+		status.Pools[name] = ps
+	}
+	return status
+}
@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/nmslite/nmslite/internal/api/common"
+	"github.com/nmslite/nmslite/internal/globals"
+)
+
+// fakePool answers pings with a fixed error and has no statistics
+type fakePool struct {
+	err error
+}
+
+func (p fakePool) Ping(ctx context.Context) error { return p.err }
+
+func (p fakePool) Stat() *pgxpool.Stat { return nil }
+
+// fakeDiscovery reports a fixed discovery worker state
+type fakeDiscovery struct {
+	active  bool
+	running int
+}
+
+func (d fakeDiscovery) Active() bool { return d.active }
+
+func (d fakeDiscovery) RunningProfiles() int { return d.running }
+
+// fakeQueue reports a fixed metric backlog
+type fakeQueue int
+
+func (q fakeQueue) QueueDepth() int { return int(q) }
+
+// fakePipeline reports a fixed metrics pipeline check result
+type fakePipeline string
+
+func (p fakePipeline) PipelineHealth() globals.PipelineHealth {
+	return globals.PipelineHealth{Status: string(p)}
+}
+
+func TestSystemHandlerStatus(t *testing.T) {
+	globals.SetGlobalConfigForTests(&globals.Config{})
+
+	plugins := staticPlugins{{ID: "ssh", Protocol: "ssh"}, {ID: "windows-winrm", Protocol: "windows-winrm"}}
+
+	testCases := []struct {
+		name       string
+		deps       *common.Dependencies
+		wantStatus string
+	}{
+		{"All healthy", &common.Dependencies{
+			Pools:       map[string]common.DatabasePool{"main": fakePool{}, "discovery": fakePool{}},
+			Scheduler:   &fakeScheduler{},
+			Discovery:   fakeDiscovery{active: true, running: 2},
+			MetricQueue: fakeQueue(42),
+			Pipeline:    fakePipeline(globals.PipelineOK),
+			Plugins:     plugins,
+		}, StatusOK},
+		{"Metrics pipeline stalled", &common.Dependencies{
+			Pools:    map[string]common.DatabasePool{"main": fakePool{}},
+			Pipeline: fakePipeline(globals.PipelineDegraded),
+		}, StatusDegraded},
+		{"Metrics pipeline idle", &common.Dependencies{
+			Pools:    map[string]common.DatabasePool{"main": fakePool{}},
+			Pipeline: fakePipeline(globals.PipelineIdle),
+		}, StatusOK},
+		{"Database unreachable", &common.Dependencies{
+			Pools:     map[string]common.DatabasePool{"main": fakePool{}, "discovery": fakePool{err: errors.New("connection refused")}},
+			Discovery: fakeDiscovery{active: true},
+		}, StatusDegraded},
+		{"Discovery stopped", &common.Dependencies{
+			Pools:     map[string]common.DatabasePool{"main": fakePool{}},
+			Discovery: fakeDiscovery{},
+		}, StatusDegraded},
+		{"No pools", &common.Dependencies{}, StatusDegraded},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			NewSystemHandler(tc.deps).Status(rec, httptest.NewRequest(http.MethodGet, "/api/v1/status", nil))
+
+			if rec.Code != http.StatusOK {
+				t.Fatalf("Expected status 200, got %d (body: %s)", rec.Code, rec.Body.String())
+			}
+			var resp StatusResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if resp.Status != tc.wantStatus {
+				t.Errorf("Expected status %q, got %q (body: %s)", tc.wantStatus, resp.Status, rec.Body.String())
+			}
+			if resp.Build.Version != globals.Version {
+				t.Errorf("Expected version %q, got %q", globals.Version, resp.Build.Version)
+			}
+			if len(resp.Database.Pools) != len(tc.deps.Pools) {
+				t.Errorf("Expected %d pools, got %d", len(tc.deps.Pools), len(resp.Database.Pools))
+			}
+		})
+	}
+
+	// Component details are passed through
+	rec := httptest.NewRecorder()
+	NewSystemHandler(testCases[0].deps).Status(rec, httptest.NewRequest(http.MethodGet, "/api/v1/status", nil))
+	var resp StatusResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if !resp.Scheduler.Running || resp.Scheduler.TrackedMonitors != 4 {
+		t.Errorf("Unexpected scheduler status: %+v", resp.Scheduler)
+	}
+	if resp.Discovery.ActiveProfiles != 2 || resp.Metrics.QueueDepth != 42 || resp.Plugins.Count != 2 {
+		t.Errorf("Unexpected component status: %+v %+v %+v", resp.Discovery, resp.Metrics, resp.Plugins)
+	}
+	if resp.Pipeline.Status != globals.PipelineOK {
+		t.Errorf("Expected pipeline status %q, got %q", globals.PipelineOK, resp.Pipeline.Status)
+	}
+}
@@ -2,10 +2,17 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
+	"sort"
 
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
 	"github.com/nmslite/nmslite/internal/api/auth"
 	"github.com/nmslite/nmslite/internal/api/common"
+	"github.com/nmslite/nmslite/internal/globals"
+	"github.com/nmslite/nmslite/internal/protocols"
+	"golang.org/x/crypto/bcrypt"
 )
 
 type SystemHandler struct {
@@ -20,7 +27,9 @@ func NewSystemHandler(deps *common.Dependencies) *SystemHandler {
 func (h *SystemHandler) Login(w http.ResponseWriter, r *http.Request) {
 	var req auth.LoginRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		common.SendError(w, r, http.StatusBadRequest, "INVALID_REQUEST", "Invalid JSON payload", nil)
+		if !common.BodyTooLarge(w, r, err) {
+			common.SendError(w, r, http.StatusBadRequest, "INVALID_REQUEST", "Invalid JSON payload", nil)
+		}
 		return
 	}
 
@@ -29,7 +38,12 @@ func (h *SystemHandler) Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// The configured admin first, then users stored in the database
 	response, err := h.Deps.Auth.Login(req.Username, req.Password)
+	if err != nil && h.Deps.Q != nil && !h.Deps.Auth.IsAdminUsername(req.Username) {
+		h.loginUser(w, r, req)
+		return
+	}
 	if err != nil {
 		common.SendError(w, r, http.StatusUnauthorized, "UNAUTHORIZED", "Invalid credentials", nil)
 		return
@@ -38,6 +52,38 @@ func (h *SystemHandler) Login(w http.ResponseWriter, r *http.Request) {
 	common.SendJSON(w, http.StatusOK, response)
 }
 
+// dummyPasswordHash is compared against for unknown users, so they take as long to reject
+// as a wrong password and response times do not reveal which usernames exist
+const dummyPasswordHash = "$2a$10$oqqD8/0W12sVzTMN9VH6suFMZ5cMdb1/IR9KQfu5GPpMixHNt/xwe"
+
+// loginUser checks req against the users table and responds with a token carrying the
+// user's role. An unknown user and a wrong password get the same 401 in the same time.
+func (h *SystemHandler) loginUser(w http.ResponseWriter, r *http.Request, req auth.LoginRequest) {
+	ctx, cancel := common.QueryContext(r)
+	defer cancel()
+
+	user, err := h.Deps.Q.GetUserByUsername(ctx, req.Username)
+	if errors.Is(err, pgx.ErrNoRows) {
+		_ = bcrypt.CompareHashAndPassword([]byte(dummyPasswordHash), []byte(req.Password))
+		common.SendError(w, r, http.StatusUnauthorized, "UNAUTHORIZED", "Invalid credentials", nil)
+		return
+	}
+	if err == nil && bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(req.Password)) != nil {
+		common.SendError(w, r, http.StatusUnauthorized, "UNAUTHORIZED", "Invalid credentials", nil)
+		return
+	}
+	if common.HandleDBError(w, r, err, "User") {
+		return
+	}
+
+	response, err := h.Deps.Auth.IssueToken(user.Username, user.Role)
+	if err != nil {
+		common.SendError(w, r, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to issue token", nil)
+		return
+	}
+	common.SendJSON(w, http.StatusOK, response)
+}
+
 // ListProtocols handles GET /api/v1/protocols
 func (h *SystemHandler) ListProtocols(w http.ResponseWriter, r *http.Request) {
 	if h.Deps.Registry == nil {
@@ -48,3 +94,54 @@ func (h *SystemHandler) ListProtocols(w http.ResponseWriter, r *http.Request) {
 	protocols := h.Deps.Registry.ListProtocols()
 	common.SendListResponse(w, protocols, len(protocols))
 }
+
+// GetProtocolSchema handles GET /api/v1/protocols/{protocol}/schema
+func (h *SystemHandler) GetProtocolSchema(w http.ResponseWriter, r *http.Request) {
+	if h.Deps.Registry == nil {
+		common.SendError(w, r, http.StatusInternalServerError, "REGISTRY_ERROR", "Protocol registry not initialized", nil)
+		return
+	}
+
+	schema, err := h.Deps.Registry.CredentialSchema(chi.URLParam(r, "protocol"))
+	if err != nil {
+		common.SendError(w, r, http.StatusNotFound, "NOT_FOUND", "Protocol not found", nil)
+		return
+	}
+
+	common.SendJSON(w, http.StatusOK, schema)
+}
+
+// pluginResponse is a loaded plugin's manifest joined with its protocol's credential fields
+type pluginResponse struct {
+	*globals.PluginInfo
+	CredentialFields []protocols.CredentialField `json:"credential_fields"`
+	Stats            *globals.PluginStats        `json:"stats,omitempty"` // nil until first invocation
+}
+
+// ListPlugins handles GET /api/v1/plugins
+func (h *SystemHandler) ListPlugins(w http.ResponseWriter, r *http.Request) {
+	if h.Deps.Plugins == nil || h.Deps.Registry == nil {
+		common.SendError(w, r, http.StatusInternalServerError, "REGISTRY_ERROR", "Plugin manager not initialized", nil)
+		return
+	}
+
+	plugins := h.Deps.Plugins.List()
+	stats := h.Deps.Plugins.Stats()
+	sort.Slice(plugins, func(i, j int) bool { return plugins[i].Protocol < plugins[j].Protocol })
+
+	response := make([]pluginResponse, 0, len(plugins))
+	for _, p := range plugins {
+		// Plugins for protocols unknown to the registry are listed without fields
+		fields, err := h.Deps.Registry.CredentialFields(p.Protocol)
+		if err != nil {
+			fields = []protocols.CredentialField{}
+		}
+		resp := pluginResponse{PluginInfo: p, CredentialFields: fields}
+		if s, ok := stats[p.Protocol]; ok {
+			resp.Stats = &s
+		}
+		response = append(response, resp)
+	}
+
+	common.SendListResponse(w, response, len(response))
+}
@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/nmslite/nmslite/internal/api/common"
+	"github.com/nmslite/nmslite/internal/globals"
+	"github.com/nmslite/nmslite/internal/protocols"
+)
+
+type staticPlugins []*globals.PluginInfo
+
+func (p staticPlugins) List() []*globals.PluginInfo { return p }
+
+func (p staticPlugins) Stats() map[string]globals.PluginStats {
+	return map[string]globals.PluginStats{"windows-winrm": {Protocol: "windows-winrm", Invocations: 3}}
+}
+
+func TestSystemHandlerListPlugins(t *testing.T) {
+	h := NewSystemHandler(&common.Dependencies{
+		Registry: protocols.GetRegistry(),
+		Plugins: staticPlugins{
+			{ID: "windows-winrm", Name: "Windows Server (WinRM)", Version: "1.0.0", Protocol: "windows-winrm", DefaultPort: 5985},
+			{ID: "custom", Name: "Custom", Protocol: "custom"},
+		},
+	})
+
+	rec := httptest.NewRecorder()
+	h.ListPlugins(rec, httptest.NewRequest(http.MethodGet, "/api/v1/plugins", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", rec.Code)
+	}
+
+	var body struct {
+		Data []struct {
+			ID               string                      `json:"id"`
+			Protocol         string                      `json:"protocol"`
+			DefaultPort      int                         `json:"default_port"`
+			CredentialFields []protocols.CredentialField `json:"credential_fields"`
+			Stats            *globals.PluginStats        `json:"stats"`
+		} `json:"data"`
+		Total int `json:"total"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	if body.Total != 2 || len(body.Data) != 2 {
+		t.Fatalf("Expected 2 plugins, got %d", body.Total)
+	}
+
+	// Sorted by protocol: custom, windows-winrm
+	if body.Data[0].Protocol != "custom" || len(body.Data[0].CredentialFields) != 0 {
+		t.Errorf("Unknown protocol should be listed without fields, got %+v", body.Data[0])
+	}
+	winrm := body.Data[1]
+	if winrm.DefaultPort != 5985 || len(winrm.CredentialFields) != 6 {
+		t.Errorf("Expected WinRM manifest with 6 credential fields, got %+v", winrm)
+	}
+	if winrm.Stats == nil || winrm.Stats.Invocations != 3 {
+		t.Errorf("Expected WinRM stats with 3 invocations, got %+v", winrm.Stats)
+	}
+	if body.Data[0].Stats != nil {
+		t.Errorf("Never-invoked plugin should have no stats, got %+v", body.Data[0].Stats)
+	}
+}
+
+func TestSystemHandlerGetProtocolSchema(t *testing.T) {
+	h := NewSystemHandler(&common.Dependencies{Registry: protocols.GetRegistry()})
+
+	router := chi.NewRouter()
+	router.Get("/protocols/{protocol}/schema", h.GetProtocolSchema)
+
+	testCases := []struct {
+		name       string
+		protocol   string
+		wantStatus int
+	}{
+		{"Known protocol", "snmp-v3", http.StatusOK},
+		{"Unknown protocol", "telnet", http.StatusNotFound},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/protocols/"+tc.protocol+"/schema", nil))
+
+			if rec.Code != tc.wantStatus {
+				t.Errorf("Expected status %d, got %d", tc.wantStatus, rec.Code)
+			}
+		})
+	}
+}
@@ -0,0 +1,183 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/nmslite/nmslite/internal/api/auth"
+	"github.com/nmslite/nmslite/internal/api/common"
+	"github.com/nmslite/nmslite/internal/database/dbgen"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Password length bounds; bcrypt ignores bytes past 72
+const (
+	minPasswordLength = 8
+	maxPasswordLength = 72
+)
+
+// maxUsernameLength matches users.username
+const maxUsernameLength = 255
+
+// UserHandler manages API users and their roles
+type UserHandler struct {
+	Deps *common.Dependencies
+}
+
+func NewUserHandler(deps *common.Dependencies) *UserHandler {
+	return &UserHandler{Deps: deps}
+}
+
+// UserResponse is a stored user without its password hash
+type UserResponse struct {
+	ID        int64     `json:"id"`
+	Username  string    `json:"username"`
+	Role      string    `json:"role"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// CreateUserRequest is the body of POST /api/v1/users
+type CreateUserRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+	Role     string `json:"role"`
+}
+
+// userRoleRequest is the body of PUT /api/v1/users/{id}/role
+type userRoleRequest struct {
+	Role string `json:"role"`
+}
+
+func newUserResponse(u dbgen.User) UserResponse {
+	return UserResponse{ID: u.ID, Username: u.Username, Role: u.Role, CreatedAt: u.CreatedAt, UpdatedAt: u.UpdatedAt}
+}
+
+// validateRole checks role is one of auth.Roles
+func validateRole(role string) error {
+	if !auth.ValidRole(role) {
+		return fmt.Errorf("role must be one of %s", strings.Join(auth.Roles, ", "))
+	}
+	return nil
+}
+
+// List handles GET /api/v1/users
+func (h *UserHandler) List(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := common.QueryContext(r)
+	defer cancel()
+
+	users, err := h.Deps.Q.ListUsers(ctx)
+	if common.HandleDBError(w, r, err, "User") {
+		return
+	}
+	resp := make([]UserResponse, 0, len(users))
+	for _, u := range users {
+		resp = append(resp, newUserResponse(u))
+	}
+	common.SendListResponse(w, resp, len(resp))
+}
+
+// Create handles POST /api/v1/users
+func (h *UserHandler) Create(w http.ResponseWriter, r *http.Request) {
+	input, ok := common.DecodeJSON[CreateUserRequest](w, r)
+	if !ok {
+		return
+	}
+
+	input.Username = strings.TrimSpace(input.Username)
+	switch {
+	case input.Username == "" || len(input.Username) > maxUsernameLength:
+		common.SendError(w, r, http.StatusBadRequest, "VALIDATION_ERROR",
+			fmt.Sprintf("username must be 1 to %d characters", maxUsernameLength), nil)
+		return
+	case len(input.Password) < minPasswordLength || len(input.Password) > maxPasswordLength:
+		common.SendError(w, r, http.StatusBadRequest, "VALIDATION_ERROR",
+			fmt.Sprintf("password must be %d to %d bytes", minPasswordLength, maxPasswordLength), nil)
+		return
+	}
+	if err := validateRole(input.Role); err != nil {
+		common.SendError(w, r, http.StatusBadRequest, "VALIDATION_ERROR", err.Error(), nil)
+		return
+	}
+	if h.Deps.Auth != nil && h.Deps.Auth.IsAdminUsername(input.Username) {
+		common.SendError(w, r, http.StatusConflict, "USER_EXISTS", "Username is taken by the configured admin", nil)
+		return
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(input.Password), bcrypt.DefaultCost)
+	if err != nil {
+		common.SendError(w, r, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to hash password", nil)
+		return
+	}
+
+	ctx, cancel := common.QueryContext(r)
+	defer cancel()
+
+	user, err := h.Deps.Q.CreateUser(ctx, dbgen.CreateUserParams{
+		Username:     input.Username,
+		PasswordHash: string(hash),
+		Role:         input.Role,
+	})
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		common.SendError(w, r, http.StatusConflict, "USER_EXISTS", "Username is already taken", nil)
+		return
+	}
+	if common.HandleDBError(w, r, err, "User") {
+		return
+	}
+
+	common.SendJSON(w, http.StatusCreated, newUserResponse(user))
+}
+
+// SetRole handles PUT /api/v1/users/{id}/role. The new role applies to the user's
+// existing tokens from the next request on.
+func (h *UserHandler) SetRole(w http.ResponseWriter, r *http.Request) {
+	id, ok := common.ParseIDParam(w, r, "id")
+	if !ok {
+		return
+	}
+	input, ok := common.DecodeJSON[userRoleRequest](w, r)
+	if !ok {
+		return
+	}
+	if err := validateRole(input.Role); err != nil {
+		common.SendError(w, r, http.StatusBadRequest, "VALIDATION_ERROR", err.Error(), nil)
+		return
+	}
+
+	ctx, cancel := common.QueryContext(r)
+	defer cancel()
+
+	user, err := h.Deps.Q.UpdateUserRole(ctx, dbgen.UpdateUserRoleParams{ID: id, Role: input.Role})
+	if common.HandleDBError(w, r, err, "User") {
+		return
+	}
+	common.SendJSON(w, http.StatusOK, newUserResponse(user))
+}
+
+// Delete handles DELETE /api/v1/users/{id}. Tokens already issued to the user are
+// rejected from the next request on.
+func (h *UserHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	id, ok := common.ParseIDParam(w, r, "id")
+	if !ok {
+		return
+	}
+
+	ctx, cancel := common.QueryContext(r)
+	defer cancel()
+
+	rows, err := h.Deps.Q.DeleteUser(ctx, id)
+	if common.HandleDBError(w, r, err, "User") {
+		return
+	}
+	if rows == 0 {
+		common.SendError(w, r, http.StatusNotFound, "NOT_FOUND", "User not found", nil)
+		return
+	}
+	common.SendJSON(w, http.StatusNoContent, nil)
+}
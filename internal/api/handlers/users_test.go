@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nmslite/nmslite/internal/api/auth"
+	"github.com/nmslite/nmslite/internal/api/common"
+	"github.com/nmslite/nmslite/internal/globals"
+)
+
+func TestUserCreateAndLogin(t *testing.T) {
+	globals.SetGlobalConfigForTests(&globals.Config{})
+	authService, err := auth.NewService("0123456789abcdef0123456789abcdef", "0123456789abcdef0123456789abcdef", "admin", "admin-pass", time.Hour)
+	if err != nil {
+		t.Fatalf("Failed to create auth service: %v", err)
+	}
+	deps := &common.Dependencies{Q: newFakeQuerier(), Auth: authService}
+	users, system := NewUserHandler(deps), NewSystemHandler(deps)
+
+	createCases := []struct {
+		name       string
+		body       string
+		wantStatus int
+	}{
+		{"Viewer", `{"username":"alice","password":"correct horse","role":"viewer"}`, http.StatusCreated},
+		{"Unknown role", `{"username":"bob","password":"correct horse","role":"root"}`, http.StatusBadRequest},
+		{"Short password", `{"username":"bob","password":"short","role":"viewer"}`, http.StatusBadRequest},
+		{"Missing username", `{"password":"correct horse","role":"viewer"}`, http.StatusBadRequest},
+		{"Shadows the configured admin", `{"username":"admin","password":"correct horse","role":"viewer"}`, http.StatusConflict},
+	}
+	for _, tc := range createCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			users.Create(rec, httptest.NewRequest(http.MethodPost, "/api/v1/users", strings.NewReader(tc.body)))
+			if rec.Code != tc.wantStatus {
+				t.Errorf("Expected status %d, got %d (body: %s)", tc.wantStatus, rec.Code, rec.Body.String())
+			}
+			if strings.Contains(rec.Body.String(), "correct horse") || strings.Contains(rec.Body.String(), "password_hash") {
+				t.Errorf("Response must not include the password or its hash, got %s", rec.Body.String())
+			}
+		})
+	}
+
+	loginCases := []struct {
+		name       string
+		username   string
+		password   string
+		wantStatus int
+		wantRole   string
+	}{
+		{"Stored user", "alice", "correct horse", http.StatusOK, auth.RoleViewer},
+		{"Configured admin", "admin", "admin-pass", http.StatusOK, auth.RoleAdmin},
+		{"Wrong password", "alice", "wrong horse", http.StatusUnauthorized, ""},
+		{"Unknown user", "mallory", "correct horse", http.StatusUnauthorized, ""},
+	}
+	for _, tc := range loginCases {
+		t.Run("Login "+tc.name, func(t *testing.T) {
+			body, _ := json.Marshal(auth.LoginRequest{Username: tc.username, Password: tc.password})
+			rec := httptest.NewRecorder()
+			system.Login(rec, httptest.NewRequest(http.MethodPost, "/api/v1/login", strings.NewReader(string(body))))
+			if rec.Code != tc.wantStatus {
+				t.Fatalf("Expected status %d, got %d (body: %s)", tc.wantStatus, rec.Code, rec.Body.String())
+			}
+			if tc.wantRole == "" {
+				return
+			}
+			var resp auth.LoginResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			claims, err := authService.ValidateToken(resp.Token)
+			if err != nil {
+				t.Fatalf("Expected a valid token, got %v", err)
+			}
+			if claims.Role != tc.wantRole {
+				t.Errorf("Expected role %q, got %q", tc.wantRole, claims.Role)
+			}
+		})
+	}
+}
@@ -2,16 +2,44 @@ package api
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"time"
+
+	"github.com/nmslite/nmslite/internal/api/common"
+	"github.com/nmslite/nmslite/internal/globals"
 )
 
-// HealthHandler handles health check endpoints
-type HealthHandler struct{}
+// HealthHandler handles health check and metrics endpoints
+type HealthHandler struct {
+	breaker  *common.DBBreaker
+	polls    PollCounter
+	channels ChannelReporter
+	pipeline PipelineReporter
+}
+
+// PollCounter reports the scheduler's polls in flight, their global cap (0 = unlimited)
+// and how many successful polls had metrics that were not persisted
+type PollCounter interface {
+	InFlightPolls() int64
+	MaxInFlightPolls() int
+	WriteFailures() int64
+}
+
+// ChannelReporter reports event channel fill and slow-consumer warnings
+type ChannelReporter interface {
+	ChannelStats() []globals.ChannelStats
+}
 
-// NewHealthHandler creates a new health handler
-func NewHealthHandler() *HealthHandler {
-	return &HealthHandler{}
+// PipelineReporter reports the result of the latest metrics pipeline check
+type PipelineReporter interface {
+	PipelineHealth() globals.PipelineHealth
+}
+
+// NewHealthHandler creates a new health handler; polls may be nil when no scheduler runs,
+// channels when there are no event channels and pipeline when no pipeline check runs
+func NewHealthHandler(breaker *common.DBBreaker, polls PollCounter, channels ChannelReporter, pipeline PipelineReporter) *HealthHandler {
+	return &HealthHandler{breaker: breaker, polls: polls, channels: channels, pipeline: pipeline}
 }
 
 // HealthResponse represents the health check response
@@ -33,3 +61,79 @@ func (h *HealthHandler) Health(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(response)
 }
+
+// breakerStateValues maps breaker states to the nms_db_breaker_state gauge
+var breakerStateValues = map[string]int{
+	common.BreakerClosed:   0,
+	common.BreakerHalfOpen: 1,
+	common.BreakerOpen:     2,
+}
+
+// Metrics handles GET /metrics in the Prometheus text format
+//
+//goland:noinspection GoUnusedParameter
+func (h *HealthHandler) Metrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	w.WriteHeader(http.StatusOK)
+
+	fmt.Fprintln(w, "# HELP nms_db_breaker_state API database circuit breaker state (0 closed, 1 half-open, 2 open).")
+	fmt.Fprintln(w, "# TYPE nms_db_breaker_state gauge")
+	fmt.Fprintf(w, "nms_db_breaker_state %d\n", breakerStateValues[h.breaker.State()])
+	fmt.Fprintln(w, "# HELP nms_db_breaker_trips_total Times the API database circuit breaker has opened.")
+	fmt.Fprintln(w, "# TYPE nms_db_breaker_trips_total counter")
+	fmt.Fprintf(w, "nms_db_breaker_trips_total %d\n", h.breaker.Trips())
+	fmt.Fprintln(w, "# HELP nms_db_breaker_rejected_total API reads failed fast while the breaker was open.")
+	fmt.Fprintln(w, "# TYPE nms_db_breaker_rejected_total counter")
+	fmt.Fprintf(w, "nms_db_breaker_rejected_total %d\n", h.breaker.Rejected())
+
+	if h.channels != nil {
+		stats := h.channels.ChannelStats()
+		fmt.Fprintln(w, "# HELP nms_event_channel_length Events buffered in each event channel.")
+		fmt.Fprintln(w, "# TYPE nms_event_channel_length gauge")
+		for _, c := range stats {
+			fmt.Fprintf(w, "nms_event_channel_length{channel=%q} %d\n", c.Name, c.Length)
+		}
+		fmt.Fprintln(w, "# HELP nms_event_channel_capacity Buffer size of each event channel.")
+		fmt.Fprintln(w, "# TYPE nms_event_channel_capacity gauge")
+		for _, c := range stats {
+			fmt.Fprintf(w, "nms_event_channel_capacity{channel=%q} %d\n", c.Name, c.Capacity)
+		}
+		fmt.Fprintln(w, "# HELP nms_event_channel_slow_consumer_total Times a channel stayed above the high-water mark long enough to be reported.")
+		fmt.Fprintln(w, "# TYPE nms_event_channel_slow_consumer_total counter")
+		for _, c := range stats {
+			fmt.Fprintf(w, "nms_event_channel_slow_consumer_total{channel=%q} %d\n", c.Name, c.SlowWarnings)
+		}
+	}
+
+	if h.pipeline != nil {
+		health := h.pipeline.PipelineHealth()
+		degraded := 0
+		if health.Status == globals.PipelineDegraded {
+			degraded = 1
+		}
+		fmt.Fprintln(w, "# HELP nms_metrics_pipeline_degraded 1 when reachable monitors exist but no metric was written within the expected window.")
+		fmt.Fprintln(w, "# TYPE nms_metrics_pipeline_degraded gauge")
+		fmt.Fprintf(w, "nms_metrics_pipeline_degraded %d\n", degraded)
+		fmt.Fprintln(w, "# HELP nms_metrics_pipeline_polled_monitors Reachable monitors expected to produce metrics, as of the last check.")
+		fmt.Fprintln(w, "# TYPE nms_metrics_pipeline_polled_monitors gauge")
+		fmt.Fprintf(w, "nms_metrics_pipeline_polled_monitors %d\n", health.PolledMonitors)
+		if health.LatestMetric != nil {
+			fmt.Fprintln(w, "# HELP nms_metrics_pipeline_latest_metric_timestamp_seconds Unix time of the newest stored metric, as of the last check.")
+			fmt.Fprintln(w, "# TYPE nms_metrics_pipeline_latest_metric_timestamp_seconds gauge")
+			fmt.Fprintf(w, "nms_metrics_pipeline_latest_metric_timestamp_seconds %d\n", health.LatestMetric.Unix())
+		}
+	}
+
+	if h.polls == nil {
+		return
+	}
+	fmt.Fprintln(w, "# HELP nms_scheduler_in_flight_polls Monitors being polled right now across all plugins.")
+	fmt.Fprintln(w, "# TYPE nms_scheduler_in_flight_polls gauge")
+	fmt.Fprintf(w, "nms_scheduler_in_flight_polls %d\n", h.polls.InFlightPolls())
+	fmt.Fprintln(w, "# HELP nms_scheduler_max_in_flight_polls Cap on polls in flight (0 = unlimited).")
+	fmt.Fprintln(w, "# TYPE nms_scheduler_max_in_flight_polls gauge")
+	fmt.Fprintf(w, "nms_scheduler_max_in_flight_polls %d\n", h.polls.MaxInFlightPolls())
+	fmt.Fprintln(w, "# HELP nms_scheduler_metric_write_failures_total Successful polls whose metrics could not be persisted.")
+	fmt.Fprintln(w, "# TYPE nms_scheduler_metric_write_failures_total counter")
+	fmt.Fprintf(w, "nms_scheduler_metric_write_failures_total %d\n", h.polls.WriteFailures())
+}
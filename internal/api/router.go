@@ -9,22 +9,31 @@ import (
 	auth2 "github.com/nmslite/nmslite/internal/api/auth"
 	"github.com/nmslite/nmslite/internal/api/common"
 	"github.com/nmslite/nmslite/internal/api/handlers"
+	"github.com/nmslite/nmslite/internal/database"
 	"github.com/nmslite/nmslite/internal/database/dbgen"
 	"github.com/nmslite/nmslite/internal/discovery"
 	"github.com/nmslite/nmslite/internal/globals"
+	"github.com/nmslite/nmslite/internal/poller"
 	"github.com/nmslite/nmslite/internal/protocols"
 )
 
-// NewRouter NewRouter creates and configures the API router
-func NewRouter(authService *auth2.Service, db *pgxpool.Pool, events *globals.EventChannels, provisioner *discovery.Provisioner) http.Handler {
+// NewRouter NewRouter creates and configures the API router. The returned func stops the
+// router's background routines and must be called once the server has shut down.
+func NewRouter(authService *auth2.Service, db *pgxpool.Pool, events *globals.EventChannels, provisioner *discovery.Provisioner, pluginManager *poller.PluginManager, batchWriter *poller.BatchWriter, scheduler *poller.SchedulerImpl, discoveryWorker *discovery.Worker, pipelineCheck *poller.PipelineCheck) (http.Handler, func()) {
 	cfg := globals.GetConfig()
-	logger := slog.Default()
+	logger := slog.Default().With("component", "api")
 	r := chi.NewRouter()
 
 	// Apply middleware
 	r.Use(auth2.RequestID)
-	r.Use(auth2.Logger(slog.Default()))
-	r.Use(auth2.Recovery(slog.Default()))
+	r.Use(auth2.Logger(
+		logger,
+		globals.ParseLogLevel(cfg.Logging.AccessLog.Level),
+		cfg.Logging.AccessLog.SkipPaths,
+	))
+	r.Use(auth2.Recovery(logger))
+	r.Use(auth2.BodyLimit(cfg.Server.MaxBodySize()))
+	bulkBodyLimit := auth2.BodyLimit(cfg.Server.BulkMaxBodySize())
 
 	// CORS (if enabled)
 	if cfg.CORS.Enabled {
@@ -36,8 +45,36 @@ func NewRouter(authService *auth2.Service, db *pgxpool.Pool, events *globals.Eve
 		))
 	}
 
+	// Rate limiting (if enabled); pass-through otherwise
+	rateLimit := func(next http.Handler) http.Handler { return next }
+	closeRouter := func() {}
+	if cfg.RateLimit.Enabled {
+		routes := make([]auth2.RouteLimit, 0, len(cfg.RateLimit.Routes))
+		for _, rt := range cfg.RateLimit.Routes {
+			routes = append(routes, auth2.RouteLimit{
+				Method:            rt.Method,
+				Path:              rt.Path,
+				RequestsPerSecond: rt.RequestsPerSecond,
+				Burst:             rt.Burst,
+			})
+		}
+		limiter := auth2.NewRateLimiter(
+			cfg.RateLimit.RequestsPerSecond,
+			cfg.RateLimit.Burst,
+			routes,
+			cfg.RateLimit.IdleTTL(),
+		)
+		rateLimit = limiter.Middleware
+		closeRouter = limiter.Close
+	}
+
 	// Initialize dependencies
 	queries := dbgen.New(db)
+	// Without a database (tests) token roles are trusted as issued
+	var users auth2.UserStore
+	if db != nil {
+		users = queries
+	}
 	deps := &common.Dependencies{
 		Q:        queries,
 		Auth:     authService,
@@ -45,50 +82,135 @@ func NewRouter(authService *auth2.Service, db *pgxpool.Pool, events *globals.Eve
 		Registry: protocols.GetRegistry(),
 		Logger:   logger,
 	}
+	if pluginManager != nil {
+		deps.Plugins = pluginManager
+	}
+	if batchWriter != nil {
+		deps.Metrics = batchWriter
+		deps.MetricQueue = batchWriter
+	}
+	if scheduler != nil {
+		deps.Scheduler = scheduler
+		deps.Collectors = scheduler
+	}
+	if discoveryWorker != nil {
+		deps.Discovery = discoveryWorker
+	}
+	if pipelineCheck != nil {
+		deps.Pipeline = pipelineCheck
+	}
+	if db != nil {
+		deps.Pools = map[string]common.DatabasePool{"main": db}
+		if discoveryPool := database.GetDiscoveryPool(); discoveryPool != nil {
+			deps.Pools["discovery"] = discoveryPool
+		}
+		// Metrics and history reads go to the replica, failing over to db and skipping a
+		// failing replica with the same threshold and cooldown as the API breaker
+		if replicaPool := database.GetReplicaPool(); replicaPool != nil {
+			deps.Pools["replica"] = replicaPool
+			deps.ReplicaQ = dbgen.New(database.NewReadRouter(db, replicaPool,
+				cfg.Database.BreakerFailureThreshold, cfg.Database.BreakerCooldown()))
+		}
+	}
+
+	// Fail API reads fast while the database is struggling
+	dbBreaker := common.NewDBBreaker(cfg.Database.BreakerFailureThreshold, cfg.Database.BreakerCooldown())
 
 	// Initialize handlers
-	healthHandler := NewHealthHandler()
+	var polls PollCounter
+	if scheduler != nil {
+		polls = scheduler
+	}
+	var channels ChannelReporter
+	if events != nil {
+		channels = events
+	}
+	var pipeline PipelineReporter
+	if pipelineCheck != nil {
+		pipeline = pipelineCheck
+	}
+	healthHandler := NewHealthHandler(dbBreaker, polls, channels, pipeline)
 	systemHandler := handlers.NewSystemHandler(deps)
 	credentialHandler := handlers.NewCredentialHandler(deps)
 	discoveryHandler := handlers.NewDiscoveryHandler(deps)
+	deviceHandler := handlers.NewDeviceHandler(queries, provisioner)
 	monitorHandler := handlers.NewMonitorHandler(deps)
+	eventsHandler := handlers.NewEventsHandler(deps)
+	adminHandler := handlers.NewAdminHandler(deps)
+	userHandler := handlers.NewUserHandler(deps)
 
 	// Public routes (no auth required)
 	r.Get("/health", healthHandler.Health)
+	r.Get("/metrics", healthHandler.Metrics)
 
 	// API v1 routes
 	r.Route("/api/v1", func(r chi.Router) {
-		// Public auth endpoint
-		r.Post("/login", systemHandler.Login)
+		// Public auth endpoint (limited per client IP)
+		r.With(rateLimit).Post("/login", systemHandler.Login)
 
-		// Protected routes (require JWT)
+		// Protected routes (require JWT). Any role may read unless a route says otherwise;
+		// mutations need operator, and credentials, users and admin routes need admin.
 		r.Group(func(r chi.Router) {
-			r.Use(auth2.JWTAuth(authService))
+			r.Use(auth2.JWTAuth(authService, users))
+			r.Use(rateLimit)
 
-			// Credential Profiles
+			// Credential Profiles; reads return decrypted secrets
 			r.Route("/credentials", func(r chi.Router) {
+				r.Use(auth2.RequireRole(auth2.RoleOperator), auth2.RequireRoleToWrite(auth2.RoleAdmin))
+				r.Use(dbBreaker.GuardReads)
 				r.Get("/", credentialHandler.List)
 				r.Post("/", credentialHandler.Create)
 				r.Get("/{id}", credentialHandler.Get)
 				r.Put("/{id}", credentialHandler.Update)
+				r.Patch("/{id}", credentialHandler.Update)
 				r.Delete("/{id}", credentialHandler.Delete)
+				r.Post("/{id}/restore", credentialHandler.Restore)
+				r.Post("/{id}/test", credentialHandler.Test)
 			})
 
 			// Discovery Profiles
 			r.Route("/discoveries", func(r chi.Router) {
+				r.Use(auth2.RequireRoleToWrite(auth2.RoleOperator))
+				r.Use(dbBreaker.GuardReads)
 				r.Get("/", discoveryHandler.List)
 				r.Post("/", discoveryHandler.Create)
+				r.Get("/jobs/{jobID}", discoveryHandler.GetJob)
+				r.Post("/preview", discoveryHandler.Preview)
 				r.Get("/{id}", discoveryHandler.Get)
 				r.Put("/{id}", discoveryHandler.Update)
 				r.Delete("/{id}", discoveryHandler.Delete)
+				r.Post("/{id}/restore", discoveryHandler.Restore)
 				r.Post("/{id}/run", discoveryHandler.Run)
 				r.Get("/{id}/results", discoveryHandler.GetResults)
+				r.Get("/{id}/diff", discoveryHandler.Diff)
+				r.Get("/{id}/runs", discoveryHandler.Runs)
 			})
 
+			// Fleet-wide inventory of what discovery has found, across profiles
+			r.With(auth2.RequireRoleToWrite(auth2.RoleOperator), dbBreaker.GuardReads).Get("/discovered-devices", discoveryHandler.ListDevices)
+			r.With(auth2.RequireRoleToWrite(auth2.RoleOperator)).Post("/discovered-devices/provision", deviceHandler.ProvisionMany)
+
 			// Monitors (Devices)
 			r.Route("/monitors", func(r chi.Router) {
+				r.Use(auth2.RequireRoleToWrite(auth2.RoleOperator))
+				r.Use(dbBreaker.GuardReads)
 				r.Get("/", monitorHandler.List)
 				r.Post("/", monitorHandler.Create)
+				r.Get("/archived", monitorHandler.ListArchived)
+				r.Get("/groups", monitorHandler.ListGroups)
+				r.Post("/{id}/restore", monitorHandler.Restore)
+				r.Get("/{id}/metrics/latest", monitorHandler.LatestMetrics)
+				r.Get("/{id}/history", monitorHandler.History)
+				r.Get("/{id}/uptime", monitorHandler.Uptime)
+				r.Get("/{id}/effective", monitorHandler.Effective)
+				r.Get("/{id}/groups", monitorHandler.GetGroups)
+				r.Put("/{id}/groups", monitorHandler.SetGroups)
+				r.Put("/{id}/groups/{group}", monitorHandler.AddToGroup)
+				r.Delete("/{id}/groups/{group}", monitorHandler.RemoveFromGroup)
+				r.Get("/{id}/host-key", monitorHandler.GetHostKey)
+				r.Put("/{id}/host-key", monitorHandler.SetHostKeyTracking)
+				r.Post("/{id}/host-key/accept", monitorHandler.AcceptHostKey)
+				r.With(bulkBodyLimit).Post("/{id}/metrics", monitorHandler.IngestMetrics)
 				r.Get("/{id}", monitorHandler.Get)
 				r.Patch("/{id}", monitorHandler.Update)
 				r.Delete("/{id}", monitorHandler.Delete)
@@ -96,17 +218,52 @@ func NewRouter(authService *auth2.Service, db *pgxpool.Pool, events *globals.Eve
 			})
 
 			// Devices (discovered devices)
-			r.Mount("/devices", handlers.NewDeviceHandler(queries, provisioner).Routes())
+			r.With(auth2.RequireRoleToWrite(auth2.RoleOperator), dbBreaker.GuardReads).Mount("/devices", deviceHandler.Routes())
 
-			// Metrics queries (batch)
-			r.Post("/metrics/query", monitorHandler.QueryMetrics)
+			// Metrics queries (batch); a read despite the POST
+			r.With(dbBreaker.Guard, bulkBodyLimit).Post("/metrics/query", monitorHandler.QueryMetrics)
 
 			// Protocols
 			r.Route("/protocols", func(r chi.Router) {
 				r.Get("/", systemHandler.ListProtocols)
+				r.Get("/{protocol}/schema", systemHandler.GetProtocolSchema)
+			})
+
+			// Live monitor state and discovery events (SSE)
+			r.Get("/events/stream", eventsHandler.Stream)
+
+			// Structured health of every subsystem, for operators
+			r.Get("/status", systemHandler.Status)
+
+			// Installed plugins with their credential fields
+			r.Get("/plugins", systemHandler.ListPlugins)
+
+			r.Route("/admin", func(r chi.Router) {
+				r.Use(auth2.RequireRole(auth2.RoleAdmin))
+
+				// Scheduler inspection for debugging polling
+				r.Route("/scheduler", func(r chi.Router) {
+					r.Get("/", adminHandler.SchedulerState)
+					r.Post("/reload", adminHandler.ReloadScheduler)
+				})
+
+				// Checks every stored secret still decrypts, e.g. after an encryption key change
+				r.Post("/credentials/verify", adminHandler.VerifyCredentials)
+
+				// Recently dropped events, when channel.record_dropped_events is on
+				r.Get("/events/dropped", adminHandler.DroppedEvents)
+			})
+
+			// API users and role assignment
+			r.Route("/users", func(r chi.Router) {
+				r.Use(auth2.RequireRole(auth2.RoleAdmin))
+				r.Get("/", userHandler.List)
+				r.Post("/", userHandler.Create)
+				r.Put("/{id}/role", userHandler.SetRole)
+				r.Delete("/{id}", userHandler.Delete)
 			})
 		})
 	})
 
-	return r
+	return r, closeRouter
 }
@@ -0,0 +1,212 @@
+package api
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nmslite/nmslite/internal/api/auth"
+	"github.com/nmslite/nmslite/internal/api/common"
+	"github.com/nmslite/nmslite/internal/globals"
+)
+
+func TestRouterCORSConfig(t *testing.T) {
+	testCases := []struct {
+		name       string
+		enabled    bool
+		wantStatus int
+		wantOrigin string
+	}{
+		{"Enabled answers preflight", true, http.StatusNoContent, "https://app.example.com"},
+		{"Disabled adds no headers", false, http.StatusMethodNotAllowed, ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			globals.SetGlobalConfigForTests(&globals.Config{
+				CORS: globals.CORSConfig{
+					Enabled:        tc.enabled,
+					AllowedOrigins: []string{"https://app.example.com"},
+					AllowedMethods: []string{"GET"},
+					AllowedHeaders: []string{"Authorization"},
+					MaxAgeSeconds:  3600,
+				},
+			})
+
+			router, _ := NewRouter(nil, nil, nil, nil, nil, nil, nil, nil, nil)
+
+			req := httptest.NewRequest(http.MethodOptions, "/health", nil)
+			req.Header.Set("Origin", "https://app.example.com")
+			req.Header.Set("Access-Control-Request-Method", "GET")
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+
+			if rec.Code != tc.wantStatus {
+				t.Errorf("Expected status %d, got %d", tc.wantStatus, rec.Code)
+			}
+			if got := rec.Header().Get("Access-Control-Allow-Origin"); got != tc.wantOrigin {
+				t.Errorf("Expected Allow-Origin %q, got %q", tc.wantOrigin, got)
+			}
+			if !tc.enabled {
+				for key := range rec.Header() {
+					if strings.HasPrefix(key, "Access-Control-") {
+						t.Errorf("Disabled CORS should not set %s", key)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestRouterMetricsExposesBreaker(t *testing.T) {
+	globals.SetGlobalConfigForTests(&globals.Config{})
+
+	router, _ := NewRouter(nil, nil, nil, nil, nil, nil, nil, nil, nil)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", rec.Code)
+	}
+	if !strings.Contains(rec.Body.String(), "nms_db_breaker_state 0") {
+		t.Errorf("Expected closed breaker state in metrics, got:\n%s", rec.Body.String())
+	}
+	if strings.Contains(rec.Body.String(), "nms_scheduler_in_flight_polls") {
+		t.Errorf("Expected no scheduler metrics without a scheduler, got:\n%s", rec.Body.String())
+	}
+}
+
+// stalledPipeline reports a degraded metrics pipeline
+type stalledPipeline struct{}
+
+func (stalledPipeline) PipelineHealth() globals.PipelineHealth {
+	latest := time.Unix(1700000000, 0)
+	return globals.PipelineHealth{Status: globals.PipelineDegraded, PolledMonitors: 3, LatestMetric: &latest}
+}
+
+func TestHealthHandlerMetricsExposesPipeline(t *testing.T) {
+	h := NewHealthHandler(common.NewDBBreaker(5, time.Second), nil, nil, stalledPipeline{})
+	rec := httptest.NewRecorder()
+	h.Metrics(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	for _, want := range []string{
+		"nms_metrics_pipeline_degraded 1",
+		"nms_metrics_pipeline_polled_monitors 3",
+		"nms_metrics_pipeline_latest_metric_timestamp_seconds 1700000000",
+	} {
+		if !strings.Contains(rec.Body.String(), want) {
+			t.Errorf("Expected %q in metrics, got:\n%s", want, rec.Body.String())
+		}
+	}
+}
+
+// busyScheduler reports fixed poll counters
+type busyScheduler struct{}
+
+func (busyScheduler) InFlightPolls() int64  { return 4 }
+func (busyScheduler) MaxInFlightPolls() int { return 10 }
+func (busyScheduler) WriteFailures() int64  { return 7 }
+
+func TestHealthHandlerMetricsExposesWriteFailures(t *testing.T) {
+	h := NewHealthHandler(common.NewDBBreaker(5, time.Second), busyScheduler{}, nil, nil)
+	rec := httptest.NewRecorder()
+	h.Metrics(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	for _, want := range []string{
+		"nms_scheduler_in_flight_polls 4",
+		"nms_scheduler_metric_write_failures_total 7",
+	} {
+		if !strings.Contains(rec.Body.String(), want) {
+			t.Errorf("Expected %q in metrics, got:\n%s", want, rec.Body.String())
+		}
+	}
+}
+
+func TestRouterRejectsOversizedBody(t *testing.T) {
+	globals.SetGlobalConfigForTests(&globals.Config{Server: globals.ServerConfig{MaxBodyBytes: 64}})
+	router, _ := NewRouter(nil, nil, nil, nil, nil, nil, nil, nil, nil)
+
+	body := `{"username":"admin","password":"` + strings.Repeat("x", 128) + `"}`
+	testCases := []struct {
+		name          string
+		contentLength bool
+	}{
+		{"Declared length", true},
+		{"Chunked", false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/login", strings.NewReader(body))
+			if !tc.contentLength {
+				// Hide the length so the limit is only hit while decoding
+				req.Body = io.NopCloser(strings.NewReader(body))
+				req.ContentLength = -1
+			}
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusRequestEntityTooLarge {
+				t.Fatalf("Expected status 413, got %d (body: %s)", rec.Code, rec.Body.String())
+			}
+			if !strings.Contains(rec.Body.String(), "PAYLOAD_TOO_LARGE") {
+				t.Errorf("Expected PAYLOAD_TOO_LARGE error, got %s", rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestRouterEnforcesRoles(t *testing.T) {
+	globals.SetGlobalConfigForTests(&globals.Config{})
+	authService, err := auth.NewService("0123456789abcdef0123456789abcdef", "0123456789abcdef0123456789abcdef", "admin", "admin", time.Hour)
+	if err != nil {
+		t.Fatalf("Failed to create auth service: %v", err)
+	}
+	router, _ := NewRouter(authService, nil, nil, nil, nil, nil, nil, nil, nil)
+
+	token := func(role string) string {
+		resp, err := authService.IssueToken(role+"-user", role)
+		if err != nil {
+			t.Fatalf("Failed to issue token: %v", err)
+		}
+		return resp.Token
+	}
+
+	// Requests that pass the role check fail later (no scheduler, invalid bodies) without a database
+	testCases := []struct {
+		name       string
+		role       string
+		method     string
+		path       string
+		body       string
+		wantStatus int
+	}{
+		{"Viewer reads protocols", auth.RoleViewer, http.MethodGet, "/api/v1/protocols", "", http.StatusOK},
+		{"Viewer cannot create monitors", auth.RoleViewer, http.MethodPost, "/api/v1/monitors", "{", http.StatusForbidden},
+		{"Viewer cannot delete discoveries", auth.RoleViewer, http.MethodDelete, "/api/v1/discoveries/1", "", http.StatusForbidden},
+		{"Viewer cannot read credentials", auth.RoleViewer, http.MethodGet, "/api/v1/credentials", "", http.StatusForbidden},
+		{"Viewer cannot inspect the scheduler", auth.RoleViewer, http.MethodGet, "/api/v1/admin/scheduler", "", http.StatusForbidden},
+		{"Operator creates monitors", auth.RoleOperator, http.MethodPost, "/api/v1/monitors", "{", http.StatusBadRequest},
+		{"Operator cannot create credentials", auth.RoleOperator, http.MethodPost, "/api/v1/credentials", "{", http.StatusForbidden},
+		{"Operator cannot manage users", auth.RoleOperator, http.MethodPost, "/api/v1/users", "{}", http.StatusForbidden},
+		{"Admin creates credentials", auth.RoleAdmin, http.MethodPost, "/api/v1/credentials", "{", http.StatusBadRequest},
+		{"Admin manages users", auth.RoleAdmin, http.MethodPost, "/api/v1/users", "{}", http.StatusBadRequest},
+		{"Admin inspects the scheduler", auth.RoleAdmin, http.MethodGet, "/api/v1/admin/scheduler", "", http.StatusServiceUnavailable},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, tc.path, strings.NewReader(tc.body))
+			req.Header.Set("Authorization", "Bearer "+token(tc.role))
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+
+			if rec.Code != tc.wantStatus {
+				t.Errorf("Expected status %d, got %d (body: %s)", tc.wantStatus, rec.Code, rec.Body.String())
+			}
+		})
+	}
+}
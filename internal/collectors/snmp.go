@@ -0,0 +1,195 @@
+package collectors
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/gosnmp/gosnmp"
+	"github.com/nmslite/nmslite/internal/api/auth"
+	"github.com/nmslite/nmslite/internal/discovery"
+	"github.com/nmslite/nmslite/internal/globals"
+)
+
+// IF-MIB and SNMPv2-MIB objects read by SNMPCollector
+const (
+	oidSysUpTime    = ".1.3.6.1.2.1.1.3.0"
+	oidIfDescr      = ".1.3.6.1.2.1.2.2.1.2"
+	oidIfOperStatus = ".1.3.6.1.2.1.2.2.1.8"
+	oidIfInOctets   = ".1.3.6.1.2.1.2.2.1.10"
+	oidIfInErrors   = ".1.3.6.1.2.1.2.2.1.14"
+	oidIfOutOctets  = ".1.3.6.1.2.1.2.2.1.16"
+	oidIfOutErrors  = ".1.3.6.1.2.1.2.2.1.20"
+	oidIfName       = ".1.3.6.1.2.1.31.1.1.1.1"
+	oidIfHCIn       = ".1.3.6.1.2.1.31.1.1.1.6"
+	oidIfHCOut      = ".1.3.6.1.2.1.31.1.1.1.10"
+)
+
+// ifOperStatusUp is IF-MIB's ifOperStatus value for "up"
+const ifOperStatusUp = 1
+
+// ifColumns are walked in this order; 64-bit counters replace the 32-bit ones when present
+var ifColumns = []string{
+	oidIfDescr, oidIfName, oidIfOperStatus,
+	oidIfInOctets, oidIfOutOctets, oidIfHCIn, oidIfHCOut,
+	oidIfInErrors, oidIfOutErrors,
+}
+
+// ifCounterUnits is the unit of each per-interface counter metric
+var ifCounterUnits = map[string]string{
+	"bytes_recv": "bytes",
+	"bytes_sent": "bytes",
+	"errors_in":  "errors",
+	"errors_out": "errors",
+}
+
+// SNMPCollector collects sysUpTime and per-interface IF-MIB counters
+type SNMPCollector struct {
+	protocol string // "snmp-v1", "snmp-v2c" or "snmp-v3"
+}
+
+// NewSNMPCollector creates an SNMPCollector for the "snmp-v1", "snmp-v2c" or "snmp-v3" protocol
+func NewSNMPCollector(protocol string) *SNMPCollector {
+	return &SNMPCollector{protocol: protocol}
+}
+
+// Collect reads sysUpTime and walks the interface table
+func (c *SNMPCollector) Collect(ctx context.Context, _ int64, target string, port int, creds auth.Credentials) ([]globals.PollResult, error) {
+	g, err := discovery.NewSNMPClient(target, port, c.protocol, &creds, timeoutFor(ctx))
+	if err != nil {
+		return nil, err
+	}
+	g.Context = ctx
+	if err := g.Connect(); err != nil {
+		return nil, fmt.Errorf("snmp connect: %w", err)
+	}
+	defer g.Conn.Close()
+
+	var metrics []interface{}
+	if packet, err := g.Get([]string{oidSysUpTime}); err == nil && len(packet.Variables) == 1 {
+		if ticks := gosnmp.ToBigInt(packet.Variables[0].Value); ticks.Sign() > 0 {
+			metrics = append(metrics, metric("system.uptime_seconds", float64(ticks.Uint64())/100, "gauge", "seconds"))
+		}
+	} else if err != nil {
+		return nil, fmt.Errorf("snmp get sysUpTime: %w", err)
+	}
+
+	// SNMPv1 has no GetBulk; walk with GetNext instead. v1 agents also never return the
+	// Counter64 ifHC columns, so the 32-bit counters are used.
+	walk := g.BulkWalkAll
+	if g.Version == gosnmp.Version1 {
+		walk = g.WalkAll
+	}
+
+	columns := make(map[string][]gosnmp.SnmpPDU, len(ifColumns))
+	for _, column := range ifColumns {
+		// Devices without ifXTable answer with nothing or an error; the 32-bit columns remain
+		pdus, err := walk(column)
+		if err != nil && ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		columns[column] = pdus
+	}
+
+	metrics = append(metrics, interfaceMetrics(columns)...)
+	return []globals.PollResult{successResult(metrics)}, nil
+}
+
+// snmpInterface is one row of the interface table
+type snmpInterface struct {
+	index    string
+	name     string
+	up       bool
+	counters map[string]float64 // metric suffix -> value
+}
+
+// interfaceMetrics turns walked IF-MIB columns into per-interface metrics named after
+// ifName, falling back to ifDescr and then the row index
+func interfaceMetrics(columns map[string][]gosnmp.SnmpPDU) []interface{} {
+	rows := make(map[string]*snmpInterface)
+	var order []string
+	row := func(index string) *snmpInterface {
+		r, ok := rows[index]
+		if !ok {
+			r = &snmpInterface{index: index, counters: make(map[string]float64)}
+			rows[index] = r
+			order = append(order, index)
+		}
+		return r
+	}
+
+	for _, column := range ifColumns {
+		for _, pdu := range columns[column] {
+			index := strings.TrimPrefix(pdu.Name, column+".")
+			if index == pdu.Name {
+				continue
+			}
+			r := row(index)
+			switch column {
+			case oidIfDescr:
+				if r.name == "" {
+					r.name = pduString(pdu)
+				}
+			case oidIfName:
+				if name := pduString(pdu); name != "" {
+					r.name = name
+				}
+			case oidIfOperStatus:
+				r.up = gosnmp.ToBigInt(pdu.Value).Int64() == ifOperStatusUp
+			case oidIfInOctets, oidIfHCIn:
+				r.counters["bytes_recv"] = counterValue(pdu)
+			case oidIfOutOctets, oidIfHCOut:
+				r.counters["bytes_sent"] = counterValue(pdu)
+			case oidIfInErrors:
+				r.counters["errors_in"] = counterValue(pdu)
+			case oidIfOutErrors:
+				r.counters["errors_out"] = counterValue(pdu)
+			}
+		}
+	}
+
+	var metrics []interface{}
+	for _, index := range order {
+		r := rows[index]
+		name := metricSegment(r.name)
+		if name == "" {
+			name = "if" + index
+		}
+
+		up := 0.0
+		if r.up {
+			up = 1
+		}
+		metrics = append(metrics, metric(fmt.Sprintf("network.%s.oper_up", name), up, "gauge", ""))
+		for _, suffix := range []string{"bytes_recv", "bytes_sent", "errors_in", "errors_out"} {
+			if value, ok := r.counters[suffix]; ok {
+				metrics = append(metrics, metric(fmt.Sprintf("network.%s.%s", name, suffix), value, "counter", ifCounterUnits[suffix]))
+			}
+		}
+	}
+	return metrics
+}
+
+// pduString returns an OctetString value as text
+func pduString(pdu gosnmp.SnmpPDU) string {
+	if b, ok := pdu.Value.([]byte); ok {
+		return strings.TrimRight(string(b), "\x00")
+	}
+	return ""
+}
+
+// counterValue returns a Counter32/Counter64 value as a float
+func counterValue(pdu gosnmp.SnmpPDU) float64 {
+	return float64(gosnmp.ToBigInt(pdu.Value).Uint64())
+}
+
+// metricSegment makes an interface name safe as one dotted metric name segment
+func metricSegment(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case '.', ' ', '/', '\\':
+			return '_'
+		}
+		return r
+	}, strings.TrimSpace(name))
+}
@@ -0,0 +1,57 @@
+package collectors
+
+import (
+	"testing"
+
+	"github.com/gosnmp/gosnmp"
+)
+
+func TestInterfaceMetrics(t *testing.T) {
+	pdu := func(column, index string, typ gosnmp.Asn1BER, value interface{}) gosnmp.SnmpPDU {
+		return gosnmp.SnmpPDU{Name: column + "." + index, Type: typ, Value: value}
+	}
+	columns := map[string][]gosnmp.SnmpPDU{
+		oidIfDescr: {
+			pdu(oidIfDescr, "1", gosnmp.OctetString, []byte("Loopback")),
+			pdu(oidIfDescr, "2", gosnmp.OctetString, []byte("Intel Ethernet 1.0")),
+			pdu(oidIfDescr, "3", gosnmp.OctetString, []byte("")),
+		},
+		oidIfName: {
+			pdu(oidIfName, "1", gosnmp.OctetString, []byte("lo")),
+		},
+		oidIfOperStatus: {
+			pdu(oidIfOperStatus, "1", gosnmp.Integer, 1),
+			pdu(oidIfOperStatus, "2", gosnmp.Integer, 2),
+			pdu(oidIfOperStatus, "3", gosnmp.Integer, 1),
+		},
+		oidIfInOctets: {
+			pdu(oidIfInOctets, "1", gosnmp.Counter32, uint(100)),
+			pdu(oidIfInOctets, "2", gosnmp.Counter32, uint(200)),
+		},
+		oidIfHCIn: {
+			pdu(oidIfHCIn, "1", gosnmp.Counter64, uint64(5000000000)),
+		},
+		oidIfOutErrors: {
+			pdu(oidIfOutErrors, "2", gosnmp.Counter32, uint(7)),
+		},
+	}
+
+	got := metricValues(t, interfaceMetrics(columns))
+
+	want := map[string]float64{
+		"network.lo.oper_up":                    1,
+		"network.lo.bytes_recv":                 5000000000,
+		"network.Intel_Ethernet_1_0.oper_up":    0,
+		"network.Intel_Ethernet_1_0.bytes_recv": 200,
+		"network.Intel_Ethernet_1_0.errors_out": 7,
+		"network.if3.oper_up":                   1,
+	}
+	if len(got) != len(want) {
+		t.Errorf("Expected %d metrics, got %d: %v", len(want), len(got), got)
+	}
+	for name, value := range want {
+		if v, ok := got[name]; !ok || v != value {
+			t.Errorf("Expected %s = %v, got %v (present=%v)", name, value, v, ok)
+		}
+	}
+}
@@ -0,0 +1,222 @@
+// Package collectors implements the in-process poller.Collector for protocols that ship
+// without a plugin binary: uptime, load and disk usage over SSH, and interface counters
+// from IF-MIB over SNMP.
+package collectors
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/nmslite/nmslite/internal/api/auth"
+	"github.com/nmslite/nmslite/internal/database/dbgen"
+	"github.com/nmslite/nmslite/internal/discovery"
+	"github.com/nmslite/nmslite/internal/globals"
+	"golang.org/x/crypto/ssh"
+)
+
+// defaultTimeout bounds connection setup when the poll context has no deadline
+const defaultTimeout = 10 * time.Second
+
+// sshSectionMarker separates the outputs of sshCommand
+const sshSectionMarker = "--nmslite--"
+
+// sshCommand prints uptime and load from procfs, then POSIX df output in KiB. Each part may
+// fail on its own (e.g. no procfs); the sections that parse still produce metrics.
+const sshCommand = "cat /proc/uptime; echo " + sshSectionMarker + "; cat /proc/loadavg; echo " + sshSectionMarker + "; df -kP"
+
+// pseudoFilesystems are df sources that do not describe real storage
+var pseudoFilesystems = map[string]bool{
+	"tmpfs": true, "devtmpfs": true, "udev": true, "none": true, "overlay": true, "shm": true,
+}
+
+// HostKeyStore looks up the host key pinned for a monitor (dbgen.Querier outside tests)
+type HostKeyStore interface {
+	GetMonitorHostKey(ctx context.Context, monitorID int64) (dbgen.MonitorHostKey, error)
+}
+
+// SSHCollector collects uptime, load averages and disk usage from Unix hosts over SSH
+type SSHCollector struct {
+	hostKeys HostKeyStore
+}
+
+// NewSSHCollector creates an SSHCollector. Monitors opted in to host key verification
+// are only polled while the server presents the key trusted in hostKeys; nil trusts any key.
+func NewSSHCollector(hostKeys HostKeyStore) *SSHCollector {
+	return &SSHCollector{hostKeys: hostKeys}
+}
+
+// Collect runs sshCommand on the target and parses its output. A host key other than the
+// pinned one fails with discovery.ErrHostKeyMismatch before credentials are sent.
+func (c *SSHCollector) Collect(ctx context.Context, monitorID int64, target string, port int, creds auth.Credentials) ([]globals.PollResult, error) {
+	pinned, err := c.pinnedFingerprint(ctx, monitorID)
+	if err != nil {
+		return nil, err
+	}
+	client, err := discovery.DialSSH(target, port, &creds, pinned, timeoutFor(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("ssh connect: %w", err)
+	}
+	defer client.Close()
+
+	// Dial has its own timeout; closing the client ends a command still running at the deadline
+	stop := context.AfterFunc(ctx, func() { client.Close() })
+	defer stop()
+
+	session, err := client.NewSession()
+	if err != nil {
+		return nil, fmt.Errorf("ssh session: %w", err)
+	}
+	defer session.Close()
+
+	var stdout bytes.Buffer
+	session.Stdout = &stdout
+	err = session.Run(sshCommand)
+	var exitErr *ssh.ExitError
+	if err != nil && !errors.As(err, &exitErr) {
+		// A non-zero exit only means one of the commands failed
+		return nil, fmt.Errorf("ssh command: %w", err)
+	}
+
+	metrics := parseSSHOutput(stdout.String())
+	if len(metrics) == 0 {
+		return nil, fmt.Errorf("no metrics in command output")
+	}
+	return []globals.PollResult{successResult(metrics)}, nil
+}
+
+// pinnedFingerprint returns the trusted host key fingerprint of a monitor opted in to
+// verification, or "" when there is none yet
+func (c *SSHCollector) pinnedFingerprint(ctx context.Context, monitorID int64) (string, error) {
+	if c.hostKeys == nil {
+		return "", nil
+	}
+	hostKey, err := c.hostKeys.GetMonitorHostKey(ctx, monitorID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("host key lookup: %w", err)
+	}
+	if !hostKey.Enabled || !hostKey.Fingerprint.Valid {
+		return "", nil
+	}
+	return hostKey.Fingerprint.String, nil
+}
+
+// parseSSHOutput turns sshCommand output into metric objects, skipping unparsable sections
+func parseSSHOutput(out string) []interface{} {
+	sections := strings.Split(out, sshSectionMarker+"\n")
+	for len(sections) < 3 {
+		sections = append(sections, "")
+	}
+
+	var metrics []interface{}
+
+	// /proc/uptime: "<seconds up> <seconds idle>"
+	if fields := strings.Fields(sections[0]); len(fields) >= 1 {
+		if uptime, err := strconv.ParseFloat(fields[0], 64); err == nil {
+			metrics = append(metrics, metric("system.uptime_seconds", uptime, "gauge", "seconds"))
+		}
+	}
+
+	// /proc/loadavg: "<1m> <5m> <15m> <running/total> <last pid>"
+	if fields := strings.Fields(sections[1]); len(fields) >= 3 {
+		for i, window := range []string{"1", "5", "15"} {
+			if load, err := strconv.ParseFloat(fields[i], 64); err == nil {
+				metrics = append(metrics, metric("system.load."+window, load, "gauge", ""))
+			}
+		}
+	}
+
+	return append(metrics, parseDF(sections[2])...)
+}
+
+// parseDF reads `df -kP` rows: filesystem, 1024-blocks, used, available, capacity, mount
+func parseDF(out string) []interface{} {
+	var metrics []interface{}
+	var aggTotal, aggUsed, aggFree float64
+
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 6 || fields[0] == "Filesystem" || pseudoFilesystems[fields[0]] {
+			continue
+		}
+		blocks, err1 := strconv.ParseFloat(fields[1], 64)
+		used, err2 := strconv.ParseFloat(fields[2], 64)
+		avail, err3 := strconv.ParseFloat(fields[3], 64)
+		if err1 != nil || err2 != nil || err3 != nil || blocks == 0 {
+			continue
+		}
+
+		total, usedBytes, freeBytes := blocks*1024, used*1024, avail*1024
+		name := diskName(strings.Join(fields[5:], " "))
+		metrics = append(metrics,
+			metric(fmt.Sprintf("system.disk.%s.total_bytes", name), total, "gauge", "bytes"),
+			metric(fmt.Sprintf("system.disk.%s.used_bytes", name), usedBytes, "gauge", "bytes"),
+			metric(fmt.Sprintf("system.disk.%s.free_bytes", name), freeBytes, "gauge", "bytes"),
+			metric(fmt.Sprintf("system.disk.%s.usage_percent", name), usagePercent(usedBytes, freeBytes), "gauge", "percent"),
+		)
+		aggTotal += total
+		aggUsed += usedBytes
+		aggFree += freeBytes
+	}
+
+	if len(metrics) > 0 {
+		metrics = append(metrics,
+			metric("system.disk.total_bytes", aggTotal, "gauge", "bytes"),
+			metric("system.disk.used_bytes", aggUsed, "gauge", "bytes"),
+			metric("system.disk.free_bytes", aggFree, "gauge", "bytes"),
+			metric("system.disk.usage_percent", usagePercent(aggUsed, aggFree), "gauge", "percent"),
+		)
+	}
+	return metrics
+}
+
+// usagePercent is used space over space available to users, as df reports capacity
+func usagePercent(used, free float64) float64 {
+	if used+free == 0 {
+		return 0
+	}
+	return used / (used + free) * 100
+}
+
+// diskName turns a mount point into a metric name segment: "/" is "root", "/var/lib" is "var_lib"
+func diskName(mount string) string {
+	name := strings.ReplaceAll(strings.Trim(mount, "/"), "/", "_")
+	if name == "" {
+		return "root"
+	}
+	return name
+}
+
+// metric builds a metric object in the shape plugins emit; an empty unit is left out
+func metric(name string, value float64, metricType, unit string) map[string]interface{} {
+	m := map[string]interface{}{"name": name, "value": value, "type": metricType}
+	if unit != "" {
+		m["unit"] = unit
+	}
+	return m
+}
+
+// successResult wraps metrics in a successful poll result
+func successResult(metrics []interface{}) globals.PollResult {
+	return globals.PollResult{
+		Status:    "success",
+		Timestamp: time.Now().UTC().Format(time.RFC3339),
+		Metrics:   metrics,
+	}
+}
+
+// timeoutFor returns the time left before ctx's deadline, or defaultTimeout without one
+func timeoutFor(ctx context.Context) time.Duration {
+	if deadline, ok := ctx.Deadline(); ok {
+		return max(time.Until(deadline), time.Millisecond)
+	}
+	return defaultTimeout
+}
@@ -0,0 +1,182 @@
+package collectors
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"net"
+	"sync/atomic"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/nmslite/nmslite/internal/api/auth"
+	"github.com/nmslite/nmslite/internal/database/dbgen"
+	"github.com/nmslite/nmslite/internal/discovery"
+	"golang.org/x/crypto/ssh"
+)
+
+// metricValues indexes metric objects by name
+func metricValues(t *testing.T, metrics []interface{}) map[string]float64 {
+	t.Helper()
+	values := make(map[string]float64, len(metrics))
+	for _, m := range metrics {
+		obj := m.(map[string]interface{})
+		values[obj["name"].(string)] = obj["value"].(float64)
+	}
+	return values
+}
+
+func TestParseSSHOutput(t *testing.T) {
+	out := "12345.67 40000.00\n" +
+		sshSectionMarker + "\n" +
+		"0.50 0.25 0.10 1/234 5678\n" +
+		sshSectionMarker + "\n" +
+		"Filesystem     1024-blocks    Used Available Capacity Mounted on\n" +
+		"/dev/sda1         1000000  250000    750000      25% /\n" +
+		"tmpfs              100000       0    100000       0% /run\n" +
+		"/dev/sdb1          400000  300000    100000      75% /var/lib/data\n"
+
+	got := metricValues(t, parseSSHOutput(out))
+
+	want := map[string]float64{
+		"system.uptime_seconds":               12345.67,
+		"system.load.1":                       0.5,
+		"system.load.5":                       0.25,
+		"system.load.15":                      0.1,
+		"system.disk.root.total_bytes":        1000000 * 1024,
+		"system.disk.root.usage_percent":      25,
+		"system.disk.var_lib_data.used_bytes": 300000 * 1024,
+		"system.disk.var_lib_data.free_bytes": 100000 * 1024,
+		"system.disk.total_bytes":             1400000 * 1024,
+		"system.disk.usage_percent":           55000000.0 / 1400000,
+	}
+	for name, value := range want {
+		if got[name] != value {
+			t.Errorf("Expected %s = %v, got %v", name, value, got[name])
+		}
+	}
+	if _, ok := got["system.disk.run.total_bytes"]; ok {
+		t.Error("Expected tmpfs mounts to be skipped")
+	}
+}
+
+func TestParseSSHOutputPartial(t *testing.T) {
+	// No procfs: both cat commands print nothing, df still works
+	out := sshSectionMarker + "\n" + sshSectionMarker + "\n" +
+		"Filesystem 1024-blocks Used Available Capacity Mounted on\n" +
+		"/dev/disk1s1 2000 500 1500 25% /\n"
+
+	got := metricValues(t, parseSSHOutput(out))
+	if _, ok := got["system.uptime_seconds"]; ok {
+		t.Error("Expected no uptime without /proc/uptime")
+	}
+	if got["system.disk.root.used_bytes"] != 500*1024 {
+		t.Errorf("Expected disk metrics from df, got %v", got)
+	}
+
+	if metrics := parseSSHOutput("sh: command not found\n"); len(metrics) != 0 {
+		t.Errorf("Expected no metrics from unrelated output, got %v", metrics)
+	}
+}
+
+// fakeSSHServer accepts password logins on a local port and rejects every session. It
+// returns the port, the host key fingerprint and a count of authentication attempts.
+func fakeSSHServer(t *testing.T) (int, string, *atomic.Int32) {
+	t.Helper()
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate host key: %v", err)
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatalf("Failed to create signer: %v", err)
+	}
+
+	var logins atomic.Int32
+	config := &ssh.ServerConfig{
+		PasswordCallback: func(ssh.ConnMetadata, []byte) (*ssh.Permissions, error) {
+			logins.Add(1)
+			return nil, nil
+		},
+	}
+	config.AddHostKey(signer)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				_, chans, reqs, err := ssh.NewServerConn(conn, config)
+				if err != nil {
+					return
+				}
+				go ssh.DiscardRequests(reqs)
+				for ch := range chans {
+					ch.Reject(ssh.Prohibited, "no sessions")
+				}
+			}()
+		}
+	}()
+	return listener.Addr().(*net.TCPAddr).Port, ssh.FingerprintSHA256(signer.PublicKey()), &logins
+}
+
+// hostKeyMap is a HostKeyStore over a map
+type hostKeyMap map[int64]dbgen.MonitorHostKey
+
+func (m hostKeyMap) GetMonitorHostKey(ctx context.Context, monitorID int64) (dbgen.MonitorHostKey, error) {
+	hostKey, ok := m[monitorID]
+	if !ok {
+		return dbgen.MonitorHostKey{}, pgx.ErrNoRows
+	}
+	return hostKey, nil
+}
+
+func TestSSHCollectorPinnedHostKey(t *testing.T) {
+	port, fingerprint, logins := fakeSSHServer(t)
+	pinned := func(fingerprint string, enabled bool) dbgen.MonitorHostKey {
+		return dbgen.MonitorHostKey{Enabled: enabled, Fingerprint: pgtype.Text{String: fingerprint, Valid: true}}
+	}
+	c := NewSSHCollector(hostKeyMap{
+		1: pinned(fingerprint, true),
+		2: pinned("SHA256:other", true),
+		3: pinned("SHA256:other", false),
+	})
+
+	testCases := []struct {
+		name         string
+		monitorID    int64
+		wantMismatch bool
+	}{
+		{"Pinned key matches", 1, false},
+		{"Pinned key differs", 2, true},
+		{"Verification disabled", 3, false},
+		{"Never opted in", 4, false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			before := logins.Load()
+			_, err := c.Collect(context.Background(), tc.monitorID, "127.0.0.1", port, auth.Credentials{Username: "admin", Password: "secret"})
+			if err == nil {
+				t.Fatal("Expected an error from a server without sessions")
+			}
+			if got := errors.Is(err, discovery.ErrHostKeyMismatch); got != tc.wantMismatch {
+				t.Errorf("Expected host key mismatch %v, got error %v", tc.wantMismatch, err)
+			}
+			// A mismatch must abort before the password is sent
+			if authenticated := logins.Load() > before; authenticated == tc.wantMismatch {
+				t.Errorf("Expected authentication %v, got %v", !tc.wantMismatch, authenticated)
+			}
+		})
+	}
+}
@@ -1,5 +1,6 @@
 // Package database provides PostgreSQL connection pooling using pgx/v5.
-// It maintains a single connection pool for all database operations.
+// It maintains a main pool for the API, scheduler and metrics writes, a separate
+// bounded pool for discovery and provisioning writes, and an optional read replica pool.
 package database
 
 import (
@@ -16,9 +17,15 @@ import (
 )
 
 var (
-	// pool handles all database operations
+	// pool handles API, scheduler and metrics operations
 	pool *pgxpool.Pool
 
+	// discoveryPool handles discovery and provisioning writes
+	discoveryPool *pgxpool.Pool
+
+	// replicaPool serves metrics and history reads; nil when no replica is configured
+	replicaPool *pgxpool.Pool
+
 	// initOnce ensures the pool is initialized only once
 	initOnce sync.Once
 
@@ -29,57 +36,100 @@ var (
 	closeMu sync.Mutex
 )
 
-// GetPool returns the connection pool for database operations.
+// GetPool returns the main connection pool used by the API, scheduler and metrics writers.
 // Returns nil if InitDB has not been called successfully.
 func GetPool() *pgxpool.Pool {
 	return pool
 }
 
-// InitDB initializes the database connection pool.
-// This function is safe to call multiple times - only the first call will initialize the pool.
-//
-// The pool is configured for:
-//   - All database operations (API, metrics, etc.)
-//   - Optimized for mixed workloads
-//
-// InitDB initializes the database connection pool.
-// This function is safe to call multiple times - only the first call will initialize the pool.
+// GetDiscoveryPool returns the connection pool for discovery and provisioning writes.
+// Returns nil if InitDB has not been called successfully.
+func GetDiscoveryPool() *pgxpool.Pool {
+	return discoveryPool
+}
+
+// GetReplicaPool returns the read replica pool, or nil when no replica is configured.
+func GetReplicaPool() *pgxpool.Pool {
+	return replicaPool
+}
+
+// InitDB initializes the main, discovery and (if configured) replica connection pools.
+// This function is safe to call multiple times - only the first call will initialize the pools.
 //
-// The pool is configured for:
-//   - All database operations (API, metrics, etc.)
-//   - Optimized for mixed workloads
+// The pools are configured for:
+//   - Main pool: API, scheduler reads and metrics writes
+//   - Discovery pool: bursts of discovered-device and provisioning inserts
+//   - Replica pool: metrics and history reads. It is not pinged at startup, so an
+//     unreachable replica only sends those reads to the primary (see ReadRouter).
 func InitDB(ctx context.Context) error {
 	initOnce.Do(func() {
-		// Create pool config
-		poolConfig, err := createPoolConfig()
-		if err != nil {
-			initErr = fmt.Errorf("failed to create pool config: %w", err)
-			return
-		}
+		cfg := globals.GetConfig()
 
-		// Initialize pool
-		pool, err = pgxpool.NewWithConfig(ctx, poolConfig)
+		var err error
+		pool, err = openPool(ctx, cfg.Database.Host, cfg.Database.Port, cfg.Database.Pool)
 		if err != nil {
-			initErr = fmt.Errorf("failed to create pool: %w", err)
+			initErr = err
 			return
 		}
 
-		// Verify pool connectivity
-		if err = pool.Ping(ctx); err != nil {
+		discoveryPool, err = openPool(ctx, cfg.Database.Host, cfg.Database.Port, cfg.Database.DiscoveryPoolConfig())
+		if err != nil {
 			pool.Close()
 			pool = nil
-			initErr = fmt.Errorf("failed to ping pool: %w", err)
+			initErr = fmt.Errorf("discovery pool: %w", err)
 			return
 		}
 
+		if cfg.Database.ReplicaEnabled() {
+			replicaPool, err = newPool(ctx, cfg.Database.Replica.Host, cfg.Database.ReplicaPort(), cfg.Database.ReplicaPoolConfig())
+			if err != nil {
+				discoveryPool.Close()
+				discoveryPool = nil
+				pool.Close()
+				pool = nil
+				initErr = fmt.Errorf("replica pool: %w", err)
+				return
+			}
+		}
+
 		initErr = nil
 	})
 
 	return initErr
 }
 
-// createPoolConfig creates a pgxpool configuration based on the database config.
-func createPoolConfig() (*pgxpool.Config, error) {
+// openPool creates a pool with the given settings and verifies connectivity.
+func openPool(ctx context.Context, host string, port int, poolCfg globals.PoolConfig) (*pgxpool.Pool, error) {
+	p, err := newPool(ctx, host, port, poolCfg)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = p.Ping(ctx); err != nil {
+		p.Close()
+		return nil, fmt.Errorf("failed to ping pool: %w", err)
+	}
+
+	return p, nil
+}
+
+// newPool creates a pool with the given settings without connecting.
+func newPool(ctx context.Context, host string, port int, poolCfg globals.PoolConfig) (*pgxpool.Pool, error) {
+	poolConfig, err := createPoolConfig(host, port, poolCfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create pool config: %w", err)
+	}
+
+	p, err := pgxpool.NewWithConfig(ctx, poolConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create pool: %w", err)
+	}
+
+	return p, nil
+}
+
+// createPoolConfig creates a pgxpool configuration for host:port from the database config and pool settings.
+func createPoolConfig(host string, port int, poolCfg globals.PoolConfig) (*pgxpool.Config, error) {
 	cfg := globals.GetConfig()
 
 	// Build connection string
@@ -87,8 +137,8 @@ func createPoolConfig() (*pgxpool.Config, error) {
 		"postgres://%s:%s@%s:%d/%s?sslmode=%s",
 		cfg.Database.User,
 		cfg.Database.Password,
-		cfg.Database.Host,
-		cfg.Database.Port,
+		host,
+		port,
 		cfg.Database.DBName,
 		cfg.Database.SSLMode,
 	)
@@ -99,12 +149,12 @@ func createPoolConfig() (*pgxpool.Config, error) {
 		return nil, fmt.Errorf("failed to parse connection string: %w", err)
 	}
 
-	// Configure connection pool with unified settings
-	poolConfig.MaxConns = int32(cfg.Database.Pool.MaxConns)
-	poolConfig.MinConns = int32(cfg.Database.Pool.MinConns)
-	poolConfig.MaxConnLifetime = time.Duration(cfg.Database.Pool.MaxConnLifetimeMinutes) * time.Minute
-	poolConfig.MaxConnIdleTime = time.Duration(cfg.Database.Pool.MaxConnIdleTimeMinutes) * time.Minute
-	poolConfig.HealthCheckPeriod = time.Duration(cfg.Database.Pool.HealthCheckPeriodSeconds) * time.Second
+	// Configure connection pool
+	poolConfig.MaxConns = int32(poolCfg.MaxConns)
+	poolConfig.MinConns = int32(poolCfg.MinConns)
+	poolConfig.MaxConnLifetime = poolCfg.MaxConnLifetime()
+	poolConfig.MaxConnIdleTime = poolCfg.MaxConnIdleTime()
+	poolConfig.HealthCheckPeriod = poolCfg.HealthCheckPeriod()
 
 	// Set connection timeout
 	poolConfig.ConnConfig.ConnectTimeout = 10 * time.Second
@@ -164,18 +214,39 @@ func RunMigrations(ctx context.Context) error {
 	return nil
 }
 
-// Close gracefully closes the connection pool.
+// Close gracefully closes the connection pools.
 // This function is safe to call multiple times and from multiple goroutines.
-// It waits for all active connections to be returned to the pool before closing.
+// It waits for all active connections to be returned to the pools before closing.
 func Close() {
 	closeMu.Lock()
 	defer closeMu.Unlock()
 
+	if replicaPool != nil {
+		replicaPool.Close()
+		replicaPool = nil
+	}
+	if discoveryPool != nil {
+		discoveryPool.Close()
+		discoveryPool = nil
+	}
 	if pool != nil {
 		pool.Close()
 		pool = nil
 	}
 }
 
-// Stats returns statistics for both connection pools.
+// Stats returns statistics for the connection pools, keyed by "main", "discovery" and "replica".
 // Useful for monitoring and debugging connection pool health.
+func Stats() map[string]*pgxpool.Stat {
+	stats := make(map[string]*pgxpool.Stat, 3)
+	if pool != nil {
+		stats["main"] = pool.Stat()
+	}
+	if discoveryPool != nil {
+		stats["discovery"] = discoveryPool.Stat()
+	}
+	if replicaPool != nil {
+		stats["replica"] = replicaPool.Stat()
+	}
+	return stats
+}
@@ -8,6 +8,7 @@ package dbgen
 import (
 	"context"
 	"encoding/json"
+	"time"
 
 	"github.com/jackc/pgx/v5/pgtype"
 )
@@ -21,7 +22,7 @@ INSERT INTO credential_profiles (
 ) VALUES (
     $1, $2, $3, $4
 )
-RETURNING id, name, description, protocol, payload, created_at, updated_at
+RETURNING id, name, description, protocol, payload, created_at, updated_at, deleted_at
 `
 
 type CreateCredentialProfileParams struct {
@@ -47,23 +48,48 @@ func (q *Queries) CreateCredentialProfile(ctx context.Context, arg CreateCredent
 		&i.Payload,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.DeletedAt,
 	)
 	return i, err
 }
 
-const deleteCredentialProfile = `-- name: DeleteCredentialProfile :exec
-DELETE FROM credential_profiles
-WHERE id = $1
+const countCredentialProfileReferences = `-- name: CountCredentialProfileReferences :one
+SELECT
+    (SELECT COUNT(*) FROM monitors m WHERE m.credential_profile_id = $1 AND m.deleted_at IS NULL)::int AS monitors,
+    (SELECT COUNT(*) FROM discovery_profiles d WHERE (d.credential_profile_id = $1 OR $1 = ANY(d.credential_profile_ids)) AND d.deleted_at IS NULL)::int AS discovery_profiles
+`
+
+type CountCredentialProfileReferencesRow struct {
+	Monitors          int32 `json:"monitors"`
+	DiscoveryProfiles int32 `json:"discovery_profiles"`
+}
+
+// Live monitors and discovery profiles still using a credential profile.
+func (q *Queries) CountCredentialProfileReferences(ctx context.Context, credentialProfileID int64) (CountCredentialProfileReferencesRow, error) {
+	row := q.db.QueryRow(ctx, countCredentialProfileReferences, credentialProfileID)
+	var i CountCredentialProfileReferencesRow
+	err := row.Scan(&i.Monitors, &i.DiscoveryProfiles)
+	return i, err
+}
+
+const deleteCredentialProfile = `-- name: DeleteCredentialProfile :execrows
+UPDATE credential_profiles
+SET deleted_at = NOW()
+WHERE id = $1 AND deleted_at IS NULL
 `
 
-func (q *Queries) DeleteCredentialProfile(ctx context.Context, id int64) error {
-	_, err := q.db.Exec(ctx, deleteCredentialProfile, id)
-	return err
+// Soft delete; returns 0 rows affected if the profile does not exist or is already deleted.
+func (q *Queries) DeleteCredentialProfile(ctx context.Context, id int64) (int64, error) {
+	result, err := q.db.Exec(ctx, deleteCredentialProfile, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
 }
 
 const getCredentialProfile = `-- name: GetCredentialProfile :one
-SELECT id, name, description, protocol, payload, created_at, updated_at FROM credential_profiles
-WHERE id = $1 LIMIT 1
+SELECT id, name, description, protocol, payload, created_at, updated_at, deleted_at FROM credential_profiles
+WHERE id = $1 AND deleted_at IS NULL LIMIT 1
 `
 
 func (q *Queries) GetCredentialProfile(ctx context.Context, id int64) (CredentialProfile, error) {
@@ -77,17 +103,92 @@ func (q *Queries) GetCredentialProfile(ctx context.Context, id int64) (Credentia
 		&i.Payload,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.DeletedAt,
 	)
 	return i, err
 }
 
+const getCredentialProfileProtocol = `-- name: GetCredentialProfileProtocol :one
+SELECT protocol FROM credential_profiles
+WHERE id = $1 AND deleted_at IS NULL
+`
+
+// Protocol only, for checking a monitor's plugin against its credential.
+func (q *Queries) GetCredentialProfileProtocol(ctx context.Context, id int64) (string, error) {
+	row := q.db.QueryRow(ctx, getCredentialProfileProtocol, id)
+	var protocol string
+	err := row.Scan(&protocol)
+	return protocol, err
+}
+
+const getCredentialProfilesVersion = `-- name: GetCredentialProfilesVersion :one
+SELECT COUNT(*)::bigint AS total,
+       COALESCE(MAX(GREATEST(updated_at, deleted_at)), 'epoch')::timestamptz AS last_modified
+FROM credential_profiles
+WHERE deleted_at IS NULL OR $1::bool
+`
+
+type GetCredentialProfilesVersionRow struct {
+	Total        int64     `json:"total"`
+	LastModified time.Time `json:"last_modified"`
+}
+
+// ETag validator for ListCredentialProfiles without fetching rows: the count and the latest
+// update or soft delete change whenever a listed row does.
+func (q *Queries) GetCredentialProfilesVersion(ctx context.Context, includeDeleted bool) (GetCredentialProfilesVersionRow, error) {
+	row := q.db.QueryRow(ctx, getCredentialProfilesVersion, includeDeleted)
+	var i GetCredentialProfilesVersionRow
+	err := row.Scan(&i.Total, &i.LastModified)
+	return i, err
+}
+
+const listCredentialPayloadsPage = `-- name: ListCredentialPayloadsPage :many
+SELECT id, name, payload FROM credential_profiles
+WHERE id > $1 AND deleted_at IS NULL
+ORDER BY id
+LIMIT $2
+`
+
+type ListCredentialPayloadsPageParams struct {
+	AfterID    int64 `json:"after_id"`
+	LimitCount int32 `json:"limit_count"`
+}
+
+type ListCredentialPayloadsPageRow struct {
+	ID      int64           `json:"id"`
+	Name    string          `json:"name"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+// Pages through live credential profiles by ID, after after_id, for the credential verifier.
+func (q *Queries) ListCredentialPayloadsPage(ctx context.Context, arg ListCredentialPayloadsPageParams) ([]ListCredentialPayloadsPageRow, error) {
+	rows, err := q.db.Query(ctx, listCredentialPayloadsPage, arg.AfterID, arg.LimitCount)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListCredentialPayloadsPageRow
+	for rows.Next() {
+		var i ListCredentialPayloadsPageRow
+		if err := rows.Scan(&i.ID, &i.Name, &i.Payload); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const listCredentialProfiles = `-- name: ListCredentialProfiles :many
-SELECT id, name, description, protocol, payload, created_at, updated_at FROM credential_profiles
+SELECT id, name, description, protocol, payload, created_at, updated_at, deleted_at FROM credential_profiles
+WHERE deleted_at IS NULL OR $1::bool
 ORDER BY name
 `
 
-func (q *Queries) ListCredentialProfiles(ctx context.Context) ([]CredentialProfile, error) {
-	rows, err := q.db.Query(ctx, listCredentialProfiles)
+func (q *Queries) ListCredentialProfiles(ctx context.Context, includeDeleted bool) ([]CredentialProfile, error) {
+	rows, err := q.db.Query(ctx, listCredentialProfiles, includeDeleted)
 	if err != nil {
 		return nil, err
 	}
@@ -103,6 +204,7 @@ func (q *Queries) ListCredentialProfiles(ctx context.Context) ([]CredentialProfi
 			&i.Payload,
 			&i.CreatedAt,
 			&i.UpdatedAt,
+			&i.DeletedAt,
 		); err != nil {
 			return nil, err
 		}
@@ -114,6 +216,65 @@ func (q *Queries) ListCredentialProfiles(ctx context.Context) ([]CredentialProfi
 	return items, nil
 }
 
+const listCredentialProfilesByIDs = `-- name: ListCredentialProfilesByIDs :many
+SELECT id, name, description, protocol, payload, created_at, updated_at, deleted_at FROM credential_profiles
+WHERE id = ANY($1::bigint[]) AND deleted_at IS NULL
+`
+
+// Batch form of GetCredentialProfile for bulk provisioning; missing or deleted IDs are left out.
+func (q *Queries) ListCredentialProfilesByIDs(ctx context.Context, credentialProfileIds []int64) ([]CredentialProfile, error) {
+	rows, err := q.db.Query(ctx, listCredentialProfilesByIDs, credentialProfileIds)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []CredentialProfile
+	for rows.Next() {
+		var i CredentialProfile
+		if err := rows.Scan(
+			&i.ID,
+			&i.Name,
+			&i.Description,
+			&i.Protocol,
+			&i.Payload,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.DeletedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const restoreCredentialProfile = `-- name: RestoreCredentialProfile :one
+UPDATE credential_profiles
+SET deleted_at = NULL, updated_at = NOW()
+WHERE id = $1 AND deleted_at IS NOT NULL
+RETURNING id, name, description, protocol, payload, created_at, updated_at, deleted_at
+`
+
+// Undeletes a soft-deleted profile; returns no rows if it is not deleted.
+func (q *Queries) RestoreCredentialProfile(ctx context.Context, id int64) (CredentialProfile, error) {
+	row := q.db.QueryRow(ctx, restoreCredentialProfile, id)
+	var i CredentialProfile
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.Description,
+		&i.Protocol,
+		&i.Payload,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.DeletedAt,
+	)
+	return i, err
+}
+
 const updateCredentialProfile = `-- name: UpdateCredentialProfile :one
 UPDATE credential_profiles
 SET 
@@ -123,15 +284,18 @@ SET
     payload = $5,
     updated_at = NOW()
 WHERE id = $1
-RETURNING id, name, description, protocol, payload, created_at, updated_at
+  AND deleted_at IS NULL
+  AND ($6::timestamptz IS NULL OR updated_at <= $6)
+RETURNING id, name, description, protocol, payload, created_at, updated_at, deleted_at
 `
 
 type UpdateCredentialProfileParams struct {
-	ID          int64           `json:"id"`
-	Name        string          `json:"name"`
-	Description pgtype.Text     `json:"description"`
-	Protocol    string          `json:"protocol"`
-	Payload     json.RawMessage `json:"payload"`
+	ID              int64              `json:"id"`
+	Name            string             `json:"name"`
+	Description     pgtype.Text        `json:"description"`
+	Protocol        string             `json:"protocol"`
+	Payload         json.RawMessage    `json:"payload"`
+	UnmodifiedSince pgtype.Timestamptz `json:"unmodified_since"`
 }
 
 func (q *Queries) UpdateCredentialProfile(ctx context.Context, arg UpdateCredentialProfileParams) (CredentialProfile, error) {
@@ -141,6 +305,7 @@ func (q *Queries) UpdateCredentialProfile(ctx context.Context, arg UpdateCredent
 		arg.Description,
 		arg.Protocol,
 		arg.Payload,
+		arg.UnmodifiedSince,
 	)
 	var i CredentialProfile
 	err := row.Scan(
@@ -151,6 +316,7 @@ func (q *Queries) UpdateCredentialProfile(ctx context.Context, arg UpdateCredent
 		&i.Payload,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.DeletedAt,
 	)
 	return i, err
 }
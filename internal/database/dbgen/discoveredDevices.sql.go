@@ -22,20 +22,61 @@ func (q *Queries) ClearDiscoveredDevices(ctx context.Context, discoveryProfileID
 	return err
 }
 
+const countDiscoveredDevicesFiltered = `-- name: CountDiscoveredDevicesFiltered :one
+SELECT COUNT(*) FROM discovered_devices d
+WHERE ($1::text IS NULL OR d.status = $1)
+  AND ($2::bigint IS NULL OR d.discovery_profile_id = $2)
+  AND ($3::inet IS NULL OR d.ip_address <<= $3)
+  AND ($4::bool IS NULL OR EXISTS (
+    SELECT 1 FROM monitors mon
+    LEFT JOIN unnest($5::text[], $6::int[]) AS dp(plugin_id, port)
+        ON dp.plugin_id = mon.plugin_id
+    WHERE mon.ip_address = d.ip_address AND COALESCE(mon.port, dp.port) = d.port
+      AND mon.deleted_at IS NULL
+  ) = $4)
+`
+
+type CountDiscoveredDevicesFilteredParams struct {
+	Status       pgtype.Text   `json:"status"`
+	ProfileID    pgtype.Int8   `json:"profile_id"`
+	Ip           *netip.Prefix `json:"ip"`
+	Provisioned  pgtype.Bool   `json:"provisioned"`
+	PluginIds    []string      `json:"plugin_ids"`
+	DefaultPorts []int32       `json:"default_ports"`
+}
+
+// Total for ListDiscoveredDevicesFiltered's filters, across all pages.
+func (q *Queries) CountDiscoveredDevicesFiltered(ctx context.Context, arg CountDiscoveredDevicesFilteredParams) (int64, error) {
+	row := q.db.QueryRow(ctx, countDiscoveredDevicesFiltered,
+		arg.Status,
+		arg.ProfileID,
+		arg.Ip,
+		arg.Provisioned,
+		arg.PluginIds,
+		arg.DefaultPorts,
+	)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
 const createDiscoveredDevice = `-- name: CreateDiscoveredDevice :one
 INSERT INTO discovered_devices (
-    discovery_profile_id, ip_address, port, status
+    discovery_profile_id, ip_address, port, status, credential_profile_id, discovery_job_id, protocol
 ) VALUES (
-    $1, $2, $3, $4
+    $1, $2, $3, $4, $5, $6, $7
 )
-RETURNING id, discovery_profile_id, ip_address, port, status, created_at, updated_at
+RETURNING id, discovery_profile_id, ip_address, port, status, created_at, updated_at, credential_profile_id, discovery_job_id, protocol
 `
 
 type CreateDiscoveredDeviceParams struct {
-	DiscoveryProfileID pgtype.Int8 `json:"discovery_profile_id"`
-	IpAddress          netip.Addr  `json:"ip_address"`
-	Port               int32       `json:"port"`
-	Status             pgtype.Text `json:"status"`
+	DiscoveryProfileID  pgtype.Int8 `json:"discovery_profile_id"`
+	IpAddress           netip.Addr  `json:"ip_address"`
+	Port                int32       `json:"port"`
+	Status              pgtype.Text `json:"status"`
+	CredentialProfileID pgtype.Int8 `json:"credential_profile_id"`
+	DiscoveryJobID      pgtype.Int8 `json:"discovery_job_id"`
+	Protocol            pgtype.Text `json:"protocol"`
 }
 
 func (q *Queries) CreateDiscoveredDevice(ctx context.Context, arg CreateDiscoveredDeviceParams) (DiscoveredDevice, error) {
@@ -44,6 +85,9 @@ func (q *Queries) CreateDiscoveredDevice(ctx context.Context, arg CreateDiscover
 		arg.IpAddress,
 		arg.Port,
 		arg.Status,
+		arg.CredentialProfileID,
+		arg.DiscoveryJobID,
+		arg.Protocol,
 	)
 	var i DiscoveredDevice
 	err := row.Scan(
@@ -54,6 +98,9 @@ func (q *Queries) CreateDiscoveredDevice(ctx context.Context, arg CreateDiscover
 		&i.Status,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.CredentialProfileID,
+		&i.DiscoveryJobID,
+		&i.Protocol,
 	)
 	return i, err
 }
@@ -69,7 +116,7 @@ func (q *Queries) DeleteDiscoveredDevice(ctx context.Context, id int64) error {
 }
 
 const getDiscoveredDevice = `-- name: GetDiscoveredDevice :one
-SELECT id, discovery_profile_id, ip_address, port, status, created_at, updated_at FROM discovered_devices
+SELECT id, discovery_profile_id, ip_address, port, status, created_at, updated_at, credential_profile_id, discovery_job_id, protocol FROM discovered_devices
 WHERE id = $1
 `
 
@@ -84,12 +131,15 @@ func (q *Queries) GetDiscoveredDevice(ctx context.Context, id int64) (Discovered
 		&i.Status,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.CredentialProfileID,
+		&i.DiscoveryJobID,
+		&i.Protocol,
 	)
 	return i, err
 }
 
 const listAllDiscoveredDevices = `-- name: ListAllDiscoveredDevices :many
-SELECT id, discovery_profile_id, ip_address, port, status, created_at, updated_at FROM discovered_devices
+SELECT id, discovery_profile_id, ip_address, port, status, created_at, updated_at, credential_profile_id, discovery_job_id, protocol FROM discovered_devices
 ORDER BY created_at DESC
 `
 
@@ -110,6 +160,9 @@ func (q *Queries) ListAllDiscoveredDevices(ctx context.Context) ([]DiscoveredDev
 			&i.Status,
 			&i.CreatedAt,
 			&i.UpdatedAt,
+			&i.CredentialProfileID,
+			&i.DiscoveryJobID,
+			&i.Protocol,
 		); err != nil {
 			return nil, err
 		}
@@ -122,7 +175,7 @@ func (q *Queries) ListAllDiscoveredDevices(ctx context.Context) ([]DiscoveredDev
 }
 
 const listDiscoveredDevices = `-- name: ListDiscoveredDevices :many
-SELECT id, discovery_profile_id, ip_address, port, status, created_at, updated_at FROM discovered_devices
+SELECT id, discovery_profile_id, ip_address, port, status, created_at, updated_at, credential_profile_id, discovery_job_id, protocol FROM discovered_devices
 WHERE discovery_profile_id = $1
 ORDER BY created_at DESC
 `
@@ -144,6 +197,142 @@ func (q *Queries) ListDiscoveredDevices(ctx context.Context, discoveryProfileID
 			&i.Status,
 			&i.CreatedAt,
 			&i.UpdatedAt,
+			&i.CredentialProfileID,
+			&i.DiscoveryJobID,
+			&i.Protocol,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listDiscoveredDevicesByIDs = `-- name: ListDiscoveredDevicesByIDs :many
+SELECT id, discovery_profile_id, ip_address, port, status, created_at, updated_at, credential_profile_id, discovery_job_id, protocol FROM discovered_devices
+WHERE id = ANY($1::bigint[])
+`
+
+// Batch form of GetDiscoveredDevice for bulk provisioning; missing IDs are left out.
+func (q *Queries) ListDiscoveredDevicesByIDs(ctx context.Context, deviceIds []int64) ([]DiscoveredDevice, error) {
+	rows, err := q.db.Query(ctx, listDiscoveredDevicesByIDs, deviceIds)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []DiscoveredDevice
+	for rows.Next() {
+		var i DiscoveredDevice
+		if err := rows.Scan(
+			&i.ID,
+			&i.DiscoveryProfileID,
+			&i.IpAddress,
+			&i.Port,
+			&i.Status,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.CredentialProfileID,
+			&i.DiscoveryJobID,
+			&i.Protocol,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listDiscoveredDevicesFiltered = `-- name: ListDiscoveredDevicesFiltered :many
+SELECT d.id, d.discovery_profile_id, d.ip_address, d.port, d.status, d.created_at, d.updated_at,
+    d.credential_profile_id, d.discovery_job_id, d.protocol, m.id AS monitor_id,
+    (m.id IS NOT NULL)::bool AS provisioned
+FROM discovered_devices d
+LEFT JOIN LATERAL (
+    SELECT mon.id FROM monitors mon
+    LEFT JOIN unnest($1::text[], $2::int[]) AS dp(plugin_id, port)
+        ON dp.plugin_id = mon.plugin_id
+    WHERE mon.ip_address = d.ip_address AND COALESCE(mon.port, dp.port) = d.port
+      AND mon.deleted_at IS NULL
+    ORDER BY mon.id
+    LIMIT 1
+) m ON TRUE
+WHERE ($3::text IS NULL OR d.status = $3)
+  AND ($4::bigint IS NULL OR d.discovery_profile_id = $4)
+  AND ($5::inet IS NULL OR d.ip_address <<= $5)
+  AND ($6::bool IS NULL OR (m.id IS NOT NULL) = $6)
+  AND ($7::bigint = 0 OR d.id < $7)
+ORDER BY d.id DESC
+LIMIT $8
+`
+
+type ListDiscoveredDevicesFilteredParams struct {
+	PluginIds    []string      `json:"plugin_ids"`
+	DefaultPorts []int32       `json:"default_ports"`
+	Status       pgtype.Text   `json:"status"`
+	ProfileID    pgtype.Int8   `json:"profile_id"`
+	Ip           *netip.Prefix `json:"ip"`
+	Provisioned  pgtype.Bool   `json:"provisioned"`
+	BeforeID     int64         `json:"before_id"`
+	LimitCount   int32         `json:"limit_count"`
+}
+
+type ListDiscoveredDevicesFilteredRow struct {
+	ID                  int64              `json:"id"`
+	DiscoveryProfileID  pgtype.Int8        `json:"discovery_profile_id"`
+	IpAddress           netip.Addr         `json:"ip_address"`
+	Port                int32              `json:"port"`
+	Status              pgtype.Text        `json:"status"`
+	CreatedAt           pgtype.Timestamptz `json:"created_at"`
+	UpdatedAt           pgtype.Timestamptz `json:"updated_at"`
+	CredentialProfileID pgtype.Int8        `json:"credential_profile_id"`
+	DiscoveryJobID      pgtype.Int8        `json:"discovery_job_id"`
+	Protocol            pgtype.Text        `json:"protocol"`
+	MonitorID           pgtype.Int8        `json:"monitor_id"`
+	Provisioned         bool               `json:"provisioned"`
+}
+
+// Fleet-wide inventory across profiles, newest first, paged by ID below before_id (0 for
+// the first page). monitor_id is a live monitor on the device's address and port, if any,
+// whatever the device's status says; a monitor without a port is matched on its plugin's
+// default, given as parallel plugin_ids and default_ports arrays. ip matches a single
+// address or a CIDR range.
+func (q *Queries) ListDiscoveredDevicesFiltered(ctx context.Context, arg ListDiscoveredDevicesFilteredParams) ([]ListDiscoveredDevicesFilteredRow, error) {
+	rows, err := q.db.Query(ctx, listDiscoveredDevicesFiltered,
+		arg.PluginIds,
+		arg.DefaultPorts,
+		arg.Status,
+		arg.ProfileID,
+		arg.Ip,
+		arg.Provisioned,
+		arg.BeforeID,
+		arg.LimitCount,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListDiscoveredDevicesFilteredRow
+	for rows.Next() {
+		var i ListDiscoveredDevicesFilteredRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.DiscoveryProfileID,
+			&i.IpAddress,
+			&i.Port,
+			&i.Status,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.CredentialProfileID,
+			&i.DiscoveryJobID,
+			&i.Protocol,
+			&i.MonitorID,
+			&i.Provisioned,
 		); err != nil {
 			return nil, err
 		}
@@ -155,6 +344,33 @@ func (q *Queries) ListDiscoveredDevices(ctx context.Context, discoveryProfileID
 	return items, nil
 }
 
+const listDiscoveryJobDeviceIPs = `-- name: ListDiscoveryJobDeviceIPs :many
+SELECT DISTINCT ip_address FROM discovered_devices
+WHERE discovery_job_id = $1
+ORDER BY ip_address
+`
+
+// Distinct addresses that responded during one discovery run.
+func (q *Queries) ListDiscoveryJobDeviceIPs(ctx context.Context, discoveryJobID pgtype.Int8) ([]netip.Addr, error) {
+	rows, err := q.db.Query(ctx, listDiscoveryJobDeviceIPs, discoveryJobID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []netip.Addr
+	for rows.Next() {
+		var ip_address netip.Addr
+		if err := rows.Scan(&ip_address); err != nil {
+			return nil, err
+		}
+		items = append(items, ip_address)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const updateDiscoveredDeviceStatus = `-- name: UpdateDiscoveredDeviceStatus :exec
 UPDATE discovered_devices
 SET 
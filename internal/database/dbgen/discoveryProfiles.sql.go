@@ -7,27 +7,44 @@ package dbgen
 
 import (
 	"context"
+	"time"
 
 	"github.com/jackc/pgx/v5/pgtype"
 )
 
+const countDiscoveryProfileMonitors = `-- name: CountDiscoveryProfileMonitors :one
+SELECT COUNT(*)::int AS monitors FROM monitors
+WHERE discovery_profile_id = $1 AND deleted_at IS NULL
+`
+
+// Live monitors still created from a discovery profile.
+func (q *Queries) CountDiscoveryProfileMonitors(ctx context.Context, discoveryProfileID int64) (int32, error) {
+	row := q.db.QueryRow(ctx, countDiscoveryProfileMonitors, discoveryProfileID)
+	var monitors int32
+	err := row.Scan(&monitors)
+	return monitors, err
+}
+
 const createDiscoveryProfile = `-- name: CreateDiscoveryProfile :one
 INSERT INTO discovery_profiles (
-    name, target_value, port, port_scan_timeout_ms, credential_profile_id, auto_provision, auto_run
+    name, target_value, port, port_scan_timeout_ms, credential_profile_id, auto_provision, auto_run, interval_seconds, credential_profile_ids, ports
 ) VALUES (
-    $1, $2, $3, $4, $5, $6, $7
+    $1, $2, $3, $4, $5, $6, $7, $8, $9, $10
 )
-RETURNING id, name, target_value, port, port_scan_timeout_ms, credential_profile_id, last_run_at, last_run_status, devices_discovered, created_at, updated_at, auto_provision, auto_run
+RETURNING id, name, target_value, port, port_scan_timeout_ms, credential_profile_id, last_run_at, last_run_status, devices_discovered, created_at, updated_at, auto_provision, auto_run, interval_seconds, deleted_at, credential_profile_ids, ports
 `
 
 type CreateDiscoveryProfileParams struct {
-	Name                string      `json:"name"`
-	TargetValue         string      `json:"target_value"`
-	Port                int32       `json:"port"`
-	PortScanTimeoutMs   pgtype.Int4 `json:"port_scan_timeout_ms"`
-	CredentialProfileID int64       `json:"credential_profile_id"`
-	AutoProvision       pgtype.Bool `json:"auto_provision"`
-	AutoRun             pgtype.Bool `json:"auto_run"`
+	Name                 string      `json:"name"`
+	TargetValue          string      `json:"target_value"`
+	Port                 int32       `json:"port"`
+	PortScanTimeoutMs    pgtype.Int4 `json:"port_scan_timeout_ms"`
+	CredentialProfileID  int64       `json:"credential_profile_id"`
+	AutoProvision        pgtype.Bool `json:"auto_provision"`
+	AutoRun              pgtype.Bool `json:"auto_run"`
+	IntervalSeconds      pgtype.Int4 `json:"interval_seconds"`
+	CredentialProfileIds []int64     `json:"credential_profile_ids"`
+	Ports                []int32     `json:"ports"`
 }
 
 func (q *Queries) CreateDiscoveryProfile(ctx context.Context, arg CreateDiscoveryProfileParams) (DiscoveryProfile, error) {
@@ -39,6 +56,9 @@ func (q *Queries) CreateDiscoveryProfile(ctx context.Context, arg CreateDiscover
 		arg.CredentialProfileID,
 		arg.AutoProvision,
 		arg.AutoRun,
+		arg.IntervalSeconds,
+		arg.CredentialProfileIds,
+		arg.Ports,
 	)
 	var i DiscoveryProfile
 	err := row.Scan(
@@ -55,23 +75,32 @@ func (q *Queries) CreateDiscoveryProfile(ctx context.Context, arg CreateDiscover
 		&i.UpdatedAt,
 		&i.AutoProvision,
 		&i.AutoRun,
+		&i.IntervalSeconds,
+		&i.DeletedAt,
+		&i.CredentialProfileIds,
+		&i.Ports,
 	)
 	return i, err
 }
 
-const deleteDiscoveryProfile = `-- name: DeleteDiscoveryProfile :exec
-DELETE FROM discovery_profiles
-WHERE id = $1
+const deleteDiscoveryProfile = `-- name: DeleteDiscoveryProfile :execrows
+UPDATE discovery_profiles
+SET deleted_at = NOW()
+WHERE id = $1 AND deleted_at IS NULL
 `
 
-func (q *Queries) DeleteDiscoveryProfile(ctx context.Context, id int64) error {
-	_, err := q.db.Exec(ctx, deleteDiscoveryProfile, id)
-	return err
+// Soft delete; returns 0 rows affected if the profile does not exist or is already deleted.
+func (q *Queries) DeleteDiscoveryProfile(ctx context.Context, id int64) (int64, error) {
+	result, err := q.db.Exec(ctx, deleteDiscoveryProfile, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
 }
 
 const getDiscoveryProfile = `-- name: GetDiscoveryProfile :one
-SELECT id, name, target_value, port, port_scan_timeout_ms, credential_profile_id, last_run_at, last_run_status, devices_discovered, created_at, updated_at, auto_provision, auto_run FROM discovery_profiles
-WHERE id = $1
+SELECT id, name, target_value, port, port_scan_timeout_ms, credential_profile_id, last_run_at, last_run_status, devices_discovered, created_at, updated_at, auto_provision, auto_run, interval_seconds, deleted_at, credential_profile_ids, ports FROM discovery_profiles
+WHERE id = $1 AND deleted_at IS NULL
 `
 
 func (q *Queries) GetDiscoveryProfile(ctx context.Context, id int64) (DiscoveryProfile, error) {
@@ -91,17 +120,175 @@ func (q *Queries) GetDiscoveryProfile(ctx context.Context, id int64) (DiscoveryP
 		&i.UpdatedAt,
 		&i.AutoProvision,
 		&i.AutoRun,
+		&i.IntervalSeconds,
+		&i.DeletedAt,
+		&i.CredentialProfileIds,
+		&i.Ports,
 	)
 	return i, err
 }
 
+const getDiscoveryProfilesVersion = `-- name: GetDiscoveryProfilesVersion :one
+SELECT COUNT(*)::bigint AS total,
+       COALESCE(MAX(GREATEST(updated_at, deleted_at)), 'epoch')::timestamptz AS last_modified
+FROM discovery_profiles
+WHERE deleted_at IS NULL OR $1::bool
+`
+
+type GetDiscoveryProfilesVersionRow struct {
+	Total        int64     `json:"total"`
+	LastModified time.Time `json:"last_modified"`
+}
+
+// ETag validator for ListDiscoveryProfiles without fetching rows: the count and the latest
+// update or soft delete change whenever a listed row does.
+func (q *Queries) GetDiscoveryProfilesVersion(ctx context.Context, includeDeleted bool) (GetDiscoveryProfilesVersionRow, error) {
+	row := q.db.QueryRow(ctx, getDiscoveryProfilesVersion, includeDeleted)
+	var i GetDiscoveryProfilesVersionRow
+	err := row.Scan(&i.Total, &i.LastModified)
+	return i, err
+}
+
 const listDiscoveryProfiles = `-- name: ListDiscoveryProfiles :many
-SELECT id, name, target_value, port, port_scan_timeout_ms, credential_profile_id, last_run_at, last_run_status, devices_discovered, created_at, updated_at, auto_provision, auto_run FROM discovery_profiles
+SELECT id, name, target_value, port, port_scan_timeout_ms, credential_profile_id, last_run_at, last_run_status, devices_discovered, created_at, updated_at, auto_provision, auto_run, interval_seconds, deleted_at, credential_profile_ids, ports FROM discovery_profiles
+WHERE deleted_at IS NULL OR $1::bool
 ORDER BY created_at DESC
 `
 
-func (q *Queries) ListDiscoveryProfiles(ctx context.Context) ([]DiscoveryProfile, error) {
-	rows, err := q.db.Query(ctx, listDiscoveryProfiles)
+func (q *Queries) ListDiscoveryProfiles(ctx context.Context, includeDeleted bool) ([]DiscoveryProfile, error) {
+	rows, err := q.db.Query(ctx, listDiscoveryProfiles, includeDeleted)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []DiscoveryProfile
+	for rows.Next() {
+		var i DiscoveryProfile
+		if err := rows.Scan(
+			&i.ID,
+			&i.Name,
+			&i.TargetValue,
+			&i.Port,
+			&i.PortScanTimeoutMs,
+			&i.CredentialProfileID,
+			&i.LastRunAt,
+			&i.LastRunStatus,
+			&i.DevicesDiscovered,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.AutoProvision,
+			&i.AutoRun,
+			&i.IntervalSeconds,
+			&i.DeletedAt,
+			&i.CredentialProfileIds,
+			&i.Ports,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listDiscoveryProfilesByIDs = `-- name: ListDiscoveryProfilesByIDs :many
+SELECT id, name, target_value, port, port_scan_timeout_ms, credential_profile_id, last_run_at, last_run_status, devices_discovered, created_at, updated_at, auto_provision, auto_run, interval_seconds, deleted_at, credential_profile_ids, ports FROM discovery_profiles
+WHERE id = ANY($1::bigint[]) AND deleted_at IS NULL
+`
+
+// Batch form of GetDiscoveryProfile for bulk provisioning; missing or deleted IDs are left out.
+func (q *Queries) ListDiscoveryProfilesByIDs(ctx context.Context, profileIds []int64) ([]DiscoveryProfile, error) {
+	rows, err := q.db.Query(ctx, listDiscoveryProfilesByIDs, profileIds)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []DiscoveryProfile
+	for rows.Next() {
+		var i DiscoveryProfile
+		if err := rows.Scan(
+			&i.ID,
+			&i.Name,
+			&i.TargetValue,
+			&i.Port,
+			&i.PortScanTimeoutMs,
+			&i.CredentialProfileID,
+			&i.LastRunAt,
+			&i.LastRunStatus,
+			&i.DevicesDiscovered,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.AutoProvision,
+			&i.AutoRun,
+			&i.IntervalSeconds,
+			&i.DeletedAt,
+			&i.CredentialProfileIds,
+			&i.Ports,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listDiscoveryTargetsPage = `-- name: ListDiscoveryTargetsPage :many
+SELECT id, name, target_value FROM discovery_profiles
+WHERE id > $1 AND deleted_at IS NULL
+ORDER BY id
+LIMIT $2
+`
+
+type ListDiscoveryTargetsPageParams struct {
+	AfterID    int64 `json:"after_id"`
+	LimitCount int32 `json:"limit_count"`
+}
+
+type ListDiscoveryTargetsPageRow struct {
+	ID          int64  `json:"id"`
+	Name        string `json:"name"`
+	TargetValue string `json:"target_value"`
+}
+
+// Pages through live discovery profiles' encrypted targets by ID, after after_id, for the
+// credential verifier.
+func (q *Queries) ListDiscoveryTargetsPage(ctx context.Context, arg ListDiscoveryTargetsPageParams) ([]ListDiscoveryTargetsPageRow, error) {
+	rows, err := q.db.Query(ctx, listDiscoveryTargetsPage, arg.AfterID, arg.LimitCount)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListDiscoveryTargetsPageRow
+	for rows.Next() {
+		var i ListDiscoveryTargetsPageRow
+		if err := rows.Scan(&i.ID, &i.Name, &i.TargetValue); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listDueDiscoveryProfiles = `-- name: ListDueDiscoveryProfiles :many
+SELECT id, name, target_value, port, port_scan_timeout_ms, credential_profile_id, last_run_at, last_run_status, devices_discovered, created_at, updated_at, auto_provision, auto_run, interval_seconds, deleted_at, credential_profile_ids, ports FROM discovery_profiles
+WHERE interval_seconds > 0
+  AND deleted_at IS NULL
+  AND (last_run_at IS NULL OR last_run_at + make_interval(secs => interval_seconds) <= NOW())
+ORDER BY last_run_at ASC NULLS FIRST
+`
+
+// Returns scheduled profiles whose interval has elapsed since their last run.
+// Profiles that never ran are due immediately.
+func (q *Queries) ListDueDiscoveryProfiles(ctx context.Context) ([]DiscoveryProfile, error) {
+	rows, err := q.db.Query(ctx, listDueDiscoveryProfiles)
 	if err != nil {
 		return nil, err
 	}
@@ -123,6 +310,10 @@ func (q *Queries) ListDiscoveryProfiles(ctx context.Context) ([]DiscoveryProfile
 			&i.UpdatedAt,
 			&i.AutoProvision,
 			&i.AutoRun,
+			&i.IntervalSeconds,
+			&i.DeletedAt,
+			&i.CredentialProfileIds,
+			&i.Ports,
 		); err != nil {
 			return nil, err
 		}
@@ -134,6 +325,44 @@ func (q *Queries) ListDiscoveryProfiles(ctx context.Context) ([]DiscoveryProfile
 	return items, nil
 }
 
+const restoreDiscoveryProfile = `-- name: RestoreDiscoveryProfile :one
+UPDATE discovery_profiles d
+SET deleted_at = NULL, updated_at = NOW()
+WHERE d.id = $1 AND d.deleted_at IS NOT NULL
+  AND EXISTS (
+      SELECT 1 FROM credential_profiles c
+      WHERE c.id = d.credential_profile_id AND c.deleted_at IS NULL
+  )
+RETURNING d.id, d.name, d.target_value, d.port, d.port_scan_timeout_ms, d.credential_profile_id, d.last_run_at, d.last_run_status, d.devices_discovered, d.created_at, d.updated_at, d.auto_provision, d.auto_run, d.interval_seconds, d.deleted_at, d.credential_profile_ids, d.ports
+`
+
+// Undeletes a soft-deleted profile whose credential profile is still live;
+// returns no rows otherwise.
+func (q *Queries) RestoreDiscoveryProfile(ctx context.Context, id int64) (DiscoveryProfile, error) {
+	row := q.db.QueryRow(ctx, restoreDiscoveryProfile, id)
+	var i DiscoveryProfile
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.TargetValue,
+		&i.Port,
+		&i.PortScanTimeoutMs,
+		&i.CredentialProfileID,
+		&i.LastRunAt,
+		&i.LastRunStatus,
+		&i.DevicesDiscovered,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.AutoProvision,
+		&i.AutoRun,
+		&i.IntervalSeconds,
+		&i.DeletedAt,
+		&i.CredentialProfileIds,
+		&i.Ports,
+	)
+	return i, err
+}
+
 const updateDiscoveryProfile = `-- name: UpdateDiscoveryProfile :one
 UPDATE discovery_profiles
 SET 
@@ -144,20 +373,26 @@ SET
     credential_profile_id = $6,
     auto_provision = $7,
     auto_run = $8,
+    interval_seconds = $9,
+    credential_profile_ids = $10,
+    ports = $11,
     updated_at = NOW()
-WHERE id = $1
-RETURNING id, name, target_value, port, port_scan_timeout_ms, credential_profile_id, last_run_at, last_run_status, devices_discovered, created_at, updated_at, auto_provision, auto_run
+WHERE id = $1 AND deleted_at IS NULL
+RETURNING id, name, target_value, port, port_scan_timeout_ms, credential_profile_id, last_run_at, last_run_status, devices_discovered, created_at, updated_at, auto_provision, auto_run, interval_seconds, deleted_at, credential_profile_ids, ports
 `
 
 type UpdateDiscoveryProfileParams struct {
-	ID                  int64       `json:"id"`
-	Name                string      `json:"name"`
-	TargetValue         string      `json:"target_value"`
-	Port                int32       `json:"port"`
-	PortScanTimeoutMs   pgtype.Int4 `json:"port_scan_timeout_ms"`
-	CredentialProfileID int64       `json:"credential_profile_id"`
-	AutoProvision       pgtype.Bool `json:"auto_provision"`
-	AutoRun             pgtype.Bool `json:"auto_run"`
+	ID                   int64       `json:"id"`
+	Name                 string      `json:"name"`
+	TargetValue          string      `json:"target_value"`
+	Port                 int32       `json:"port"`
+	PortScanTimeoutMs    pgtype.Int4 `json:"port_scan_timeout_ms"`
+	CredentialProfileID  int64       `json:"credential_profile_id"`
+	AutoProvision        pgtype.Bool `json:"auto_provision"`
+	AutoRun              pgtype.Bool `json:"auto_run"`
+	IntervalSeconds      pgtype.Int4 `json:"interval_seconds"`
+	CredentialProfileIds []int64     `json:"credential_profile_ids"`
+	Ports                []int32     `json:"ports"`
 }
 
 func (q *Queries) UpdateDiscoveryProfile(ctx context.Context, arg UpdateDiscoveryProfileParams) (DiscoveryProfile, error) {
@@ -170,6 +405,9 @@ func (q *Queries) UpdateDiscoveryProfile(ctx context.Context, arg UpdateDiscover
 		arg.CredentialProfileID,
 		arg.AutoProvision,
 		arg.AutoRun,
+		arg.IntervalSeconds,
+		arg.CredentialProfileIds,
+		arg.Ports,
 	)
 	var i DiscoveryProfile
 	err := row.Scan(
@@ -186,6 +424,10 @@ func (q *Queries) UpdateDiscoveryProfile(ctx context.Context, arg UpdateDiscover
 		&i.UpdatedAt,
 		&i.AutoProvision,
 		&i.AutoRun,
+		&i.IntervalSeconds,
+		&i.DeletedAt,
+		&i.CredentialProfileIds,
+		&i.Ports,
 	)
 	return i, err
 }
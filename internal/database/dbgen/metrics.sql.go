@@ -8,7 +8,54 @@ package dbgen
 import (
 	"context"
 	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const deleteMetricsInRange = `-- name: DeleteMetricsInRange :execrows
+DELETE FROM metrics
+WHERE timestamp >= $1
+  AND timestamp < $2
+`
+
+type DeleteMetricsInRangeParams struct {
+	StartTime time.Time `json:"start_time"`
+	EndTime   time.Time `json:"end_time"`
+}
+
+// Deletes raw metrics in [start_time, end_time) once they have been rolled up.
+func (q *Queries) DeleteMetricsInRange(ctx context.Context, arg DeleteMetricsInRangeParams) (int64, error) {
+	result, err := q.db.Exec(ctx, deleteMetricsInRange, arg.StartTime, arg.EndTime)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const deleteMetricsOlderThan = `-- name: DeleteMetricsOlderThan :execrows
+DELETE FROM metrics
+WHERE (device_id, name, timestamp) IN (
+  SELECT metrics.device_id, metrics.name, metrics.timestamp
+  FROM metrics
+  WHERE metrics.timestamp < $1
+  LIMIT $2
 )
+`
+
+type DeleteMetricsOlderThanParams struct {
+	Cutoff     time.Time `json:"cutoff"`
+	LimitCount int32     `json:"limit_count"`
+}
+
+// Deletes up to limit_count metrics older than the cutoff.
+// Bounded so retention runs as many short deletes instead of one long lock.
+func (q *Queries) DeleteMetricsOlderThan(ctx context.Context, arg DeleteMetricsOlderThanParams) (int64, error) {
+	result, err := q.db.Exec(ctx, deleteMetricsOlderThan, arg.Cutoff, arg.LimitCount)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
 
 const getAllMetricNames = `-- name: GetAllMetricNames :many
 SELECT DISTINCT name
@@ -38,9 +85,137 @@ func (q *Queries) GetAllMetricNames(ctx context.Context, deviceIds []int64) ([]s
 	return items, nil
 }
 
+const getBucketedMetricsByDeviceAndPrefix = `-- name: GetBucketedMetricsByDeviceAndPrefix :many
+SELECT time_bucket(('1 ' || $1::text)::interval, s.ts, $2::text) AS bucket,
+       s.device_id,
+       s.name,
+       (SUM(s.value * s.samples) / SUM(s.samples))::double precision AS avg_value,
+       MAX(s.type) AS type,
+       MAX(s.unit) AS unit
+FROM (
+  SELECT metrics.timestamp AS ts, metrics.device_id, metrics.name, metrics.value, 1::bigint AS samples, metrics.type, metrics.unit
+  FROM metrics
+  WHERE metrics.device_id = ANY($3::bigint[])
+    AND metrics.name LIKE $4
+    AND metrics.timestamp >= GREATEST($5::timestamptz, $6::timestamptz)
+    AND metrics.timestamp <= $7
+  UNION ALL
+  SELECT metrics_rollup.bucket, metrics_rollup.device_id, metrics_rollup.name, metrics_rollup.avg_value,
+         metrics_rollup.sample_count, metrics_rollup.type, metrics_rollup.unit
+  FROM metrics_rollup
+  WHERE metrics_rollup.device_id = ANY($3::bigint[])
+    AND metrics_rollup.name LIKE $4
+    AND metrics_rollup.bucket >= $5
+    AND metrics_rollup.bucket < $6
+    AND metrics_rollup.bucket <= $7
+) s
+GROUP BY 1, s.device_id, s.name
+ORDER BY s.device_id, s.name, bucket DESC
+`
+
+type GetBucketedMetricsByDeviceAndPrefixParams struct {
+	Bucket            string    `json:"bucket"`
+	Timezone          string    `json:"timezone"`
+	DeviceIds         []int64   `json:"device_ids"`
+	MetricNamePattern string    `json:"metric_name_pattern"`
+	StartTime         time.Time `json:"start_time"`
+	RollupBefore      time.Time `json:"rollup_before"`
+	EndTime           time.Time `json:"end_time"`
+}
+
+type GetBucketedMetricsByDeviceAndPrefixRow struct {
+	Bucket   time.Time   `json:"bucket"`
+	DeviceID int64       `json:"device_id"`
+	Name     string      `json:"name"`
+	AvgValue float64     `json:"avg_value"`
+	Type     pgtype.Text `json:"type"`
+	Unit     pgtype.Text `json:"unit"`
+}
+
+// Averages each series into one-hour or one-day buckets aligned to timezone's wall clock,
+// over the whole range with no per-series limit. Raw metrics cover rollup_before onwards;
+// earlier hours come from metrics_rollup, weighted by their sample counts.
+func (q *Queries) GetBucketedMetricsByDeviceAndPrefix(ctx context.Context, arg GetBucketedMetricsByDeviceAndPrefixParams) ([]GetBucketedMetricsByDeviceAndPrefixRow, error) {
+	rows, err := q.db.Query(ctx, getBucketedMetricsByDeviceAndPrefix,
+		arg.Bucket,
+		arg.Timezone,
+		arg.DeviceIds,
+		arg.MetricNamePattern,
+		arg.StartTime,
+		arg.RollupBefore,
+		arg.EndTime,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetBucketedMetricsByDeviceAndPrefixRow
+	for rows.Next() {
+		var i GetBucketedMetricsByDeviceAndPrefixRow
+		if err := rows.Scan(
+			&i.Bucket,
+			&i.DeviceID,
+			&i.Name,
+			&i.AvgValue,
+			&i.Type,
+			&i.Unit,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getLatestMetricsByDevice = `-- name: GetLatestMetricsByDevice :many
+SELECT DISTINCT ON (name)
+       timestamp, device_id, name, value, type, unit, tags
+FROM metrics
+WHERE device_id = $1
+  AND timestamp >= $2
+ORDER BY name, timestamp DESC
+`
+
+type GetLatestMetricsByDeviceParams struct {
+	DeviceID int64     `json:"device_id"`
+	Since    time.Time `json:"since"`
+}
+
+// Latest value of every metric for a single device, looking back to since
+func (q *Queries) GetLatestMetricsByDevice(ctx context.Context, arg GetLatestMetricsByDeviceParams) ([]Metric, error) {
+	rows, err := q.db.Query(ctx, getLatestMetricsByDevice, arg.DeviceID, arg.Since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Metric
+	for rows.Next() {
+		var i Metric
+		if err := rows.Scan(
+			&i.Timestamp,
+			&i.DeviceID,
+			&i.Name,
+			&i.Value,
+			&i.Type,
+			&i.Unit,
+			&i.Tags,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const getLatestMetricsByDeviceAndPrefix = `-- name: GetLatestMetricsByDeviceAndPrefix :many
 SELECT DISTINCT ON (device_id, name)
-       timestamp, device_id, name, value, type
+       timestamp, device_id, name, value, type, unit, tags
 FROM metrics
 WHERE device_id = ANY($1::bigint[])
   AND name LIKE $2
@@ -77,6 +252,8 @@ func (q *Queries) GetLatestMetricsByDeviceAndPrefix(ctx context.Context, arg Get
 			&i.Name,
 			&i.Value,
 			&i.Type,
+			&i.Unit,
+			&i.Tags,
 		); err != nil {
 			return nil, err
 		}
@@ -89,7 +266,7 @@ func (q *Queries) GetLatestMetricsByDeviceAndPrefix(ctx context.Context, arg Get
 }
 
 const getMetricsByDeviceAndPrefix = `-- name: GetMetricsByDeviceAndPrefix :many
-SELECT m.timestamp, m.device_id, m.name, m.value, m.type
+SELECT m.timestamp, m.device_id, m.name, m.value, m.type, m.unit, m.tags
 FROM (
   SELECT DISTINCT metrics.device_id, metrics.name
   FROM metrics
@@ -99,7 +276,7 @@ FROM (
     AND metrics.timestamp <= $4
 ) groups
 CROSS JOIN LATERAL (
-  SELECT metrics.timestamp, metrics.device_id, metrics.name, metrics.value, metrics.type
+  SELECT metrics.timestamp, metrics.device_id, metrics.name, metrics.value, metrics.type, metrics.unit, metrics.tags
   FROM metrics
   WHERE metrics.device_id = groups.device_id
     AND metrics.name = groups.name
@@ -142,6 +319,8 @@ func (q *Queries) GetMetricsByDeviceAndPrefix(ctx context.Context, arg GetMetric
 			&i.Name,
 			&i.Value,
 			&i.Type,
+			&i.Unit,
+			&i.Tags,
 		); err != nil {
 			return nil, err
 		}
@@ -152,3 +331,35 @@ func (q *Queries) GetMetricsByDeviceAndPrefix(ctx context.Context, arg GetMetric
 	}
 	return items, nil
 }
+
+const getNewestMetricTimestamp = `-- name: GetNewestMetricTimestamp :one
+SELECT timestamp
+FROM metrics
+ORDER BY timestamp DESC
+LIMIT 1
+`
+
+// Returns the newest raw metric timestamp (pgx.ErrNoRows if there are none).
+// Used by the metrics pipeline check to confirm metrics are still being written.
+func (q *Queries) GetNewestMetricTimestamp(ctx context.Context) (time.Time, error) {
+	row := q.db.QueryRow(ctx, getNewestMetricTimestamp)
+	var timestamp time.Time
+	err := row.Scan(&timestamp)
+	return timestamp, err
+}
+
+const getOldestMetricTimestampBefore = `-- name: GetOldestMetricTimestampBefore :one
+SELECT timestamp
+FROM metrics
+WHERE timestamp < $1
+ORDER BY timestamp ASC
+LIMIT 1
+`
+
+// Returns the oldest raw metric timestamp before the cutoff (pgx.ErrNoRows if none).
+func (q *Queries) GetOldestMetricTimestampBefore(ctx context.Context, cutoff time.Time) (time.Time, error) {
+	row := q.db.QueryRow(ctx, getOldestMetricTimestampBefore, cutoff)
+	var timestamp time.Time
+	err := row.Scan(&timestamp)
+	return timestamp, err
+}
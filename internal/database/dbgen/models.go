@@ -20,40 +20,79 @@ type CredentialProfile struct {
 	Payload     json.RawMessage    `json:"payload"`
 	CreatedAt   pgtype.Timestamptz `json:"created_at"`
 	UpdatedAt   pgtype.Timestamptz `json:"updated_at"`
+	DeletedAt   pgtype.Timestamptz `json:"deleted_at"`
 }
 
 type DiscoveredDevice struct {
-	ID                 int64              `json:"id"`
-	DiscoveryProfileID pgtype.Int8        `json:"discovery_profile_id"`
-	IpAddress          netip.Addr         `json:"ip_address"`
-	Port               int32              `json:"port"`
-	Status             pgtype.Text        `json:"status"`
-	CreatedAt          pgtype.Timestamptz `json:"created_at"`
-	UpdatedAt          pgtype.Timestamptz `json:"updated_at"`
-}
-
-type DiscoveryProfile struct {
 	ID                  int64              `json:"id"`
-	Name                string             `json:"name"`
-	TargetValue         string             `json:"target_value"`
+	DiscoveryProfileID  pgtype.Int8        `json:"discovery_profile_id"`
+	IpAddress           netip.Addr         `json:"ip_address"`
 	Port                int32              `json:"port"`
-	PortScanTimeoutMs   pgtype.Int4        `json:"port_scan_timeout_ms"`
-	CredentialProfileID int64              `json:"credential_profile_id"`
-	LastRunAt           pgtype.Timestamptz `json:"last_run_at"`
-	LastRunStatus       pgtype.Text        `json:"last_run_status"`
-	DevicesDiscovered   pgtype.Int4        `json:"devices_discovered"`
+	Status              pgtype.Text        `json:"status"`
 	CreatedAt           pgtype.Timestamptz `json:"created_at"`
 	UpdatedAt           pgtype.Timestamptz `json:"updated_at"`
-	AutoProvision       pgtype.Bool        `json:"auto_provision"`
-	AutoRun             pgtype.Bool        `json:"auto_run"`
+	CredentialProfileID pgtype.Int8        `json:"credential_profile_id"`
+	DiscoveryJobID      pgtype.Int8        `json:"discovery_job_id"`
+	Protocol            pgtype.Text        `json:"protocol"`
+}
+
+type DiscoveryJob struct {
+	ID               int64              `json:"id"`
+	ProfileID        int64              `json:"profile_id"`
+	Status           string             `json:"status"`
+	TotalTargets     int32              `json:"total_targets"`
+	ProcessedTargets int32              `json:"processed_targets"`
+	DevicesFound     int32              `json:"devices_found"`
+	Error            pgtype.Text        `json:"error"`
+	CreatedAt        time.Time          `json:"created_at"`
+	StartedAt        pgtype.Timestamptz `json:"started_at"`
+	CompletedAt      pgtype.Timestamptz `json:"completed_at"`
+	UpdatedAt        time.Time          `json:"updated_at"`
+	Summary          json.RawMessage    `json:"summary"`
+	ResultsStatus    pgtype.Text        `json:"results_status"`
+	InstanceID       pgtype.Text        `json:"instance_id"`
+}
+
+type DiscoveryProfile struct {
+	ID                   int64              `json:"id"`
+	Name                 string             `json:"name"`
+	TargetValue          string             `json:"target_value"`
+	Port                 int32              `json:"port"`
+	PortScanTimeoutMs    pgtype.Int4        `json:"port_scan_timeout_ms"`
+	CredentialProfileID  int64              `json:"credential_profile_id"`
+	LastRunAt            pgtype.Timestamptz `json:"last_run_at"`
+	LastRunStatus        pgtype.Text        `json:"last_run_status"`
+	DevicesDiscovered    pgtype.Int4        `json:"devices_discovered"`
+	CreatedAt            pgtype.Timestamptz `json:"created_at"`
+	UpdatedAt            pgtype.Timestamptz `json:"updated_at"`
+	AutoProvision        pgtype.Bool        `json:"auto_provision"`
+	AutoRun              pgtype.Bool        `json:"auto_run"`
+	IntervalSeconds      pgtype.Int4        `json:"interval_seconds"`
+	DeletedAt            pgtype.Timestamptz `json:"deleted_at"`
+	CredentialProfileIds []int64            `json:"credential_profile_ids"`
+	Ports                []int32            `json:"ports"`
 }
 
 type Metric struct {
-	Timestamp time.Time   `json:"timestamp"`
-	DeviceID  int64       `json:"device_id"`
-	Name      string      `json:"name"`
-	Value     float64     `json:"value"`
-	Type      pgtype.Text `json:"type"`
+	Timestamp time.Time       `json:"timestamp"`
+	DeviceID  int64           `json:"device_id"`
+	Name      string          `json:"name"`
+	Value     float64         `json:"value"`
+	Type      pgtype.Text     `json:"type"`
+	Unit      pgtype.Text     `json:"unit"`
+	Tags      json.RawMessage `json:"tags"`
+}
+
+type MetricsRollup struct {
+	Bucket      time.Time   `json:"bucket"`
+	DeviceID    int64       `json:"device_id"`
+	Name        string      `json:"name"`
+	MinValue    float64     `json:"min_value"`
+	AvgValue    float64     `json:"avg_value"`
+	MaxValue    float64     `json:"max_value"`
+	SampleCount int64       `json:"sample_count"`
+	Type        pgtype.Text `json:"type"`
+	Unit        pgtype.Text `json:"unit"`
 }
 
 type Monitor struct {
@@ -69,4 +108,44 @@ type Monitor struct {
 	CreatedAt              pgtype.Timestamptz `json:"created_at"`
 	UpdatedAt              pgtype.Timestamptz `json:"updated_at"`
 	Port                   pgtype.Int4        `json:"port"`
+	DeletedAt              pgtype.Timestamptz `json:"deleted_at"`
+	Collectors             []string           `json:"collectors"`
+	KeepPollingWhenDown    bool               `json:"keep_polling_when_down"`
+	Tags                   json.RawMessage    `json:"tags"`
+	DownSince              pgtype.Timestamptz `json:"down_since"`
+	ArchivedAt             pgtype.Timestamptz `json:"archived_at"`
+}
+
+type MonitorGroup struct {
+	MonitorID int64     `json:"monitor_id"`
+	GroupName string    `json:"group_name"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type MonitorHostKey struct {
+	MonitorID           int64              `json:"monitor_id"`
+	Enabled             bool               `json:"enabled"`
+	Fingerprint         pgtype.Text        `json:"fingerprint"`
+	ObservedFingerprint pgtype.Text        `json:"observed_fingerprint"`
+	TrustedAt           pgtype.Timestamptz `json:"trusted_at"`
+	ChangedAt           pgtype.Timestamptz `json:"changed_at"`
+	LastCheckedAt       pgtype.Timestamptz `json:"last_checked_at"`
+	CreatedAt           time.Time          `json:"created_at"`
+}
+
+type MonitorStateHistory struct {
+	ID         int64     `json:"id"`
+	MonitorID  int64     `json:"monitor_id"`
+	EventType  string    `json:"event_type"`
+	Failures   int32     `json:"failures"`
+	OccurredAt time.Time `json:"occurred_at"`
+}
+
+type User struct {
+	ID           int64     `json:"id"`
+	Username     string    `json:"username"`
+	PasswordHash string    `json:"password_hash"`
+	Role         string    `json:"role"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
 }
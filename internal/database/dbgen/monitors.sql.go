@@ -9,10 +9,48 @@ import (
 	"context"
 	"encoding/json"
 	"net/netip"
+	"time"
 
 	"github.com/jackc/pgx/v5/pgtype"
 )
 
+const archiveDownMonitors = `-- name: ArchiveDownMonitors :many
+UPDATE monitors
+SET status = 'archived', archived_at = NOW(), updated_at = NOW()
+WHERE status = 'down'
+  AND NOT keep_polling_when_down
+  AND deleted_at IS NULL
+  AND down_since < $1::timestamptz
+RETURNING id, ip_address
+`
+
+type ArchiveDownMonitorsRow struct {
+	ID        int64      `json:"id"`
+	IpAddress netip.Addr `json:"ip_address"`
+}
+
+// Moves monitors that have been down since before down_before to "archived".
+// Monitors that keep polling while down are still observed and never archived.
+func (q *Queries) ArchiveDownMonitors(ctx context.Context, downBefore time.Time) ([]ArchiveDownMonitorsRow, error) {
+	rows, err := q.db.Query(ctx, archiveDownMonitors, downBefore)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ArchiveDownMonitorsRow
+	for rows.Next() {
+		var i ArchiveDownMonitorsRow
+		if err := rows.Scan(&i.ID, &i.IpAddress); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const createMonitor = `-- name: CreateMonitor :one
 INSERT INTO monitors (
     display_name,
@@ -23,27 +61,49 @@ INSERT INTO monitors (
     discovery_profile_id,
     port,
     polling_interval_seconds,
-    status
-) VALUES (
-    $1, $2, $3, $4, $5, $6, $7, 
-    COALESCE($8::int, 60), 
-    COALESCE($9::text, 'active')
+    status,
+    collectors,
+    keep_polling_when_down,
+    tags
+)
+SELECT
+    $1::text,
+    $2::text,
+    $3::inet,
+    $4::text,
+    $5::bigint,
+    $6::bigint,
+    $7::int,
+    COALESCE($8::int, 60),
+    COALESCE($9::text, 'active'),
+    $10::text[],
+    $11::bool,
+    COALESCE($12::jsonb, '{}')
+WHERE NOT $13::bool OR NOT EXISTS (
+    SELECT 1 FROM monitors d
+    WHERE d.ip_address = $3::inet AND d.plugin_id = $4::text AND d.deleted_at IS NULL
 )
-RETURNING id, display_name, hostname, ip_address, plugin_id, credential_profile_id, discovery_profile_id, polling_interval_seconds, status, created_at, updated_at, port
+RETURNING id, display_name, hostname, ip_address, plugin_id, credential_profile_id, discovery_profile_id, polling_interval_seconds, status, created_at, updated_at, port, deleted_at, collectors, keep_polling_when_down, tags, down_since, archived_at
 `
 
 type CreateMonitorParams struct {
-	DisplayName            pgtype.Text `json:"display_name"`
-	Hostname               pgtype.Text `json:"hostname"`
-	IpAddress              netip.Addr  `json:"ip_address"`
-	PluginID               string      `json:"plugin_id"`
-	CredentialProfileID    int64       `json:"credential_profile_id"`
-	DiscoveryProfileID     int64       `json:"discovery_profile_id"`
-	Port                   pgtype.Int4 `json:"port"`
-	PollingIntervalSeconds pgtype.Int4 `json:"polling_interval_seconds"`
-	Status                 pgtype.Text `json:"status"`
+	DisplayName            pgtype.Text     `json:"display_name"`
+	Hostname               pgtype.Text     `json:"hostname"`
+	IpAddress              netip.Addr      `json:"ip_address"`
+	PluginID               string          `json:"plugin_id"`
+	CredentialProfileID    int64           `json:"credential_profile_id"`
+	DiscoveryProfileID     int64           `json:"discovery_profile_id"`
+	Port                   pgtype.Int4     `json:"port"`
+	PollingIntervalSeconds pgtype.Int4     `json:"polling_interval_seconds"`
+	Status                 pgtype.Text     `json:"status"`
+	Collectors             []string        `json:"collectors"`
+	KeepPollingWhenDown    bool            `json:"keep_polling_when_down"`
+	Tags                   json.RawMessage `json:"tags"`
+	RejectDuplicate        bool            `json:"reject_duplicate"`
 }
 
+// With reject_duplicate set, no row is inserted when a live monitor already polls
+// ip_address with plugin_id.
 func (q *Queries) CreateMonitor(ctx context.Context, arg CreateMonitorParams) (Monitor, error) {
 	row := q.db.QueryRow(ctx, createMonitor,
 		arg.DisplayName,
@@ -55,6 +115,10 @@ func (q *Queries) CreateMonitor(ctx context.Context, arg CreateMonitorParams) (M
 		arg.Port,
 		arg.PollingIntervalSeconds,
 		arg.Status,
+		arg.Collectors,
+		arg.KeepPollingWhenDown,
+		arg.Tags,
+		arg.RejectDuplicate,
 	)
 	var i Monitor
 	err := row.Scan(
@@ -70,22 +134,33 @@ func (q *Queries) CreateMonitor(ctx context.Context, arg CreateMonitorParams) (M
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.Port,
+		&i.DeletedAt,
+		&i.Collectors,
+		&i.KeepPollingWhenDown,
+		&i.Tags,
+		&i.DownSince,
+		&i.ArchivedAt,
 	)
 	return i, err
 }
 
-const deleteMonitor = `-- name: DeleteMonitor :exec
-DELETE FROM monitors
-WHERE id = $1
+const deleteMonitor = `-- name: DeleteMonitor :execrows
+UPDATE monitors
+SET deleted_at = NOW()
+WHERE id = $1 AND deleted_at IS NULL
 `
 
-func (q *Queries) DeleteMonitor(ctx context.Context, id int64) error {
-	_, err := q.db.Exec(ctx, deleteMonitor, id)
-	return err
+// Soft delete; returns 0 rows affected if the monitor does not exist or is already deleted.
+func (q *Queries) DeleteMonitor(ctx context.Context, id int64) (int64, error) {
+	result, err := q.db.Exec(ctx, deleteMonitor, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
 }
 
 const getExistingMonitorIDs = `-- name: GetExistingMonitorIDs :many
-SELECT id FROM monitors WHERE id = ANY($1::bigint[])
+SELECT id FROM monitors WHERE id = ANY($1::bigint[]) AND deleted_at IS NULL
 `
 
 // Returns only monitor IDs that exist and are not soft-deleted.
@@ -111,8 +186,8 @@ func (q *Queries) GetExistingMonitorIDs(ctx context.Context, monitorIds []int64)
 }
 
 const getMonitor = `-- name: GetMonitor :one
-SELECT id, display_name, hostname, ip_address, plugin_id, credential_profile_id, discovery_profile_id, polling_interval_seconds, status, created_at, updated_at, port FROM monitors
-WHERE id = $1
+SELECT id, display_name, hostname, ip_address, plugin_id, credential_profile_id, discovery_profile_id, polling_interval_seconds, status, created_at, updated_at, port, deleted_at, collectors, keep_polling_when_down, tags, down_since, archived_at FROM monitors
+WHERE id = $1 AND deleted_at IS NULL
 `
 
 func (q *Queries) GetMonitor(ctx context.Context, id int64) (Monitor, error) {
@@ -131,6 +206,84 @@ func (q *Queries) GetMonitor(ctx context.Context, id int64) (Monitor, error) {
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.Port,
+		&i.DeletedAt,
+		&i.Collectors,
+		&i.KeepPollingWhenDown,
+		&i.Tags,
+		&i.DownSince,
+		&i.ArchivedAt,
+	)
+	return i, err
+}
+
+const getMonitorByIPAndPlugin = `-- name: GetMonitorByIPAndPlugin :one
+SELECT id, display_name, hostname, ip_address, plugin_id, credential_profile_id, discovery_profile_id, polling_interval_seconds, status, created_at, updated_at, port, deleted_at, collectors, keep_polling_when_down, tags, down_since, archived_at FROM monitors
+WHERE ip_address = $1 AND plugin_id = $2 AND deleted_at IS NULL
+ORDER BY id
+LIMIT 1
+`
+
+type GetMonitorByIPAndPluginParams struct {
+	IpAddress netip.Addr `json:"ip_address"`
+	PluginID  string     `json:"plugin_id"`
+}
+
+// Finds the oldest live monitor polling ip_address with plugin_id (pgx.ErrNoRows if none).
+// Used to catch duplicate monitors at creation and during auto-provisioning.
+func (q *Queries) GetMonitorByIPAndPlugin(ctx context.Context, arg GetMonitorByIPAndPluginParams) (Monitor, error) {
+	row := q.db.QueryRow(ctx, getMonitorByIPAndPlugin, arg.IpAddress, arg.PluginID)
+	var i Monitor
+	err := row.Scan(
+		&i.ID,
+		&i.DisplayName,
+		&i.Hostname,
+		&i.IpAddress,
+		&i.PluginID,
+		&i.CredentialProfileID,
+		&i.DiscoveryProfileID,
+		&i.PollingIntervalSeconds,
+		&i.Status,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Port,
+		&i.DeletedAt,
+		&i.Collectors,
+		&i.KeepPollingWhenDown,
+		&i.Tags,
+		&i.DownSince,
+		&i.ArchivedAt,
+	)
+	return i, err
+}
+
+const getMonitorIncludingDeleted = `-- name: GetMonitorIncludingDeleted :one
+SELECT id, display_name, hostname, ip_address, plugin_id, credential_profile_id, discovery_profile_id, polling_interval_seconds, status, created_at, updated_at, port, deleted_at, collectors, keep_polling_when_down, tags, down_since, archived_at FROM monitors
+WHERE id = $1
+`
+
+// GetMonitor that also finds soft-deleted monitors, for reports over their history.
+func (q *Queries) GetMonitorIncludingDeleted(ctx context.Context, id int64) (Monitor, error) {
+	row := q.db.QueryRow(ctx, getMonitorIncludingDeleted, id)
+	var i Monitor
+	err := row.Scan(
+		&i.ID,
+		&i.DisplayName,
+		&i.Hostname,
+		&i.IpAddress,
+		&i.PluginID,
+		&i.CredentialProfileID,
+		&i.DiscoveryProfileID,
+		&i.PollingIntervalSeconds,
+		&i.Status,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Port,
+		&i.DeletedAt,
+		&i.Collectors,
+		&i.KeepPollingWhenDown,
+		&i.Tags,
+		&i.DownSince,
+		&i.ArchivedAt,
 	)
 	return i, err
 }
@@ -140,10 +293,10 @@ SELECT
     m.id, m.display_name, m.hostname, m.ip_address, m.plugin_id, 
     m.credential_profile_id, m.discovery_profile_id, m.port, 
     m.polling_interval_seconds, m.status, m.created_at, m.updated_at,
-    c.payload
+    m.collectors, m.keep_polling_when_down, m.tags, c.payload
 FROM monitors m
 JOIN credential_profiles c ON m.credential_profile_id = c.id
-WHERE m.id = $1
+WHERE m.id = $1 AND m.deleted_at IS NULL
 `
 
 type GetMonitorWithCredentialsRow struct {
@@ -159,6 +312,9 @@ type GetMonitorWithCredentialsRow struct {
 	Status                 pgtype.Text        `json:"status"`
 	CreatedAt              pgtype.Timestamptz `json:"created_at"`
 	UpdatedAt              pgtype.Timestamptz `json:"updated_at"`
+	Collectors             []string           `json:"collectors"`
+	KeepPollingWhenDown    bool               `json:"keep_polling_when_down"`
+	Tags                   json.RawMessage    `json:"tags"`
 	Payload                json.RawMessage    `json:"payload"`
 }
 
@@ -180,13 +336,16 @@ func (q *Queries) GetMonitorWithCredentials(ctx context.Context, id int64) (GetM
 		&i.Status,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.Collectors,
+		&i.KeepPollingWhenDown,
+		&i.Tags,
 		&i.Payload,
 	)
 	return i, err
 }
 
 const getMonitorsByCredentialID = `-- name: GetMonitorsByCredentialID :many
-SELECT id FROM monitors WHERE credential_profile_id = $1
+SELECT id FROM monitors WHERE credential_profile_id = $1 AND deleted_at IS NULL
 `
 
 func (q *Queries) GetMonitorsByCredentialID(ctx context.Context, credentialProfileID int64) ([]int64, error) {
@@ -209,15 +368,37 @@ func (q *Queries) GetMonitorsByCredentialID(ctx context.Context, credentialProfi
 	return items, nil
 }
 
+const getMonitorsVersion = `-- name: GetMonitorsVersion :one
+SELECT COUNT(*)::bigint AS total,
+       COALESCE(MAX(GREATEST(updated_at, deleted_at)), 'epoch')::timestamptz AS last_modified
+FROM monitors
+WHERE status IS DISTINCT FROM 'archived'
+  AND (deleted_at IS NULL OR $1::bool)
+`
+
+type GetMonitorsVersionRow struct {
+	Total        int64     `json:"total"`
+	LastModified time.Time `json:"last_modified"`
+}
+
+// ETag validator for ListMonitors without fetching rows: the count and the latest
+// update or soft delete change whenever a listed row does.
+func (q *Queries) GetMonitorsVersion(ctx context.Context, includeDeleted bool) (GetMonitorsVersionRow, error) {
+	row := q.db.QueryRow(ctx, getMonitorsVersion, includeDeleted)
+	var i GetMonitorsVersionRow
+	err := row.Scan(&i.Total, &i.LastModified)
+	return i, err
+}
+
 const getMonitorsWithCredentialsByCredentialID = `-- name: GetMonitorsWithCredentialsByCredentialID :many
 SELECT 
     m.id, m.display_name, m.hostname, m.ip_address, m.plugin_id, 
     m.credential_profile_id, m.discovery_profile_id, m.port, 
     m.polling_interval_seconds, m.status, m.created_at, m.updated_at,
-    c.payload
+    m.collectors, m.keep_polling_when_down, m.tags, c.payload
 FROM monitors m
 JOIN credential_profiles c ON m.credential_profile_id = c.id
-WHERE m.credential_profile_id = $1
+WHERE m.credential_profile_id = $1 AND m.deleted_at IS NULL
 `
 
 type GetMonitorsWithCredentialsByCredentialIDRow struct {
@@ -233,6 +414,9 @@ type GetMonitorsWithCredentialsByCredentialIDRow struct {
 	Status                 pgtype.Text        `json:"status"`
 	CreatedAt              pgtype.Timestamptz `json:"created_at"`
 	UpdatedAt              pgtype.Timestamptz `json:"updated_at"`
+	Collectors             []string           `json:"collectors"`
+	KeepPollingWhenDown    bool               `json:"keep_polling_when_down"`
+	Tags                   json.RawMessage    `json:"tags"`
 	Payload                json.RawMessage    `json:"payload"`
 }
 
@@ -260,6 +444,9 @@ func (q *Queries) GetMonitorsWithCredentialsByCredentialID(ctx context.Context,
 			&i.Status,
 			&i.CreatedAt,
 			&i.UpdatedAt,
+			&i.Collectors,
+			&i.KeepPollingWhenDown,
+			&i.Tags,
 			&i.Payload,
 		); err != nil {
 			return nil, err
@@ -272,15 +459,64 @@ func (q *Queries) GetMonitorsWithCredentialsByCredentialID(ctx context.Context,
 	return items, nil
 }
 
+const getPolledMonitorSummary = `-- name: GetPolledMonitorSummary :one
+SELECT COUNT(*)::bigint AS monitors,
+       COALESCE(MIN(COALESCE(polling_interval_seconds, 60)), 0)::int AS shortest_interval_seconds
+FROM monitors
+WHERE status IN ('active', 'stale') AND deleted_at IS NULL
+`
+
+type GetPolledMonitorSummaryRow struct {
+	Monitors                int64 `json:"monitors"`
+	ShortestIntervalSeconds int32 `json:"shortest_interval_seconds"`
+}
+
+// Counts reachable (active or stale) monitors, which should be producing metrics, and
+// their shortest polling interval (NULL is the 60 second default; 0 with no monitors).
+func (q *Queries) GetPolledMonitorSummary(ctx context.Context) (GetPolledMonitorSummaryRow, error) {
+	row := q.db.QueryRow(ctx, getPolledMonitorSummary)
+	var i GetPolledMonitorSummaryRow
+	err := row.Scan(&i.Monitors, &i.ShortestIntervalSeconds)
+	return i, err
+}
+
+const listActiveMonitorIDsByIP = `-- name: ListActiveMonitorIDsByIP :many
+SELECT id FROM monitors
+WHERE ip_address = $1 AND status IN ('active', 'stale') AND deleted_at IS NULL
+ORDER BY id
+`
+
+// Resolves an SNMP trap's source address to the active (or stale) monitors of that device.
+func (q *Queries) ListActiveMonitorIDsByIP(ctx context.Context, ipAddress netip.Addr) ([]int64, error) {
+	rows, err := q.db.Query(ctx, listActiveMonitorIDsByIP, ipAddress)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		items = append(items, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const listActiveMonitorsWithCredentials = `-- name: ListActiveMonitorsWithCredentials :many
 SELECT 
     m.id, m.display_name, m.hostname, m.ip_address, m.plugin_id, 
     m.credential_profile_id, m.discovery_profile_id, m.port, 
     m.polling_interval_seconds, m.status, m.created_at, m.updated_at,
-    c.payload
+    m.collectors, m.keep_polling_when_down, m.tags, c.payload
 FROM monitors m
 JOIN credential_profiles c ON m.credential_profile_id = c.id
-WHERE m.status = 'active'
+WHERE (m.status IN ('active', 'stale') OR (m.status = 'down' AND m.keep_polling_when_down))
+  AND m.deleted_at IS NULL
 `
 
 type ListActiveMonitorsWithCredentialsRow struct {
@@ -296,11 +532,14 @@ type ListActiveMonitorsWithCredentialsRow struct {
 	Status                 pgtype.Text        `json:"status"`
 	CreatedAt              pgtype.Timestamptz `json:"created_at"`
 	UpdatedAt              pgtype.Timestamptz `json:"updated_at"`
+	Collectors             []string           `json:"collectors"`
+	KeepPollingWhenDown    bool               `json:"keep_polling_when_down"`
+	Tags                   json.RawMessage    `json:"tags"`
 	Payload                json.RawMessage    `json:"payload"`
 }
 
-// Loads active monitors with their credential data in a single query.
-// Used by scheduler to initialize cache at startup.
+// Loads active (and stale) monitors, and down monitors that keep polling, with their credential
+// data in a single query. Used by scheduler to initialize cache at startup.
 func (q *Queries) ListActiveMonitorsWithCredentials(ctx context.Context) ([]ListActiveMonitorsWithCredentialsRow, error) {
 	rows, err := q.db.Query(ctx, listActiveMonitorsWithCredentials)
 	if err != nil {
@@ -323,6 +562,9 @@ func (q *Queries) ListActiveMonitorsWithCredentials(ctx context.Context) ([]List
 			&i.Status,
 			&i.CreatedAt,
 			&i.UpdatedAt,
+			&i.Collectors,
+			&i.KeepPollingWhenDown,
+			&i.Tags,
 			&i.Payload,
 		); err != nil {
 			return nil, err
@@ -335,13 +577,62 @@ func (q *Queries) ListActiveMonitorsWithCredentials(ctx context.Context) ([]List
 	return items, nil
 }
 
+const listArchivedMonitors = `-- name: ListArchivedMonitors :many
+SELECT id, display_name, hostname, ip_address, plugin_id, credential_profile_id, discovery_profile_id, polling_interval_seconds, status, created_at, updated_at, port, deleted_at, collectors, keep_polling_when_down, tags, down_since, archived_at FROM monitors
+WHERE status = 'archived' AND deleted_at IS NULL
+ORDER BY archived_at DESC, id DESC
+`
+
+// Most recently archived first; edits to an archived monitor do not reorder it.
+func (q *Queries) ListArchivedMonitors(ctx context.Context) ([]Monitor, error) {
+	rows, err := q.db.Query(ctx, listArchivedMonitors)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Monitor
+	for rows.Next() {
+		var i Monitor
+		if err := rows.Scan(
+			&i.ID,
+			&i.DisplayName,
+			&i.Hostname,
+			&i.IpAddress,
+			&i.PluginID,
+			&i.CredentialProfileID,
+			&i.DiscoveryProfileID,
+			&i.PollingIntervalSeconds,
+			&i.Status,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Port,
+			&i.DeletedAt,
+			&i.Collectors,
+			&i.KeepPollingWhenDown,
+			&i.Tags,
+			&i.DownSince,
+			&i.ArchivedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const listMonitors = `-- name: ListMonitors :many
-SELECT id, display_name, hostname, ip_address, plugin_id, credential_profile_id, discovery_profile_id, polling_interval_seconds, status, created_at, updated_at, port FROM monitors
+SELECT id, display_name, hostname, ip_address, plugin_id, credential_profile_id, discovery_profile_id, polling_interval_seconds, status, created_at, updated_at, port, deleted_at, collectors, keep_polling_when_down, tags, down_since, archived_at FROM monitors
+WHERE status IS DISTINCT FROM 'archived'
+  AND (deleted_at IS NULL OR $1::bool)
 ORDER BY created_at DESC
 `
 
-func (q *Queries) ListMonitors(ctx context.Context) ([]Monitor, error) {
-	rows, err := q.db.Query(ctx, listMonitors)
+// Archived monitors are listed separately via ListArchivedMonitors.
+func (q *Queries) ListMonitors(ctx context.Context, includeDeleted bool) ([]Monitor, error) {
+	rows, err := q.db.Query(ctx, listMonitors, includeDeleted)
 	if err != nil {
 		return nil, err
 	}
@@ -362,6 +653,12 @@ func (q *Queries) ListMonitors(ctx context.Context) ([]Monitor, error) {
 			&i.CreatedAt,
 			&i.UpdatedAt,
 			&i.Port,
+			&i.DeletedAt,
+			&i.Collectors,
+			&i.KeepPollingWhenDown,
+			&i.Tags,
+			&i.DownSince,
+			&i.ArchivedAt,
 		); err != nil {
 			return nil, err
 		}
@@ -373,6 +670,79 @@ func (q *Queries) ListMonitors(ctx context.Context) ([]Monitor, error) {
 	return items, nil
 }
 
+const restoreArchivedMonitor = `-- name: RestoreArchivedMonitor :one
+UPDATE monitors
+SET status = 'active', down_since = NULL, archived_at = NULL, updated_at = NOW()
+WHERE id = $1 AND status = 'archived' AND deleted_at IS NULL
+RETURNING id, display_name, hostname, ip_address, plugin_id, credential_profile_id, discovery_profile_id, polling_interval_seconds, status, created_at, updated_at, port, deleted_at, collectors, keep_polling_when_down, tags, down_since, archived_at
+`
+
+// Reactivates an archived monitor; returns no rows if it is not archived.
+func (q *Queries) RestoreArchivedMonitor(ctx context.Context, id int64) (Monitor, error) {
+	row := q.db.QueryRow(ctx, restoreArchivedMonitor, id)
+	var i Monitor
+	err := row.Scan(
+		&i.ID,
+		&i.DisplayName,
+		&i.Hostname,
+		&i.IpAddress,
+		&i.PluginID,
+		&i.CredentialProfileID,
+		&i.DiscoveryProfileID,
+		&i.PollingIntervalSeconds,
+		&i.Status,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Port,
+		&i.DeletedAt,
+		&i.Collectors,
+		&i.KeepPollingWhenDown,
+		&i.Tags,
+		&i.DownSince,
+		&i.ArchivedAt,
+	)
+	return i, err
+}
+
+const restoreDeletedMonitor = `-- name: RestoreDeletedMonitor :one
+UPDATE monitors m
+SET deleted_at = NULL, updated_at = NOW()
+WHERE m.id = $1 AND m.deleted_at IS NOT NULL
+  AND EXISTS (
+      SELECT 1 FROM credential_profiles c
+      WHERE c.id = m.credential_profile_id AND c.deleted_at IS NULL
+  )
+RETURNING m.id, m.display_name, m.hostname, m.ip_address, m.plugin_id, m.credential_profile_id, m.discovery_profile_id, m.polling_interval_seconds, m.status, m.created_at, m.updated_at, m.port, m.deleted_at, m.collectors, m.keep_polling_when_down, m.tags, m.down_since, m.archived_at
+`
+
+// Undeletes a soft-deleted monitor whose credential profile is still live;
+// returns no rows otherwise.
+func (q *Queries) RestoreDeletedMonitor(ctx context.Context, id int64) (Monitor, error) {
+	row := q.db.QueryRow(ctx, restoreDeletedMonitor, id)
+	var i Monitor
+	err := row.Scan(
+		&i.ID,
+		&i.DisplayName,
+		&i.Hostname,
+		&i.IpAddress,
+		&i.PluginID,
+		&i.CredentialProfileID,
+		&i.DiscoveryProfileID,
+		&i.PollingIntervalSeconds,
+		&i.Status,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Port,
+		&i.DeletedAt,
+		&i.Collectors,
+		&i.KeepPollingWhenDown,
+		&i.Tags,
+		&i.DownSince,
+		&i.ArchivedAt,
+	)
+	return i, err
+}
+
 const updateMonitor = `-- name: UpdateMonitor :one
 UPDATE monitors
 SET 
@@ -384,23 +754,41 @@ SET
     polling_interval_seconds = $7,
     port = $8,
     status = $9,
+    down_since = CASE WHEN $9 IN ('down', 'archived') THEN COALESCE(down_since, NOW()) END,
+    archived_at = CASE WHEN $9 = 'archived' THEN COALESCE(archived_at, NOW()) END,
+    collectors = $10::text[],
+    keep_polling_when_down = $11::bool,
+    tags = COALESCE($12::jsonb, '{}'),
     updated_at = NOW()
 WHERE id = $1
-RETURNING id, display_name, hostname, ip_address, plugin_id, credential_profile_id, discovery_profile_id, polling_interval_seconds, status, created_at, updated_at, port
+  AND deleted_at IS NULL
+  AND ($13::timestamptz IS NULL OR updated_at <= $13)
+  AND (NOT $14::bool OR NOT EXISTS (
+      SELECT 1 FROM monitors d
+      WHERE d.ip_address = $4 AND d.plugin_id = $5 AND d.deleted_at IS NULL AND d.id <> $1
+  ))
+RETURNING id, display_name, hostname, ip_address, plugin_id, credential_profile_id, discovery_profile_id, polling_interval_seconds, status, created_at, updated_at, port, deleted_at, collectors, keep_polling_when_down, tags, down_since, archived_at
 `
 
 type UpdateMonitorParams struct {
-	ID                     int64       `json:"id"`
-	DisplayName            pgtype.Text `json:"display_name"`
-	Hostname               pgtype.Text `json:"hostname"`
-	IpAddress              netip.Addr  `json:"ip_address"`
-	PluginID               string      `json:"plugin_id"`
-	CredentialProfileID    int64       `json:"credential_profile_id"`
-	PollingIntervalSeconds pgtype.Int4 `json:"polling_interval_seconds"`
-	Port                   pgtype.Int4 `json:"port"`
-	Status                 pgtype.Text `json:"status"`
+	ID                     int64              `json:"id"`
+	DisplayName            pgtype.Text        `json:"display_name"`
+	Hostname               pgtype.Text        `json:"hostname"`
+	IpAddress              netip.Addr         `json:"ip_address"`
+	PluginID               string             `json:"plugin_id"`
+	CredentialProfileID    int64              `json:"credential_profile_id"`
+	PollingIntervalSeconds pgtype.Int4        `json:"polling_interval_seconds"`
+	Port                   pgtype.Int4        `json:"port"`
+	Status                 pgtype.Text        `json:"status"`
+	Collectors             []string           `json:"collectors"`
+	KeepPollingWhenDown    bool               `json:"keep_polling_when_down"`
+	Tags                   json.RawMessage    `json:"tags"`
+	UnmodifiedSince        pgtype.Timestamptz `json:"unmodified_since"`
+	RejectDuplicate        bool               `json:"reject_duplicate"`
 }
 
+// With reject_duplicate set, no row is updated when another live monitor already polls
+// the new ip_address with the new plugin_id.
 func (q *Queries) UpdateMonitor(ctx context.Context, arg UpdateMonitorParams) (Monitor, error) {
 	row := q.db.QueryRow(ctx, updateMonitor,
 		arg.ID,
@@ -412,6 +800,11 @@ func (q *Queries) UpdateMonitor(ctx context.Context, arg UpdateMonitorParams) (M
 		arg.PollingIntervalSeconds,
 		arg.Port,
 		arg.Status,
+		arg.Collectors,
+		arg.KeepPollingWhenDown,
+		arg.Tags,
+		arg.UnmodifiedSince,
+		arg.RejectDuplicate,
 	)
 	var i Monitor
 	err := row.Scan(
@@ -427,14 +820,23 @@ func (q *Queries) UpdateMonitor(ctx context.Context, arg UpdateMonitorParams) (M
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.Port,
+		&i.DeletedAt,
+		&i.Collectors,
+		&i.KeepPollingWhenDown,
+		&i.Tags,
+		&i.DownSince,
+		&i.ArchivedAt,
 	)
 	return i, err
 }
 
 const updateMonitorStatus = `-- name: UpdateMonitorStatus :exec
 UPDATE monitors
-SET status = $2, updated_at = NOW()
-WHERE id = $1
+SET status = $2,
+    down_since = CASE WHEN $2 IN ('down', 'archived') THEN COALESCE(down_since, NOW()) END,
+    archived_at = CASE WHEN $2 = 'archived' THEN COALESCE(archived_at, NOW()) END,
+    updated_at = NOW()
+WHERE id = $1 AND deleted_at IS NULL
 `
 
 type UpdateMonitorStatusParams struct {
@@ -442,7 +844,8 @@ type UpdateMonitorStatusParams struct {
 	Status pgtype.Text `json:"status"`
 }
 
-// Updates monitor status (active/down) and updated_at timestamp.
+// Updates monitor status (active/down) and updated_at timestamp. down_since keeps the
+// start of an outage across repeated "down" updates and clears once the monitor is back.
 func (q *Queries) UpdateMonitorStatus(ctx context.Context, arg UpdateMonitorStatusParams) error {
 	_, err := q.db.Exec(ctx, updateMonitorStatus, arg.ID, arg.Status)
 	return err
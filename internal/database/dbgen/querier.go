@@ -6,56 +6,211 @@ package dbgen
 
 import (
 	"context"
+	"net/netip"
+	"time"
 
 	"github.com/jackc/pgx/v5/pgtype"
 )
 
 type Querier interface {
+	AddMonitorToGroup(ctx context.Context, arg AddMonitorToGroupParams) error
+	// Moves monitors that have been down since before down_before to "archived".
+	// Monitors that keep polling while down are still observed and never archived.
+	ArchiveDownMonitors(ctx context.Context, downBefore time.Time) ([]ArchiveDownMonitorsRow, error)
 	ClearDiscoveredDevices(ctx context.Context, discoveryProfileID pgtype.Int8) error
+	CompleteDiscoveryJob(ctx context.Context, arg CompleteDiscoveryJobParams) error
+	// Live monitors and discovery profiles still using a credential profile.
+	CountCredentialProfileReferences(ctx context.Context, credentialProfileID int64) (CountCredentialProfileReferencesRow, error)
+	// Total for ListDiscoveredDevicesFiltered's filters, across all pages.
+	CountDiscoveredDevicesFiltered(ctx context.Context, arg CountDiscoveredDevicesFilteredParams) (int64, error)
+	// Live monitors still created from a discovery profile.
+	CountDiscoveryProfileMonitors(ctx context.Context, discoveryProfileID int64) (int32, error)
 	CreateCredentialProfile(ctx context.Context, arg CreateCredentialProfileParams) (CredentialProfile, error)
 	CreateDiscoveredDevice(ctx context.Context, arg CreateDiscoveredDeviceParams) (DiscoveredDevice, error)
+	CreateDiscoveryJob(ctx context.Context, arg CreateDiscoveryJobParams) (DiscoveryJob, error)
 	CreateDiscoveryProfile(ctx context.Context, arg CreateDiscoveryProfileParams) (DiscoveryProfile, error)
+	// With reject_duplicate set, no row is inserted when a live monitor already polls
+	// ip_address with plugin_id.
 	CreateMonitor(ctx context.Context, arg CreateMonitorParams) (Monitor, error)
-	DeleteCredentialProfile(ctx context.Context, id int64) error
+	CreateUser(ctx context.Context, arg CreateUserParams) (User, error)
+	// Soft delete; returns 0 rows affected if the profile does not exist or is already deleted.
+	DeleteCredentialProfile(ctx context.Context, id int64) (int64, error)
 	DeleteDiscoveredDevice(ctx context.Context, id int64) error
-	DeleteDiscoveryProfile(ctx context.Context, id int64) error
-	DeleteMonitor(ctx context.Context, id int64) error
+	// Soft delete; returns 0 rows affected if the profile does not exist or is already deleted.
+	DeleteDiscoveryProfile(ctx context.Context, id int64) (int64, error)
+	// Deletes up to limit_count hourly rollups whose bucket is older than the cutoff.
+	// Bounded like DeleteMetricsOlderThan so retention never holds one long lock.
+	DeleteMetricRollupsOlderThan(ctx context.Context, arg DeleteMetricRollupsOlderThanParams) (int64, error)
+	// Deletes raw metrics in [start_time, end_time) once they have been rolled up.
+	DeleteMetricsInRange(ctx context.Context, arg DeleteMetricsInRangeParams) (int64, error)
+	// Deletes up to limit_count metrics older than the cutoff.
+	// Bounded so retention runs as many short deletes instead of one long lock.
+	DeleteMetricsOlderThan(ctx context.Context, arg DeleteMetricsOlderThanParams) (int64, error)
+	// Soft delete; returns 0 rows affected if the monitor does not exist or is already deleted.
+	DeleteMonitor(ctx context.Context, id int64) (int64, error)
+	// Prunes transitions older than the retention cutoff.
+	DeleteMonitorStateHistoryBefore(ctx context.Context, cutoff time.Time) (int64, error)
+	DeleteUser(ctx context.Context, id int64) (int64, error)
+	// Marks jobs of instance_id (or of no instance) still queued/running since before
+	// updated_before as failed. Used at worker startup: runs owned by a previous process
+	// of this instance can never finish. Other instances' runs are left alone.
+	FailUnfinishedDiscoveryJobs(ctx context.Context, arg FailUnfinishedDiscoveryJobsParams) (int64, error)
 	// Get all unique metric names (for discovery/autocomplete)
 	GetAllMetricNames(ctx context.Context, deviceIds []int64) ([]string, error)
+	// Averages each series into one-hour or one-day buckets aligned to timezone's wall clock,
+	// over the whole range with no per-series limit. Raw metrics cover rollup_before onwards;
+	// earlier hours come from metrics_rollup, weighted by their sample counts.
+	GetBucketedMetricsByDeviceAndPrefix(ctx context.Context, arg GetBucketedMetricsByDeviceAndPrefixParams) ([]GetBucketedMetricsByDeviceAndPrefixRow, error)
 	GetCredentialProfile(ctx context.Context, id int64) (CredentialProfile, error)
+	// Protocol only, for checking a monitor's plugin against its credential.
+	GetCredentialProfileProtocol(ctx context.Context, id int64) (string, error)
+	// ETag validator for ListCredentialProfiles without fetching rows: the count and the latest
+	// update or soft delete change whenever a listed row does.
+	GetCredentialProfilesVersion(ctx context.Context, includeDeleted bool) (GetCredentialProfilesVersionRow, error)
 	GetDiscoveredDevice(ctx context.Context, id int64) (DiscoveredDevice, error)
+	GetDiscoveryJob(ctx context.Context, id int64) (DiscoveryJob, error)
 	GetDiscoveryProfile(ctx context.Context, id int64) (DiscoveryProfile, error)
+	// ETag validator for ListDiscoveryProfiles without fetching rows: the count and the latest
+	// update or soft delete change whenever a listed row does.
+	GetDiscoveryProfilesVersion(ctx context.Context, includeDeleted bool) (GetDiscoveryProfilesVersionRow, error)
 	// Returns only monitor IDs that exist and are not soft-deleted.
 	// Used to validate a batch of IDs before metrics queries.
 	GetExistingMonitorIDs(ctx context.Context, monitorIds []int64) ([]int64, error)
+	// The newest run of a profile with an ID below before_id that scanned its whole target
+	// and recorded every device it found. Runs that found nothing still count: every device
+	// seen before is gone.
+	GetLastFinishedDiscoveryJob(ctx context.Context, arg GetLastFinishedDiscoveryJobParams) (DiscoveryJob, error)
+	// The transition in effect at a point in time, i.e. the state a window starts in.
+	GetLastMonitorStateChangeBefore(ctx context.Context, arg GetLastMonitorStateChangeBeforeParams) (MonitorStateHistory, error)
+	// Latest value of every metric for a single device, looking back to since
+	GetLatestMetricsByDevice(ctx context.Context, arg GetLatestMetricsByDeviceParams) ([]Metric, error)
 	// Query the latest value for each metric (per device) with prefix matching
 	GetLatestMetricsByDeviceAndPrefix(ctx context.Context, arg GetLatestMetricsByDeviceAndPrefixParams) ([]Metric, error)
+	// Newest hourly rollup of each metric (per device) with prefix matching.
+	// Latest-value reads fall back to it for series with no raw point left in range.
+	GetLatestRollupMetricsByDeviceAndPrefix(ctx context.Context, arg GetLatestRollupMetricsByDeviceAndPrefixParams) ([]MetricsRollup, error)
 	// Query metrics for devices with per-metric limiting using LATERAL JOIN
 	// Returns top N rows per (device_id, metric_name) group ordered by timestamp DESC
 	GetMetricsByDeviceAndPrefix(ctx context.Context, arg GetMetricsByDeviceAndPrefixParams) ([]Metric, error)
 	GetMonitor(ctx context.Context, id int64) (Monitor, error)
+	// Finds the oldest live monitor polling ip_address with plugin_id (pgx.ErrNoRows if none).
+	// Used to catch duplicate monitors at creation and during auto-provisioning.
+	GetMonitorByIPAndPlugin(ctx context.Context, arg GetMonitorByIPAndPluginParams) (Monitor, error)
+	GetMonitorHostKey(ctx context.Context, monitorID int64) (MonitorHostKey, error)
+	// GetMonitor that also finds soft-deleted monitors, for reports over their history.
+	GetMonitorIncludingDeleted(ctx context.Context, id int64) (Monitor, error)
 	// Fetches a single monitor with its credential data.
 	// Used for efficient cache invalidation.
 	GetMonitorWithCredentials(ctx context.Context, id int64) (GetMonitorWithCredentialsRow, error)
 	GetMonitorsByCredentialID(ctx context.Context, credentialProfileID int64) ([]int64, error)
+	// ETag validator for ListMonitors without fetching rows: the count and the latest
+	// update or soft delete change whenever a listed row does.
+	GetMonitorsVersion(ctx context.Context, includeDeleted bool) (GetMonitorsVersionRow, error)
 	// Fetches all monitors using a specific credential profile, with their credential data.
 	// Used for efficient cache invalidation when a credential profile changes.
 	GetMonitorsWithCredentialsByCredentialID(ctx context.Context, credentialProfileID int64) ([]GetMonitorsWithCredentialsByCredentialIDRow, error)
-	// Loads active monitors with their credential data in a single query.
-	// Used by scheduler to initialize cache at startup.
+	// Returns the newest raw metric timestamp (pgx.ErrNoRows if there are none).
+	// Used by the metrics pipeline check to confirm metrics are still being written.
+	GetNewestMetricTimestamp(ctx context.Context) (time.Time, error)
+	// Returns the oldest raw metric timestamp before the cutoff (pgx.ErrNoRows if none).
+	GetOldestMetricTimestampBefore(ctx context.Context, cutoff time.Time) (time.Time, error)
+	// Counts reachable (active or stale) monitors, which should be producing metrics, and
+	// their shortest polling interval (NULL is the 60 second default; 0 with no monitors).
+	GetPolledMonitorSummary(ctx context.Context) (GetPolledMonitorSummaryRow, error)
+	// Query hourly rollups for devices with per-metric limiting using LATERAL JOIN
+	// Mirrors GetMetricsByDeviceAndPrefix for time ranges older than the rollup threshold
+	GetRollupMetricsByDeviceAndPrefix(ctx context.Context, arg GetRollupMetricsByDeviceAndPrefixParams) ([]MetricsRollup, error)
+	GetUserByUsername(ctx context.Context, username string) (User, error)
+	InsertMonitorStateChange(ctx context.Context, arg InsertMonitorStateChangeParams) error
+	// Resolves an SNMP trap's source address to the active monitors of that device.
+	ListActiveMonitorIDsByIP(ctx context.Context, ipAddress netip.Addr) ([]int64, error)
+	// Loads active monitors, and down monitors that keep polling, with their credential
+	// data in a single query. Used by scheduler to initialize cache at startup.
 	ListActiveMonitorsWithCredentials(ctx context.Context) ([]ListActiveMonitorsWithCredentialsRow, error)
+	// Most recently archived first; edits to an archived monitor do not reorder it.
+	ListArchivedMonitors(ctx context.Context) ([]Monitor, error)
 	ListAllDiscoveredDevices(ctx context.Context) ([]DiscoveredDevice, error)
-	ListCredentialProfiles(ctx context.Context) ([]CredentialProfile, error)
+	// Pages through live credential profiles by ID, after after_id, for the credential verifier.
+	ListCredentialPayloadsPage(ctx context.Context, arg ListCredentialPayloadsPageParams) ([]ListCredentialPayloadsPageRow, error)
+	ListCredentialProfiles(ctx context.Context, includeDeleted bool) ([]CredentialProfile, error)
+	// Batch form of GetCredentialProfile for bulk provisioning; missing or deleted IDs are left out.
+	ListCredentialProfilesByIDs(ctx context.Context, credentialProfileIds []int64) ([]CredentialProfile, error)
 	ListDiscoveredDevices(ctx context.Context, discoveryProfileID pgtype.Int8) ([]DiscoveredDevice, error)
-	ListDiscoveryProfiles(ctx context.Context) ([]DiscoveryProfile, error)
-	ListMonitors(ctx context.Context) ([]Monitor, error)
+	// Batch form of GetDiscoveredDevice for bulk provisioning; missing IDs are left out.
+	ListDiscoveredDevicesByIDs(ctx context.Context, deviceIds []int64) ([]DiscoveredDevice, error)
+	// Fleet-wide inventory across profiles, newest first, paged by ID below before_id (0 for
+	// the first page). monitor_id is a live monitor on the device's address and port, if any,
+	// whatever the device's status says; a monitor without a port is matched on its plugin's
+	// default, given as parallel plugin_ids and default_ports arrays. ip matches a single
+	// address or a CIDR range.
+	ListDiscoveredDevicesFiltered(ctx context.Context, arg ListDiscoveredDevicesFilteredParams) ([]ListDiscoveredDevicesFilteredRow, error)
+	// Distinct addresses that responded during one discovery run.
+	ListDiscoveryJobDeviceIPs(ctx context.Context, discoveryJobID pgtype.Int8) ([]netip.Addr, error)
+	ListDiscoveryJobsByProfile(ctx context.Context, arg ListDiscoveryJobsByProfileParams) ([]DiscoveryJob, error)
+	ListDiscoveryProfiles(ctx context.Context, includeDeleted bool) ([]DiscoveryProfile, error)
+	// Batch form of GetDiscoveryProfile for bulk provisioning; missing or deleted IDs are left out.
+	ListDiscoveryProfilesByIDs(ctx context.Context, profileIds []int64) ([]DiscoveryProfile, error)
+	// Pages through live discovery profiles' encrypted targets by ID, after after_id, for the
+	// credential verifier.
+	ListDiscoveryTargetsPage(ctx context.Context, arg ListDiscoveryTargetsPageParams) ([]ListDiscoveryTargetsPageRow, error)
+	// Returns scheduled profiles whose interval has elapsed since their last run.
+	// Profiles that never ran are due immediately.
+	ListDueDiscoveryProfiles(ctx context.Context) ([]DiscoveryProfile, error)
+	ListGroupsForMonitor(ctx context.Context, monitorID int64) ([]string, error)
+	// Live, unpaused monitors of a plugin that are opted in to host key verification.
+	ListHostKeyChecks(ctx context.Context, pluginID string) ([]ListHostKeyChecksRow, error)
+	ListMonitorGroups(ctx context.Context) ([]ListMonitorGroupsRow, error)
+	// Resolves a group to the IDs of its non-archived monitors (for group-scoped metrics queries).
+	ListMonitorIDsByGroup(ctx context.Context, groupName string) ([]int64, error)
+	// Every transition of one monitor within [start_time, end_time), oldest first.
+	ListMonitorStateChanges(ctx context.Context, arg ListMonitorStateChangesParams) ([]MonitorStateHistory, error)
+	// Transitions of one monitor within [start_time, end_time), newest first.
+	ListMonitorStateHistory(ctx context.Context, arg ListMonitorStateHistoryParams) ([]MonitorStateHistory, error)
+	// Archived monitors are listed separately via ListArchivedMonitors.
+	ListMonitors(ctx context.Context, includeDeleted bool) ([]Monitor, error)
+	ListMonitorsByGroup(ctx context.Context, groupName string) ([]Monitor, error)
+	ListUsers(ctx context.Context) ([]User, error)
+	// Deletes a profile's finished runs beyond the newest keep, bounding run history.
+	// Devices found by a deleted run keep their row with discovery_job_id set to NULL.
+	PruneDiscoveryJobs(ctx context.Context, arg PruneDiscoveryJobsParams) (int64, error)
+	RecordHostKeyMatch(ctx context.Context, monitorID int64) error
+	// Stores a differing key; affects no rows if this key was already reported,
+	// so each change is alerted once rather than on every check.
+	RecordHostKeyMismatch(ctx context.Context, arg RecordHostKeyMismatchParams) (int64, error)
+	RemoveMonitorFromGroup(ctx context.Context, arg RemoveMonitorFromGroupParams) (int64, error)
+	// Reactivates an archived monitor; returns no rows if it is not archived.
+	RestoreArchivedMonitor(ctx context.Context, id int64) (Monitor, error)
+	// Undeletes a soft-deleted profile; returns no rows if it is not deleted.
+	RestoreCredentialProfile(ctx context.Context, id int64) (CredentialProfile, error)
+	// Undeletes a soft-deleted monitor whose credential profile is still live;
+	// returns no rows otherwise.
+	RestoreDeletedMonitor(ctx context.Context, id int64) (Monitor, error)
+	// Undeletes a soft-deleted profile whose credential profile is still live;
+	// returns no rows otherwise.
+	RestoreDiscoveryProfile(ctx context.Context, id int64) (DiscoveryProfile, error)
+	// Aggregates raw metrics in [start_time, end_time) into hourly min/avg/max buckets.
+	// Merges into existing buckets so a re-run after a partial failure stays correct.
+	RollupMetricsRange(ctx context.Context, arg RollupMetricsRangeParams) (int64, error)
+	// Replaces a monitor's group memberships with group_names in one statement.
+	SetDiscoveryJobSummary(ctx context.Context, arg SetDiscoveryJobSummaryParams) error
+	SetMonitorGroups(ctx context.Context, arg SetMonitorGroupsParams) error
+	// Opts a monitor in or out of host key verification, keeping any known fingerprint.
+	SetMonitorHostKeyTracking(ctx context.Context, arg SetMonitorHostKeyTrackingParams) (MonitorHostKey, error)
+	TouchMonitorHostKey(ctx context.Context, monitorID int64) error
+	// Records fingerprint as the known host key, on first contact or when a change is accepted.
+	TrustMonitorHostKey(ctx context.Context, arg TrustMonitorHostKeyParams) (int64, error)
 	UpdateCredentialProfile(ctx context.Context, arg UpdateCredentialProfileParams) (CredentialProfile, error)
 	UpdateDiscoveredDeviceStatus(ctx context.Context, arg UpdateDiscoveredDeviceStatusParams) error
+	UpdateDiscoveryJobProgress(ctx context.Context, arg UpdateDiscoveryJobProgressParams) error
 	UpdateDiscoveryProfile(ctx context.Context, arg UpdateDiscoveryProfileParams) (DiscoveryProfile, error)
 	UpdateDiscoveryProfileStatus(ctx context.Context, arg UpdateDiscoveryProfileStatusParams) error
+	// With reject_duplicate set, no row is updated when another live monitor already polls
+	// the new ip_address with the new plugin_id.
 	UpdateMonitor(ctx context.Context, arg UpdateMonitorParams) (Monitor, error)
-	// Updates monitor status (active/down) and updated_at timestamp.
+	// Updates monitor status (active/down) and updated_at timestamp. down_since keeps the
+	// start of an outage across repeated "down" updates and clears once the monitor is back.
 	UpdateMonitorStatus(ctx context.Context, arg UpdateMonitorStatusParams) error
+	UpdateUserRole(ctx context.Context, arg UpdateUserRoleParams) (User, error)
 }
 
 var _ Querier = (*Queries)(nil)
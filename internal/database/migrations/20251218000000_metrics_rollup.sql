@@ -0,0 +1,34 @@
+-- +goose Up
+-- +goose StatementBegin
+
+-- Hourly aggregates of raw metrics older than metrics.rollup_after_hours.
+-- Populated by the rollup worker, which deletes the raw points it aggregates.
+CREATE TABLE IF NOT EXISTS metrics_rollup (
+    bucket TIMESTAMPTZ NOT NULL,
+    device_id BIGINT NOT NULL REFERENCES monitors(id) ON DELETE CASCADE,
+    name VARCHAR(255) NOT NULL,
+    min_value DOUBLE PRECISION NOT NULL,
+    avg_value DOUBLE PRECISION NOT NULL,
+    max_value DOUBLE PRECISION NOT NULL,
+    sample_count BIGINT NOT NULL,
+    type VARCHAR(20) DEFAULT 'gauge',
+    PRIMARY KEY (device_id, name, bucket)
+);
+
+CREATE INDEX IF NOT EXISTS idx_metrics_rollup_bucket ON metrics_rollup(bucket DESC);
+
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM timescaledb_information.hypertables WHERE hypertable_name = 'metrics_rollup') THEN
+        PERFORM create_hypertable('metrics_rollup', 'bucket', chunk_time_interval => INTERVAL '30 days');
+    END IF;
+EXCEPTION WHEN OTHERS THEN
+    NULL;
+END $$;
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS metrics_rollup CASCADE;
+-- +goose StatementEnd
@@ -0,0 +1,16 @@
+-- +goose Up
+-- +goose StatementBegin
+
+-- Recurring discovery: profiles with interval_seconds > 0 are re-run automatically
+-- once last_run_at + interval_seconds has passed. NULL or 0 disables scheduling.
+ALTER TABLE discovery_profiles ADD COLUMN IF NOT EXISTS interval_seconds INT DEFAULT NULL;
+
+CREATE INDEX IF NOT EXISTS idx_discovery_profiles_scheduled ON discovery_profiles(last_run_at) WHERE interval_seconds > 0;
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_discovery_profiles_scheduled;
+ALTER TABLE discovery_profiles DROP COLUMN IF EXISTS interval_seconds;
+-- +goose StatementEnd
@@ -0,0 +1,28 @@
+-- +goose Up
+-- +goose StatementBegin
+
+-- One row per discovery run, so status and progress survive restarts and can be
+-- polled by job ID. status: queued, running, success, partial, failed
+CREATE TABLE IF NOT EXISTS discovery_jobs (
+    id BIGINT PRIMARY KEY GENERATED ALWAYS AS IDENTITY,
+    profile_id BIGINT NOT NULL REFERENCES discovery_profiles(id) ON DELETE CASCADE,
+    status VARCHAR(20) NOT NULL DEFAULT 'queued',
+    total_targets INT NOT NULL DEFAULT 0,
+    processed_targets INT NOT NULL DEFAULT 0,
+    devices_found INT NOT NULL DEFAULT 0,
+    error TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    started_at TIMESTAMPTZ,
+    completed_at TIMESTAMPTZ,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_discovery_jobs_profile ON discovery_jobs(profile_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_discovery_jobs_unfinished ON discovery_jobs(updated_at) WHERE status IN ('queued', 'running');
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS discovery_jobs;
+-- +goose StatementEnd
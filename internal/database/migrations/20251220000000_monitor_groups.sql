@@ -0,0 +1,20 @@
+-- +goose Up
+-- +goose StatementBegin
+
+-- Named groups of monitors (e.g. "datacenter-1", "edge-routers"). A monitor can belong
+-- to any number of groups; membership goes away with the monitor.
+CREATE TABLE IF NOT EXISTS monitor_groups (
+    monitor_id BIGINT NOT NULL REFERENCES monitors(id) ON DELETE CASCADE,
+    group_name VARCHAR(100) NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (monitor_id, group_name)
+);
+
+CREATE INDEX IF NOT EXISTS idx_monitor_groups_name ON monitor_groups(group_name);
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS monitor_groups;
+-- +goose StatementEnd
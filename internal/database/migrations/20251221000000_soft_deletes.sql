@@ -0,0 +1,36 @@
+-- +goose Up
+-- +goose StatementBegin
+
+-- Deleting a credential profile, discovery profile or monitor now only sets deleted_at,
+-- so an accidental delete can be restored. Deleted rows are hidden from normal reads.
+ALTER TABLE credential_profiles ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ DEFAULT NULL;
+ALTER TABLE discovery_profiles ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ DEFAULT NULL;
+ALTER TABLE monitors ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ DEFAULT NULL;
+
+CREATE INDEX IF NOT EXISTS idx_credential_profiles_live ON credential_profiles(id) WHERE deleted_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_discovery_profiles_live ON discovery_profiles(id) WHERE deleted_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_monitors_live_credential ON monitors(credential_profile_id) WHERE deleted_at IS NULL;
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+
+-- Soft-deleted rows would reappear as live ones, so remove them first. A deleted
+-- profile that a remaining row still references cannot be removed and is kept live.
+DELETE FROM monitors WHERE deleted_at IS NOT NULL;
+UPDATE discovery_profiles d SET deleted_at = NULL
+WHERE d.deleted_at IS NOT NULL
+  AND EXISTS (SELECT 1 FROM monitors m WHERE m.discovery_profile_id = d.id);
+DELETE FROM discovery_profiles WHERE deleted_at IS NOT NULL;
+UPDATE credential_profiles c SET deleted_at = NULL
+WHERE c.deleted_at IS NOT NULL
+  AND (EXISTS (SELECT 1 FROM monitors m WHERE m.credential_profile_id = c.id)
+    OR EXISTS (SELECT 1 FROM discovery_profiles d WHERE d.credential_profile_id = c.id));
+DELETE FROM credential_profiles WHERE deleted_at IS NOT NULL;
+
+ALTER TABLE monitors DROP COLUMN IF EXISTS deleted_at;
+ALTER TABLE discovery_profiles DROP COLUMN IF EXISTS deleted_at;
+ALTER TABLE credential_profiles DROP COLUMN IF EXISTS deleted_at;
+
+-- +goose StatementEnd
@@ -0,0 +1,18 @@
+-- +goose Up
+-- +goose StatementBegin
+
+-- A discovery profile may list several credential profiles, tried in order per IP until
+-- one handshake succeeds. credential_profile_id stays the first entry of the list.
+ALTER TABLE discovery_profiles ADD COLUMN IF NOT EXISTS credential_profile_ids BIGINT[] NOT NULL DEFAULT '{}';
+UPDATE discovery_profiles SET credential_profile_ids = ARRAY[credential_profile_id] WHERE credential_profile_ids = '{}';
+
+-- The credential profile whose handshake validated the device, used when provisioning it
+ALTER TABLE discovered_devices ADD COLUMN IF NOT EXISTS credential_profile_id BIGINT REFERENCES credential_profiles(id);
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE discovered_devices DROP COLUMN IF EXISTS credential_profile_id;
+ALTER TABLE discovery_profiles DROP COLUMN IF EXISTS credential_profile_ids;
+-- +goose StatementEnd
@@ -0,0 +1,25 @@
+-- +goose Up
+-- +goose StatementBegin
+
+-- SSH host key verification, opt-in per monitor. The first key seen is trusted; a
+-- different key on a later check is kept in observed_fingerprint until an operator
+-- accepts it, so a rebuilt or impersonated host is flagged rather than silently trusted.
+CREATE TABLE IF NOT EXISTS monitor_host_keys (
+    monitor_id BIGINT PRIMARY KEY REFERENCES monitors(id) ON DELETE CASCADE,
+    enabled BOOLEAN NOT NULL DEFAULT true,
+    fingerprint TEXT,
+    observed_fingerprint TEXT,
+    trusted_at TIMESTAMPTZ,
+    changed_at TIMESTAMPTZ,
+    last_checked_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_monitor_host_keys_enabled ON monitor_host_keys(monitor_id) WHERE enabled;
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS monitor_host_keys;
+-- +goose StatementEnd
@@ -0,0 +1,13 @@
+-- +goose Up
+-- +goose StatementBegin
+
+-- Per-monitor collector selection (e.g. only "disk" on a file server). NULL runs every
+-- collector the plugin offers, which keeps existing monitors unchanged.
+ALTER TABLE monitors ADD COLUMN IF NOT EXISTS collectors TEXT[];
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE monitors DROP COLUMN IF EXISTS collectors;
+-- +goose StatementEnd
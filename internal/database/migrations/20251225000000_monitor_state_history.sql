@@ -0,0 +1,23 @@
+-- +goose Up
+-- +goose StatementBegin
+
+-- Append-only log of monitor state transitions (down, recovered, degraded, archived) so
+-- availability can be reviewed after the fact. Rows older than the configured retention
+-- are pruned by the state history worker.
+CREATE TABLE IF NOT EXISTS monitor_state_history (
+    id BIGSERIAL PRIMARY KEY,
+    monitor_id BIGINT NOT NULL REFERENCES monitors(id) ON DELETE CASCADE,
+    event_type TEXT NOT NULL,
+    failures INT NOT NULL DEFAULT 0,
+    occurred_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_monitor_state_history_monitor_time ON monitor_state_history(monitor_id, occurred_at DESC);
+CREATE INDEX IF NOT EXISTS idx_monitor_state_history_occurred_at ON monitor_state_history(occurred_at);
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS monitor_state_history;
+-- +goose StatementEnd
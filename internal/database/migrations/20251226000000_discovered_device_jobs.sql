@@ -0,0 +1,16 @@
+-- +goose Up
+-- +goose StatementBegin
+
+-- Tags each discovered device with the discovery run that found it, so consecutive runs
+-- of a profile can be compared. Rows from before this migration have no run.
+ALTER TABLE discovered_devices ADD COLUMN IF NOT EXISTS discovery_job_id BIGINT REFERENCES discovery_jobs(id) ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS idx_discovered_devices_job ON discovered_devices(discovery_job_id);
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_discovered_devices_job;
+ALTER TABLE discovered_devices DROP COLUMN IF EXISTS discovery_job_id;
+-- +goose StatementEnd
@@ -0,0 +1,13 @@
+-- +goose Up
+-- +goose StatementBegin
+
+-- Observe-only monitors stay scheduled after crossing the down threshold, so metrics
+-- resume the moment the device recovers. They are never archived while down.
+ALTER TABLE monitors ADD COLUMN IF NOT EXISTS keep_polling_when_down BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE monitors DROP COLUMN IF EXISTS keep_polling_when_down;
+-- +goose StatementEnd
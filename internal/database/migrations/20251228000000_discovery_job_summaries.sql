@@ -0,0 +1,13 @@
+-- +goose Up
+-- +goose StatementBegin
+
+-- Per-run summary written when a discovery run finishes: target counts, per-protocol
+-- breakdown, duration and a sample of handshake errors. Runs that never started keep '{}'.
+ALTER TABLE discovery_jobs ADD COLUMN IF NOT EXISTS summary JSONB NOT NULL DEFAULT '{}'::jsonb;
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE discovery_jobs DROP COLUMN IF EXISTS summary;
+-- +goose StatementEnd
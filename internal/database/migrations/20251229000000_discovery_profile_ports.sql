@@ -0,0 +1,14 @@
+-- +goose Up
+-- +goose StatementBegin
+
+-- A discovery profile may probe each address on several ports, in order, until one
+-- validates. port stays the first entry of the list; an empty list probes port alone.
+ALTER TABLE discovery_profiles ADD COLUMN IF NOT EXISTS ports INT[] NOT NULL DEFAULT '{}';
+UPDATE discovery_profiles SET ports = ARRAY[port] WHERE ports = '{}' AND port > 0;
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE discovery_profiles DROP COLUMN IF EXISTS ports;
+-- +goose StatementEnd
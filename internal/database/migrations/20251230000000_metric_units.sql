@@ -0,0 +1,15 @@
+-- +goose Up
+-- +goose StatementBegin
+
+-- Unit of a metric value as reported by its collector (e.g. "bytes", "percent").
+-- Rows written before this column existed keep a NULL unit.
+ALTER TABLE metrics ADD COLUMN IF NOT EXISTS unit VARCHAR(20);
+ALTER TABLE metrics_rollup ADD COLUMN IF NOT EXISTS unit VARCHAR(20);
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE metrics_rollup DROP COLUMN IF EXISTS unit;
+ALTER TABLE metrics DROP COLUMN IF EXISTS unit;
+-- +goose StatementEnd
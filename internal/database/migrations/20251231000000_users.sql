@@ -0,0 +1,20 @@
+-- +goose Up
+-- +goose StatementBegin
+
+-- API users and their role. The admin configured in auth.admin_username always exists
+-- besides these rows and has the admin role.
+CREATE TABLE IF NOT EXISTS users (
+    id BIGSERIAL PRIMARY KEY,
+    username VARCHAR(255) NOT NULL UNIQUE,
+    password_hash TEXT NOT NULL, -- bcrypt
+    role VARCHAR(20) NOT NULL CHECK (role IN ('admin', 'operator', 'viewer')),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS users;
+-- +goose StatementEnd
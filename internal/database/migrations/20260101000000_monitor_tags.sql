@@ -0,0 +1,18 @@
+-- +goose Up
+-- +goose StatementBegin
+
+-- Operator-defined static tags (datacenter, owner, environment, ...) merged into the
+-- tags of every metric the monitor writes.
+ALTER TABLE monitors ADD COLUMN IF NOT EXISTS tags JSONB NOT NULL DEFAULT '{}';
+
+-- Tags of a metric sample: the plugin's own tags merged over its monitor's tags.
+-- Rows written before this column existed keep NULL tags.
+ALTER TABLE metrics ADD COLUMN IF NOT EXISTS tags JSONB;
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE metrics DROP COLUMN IF EXISTS tags;
+ALTER TABLE monitors DROP COLUMN IF EXISTS tags;
+-- +goose StatementEnd
@@ -0,0 +1,13 @@
+-- +goose Up
+-- +goose StatementBegin
+
+-- Protocol the device answered on. Auto-detecting discovery may validate a device over a
+-- protocol other than its credential profile's; NULL falls back to the credential's protocol.
+ALTER TABLE discovered_devices ADD COLUMN IF NOT EXISTS protocol TEXT;
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE discovered_devices DROP COLUMN IF EXISTS protocol;
+-- +goose StatementEnd
@@ -0,0 +1,18 @@
+-- +goose Up
+-- +goose StatementBegin
+
+-- Whether a finished run's device list can be compared with other runs: 'complete' once
+-- the run scanned its whole target and every device it found was recorded, 'incomplete'
+-- otherwise. NULL while the run is unfinished.
+ALTER TABLE discovery_jobs ADD COLUMN IF NOT EXISTS results_status VARCHAR(20);
+
+UPDATE discovery_jobs
+SET results_status = CASE WHEN error IS NULL OR error = 'no devices found' THEN 'complete' ELSE 'incomplete' END
+WHERE completed_at IS NOT NULL;
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE discovery_jobs DROP COLUMN IF EXISTS results_status;
+-- +goose StatementEnd
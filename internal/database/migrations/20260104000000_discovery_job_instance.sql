@@ -0,0 +1,13 @@
+-- +goose Up
+-- +goose StatementBegin
+
+-- The server instance (server.instance_id) whose discovery worker runs the job. On startup
+-- an instance fails only its own unfinished jobs; NULL marks jobs from before the column.
+ALTER TABLE discovery_jobs ADD COLUMN IF NOT EXISTS instance_id VARCHAR(255);
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE discovery_jobs DROP COLUMN IF EXISTS instance_id;
+-- +goose StatementEnd
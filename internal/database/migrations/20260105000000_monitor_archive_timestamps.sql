@@ -0,0 +1,23 @@
+-- +goose Up
+-- +goose StatementBegin
+
+-- down_since is when the current outage began (NULL unless the monitor is down or archived);
+-- archived_at is when the reaper moved the monitor out of the active list. Both used to be
+-- read off updated_at, which every edit moves.
+ALTER TABLE monitors ADD COLUMN IF NOT EXISTS down_since TIMESTAMPTZ;
+ALTER TABLE monitors ADD COLUMN IF NOT EXISTS archived_at TIMESTAMPTZ;
+
+UPDATE monitors SET down_since = updated_at WHERE status IN ('down', 'archived');
+UPDATE monitors SET archived_at = updated_at WHERE status = 'archived';
+
+CREATE INDEX IF NOT EXISTS idx_monitors_archived ON monitors (archived_at DESC, id DESC)
+    WHERE status = 'archived' AND deleted_at IS NULL;
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_monitors_archived;
+ALTER TABLE monitors DROP COLUMN IF EXISTS archived_at;
+ALTER TABLE monitors DROP COLUMN IF EXISTS down_since;
+-- +goose StatementEnd
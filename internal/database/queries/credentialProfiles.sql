@@ -11,12 +11,31 @@ RETURNING *;
 
 -- name: GetCredentialProfile :one
 SELECT * FROM credential_profiles
-WHERE id = $1 LIMIT 1;
+WHERE id = $1 AND deleted_at IS NULL LIMIT 1;
+
+-- name: ListCredentialProfilesByIDs :many
+-- Batch form of GetCredentialProfile for bulk provisioning; missing or deleted IDs are left out.
+SELECT * FROM credential_profiles
+WHERE id = ANY(sqlc.arg(credential_profile_ids)::bigint[]) AND deleted_at IS NULL;
+
+-- name: GetCredentialProfileProtocol :one
+-- Protocol only, for checking a monitor's plugin against its credential.
+SELECT protocol FROM credential_profiles
+WHERE id = $1 AND deleted_at IS NULL;
 
 -- name: ListCredentialProfiles :many
 SELECT * FROM credential_profiles
+WHERE deleted_at IS NULL OR sqlc.arg(include_deleted)::bool
 ORDER BY name;
 
+-- name: GetCredentialProfilesVersion :one
+-- ETag validator for ListCredentialProfiles without fetching rows: the count and the latest
+-- update or soft delete change whenever a listed row does.
+SELECT COUNT(*)::bigint AS total,
+       COALESCE(MAX(GREATEST(updated_at, deleted_at)), 'epoch')::timestamptz AS last_modified
+FROM credential_profiles
+WHERE deleted_at IS NULL OR sqlc.arg(include_deleted)::bool;
+
 -- name: UpdateCredentialProfile :one
 UPDATE credential_profiles
 SET 
@@ -26,8 +45,32 @@ SET
     payload = $5,
     updated_at = NOW()
 WHERE id = $1
+  AND deleted_at IS NULL
+  AND (sqlc.narg(unmodified_since)::timestamptz IS NULL OR updated_at <= sqlc.narg(unmodified_since))
+RETURNING *;
+
+-- name: DeleteCredentialProfile :execrows
+-- Soft delete; returns 0 rows affected if the profile does not exist or is already deleted.
+UPDATE credential_profiles
+SET deleted_at = NOW()
+WHERE id = $1 AND deleted_at IS NULL;
+
+-- name: RestoreCredentialProfile :one
+-- Undeletes a soft-deleted profile; returns no rows if it is not deleted.
+UPDATE credential_profiles
+SET deleted_at = NULL, updated_at = NOW()
+WHERE id = $1 AND deleted_at IS NOT NULL
 RETURNING *;
 
--- name: DeleteCredentialProfile :exec
-DELETE FROM credential_profiles
-WHERE id = $1;
+-- name: CountCredentialProfileReferences :one
+-- Live monitors and discovery profiles still using a credential profile.
+SELECT
+    (SELECT COUNT(*) FROM monitors m WHERE m.credential_profile_id = $1 AND m.deleted_at IS NULL)::int AS monitors,
+    (SELECT COUNT(*) FROM discovery_profiles d WHERE (d.credential_profile_id = $1 OR $1 = ANY(d.credential_profile_ids)) AND d.deleted_at IS NULL)::int AS discovery_profiles;
+
+-- name: ListCredentialPayloadsPage :many
+-- Pages through live credential profiles by ID, after after_id, for the credential verifier.
+SELECT id, name, payload FROM credential_profiles
+WHERE id > sqlc.arg(after_id) AND deleted_at IS NULL
+ORDER BY id
+LIMIT sqlc.arg(limit_count);
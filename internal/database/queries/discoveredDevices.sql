@@ -1,8 +1,8 @@
 -- name: CreateDiscoveredDevice :one
 INSERT INTO discovered_devices (
-    discovery_profile_id, ip_address, port, status
+    discovery_profile_id, ip_address, port, status, credential_profile_id, discovery_job_id, protocol
 ) VALUES (
-    $1, $2, $3, $4
+    $1, $2, $3, $4, $5, $6, $7
 )
 RETURNING *;
 
@@ -26,6 +26,11 @@ WHERE id = $1;
 SELECT * FROM discovered_devices
 WHERE id = $1;
 
+-- name: ListDiscoveredDevicesByIDs :many
+-- Batch form of GetDiscoveredDevice for bulk provisioning; missing IDs are left out.
+SELECT * FROM discovered_devices
+WHERE id = ANY(sqlc.arg(device_ids)::bigint[]);
+
 -- name: DeleteDiscoveredDevice :exec
 DELETE FROM discovered_devices
 WHERE id = $1;
@@ -33,3 +38,50 @@ WHERE id = $1;
 -- name: ClearDiscoveredDevices :exec
 DELETE FROM discovered_devices
 WHERE discovery_profile_id = $1;
+
+-- name: ListDiscoveryJobDeviceIPs :many
+-- Distinct addresses that responded during one discovery run.
+SELECT DISTINCT ip_address FROM discovered_devices
+WHERE discovery_job_id = $1
+ORDER BY ip_address;
+
+-- name: ListDiscoveredDevicesFiltered :many
+-- Fleet-wide inventory across profiles, newest first, paged by ID below before_id (0 for
+-- the first page). monitor_id is a live monitor on the device's address and port, if any,
+-- whatever the device's status says; a monitor without a port is matched on its plugin's
+-- default, given as parallel plugin_ids and default_ports arrays. ip matches a single
+-- address or a CIDR range.
+SELECT d.id, d.discovery_profile_id, d.ip_address, d.port, d.status, d.created_at, d.updated_at,
+    d.credential_profile_id, d.discovery_job_id, d.protocol, m.id AS monitor_id,
+    (m.id IS NOT NULL)::bool AS provisioned
+FROM discovered_devices d
+LEFT JOIN LATERAL (
+    SELECT mon.id FROM monitors mon
+    LEFT JOIN unnest(sqlc.arg(plugin_ids)::text[], sqlc.arg(default_ports)::int[]) AS dp(plugin_id, port)
+        ON dp.plugin_id = mon.plugin_id
+    WHERE mon.ip_address = d.ip_address AND COALESCE(mon.port, dp.port) = d.port
+      AND mon.deleted_at IS NULL
+    ORDER BY mon.id
+    LIMIT 1
+) m ON TRUE
+WHERE (sqlc.narg(status)::text IS NULL OR d.status = sqlc.narg(status))
+  AND (sqlc.narg(profile_id)::bigint IS NULL OR d.discovery_profile_id = sqlc.narg(profile_id))
+  AND (sqlc.narg(ip)::inet IS NULL OR d.ip_address <<= sqlc.narg(ip))
+  AND (sqlc.narg(provisioned)::bool IS NULL OR (m.id IS NOT NULL) = sqlc.narg(provisioned))
+  AND (sqlc.arg(before_id)::bigint = 0 OR d.id < sqlc.arg(before_id))
+ORDER BY d.id DESC
+LIMIT sqlc.arg(limit_count);
+
+-- name: CountDiscoveredDevicesFiltered :one
+-- Total for ListDiscoveredDevicesFiltered's filters, across all pages.
+SELECT COUNT(*) FROM discovered_devices d
+WHERE (sqlc.narg(status)::text IS NULL OR d.status = sqlc.narg(status))
+  AND (sqlc.narg(profile_id)::bigint IS NULL OR d.discovery_profile_id = sqlc.narg(profile_id))
+  AND (sqlc.narg(ip)::inet IS NULL OR d.ip_address <<= sqlc.narg(ip))
+  AND (sqlc.narg(provisioned)::bool IS NULL OR EXISTS (
+    SELECT 1 FROM monitors mon
+    LEFT JOIN unnest(sqlc.arg(plugin_ids)::text[], sqlc.arg(default_ports)::int[]) AS dp(plugin_id, port)
+        ON dp.plugin_id = mon.plugin_id
+    WHERE mon.ip_address = d.ip_address AND COALESCE(mon.port, dp.port) = d.port
+      AND mon.deleted_at IS NULL
+  ) = sqlc.narg(provisioned));
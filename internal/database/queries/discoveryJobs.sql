@@ -0,0 +1,86 @@
+-- name: CreateDiscoveryJob :one
+INSERT INTO discovery_jobs (
+    profile_id, status, instance_id
+) VALUES (
+    $1, $2, $3
+)
+RETURNING *;
+
+-- name: GetDiscoveryJob :one
+SELECT * FROM discovery_jobs
+WHERE id = $1;
+
+-- name: ListDiscoveryJobsByProfile :many
+SELECT * FROM discovery_jobs
+WHERE profile_id = $1
+ORDER BY created_at DESC
+LIMIT $2;
+
+-- name: UpdateDiscoveryJobProgress :exec
+UPDATE discovery_jobs
+SET
+    status = $2,
+    total_targets = $3,
+    processed_targets = $4,
+    devices_found = $5,
+    started_at = COALESCE(started_at, NOW()),
+    updated_at = NOW()
+WHERE id = $1;
+
+-- name: CompleteDiscoveryJob :exec
+UPDATE discovery_jobs
+SET
+    status = $2,
+    devices_found = $3,
+    error = $4,
+    results_status = $5,
+    completed_at = NOW(),
+    updated_at = NOW()
+WHERE id = $1;
+
+-- name: FailUnfinishedDiscoveryJobs :execrows
+-- Marks jobs of instance_id (or of no instance) still queued/running since before
+-- updated_before as failed. Used at worker startup: runs owned by a previous process
+-- of this instance can never finish. Other instances' runs are left alone.
+UPDATE discovery_jobs
+SET
+    status = 'failed',
+    error = 'interrupted by server restart',
+    results_status = 'incomplete',
+    completed_at = NOW(),
+    updated_at = NOW()
+WHERE status IN ('queued', 'running')
+  AND (instance_id = sqlc.arg(instance_id) OR instance_id IS NULL)
+  AND updated_at < sqlc.arg(updated_before)::timestamptz;
+
+-- name: GetLastFinishedDiscoveryJob :one
+-- The newest run of a profile with an ID below before_id that scanned its whole target
+-- and recorded every device it found. Runs that found nothing still count: every device
+-- seen before is gone.
+SELECT * FROM discovery_jobs
+WHERE profile_id = sqlc.arg(profile_id)
+  AND id < sqlc.arg(before_id)
+  AND results_status = 'complete'
+ORDER BY id DESC
+LIMIT 1;
+
+-- name: SetDiscoveryJobSummary :exec
+UPDATE discovery_jobs
+SET
+    summary = $2,
+    updated_at = NOW()
+WHERE id = $1;
+
+-- name: PruneDiscoveryJobs :execrows
+-- Deletes a profile's finished runs beyond the newest keep, bounding run history.
+-- Devices found by a deleted run keep their row with discovery_job_id set to NULL.
+DELETE FROM discovery_jobs
+WHERE profile_id = sqlc.arg(profile_id)
+  AND completed_at IS NOT NULL
+  AND id NOT IN (
+      SELECT id FROM discovery_jobs
+      WHERE profile_id = sqlc.arg(profile_id)
+        AND completed_at IS NOT NULL
+      ORDER BY id DESC
+      LIMIT sqlc.arg(keep)::int
+  );
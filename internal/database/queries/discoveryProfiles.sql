@@ -1,18 +1,32 @@
 -- name: ListDiscoveryProfiles :many
 SELECT * FROM discovery_profiles
+WHERE deleted_at IS NULL OR sqlc.arg(include_deleted)::bool
 ORDER BY created_at DESC;
 
+-- name: GetDiscoveryProfilesVersion :one
+-- ETag validator for ListDiscoveryProfiles without fetching rows: the count and the latest
+-- update or soft delete change whenever a listed row does.
+SELECT COUNT(*)::bigint AS total,
+       COALESCE(MAX(GREATEST(updated_at, deleted_at)), 'epoch')::timestamptz AS last_modified
+FROM discovery_profiles
+WHERE deleted_at IS NULL OR sqlc.arg(include_deleted)::bool;
+
 -- name: CreateDiscoveryProfile :one
 INSERT INTO discovery_profiles (
-    name, target_value, port, port_scan_timeout_ms, credential_profile_id, auto_provision, auto_run
+    name, target_value, port, port_scan_timeout_ms, credential_profile_id, auto_provision, auto_run, interval_seconds, credential_profile_ids, ports
 ) VALUES (
-    $1, $2, $3, $4, $5, $6, $7
+    $1, $2, $3, $4, $5, $6, $7, $8, $9, $10
 )
 RETURNING *;
 
 -- name: GetDiscoveryProfile :one
 SELECT * FROM discovery_profiles
-WHERE id = $1;
+WHERE id = $1 AND deleted_at IS NULL;
+
+-- name: ListDiscoveryProfilesByIDs :many
+-- Batch form of GetDiscoveryProfile for bulk provisioning; missing or deleted IDs are left out.
+SELECT * FROM discovery_profiles
+WHERE id = ANY(sqlc.arg(profile_ids)::bigint[]) AND deleted_at IS NULL;
 
 -- name: UpdateDiscoveryProfile :one
 UPDATE discovery_profiles
@@ -24,13 +38,35 @@ SET
     credential_profile_id = $6,
     auto_provision = $7,
     auto_run = $8,
+    interval_seconds = $9,
+    credential_profile_ids = $10,
+    ports = $11,
     updated_at = NOW()
-WHERE id = $1
+WHERE id = $1 AND deleted_at IS NULL
 RETURNING *;
 
--- name: DeleteDiscoveryProfile :exec
-DELETE FROM discovery_profiles
-WHERE id = $1;
+-- name: CountDiscoveryProfileMonitors :one
+-- Live monitors still created from a discovery profile.
+SELECT COUNT(*)::int AS monitors FROM monitors
+WHERE discovery_profile_id = $1 AND deleted_at IS NULL;
+
+-- name: DeleteDiscoveryProfile :execrows
+-- Soft delete; returns 0 rows affected if the profile does not exist or is already deleted.
+UPDATE discovery_profiles
+SET deleted_at = NOW()
+WHERE id = $1 AND deleted_at IS NULL;
+
+-- name: RestoreDiscoveryProfile :one
+-- Undeletes a soft-deleted profile whose credential profile is still live;
+-- returns no rows otherwise.
+UPDATE discovery_profiles d
+SET deleted_at = NULL, updated_at = NOW()
+WHERE d.id = $1 AND d.deleted_at IS NOT NULL
+  AND EXISTS (
+      SELECT 1 FROM credential_profiles c
+      WHERE c.id = d.credential_profile_id AND c.deleted_at IS NULL
+  )
+RETURNING d.*;
 
 -- name: UpdateDiscoveryProfileStatus :exec
 UPDATE discovery_profiles
@@ -40,3 +76,20 @@ SET
     devices_discovered = $3,
     updated_at = NOW()
 WHERE id = $1;
+
+-- name: ListDueDiscoveryProfiles :many
+-- Returns scheduled profiles whose interval has elapsed since their last run.
+-- Profiles that never ran are due immediately.
+SELECT * FROM discovery_profiles
+WHERE interval_seconds > 0
+  AND deleted_at IS NULL
+  AND (last_run_at IS NULL OR last_run_at + make_interval(secs => interval_seconds) <= NOW())
+ORDER BY last_run_at ASC NULLS FIRST;
+
+-- name: ListDiscoveryTargetsPage :many
+-- Pages through live discovery profiles' encrypted targets by ID, after after_id, for the
+-- credential verifier.
+SELECT id, name, target_value FROM discovery_profiles
+WHERE id > sqlc.arg(after_id) AND deleted_at IS NULL
+ORDER BY id
+LIMIT sqlc.arg(limit_count);
@@ -1,7 +1,7 @@
 -- name: GetMetricsByDeviceAndPrefix :many
 -- Query metrics for devices with per-metric limiting using LATERAL JOIN
 -- Returns top N rows per (device_id, metric_name) group ordered by timestamp DESC
-SELECT m.timestamp, m.device_id, m.name, m.value, m.type
+SELECT m.timestamp, m.device_id, m.name, m.value, m.type, m.unit, m.tags
 FROM (
   SELECT DISTINCT metrics.device_id, metrics.name
   FROM metrics
@@ -11,7 +11,7 @@ FROM (
     AND metrics.timestamp <= sqlc.arg(end_time)
 ) groups
 CROSS JOIN LATERAL (
-  SELECT metrics.timestamp, metrics.device_id, metrics.name, metrics.value, metrics.type
+  SELECT metrics.timestamp, metrics.device_id, metrics.name, metrics.value, metrics.type, metrics.unit, metrics.tags
   FROM metrics
   WHERE metrics.device_id = groups.device_id
     AND metrics.name = groups.name
@@ -22,10 +22,49 @@ CROSS JOIN LATERAL (
 ) m
 ORDER BY m.device_id, m.name, m.timestamp DESC;
 
+-- name: GetBucketedMetricsByDeviceAndPrefix :many
+-- Averages each series into one-hour or one-day buckets aligned to timezone's wall clock,
+-- over the whole range with no per-series limit. Raw metrics cover rollup_before onwards;
+-- earlier hours come from metrics_rollup, weighted by their sample counts.
+SELECT time_bucket(('1 ' || sqlc.arg(bucket)::text)::interval, s.ts, sqlc.arg(timezone)::text) AS bucket,
+       s.device_id,
+       s.name,
+       (SUM(s.value * s.samples) / SUM(s.samples))::double precision AS avg_value,
+       MAX(s.type) AS type,
+       MAX(s.unit) AS unit
+FROM (
+  SELECT metrics.timestamp AS ts, metrics.device_id, metrics.name, metrics.value, 1::bigint AS samples, metrics.type, metrics.unit
+  FROM metrics
+  WHERE metrics.device_id = ANY(sqlc.arg(device_ids)::bigint[])
+    AND metrics.name LIKE sqlc.arg(metric_name_pattern)
+    AND metrics.timestamp >= GREATEST(sqlc.arg(start_time)::timestamptz, sqlc.arg(rollup_before)::timestamptz)
+    AND metrics.timestamp <= sqlc.arg(end_time)
+  UNION ALL
+  SELECT metrics_rollup.bucket, metrics_rollup.device_id, metrics_rollup.name, metrics_rollup.avg_value,
+         metrics_rollup.sample_count, metrics_rollup.type, metrics_rollup.unit
+  FROM metrics_rollup
+  WHERE metrics_rollup.device_id = ANY(sqlc.arg(device_ids)::bigint[])
+    AND metrics_rollup.name LIKE sqlc.arg(metric_name_pattern)
+    AND metrics_rollup.bucket >= sqlc.arg(start_time)
+    AND metrics_rollup.bucket < sqlc.arg(rollup_before)
+    AND metrics_rollup.bucket <= sqlc.arg(end_time)
+) s
+GROUP BY 1, s.device_id, s.name
+ORDER BY s.device_id, s.name, bucket DESC;
+
+-- name: GetLatestMetricsByDevice :many
+-- Latest value of every metric for a single device, looking back to since
+SELECT DISTINCT ON (name)
+       timestamp, device_id, name, value, type, unit, tags
+FROM metrics
+WHERE device_id = sqlc.arg(device_id)
+  AND timestamp >= sqlc.arg(since)
+ORDER BY name, timestamp DESC;
+
 -- name: GetLatestMetricsByDeviceAndPrefix :many
 -- Query the latest value for each metric (per device) with prefix matching
 SELECT DISTINCT ON (device_id, name)
-       timestamp, device_id, name, value, type
+       timestamp, device_id, name, value, type, unit, tags
 FROM metrics
 WHERE device_id = ANY(sqlc.arg(device_ids)::bigint[])
   AND name LIKE sqlc.arg(metric_name_pattern)
@@ -39,3 +78,36 @@ SELECT DISTINCT name
 FROM metrics
 WHERE device_id = ANY(sqlc.arg(device_ids)::bigint[])
 ORDER BY name;
+
+-- name: DeleteMetricsOlderThan :execrows
+-- Deletes up to limit_count metrics older than the cutoff.
+-- Bounded so retention runs as many short deletes instead of one long lock.
+DELETE FROM metrics
+WHERE (device_id, name, timestamp) IN (
+  SELECT metrics.device_id, metrics.name, metrics.timestamp
+  FROM metrics
+  WHERE metrics.timestamp < sqlc.arg(cutoff)
+  LIMIT sqlc.arg(limit_count)
+);
+
+-- name: GetNewestMetricTimestamp :one
+-- Returns the newest raw metric timestamp (pgx.ErrNoRows if there are none).
+-- Used by the metrics pipeline check to confirm metrics are still being written.
+SELECT timestamp
+FROM metrics
+ORDER BY timestamp DESC
+LIMIT 1;
+
+-- name: GetOldestMetricTimestampBefore :one
+-- Returns the oldest raw metric timestamp before the cutoff (pgx.ErrNoRows if none).
+SELECT timestamp
+FROM metrics
+WHERE timestamp < sqlc.arg(cutoff)
+ORDER BY timestamp ASC
+LIMIT 1;
+
+-- name: DeleteMetricsInRange :execrows
+-- Deletes raw metrics in [start_time, end_time) once they have been rolled up.
+DELETE FROM metrics
+WHERE timestamp >= sqlc.arg(start_time)
+  AND timestamp < sqlc.arg(end_time);
@@ -0,0 +1,72 @@
+-- name: RollupMetricsRange :execrows
+-- Aggregates raw metrics in [start_time, end_time) into hourly min/avg/max buckets.
+-- Merges into existing buckets so a re-run after a partial failure stays correct.
+INSERT INTO metrics_rollup (bucket, device_id, name, min_value, avg_value, max_value, sample_count, type, unit)
+SELECT date_trunc('hour', metrics.timestamp) AS bucket,
+       metrics.device_id,
+       metrics.name,
+       MIN(metrics.value),
+       AVG(metrics.value),
+       MAX(metrics.value),
+       COUNT(*),
+       MAX(metrics.type),
+       MAX(metrics.unit)
+FROM metrics
+WHERE metrics.timestamp >= sqlc.arg(start_time)
+  AND metrics.timestamp < sqlc.arg(end_time)
+GROUP BY date_trunc('hour', metrics.timestamp), metrics.device_id, metrics.name
+ON CONFLICT (device_id, name, bucket) DO UPDATE SET
+    min_value = LEAST(metrics_rollup.min_value, EXCLUDED.min_value),
+    max_value = GREATEST(metrics_rollup.max_value, EXCLUDED.max_value),
+    avg_value = (metrics_rollup.avg_value * metrics_rollup.sample_count + EXCLUDED.avg_value * EXCLUDED.sample_count)
+                / (metrics_rollup.sample_count + EXCLUDED.sample_count),
+    sample_count = metrics_rollup.sample_count + EXCLUDED.sample_count,
+    unit = COALESCE(metrics_rollup.unit, EXCLUDED.unit);
+
+-- name: DeleteMetricRollupsOlderThan :execrows
+-- Deletes up to limit_count hourly rollups whose bucket is older than the cutoff.
+-- Bounded like DeleteMetricsOlderThan so retention never holds one long lock.
+DELETE FROM metrics_rollup
+WHERE (device_id, name, bucket) IN (
+  SELECT metrics_rollup.device_id, metrics_rollup.name, metrics_rollup.bucket
+  FROM metrics_rollup
+  WHERE metrics_rollup.bucket < sqlc.arg(cutoff)
+  LIMIT sqlc.arg(limit_count)
+);
+
+-- name: GetLatestRollupMetricsByDeviceAndPrefix :many
+-- Newest hourly rollup of each metric (per device) with prefix matching.
+-- Latest-value reads fall back to it for series with no raw point left in range.
+SELECT DISTINCT ON (device_id, name)
+       bucket, device_id, name, min_value, avg_value, max_value, sample_count, type, unit
+FROM metrics_rollup
+WHERE device_id = ANY(sqlc.arg(device_ids)::bigint[])
+  AND name LIKE sqlc.arg(metric_name_pattern)
+  AND bucket >= sqlc.arg(start_time)
+  AND bucket <= sqlc.arg(end_time)
+ORDER BY device_id, name, bucket DESC;
+
+-- name: GetRollupMetricsByDeviceAndPrefix :many
+-- Query hourly rollups for devices with per-metric limiting using LATERAL JOIN
+-- Mirrors GetMetricsByDeviceAndPrefix for time ranges older than the rollup threshold
+SELECT r.bucket, r.device_id, r.name, r.min_value, r.avg_value, r.max_value, r.sample_count, r.type, r.unit
+FROM (
+  SELECT DISTINCT metrics_rollup.device_id, metrics_rollup.name
+  FROM metrics_rollup
+  WHERE metrics_rollup.device_id = ANY(sqlc.arg(device_ids)::bigint[])
+    AND metrics_rollup.name LIKE sqlc.arg(metric_name_pattern)
+    AND metrics_rollup.bucket >= sqlc.arg(start_time)
+    AND metrics_rollup.bucket <= sqlc.arg(end_time)
+) groups
+CROSS JOIN LATERAL (
+  SELECT metrics_rollup.bucket, metrics_rollup.device_id, metrics_rollup.name, metrics_rollup.min_value,
+         metrics_rollup.avg_value, metrics_rollup.max_value, metrics_rollup.sample_count, metrics_rollup.type, metrics_rollup.unit
+  FROM metrics_rollup
+  WHERE metrics_rollup.device_id = groups.device_id
+    AND metrics_rollup.name = groups.name
+    AND metrics_rollup.bucket >= sqlc.arg(start_time)
+    AND metrics_rollup.bucket <= sqlc.arg(end_time)
+  ORDER BY metrics_rollup.bucket DESC
+  LIMIT sqlc.arg(limit_count)
+) r
+ORDER BY r.device_id, r.name, r.bucket DESC;
@@ -0,0 +1,52 @@
+-- name: AddMonitorToGroup :exec
+INSERT INTO monitor_groups (
+    monitor_id, group_name
+) VALUES (
+    $1, $2
+)
+ON CONFLICT DO NOTHING;
+
+-- name: RemoveMonitorFromGroup :execrows
+DELETE FROM monitor_groups
+WHERE monitor_id = $1 AND group_name = $2;
+
+-- name: SetMonitorGroups :exec
+-- Replaces a monitor's group memberships with group_names in one statement.
+WITH removed AS (
+    DELETE FROM monitor_groups
+    WHERE monitor_id = sqlc.arg(monitor_id)
+      AND group_name <> ALL(sqlc.arg(group_names)::text[])
+)
+INSERT INTO monitor_groups (monitor_id, group_name)
+SELECT sqlc.arg(monitor_id), unnest(sqlc.arg(group_names)::text[])
+ON CONFLICT DO NOTHING;
+
+-- name: ListGroupsForMonitor :many
+SELECT group_name FROM monitor_groups
+WHERE monitor_id = $1
+ORDER BY group_name;
+
+-- name: ListMonitorGroups :many
+SELECT mg.group_name, COUNT(*)::int AS monitor_count
+FROM monitor_groups mg
+JOIN monitors m ON m.id = mg.monitor_id
+WHERE m.deleted_at IS NULL
+GROUP BY mg.group_name
+ORDER BY mg.group_name;
+
+-- name: ListMonitorIDsByGroup :many
+-- Resolves a group to the IDs of its non-archived monitors (for group-scoped metrics queries).
+SELECT mg.monitor_id FROM monitor_groups mg
+JOIN monitors m ON m.id = mg.monitor_id
+WHERE mg.group_name = $1
+  AND m.status IS DISTINCT FROM 'archived'
+  AND m.deleted_at IS NULL
+ORDER BY mg.monitor_id;
+
+-- name: ListMonitorsByGroup :many
+SELECT m.* FROM monitors m
+JOIN monitor_groups mg ON mg.monitor_id = m.id
+WHERE mg.group_name = $1
+  AND m.status IS DISTINCT FROM 'archived'
+  AND m.deleted_at IS NULL
+ORDER BY m.created_at DESC;
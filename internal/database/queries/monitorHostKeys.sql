@@ -0,0 +1,53 @@
+-- name: GetMonitorHostKey :one
+SELECT * FROM monitor_host_keys
+WHERE monitor_id = $1;
+
+-- name: SetMonitorHostKeyTracking :one
+-- Opts a monitor in or out of host key verification, keeping any known fingerprint.
+INSERT INTO monitor_host_keys (
+    monitor_id, enabled
+) VALUES (
+    $1, $2
+)
+ON CONFLICT (monitor_id) DO UPDATE SET enabled = EXCLUDED.enabled
+RETURNING *;
+
+-- name: ListHostKeyChecks :many
+-- Live, unpaused monitors of a plugin that are opted in to host key verification.
+SELECT h.monitor_id, m.ip_address, m.port, h.fingerprint
+FROM monitor_host_keys h
+JOIN monitors m ON m.id = h.monitor_id
+WHERE h.enabled
+  AND m.plugin_id = $1
+  AND m.deleted_at IS NULL
+  AND m.status IS DISTINCT FROM 'paused'
+ORDER BY h.monitor_id;
+
+-- name: TrustMonitorHostKey :execrows
+-- Records fingerprint as the known host key, on first contact or when a change is accepted.
+UPDATE monitor_host_keys
+SET fingerprint = $2,
+    observed_fingerprint = NULL,
+    trusted_at = NOW(),
+    last_checked_at = NOW()
+WHERE monitor_id = $1;
+
+-- name: RecordHostKeyMatch :exec
+UPDATE monitor_host_keys
+SET observed_fingerprint = NULL,
+    last_checked_at = NOW()
+WHERE monitor_id = $1;
+
+-- name: RecordHostKeyMismatch :execrows
+-- Stores a differing key; affects no rows if this key was already reported,
+-- so each change is alerted once rather than on every check.
+UPDATE monitor_host_keys
+SET observed_fingerprint = $2,
+    changed_at = NOW(),
+    last_checked_at = NOW()
+WHERE monitor_id = $1 AND observed_fingerprint IS DISTINCT FROM $2;
+
+-- name: TouchMonitorHostKey :exec
+UPDATE monitor_host_keys
+SET last_checked_at = NOW()
+WHERE monitor_id = $1;
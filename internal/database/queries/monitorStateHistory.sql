@@ -0,0 +1,36 @@
+-- name: InsertMonitorStateChange :exec
+INSERT INTO monitor_state_history (
+    monitor_id, event_type, failures, occurred_at
+) VALUES (
+    $1, $2, $3, $4
+);
+
+-- name: ListMonitorStateHistory :many
+-- Transitions of one monitor within [start_time, end_time), newest first.
+SELECT * FROM monitor_state_history
+WHERE monitor_id = sqlc.arg(monitor_id)
+  AND occurred_at >= sqlc.arg(start_time)::timestamptz
+  AND occurred_at < sqlc.arg(end_time)::timestamptz
+ORDER BY occurred_at DESC, id DESC
+LIMIT sqlc.arg(row_limit);
+
+-- name: DeleteMonitorStateHistoryBefore :execrows
+-- Prunes transitions older than the retention cutoff.
+DELETE FROM monitor_state_history
+WHERE occurred_at < sqlc.arg(cutoff)::timestamptz;
+
+-- name: GetLastMonitorStateChangeBefore :one
+-- The transition in effect at a point in time, i.e. the state a window starts in.
+SELECT * FROM monitor_state_history
+WHERE monitor_id = sqlc.arg(monitor_id)
+  AND occurred_at < sqlc.arg(before)::timestamptz
+ORDER BY occurred_at DESC, id DESC
+LIMIT 1;
+
+-- name: ListMonitorStateChanges :many
+-- Every transition of one monitor within [start_time, end_time), oldest first.
+SELECT * FROM monitor_state_history
+WHERE monitor_id = sqlc.arg(monitor_id)
+  AND occurred_at >= sqlc.arg(start_time)::timestamptz
+  AND occurred_at < sqlc.arg(end_time)::timestamptz
+ORDER BY occurred_at, id;
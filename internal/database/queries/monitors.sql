@@ -1,8 +1,22 @@
 -- name: ListMonitors :many
+-- Archived monitors are listed separately via ListArchivedMonitors.
 SELECT * FROM monitors
+WHERE status IS DISTINCT FROM 'archived'
+  AND (deleted_at IS NULL OR sqlc.arg(include_deleted)::bool)
 ORDER BY created_at DESC;
 
+-- name: GetMonitorsVersion :one
+-- ETag validator for ListMonitors without fetching rows: the count and the latest
+-- update or soft delete change whenever a listed row does.
+SELECT COUNT(*)::bigint AS total,
+       COALESCE(MAX(GREATEST(updated_at, deleted_at)), 'epoch')::timestamptz AS last_modified
+FROM monitors
+WHERE status IS DISTINCT FROM 'archived'
+  AND (deleted_at IS NULL OR sqlc.arg(include_deleted)::bool);
+
 -- name: CreateMonitor :one
+-- With reject_duplicate set, no row is inserted when a live monitor already polls
+-- ip_address with plugin_id.
 INSERT INTO monitors (
     display_name,
     hostname,
@@ -12,19 +26,50 @@ INSERT INTO monitors (
     discovery_profile_id,
     port,
     polling_interval_seconds,
-    status
-) VALUES (
-    $1, $2, $3, $4, $5, $6, $7, 
-    COALESCE(sqlc.narg(polling_interval_seconds)::int, 60), 
-    COALESCE(sqlc.narg(status)::text, 'active')
+    status,
+    collectors,
+    keep_polling_when_down,
+    tags
+)
+SELECT
+    sqlc.narg(display_name)::text,
+    sqlc.narg(hostname)::text,
+    sqlc.arg(ip_address)::inet,
+    sqlc.arg(plugin_id)::text,
+    sqlc.arg(credential_profile_id)::bigint,
+    sqlc.arg(discovery_profile_id)::bigint,
+    sqlc.narg(port)::int,
+    COALESCE(sqlc.narg(polling_interval_seconds)::int, 60),
+    COALESCE(sqlc.narg(status)::text, 'active'),
+    sqlc.narg(collectors)::text[],
+    sqlc.arg(keep_polling_when_down)::bool,
+    COALESCE(sqlc.narg(tags)::jsonb, '{}')
+WHERE NOT sqlc.arg(reject_duplicate)::bool OR NOT EXISTS (
+    SELECT 1 FROM monitors d
+    WHERE d.ip_address = sqlc.arg(ip_address)::inet AND d.plugin_id = sqlc.arg(plugin_id)::text AND d.deleted_at IS NULL
 )
 RETURNING *;
 
 -- name: GetMonitor :one
 SELECT * FROM monitors
+WHERE id = $1 AND deleted_at IS NULL;
+
+-- name: GetMonitorByIPAndPlugin :one
+-- Finds the oldest live monitor polling ip_address with plugin_id (pgx.ErrNoRows if none).
+-- Used to catch duplicate monitors at creation and during auto-provisioning.
+SELECT * FROM monitors
+WHERE ip_address = $1 AND plugin_id = $2 AND deleted_at IS NULL
+ORDER BY id
+LIMIT 1;
+
+-- name: GetMonitorIncludingDeleted :one
+-- GetMonitor that also finds soft-deleted monitors, for reports over their history.
+SELECT * FROM monitors
 WHERE id = $1;
 
 -- name: UpdateMonitor :one
+-- With reject_duplicate set, no row is updated when another live monitor already polls
+-- the new ip_address with the new plugin_id.
 UPDATE monitors
 SET 
     display_name = $2,
@@ -35,36 +80,104 @@ SET
     polling_interval_seconds = $7,
     port = $8,
     status = $9,
+    down_since = CASE WHEN $9 IN ('down', 'archived') THEN COALESCE(down_since, NOW()) END,
+    archived_at = CASE WHEN $9 = 'archived' THEN COALESCE(archived_at, NOW()) END,
+    collectors = sqlc.narg(collectors)::text[],
+    keep_polling_when_down = sqlc.arg(keep_polling_when_down)::bool,
+    tags = COALESCE(sqlc.narg(tags)::jsonb, '{}'),
     updated_at = NOW()
 WHERE id = $1
+  AND deleted_at IS NULL
+  AND (sqlc.narg(unmodified_since)::timestamptz IS NULL OR updated_at <= sqlc.narg(unmodified_since))
+  AND (NOT sqlc.arg(reject_duplicate)::bool OR NOT EXISTS (
+      SELECT 1 FROM monitors d
+      WHERE d.ip_address = $4 AND d.plugin_id = $5 AND d.deleted_at IS NULL AND d.id <> $1
+  ))
 RETURNING *;
 
--- name: DeleteMonitor :exec
-DELETE FROM monitors
-WHERE id = $1;
+-- name: DeleteMonitor :execrows
+-- Soft delete; returns 0 rows affected if the monitor does not exist or is already deleted.
+UPDATE monitors
+SET deleted_at = NOW()
+WHERE id = $1 AND deleted_at IS NULL;
+
+-- name: RestoreDeletedMonitor :one
+-- Undeletes a soft-deleted monitor whose credential profile is still live;
+-- returns no rows otherwise.
+UPDATE monitors m
+SET deleted_at = NULL, updated_at = NOW()
+WHERE m.id = $1 AND m.deleted_at IS NOT NULL
+  AND EXISTS (
+      SELECT 1 FROM credential_profiles c
+      WHERE c.id = m.credential_profile_id AND c.deleted_at IS NULL
+  )
+RETURNING m.*;
+
+-- name: GetPolledMonitorSummary :one
+-- Counts reachable (active or stale) monitors, which should be producing metrics, and
+-- their shortest polling interval (NULL is the 60 second default; 0 with no monitors).
+SELECT COUNT(*)::bigint AS monitors,
+       COALESCE(MIN(COALESCE(polling_interval_seconds, 60)), 0)::int AS shortest_interval_seconds
+FROM monitors
+WHERE status IN ('active', 'stale') AND deleted_at IS NULL;
+
+-- name: ListActiveMonitorIDsByIP :many
+-- Resolves an SNMP trap's source address to the active (or stale) monitors of that device.
+SELECT id FROM monitors
+WHERE ip_address = $1 AND status IN ('active', 'stale') AND deleted_at IS NULL
+ORDER BY id;
 
 -- name: ListActiveMonitorsWithCredentials :many
--- Loads active monitors with their credential data in a single query.
--- Used by scheduler to initialize cache at startup.
+-- Loads active (and stale) monitors, and down monitors that keep polling, with their credential
+-- data in a single query. Used by scheduler to initialize cache at startup.
 SELECT 
     m.id, m.display_name, m.hostname, m.ip_address, m.plugin_id, 
     m.credential_profile_id, m.discovery_profile_id, m.port, 
     m.polling_interval_seconds, m.status, m.created_at, m.updated_at,
-    c.payload
+    m.collectors, m.keep_polling_when_down, m.tags, c.payload
 FROM monitors m
 JOIN credential_profiles c ON m.credential_profile_id = c.id
-WHERE m.status = 'active';
+WHERE (m.status IN ('active', 'stale') OR (m.status = 'down' AND m.keep_polling_when_down))
+  AND m.deleted_at IS NULL;
 
 -- name: UpdateMonitorStatus :exec
--- Updates monitor status (active/down) and updated_at timestamp.
+-- Updates monitor status (active/down) and updated_at timestamp. down_since keeps the
+-- start of an outage across repeated "down" updates and clears once the monitor is back.
 UPDATE monitors
-SET status = $2, updated_at = NOW()
-WHERE id = $1;
+SET status = $2,
+    down_since = CASE WHEN $2 IN ('down', 'archived') THEN COALESCE(down_since, NOW()) END,
+    archived_at = CASE WHEN $2 = 'archived' THEN COALESCE(archived_at, NOW()) END,
+    updated_at = NOW()
+WHERE id = $1 AND deleted_at IS NULL;
+
+-- name: ArchiveDownMonitors :many
+-- Moves monitors that have been down since before down_before to "archived".
+-- Monitors that keep polling while down are still observed and never archived.
+UPDATE monitors
+SET status = 'archived', archived_at = NOW(), updated_at = NOW()
+WHERE status = 'down'
+  AND NOT keep_polling_when_down
+  AND deleted_at IS NULL
+  AND down_since < sqlc.arg(down_before)::timestamptz
+RETURNING id, ip_address;
+
+-- name: ListArchivedMonitors :many
+-- Most recently archived first; edits to an archived monitor do not reorder it.
+SELECT * FROM monitors
+WHERE status = 'archived' AND deleted_at IS NULL
+ORDER BY archived_at DESC, id DESC;
+
+-- name: RestoreArchivedMonitor :one
+-- Reactivates an archived monitor; returns no rows if it is not archived.
+UPDATE monitors
+SET status = 'active', down_since = NULL, archived_at = NULL, updated_at = NOW()
+WHERE id = $1 AND status = 'archived' AND deleted_at IS NULL
+RETURNING *;
 
 -- name: GetExistingMonitorIDs :many
 -- Returns only monitor IDs that exist and are not soft-deleted.
 -- Used to validate a batch of IDs before metrics queries.
-SELECT id FROM monitors WHERE id = ANY(sqlc.arg(monitor_ids)::bigint[]);
+SELECT id FROM monitors WHERE id = ANY(sqlc.arg(monitor_ids)::bigint[]) AND deleted_at IS NULL;
 
 -- name: GetMonitorWithCredentials :one
 -- Fetches a single monitor with its credential data.
@@ -73,10 +186,10 @@ SELECT
     m.id, m.display_name, m.hostname, m.ip_address, m.plugin_id, 
     m.credential_profile_id, m.discovery_profile_id, m.port, 
     m.polling_interval_seconds, m.status, m.created_at, m.updated_at,
-    c.payload
+    m.collectors, m.keep_polling_when_down, m.tags, c.payload
 FROM monitors m
 JOIN credential_profiles c ON m.credential_profile_id = c.id
-WHERE m.id = $1;
+WHERE m.id = $1 AND m.deleted_at IS NULL;
 
 -- name: GetMonitorsWithCredentialsByCredentialID :many
 -- Fetches all monitors using a specific credential profile, with their credential data.
@@ -85,10 +198,10 @@ SELECT
     m.id, m.display_name, m.hostname, m.ip_address, m.plugin_id, 
     m.credential_profile_id, m.discovery_profile_id, m.port, 
     m.polling_interval_seconds, m.status, m.created_at, m.updated_at,
-    c.payload
+    m.collectors, m.keep_polling_when_down, m.tags, c.payload
 FROM monitors m
 JOIN credential_profiles c ON m.credential_profile_id = c.id
-WHERE m.credential_profile_id = $1;
+WHERE m.credential_profile_id = $1 AND m.deleted_at IS NULL;
 
 -- name: GetMonitorsByCredentialID :many
-SELECT id FROM monitors WHERE credential_profile_id = $1;
\ No newline at end of file
+SELECT id FROM monitors WHERE credential_profile_id = $1 AND deleted_at IS NULL;
\ No newline at end of file
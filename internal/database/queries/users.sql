@@ -0,0 +1,26 @@
+-- name: GetUserByUsername :one
+SELECT * FROM users
+WHERE username = $1;
+
+-- name: ListUsers :many
+SELECT * FROM users
+ORDER BY id;
+
+-- name: CreateUser :one
+INSERT INTO users (
+    username, password_hash, role
+) VALUES (
+    $1, $2, $3
+)
+RETURNING *;
+
+-- name: UpdateUserRole :one
+UPDATE users
+SET role = $2,
+    updated_at = NOW()
+WHERE id = $1
+RETURNING *;
+
+-- name: DeleteUser :execrows
+DELETE FROM users
+WHERE id = $1;
@@ -0,0 +1,154 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/nmslite/nmslite/internal/database/dbgen"
+)
+
+// ReadRouter is a dbgen.DBTX that runs queries on a read replica and retries them on the
+// primary when the replica connection fails. Exec always runs on the primary. Only
+// failures before any row is returned fail over; an error mid-iteration is returned as is.
+//
+// The replica has its own breaker: after threshold consecutive connection failures reads
+// skip it and go straight to the primary for the cooldown, so an unreachable replica does
+// not add a connect timeout to every read. The API's DBBreaker then sees the primary.
+type ReadRouter struct {
+	primary dbgen.DBTX
+	replica dbgen.DBTX
+	logger  *slog.Logger
+
+	threshold int
+	cooldown  time.Duration
+	now       func() time.Time
+
+	mu        sync.Mutex
+	failures  int
+	skipUntil time.Time
+}
+
+// NewReadRouter creates a router that prefers replica and falls back to primary
+// (threshold <= 0 uses 5, cooldown <= 0 uses 30s)
+func NewReadRouter(primary, replica dbgen.DBTX, threshold int, cooldown time.Duration) *ReadRouter {
+	if threshold <= 0 {
+		threshold = 5
+	}
+	if cooldown <= 0 {
+		cooldown = 30 * time.Second
+	}
+	return &ReadRouter{
+		primary:   primary,
+		replica:   replica,
+		logger:    slog.Default().With("component", "database"),
+		threshold: threshold,
+		cooldown:  cooldown,
+		now:       time.Now,
+	}
+}
+
+// useReplica reports whether reads should try the replica, false while it is skipped
+func (r *ReadRouter) useReplica() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return !r.now().Before(r.skipUntil)
+}
+
+// record counts a replica read's outcome; consecutive connection failures skip the replica
+func (r *ReadRouter) record(connFailed bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !connFailed {
+		r.failures = 0
+		return
+	}
+	r.failures++
+	if r.failures >= r.threshold {
+		r.failures = 0
+		r.skipUntil = r.now().Add(r.cooldown)
+		r.logger.Warn("Read replica failing, reading from primary", "cooldown", r.cooldown)
+	}
+}
+
+// Exec runs on the primary; the replica is read-only
+func (r *ReadRouter) Exec(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error) {
+	return r.primary.Exec(ctx, sql, args...)
+}
+
+// Query runs on the replica, retrying on the primary after a connection error
+func (r *ReadRouter) Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error) {
+	if !r.useReplica() {
+		return r.primary.Query(ctx, sql, args...)
+	}
+	rows, err := r.replica.Query(ctx, sql, args...)
+	if r.failover(ctx, err) {
+		return r.primary.Query(ctx, sql, args...)
+	}
+	return rows, err
+}
+
+// QueryRow runs on the replica; Scan retries on the primary after a connection error
+func (r *ReadRouter) QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row {
+	if !r.useReplica() {
+		return r.primary.QueryRow(ctx, sql, args...)
+	}
+	return &failoverRow{
+		router: r,
+		ctx:    ctx,
+		sql:    sql,
+		args:   args,
+		row:    r.replica.QueryRow(ctx, sql, args...),
+	}
+}
+
+// failover reports whether err is a replica connection failure worth retrying on the
+// primary, logging and counting it if so. Query errors and cancelled requests are not
+// retried.
+func (r *ReadRouter) failover(ctx context.Context, err error) bool {
+	if ctx.Err() != nil && err != nil {
+		return false
+	}
+	connFailed := err != nil && isConnError(err)
+	r.record(connFailed)
+	if connFailed {
+		r.logger.Warn("Read replica unavailable, using primary", "error", err)
+	}
+	return connFailed
+}
+
+// isConnError reports whether err means the connection failed rather than the query
+func isConnError(err error) bool {
+	var connErr *pgconn.ConnectError
+	if errors.As(err, &connErr) {
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+	// pgx marks errors that happened before the query reached the server as safe to retry
+	return pgconn.SafeToRetry(err)
+}
+
+// failoverRow defers the primary retry to Scan, where pgx reports QueryRow errors
+type failoverRow struct {
+	router *ReadRouter
+	ctx    context.Context
+	sql    string
+	args   []interface{}
+	row    pgx.Row
+}
+
+func (f *failoverRow) Scan(dest ...any) error {
+	err := f.row.Scan(dest...)
+	if f.router.failover(f.ctx, err) {
+		return f.router.primary.QueryRow(f.ctx, f.sql, f.args...).Scan(dest...)
+	}
+	return err
+}
@@ -0,0 +1,128 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// fakeDB answers every query with err, counting calls
+type fakeDB struct {
+	err   error
+	calls int
+}
+
+func (f *fakeDB) Exec(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error) {
+	f.calls++
+	return pgconn.CommandTag{}, f.err
+}
+
+func (f *fakeDB) Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error) {
+	f.calls++
+	return nil, f.err
+}
+
+func (f *fakeDB) QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row {
+	f.calls++
+	return fakeRow{err: f.err}
+}
+
+type fakeRow struct{ err error }
+
+func (r fakeRow) Scan(dest ...any) error { return r.err }
+
+func TestReadRouterFailover(t *testing.T) {
+	refused := &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+	queryErr := &pgconn.PgError{Code: "42P01", Message: "relation does not exist"}
+
+	testCases := []struct {
+		name         string
+		replicaErr   error
+		wantErr      error
+		wantPrimary  int
+		cancelledCtx bool
+	}{
+		{"Replica healthy", nil, nil, 0, false},
+		{"Replica unreachable", refused, nil, 1, false},
+		{"Query error stays on replica", queryErr, queryErr, 0, false},
+		{"Cancelled request is not retried", refused, refused, 0, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			if tc.cancelledCtx {
+				cancel()
+			}
+
+			for _, method := range []string{"Query", "QueryRow"} {
+				primary, replica := &fakeDB{}, &fakeDB{err: tc.replicaErr}
+				router := NewReadRouter(primary, replica, 0, 0)
+
+				var err error
+				if method == "Query" {
+					_, err = router.Query(ctx, "SELECT 1")
+				} else {
+					err = router.QueryRow(ctx, "SELECT 1").Scan()
+				}
+
+				if !errors.Is(err, tc.wantErr) {
+					t.Errorf("%s: Expected error %v, got %v", method, tc.wantErr, err)
+				}
+				if replica.calls != 1 {
+					t.Errorf("%s: Expected 1 replica call, got %d", method, replica.calls)
+				}
+				if primary.calls != tc.wantPrimary {
+					t.Errorf("%s: Expected %d primary calls, got %d", method, tc.wantPrimary, primary.calls)
+				}
+			}
+		})
+	}
+}
+
+func TestReadRouterExecUsesPrimary(t *testing.T) {
+	primary, replica := &fakeDB{}, &fakeDB{}
+	if _, err := NewReadRouter(primary, replica, 0, 0).Exec(context.Background(), "DELETE FROM metrics"); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if primary.calls != 1 || replica.calls != 0 {
+		t.Errorf("Expected Exec on the primary only, got primary=%d replica=%d", primary.calls, replica.calls)
+	}
+}
+
+func TestReadRouterSkipsFailingReplica(t *testing.T) {
+	refused := &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+	primary, replica := &fakeDB{}, &fakeDB{err: refused}
+	router := NewReadRouter(primary, replica, 2, time.Minute)
+	now := time.Now()
+	router.now = func() time.Time { return now }
+
+	read := func() {
+		if err := router.QueryRow(context.Background(), "SELECT 1").Scan(); err != nil {
+			t.Fatalf("Expected the primary to answer, got %v", err)
+		}
+	}
+
+	// Two connection failures trip the replica breaker; the next read skips the replica
+	read()
+	read()
+	read()
+	if replica.calls != 2 || primary.calls != 3 {
+		t.Errorf("Expected the replica skipped after 2 failures, got replica=%d primary=%d", replica.calls, primary.calls)
+	}
+
+	// After the cooldown the replica is tried again, and a success keeps it in use
+	now = now.Add(time.Minute)
+	replica.err = nil
+	read()
+	read()
+	if replica.calls != 4 || primary.calls != 3 {
+		t.Errorf("Expected the recovered replica used, got replica=%d primary=%d", replica.calls, primary.calls)
+	}
+}
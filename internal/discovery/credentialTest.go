@@ -0,0 +1,113 @@
+package discovery
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	auth2 "github.com/nmslite/nmslite/internal/api/auth"
+	"github.com/nmslite/nmslite/internal/globals"
+)
+
+// HandshakeCheck is one live handshake of a credential against a target
+type HandshakeCheck struct {
+	Target   string
+	Port     int
+	Protocol string
+	Creds    *auth2.Credentials
+}
+
+// HandshakeOutcome is the result of a HandshakeCheck. Err is set when the handshake
+// failed or never ran because the test was cancelled.
+type HandshakeOutcome struct {
+	HandshakeCheck
+	Success  bool
+	Hostname string
+	Err      error
+	Duration time.Duration
+}
+
+// CredentialTester runs live credential handshakes on a bounded pool, so testing many
+// targets neither takes one handshake timeout per target nor opens unbounded sockets.
+// The pool is shared by every Run, so concurrent tests together stay within the limit.
+type CredentialTester struct {
+	// slots holds one token per handshake in flight across all runs
+	slots   chan struct{}
+	timeout time.Duration
+
+	// handshakes resolves a protocol to its handshake (the discovery handshakes outside tests)
+	handshakes map[string]handshakeFunc
+}
+
+// NewCredentialTester creates a tester using the discovery config's credential test limits
+func NewCredentialTester() *CredentialTester {
+	cfg := globals.GetConfig().Discovery
+	return &CredentialTester{
+		slots:      make(chan struct{}, cfg.CredentialTestConcurrency()),
+		timeout:    cfg.CredentialTestTimeout(),
+		handshakes: handshakes,
+	}
+}
+
+// Run starts checks with at most the configured number in flight across all runs, each
+// bounded by the handshake timeout, and sends every outcome on the returned channel as it
+// completes. A slow target only holds its own slot. Once ctx is done no further handshakes start and
+// the remaining checks are reported with ctx's error. The channel is closed after every
+// check has been reported.
+func (t *CredentialTester) Run(ctx context.Context, checks []HandshakeCheck) <-chan HandshakeOutcome {
+	outcomes := make(chan HandshakeOutcome, len(checks))
+
+	go func() {
+		defer close(outcomes)
+
+		var wg sync.WaitGroup
+		for i, check := range checks {
+			select {
+			case t.slots <- struct{}{}:
+			case <-ctx.Done():
+				for _, skipped := range checks[i:] {
+					outcomes <- HandshakeOutcome{HandshakeCheck: skipped, Err: ctx.Err()}
+				}
+				wg.Wait()
+				return
+			}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				defer func() { <-t.slots }()
+				outcomes <- t.runOne(check)
+			}()
+		}
+		wg.Wait()
+	}()
+
+	return outcomes
+}
+
+// runOne performs a single handshake
+func (t *CredentialTester) runOne(check HandshakeCheck) HandshakeOutcome {
+	outcome := HandshakeOutcome{HandshakeCheck: check}
+	handshake, ok := t.handshakes[check.Protocol]
+	if !ok {
+		outcome.Err = fmt.Errorf("protocol %q has no handshake", check.Protocol)
+		return outcome
+	}
+
+	start := time.Now()
+	result, err := handshake(check.Target, check.Port, check.Creds, t.timeout)
+	outcome.Duration = time.Since(start)
+	switch {
+	case err != nil:
+		outcome.Err = err
+	case result == nil || !result.Success:
+		outcome.Err = fmt.Errorf("handshake rejected")
+		if result != nil && result.Message != "" {
+			outcome.Err = fmt.Errorf("handshake rejected: %s", result.Message)
+		}
+	default:
+		outcome.Success = true
+		outcome.Hostname = result.Hostname
+	}
+	return outcome
+}
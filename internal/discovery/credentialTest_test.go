@@ -0,0 +1,161 @@
+package discovery
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	auth2 "github.com/nmslite/nmslite/internal/api/auth"
+)
+
+// gatedHandshake succeeds for every target, blocking "slow" until release is closed and
+// tracking the most handshakes in flight at once
+type gatedHandshake struct {
+	release     chan struct{}
+	inFlight    atomic.Int32
+	maxInFlight atomic.Int32
+}
+
+func (g *gatedHandshake) handshake(target string, port int, creds *auth2.Credentials, timeout time.Duration) (*HandshakeResult, error) {
+	n := g.inFlight.Add(1)
+	defer g.inFlight.Add(-1)
+	for {
+		max := g.maxInFlight.Load()
+		if n <= max || g.maxInFlight.CompareAndSwap(max, n) {
+			break
+		}
+	}
+
+	if target == "slow" {
+		<-g.release
+	} else {
+		time.Sleep(5 * time.Millisecond)
+	}
+	return &HandshakeResult{Success: true, Hostname: target}, nil
+}
+
+func testChecks(targets ...string) []HandshakeCheck {
+	checks := make([]HandshakeCheck, 0, len(targets))
+	for _, target := range targets {
+		checks = append(checks, HandshakeCheck{Target: target, Port: 22, Protocol: "ssh"})
+	}
+	return checks
+}
+
+func TestCredentialTesterConcurrencyCap(t *testing.T) {
+	g := &gatedHandshake{release: make(chan struct{})}
+	tester := &CredentialTester{slots: make(chan struct{}, 3), timeout: time.Second, handshakes: map[string]handshakeFunc{"ssh": g.handshake}}
+
+	targets := make([]string, 20)
+	for i := range targets {
+		targets[i] = "fast"
+	}
+	succeeded := 0
+	for outcome := range tester.Run(context.Background(), testChecks(targets...)) {
+		if outcome.Success {
+			succeeded++
+		}
+	}
+
+	if succeeded != len(targets) {
+		t.Errorf("Expected %d successes, got %d", len(targets), succeeded)
+	}
+	if max := g.maxInFlight.Load(); max > 3 {
+		t.Errorf("Expected at most 3 handshakes in flight, got %d", max)
+	}
+}
+
+func TestCredentialTesterCapSharedAcrossRuns(t *testing.T) {
+	g := &gatedHandshake{release: make(chan struct{})}
+	tester := &CredentialTester{slots: make(chan struct{}, 2), timeout: time.Second, handshakes: map[string]handshakeFunc{"ssh": g.handshake}}
+
+	first := tester.Run(context.Background(), testChecks("slow", "slow"))
+	for g.inFlight.Load() < 2 {
+		time.Sleep(time.Millisecond)
+	}
+	second := tester.Run(context.Background(), testChecks("a", "b"))
+
+	// The first run holds both slots, so the second cannot start
+	select {
+	case outcome := <-second:
+		t.Fatalf("Expected the second run to wait for a slot, got %+v", outcome)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(g.release)
+	for range first {
+	}
+	for range second {
+	}
+	if max := g.maxInFlight.Load(); max > 2 {
+		t.Errorf("Expected at most 2 handshakes in flight across runs, got %d", max)
+	}
+}
+
+func TestCredentialTesterSlowTargetDoesNotBlockOthers(t *testing.T) {
+	g := &gatedHandshake{release: make(chan struct{})}
+	tester := &CredentialTester{slots: make(chan struct{}, 2), timeout: time.Second, handshakes: map[string]handshakeFunc{"ssh": g.handshake}}
+
+	outcomes := tester.Run(context.Background(), testChecks("slow", "a", "b", "c", "d"))
+
+	// Every fast target completes while the slow one still holds its slot
+	var order []string
+	for range 4 {
+		select {
+		case outcome := <-outcomes:
+			order = append(order, outcome.Target)
+		case <-time.After(2 * time.Second):
+			t.Fatalf("Expected fast targets to finish while the slow one runs, got %v", order)
+		}
+	}
+	for _, target := range order {
+		if target == "slow" {
+			t.Fatalf("Expected the slow target to be still running, got %v", order)
+		}
+	}
+
+	close(g.release)
+	last, ok := <-outcomes
+	if !ok || last.Target != "slow" || !last.Success {
+		t.Errorf("Expected the slow target to finish last, got %+v", last)
+	}
+	if _, open := <-outcomes; open {
+		t.Error("Expected the outcome channel to be closed after every check")
+	}
+}
+
+func TestCredentialTesterCancel(t *testing.T) {
+	g := &gatedHandshake{release: make(chan struct{})}
+	tester := &CredentialTester{slots: make(chan struct{}, 1), timeout: time.Second, handshakes: map[string]handshakeFunc{"ssh": g.handshake}}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	outcomes := tester.Run(ctx, testChecks("slow", "a", "b"))
+	for g.inFlight.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+
+	// The checks still queued behind the slow one are reported as cancelled right away
+	for range 2 {
+		outcome := <-outcomes
+		if outcome.Target == "slow" || !errors.Is(outcome.Err, context.Canceled) {
+			t.Fatalf("Expected a queued check cancelled, got %+v", outcome)
+		}
+	}
+
+	close(g.release)
+	if outcome := <-outcomes; outcome.Target != "slow" || !outcome.Success {
+		t.Errorf("Expected the running handshake to finish, got %+v", outcome)
+	}
+}
+
+func TestCredentialTesterUnknownProtocol(t *testing.T) {
+	tester := &CredentialTester{slots: make(chan struct{}, 1), timeout: time.Second, handshakes: map[string]handshakeFunc{}}
+
+	outcome := <-tester.Run(context.Background(), testChecks("a"))
+	if outcome.Success || outcome.Err == nil {
+		t.Errorf("Expected an error for a protocol without handshake, got %+v", outcome)
+	}
+}
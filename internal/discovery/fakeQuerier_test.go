@@ -0,0 +1,371 @@
+package discovery
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/nmslite/nmslite/internal/database/dbgen"
+)
+
+// fakeQuerier is the in-memory database behind the discovery tests. Tests fill the tables
+// directly; queries read and write them the way the SQL does. Queries no test needs panic
+// via the nil embedded interface.
+type fakeQuerier struct {
+	dbgen.Querier
+
+	mu sync.Mutex
+
+	devices     map[int64]dbgen.DiscoveredDevice
+	monitors    map[int64]dbgen.Monitor
+	hostKeys    map[int64]dbgen.MonitorHostKey
+	profiles    map[int64]dbgen.DiscoveryProfile
+	credentials map[int64]dbgen.CredentialProfile
+
+	// delay holds every query back, bounded by its context
+	delay time.Duration
+	// fail makes the named queries return the error instead of running
+	fail map[string]error
+
+	// calls counts queries by name
+	calls map[string]int
+
+	// inFlight, active and maxActive track device inserts held back by delay;
+	// overlapped is set when two inserts for the same address and port overlap
+	inFlight   map[string]bool
+	active     int
+	maxActive  int
+	overlapped bool
+}
+
+func newFakeQuerier() *fakeQuerier {
+	return &fakeQuerier{
+		devices:     make(map[int64]dbgen.DiscoveredDevice),
+		monitors:    make(map[int64]dbgen.Monitor),
+		hostKeys:    make(map[int64]dbgen.MonitorHostKey),
+		profiles:    make(map[int64]dbgen.DiscoveryProfile),
+		credentials: make(map[int64]dbgen.CredentialProfile),
+		fail:        make(map[string]error),
+		calls:       make(map[string]int),
+		inFlight:    make(map[string]bool),
+	}
+}
+
+// read waits out the delay, locks the tables and records the call. The caller unlocks.
+func (q *fakeQuerier) read(ctx context.Context, query string) error {
+	if q.delay > 0 {
+		select {
+		case <-time.After(q.delay):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	q.mu.Lock()
+	q.calls[query]++
+	if err := q.fail[query]; err != nil {
+		q.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// fakeTx runs fn on db and rolls the tables back when fn fails
+func fakeTx(db *fakeQuerier) TxFunc {
+	return func(ctx context.Context, fn func(q dbgen.Querier) error) error {
+		db.mu.Lock()
+		devices, monitors := maps.Clone(db.devices), maps.Clone(db.monitors)
+		db.mu.Unlock()
+		if err := fn(db); err != nil {
+			db.mu.Lock()
+			db.devices, db.monitors = devices, monitors
+			db.mu.Unlock()
+			return err
+		}
+		return nil
+	}
+}
+
+// nextID returns the ID the next row inserted into table gets
+func nextID[V any](table map[int64]V) int64 {
+	var id int64
+	for k := range table {
+		id = max(id, k)
+	}
+	return id + 1
+}
+
+func now() pgtype.Timestamptz {
+	return pgtype.Timestamptz{Time: time.Now(), Valid: true}
+}
+
+// Discovered devices
+
+func (q *fakeQuerier) GetDiscoveredDevice(ctx context.Context, id int64) (dbgen.DiscoveredDevice, error) {
+	if err := q.read(ctx, "GetDiscoveredDevice"); err != nil {
+		return dbgen.DiscoveredDevice{}, err
+	}
+	defer q.mu.Unlock()
+	device, ok := q.devices[id]
+	if !ok {
+		return dbgen.DiscoveredDevice{}, pgx.ErrNoRows
+	}
+	return device, nil
+}
+
+func (q *fakeQuerier) ListDiscoveredDevicesByIDs(ctx context.Context, ids []int64) ([]dbgen.DiscoveredDevice, error) {
+	if err := q.read(ctx, "ListDiscoveredDevicesByIDs"); err != nil {
+		return nil, err
+	}
+	defer q.mu.Unlock()
+	var devices []dbgen.DiscoveredDevice
+	for _, id := range ids {
+		if device, ok := q.devices[id]; ok {
+			devices = append(devices, device)
+		}
+	}
+	return devices, nil
+}
+
+func (q *fakeQuerier) CreateDiscoveredDevice(ctx context.Context, arg dbgen.CreateDiscoveredDeviceParams) (dbgen.DiscoveredDevice, error) {
+	key := fmt.Sprintf("%s:%d", arg.IpAddress, arg.Port)
+	q.mu.Lock()
+	q.overlapped = q.overlapped || q.inFlight[key]
+	q.inFlight[key] = true
+	q.active++
+	q.maxActive = max(q.maxActive, q.active)
+	q.mu.Unlock()
+	defer func() {
+		q.mu.Lock()
+		delete(q.inFlight, key)
+		q.active--
+		q.mu.Unlock()
+	}()
+
+	if err := q.read(ctx, "CreateDiscoveredDevice"); err != nil {
+		return dbgen.DiscoveredDevice{}, err
+	}
+	defer q.mu.Unlock()
+	device := dbgen.DiscoveredDevice{
+		ID:                  nextID(q.devices),
+		DiscoveryProfileID:  arg.DiscoveryProfileID,
+		IpAddress:           arg.IpAddress,
+		Port:                arg.Port,
+		Status:              arg.Status,
+		CreatedAt:           now(),
+		UpdatedAt:           now(),
+		CredentialProfileID: arg.CredentialProfileID,
+		DiscoveryJobID:      arg.DiscoveryJobID,
+		Protocol:            arg.Protocol,
+	}
+	q.devices[device.ID] = device
+	return device, nil
+}
+
+func (q *fakeQuerier) UpdateDiscoveredDeviceStatus(ctx context.Context, arg dbgen.UpdateDiscoveredDeviceStatusParams) error {
+	if err := q.read(ctx, "UpdateDiscoveredDeviceStatus"); err != nil {
+		return err
+	}
+	defer q.mu.Unlock()
+	device, ok := q.devices[arg.ID]
+	if !ok {
+		return nil
+	}
+	device.Status = arg.Status
+	device.UpdatedAt = now()
+	q.devices[arg.ID] = device
+	return nil
+}
+
+// Monitors
+
+func (q *fakeQuerier) CreateMonitor(ctx context.Context, arg dbgen.CreateMonitorParams) (dbgen.Monitor, error) {
+	if err := q.read(ctx, "CreateMonitor"); err != nil {
+		return dbgen.Monitor{}, err
+	}
+	defer q.mu.Unlock()
+	monitor := dbgen.Monitor{
+		ID:                     nextID(q.monitors),
+		IpAddress:              arg.IpAddress,
+		Hostname:               arg.Hostname,
+		Port:                   arg.Port,
+		PluginID:               arg.PluginID,
+		CredentialProfileID:    arg.CredentialProfileID,
+		DiscoveryProfileID:     arg.DiscoveryProfileID,
+		PollingIntervalSeconds: arg.PollingIntervalSeconds,
+		CreatedAt:              now(),
+		UpdatedAt:              now(),
+	}
+	q.monitors[monitor.ID] = monitor
+	return monitor, nil
+}
+
+func (q *fakeQuerier) GetMonitorByIPAndPlugin(ctx context.Context, arg dbgen.GetMonitorByIPAndPluginParams) (dbgen.Monitor, error) {
+	if err := q.read(ctx, "GetMonitorByIPAndPlugin"); err != nil {
+		return dbgen.Monitor{}, err
+	}
+	defer q.mu.Unlock()
+	for _, monitor := range q.monitors {
+		if !monitor.DeletedAt.Valid && monitor.IpAddress == arg.IpAddress && monitor.PluginID == arg.PluginID {
+			return monitor, nil
+		}
+	}
+	return dbgen.Monitor{}, pgx.ErrNoRows
+}
+
+func (q *fakeQuerier) GetMonitorWithCredentials(ctx context.Context, id int64) (dbgen.GetMonitorWithCredentialsRow, error) {
+	if err := q.read(ctx, "GetMonitorWithCredentials"); err != nil {
+		return dbgen.GetMonitorWithCredentialsRow{}, err
+	}
+	defer q.mu.Unlock()
+	m, ok := q.monitors[id]
+	if !ok || m.DeletedAt.Valid {
+		return dbgen.GetMonitorWithCredentialsRow{}, pgx.ErrNoRows
+	}
+	return dbgen.GetMonitorWithCredentialsRow{
+		ID:                     m.ID,
+		IpAddress:              m.IpAddress,
+		Port:                   m.Port,
+		PluginID:               m.PluginID,
+		CredentialProfileID:    m.CredentialProfileID,
+		PollingIntervalSeconds: m.PollingIntervalSeconds,
+	}, nil
+}
+
+// Monitor host keys
+
+// updateHostKey applies change to a monitor's host key row, reporting whether it exists
+func (q *fakeQuerier) updateHostKey(monitorID int64, change func(*dbgen.MonitorHostKey)) bool {
+	hostKey, ok := q.hostKeys[monitorID]
+	if !ok {
+		return false
+	}
+	change(&hostKey)
+	hostKey.LastCheckedAt = now()
+	q.hostKeys[monitorID] = hostKey
+	return true
+}
+
+func (q *fakeQuerier) TrustMonitorHostKey(ctx context.Context, arg dbgen.TrustMonitorHostKeyParams) (int64, error) {
+	if err := q.read(ctx, "TrustMonitorHostKey"); err != nil {
+		return 0, err
+	}
+	defer q.mu.Unlock()
+	if !q.updateHostKey(arg.MonitorID, func(k *dbgen.MonitorHostKey) {
+		k.Fingerprint, k.ObservedFingerprint, k.TrustedAt = arg.Fingerprint, pgtype.Text{}, now()
+	}) {
+		return 0, nil
+	}
+	return 1, nil
+}
+
+func (q *fakeQuerier) RecordHostKeyMatch(ctx context.Context, monitorID int64) error {
+	if err := q.read(ctx, "RecordHostKeyMatch"); err != nil {
+		return err
+	}
+	defer q.mu.Unlock()
+	q.updateHostKey(monitorID, func(k *dbgen.MonitorHostKey) { k.ObservedFingerprint = pgtype.Text{} })
+	return nil
+}
+
+func (q *fakeQuerier) RecordHostKeyMismatch(ctx context.Context, arg dbgen.RecordHostKeyMismatchParams) (int64, error) {
+	if err := q.read(ctx, "RecordHostKeyMismatch"); err != nil {
+		return 0, err
+	}
+	defer q.mu.Unlock()
+	if k, ok := q.hostKeys[arg.MonitorID]; !ok || k.ObservedFingerprint == arg.ObservedFingerprint {
+		return 0, nil
+	}
+	q.updateHostKey(arg.MonitorID, func(k *dbgen.MonitorHostKey) {
+		k.ObservedFingerprint, k.ChangedAt = arg.ObservedFingerprint, now()
+	})
+	return 1, nil
+}
+
+func (q *fakeQuerier) TouchMonitorHostKey(ctx context.Context, monitorID int64) error {
+	if err := q.read(ctx, "TouchMonitorHostKey"); err != nil {
+		return err
+	}
+	defer q.mu.Unlock()
+	q.updateHostKey(monitorID, func(*dbgen.MonitorHostKey) {})
+	return nil
+}
+
+// Discovery and credential profiles
+
+func (q *fakeQuerier) GetDiscoveryProfile(ctx context.Context, id int64) (dbgen.DiscoveryProfile, error) {
+	if err := q.read(ctx, "GetDiscoveryProfile"); err != nil {
+		return dbgen.DiscoveryProfile{}, err
+	}
+	defer q.mu.Unlock()
+	profile, ok := q.profiles[id]
+	if !ok || profile.DeletedAt.Valid {
+		return dbgen.DiscoveryProfile{}, pgx.ErrNoRows
+	}
+	return profile, nil
+}
+
+func (q *fakeQuerier) ListDiscoveryProfilesByIDs(ctx context.Context, ids []int64) ([]dbgen.DiscoveryProfile, error) {
+	if err := q.read(ctx, "ListDiscoveryProfilesByIDs"); err != nil {
+		return nil, err
+	}
+	defer q.mu.Unlock()
+	var profiles []dbgen.DiscoveryProfile
+	for _, id := range ids {
+		if profile, ok := q.profiles[id]; ok && !profile.DeletedAt.Valid {
+			profiles = append(profiles, profile)
+		}
+	}
+	return profiles, nil
+}
+
+func (q *fakeQuerier) ListDueDiscoveryProfiles(ctx context.Context) ([]dbgen.DiscoveryProfile, error) {
+	if err := q.read(ctx, "ListDueDiscoveryProfiles"); err != nil {
+		return nil, err
+	}
+	defer q.mu.Unlock()
+	var profiles []dbgen.DiscoveryProfile
+	for _, profile := range q.profiles {
+		interval := time.Duration(profile.IntervalSeconds.Int32) * time.Second
+		if interval <= 0 || profile.DeletedAt.Valid {
+			continue
+		}
+		if !profile.LastRunAt.Valid || !profile.LastRunAt.Time.Add(interval).After(time.Now()) {
+			profiles = append(profiles, profile)
+		}
+	}
+	slices.SortFunc(profiles, func(a, b dbgen.DiscoveryProfile) int {
+		return a.LastRunAt.Time.Compare(b.LastRunAt.Time)
+	})
+	return profiles, nil
+}
+
+func (q *fakeQuerier) GetCredentialProfile(ctx context.Context, id int64) (dbgen.CredentialProfile, error) {
+	if err := q.read(ctx, "GetCredentialProfile"); err != nil {
+		return dbgen.CredentialProfile{}, err
+	}
+	defer q.mu.Unlock()
+	credential, ok := q.credentials[id]
+	if !ok || credential.DeletedAt.Valid {
+		return dbgen.CredentialProfile{}, pgx.ErrNoRows
+	}
+	return credential, nil
+}
+
+func (q *fakeQuerier) ListCredentialProfilesByIDs(ctx context.Context, ids []int64) ([]dbgen.CredentialProfile, error) {
+	if err := q.read(ctx, "ListCredentialProfilesByIDs"); err != nil {
+		return nil, err
+	}
+	defer q.mu.Unlock()
+	var credentials []dbgen.CredentialProfile
+	for _, id := range ids {
+		if credential, ok := q.credentials[id]; ok && !credential.DeletedAt.Valid {
+			credentials = append(credentials, credential)
+		}
+	}
+	return credentials, nil
+}
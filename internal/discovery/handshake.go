@@ -1,13 +1,17 @@
 package discovery
 
 import (
+	"errors"
 	"fmt"
+	"net"
 	"strings"
 	"time"
 
 	"github.com/gosnmp/gosnmp"
 	"github.com/masterzen/winrm"
 	"github.com/nmslite/nmslite/internal/api/auth"
+	"github.com/nmslite/nmslite/internal/globals"
+	"github.com/nmslite/nmslite/internal/protocols"
 	"golang.org/x/crypto/ssh"
 )
 
@@ -15,11 +19,59 @@ import (
 type HandshakeResult struct {
 	Success  bool
 	Hostname string
+	// Message says why the handshake did not succeed when it returned no error
+	Message string
 }
 
-// ValidateSSH attempts SSH handshake with password or key auth
-// Uses golang.org/x/crypto/ssh
-func ValidateSSH(target string, port int, creds *auth.Credentials, timeout time.Duration) (*HandshakeResult, error) {
+// ErrHostKeyMismatch is returned by DialSSH when the server presents a host key other
+// than the pinned one. No credentials have been sent.
+var ErrHostKeyMismatch = errors.New("ssh host key mismatch")
+
+// pinnedHostKey returns a host key callback that only accepts the key with the given
+// SHA256 fingerprint; an empty fingerprint accepts any key. The callback runs before
+// authentication, so a mismatch aborts the connection without sending credentials.
+func pinnedHostKey(fingerprint string) ssh.HostKeyCallback {
+	return func(_ string, _ net.Addr, key ssh.PublicKey) error {
+		if observed := ssh.FingerprintSHA256(key); fingerprint != "" && observed != fingerprint {
+			return fmt.Errorf("%w: expected %s, got %s", ErrHostKeyMismatch, fingerprint, observed)
+		}
+		return nil
+	}
+}
+
+// recordHostKey returns a host key callback that accepts any key and stores its SHA256
+// fingerprint. Trust decisions are made afterwards by comparing fingerprints.
+func recordHostKey(fingerprint *string) ssh.HostKeyCallback {
+	return func(_ string, _ net.Addr, key ssh.PublicKey) error {
+		*fingerprint = ssh.FingerprintSHA256(key)
+		return nil
+	}
+}
+
+// FetchSSHHostKey returns the SHA256 fingerprint of the host key an SSH server presents.
+// No credentials are needed: the key is exchanged before authentication, which is
+// expected to fail here.
+func FetchSSHHostKey(target string, port int, timeout time.Duration) (string, error) {
+	var fingerprint string
+	config := &ssh.ClientConfig{
+		User:            "nmslite",
+		HostKeyCallback: recordHostKey(&fingerprint),
+		Timeout:         timeout,
+	}
+
+	client, err := ssh.Dial("tcp", fmt.Sprintf("%s:%d", target, port), config)
+	if err == nil {
+		client.Close()
+	}
+	if fingerprint == "" {
+		return "", fmt.Errorf("no host key received: %w", err)
+	}
+	return fingerprint, nil
+}
+
+// DialSSH connects and authenticates with password or key auth. A non-empty
+// pinnedFingerprint must match the server's host key, see pinnedHostKey.
+func DialSSH(target string, port int, creds *auth.Credentials, pinnedFingerprint string, timeout time.Duration) (*ssh.Client, error) {
 	address := fmt.Sprintf("%s:%d", target, port)
 
 	// Build auth methods
@@ -42,31 +94,35 @@ func ValidateSSH(target string, port int, creds *auth.Credentials, timeout time.
 		}
 
 		if err != nil {
-			return &HandshakeResult{
-				Success: false,
-			}, nil
+			return nil, fmt.Errorf("invalid private key: %w", err)
 		}
 
 		authMethods = append(authMethods, ssh.PublicKeys(key))
 	}
 
 	if len(authMethods) == 0 {
-		return &HandshakeResult{
-			Success: false,
-		}, nil
+		return nil, fmt.Errorf("no password or private key")
 	}
 
 	config := &ssh.ClientConfig{
 		User:            creds.Username,
 		Auth:            authMethods,
-		HostKeyCallback: ssh.InsecureIgnoreHostKey(), // Validation happens at connection time
+		HostKeyCallback: pinnedHostKey(pinnedFingerprint),
 		Timeout:         timeout,
 	}
 
-	client, err := ssh.Dial("tcp", address, config)
+	return ssh.Dial("tcp", address, config)
+}
+
+// ValidateSSH attempts SSH handshake with password or key auth. Discovered devices have
+// no pinned host key yet; the host key verifier records one once a monitor opts in.
+// Uses golang.org/x/crypto/ssh
+func ValidateSSH(target string, port int, creds *auth.Credentials, timeout time.Duration) (*HandshakeResult, error) {
+	client, err := DialSSH(target, port, creds, "", timeout)
 	if err != nil {
 		return &HandshakeResult{
 			Success: false,
+			Message: err.Error(),
 		}, nil
 	}
 	defer client.Close()
@@ -90,12 +146,17 @@ func ValidateSSH(target string, port int, creds *auth.Credentials, timeout time.
 // ValidateWinRM attempts WinRM handshake (NTLM or Basic)
 // Uses github.com/masterzen/winrm
 func ValidateWinRM(target string, port int, creds *auth.Credentials, timeout time.Duration) (*HandshakeResult, error) {
-	endpoint := winrm.NewEndpoint(target, port, false, false, nil, nil, nil, timeout)
+	var caCert []byte
+	if creds.CACert != "" {
+		caCert = []byte(creds.CACert)
+	}
+	endpoint := winrm.NewEndpoint(target, port, creds.UseHTTPS, creds.InsecureSkipVerify, caCert, nil, nil, timeout)
 
 	client, err := winrm.NewClient(endpoint, creds.Username, creds.Password)
 	if err != nil {
 		return &HandshakeResult{
 			Success: false,
+			Message: err.Error(),
 		}, nil
 	}
 
@@ -104,6 +165,7 @@ func ValidateWinRM(target string, port int, creds *auth.Credentials, timeout tim
 	if err != nil {
 		return &HandshakeResult{
 			Success: false,
+			Message: err.Error(),
 		}, nil
 	}
 	defer shell.Close()
@@ -122,61 +184,61 @@ func ValidateWinRM(target string, port int, creds *auth.Credentials, timeout tim
 	}, nil
 }
 
-// ValidateSNMPv2c attempts SNMP v2c handshake with community string
-// Uses github.com/gosnmp/gosnmp - UDP GetRequest to sysDescr OID
-func ValidateSNMPv2c(target string, port int, creds *auth.Credentials, timeout time.Duration) (*HandshakeResult, error) {
-	g := &gosnmp.GoSNMP{
-		Target:    target,
-		Port:      uint16(port),
-		Version:   gosnmp.Version2c,
-		Community: creds.Community,
-		Timeout:   timeout,
-	}
+// snmpParams holds the per-request SNMP transport settings
+type snmpParams struct {
+	Timeout time.Duration // per attempt
+	Retries int
+}
 
-	err := g.Connect()
-	if err != nil {
-		return &HandshakeResult{
-			Success: false,
-		}, nil
+// resolveSNMPParams applies, in order: the handshake timeout, discovery config defaults,
+// then credential overrides.
+func resolveSNMPParams(creds *auth.Credentials, timeout time.Duration) snmpParams {
+	cfg := globals.GetConfig().Discovery
+	params := snmpParams{Timeout: timeout, Retries: cfg.SNMPRetryCount()}
+	if cfg.SNMPTimeoutMS > 0 {
+		params.Timeout = time.Duration(cfg.SNMPTimeoutMS) * time.Millisecond
 	}
-	defer g.Conn.Close()
 
-	// Perform a GetRequest to sysDescr (1.3.6.1.2.1.1.1.0) and sysName (1.3.6.1.2.1.1.5.0)
-	oids := []string{"1.3.6.1.2.1.1.1.0", "1.3.6.1.2.1.1.5.0"}
-	result, err := g.Get(oids)
-	if err != nil {
-		return &HandshakeResult{
-			Success: false,
-		}, nil
+	if creds.TimeoutMS > 0 {
+		params.Timeout = time.Duration(creds.TimeoutMS) * time.Millisecond
 	}
-
-	// Extract values
-	var hostname string
-	for _, variable := range result.Variables {
-		switch variable.Name {
-		case ".1.3.6.1.2.1.1.1.0":
-			// sysDescr - skipped, not used
-		case ".1.3.6.1.2.1.1.5.0":
-			hostname = fmt.Sprintf("%v", variable.Value)
-		}
+	if creds.Retries != nil && *creds.Retries >= 0 {
+		params.Retries = *creds.Retries
 	}
-
-	return &HandshakeResult{
-		Success:  true,
-		Hostname: hostname,
-	}, nil
+	return params
 }
 
-// ValidateSNMPv3 attempts SNMP v3 handshake with USM auth
-// Uses github.com/gosnmp/gosnmp - supports noAuthNoPriv, authNoPriv, authPriv
-func ValidateSNMPv3(target string, port int, creds *auth.Credentials, timeout time.Duration) (*HandshakeResult, error) {
-	g := &gosnmp.GoSNMP{
+// newSNMPClient builds a gosnmp client with explicit timeout and retries
+func newSNMPClient(target string, port int, version gosnmp.SnmpVersion, params snmpParams) *gosnmp.GoSNMP {
+	return &gosnmp.GoSNMP{
 		Target:  target,
 		Port:    uint16(port),
-		Version: gosnmp.Version3,
-		Timeout: timeout,
+		Version: version,
+		Timeout: params.Timeout,
+		Retries: params.Retries,
+	}
+}
+
+// NewSNMPClient builds an unconnected gosnmp client for an "snmp-v1", "snmp-v2c" or
+// "snmp-v3" credential, with timeout and retries resolved as for handshakes
+func NewSNMPClient(target string, port int, protocol string, creds *auth.Credentials, timeout time.Duration) (*gosnmp.GoSNMP, error) {
+	params := resolveSNMPParams(creds, timeout)
+	switch protocol {
+	case "snmp-v1":
+		g := newSNMPClient(target, port, gosnmp.Version1, params)
+		g.Community = creds.Community
+		return g, nil
+	case "snmp-v2c":
+		g := newSNMPClient(target, port, gosnmp.Version2c, params)
+		g.Community = creds.Community
+		return g, nil
+	}
+	if protocol != "snmp-v3" {
+		return nil, fmt.Errorf("unsupported SNMP protocol %q", protocol)
 	}
 
+	g := newSNMPClient(target, port, gosnmp.Version3, params)
+
 	// Parse security level
 	var securityLevel gosnmp.SnmpV3MsgFlags
 	switch creds.SecurityLevel {
@@ -187,9 +249,7 @@ func ValidateSNMPv3(target string, port int, creds *auth.Credentials, timeout ti
 	case "authPriv":
 		securityLevel = gosnmp.AuthPriv
 	default:
-		return &HandshakeResult{
-			Success: false,
-		}, nil
+		return nil, fmt.Errorf("unknown security_level %q", creds.SecurityLevel)
 	}
 
 	// Parse auth protocol
@@ -226,6 +286,14 @@ func ValidateSNMPv3(target string, port int, creds *auth.Credentials, timeout ti
 		privProto = gosnmp.NoPriv // default
 	}
 
+	// Optional context for devices with multiple SNMP contexts; empty keeps the defaults
+	contextEngineID, err := protocols.DecodeEngineID(creds.ContextEngineID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid context_engine_id: %w", err)
+	}
+	g.ContextName = creds.ContextName
+	g.ContextEngineID = contextEngineID
+
 	// Build security parameters
 	switch securityLevel {
 	case gosnmp.NoAuthNoPriv:
@@ -255,10 +323,24 @@ func ValidateSNMPv3(target string, port int, creds *auth.Credentials, timeout ti
 		}
 	}
 
-	err := g.Connect()
+	return g, nil
+}
+
+// validateSNMP connects with the credential and reads sysDescr and sysName
+func validateSNMP(target string, port int, protocol string, creds *auth.Credentials, timeout time.Duration) (*HandshakeResult, error) {
+	g, err := NewSNMPClient(target, port, protocol, creds, timeout)
 	if err != nil {
 		return &HandshakeResult{
 			Success: false,
+			Message: err.Error(),
+		}, nil
+	}
+
+	err = g.Connect()
+	if err != nil {
+		return &HandshakeResult{
+			Success: false,
+			Message: err.Error(),
 		}, nil
 	}
 	defer g.Conn.Close()
@@ -269,6 +351,7 @@ func ValidateSNMPv3(target string, port int, creds *auth.Credentials, timeout ti
 	if err != nil {
 		return &HandshakeResult{
 			Success: false,
+			Message: err.Error(),
 		}, nil
 	}
 
@@ -279,7 +362,12 @@ func ValidateSNMPv3(target string, port int, creds *auth.Credentials, timeout ti
 		case ".1.3.6.1.2.1.1.1.0":
 			// sysDescr - skipped, not used
 		case ".1.3.6.1.2.1.1.5.0":
-			hostname = fmt.Sprintf("%v", variable.Value)
+			// OctetStrings decode as []byte
+			if b, ok := variable.Value.([]byte); ok {
+				hostname = string(b)
+			} else {
+				hostname = fmt.Sprintf("%v", variable.Value)
+			}
 		}
 	}
 
@@ -288,3 +376,21 @@ func ValidateSNMPv3(target string, port int, creds *auth.Credentials, timeout ti
 		Hostname: hostname,
 	}, nil
 }
+
+// ValidateSNMPv1 attempts SNMP v1 handshake with community string, for legacy devices
+// that do not speak v2c
+func ValidateSNMPv1(target string, port int, creds *auth.Credentials, timeout time.Duration) (*HandshakeResult, error) {
+	return validateSNMP(target, port, "snmp-v1", creds, timeout)
+}
+
+// ValidateSNMPv2c attempts SNMP v2c handshake with community string
+// Uses github.com/gosnmp/gosnmp - UDP GetRequest to sysDescr OID
+func ValidateSNMPv2c(target string, port int, creds *auth.Credentials, timeout time.Duration) (*HandshakeResult, error) {
+	return validateSNMP(target, port, "snmp-v2c", creds, timeout)
+}
+
+// ValidateSNMPv3 attempts SNMP v3 handshake with USM auth
+// Uses github.com/gosnmp/gosnmp - supports noAuthNoPriv, authNoPriv, authPriv
+func ValidateSNMPv3(target string, port int, creds *auth.Credentials, timeout time.Duration) (*HandshakeResult, error) {
+	return validateSNMP(target, port, "snmp-v3", creds, timeout)
+}
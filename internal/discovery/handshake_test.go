@@ -0,0 +1,122 @@
+package discovery
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/gosnmp/gosnmp"
+	"github.com/nmslite/nmslite/internal/api/auth"
+	"github.com/nmslite/nmslite/internal/globals"
+)
+
+func TestResolveSNMPParams(t *testing.T) {
+	zero, four, five := 0, 4, 5
+
+	testCases := []struct {
+		name        string
+		cfg         globals.DiscoveryConfig
+		creds       auth.Credentials
+		wantTimeout time.Duration
+		wantRetries int
+	}{
+		{"Defaults", globals.DiscoveryConfig{}, auth.Credentials{}, 5 * time.Second, 2},
+		{"Config defaults", globals.DiscoveryConfig{SNMPRetries: &four, SNMPTimeoutMS: 1500}, auth.Credentials{}, 1500 * time.Millisecond, 4},
+		{"Config disables retries", globals.DiscoveryConfig{SNMPRetries: &zero}, auth.Credentials{}, 5 * time.Second, 0},
+		{"Credential overrides", globals.DiscoveryConfig{SNMPRetries: &four, SNMPTimeoutMS: 1500}, auth.Credentials{Retries: &five, TimeoutMS: 800}, 800 * time.Millisecond, 5},
+		{"Credential disables retries", globals.DiscoveryConfig{SNMPRetries: &four}, auth.Credentials{Retries: &zero}, 5 * time.Second, 0},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			globals.SetGlobalConfigForTests(&globals.Config{Discovery: tc.cfg})
+
+			g := newSNMPClient("192.0.2.1", 161, gosnmp.Version2c, resolveSNMPParams(&tc.creds, 5*time.Second))
+
+			if g.Retries != tc.wantRetries {
+				t.Errorf("Expected %d retries, got %d", tc.wantRetries, g.Retries)
+			}
+			if g.Timeout != tc.wantTimeout {
+				t.Errorf("Expected timeout %v, got %v", tc.wantTimeout, g.Timeout)
+			}
+			if g.Port != 161 || g.Target != "192.0.2.1" || g.Version != gosnmp.Version2c {
+				t.Errorf("Unexpected client target: %s:%d v%v", g.Target, g.Port, g.Version)
+			}
+		})
+	}
+}
+
+// fakeSNMPAgent answers GetRequests of one SNMP version and community on a local UDP port
+// and returns the port. Other requests are ignored, as a real agent would.
+func fakeSNMPAgent(t *testing.T, version gosnmp.SnmpVersion, community string, values map[string]string) int {
+	t.Helper()
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	codec := *gosnmp.Default
+	go func() {
+		buf := make([]byte, 65535)
+		for {
+			n, from, err := conn.ReadFromUDP(buf)
+			if err != nil {
+				return
+			}
+			request, err := codec.SnmpDecodePacket(buf[:n])
+			if err != nil || request.Version != version || request.Community != community || request.PDUType != gosnmp.GetRequest {
+				continue
+			}
+			response := *request
+			response.PDUType = gosnmp.GetResponse
+			response.Variables = nil
+			for _, v := range request.Variables {
+				response.Variables = append(response.Variables, gosnmp.SnmpPDU{Name: v.Name, Type: gosnmp.OctetString, Value: values[v.Name]})
+			}
+			out, err := response.MarshalMsg()
+			if err != nil {
+				continue
+			}
+			conn.WriteToUDP(out, from)
+		}
+	}()
+	return conn.LocalAddr().(*net.UDPAddr).Port
+}
+
+func TestValidateSNMPv1(t *testing.T) {
+	globals.SetGlobalConfigForTests(&globals.Config{})
+	zero := 0
+
+	v1Port := fakeSNMPAgent(t, gosnmp.Version1, "public", map[string]string{
+		".1.3.6.1.2.1.1.1.0": "Legacy switch",
+		".1.3.6.1.2.1.1.5.0": "core-sw1",
+	})
+	v2cPort := fakeSNMPAgent(t, gosnmp.Version2c, "public", nil)
+
+	testCases := []struct {
+		name         string
+		port         int
+		community    string
+		wantSuccess  bool
+		wantHostname string
+	}{
+		{"v1 agent answers", v1Port, "public", true, "core-sw1"},
+		{"Wrong community", v1Port, "private", false, ""},
+		{"v2c-only agent", v2cPort, "public", false, ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			creds := &auth.Credentials{Community: tc.community, Retries: &zero}
+			result, err := ValidateSNMPv1("127.0.0.1", tc.port, creds, 300*time.Millisecond)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if result.Success != tc.wantSuccess || result.Hostname != tc.wantHostname {
+				t.Errorf("Expected success=%v hostname=%q, got success=%v hostname=%q",
+					tc.wantSuccess, tc.wantHostname, result.Success, result.Hostname)
+			}
+		})
+	}
+}
@@ -0,0 +1,181 @@
+package discovery
+
+import (
+	"context"
+	"log/slog"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/nmslite/nmslite/internal/database/dbgen"
+	"github.com/nmslite/nmslite/internal/globals"
+	"github.com/nmslite/nmslite/internal/protocols"
+)
+
+// HostKeyPluginID is the plugin whose monitors have SSH host keys to verify
+const HostKeyPluginID = "ssh"
+
+// hostKeyCheckWorkers bounds how many devices are contacted at once during a check round
+const hostKeyCheckWorkers = 8
+
+// HostKeyVerifier periodically fetches the SSH host key of every monitor opted in to
+// verification. The first key seen is trusted; a different key later is recorded and
+// published as a HostKeyChangedEvent until an operator accepts it.
+type HostKeyVerifier struct {
+	querier  dbgen.Querier
+	events   *globals.EventChannels
+	logger   *slog.Logger
+	interval time.Duration
+	timeout  time.Duration
+
+	// fetch returns a device's host key fingerprint (FetchSSHHostKey outside tests)
+	fetch func(target string, port int, timeout time.Duration) (string, error)
+}
+
+// NewHostKeyVerifier creates a verifier using the discovery config's check interval and handshake timeout.
+func NewHostKeyVerifier(querier dbgen.Querier, events *globals.EventChannels, logger *slog.Logger) *HostKeyVerifier {
+	cfg := globals.GetConfig().Discovery
+	timeout := time.Duration(cfg.HandshakeTimeoutMS) * time.Millisecond
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+	return &HostKeyVerifier{
+		querier:  querier,
+		events:   events,
+		logger:   logger.With(slog.String("component", "host_key_verifier")),
+		interval: cfg.HostKeyCheckInterval(),
+		timeout:  timeout,
+		fetch:    FetchSSHHostKey,
+	}
+}
+
+// Run checks host keys immediately and then every interval until ctx is cancelled.
+func (v *HostKeyVerifier) Run(ctx context.Context) error {
+	ticker := time.NewTicker(v.interval)
+	defer ticker.Stop()
+
+	for {
+		v.checkAll(ctx)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// checkAll verifies every opted-in monitor, a bounded number at a time.
+func (v *HostKeyVerifier) checkAll(ctx context.Context) {
+	checks, err := v.querier.ListHostKeyChecks(ctx, HostKeyPluginID)
+	if err != nil {
+		v.logger.ErrorContext(ctx, "Failed to list monitors for host key verification",
+			slog.String("error", err.Error()),
+		)
+		return
+	}
+	if len(checks) == 0 {
+		return
+	}
+
+	sem := make(chan struct{}, hostKeyCheckWorkers)
+	var wg sync.WaitGroup
+	for _, check := range checks {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			wg.Wait()
+			return
+		}
+		wg.Add(1)
+		go func(check dbgen.ListHostKeyChecksRow) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			v.checkOne(ctx, check)
+		}(check)
+	}
+	wg.Wait()
+
+	v.logger.DebugContext(ctx, "Host key verification round completed", slog.Int("monitors", len(checks)))
+}
+
+// checkOne fetches a monitor's current host key and compares it with the trusted one.
+// An unreachable device is not a key change and is only logged.
+func (v *HostKeyVerifier) checkOne(ctx context.Context, check dbgen.ListHostKeyChecksRow) {
+	port := protocols.GetRegistry().DefaultPort(HostKeyPluginID)
+	if check.Port.Valid && check.Port.Int32 > 0 {
+		port = int(check.Port.Int32)
+	}
+	ip := check.IpAddress.String()
+	logger := v.logger.With(
+		slog.String("monitor_id", strconv.FormatInt(check.MonitorID, 10)),
+		slog.String("ip", ip),
+		slog.Int("port", port),
+	)
+
+	observed, err := v.fetch(ip, port, v.timeout)
+	if err != nil {
+		logger.DebugContext(ctx, "Host key check failed", slog.String("error", err.Error()))
+		return
+	}
+
+	switch {
+	case !check.Fingerprint.Valid:
+		// Trust on first use
+		_, err = v.querier.TrustMonitorHostKey(ctx, dbgen.TrustMonitorHostKeyParams{
+			MonitorID:   check.MonitorID,
+			Fingerprint: pgtype.Text{String: observed, Valid: true},
+		})
+		if err == nil {
+			logger.InfoContext(ctx, "Recorded SSH host key", slog.String("fingerprint", observed))
+		}
+
+	case check.Fingerprint.String == observed:
+		err = v.querier.RecordHostKeyMatch(ctx, check.MonitorID)
+
+	default:
+		var changed int64
+		changed, err = v.querier.RecordHostKeyMismatch(ctx, dbgen.RecordHostKeyMismatchParams{
+			MonitorID:           check.MonitorID,
+			ObservedFingerprint: pgtype.Text{String: observed, Valid: true},
+		})
+		if err != nil {
+			break
+		}
+		if changed == 0 {
+			// Already reported; keep the check time current
+			err = v.querier.TouchMonitorHostKey(ctx, check.MonitorID)
+			break
+		}
+		logger.WarnContext(ctx, "SSH host key changed",
+			slog.String("known_fingerprint", check.Fingerprint.String),
+			slog.String("observed_fingerprint", observed),
+		)
+		v.publishChanged(ctx, globals.HostKeyChangedEvent{
+			MonitorID:           check.MonitorID,
+			IP:                  ip,
+			Port:                port,
+			KnownFingerprint:    check.Fingerprint.String,
+			ObservedFingerprint: observed,
+			Timestamp:           time.Now(),
+		})
+	}
+
+	if err != nil {
+		logger.ErrorContext(ctx, "Failed to record host key check", slog.String("error", err.Error()))
+	}
+}
+
+// publishChanged sends a host key alert without blocking the check round.
+func (v *HostKeyVerifier) publishChanged(ctx context.Context, event globals.HostKeyChangedEvent) {
+	select {
+	case v.events.HostKeyChanged <- event:
+	case <-ctx.Done():
+	default:
+		v.logger.WarnContext(ctx, "HostKeyChanged channel full, event dropped",
+			slog.String("monitor_id", strconv.FormatInt(event.MonitorID, 10)),
+		)
+		v.events.RecordDropped(globals.ChannelHostKeyChanged, globals.DropChannelFull, event)
+	}
+}
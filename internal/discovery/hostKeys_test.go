@@ -0,0 +1,103 @@
+package discovery
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/nmslite/nmslite/internal/database/dbgen"
+	"github.com/nmslite/nmslite/internal/globals"
+)
+
+func TestHostKeyVerifierCheckOne(t *testing.T) {
+	globals.SetGlobalConfigForTests(&globals.Config{})
+
+	testCases := []struct {
+		name           string
+		known          string
+		observed       string
+		fetchErr       error
+		reported       bool // the observed key was already reported
+		wantTrusted    int
+		wantMatched    int
+		wantMismatched int
+		wantTouched    int
+		wantEvent      bool
+	}{
+		{"Trust on first use", "", "SHA256:aaa", nil, false, 1, 0, 0, 0, false},
+		{"Key matches", "SHA256:aaa", "SHA256:aaa", nil, false, 0, 1, 0, 0, false},
+		{"Key changed", "SHA256:aaa", "SHA256:bbb", nil, false, 0, 0, 1, 0, true},
+		{"Change already reported", "SHA256:aaa", "SHA256:bbb", nil, true, 0, 0, 1, 1, false},
+		{"Device unreachable", "SHA256:aaa", "", errors.New("connection refused"), false, 0, 0, 0, 0, false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			q := newFakeQuerier()
+			q.hostKeys[7] = dbgen.MonitorHostKey{
+				MonitorID:   7,
+				Enabled:     true,
+				Fingerprint: pgtype.Text{String: tc.known, Valid: tc.known != ""},
+			}
+			if tc.reported {
+				q.hostKeys[7] = dbgen.MonitorHostKey{
+					MonitorID:           7,
+					Enabled:             true,
+					Fingerprint:         q.hostKeys[7].Fingerprint,
+					ObservedFingerprint: pgtype.Text{String: tc.observed, Valid: true},
+				}
+			}
+			events := globals.NewEventChannels()
+			v := &HostKeyVerifier{
+				querier: q,
+				events:  events,
+				logger:  slog.New(slog.NewTextHandler(io.Discard, nil)),
+				timeout: time.Second,
+				fetch: func(target string, port int, timeout time.Duration) (string, error) {
+					if port != 2222 {
+						t.Errorf("Expected port 2222, got %d", port)
+					}
+					return tc.observed, tc.fetchErr
+				},
+			}
+
+			v.checkOne(context.Background(), dbgen.ListHostKeyChecksRow{
+				MonitorID:   7,
+				IpAddress:   netip.MustParseAddr("10.0.0.7"),
+				Port:        pgtype.Int4{Int32: 2222, Valid: true},
+				Fingerprint: pgtype.Text{String: tc.known, Valid: tc.known != ""},
+			})
+
+			if got := q.calls["TrustMonitorHostKey"]; got != tc.wantTrusted {
+				t.Errorf("Expected %d trusted keys, got %d", tc.wantTrusted, got)
+			}
+			if got := q.calls["RecordHostKeyMatch"]; got != tc.wantMatched {
+				t.Errorf("Expected %d matches, got %d", tc.wantMatched, got)
+			}
+			if got := q.calls["RecordHostKeyMismatch"]; got != tc.wantMismatched {
+				t.Errorf("Expected %d mismatches, got %d", tc.wantMismatched, got)
+			}
+			if got := q.calls["TouchMonitorHostKey"]; got != tc.wantTouched {
+				t.Errorf("Expected %d touches, got %d", tc.wantTouched, got)
+			}
+
+			select {
+			case event := <-events.HostKeyChanged:
+				if !tc.wantEvent {
+					t.Errorf("Unexpected host key event: %+v", event)
+				} else if event.MonitorID != 7 || event.KnownFingerprint != tc.known || event.ObservedFingerprint != tc.observed {
+					t.Errorf("Unexpected host key event: %+v", event)
+				}
+			default:
+				if tc.wantEvent {
+					t.Error("Expected a host key changed event")
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,73 @@
+package discovery
+
+import (
+	"sync"
+	"time"
+
+	"github.com/nmslite/nmslite/internal/globals"
+)
+
+// progressSteps is roughly how many progress events a run publishes, regardless of size
+const progressSteps = 20
+
+// progressReporter counts validated targets and publishes DiscoveryProgressEvents
+// every 1/progressSteps of the run and once on completion. Each published step is
+// also handed to persist (when set) so the job row tracks progress.
+type progressReporter struct {
+	events    *globals.EventChannels
+	profileID int64
+	jobID     int64
+	total     int
+	step      int
+	persist   func(globals.DiscoveryProgressEvent)
+
+	mu        sync.Mutex
+	processed int
+	validated int
+}
+
+func newProgressReporter(events *globals.EventChannels, profileID, jobID int64, total int, persist func(globals.DiscoveryProgressEvent)) *progressReporter {
+	return &progressReporter{
+		events:    events,
+		profileID: profileID,
+		jobID:     jobID,
+		total:     total,
+		persist:   persist,
+		step:      max(1, total/progressSteps),
+	}
+}
+
+// record counts one finished target and publishes progress when a step boundary is crossed.
+// Publishing never blocks: a full channel just skips that update.
+func (p *progressReporter) record(valid bool) {
+	p.mu.Lock()
+	p.processed++
+	if valid {
+		p.validated++
+	}
+	event := globals.DiscoveryProgressEvent{
+		ProfileID: p.profileID,
+		JobID:     p.jobID,
+		Processed: p.processed,
+		Total:     p.total,
+		Validated: p.validated,
+		Timestamp: time.Now(),
+	}
+	due := p.processed%p.step == 0 || p.processed == p.total
+	p.mu.Unlock()
+
+	if !due {
+		return
+	}
+	if p.persist != nil {
+		p.persist(event)
+	}
+	if p.events == nil {
+		return
+	}
+	select {
+	case p.events.DiscoveryProgress <- event:
+	default:
+		p.events.RecordDropped(globals.ChannelDiscoveryProgress, globals.DropChannelFull, event)
+	}
+}
@@ -0,0 +1,260 @@
+package discovery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"log/slog"
+	"net/netip"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/nmslite/nmslite/internal/database/dbgen"
+	"github.com/nmslite/nmslite/internal/globals"
+)
+
+// provisionDrainTimeout bounds how long outstanding events are processed after shutdown begins
+const provisionDrainTimeout = 10 * time.Second
+
+// ProvisionHandler consumes DeviceValidatedEvents with a bounded pool of workers.
+// Events are sharded by device (profile, IP, port), so duplicate events for the same
+// device are always handled sequentially by one worker and never race each other.
+type ProvisionHandler struct {
+	events      *globals.EventChannels
+	tx          TxFunc
+	logger      *slog.Logger
+	provisioner *Provisioner
+
+	shards []chan globals.DeviceValidatedEvent
+	wg     sync.WaitGroup
+}
+
+// StartProvisionHandler listens for DeviceValidatedEvent and creates DB entries
+// using discovery.provision_workers concurrent workers, one transaction per event.
+// On shutdown, events already queued are drained (bounded by provisionDrainTimeout); use Wait to block until done.
+func StartProvisionHandler(ctx context.Context, events *globals.EventChannels, tx TxFunc, logger *slog.Logger, provisioner *Provisioner) *ProvisionHandler {
+	workers := globals.GetConfig().Discovery.ProvisionWorkers
+	if workers <= 0 {
+		workers = 4
+	}
+
+	h := &ProvisionHandler{
+		events:      events,
+		tx:          tx,
+		logger:      logger,
+		provisioner: provisioner,
+		shards:      make([]chan globals.DeviceValidatedEvent, workers),
+	}
+
+	// DB work outlives ctx so the drain can finish; it is cut off after provisionDrainTimeout
+	runCtx, cancelRun := context.WithCancel(context.WithoutCancel(ctx))
+
+	for i := range h.shards {
+		h.shards[i] = make(chan globals.DeviceValidatedEvent, 1)
+		h.wg.Add(1)
+		go h.work(runCtx, h.shards[i])
+	}
+
+	h.wg.Add(1)
+	go h.dispatch(ctx)
+
+	go func() {
+		h.wg.Wait()
+		cancelRun()
+	}()
+
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-runCtx.Done():
+			return
+		}
+		timer := time.NewTimer(provisionDrainTimeout)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+			logger.Warn("Provision handler drain timed out, aborting outstanding events")
+			cancelRun()
+		case <-runCtx.Done():
+		}
+	}()
+
+	return h
+}
+
+// Wait blocks until the dispatcher and all workers have exited.
+func (h *ProvisionHandler) Wait() {
+	h.wg.Wait()
+}
+
+// dispatch routes events to their device's shard until shutdown, then drains what is queued.
+func (h *ProvisionHandler) dispatch(ctx context.Context) {
+	defer h.wg.Done()
+	defer func() {
+		for _, shard := range h.shards {
+			close(shard)
+		}
+	}()
+
+	for {
+		select {
+		case event, ok := <-h.events.DeviceValidated:
+			if !ok {
+				return
+			}
+			// Blocks while the shard's worker is busy: the pool size bounds DB concurrency
+			h.shardFor(event) <- event
+		case <-ctx.Done():
+			h.drain()
+			return
+		case <-h.events.Done():
+			h.drain()
+			return
+		}
+	}
+}
+
+// drain hands events still buffered in the channel to the workers.
+func (h *ProvisionHandler) drain() {
+	for {
+		select {
+		case event, ok := <-h.events.DeviceValidated:
+			if !ok {
+				return
+			}
+			h.shardFor(event) <- event
+		default:
+			return
+		}
+	}
+}
+
+// shardFor picks the worker for a device so the same device always lands on the same worker.
+func (h *ProvisionHandler) shardFor(event globals.DeviceValidatedEvent) chan<- globals.DeviceValidatedEvent {
+	hash := fnv.New32a()
+	hash.Write([]byte(strconv.FormatInt(event.DiscoveryProfile.ID, 10)))
+	hash.Write([]byte(event.IP))
+	hash.Write([]byte(strconv.Itoa(event.Port)))
+	return h.shards[hash.Sum32()%uint32(len(h.shards))]
+}
+
+func (h *ProvisionHandler) work(ctx context.Context, shard <-chan globals.DeviceValidatedEvent) {
+	defer h.wg.Done()
+	for event := range shard {
+		h.handle(ctx, event)
+	}
+}
+
+// handle creates the discovered_devices entry and auto-provisions a monitor if enabled.
+// Both rows are written in one transaction, so a failed monitor insert leaves no device
+// behind; the monitor is pushed to the poller only after the commit.
+func (h *ProvisionHandler) handle(ctx context.Context, event globals.DeviceValidatedEvent) {
+	h.logger.InfoContext(ctx, "Device validated, creating discovered_devices entry",
+		slog.String("ip", event.IP),
+		slog.Int("port", event.Port),
+		slog.String("protocol", event.Plugin.Protocol),
+	)
+
+	autoProvision := event.DiscoveryProfile.AutoProvision.Valid && event.DiscoveryProfile.AutoProvision.Bool
+
+	var monitor dbgen.Monitor
+	var duplicateOf int64
+	err := h.tx(ctx, func(q dbgen.Querier) error {
+		// 1. Create discovered_devices entry
+		device, err := q.CreateDiscoveredDevice(ctx, dbgen.CreateDiscoveredDeviceParams{
+			DiscoveryProfileID: pgtype.Int8{Int64: event.DiscoveryProfile.ID, Valid: true},
+			IpAddress:          netip.MustParseAddr(event.IP),
+			Port:               int32(event.Port),
+			Status:             pgtype.Text{String: "validated", Valid: true},
+			// The credential whose handshake succeeded, so manual provisioning uses it too
+			CredentialProfileID: pgtype.Int8{Int64: event.CredentialProfile.ID, Valid: event.CredentialProfile.ID != 0},
+			DiscoveryJobID:      pgtype.Int8{Int64: event.JobID, Valid: event.JobID != 0},
+			Protocol:            pgtype.Text{String: event.Protocol, Valid: event.Protocol != ""},
+		})
+		if err != nil {
+			return fmt.Errorf("failed to create discovered_devices entry: %w", err)
+		}
+
+		// 2. If auto_provision → create the monitor, unless one already polls the device,
+		// and mark the device provisioned
+		if !autoProvision {
+			return nil
+		}
+		duplicateOf, err = existingMonitor(ctx, q, netip.MustParseAddr(event.IP), event.Plugin.Protocol)
+		if err != nil {
+			return err
+		}
+		if duplicateOf == 0 {
+			monitor, err = h.provisioner.createMonitorFromEvent(ctx, q, event)
+			if err != nil {
+				return err
+			}
+		}
+		if err := q.UpdateDiscoveredDeviceStatus(ctx, dbgen.UpdateDiscoveredDeviceStatusParams{
+			ID:     device.ID,
+			Status: pgtype.Text{String: "provisioned", Valid: true},
+		}); err != nil {
+			return fmt.Errorf("failed to update discovered device status: %w", err)
+		}
+		return nil
+	})
+	if event.Recorded != nil {
+		event.Recorded(err)
+	}
+	if err != nil {
+		h.logger.ErrorContext(ctx, "Failed to record validated device",
+			slog.String("ip", event.IP),
+			slog.Bool("auto_provision", autoProvision),
+			slog.String("error", err.Error()),
+		)
+		return
+	}
+	if !autoProvision {
+		return
+	}
+	if duplicateOf != 0 {
+		h.logger.InfoContext(ctx, "Device already monitored, skipped auto-provision",
+			slog.String("ip", event.IP),
+			slog.String("protocol", event.Plugin.Protocol),
+			slog.Int64("monitor_id", duplicateOf),
+		)
+		return
+	}
+
+	// 3. Push the committed monitor to the poller
+	if err := h.provisioner.pushToPoller(ctx, monitor.ID); err != nil {
+		h.logger.ErrorContext(ctx, "Monitor created but cache invalidation failed",
+			slog.Int64("monitor_id", monitor.ID),
+			slog.String("ip", event.IP),
+			slog.String("error", err.Error()),
+		)
+		return
+	}
+	h.logger.InfoContext(ctx, "Monitor created via auto-provision",
+		slog.Int64("monitor_id", monitor.ID),
+		slog.String("ip", event.IP),
+	)
+}
+
+// existingMonitor returns the ID of a monitor already polling ip with pluginID, or 0 when
+// there is none or scheduler.duplicate_monitor_policy is "allow"
+func existingMonitor(ctx context.Context, q dbgen.Querier, ip netip.Addr, pluginID string) (int64, error) {
+	if globals.GetConfig().Scheduler.DuplicateMonitors() == "allow" {
+		return 0, nil
+	}
+	existing, err := q.GetMonitorByIPAndPlugin(ctx, dbgen.GetMonitorByIPAndPluginParams{
+		IpAddress: ip,
+		PluginID:  pluginID,
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to look up existing monitor: %w", err)
+	}
+	return existing.ID, nil
+}
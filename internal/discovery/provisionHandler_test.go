@@ -0,0 +1,126 @@
+package discovery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/nmslite/nmslite/internal/database/dbgen"
+	"github.com/nmslite/nmslite/internal/globals"
+)
+
+// directTx runs fn straight on q, without a transaction
+func directTx(q dbgen.Querier) TxFunc {
+	return func(ctx context.Context, fn func(q dbgen.Querier) error) error {
+		return fn(q)
+	}
+}
+
+func TestProvisionHandlerConcurrencyAndDrain(t *testing.T) {
+	globals.SetGlobalConfigForTests(&globals.Config{
+		Discovery: globals.DiscoveryConfig{ProvisionWorkers: 3},
+		Channel:   globals.EventBusConfig{DiscoveryEventsChannelSize: 100},
+	})
+
+	events := globals.NewEventChannels()
+	querier := newFakeQuerier()
+	querier.delay = 2 * time.Millisecond
+
+	// Queue everything before starting so shutdown has to drain the backlog
+	const total = 60
+	for i := 0; i < total; i++ {
+		events.DeviceValidated <- globals.DeviceValidatedEvent{
+			Plugin: &globals.PluginInfo{Protocol: "ssh"},
+			IP:     fmt.Sprintf("192.0.2.%d", i%10), // duplicates of the same device
+			Port:   22,
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	h := StartProvisionHandler(ctx, events, directTx(querier), slog.Default(), nil)
+	cancel()
+	h.Wait()
+
+	querier.mu.Lock()
+	defer querier.mu.Unlock()
+	if created := querier.calls["CreateDiscoveredDevice"]; created != total {
+		t.Errorf("Expected all %d queued events to be drained, got %d", total, created)
+	}
+	if querier.maxActive > 3 {
+		t.Errorf("Expected at most 3 concurrent inserts, got %d", querier.maxActive)
+	}
+	if querier.overlapped {
+		t.Error("Events for the same device must not be processed concurrently")
+	}
+}
+
+func TestProvisionHandlerIsTransactional(t *testing.T) {
+	globals.SetGlobalConfigForTests(&globals.Config{
+		Channel: globals.EventBusConfig{CacheEventsChannelSize: 1},
+	})
+
+	testCases := []struct {
+		name          string
+		autoProvision bool
+		failMonitor   bool
+		monitored     bool   // a monitor already polls the device
+		wantDevice    string // status of the stored device, "" when none is stored
+		wantMonitors  int
+		wantPushed    int
+	}{
+		{"Discovery only", false, false, false, "validated", 0, 0},
+		{"Auto-provisioned", true, false, false, "provisioned", 1, 1},
+		{"Monitor insert fails", true, true, false, "", 0, 0},
+		{"Already monitored", true, false, true, "provisioned", 1, 0},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			events := globals.NewEventChannels()
+			db := newFakeQuerier()
+			if tc.failMonitor {
+				db.fail["CreateMonitor"] = errors.New("duplicate key value violates unique constraint")
+			}
+			if tc.monitored {
+				db.monitors[100] = dbgen.Monitor{ID: 100, IpAddress: netip.MustParseAddr("192.0.2.10"), PluginID: "ssh"}
+			}
+			h := &ProvisionHandler{
+				tx:          fakeTx(db),
+				logger:      slog.Default(),
+				provisioner: NewProvisioner(db, fakeTx(db), events, nil, slog.Default()),
+			}
+
+			var recorded []error
+			h.handle(context.Background(), globals.DeviceValidatedEvent{
+				Plugin:            &globals.PluginInfo{Protocol: "ssh"},
+				DiscoveryProfile:  dbgen.DiscoveryProfile{ID: 1, AutoProvision: pgtype.Bool{Bool: tc.autoProvision, Valid: true}},
+				CredentialProfile: dbgen.CredentialProfile{ID: 2},
+				IP:                "192.0.2.10",
+				Port:              22,
+				Recorded:          func(err error) { recorded = append(recorded, err) },
+			})
+			if len(recorded) != 1 || (recorded[0] == nil) != (tc.wantDevice != "") {
+				t.Errorf("Expected one Recorded call reporting stored=%v, got %v", tc.wantDevice != "", recorded)
+			}
+
+			var status string
+			for _, device := range db.devices {
+				status = device.Status.String
+			}
+			if len(db.devices) > 1 || status != tc.wantDevice {
+				t.Errorf("Expected stored device %q, got %d devices (status %q)", tc.wantDevice, len(db.devices), status)
+			}
+			if len(db.monitors) != tc.wantMonitors {
+				t.Errorf("Expected %d monitors, got %d", tc.wantMonitors, len(db.monitors))
+			}
+			if pushed := len(events.CacheInvalidate); pushed != tc.wantPushed {
+				t.Errorf("Expected %d cache invalidations, got %d", tc.wantPushed, pushed)
+			}
+		})
+	}
+}
@@ -2,13 +2,15 @@ package discovery
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 	"net/netip"
-
 	"strconv"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/nmslite/nmslite/internal/database/dbgen"
 	"github.com/nmslite/nmslite/internal/globals"
 	"github.com/nmslite/nmslite/internal/poller"
@@ -17,29 +19,57 @@ import (
 // Provisioner handles the logic for provisioning monitors from discovered devices.
 type Provisioner struct {
 	querier       dbgen.Querier
+	tx            TxFunc // runs ProvisionDevices batches
 	events        *globals.EventChannels
 	pluginManager *poller.PluginManager
 	logger        *slog.Logger
 }
 
 // NewProvisioner creates a new Provisioner.
-func NewProvisioner(querier dbgen.Querier, events *globals.EventChannels, pluginManager *poller.PluginManager, logger *slog.Logger) *Provisioner {
+func NewProvisioner(querier dbgen.Querier, tx TxFunc, events *globals.EventChannels, pluginManager *poller.PluginManager, logger *slog.Logger) *Provisioner {
 	return &Provisioner{
 		querier:       querier,
+		tx:            tx,
 		events:        events,
 		pluginManager: pluginManager,
 		logger:        logger,
 	}
 }
 
-// ProvisionFromEvent creates a monitor based on a validated discovery event.
-func (p *Provisioner) ProvisionFromEvent(ctx context.Context, event globals.DeviceValidatedEvent) error {
+// TxFunc runs fn in a database transaction that is committed only if fn returns nil
+type TxFunc func(ctx context.Context, fn func(q dbgen.Querier) error) error
+
+// PoolTx returns a TxFunc that runs each transaction on a connection from pool
+func PoolTx(pool *pgxpool.Pool) TxFunc {
+	return func(ctx context.Context, fn func(q dbgen.Querier) error) error {
+		tx, err := pool.Begin(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to begin transaction: %w", err)
+		}
+		defer func() {
+			// Rollback after Commit is a no-op returning ErrTxClosed
+			_ = tx.Rollback(context.WithoutCancel(ctx))
+		}()
+
+		if err := fn(dbgen.New(tx)); err != nil {
+			return err
+		}
+		if err := tx.Commit(ctx); err != nil {
+			return fmt.Errorf("failed to commit transaction: %w", err)
+		}
+		return nil
+	}
+}
+
+// createMonitorFromEvent creates a monitor for a validated discovery event using q, which
+// may be a transaction. The caller pushes it to the poller once the monitor is committed.
+func (p *Provisioner) createMonitorFromEvent(ctx context.Context, q dbgen.Querier, event globals.DeviceValidatedEvent) (dbgen.Monitor, error) {
 	p.logger.InfoContext(ctx, "Provisioning monitor from event",
 		slog.String("ip", event.IP),
 		slog.String("plugin", event.Plugin.Protocol),
 	)
 
-	monitor, err := p.querier.CreateMonitor(ctx, dbgen.CreateMonitorParams{
+	monitor, err := q.CreateMonitor(ctx, dbgen.CreateMonitorParams{
 		IpAddress:           netip.MustParseAddr(event.IP),
 		Hostname:            pgtype.Text{String: event.Hostname, Valid: event.Hostname != ""},
 		Port:                pgtype.Int4{Int32: int32(event.Port), Valid: true},
@@ -48,10 +78,9 @@ func (p *Provisioner) ProvisionFromEvent(ctx context.Context, event globals.Devi
 		DiscoveryProfileID:  event.DiscoveryProfile.ID,
 	})
 	if err != nil {
-		return fmt.Errorf("failed to create monitor: %w", err)
+		return dbgen.Monitor{}, fmt.Errorf("failed to create monitor: %w", err)
 	}
-
-	return p.pushToPoller(ctx, monitor.ID)
+	return monitor, nil
 }
 
 // ProvisionFromID provisions a monitor from an existing discovered_device ID.
@@ -62,52 +91,20 @@ func (p *Provisioner) ProvisionFromID(ctx context.Context, deviceID int64) (*dbg
 		return nil, fmt.Errorf("failed to fetch discovered device: %w", err)
 	}
 
-	if !device.DiscoveryProfileID.Valid {
-		return nil, fmt.Errorf("discovered device has no associated discovery profile")
-	}
-
-	// 2. Fetch Discovery Profile
-	profile, err := p.querier.GetDiscoveryProfile(ctx, device.DiscoveryProfileID.Int64)
-	if err != nil {
-		return nil, fmt.Errorf("failed to fetch discovery profile: %w", err)
-	}
-
-	// 3. Fetch Credential Profile (to get protocol)
-	credProfile, err := p.querier.GetCredentialProfile(ctx, profile.CredentialProfileID)
+	// 2-4. Resolve the profiles and plugin the monitor is created with
+	params, err := p.monitorParams(ctx, p.querier, device)
 	if err != nil {
-		return nil, fmt.Errorf("failed to fetch credential profile: %w", err)
-	}
-
-	// 4. Resolve Plugin ID
-	// Try to find registered plugin
-	pluginID := credProfile.Protocol // Default to protocol name if not internal
-	if plugin, ok := p.pluginManager.Get(credProfile.Protocol); ok {
-		pluginID = plugin.Protocol
-	} else {
-		// Fallback for internal protocols or if registry lookup fails (assuming protocol name = plugin id for simple cases)
-		// Or we can check if it's one of the known internal ones?
-		// Worker.go handles this by creating a placeholder.
-		// For provisioning, we need the DB 'plugin_id' logic.
-		// If it's internal, usually plugin_id is just the protocol name (e.g. 'ping'?).
-		// Wait, worker.go uses `credProfile.Protocol` as placeholder ID.
+		return nil, err
 	}
 
 	p.logger.InfoContext(ctx, "Provisioning monitor from ID",
 		slog.String("device_id", strconv.FormatInt(deviceID, 10)),
 		slog.String("ip", device.IpAddress.String()),
-		slog.String("plugin", pluginID),
+		slog.String("plugin", params.PluginID),
 	)
 
 	// 5. Create Monitor
-	// Note: Hostname is not available in DiscoveredDevice table, so we leave it empty or null.
-	monitor, err := p.querier.CreateMonitor(ctx, dbgen.CreateMonitorParams{
-		IpAddress:           device.IpAddress,
-		Hostname:            pgtype.Text{Valid: false}, // Unknown
-		Port:                pgtype.Int4{Int32: device.Port, Valid: true},
-		PluginID:            pluginID,
-		CredentialProfileID: profile.CredentialProfileID,
-		DiscoveryProfileID:  profile.ID,
-	})
+	monitor, err := p.querier.CreateMonitor(ctx, params)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create monitor: %w", err)
 	}
@@ -128,19 +125,280 @@ func (p *Provisioner) ProvisionFromID(ctx context.Context, deviceID int64) (*dbg
 	return &monitor, nil
 }
 
-func (p *Provisioner) pushToPoller(ctx context.Context, monitorID int64) error {
-	fullMonitor, err := p.querier.GetMonitorWithCredentials(ctx, monitorID)
+// errNoDiscoveryProfile is returned for devices whose discovery profile link was cleared
+var errNoDiscoveryProfile = errors.New("discovered device has no associated discovery profile")
+
+// monitorParams resolves the discovery profile, credential profile and plugin for a
+// discovered device and returns the monitor to create for it
+func (p *Provisioner) monitorParams(ctx context.Context, q dbgen.Querier, device dbgen.DiscoveredDevice) (dbgen.CreateMonitorParams, error) {
+	if !device.DiscoveryProfileID.Valid {
+		return dbgen.CreateMonitorParams{}, errNoDiscoveryProfile
+	}
+
+	profile, err := q.GetDiscoveryProfile(ctx, device.DiscoveryProfileID.Int64)
 	if err != nil {
-		return fmt.Errorf("failed to fetch full monitor for cache: %w", err)
+		return dbgen.CreateMonitorParams{}, fmt.Errorf("failed to fetch discovery profile: %w", err)
 	}
 
-	select {
-	case p.events.CacheInvalidate <- globals.CacheInvalidateEvent{
+	// Fetch Credential Profile (to get protocol)
+	credProfile, err := q.GetCredentialProfile(ctx, deviceCredentialID(device, profile))
+	if err != nil {
+		return dbgen.CreateMonitorParams{}, fmt.Errorf("failed to fetch credential profile: %w", err)
+	}
+	return p.newMonitorParams(device, profile, credProfile), nil
+}
+
+// deviceCredentialID returns the credential profile a device is monitored with: the one
+// that validated it, or its discovery profile's for devices recorded before that was stored
+func deviceCredentialID(device dbgen.DiscoveredDevice, profile dbgen.DiscoveryProfile) int64 {
+	if device.CredentialProfileID.Valid {
+		return device.CredentialProfileID.Int64
+	}
+	return profile.CredentialProfileID
+}
+
+// newMonitorParams returns the monitor to create for a device from its resolved profiles
+func (p *Provisioner) newMonitorParams(device dbgen.DiscoveredDevice, profile dbgen.DiscoveryProfile, credProfile dbgen.CredentialProfile) dbgen.CreateMonitorParams {
+	// Resolve Plugin ID from the protocol the device answered on, falling back to the
+	// credential's for devices recorded before it was stored
+	protocol := credProfile.Protocol
+	if device.Protocol.Valid && device.Protocol.String != "" {
+		protocol = device.Protocol.String
+	}
+	// Internal protocols have no registered plugin; their plugin_id is the protocol name
+	pluginID := protocol
+	if p.pluginManager != nil {
+		if plugin, ok := p.pluginManager.Get(protocol); ok {
+			pluginID = plugin.Protocol
+		}
+	}
+
+	// Hostname is not available in DiscoveredDevice table, so it is left NULL
+	return dbgen.CreateMonitorParams{
+		IpAddress:           device.IpAddress,
+		Hostname:            pgtype.Text{Valid: false},
+		Port:                pgtype.Int4{Int32: device.Port, Valid: true},
+		PluginID:            pluginID,
+		CredentialProfileID: credProfile.ID,
+		DiscoveryProfileID:  profile.ID,
+	}
+}
+
+// Outcomes of provisioning one device with ProvisionDevices
+const (
+	ProvisionCreated          = "provisioned"       // a monitor was created
+	ProvisionAlreadyMonitored = "already_monitored" // a live monitor already polls the device
+	ProvisionFailed           = "failed"            // the device or its profiles could not be resolved
+)
+
+// ProvisionOverrides replace defaults on every monitor created by ProvisionDevices
+type ProvisionOverrides struct {
+	PollingIntervalSeconds pgtype.Int4 // NULL keeps the default
+	KeepPollingWhenDown    bool
+}
+
+// ProvisionResult is the outcome for one device passed to ProvisionDevices
+type ProvisionResult struct {
+	DeviceID  int64  `json:"device_id"`
+	Status    string `json:"status"`
+	MonitorID int64  `json:"monitor_id,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// ProvisionDevices provisions monitors for discovered devices in one transaction and
+// returns a result per device, in the order given (repeated IDs are provisioned once).
+// Devices that cannot be resolved fail on their own; a database error rolls back the
+// whole batch. Created monitors are pushed to the poller together after the commit.
+func (p *Provisioner) ProvisionDevices(ctx context.Context, deviceIDs []int64, overrides ProvisionOverrides) ([]ProvisionResult, error) {
+	seen := make(map[int64]bool, len(deviceIDs))
+	ids := make([]int64, 0, len(deviceIDs))
+	for _, id := range deviceIDs {
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+
+	var results []ProvisionResult
+	var created []int64
+	err := p.tx(ctx, func(q dbgen.Querier) error {
+		results, created = nil, nil
+		batch, err := loadProvisionBatch(ctx, q, ids)
+		if err != nil {
+			return err
+		}
+		for _, id := range ids {
+			result, err := p.provisionDevice(ctx, q, batch, id, overrides)
+			if err != nil {
+				return err
+			}
+			results = append(results, result)
+			if result.Status == ProvisionCreated {
+				created = append(created, result.MonitorID)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	p.logger.InfoContext(ctx, "Provisioned discovered devices",
+		slog.Int("devices", len(results)),
+		slog.Int("created", len(created)),
+	)
+	if len(created) > 0 {
+		// The monitors are committed either way, so as with auto-provisioning a failed
+		// push is only logged
+		if err := p.pushToPoller(ctx, created...); err != nil {
+			p.logger.ErrorContext(ctx, "Failed to push provisioned monitors to poller", slog.String("error", err.Error()))
+		}
+	}
+	return results, nil
+}
+
+// provisionBatch holds the rows a ProvisionDevices batch resolves its devices against,
+// fetched with one query per table rather than per device
+type provisionBatch struct {
+	devices     map[int64]dbgen.DiscoveredDevice
+	profiles    map[int64]dbgen.DiscoveryProfile
+	credentials map[int64]dbgen.CredentialProfile
+}
+
+// loadProvisionBatch fetches the devices, and the discovery and credential profiles they
+// reference, using q
+func loadProvisionBatch(ctx context.Context, q dbgen.Querier, deviceIDs []int64) (provisionBatch, error) {
+	batch := provisionBatch{
+		devices:     make(map[int64]dbgen.DiscoveredDevice, len(deviceIDs)),
+		profiles:    make(map[int64]dbgen.DiscoveryProfile),
+		credentials: make(map[int64]dbgen.CredentialProfile),
+	}
+
+	devices, err := q.ListDiscoveredDevicesByIDs(ctx, deviceIDs)
+	if err != nil {
+		return batch, fmt.Errorf("failed to fetch discovered devices: %w", err)
+	}
+	var profileIDs []int64
+	for _, device := range devices {
+		batch.devices[device.ID] = device
+		if device.DiscoveryProfileID.Valid {
+			profileIDs = append(profileIDs, device.DiscoveryProfileID.Int64)
+		}
+	}
+
+	profiles, err := q.ListDiscoveryProfilesByIDs(ctx, profileIDs)
+	if err != nil {
+		return batch, fmt.Errorf("failed to fetch discovery profiles: %w", err)
+	}
+	for _, profile := range profiles {
+		batch.profiles[profile.ID] = profile
+	}
+
+	var credentialIDs []int64
+	for _, device := range devices {
+		if !device.DiscoveryProfileID.Valid {
+			continue
+		}
+		if profile, ok := batch.profiles[device.DiscoveryProfileID.Int64]; ok {
+			credentialIDs = append(credentialIDs, deviceCredentialID(device, profile))
+		}
+	}
+	credentials, err := q.ListCredentialProfilesByIDs(ctx, credentialIDs)
+	if err != nil {
+		return batch, fmt.Errorf("failed to fetch credential profiles: %w", err)
+	}
+	for _, credential := range credentials {
+		batch.credentials[credential.ID] = credential
+	}
+	return batch, nil
+}
+
+// monitorParams returns the monitor to create for a device of the batch, failing with
+// pgx.ErrNoRows or errNoDiscoveryProfile when the device or its profiles are missing
+func (b provisionBatch) monitorParams(p *Provisioner, deviceID int64) (dbgen.CreateMonitorParams, error) {
+	device, ok := b.devices[deviceID]
+	if !ok {
+		return dbgen.CreateMonitorParams{}, fmt.Errorf("discovered device %d not found: %w", deviceID, pgx.ErrNoRows)
+	}
+	if !device.DiscoveryProfileID.Valid {
+		return dbgen.CreateMonitorParams{}, errNoDiscoveryProfile
+	}
+	profile, ok := b.profiles[device.DiscoveryProfileID.Int64]
+	if !ok {
+		return dbgen.CreateMonitorParams{}, fmt.Errorf("failed to fetch discovery profile: %w", pgx.ErrNoRows)
+	}
+	credProfile, ok := b.credentials[deviceCredentialID(device, profile)]
+	if !ok {
+		return dbgen.CreateMonitorParams{}, fmt.Errorf("failed to fetch credential profile: %w", pgx.ErrNoRows)
+	}
+	return p.newMonitorParams(device, profile, credProfile), nil
+}
+
+// provisionDevice provisions one device of a ProvisionDevices batch using q. Only
+// database errors are returned; everything else is reported in the result.
+func (p *Provisioner) provisionDevice(ctx context.Context, q dbgen.Querier, batch provisionBatch, deviceID int64, overrides ProvisionOverrides) (ProvisionResult, error) {
+	result := ProvisionResult{DeviceID: deviceID}
+	params, err := batch.monitorParams(p, deviceID)
+	if err != nil {
+		result.Status = ProvisionFailed
+		result.Error = err.Error()
+		return result, nil
+	}
+
+	existing, err := existingMonitor(ctx, q, params.IpAddress, params.PluginID)
+	if err != nil {
+		return result, err
+	}
+	if existing != 0 {
+		result.Status = ProvisionAlreadyMonitored
+		result.MonitorID = existing
+	} else {
+		params.PollingIntervalSeconds = overrides.PollingIntervalSeconds
+		params.KeepPollingWhenDown = overrides.KeepPollingWhenDown
+		monitor, err := q.CreateMonitor(ctx, params)
+		if err != nil {
+			return result, fmt.Errorf("failed to create monitor for device %d: %w", deviceID, err)
+		}
+		result.Status = ProvisionCreated
+		result.MonitorID = monitor.ID
+	}
+
+	if err := q.UpdateDiscoveredDeviceStatus(ctx, dbgen.UpdateDiscoveredDeviceStatusParams{
+		ID:     deviceID,
+		Status: pgtype.Text{String: "provisioned", Valid: true},
+	}); err != nil {
+		return result, fmt.Errorf("failed to update discovered device status: %w", err)
+	}
+	return result, nil
+}
+
+// pushToPoller sends the monitors to the scheduler's cache in one update event. The
+// monitors are committed, so the push outlives ctx, which may be an API request about
+// to end, and is bounded by channel.cache_event_send_timeout_ms instead.
+func (p *Provisioner) pushToPoller(ctx context.Context, monitorIDs ...int64) error {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), globals.GetConfig().Channel.CacheEventSendTimeout())
+	defer cancel()
+
+	seq := globals.NextCacheInvalidateSeq()
+	monitors := make([]dbgen.GetMonitorWithCredentialsRow, 0, len(monitorIDs))
+	for _, id := range monitorIDs {
+		fullMonitor, err := p.querier.GetMonitorWithCredentials(ctx, id)
+		if err != nil {
+			return fmt.Errorf("failed to fetch full monitor for cache: %w", err)
+		}
+		monitors = append(monitors, fullMonitor)
+	}
+
+	event := globals.CacheInvalidateEvent{
 		UpdateType: "update",
-		Monitors:   []dbgen.GetMonitorWithCredentialsRow{fullMonitor},
-	}:
+		Monitors:   monitors,
+		Seq:        seq,
+	}
+	select {
+	case p.events.CacheInvalidate <- event:
 		return nil
 	case <-ctx.Done():
+		p.events.RecordDropped(globals.ChannelCacheInvalidate, globals.DropTimeout, event)
 		return ctx.Err()
 	}
 }
@@ -0,0 +1,119 @@
+package discovery
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/netip"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/nmslite/nmslite/internal/database/dbgen"
+	"github.com/nmslite/nmslite/internal/globals"
+)
+
+// inventoryDB returns a store with four discovered devices: 1 and 2 are ready to
+// provision, a monitor already polls 3 and 4 has lost its discovery profile
+func inventoryDB() *fakeQuerier {
+	db := newFakeQuerier()
+	db.profiles[1] = dbgen.DiscoveryProfile{ID: 1, CredentialProfileID: 2}
+	db.credentials[2] = dbgen.CredentialProfile{ID: 2, Protocol: "ssh"}
+	for id, ip := range map[int64]string{1: "192.0.2.1", 2: "192.0.2.2", 3: "192.0.2.3", 4: "192.0.2.4"} {
+		db.devices[id] = dbgen.DiscoveredDevice{
+			ID:                 id,
+			DiscoveryProfileID: pgtype.Int8{Int64: 1, Valid: id != 4},
+			IpAddress:          netip.MustParseAddr(ip),
+			Port:               22,
+			Status:             pgtype.Text{String: "validated", Valid: true},
+		}
+	}
+	db.monitors[50] = dbgen.Monitor{ID: 50, IpAddress: netip.MustParseAddr("192.0.2.3"), PluginID: "ssh"}
+	return db
+}
+
+func TestProvisionDevices(t *testing.T) {
+	globals.SetGlobalConfigForTests(&globals.Config{
+		Channel: globals.EventBusConfig{CacheEventsChannelSize: 1},
+	})
+
+	events := globals.NewEventChannels()
+	db := inventoryDB()
+	p := NewProvisioner(db, fakeTx(db), events, nil, slog.Default())
+
+	results, err := p.ProvisionDevices(context.Background(), []int64{1, 2, 3, 4, 99, 1},
+		ProvisionOverrides{PollingIntervalSeconds: pgtype.Int4{Int32: 300, Valid: true}})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	want := []struct {
+		id        int64
+		status    string
+		monitorID int64
+	}{
+		{1, ProvisionCreated, 51},
+		{2, ProvisionCreated, 52},
+		{3, ProvisionAlreadyMonitored, 50},
+		{4, ProvisionFailed, 0},
+		{99, ProvisionFailed, 0},
+	}
+	if len(results) != len(want) {
+		t.Fatalf("Expected %d results, got %d: %+v", len(want), len(results), results)
+	}
+	for i, w := range want {
+		got := results[i]
+		if got.DeviceID != w.id || got.Status != w.status || got.MonitorID != w.monitorID {
+			t.Errorf("Expected device %d %s (monitor %d), got %+v", w.id, w.status, w.monitorID, got)
+		}
+		if (got.Status == ProvisionFailed) != (got.Error != "") {
+			t.Errorf("Expected an error only for failed devices, got %+v", got)
+		}
+	}
+
+	for id, status := range map[int64]string{1: "provisioned", 2: "provisioned", 3: "provisioned", 4: "validated"} {
+		if got := db.devices[id].Status.String; got != status {
+			t.Errorf("Expected device %d status %q, got %q", id, status, got)
+		}
+	}
+	if interval := db.monitors[51].PollingIntervalSeconds; interval.Int32 != 300 {
+		t.Errorf("Expected polling interval override 300, got %d", interval.Int32)
+	}
+	for _, query := range []string{"ListDiscoveredDevicesByIDs", "ListDiscoveryProfilesByIDs", "ListCredentialProfilesByIDs"} {
+		if calls := db.calls[query]; calls != 1 {
+			t.Errorf("Expected one %s for the batch, got %d", query, calls)
+		}
+	}
+
+	select {
+	case event := <-events.CacheInvalidate:
+		if len(event.Monitors) != 2 {
+			t.Errorf("Expected 2 monitors in one cache update, got %d", len(event.Monitors))
+		}
+	default:
+		t.Error("Expected created monitors to be pushed to the poller")
+	}
+}
+
+func TestProvisionDevicesRollsBack(t *testing.T) {
+	globals.SetGlobalConfigForTests(&globals.Config{
+		Channel: globals.EventBusConfig{CacheEventsChannelSize: 1},
+	})
+
+	events := globals.NewEventChannels()
+	db := inventoryDB()
+	db.fail["CreateMonitor"] = errors.New("duplicate key value violates unique constraint")
+	p := NewProvisioner(db, fakeTx(db), events, nil, slog.Default())
+
+	if _, err := p.ProvisionDevices(context.Background(), []int64{3, 1}, ProvisionOverrides{}); err == nil {
+		t.Fatal("Expected a failed monitor insert to fail the batch")
+	}
+	if got := db.devices[3].Status.String; got != "validated" {
+		t.Errorf("Expected the batch to be rolled back, got device 3 status %q", got)
+	}
+	if len(db.monitors) != 1 {
+		t.Errorf("Expected no monitors created, got %d", len(db.monitors)-1)
+	}
+	if pushed := len(events.CacheInvalidate); pushed != 0 {
+		t.Errorf("Expected no cache invalidations, got %d", pushed)
+	}
+}
@@ -0,0 +1,150 @@
+package discovery
+
+import (
+	"context"
+	"log/slog"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/nmslite/nmslite/internal/database/dbgen"
+	"github.com/nmslite/nmslite/internal/globals"
+)
+
+// Scheduler emits DiscoveryRequestEvents for profiles with a recurring interval_seconds.
+// A profile is due once last_run_at + interval_seconds has passed; the worker updates
+// last_run_at when the run starts, so the next due time follows from the DB.
+type Scheduler struct {
+	events  *globals.EventChannels
+	querier dbgen.Querier
+	worker  *Worker
+	logger  *slog.Logger
+
+	tickInterval time.Duration
+
+	// dispatchedMu protects dispatched
+	dispatchedMu sync.Mutex
+	// dispatched remembers until when a queued profile counts as dispatched (queue time
+	// plus its interval), so a run still waiting in the channel (last_run_at not yet
+	// updated) is not queued again. Expired entries are pruned every tick.
+	dispatched map[int64]time.Time
+}
+
+// NewScheduler creates a new discovery scheduler.
+func NewScheduler(events *globals.EventChannels, querier dbgen.Querier, worker *Worker, logger *slog.Logger) *Scheduler {
+	tickInterval := globals.GetConfig().Discovery.ScheduleTickInterval()
+	if tickInterval <= 0 {
+		tickInterval = 30 * time.Second
+	}
+
+	return &Scheduler{
+		events:       events,
+		querier:      querier,
+		worker:       worker,
+		logger:       logger,
+		tickInterval: tickInterval,
+		dispatched:   make(map[int64]time.Time),
+	}
+}
+
+// Run checks for due profiles every tick until the context is cancelled.
+func (s *Scheduler) Run(ctx context.Context) error {
+	s.logger.InfoContext(ctx, "Discovery scheduler starting",
+		slog.String("tick_interval", s.tickInterval.String()),
+	)
+
+	ticker := time.NewTicker(s.tickInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			s.logger.InfoContext(ctx, "Discovery scheduler shutting down")
+			return ctx.Err()
+		case <-s.events.Done():
+			return nil
+		case <-ticker.C:
+			s.tick(ctx)
+		}
+	}
+}
+
+// tick queues a discovery run for every due profile that is not already running or queued.
+func (s *Scheduler) tick(ctx context.Context) {
+	profiles, err := s.querier.ListDueDiscoveryProfiles(ctx)
+	if err != nil {
+		s.logger.ErrorContext(ctx, "Failed to list due discovery profiles",
+			slog.String("error", err.Error()),
+		)
+		return
+	}
+
+	now := time.Now()
+	s.pruneDispatched(now)
+	for _, profile := range profiles {
+		profileID := strconv.FormatInt(profile.ID, 10)
+
+		// Overlapping run: skip, the next tick after it finishes will re-evaluate
+		if s.worker != nil && s.worker.IsRunning(profile.ID) {
+			s.logger.DebugContext(ctx, "Scheduled discovery still running, skipping",
+				slog.String("profile_id", profileID),
+			)
+			continue
+		}
+
+		interval := time.Duration(profile.IntervalSeconds.Int32) * time.Second
+		if !s.markDispatched(profile.ID, interval, now) {
+			continue
+		}
+
+		select {
+		case s.events.DiscoveryRequest <- globals.DiscoveryRequestEvent{
+			ProfileID: profile.ID,
+			StartedAt: now,
+		}:
+			s.logger.InfoContext(ctx, "Scheduled discovery queued",
+				slog.String("profile_id", profileID),
+				slog.String("interval", interval.String()),
+			)
+		case <-ctx.Done():
+			return
+		default:
+			s.clearDispatched(profile.ID)
+			s.logger.WarnContext(ctx, "DiscoveryRequest channel full, scheduled run deferred",
+				slog.String("profile_id", profileID),
+			)
+		}
+	}
+}
+
+// markDispatched records a dispatch unless the profile was already queued within its interval.
+func (s *Scheduler) markDispatched(profileID int64, interval time.Duration, now time.Time) bool {
+	s.dispatchedMu.Lock()
+	defer s.dispatchedMu.Unlock()
+
+	if until, ok := s.dispatched[profileID]; ok && now.Before(until) {
+		return false
+	}
+	s.dispatched[profileID] = now.Add(interval)
+	return true
+}
+
+// pruneDispatched forgets dispatches whose interval has passed. Profiles still due are
+// marked again; the rest (run, deleted or unscheduled since) would otherwise stay forever.
+func (s *Scheduler) pruneDispatched(now time.Time) {
+	s.dispatchedMu.Lock()
+	defer s.dispatchedMu.Unlock()
+
+	for profileID, until := range s.dispatched {
+		if !now.Before(until) {
+			delete(s.dispatched, profileID)
+		}
+	}
+}
+
+// clearDispatched forgets a dispatch that never reached the worker.
+func (s *Scheduler) clearDispatched(profileID int64) {
+	s.dispatchedMu.Lock()
+	defer s.dispatchedMu.Unlock()
+	delete(s.dispatched, profileID)
+}
@@ -0,0 +1,106 @@
+package discovery
+
+import (
+	"context"
+	"log/slog"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/nmslite/nmslite/internal/database/dbgen"
+	"github.com/nmslite/nmslite/internal/globals"
+)
+
+// queuedProfiles drains the profile IDs queued on ch
+func queuedProfiles(ch chan globals.DiscoveryRequestEvent) []int64 {
+	var ids []int64
+	for {
+		select {
+		case event := <-ch:
+			ids = append(ids, event.ProfileID)
+		default:
+			return ids
+		}
+	}
+}
+
+func TestSchedulerTick(t *testing.T) {
+	every := pgtype.Int4{Int32: 300, Valid: true}
+	ranAgo := func(d time.Duration) pgtype.Timestamptz {
+		return pgtype.Timestamptz{Time: time.Now().Add(-d), Valid: true}
+	}
+
+	testCases := []struct {
+		name       string
+		profile    dbgen.DiscoveryProfile
+		running    bool
+		buffer     int
+		ticks      int
+		wantQueued []int64
+	}{
+		{"Never run is due", dbgen.DiscoveryProfile{ID: 1, IntervalSeconds: every}, false, 4, 1, []int64{1}},
+		{"Interval elapsed is due", dbgen.DiscoveryProfile{ID: 1, IntervalSeconds: every, LastRunAt: ranAgo(time.Hour)}, false, 4, 1, []int64{1}},
+		{"Within interval is not due", dbgen.DiscoveryProfile{ID: 1, IntervalSeconds: every, LastRunAt: ranAgo(time.Minute)}, false, 4, 1, nil},
+		{"Unscheduled is not due", dbgen.DiscoveryProfile{ID: 1}, false, 4, 1, nil},
+		{"Still running is skipped", dbgen.DiscoveryProfile{ID: 1, IntervalSeconds: every}, true, 4, 1, nil},
+		{"Queued run is not queued again within its interval", dbgen.DiscoveryProfile{ID: 1, IntervalSeconds: every}, false, 4, 3, []int64{1}},
+		{"Full channel defers the run", dbgen.DiscoveryProfile{ID: 1, IntervalSeconds: every}, false, 0, 2, nil},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			q := newFakeQuerier()
+			q.profiles[tc.profile.ID] = tc.profile
+			events := &globals.EventChannels{DiscoveryRequest: make(chan globals.DiscoveryRequestEvent, tc.buffer)}
+			w := &Worker{runningProfiles: map[int64]bool{tc.profile.ID: tc.running}}
+			s := &Scheduler{events: events, querier: q, worker: w, logger: slog.Default(), dispatched: make(map[int64]time.Time)}
+
+			for range tc.ticks {
+				s.tick(context.Background())
+			}
+
+			if queued := queuedProfiles(events.DiscoveryRequest); !slices.Equal(queued, tc.wantQueued) {
+				t.Errorf("Expected queued profiles %v, got %v", tc.wantQueued, queued)
+			}
+			if _, dispatched := s.dispatched[tc.profile.ID]; dispatched != (len(tc.wantQueued) > 0) {
+				t.Errorf("Expected dispatched %v, got %v", len(tc.wantQueued) > 0, dispatched)
+			}
+		})
+	}
+}
+
+func TestSchedulerTickAfterFullChannel(t *testing.T) {
+	q := newFakeQuerier()
+	q.profiles[1] = dbgen.DiscoveryProfile{ID: 1, IntervalSeconds: pgtype.Int4{Int32: 300, Valid: true}}
+	events := &globals.EventChannels{DiscoveryRequest: make(chan globals.DiscoveryRequestEvent, 1)}
+	events.DiscoveryRequest <- globals.DiscoveryRequestEvent{ProfileID: 9}
+	s := &Scheduler{events: events, querier: q, logger: slog.Default(), dispatched: make(map[int64]time.Time)}
+
+	s.tick(context.Background())
+	<-events.DiscoveryRequest // the worker catches up
+
+	// A deferred run is queued on the next tick instead of waiting out its interval
+	s.tick(context.Background())
+	if queued := queuedProfiles(events.DiscoveryRequest); !slices.Equal(queued, []int64{1}) {
+		t.Errorf("Expected the deferred run queued, got %v", queued)
+	}
+}
+
+func TestSchedulerPrunesDispatched(t *testing.T) {
+	q := newFakeQuerier()
+	events := &globals.EventChannels{DiscoveryRequest: make(chan globals.DiscoveryRequestEvent, 1)}
+	s := &Scheduler{events: events, querier: q, logger: slog.Default(), dispatched: map[int64]time.Time{
+		1: time.Now().Add(-time.Second), // interval passed, no longer due
+		2: time.Now().Add(time.Hour),    // still within its interval
+	}}
+
+	s.tick(context.Background())
+
+	if _, ok := s.dispatched[1]; ok {
+		t.Error("Expected the expired dispatch to be pruned")
+	}
+	if _, ok := s.dispatched[2]; !ok {
+		t.Error("Expected the dispatch within its interval to be kept")
+	}
+}
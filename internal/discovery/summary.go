@@ -0,0 +1,118 @@
+package discovery
+
+import (
+	"fmt"
+	"maps"
+	"sync"
+	"time"
+)
+
+// maxErrorSamples bounds how many handshake errors a run summary keeps
+const maxErrorSamples = 10
+
+// RunSummary is persisted with each finished discovery run (discovery_jobs.summary)
+type RunSummary struct {
+	Status       string `json:"status"`
+	TotalTargets int    `json:"total_targets"`
+	Validated    int    `json:"validated"`
+	// Failed counts targets no credential could validate
+	Failed int `json:"failed"`
+	// Cancelled counts targets the run stopped before validating
+	Cancelled  int                        `json:"cancelled"`
+	Protocols  map[string]ProtocolSummary `json:"protocols"`
+	DurationMS int64                      `json:"duration_ms"`
+	Error      string                     `json:"error,omitempty"`
+	// ErrorSamples holds the first handshake errors of the run, at most maxErrorSamples
+	ErrorSamples []string `json:"error_samples,omitempty"`
+}
+
+// ProtocolSummary counts one protocol's handshakes in a run
+type ProtocolSummary struct {
+	Attempted int `json:"attempted"`
+	Validated int `json:"validated"`
+	Failed    int `json:"failed"`
+}
+
+// runStats collects a RunSummary while targets are validated concurrently. A nil
+// *runStats records nothing.
+type runStats struct {
+	mu        sync.Mutex
+	started   time.Time
+	total     int
+	cancelled int
+	protocols map[string]ProtocolSummary
+	errors    []string
+}
+
+func newRunStats() *runStats {
+	return &runStats{started: time.Now(), protocols: make(map[string]ProtocolSummary)}
+}
+
+// setTotal records how many targets the run expanded to
+func (s *runStats) setTotal(total int) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.total = total
+	s.mu.Unlock()
+}
+
+// cancel records a target the run stopped before it could be validated
+func (s *runStats) cancel() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.cancelled++
+	s.mu.Unlock()
+}
+
+// handshake records one handshake attempt; err, or the message of a handshake that
+// failed without one, is sampled
+func (s *runStats) handshake(protocol, ip string, result *HandshakeResult, err error) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p := s.protocols[protocol]
+	p.Attempted++
+	if result != nil && result.Success {
+		p.Validated++
+		s.protocols[protocol] = p
+		return
+	}
+	p.Failed++
+	s.protocols[protocol] = p
+
+	reason := "handshake rejected"
+	switch {
+	case err != nil:
+		reason = err.Error()
+	case result != nil && result.Message != "":
+		reason = result.Message
+	}
+	if len(s.errors) < maxErrorSamples {
+		s.errors = append(s.errors, fmt.Sprintf("%s %s: %s", protocol, ip, reason))
+	}
+}
+
+// summary builds the RunSummary for a run that ended with status after validating
+// validated targets
+func (s *runStats) summary(status string, validated int, runErr string) RunSummary {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return RunSummary{
+		Status:       status,
+		TotalTargets: s.total,
+		Validated:    validated,
+		Failed:       max(s.total-validated-s.cancelled, 0),
+		Cancelled:    s.cancelled,
+		Protocols:    maps.Clone(s.protocols),
+		DurationMS:   time.Since(s.started).Milliseconds(),
+		Error:        runErr,
+		ErrorSamples: s.errors,
+	}
+}
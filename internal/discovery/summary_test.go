@@ -0,0 +1,85 @@
+package discovery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"testing"
+	"time"
+
+	auth2 "github.com/nmslite/nmslite/internal/api/auth"
+	"github.com/nmslite/nmslite/internal/globals"
+)
+
+func TestRunStatsSummary(t *testing.T) {
+	// ssh validates .1 and .2; snmp-v2c validates nothing and times out
+	saved := handshakes
+	handshakes = map[string]handshakeFunc{
+		"ssh": func(target string, port int, creds *auth2.Credentials, timeout time.Duration) (*HandshakeResult, error) {
+			if target == "192.0.2.1" || target == "192.0.2.2" {
+				return &HandshakeResult{Success: true}, nil
+			}
+			return nil, errors.New("connection refused")
+		},
+		"snmp-v2c": func(target string, port int, creds *auth2.Credentials, timeout time.Duration) (*HandshakeResult, error) {
+			return nil, errors.New("request timeout")
+		},
+	}
+	defer func() { handshakes = saved }()
+
+	w := &Worker{}
+	logger := slog.New(slog.DiscardHandler)
+	stats := newRunStats()
+	stats.setTotal(20)
+
+	validated := 0
+	for i := 1; i <= 20; i++ {
+		plugins := []*globals.PluginInfo{{Protocol: "snmp-v2c"}, {Protocol: "ssh"}}
+		if _, _, ok := w.validateTarget(context.Background(), fmt.Sprintf("192.0.2.%d", i), 0, nil, time.Second, plugins, stats, logger); ok {
+			validated++
+		}
+	}
+
+	summary := stats.summary("partial", validated, "")
+	if summary.TotalTargets != 20 || summary.Validated != 2 || summary.Failed != 18 {
+		t.Errorf("Expected 20 targets, 2 validated, 18 failed, got %d, %d, %d",
+			summary.TotalTargets, summary.Validated, summary.Failed)
+	}
+	if got := summary.Protocols["ssh"]; got != (ProtocolSummary{Attempted: 20, Validated: 2, Failed: 18}) {
+		t.Errorf("Unexpected ssh breakdown: %+v", got)
+	}
+	if got := summary.Protocols["snmp-v2c"]; got != (ProtocolSummary{Attempted: 20, Failed: 20}) {
+		t.Errorf("Unexpected snmp-v2c breakdown: %+v", got)
+	}
+	if len(summary.ErrorSamples) != maxErrorSamples {
+		t.Errorf("Expected %d error samples, got %d", maxErrorSamples, len(summary.ErrorSamples))
+	}
+	if summary.ErrorSamples[0] != "snmp-v2c 192.0.2.1: request timeout" {
+		t.Errorf("Unexpected first error sample %q", summary.ErrorSamples[0])
+	}
+	if summary.Status != "partial" {
+		t.Errorf("Expected status partial, got %q", summary.Status)
+	}
+}
+
+func TestRunStatsSamplesMessagesAndCancelled(t *testing.T) {
+	stats := newRunStats()
+	stats.setTotal(5)
+	stats.handshake("ssh", "192.0.2.1", &HandshakeResult{Message: "ssh: unable to authenticate"}, nil)
+	stats.handshake("ssh", "192.0.2.2", nil, nil)
+	stats.handshake("ssh", "192.0.2.3", &HandshakeResult{Success: true}, nil)
+	stats.cancel()
+	stats.cancel()
+
+	summary := stats.summary("cancelled", 1, "")
+	if summary.Validated != 1 || summary.Failed != 2 || summary.Cancelled != 2 {
+		t.Errorf("Expected 1 validated, 2 failed, 2 cancelled, got %d, %d, %d",
+			summary.Validated, summary.Failed, summary.Cancelled)
+	}
+	want := []string{"ssh 192.0.2.1: ssh: unable to authenticate", "ssh 192.0.2.2: handshake rejected"}
+	if !slices.Equal(summary.ErrorSamples, want) {
+		t.Errorf("Expected error samples %q, got %q", want, summary.ErrorSamples)
+	}
+}
@@ -2,6 +2,7 @@
 package discovery
 
 import (
+	"context"
 	"fmt"
 	"net/netip"
 	"strings"
@@ -58,6 +59,93 @@ func DetectTargetType(value string) TargetType {
 	return TargetTypeUnknown
 }
 
+// DefaultMaxTargets is the expansion limit used when ExpandOptions.MaxTargets is unset
+const DefaultMaxTargets = 65536
+
+// expandCheckInterval is how many addresses are expanded between context checks
+const expandCheckInterval = 1024
+
+// maxCountableHostBits is the largest block whose size still fits in an int64
+const maxCountableHostBits = 62
+
+// ExpandOptions tunes how targets are expanded
+type ExpandOptions struct {
+	// SkipIPv6SubnetRouter drops the all-zeros host of IPv6 prefixes shorter than /127.
+	// That address is the subnet-router anycast address (RFC 4291 2.6.1), usually not a device.
+	SkipIPv6SubnetRouter bool
+
+	// MaxTargets is the most addresses a target may expand to (0 uses DefaultMaxTargets)
+	MaxTargets int
+
+	// Ports is how many ports each address is probed on (0 = 1). MaxTargets then bounds
+	// address×port combinations, so fewer addresses are allowed.
+	Ports int
+}
+
+// maxTargets returns the most addresses allowed, after dividing the limit among ports
+func (o ExpandOptions) maxTargets() int {
+	limit := o.MaxTargets
+	if limit <= 0 {
+		limit = DefaultMaxTargets
+	}
+	if o.Ports > 1 {
+		limit = max(limit/o.Ports, 1)
+	}
+	return limit
+}
+
+// TargetTooLargeError reports a target that expands to more addresses than allowed.
+// Count is 0 when the target is too large to count at all.
+type TargetTooLargeError struct {
+	Target string
+	Count  int64
+	Limit  int
+}
+
+func (e *TargetTooLargeError) Error() string {
+	if e.Count == 0 {
+		return fmt.Sprintf("target %s is too large (limit %d addresses)", e.Target, e.Limit)
+	}
+	return fmt.Sprintf("target %s expands to %d addresses, more than the limit of %d", e.Target, e.Count, e.Limit)
+}
+
+// CountTargets returns how many addresses a target expands to with the given options,
+// without expanding it. It fails with *TargetTooLargeError above opts.MaxTargets.
+func CountTargets(value string, opts ExpandOptions) (int64, error) {
+	value = strings.TrimSpace(value)
+	limit := opts.maxTargets()
+
+	var count int64
+	var err error
+	switch DetectTargetType(value) {
+	case TargetTypeCIDR:
+		count, err = countIPsInCIDR(value)
+		if err != nil {
+			if prefix, perr := netip.ParsePrefix(value); perr == nil && prefix.Addr().BitLen()-prefix.Bits() > maxCountableHostBits {
+				return 0, &TargetTooLargeError{Target: value, Limit: limit}
+			}
+			return 0, err
+		}
+		if prefix := netip.MustParsePrefix(value); opts.SkipIPv6SubnetRouter && prefix.Addr().Is6() && prefix.Bits() < 127 {
+			count--
+		}
+	case TargetTypeRange:
+		count, err = countIPsInRangeUpTo(value, int64(limit)+1)
+		if err != nil {
+			return 0, err
+		}
+	case TargetTypeSingle:
+		count = 1
+	default:
+		return 0, fmt.Errorf("invalid target format: %s", value)
+	}
+
+	if count > int64(limit) {
+		return count, &TargetTooLargeError{Target: value, Count: count, Limit: limit}
+	}
+	return count, nil
+}
+
 // ExpandTarget expands a network target into a list of individual IP addresses.
 // It supports CIDR notation, IP ranges, and single IPs.
 //
@@ -65,15 +153,37 @@ func DetectTargetType(value string) TargetType {
 // For ranges, it expands all IPs between start and end (inclusive).
 // For single IPs, it returns a slice with just that IP.
 //
-// Returns an error if the target format is invalid or if the range is too large (>65536 IPs).
+// Returns an error if the target format is invalid or if it expands to more than
+// DefaultMaxTargets addresses (*TargetTooLargeError).
 func ExpandTarget(value string) ([]string, error) {
+	return ExpandTargetWithOptions(value, ExpandOptions{})
+}
+
+// ExpandTargetContext is ExpandTarget that stops early, returning ctx.Err(), once ctx is done
+func ExpandTargetContext(ctx context.Context, value string) ([]string, error) {
+	return ExpandTargetWithOptionsContext(ctx, value, ExpandOptions{})
+}
+
+// ExpandTargetWithOptions is ExpandTarget with explicit expansion options.
+// The size is checked with CountTargets before anything is allocated.
+func ExpandTargetWithOptions(value string, opts ExpandOptions) ([]string, error) {
+	return ExpandTargetWithOptionsContext(context.Background(), value, opts)
+}
+
+// ExpandTargetWithOptionsContext is ExpandTargetWithOptions that checks ctx every
+// expandCheckInterval addresses and returns ctx.Err() once it is done.
+func ExpandTargetWithOptionsContext(ctx context.Context, value string, opts ExpandOptions) ([]string, error) {
+	if _, err := CountTargets(value, opts); err != nil {
+		return nil, err
+	}
+
 	targetType := DetectTargetType(value)
 
 	switch targetType {
 	case TargetTypeCIDR:
-		return expandCIDR(value)
+		return expandCIDR(ctx, value, opts)
 	case TargetTypeRange:
-		return expandRange(value)
+		return expandRange(ctx, value, opts.maxTargets())
 	case TargetTypeSingle:
 		return []string{strings.TrimSpace(value)}, nil
 	default:
@@ -81,10 +191,45 @@ func ExpandTarget(value string) ([]string, error) {
 	}
 }
 
+// FirstTargets returns the first n addresses a target expands to with the given options,
+// without expanding the rest, along with the total CountTargets reports. Targets over
+// opts.MaxTargets fail with *TargetTooLargeError as they would for a full expansion.
+func FirstTargets(value string, opts ExpandOptions, n int) ([]string, int64, error) {
+	count, err := CountTargets(value, opts)
+	if err != nil {
+		return nil, count, err
+	}
+
+	value = strings.TrimSpace(value)
+	var addr netip.Addr
+	switch DetectTargetType(value) {
+	case TargetTypeCIDR:
+		prefix := netip.MustParsePrefix(value)
+		addr = prefix.Masked().Addr()
+		// Same skipped hosts as expandCIDR; count already excludes them
+		if (addr.Is4() && prefix.Bits() < 31) || (addr.Is6() && prefix.Bits() < 127 && opts.SkipIPv6SubnetRouter) {
+			addr = addr.Next()
+		}
+	case TargetTypeRange:
+		addr = netip.MustParseAddr(strings.TrimSpace(strings.Split(value, "-")[0]))
+	default:
+		addr = netip.MustParseAddr(value)
+	}
+
+	ips := make([]string, 0, min(int64(max(n, 0)), count))
+	for int64(len(ips)) < count && len(ips) < n {
+		ips = append(ips, addr.String())
+		addr = addr.Next()
+	}
+	return ips, count, nil
+}
+
 // expandCIDR expands a CIDR block into individual IP addresses.
-// For IPv4, it excludes the network address and broadcast address.
-// For IPv6, it includes all addresses in the range.
-func expandCIDR(cidr string) ([]string, error) {
+// For IPv4, it excludes the network address and broadcast address (except /31 and /32).
+// For IPv6 there is no broadcast; all addresses are included unless opts.SkipIPv6SubnetRouter
+// drops the subnet-router anycast address (except /127 and /128, per RFC 6164).
+// Blocks larger than opts.MaxTargets are rejected.
+func expandCIDR(ctx context.Context, cidr string, opts ExpandOptions) ([]string, error) {
 	prefix, err := netip.ParsePrefix(cidr)
 	if err != nil {
 		return nil, fmt.Errorf("invalid CIDR notation: %w", err)
@@ -97,10 +242,11 @@ func expandCIDR(cidr string) ([]string, error) {
 		maxBits = 128
 	}
 	hostBits := maxBits - bits
+	limit := opts.maxTargets()
 
 	// Prevent expansion of very large ranges
-	if hostBits > 16 {
-		return nil, fmt.Errorf("CIDR block too large (>65536 hosts): %s", cidr)
+	if hostBits > maxCountableHostBits || int64(1)<<hostBits > int64(limit)+2 {
+		return nil, &TargetTooLargeError{Target: cidr, Limit: limit}
 	}
 
 	var ips []string
@@ -111,18 +257,26 @@ func expandCIDR(cidr string) ([]string, error) {
 	skipFirst := prefix.Addr().Is4() && bits < 31
 	skipLast := prefix.Addr().Is4() && bits < 31
 
+	// For IPv6 shorter than /127, optionally skip the subnet-router anycast (all-zeros host)
+	if prefix.Addr().Is6() && bits < 127 && opts.SkipIPv6SubnetRouter {
+		skipFirst = true
+	}
+
 	if skipFirst {
 		addr = addr.Next()
 	}
 
 	// Iterate through all IPs in the range
 	for prefix.Contains(addr) {
+		if len(ips)%expandCheckInterval == 0 && ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
 		ips = append(ips, addr.String())
 		addr = addr.Next()
 
-		// Prevent infinite loops for large ranges
-		if len(ips) > 65536 {
-			return nil, fmt.Errorf("CIDR block expanded to more than 65536 hosts: %s", cidr)
+		// Prevent infinite loops for large ranges (+1 for the broadcast dropped below)
+		if len(ips) > limit+1 {
+			return nil, &TargetTooLargeError{Target: cidr, Count: int64(len(ips)), Limit: limit}
 		}
 	}
 
@@ -130,13 +284,16 @@ func expandCIDR(cidr string) ([]string, error) {
 	if skipLast && len(ips) > 0 {
 		ips = ips[:len(ips)-1]
 	}
+	if len(ips) > limit {
+		return nil, &TargetTooLargeError{Target: cidr, Count: int64(len(ips)), Limit: limit}
+	}
 
 	return ips, nil
 }
 
 // expandRange expands an IP range (e.g., "192.168.1.1-192.168.1.50") into individual IPs.
-// Both start and end IPs are included in the result.
-func expandRange(rangeStr string) ([]string, error) {
+// Both start and end IPs are included in the result; more than limit IPs is an error.
+func expandRange(ctx context.Context, rangeStr string, limit int) ([]string, error) {
 	parts := strings.Split(rangeStr, "-")
 	if len(parts) != 2 {
 		return nil, fmt.Errorf("invalid IP range format (expected 'start-end'): %s", rangeStr)
@@ -167,11 +324,14 @@ func expandRange(rangeStr string) ([]string, error) {
 
 	// Iterate from start to end (inclusive)
 	for {
+		if len(ips)%expandCheckInterval == 0 && ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
 		ips = append(ips, current.String())
 
 		// Prevent expansion of very large ranges
-		if len(ips) > 65536 {
-			return nil, fmt.Errorf("IP range too large (>65536 hosts): %s", rangeStr)
+		if len(ips) > limit {
+			return nil, &TargetTooLargeError{Target: rangeStr, Count: int64(len(ips)), Limit: limit}
 		}
 
 		// Break if we've reached the end
@@ -217,6 +377,11 @@ func countIPsInCIDR(cidr string) (int64, error) {
 	}
 	hostBits := maxBits - bits
 
+	// Keeps the shift below from overflowing
+	if hostBits > maxCountableHostBits {
+		return 0, fmt.Errorf("CIDR block too large to count (%d host bits)", hostBits)
+	}
+
 	count := int64(1) << hostBits
 
 	// For IPv4, subtract network and broadcast addresses (except /31 and /32)
@@ -229,6 +394,12 @@ func countIPsInCIDR(cidr string) (int64, error) {
 
 // countIPsInRange returns the number of IPs in a range
 func countIPsInRange(rangeStr string) (int64, error) {
+	return countIPsInRangeUpTo(rangeStr, DefaultMaxTargets+1)
+}
+
+// countIPsInRangeUpTo returns the number of IPs in a range. IPv6 ranges are walked,
+// so counting stops at stopAt; callers treat stopAt as "at least this many".
+func countIPsInRangeUpTo(rangeStr string, stopAt int64) (int64, error) {
 	parts := strings.Split(rangeStr, "-")
 	if len(parts) != 2 {
 		return 0, fmt.Errorf("invalid IP range format")
@@ -264,12 +435,9 @@ func countIPsInRange(rangeStr string) (int64, error) {
 	// For IPv6, we need to iterate (less efficient but safer)
 	count := int64(1)
 	current := startIP
-	for current.Compare(endIP) < 0 {
+	for current.Compare(endIP) < 0 && count < stopAt {
 		current = current.Next()
 		count++
-		if count > 65536 {
-			return count, fmt.Errorf("range too large")
-		}
 	}
 
 	return count, nil
@@ -1,6 +1,9 @@
 package discovery
 
 import (
+	"context"
+	"errors"
+	"slices"
 	"testing"
 )
 
@@ -344,3 +347,208 @@ func BenchmarkDetectTargetType(b *testing.B) {
 		}
 	}
 }
+
+func TestExpandCIDR_IPv6Options(t *testing.T) {
+	skip := ExpandOptions{SkipIPv6SubnetRouter: true}
+
+	tests := []struct {
+		name          string
+		value         string
+		opts          ExpandOptions
+		expectedCount int
+		expectedFirst string
+		expectError   bool
+	}{
+		{"/126 includes subnet-router by default", "2001:db8::/126", ExpandOptions{}, 4, "2001:db8::", false},
+		{"/126 skips subnet-router", "2001:db8::/126", skip, 3, "2001:db8::1", false},
+		{"/127 point-to-point keeps both", "2001:db8::/127", skip, 2, "2001:db8::", false},
+		{"/128 single host kept", "2001:db8::5/128", skip, 1, "2001:db8::5", false},
+		{"/112 at the limit", "2001:db8::/112", ExpandOptions{}, 65536, "2001:db8::", false},
+		{"/112 at the limit skipping subnet-router", "2001:db8::/112", skip, 65535, "2001:db8::1", false},
+		{"/111 too large", "2001:db8::/111", ExpandOptions{}, 0, "", true},
+		{"/64 too large", "2001:db8::/64", skip, 0, "", true},
+		{"IPv4 unaffected by IPv6 option", "192.168.1.0/30", skip, 2, "192.168.1.1", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := ExpandTargetWithOptions(tt.value, tt.opts)
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("ExpandTargetWithOptions(%q) expected error but got none", tt.value)
+				}
+				if err := ValidateTarget(tt.value); err == nil {
+					t.Errorf("ValidateTarget(%q) should reject the same block", tt.value)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ExpandTargetWithOptions(%q) error = %v", tt.value, err)
+			}
+			if len(result) != tt.expectedCount {
+				t.Errorf("ExpandTargetWithOptions(%q) returned %d IPs, want %d", tt.value, len(result), tt.expectedCount)
+			}
+			if len(result) > 0 && result[0] != tt.expectedFirst {
+				t.Errorf("ExpandTargetWithOptions(%q)[0] = %q, want %q", tt.value, result[0], tt.expectedFirst)
+			}
+		})
+	}
+}
+
+func TestCountIPsInCIDR_IPv6(t *testing.T) {
+	if count, err := countIPsInCIDR("2001:db8::/112"); err != nil || count != 65536 {
+		t.Errorf("countIPsInCIDR(/112) = %d, %v; want 65536", count, err)
+	}
+	// Must error rather than overflow the shift
+	if _, err := countIPsInCIDR("2001:db8::/32"); err == nil {
+		t.Error("countIPsInCIDR(/32) expected error for oversized IPv6 block")
+	}
+}
+
+func TestCountTargets_Limit(t *testing.T) {
+	tests := []struct {
+		name      string
+		value     string
+		opts      ExpandOptions
+		wantCount int64
+		tooLarge  bool
+	}{
+		{"Default limit /16", "10.0.0.0/16", ExpandOptions{}, 65534, false},
+		{"Default limit /15", "10.0.0.0/15", ExpandOptions{}, 131070, true},
+		{"Custom limit allows /15", "10.0.0.0/15", ExpandOptions{MaxTargets: 1 << 17}, 131070, false},
+		{"Custom limit rejects /24", "10.0.0.0/24", ExpandOptions{MaxTargets: 100}, 254, true},
+		{"IPv4 range over limit", "10.0.0.1-10.0.0.200", ExpandOptions{MaxTargets: 100}, 200, true},
+		{"IPv6 range stops counting past limit", "2001:db8::1-2001:db8::ffff", ExpandOptions{MaxTargets: 100}, 101, true},
+		{"IPv6 skip router fits exact limit", "2001:db8::/120", ExpandOptions{MaxTargets: 255, SkipIPv6SubnetRouter: true}, 255, false},
+		{"Uncountable IPv6 block", "2001:db8::/32", ExpandOptions{}, 0, true},
+		{"Single IP", "10.0.0.1", ExpandOptions{MaxTargets: 1}, 1, false},
+		{"Two ports fit /24 in 512 probes", "10.0.0.0/24", ExpandOptions{MaxTargets: 512, Ports: 2}, 254, false},
+		{"Three ports exceed 512 probes", "10.0.0.0/24", ExpandOptions{MaxTargets: 512, Ports: 3}, 254, true},
+		{"Ports split the default limit", "10.0.0.0/16", ExpandOptions{Ports: 2}, 65534, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			count, err := CountTargets(tt.value, tt.opts)
+			var tooLarge *TargetTooLargeError
+			if got := errors.As(err, &tooLarge); got != tt.tooLarge {
+				t.Fatalf("CountTargets(%q) error = %v, want too large = %v", tt.value, err, tt.tooLarge)
+			}
+			if !tt.tooLarge && err != nil {
+				t.Fatalf("CountTargets(%q) unexpected error: %v", tt.value, err)
+			}
+			if count != tt.wantCount {
+				t.Errorf("CountTargets(%q) = %d, want %d", tt.value, count, tt.wantCount)
+			}
+			if tt.tooLarge && tooLarge.Count != tt.wantCount {
+				t.Errorf("TargetTooLargeError.Count = %d, want %d", tooLarge.Count, tt.wantCount)
+			}
+		})
+	}
+}
+
+func TestExpandTargetWithOptions_MaxTargets(t *testing.T) {
+	ips, err := ExpandTargetWithOptions("10.0.0.0/15", ExpandOptions{MaxTargets: 1 << 17})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(ips) != 131070 {
+		t.Errorf("expected 131070 hosts, got %d", len(ips))
+	}
+
+	if _, err := ExpandTargetWithOptions("10.0.0.1-10.0.0.20", ExpandOptions{MaxTargets: 10}); err == nil {
+		t.Error("expected range over the limit to be rejected")
+	}
+}
+
+// cancelAfterCtx reports cancellation once Err has been called more than checks times,
+// so tests can cancel at a known point mid-expansion
+type cancelAfterCtx struct {
+	context.Context
+	checks int
+}
+
+func (c *cancelAfterCtx) Err() error {
+	if c.checks <= 0 {
+		return context.Canceled
+	}
+	c.checks--
+	return nil
+}
+
+func TestExpandTargetContext_Cancelled(t *testing.T) {
+	tests := []struct {
+		name   string
+		target string
+	}{
+		{"cidr", "10.0.0.0/16"},
+		{"range", "10.0.0.1-10.0.255.254"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := &cancelAfterCtx{Context: context.Background(), checks: 3}
+			ips, err := ExpandTargetContext(ctx, tt.target)
+			if !errors.Is(err, context.Canceled) {
+				t.Fatalf("expected context.Canceled, got %v (%d ips)", err, len(ips))
+			}
+			if ctx.checks != 0 {
+				t.Errorf("expected expansion to stop at the first failed check, %d checks left", ctx.checks)
+			}
+		})
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := ExpandTargetContext(ctx, "10.0.0.0/16"); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled for an already cancelled context, got %v", err)
+	}
+
+	ips, err := ExpandTargetContext(context.Background(), "10.0.0.0/16")
+	if err != nil || len(ips) != 65534 {
+		t.Errorf("expected 65534 hosts without cancellation, got %d (err %v)", len(ips), err)
+	}
+}
+
+func TestFirstTargets(t *testing.T) {
+	tests := []struct {
+		name      string
+		value     string
+		opts      ExpandOptions
+		n         int
+		wantIPs   []string
+		wantCount int64
+	}{
+		{"cidr skips network address", "10.0.0.0/24", ExpandOptions{}, 3, []string{"10.0.0.1", "10.0.0.2", "10.0.0.3"}, 254},
+		{"cidr shorter than n", "10.0.0.0/30", ExpandOptions{}, 10, []string{"10.0.0.1", "10.0.0.2"}, 2},
+		{"point-to-point cidr", "10.0.0.0/31", ExpandOptions{}, 10, []string{"10.0.0.0", "10.0.0.1"}, 2},
+		{"ipv6 subnet router skipped", "2001:db8::/64", ExpandOptions{SkipIPv6SubnetRouter: true, MaxTargets: -1}, 2, nil, 0},
+		{"range", " 10.0.0.5-10.0.0.9 ", ExpandOptions{}, 2, []string{"10.0.0.5", "10.0.0.6"}, 5},
+		{"single", "10.0.0.1", ExpandOptions{}, 5, []string{"10.0.0.1"}, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ips, count, err := FirstTargets(tt.value, tt.opts, tt.n)
+			if tt.wantIPs == nil {
+				var tooLarge *TargetTooLargeError
+				if !errors.As(err, &tooLarge) {
+					t.Fatalf("expected TargetTooLargeError, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if count != tt.wantCount || !slices.Equal(ips, tt.wantIPs) {
+				t.Errorf("FirstTargets(%q, %d) = %v (count %d), want %v (count %d)", tt.value, tt.n, ips, count, tt.wantIPs, tt.wantCount)
+			}
+		})
+	}
+
+	// A prefix the expansion limit allows is previewed without expanding all of it
+	ips, count, err := FirstTargets("10.0.0.0/8", ExpandOptions{MaxTargets: 1 << 24}, 2)
+	if err != nil || count != 1<<24-2 || !slices.Equal(ips, []string{"10.0.0.1", "10.0.0.2"}) {
+		t.Errorf("expected the first 2 of %d hosts, got %v (count %d, err %v)", 1<<24-2, ips, count, err)
+	}
+}
@@ -3,11 +3,12 @@ package discovery
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"log/slog"
-	"net/netip"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"strconv"
@@ -31,11 +32,16 @@ type Worker struct {
 
 	// discoverySem limits concurrent validation goroutines
 	discoverySem chan struct{}
+	// protocolSems further limits concurrent handshakes for protocols with a configured cap
+	protocolSems map[string]chan struct{}
 
 	// runningMu protects runningProfiles
 	runningMu sync.RWMutex
 	// runningProfiles tracks which profiles are currently running
 	runningProfiles map[int64]bool
+
+	// active is set while Run is consuming discovery requests
+	active atomic.Bool
 }
 
 // NewWorker creates a new discovery worker instance with plugin support.
@@ -61,16 +67,46 @@ func NewWorker(
 		authService:     authService,
 		logger:          logger,
 		discoverySem:    make(chan struct{}, maxWorkers),
+		protocolSems:    newProtocolSems(globals.GetConfig().Discovery.ProtocolHandshakeLimits),
 		runningProfiles: make(map[int64]bool),
 	}
 }
 
+// newProtocolSems builds a semaphore for each protocol with a positive handshake limit
+func newProtocolSems(limits map[string]int) map[string]chan struct{} {
+	sems := make(map[string]chan struct{}, len(limits))
+	for protocol, limit := range limits {
+		if limit > 0 {
+			sems[protocol] = make(chan struct{}, limit)
+		}
+	}
+	return sems
+}
+
 // Run starts the discovery worker and begins processing discovery events.
 func (w *Worker) Run(ctx context.Context) error {
+	w.active.Store(true)
+	defer w.active.Store(false)
+
 	w.logger.InfoContext(ctx, "Discovery worker starting (with plugin support, channels-based)",
 		slog.String("worker", "discovery"),
 	)
 
+	// This instance's jobs queued or running before this process started were lost with it;
+	// other instances sharing the database still own theirs
+	if failed, err := w.querier.FailUnfinishedDiscoveryJobs(ctx, dbgen.FailUnfinishedDiscoveryJobsParams{
+		InstanceID:    instanceID(),
+		UpdatedBefore: time.Now(),
+	}); err != nil {
+		w.logger.WarnContext(ctx, "Failed to close out interrupted discovery jobs",
+			slog.String("error", err.Error()),
+		)
+	} else if failed > 0 {
+		w.logger.InfoContext(ctx, "Marked interrupted discovery jobs as failed",
+			slog.Int64("count", failed),
+		)
+	}
+
 	for {
 		select {
 		case <-ctx.Done():
@@ -91,6 +127,31 @@ func (w *Worker) Run(ctx context.Context) error {
 	}
 }
 
+// IsRunning reports whether a discovery run for the profile is in progress.
+func (w *Worker) IsRunning(profileID int64) bool {
+	w.runningMu.RLock()
+	defer w.runningMu.RUnlock()
+	return w.runningProfiles[profileID]
+}
+
+// Active reports whether the worker is consuming discovery requests.
+func (w *Worker) Active() bool {
+	return w.active.Load()
+}
+
+// RunningProfiles returns how many discovery runs are in progress.
+func (w *Worker) RunningProfiles() int {
+	w.runningMu.RLock()
+	defer w.runningMu.RUnlock()
+	return len(w.runningProfiles)
+}
+
+// instanceID is the server instance recorded on the jobs this worker runs
+func instanceID() pgtype.Text {
+	instance := globals.GetConfig().Server.Instance()
+	return pgtype.Text{String: instance, Valid: instance != ""}
+}
+
 // handleDiscoveryStartedEvent processes a single discovery start event.
 func (w *Worker) handleDiscoveryStartedEvent(ctx context.Context, event globals.DiscoveryRequestEvent) {
 	logger := w.logger.With(
@@ -98,6 +159,23 @@ func (w *Worker) handleDiscoveryStartedEvent(ctx context.Context, event globals.
 		slog.String("started_at", event.StartedAt.Format(time.RFC3339)),
 	)
 
+	// Scheduled runs arrive without a job; API-triggered runs already have one
+	if event.JobID == 0 {
+		job, err := w.querier.CreateDiscoveryJob(ctx, dbgen.CreateDiscoveryJobParams{
+			ProfileID:  event.ProfileID,
+			Status:     "queued",
+			InstanceID: instanceID(),
+		})
+		if err != nil {
+			logger.WarnContext(ctx, "Failed to create discovery job, run will not be tracked",
+				slog.String("error", err.Error()),
+			)
+		} else {
+			event.JobID = job.ID
+		}
+	}
+	logger = logger.With(slog.String("job_id", strconv.FormatInt(event.JobID, 10)))
+
 	// Check if profile is already running
 	w.runningMu.RLock()
 	isRunning := w.runningProfiles[event.ProfileID]
@@ -105,7 +183,7 @@ func (w *Worker) handleDiscoveryStartedEvent(ctx context.Context, event globals.
 
 	if isRunning {
 		logger.WarnContext(ctx, "Discovery already running for this profile, skipping duplicate")
-		w.publishCompletedEvent(ctx, event, "failed", 0, "duplicate discovery run detected")
+		w.publishCompletedEvent(ctx, event, "failed", 0, "duplicate discovery run detected", resultsIncomplete)
 		return
 	}
 
@@ -116,12 +194,12 @@ func (w *Worker) handleDiscoveryStartedEvent(ctx context.Context, event globals.
 			logger.ErrorContext(ctx, "Discovery profile not found",
 				slog.String("error", err.Error()),
 			)
-			w.publishCompletedEvent(ctx, event, "failed", 0, "discovery profile not found")
+			w.publishCompletedEvent(ctx, event, "failed", 0, "discovery profile not found", resultsIncomplete)
 		} else {
 			logger.ErrorContext(ctx, "Failed to fetch discovery profile",
 				slog.String("error", err.Error()),
 			)
-			w.publishCompletedEvent(ctx, event, "failed", 0, fmt.Sprintf("database error: %v", err))
+			w.publishCompletedEvent(ctx, event, "failed", 0, fmt.Sprintf("database error: %v", err), resultsIncomplete)
 		}
 		return
 	}
@@ -155,7 +233,16 @@ func (w *Worker) handleDiscoveryStartedEvent(ctx context.Context, event globals.
 	}
 
 	// Execute discovery
-	monitorCount, totalIPs, jobErr := w.executeDiscovery(ctx, profile, logger)
+	stats := newRunStats()
+	devices := &deviceRecorder{}
+	monitorCount, totalIPs, jobErr := w.executeDiscovery(ctx, profile, event.JobID, stats, devices, logger)
+
+	// The run's device list can be diffed against other runs only once every target was
+	// scanned and every validated device is recorded
+	resultsStatus := resultsIncomplete
+	if devices.wait(ctx) && jobErr == nil && ctx.Err() == nil {
+		resultsStatus = resultsComplete
+	}
 
 	// Determine final status based on discovery results:
 	// - "success": all IPs discovered (monitorCount == totalIPs)
@@ -193,7 +280,14 @@ func (w *Worker) handleDiscoveryStartedEvent(ctx context.Context, event globals.
 	}
 
 	// Publish completion event
-	w.publishCompletedEvent(ctx, event, status, monitorCount, "")
+	errMsg := ""
+	if jobErr != nil {
+		errMsg = jobErr.Error()
+	} else if monitorCount == 0 {
+		errMsg = "no devices found"
+	}
+	w.publishCompletedEvent(ctx, event, status, monitorCount, errMsg, resultsStatus)
+	w.recordRunSummary(ctx, event.JobID, profile.ID, stats.summary(status, monitorCount, errMsg), logger)
 
 	logger.InfoContext(ctx, "Discovery run completed",
 		slog.String("status", status),
@@ -206,11 +300,12 @@ func (w *Worker) handleDiscoveryStartedEvent(ctx context.Context, event globals.
 func (w *Worker) executeDiscovery(
 	ctx context.Context,
 	profile dbgen.DiscoveryProfile,
+	jobID int64,
+	stats *runStats,
+	devices *deviceRecorder,
 	logger *slog.Logger,
 ) (int, int, error) {
-	// Get port and credential from profile
-	port := int(profile.Port)
-	credentialID := profile.CredentialProfileID
+	ports := ProfilePorts(profile)
 
 	// Decrypt target value
 	decryptedTarget := profile.TargetValue
@@ -224,24 +319,37 @@ func (w *Worker) executeDiscovery(
 	}
 
 	// Expand target into individual IPs (handles CIDR, ranges, and single IPs)
-	targetIPs, err := ExpandTarget(decryptedTarget)
+	targetIPs, err := ExpandTargetWithOptionsContext(ctx, decryptedTarget, ExpandOptions{
+		SkipIPv6SubnetRouter: globals.GetConfig().Discovery.SkipIPv6SubnetRouter,
+		MaxTargets:           globals.GetConfig().Discovery.MaxTargets,
+		Ports:                len(ports),
+	})
 	if err != nil {
 		return 0, 0, fmt.Errorf("failed to expand target value: %w", err)
 	}
 
-	// Get credential profile to determine protocol
-	credProfile, err := w.querier.GetCredentialProfile(ctx, credentialID)
+	// Resolve the credential profiles to try, in order
+	candidates, err := w.loadCredentialCandidates(ctx, profile, logger)
 	if err != nil {
-		return 0, 0, fmt.Errorf("failed to fetch credential profile: %w", err)
+		return 0, 0, err
 	}
 
+	// With auto-detection, also try each credential over the other protocols it fits,
+	// bounding the handshakes per IP so the full matrix is never walked
+	budget := attemptBudget(-1)
+	if cfg := globals.GetConfig().Discovery; cfg.AutoDetectProtocols {
+		candidates = w.detectCandidates(ctx, candidates, logger)
+		budget = attemptBudget(cfg.AutoDetectAttempts())
+	}
+
+	stats.setTotal(len(targetIPs))
+
 	logger.InfoContext(ctx, "Target expanded to IPs",
 		slog.String("target", decryptedTarget),
 		slog.Int("ip_count", len(targetIPs)),
 		slog.String("target_type", string(DetectTargetType(decryptedTarget))),
-		slog.Int("port", port),
-		slog.String("credential_id", strconv.FormatInt(credentialID, 10)),
-		slog.String("protocol", credProfile.Protocol),
+		slog.Any("ports", ports),
+		slog.Int("credential_count", len(candidates)),
 	)
 
 	// Get handshake timeout, default to 5 seconds if not set
@@ -250,40 +358,22 @@ func (w *Worker) executeDiscovery(
 		handshakeTimeout = time.Duration(profile.PortScanTimeoutMs.Int32) * time.Millisecond
 	}
 
-	// Resolve plugin/protocol handler
-	// Attempt to find registered plugin for the protocol
-	var plugin *globals.PluginInfo
-	registeredPlugin, ok := w.pluginManager.Get(credProfile.Protocol)
-	if ok {
-		plugin = registeredPlugin
-	} else {
-		// If not found in registry (e.g. internal ssh/snmp), create a placeholder
-		// This ensures we can still pass a valid PluginInfo to the event handler
-		plugin = &globals.PluginInfo{
-			Name:     credProfile.Protocol, // Use protocol as name
-			Protocol: credProfile.Protocol,
-		}
-		logger.DebugContext(ctx, "Using internal/placeholder plugin for protocol",
-			slog.String("protocol", credProfile.Protocol),
-		)
-	}
-
-	// Get decrypted credentials
-	creds, err := w.credentials.GetDecrypted(ctx, credentialID)
-	if err != nil {
-		return 0, 0, fmt.Errorf("failed to decrypt credentials: %w", err)
-	}
-
 	// Validation result struct for collecting parallel results
 	type validationResult struct {
-		ip       string
-		plugin   *globals.PluginInfo
-		hostname string
-		valid    bool
+		ip         string
+		plugin     *globals.PluginInfo
+		credential dbgen.CredentialProfile
+		hostname   string
+		port       int
+		valid      bool
 	}
 
 	resultsChan := make(chan validationResult, len(targetIPs))
 	var wg sync.WaitGroup
+	w.updateJobProgress(ctx, jobID, globals.DiscoveryProgressEvent{Total: len(targetIPs)}, logger)
+	progress := newProgressReporter(w.events, profile.ID, jobID, len(targetIPs), func(event globals.DiscoveryProgressEvent) {
+		w.updateJobProgress(ctx, jobID, event, logger)
+	})
 
 	// Parallel IP validation with semaphore-based concurrency control
 	for _, targetIP := range targetIPs {
@@ -297,18 +387,46 @@ func (w *Worker) executeDiscovery(
 			case w.discoverySem <- struct{}{}:
 				defer func() { <-w.discoverySem }()
 			case <-ctx.Done():
+				stats.cancel()
 				resultsChan <- validationResult{ip: targetIP, valid: false}
 				return
 			}
 
-			// Perform validation
-			validatedPlugin, hostname, valid := w.validateTarget(ctx, targetIP, port, creds, handshakeTimeout, []*globals.PluginInfo{plugin}, logger)
-			resultsChan <- validationResult{
-				ip:       targetIP,
-				plugin:   validatedPlugin,
-				hostname: hostname,
-				valid:    valid,
+			// Perform validation on each port in order, trying each credential until one
+			// succeeds; the first port that validates is the device's port
+			result := validationResult{ip: targetIP}
+			attempts := budget
+			for _, port := range ports {
+				candidate, validatedPlugin, hostname, valid := firstValidCredential(ctx, candidates,
+					func(c credentialCandidate) (*globals.PluginInfo, string, bool) {
+						if !attempts.take() {
+							return nil, "", false
+						}
+						return w.validateTarget(ctx, targetIP, port, c.creds, handshakeTimeout, []*globals.PluginInfo{c.plugin}, stats, logger)
+					})
+				if valid {
+					result = validationResult{
+						ip:         targetIP,
+						plugin:     validatedPlugin,
+						credential: candidate.profile,
+						hostname:   hostname,
+						port:       w.targetPort(port, validatedPlugin.Protocol, candidate.creds),
+						valid:      true,
+					}
+					break
+				}
+				if attempts == 0 {
+					logger.DebugContext(ctx, "Auto-detect attempts exhausted for IP",
+						slog.String("ip", targetIP),
+					)
+					break
+				}
 			}
+			if !result.valid && ctx.Err() != nil {
+				stats.cancel()
+			}
+			progress.record(result.valid)
+			resultsChan <- result
 		}()
 	}
 
@@ -320,33 +438,41 @@ func (w *Worker) executeDiscovery(
 	validatedCount := 0
 	for result := range resultsChan {
 		if result.valid {
+			devicePort := result.port
 			logger.InfoContext(ctx, "Protocol handshake succeeded",
 				slog.String("ip", result.ip),
-				slog.Int("port", port),
+				slog.Int("port", devicePort),
 				slog.String("protocol", result.plugin.Protocol),
-				slog.String("credential_id", strconv.FormatInt(credentialID, 10)),
+				slog.String("credential_id", strconv.FormatInt(result.credential.ID, 10)),
 			)
 
 			// Publish DeviceValidatedEvent - handler creates DB entries
-			select {
-			case w.events.DeviceValidated <- globals.DeviceValidatedEvent{
+			event := globals.DeviceValidatedEvent{
 				DiscoveryProfile:  profile,
-				CredentialProfile: credProfile,
+				CredentialProfile: result.credential,
 				Plugin:            result.plugin,
+				Protocol:          result.plugin.Protocol,
+				JobID:             jobID,
 				IP:                result.ip,
-				Port:              port,
+				Port:              devicePort,
 				Hostname:          result.hostname,
-			}:
+				Recorded:          devices.add(),
+			}
+			select {
+			case w.events.DeviceValidated <- event:
 				validatedCount++
 			case <-ctx.Done():
+				devices.skip(event)
 				return validatedCount, len(targetIPs), ctx.Err()
 			default:
 				logger.WarnContext(ctx, "DeviceValidated channel full, event dropped")
+				w.events.RecordDropped(globals.ChannelDeviceValidated, globals.DropChannelFull, event)
+				devices.skip(event)
 			}
 		} else {
 			logger.DebugContext(ctx, "No valid handshake for IP",
 				slog.String("ip", result.ip),
-				slog.Int("port", port),
+				slog.Any("ports", ports),
 			)
 		}
 	}
@@ -354,7 +480,242 @@ func (w *Worker) executeDiscovery(
 	return validatedCount, len(targetIPs), nil
 }
 
-// validateTarget attempts to validate an IP against a list of plugins
+// Results statuses of a finished run (discovery_jobs.results_status)
+const (
+	resultsComplete   = "complete"
+	resultsIncomplete = "incomplete"
+)
+
+// deviceRecorder tracks a run's DeviceValidatedEvents until the provision handler has
+// recorded each device, so the run is only completed once its device list is final. A nil
+// *deviceRecorder tracks nothing.
+type deviceRecorder struct {
+	wg     sync.WaitGroup
+	failed atomic.Bool
+}
+
+// add tracks one more device and returns the callback for its event's Recorded
+func (r *deviceRecorder) add() func(error) {
+	if r == nil {
+		return nil
+	}
+	r.wg.Add(1)
+	var once sync.Once
+	return func(err error) {
+		once.Do(func() {
+			if err != nil {
+				r.failed.Store(true)
+			}
+			r.wg.Done()
+		})
+	}
+}
+
+// skip settles the device of an event that was never delivered
+func (r *deviceRecorder) skip(event globals.DeviceValidatedEvent) {
+	if r != nil && event.Recorded != nil {
+		event.Recorded(errors.New("device event not delivered"))
+	}
+}
+
+// wait blocks until every tracked device is settled or ctx ends, and reports whether all
+// of them were recorded
+func (r *deviceRecorder) wait(ctx context.Context) bool {
+	if r == nil {
+		return true
+	}
+	done := make(chan struct{})
+	go func() {
+		r.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return !r.failed.Load()
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// credentialCandidate is one credential profile a discovery run tries against each IP
+type credentialCandidate struct {
+	profile dbgen.CredentialProfile
+	creds   *auth2.Credentials
+	plugin  *globals.PluginInfo
+}
+
+// loadCredentialCandidates resolves a discovery profile's credential profiles in the order
+// they are tried, capped at discovery.max_credentials_per_profile. Profiles that are
+// missing or cannot be decrypted are skipped; it fails only if none are usable.
+func (w *Worker) loadCredentialCandidates(ctx context.Context, profile dbgen.DiscoveryProfile, logger *slog.Logger) ([]credentialCandidate, error) {
+	ids := profile.CredentialProfileIds
+	if len(ids) == 0 {
+		ids = []int64{profile.CredentialProfileID}
+	}
+	if limit := globals.GetConfig().Discovery.CredentialLimit(); len(ids) > limit {
+		logger.WarnContext(ctx, "Discovery profile lists more credential profiles than allowed, trying the first ones",
+			slog.Int("listed", len(ids)),
+			slog.Int("limit", limit),
+		)
+		ids = ids[:limit]
+	}
+
+	var (
+		candidates []credentialCandidate
+		lastErr    error
+	)
+	for _, id := range ids {
+		credProfile, err := w.querier.GetCredentialProfile(ctx, id)
+		if err != nil {
+			lastErr = fmt.Errorf("failed to fetch credential profile %d: %w", id, err)
+			logger.WarnContext(ctx, "Skipping credential profile",
+				slog.String("credential_id", strconv.FormatInt(id, 10)),
+				slog.String("error", err.Error()),
+			)
+			continue
+		}
+		creds, err := w.credentials.GetDecrypted(ctx, id)
+		if err != nil {
+			lastErr = fmt.Errorf("failed to decrypt credentials %d: %w", id, err)
+			logger.WarnContext(ctx, "Skipping credential profile",
+				slog.String("credential_id", strconv.FormatInt(id, 10)),
+				slog.String("error", err.Error()),
+			)
+			continue
+		}
+
+		plugin := w.resolvePlugin(ctx, credProfile.Protocol, logger)
+		candidates = append(candidates, credentialCandidate{profile: credProfile, creds: creds, plugin: plugin})
+	}
+
+	if len(candidates) == 0 {
+		return nil, lastErr
+	}
+	return candidates, nil
+}
+
+// resolvePlugin returns the registered plugin for a protocol
+func (w *Worker) resolvePlugin(ctx context.Context, protocol string, logger *slog.Logger) *globals.PluginInfo {
+	plugin, ok := w.pluginManager.Get(protocol)
+	if !ok {
+		// If not found in registry (e.g. internal ssh/snmp), create a placeholder
+		// This ensures we can still pass a valid PluginInfo to the event handler
+		plugin = &globals.PluginInfo{
+			Name:     protocol, // Use protocol as name
+			Protocol: protocol,
+		}
+		logger.DebugContext(ctx, "Using internal/placeholder plugin for protocol",
+			slog.String("protocol", protocol),
+		)
+	}
+	return plugin
+}
+
+// autoDetectProtocols is the order auto-detection tries a credential's other protocols in
+var autoDetectProtocols = []string{"ssh", "windows-winrm", "snmp-v2c", "snmp-v1", "snmp-v3"}
+
+// credentialFits reports whether creds carry the fields a protocol's handshake needs
+func credentialFits(protocol string, creds *auth2.Credentials) bool {
+	switch protocol {
+	case "ssh":
+		return creds.Username != "" && (creds.Password != "" || creds.PrivateKey != "")
+	case "windows-winrm":
+		return creds.Username != "" && creds.Password != ""
+	case "snmp-v1", "snmp-v2c":
+		return creds.Community != ""
+	case "snmp-v3":
+		return creds.SecurityName != ""
+	}
+	return false
+}
+
+// detectCandidates expands candidates for protocol auto-detection: every credential over
+// its own protocol first, in order, then over each other protocol its fields fit
+func (w *Worker) detectCandidates(ctx context.Context, candidates []credentialCandidate, logger *slog.Logger) []credentialCandidate {
+	expanded := append([]credentialCandidate(nil), candidates...)
+	for _, candidate := range candidates {
+		for _, protocol := range autoDetectProtocols {
+			if protocol == candidate.profile.Protocol || !credentialFits(protocol, candidate.creds) {
+				continue
+			}
+			expanded = append(expanded, credentialCandidate{
+				profile: candidate.profile,
+				creds:   candidate.creds,
+				plugin:  w.resolvePlugin(ctx, protocol, logger),
+			})
+		}
+	}
+	return expanded
+}
+
+// attemptBudget counts the handshakes left for one IP; a negative budget is unbounded
+type attemptBudget int
+
+// take spends one attempt, reporting false once the budget is exhausted
+func (b *attemptBudget) take() bool {
+	if *b == 0 {
+		return false
+	}
+	if *b > 0 {
+		*b--
+	}
+	return true
+}
+
+// firstValidCredential tries candidates in order and returns the first one validate accepts,
+// without trying the rest. It stops early if ctx is cancelled.
+func firstValidCredential(
+	ctx context.Context,
+	candidates []credentialCandidate,
+	validate func(credentialCandidate) (*globals.PluginInfo, string, bool),
+) (credentialCandidate, *globals.PluginInfo, string, bool) {
+	for _, candidate := range candidates {
+		if ctx.Err() != nil {
+			break
+		}
+		if plugin, hostname, ok := validate(candidate); ok {
+			return candidate, plugin, hostname, true
+		}
+	}
+	return credentialCandidate{}, nil, "", false
+}
+
+// ProfilePorts returns the ports a profile probes, in order: its port list, or its single
+// port (0 = each protocol's default) for profiles without one
+func ProfilePorts(profile dbgen.DiscoveryProfile) []int {
+	if len(profile.Ports) == 0 {
+		return []int{int(profile.Port)}
+	}
+	ports := make([]int, len(profile.Ports))
+	for i, port := range profile.Ports {
+		ports[i] = int(port)
+	}
+	return ports
+}
+
+// targetPort returns the profile's port, or the protocol's default port for the
+// credentials' transport when it is unset (0)
+func (w *Worker) targetPort(port int, protocol string, creds *auth2.Credentials) int {
+	if port > 0 {
+		return port
+	}
+	return w.pluginManager.DefaultPort(protocol, creds != nil && creds.UseHTTPS)
+}
+
+// handshakeFunc attempts a protocol handshake against a target
+type handshakeFunc func(target string, port int, creds *auth2.Credentials, timeout time.Duration) (*HandshakeResult, error)
+
+// handshakes maps protocol IDs to their handshake
+var handshakes = map[string]handshakeFunc{
+	"ssh":           ValidateSSH,
+	"windows-winrm": ValidateWinRM,
+	"snmp-v1":       ValidateSNMPv1,
+	"snmp-v2c":      ValidateSNMPv2c,
+	"snmp-v3":       ValidateSNMPv3,
+}
+
+// validateTarget attempts to validate an IP against a list of plugins, recording each
+// handshake in stats (which may be nil)
 func (w *Worker) validateTarget(
 	ctx context.Context,
 	ip string,
@@ -362,29 +723,35 @@ func (w *Worker) validateTarget(
 	creds *auth2.Credentials,
 	timeout time.Duration,
 	plugins []*globals.PluginInfo,
+	stats *runStats,
 	logger *slog.Logger,
 ) (*globals.PluginInfo, string, bool) {
 
 	for _, plugin := range plugins {
-		var result *HandshakeResult
-
-		switch plugin.Protocol {
-		case "ssh":
-			result, _ = ValidateSSH(ip, port, creds, timeout)
-		case "windows-winrm":
-			result, _ = ValidateWinRM(ip, port, creds, timeout)
-		case "snmp-v2c":
-			result, _ = ValidateSNMPv2c(ip, port, creds, timeout)
-		case "snmp-v3":
-			result, _ = ValidateSNMPv3(ip, port, creds, timeout)
-		default:
+		handshake, ok := handshakes[plugin.Protocol]
+		if !ok {
 			logger.WarnContext(ctx, "Unknown protocol, skipping handshake",
 				slog.String("protocol", plugin.Protocol),
 			)
 			continue
 		}
 
-		if result != nil && result.Success {
+		// Wait for a slot under the protocol's own cap, if it has one
+		if sem, ok := w.protocolSems[plugin.Protocol]; ok {
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				return nil, "", false
+			}
+		}
+		result, err := handshake(ip, w.targetPort(port, plugin.Protocol, creds), creds, timeout)
+		if sem, ok := w.protocolSems[plugin.Protocol]; ok {
+			<-sem
+		}
+
+		stats.handshake(plugin.Protocol, ip, result, err)
+		success := result != nil && result.Success
+		if success {
 			return plugin, result.Hostname, true
 		}
 	}
@@ -392,18 +759,55 @@ func (w *Worker) validateTarget(
 	return nil, "", false
 }
 
-// isPortOpen checks if a TCP port is open on the target
+// updateJobProgress records a running job's progress; failures only cost tracking, not the run.
+func (w *Worker) updateJobProgress(ctx context.Context, jobID int64, progress globals.DiscoveryProgressEvent, logger *slog.Logger) {
+	if jobID == 0 {
+		return
+	}
+	err := w.querier.UpdateDiscoveryJobProgress(ctx, dbgen.UpdateDiscoveryJobProgressParams{
+		ID:               jobID,
+		Status:           "running",
+		TotalTargets:     int32(progress.Total),
+		ProcessedTargets: int32(progress.Processed),
+		DevicesFound:     int32(progress.Validated),
+	})
+	if err != nil {
+		logger.WarnContext(ctx, "Failed to update discovery job progress",
+			slog.String("error", err.Error()),
+		)
+	}
+}
 
-// publishCompletedEvent publishes a discovery completion event to the event bus.
+// publishCompletedEvent records the job outcome and publishes a discovery completion event to the event bus.
+// resultsStatus says whether the run's device list is complete enough to diff, see deviceRecorder.
 func (w *Worker) publishCompletedEvent(
 	ctx context.Context,
 	event globals.DiscoveryRequestEvent,
 	statusStr string,
 	deviceCount int,
-	_ string, // error message (reserved for future use)
+	errMsg string,
+	resultsStatus string,
 ) {
+	if event.JobID != 0 {
+		// Detached so a shutdown mid-run still records the outcome
+		err := w.querier.CompleteDiscoveryJob(context.WithoutCancel(ctx), dbgen.CompleteDiscoveryJobParams{
+			ID:            event.JobID,
+			Status:        statusStr,
+			DevicesFound:  int32(deviceCount),
+			Error:         pgtype.Text{String: errMsg, Valid: errMsg != ""},
+			ResultsStatus: pgtype.Text{String: resultsStatus, Valid: true},
+		})
+		if err != nil {
+			w.logger.WarnContext(ctx, "Failed to record discovery job result",
+				slog.String("job_id", strconv.FormatInt(event.JobID, 10)),
+				slog.String("error", err.Error()),
+			)
+		}
+	}
+
 	completedEvent := globals.DiscoveryStatusEvent{
 		ProfileID:    event.ProfileID,
+		JobID:        event.JobID,
 		Status:       statusStr, // "success", "partial", "failed"
 		DevicesFound: deviceCount,
 		StartedAt:    event.StartedAt,
@@ -428,18 +832,59 @@ func (w *Worker) publishCompletedEvent(
 			slog.String("profile_id", strconv.FormatInt(event.ProfileID, 10)),
 			slog.String("status", statusStr),
 		)
+		w.events.RecordDropped(globals.ChannelDiscoveryStatus, globals.DropChannelFull, completedEvent)
+	}
+}
+
+// recordRunSummary stores a finished run's summary and deletes the profile's runs beyond
+// discovery.run_history_limit. It runs once per run, after the targets are validated;
+// failures only cost history, not the run.
+func (w *Worker) recordRunSummary(ctx context.Context, jobID, profileID int64, summary RunSummary, logger *slog.Logger) {
+	if jobID == 0 {
+		return
+	}
+	// Detached like the job completion, so a shutdown mid-run still records the summary
+	ctx = context.WithoutCancel(ctx)
+
+	data, err := json.Marshal(summary)
+	if err == nil {
+		err = w.querier.SetDiscoveryJobSummary(ctx, dbgen.SetDiscoveryJobSummaryParams{ID: jobID, Summary: data})
+	}
+	if err != nil {
+		logger.WarnContext(ctx, "Failed to record discovery run summary",
+			slog.String("error", err.Error()),
+		)
+	}
+
+	pruned, err := w.querier.PruneDiscoveryJobs(ctx, dbgen.PruneDiscoveryJobsParams{
+		ProfileID: profileID,
+		Keep:      int32(globals.GetConfig().Discovery.RunHistory()),
+	})
+	if err != nil {
+		logger.WarnContext(ctx, "Failed to prune discovery run history",
+			slog.String("error", err.Error()),
+		)
+	} else if pruned > 0 {
+		logger.DebugContext(ctx, "Pruned discovery run history", slog.Int64("deleted", pruned))
 	}
 }
 
 // StartDiscoveryCompletionLogger starts a goroutine that logs discovery completion events.
+// It subscribes to the event fan-out, so RunFanOut must be running for events to arrive.
 func StartDiscoveryCompletionLogger(ctx context.Context, events *globals.EventChannels, logger *slog.Logger) {
+	completions, unsubscribe := events.Subscribe(0, globals.StreamDiscoveryStatus)
 	go func() {
+		defer unsubscribe()
 		for {
 			select {
-			case event, ok := <-events.DiscoveryStatus:
+			case streamEvent, ok := <-completions:
 				if !ok {
 					return
 				}
+				event, ok := streamEvent.Data.(globals.DiscoveryStatusEvent)
+				if !ok {
+					continue
+				}
 				logger.InfoContext(ctx, "Discovery completed",
 					slog.String("profile_id", strconv.FormatInt(event.ProfileID, 10)),
 					slog.String("status", event.Status),
@@ -455,57 +900,3 @@ func StartDiscoveryCompletionLogger(ctx context.Context, events *globals.EventCh
 		}
 	}()
 }
-
-// StartProvisionHandler listens for DeviceValidatedEvent and creates DB entries.
-func StartProvisionHandler(ctx context.Context, events *globals.EventChannels, querier dbgen.Querier, logger *slog.Logger, provisioner *Provisioner) {
-	go func() {
-		for {
-			select {
-			case event, ok := <-events.DeviceValidated:
-				if !ok {
-					return
-				}
-
-				logger.InfoContext(ctx, "Device validated, creating discovered_devices entry",
-					slog.String("ip", event.IP),
-					slog.Int("port", event.Port),
-					slog.String("protocol", event.Plugin.Protocol),
-				)
-
-				// 1. Create discovered_devices entry
-				_, err := querier.CreateDiscoveredDevice(ctx, dbgen.CreateDiscoveredDeviceParams{
-					DiscoveryProfileID: pgtype.Int8{Int64: event.DiscoveryProfile.ID, Valid: true},
-					IpAddress:          netip.MustParseAddr(event.IP),
-					Port:               int32(event.Port),
-					Status:             pgtype.Text{String: "validated", Valid: true},
-				})
-				if err != nil {
-					logger.ErrorContext(ctx, "Failed to create discovered_devices entry",
-						slog.String("ip", event.IP),
-						slog.String("error", err.Error()),
-					)
-					continue
-				}
-
-				// 2. If auto_provision → Use Provisioner
-				if event.DiscoveryProfile.AutoProvision.Valid && event.DiscoveryProfile.AutoProvision.Bool {
-					if err := provisioner.ProvisionFromEvent(ctx, event); err != nil {
-						logger.ErrorContext(ctx, "Failed to auto-provision monitor",
-							slog.String("error", err.Error()),
-							slog.String("ip", event.IP),
-						)
-					} else {
-						logger.InfoContext(ctx, "Monitor created via auto-provision",
-							slog.String("ip", event.IP),
-						)
-					}
-				}
-
-			case <-ctx.Done():
-				return
-			case <-events.Done():
-				return
-			}
-		}
-	}()
-}
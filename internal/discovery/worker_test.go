@@ -0,0 +1,405 @@
+package discovery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	auth2 "github.com/nmslite/nmslite/internal/api/auth"
+	"github.com/nmslite/nmslite/internal/database/dbgen"
+	"github.com/nmslite/nmslite/internal/globals"
+	"github.com/nmslite/nmslite/internal/poller"
+)
+
+func TestLoadCredentialCandidates(t *testing.T) {
+	globals.SetGlobalConfigForTests(&globals.Config{Discovery: globals.DiscoveryConfig{MaxCredentialsPerProfile: 3}})
+
+	authService, err := auth2.NewService(
+		"0123456789abcdef0123456789abcdef", "0123456789abcdef0123456789abcdef", "admin", "admin", time.Hour,
+	)
+	if err != nil {
+		t.Fatalf("Failed to create auth service: %v", err)
+	}
+	encrypted, err := authService.Encrypt([]byte(`{"username":"nms","password":"secret"}`))
+	if err != nil {
+		t.Fatalf("Failed to encrypt credentials: %v", err)
+	}
+
+	q := newFakeQuerier()
+	q.credentials = map[int64]dbgen.CredentialProfile{
+		1: {ID: 1, Protocol: "ssh", Payload: []byte(encrypted)},
+		3: {ID: 3, Protocol: "windows-winrm", Payload: []byte("not encrypted")},
+		4: {ID: 4, Protocol: "snmp-v2c", Payload: []byte(encrypted)},
+		5: {ID: 5, Protocol: "ssh", Payload: []byte(encrypted)},
+	}
+	w := &Worker{
+		querier:       q,
+		credentials:   auth2.NewCredentialService(authService, q),
+		pluginManager: poller.NewPluginManager(t.TempDir(), time.Second, 0, 0),
+	}
+
+	testCases := []struct {
+		name    string
+		profile dbgen.DiscoveryProfile
+		wantIDs []int64
+		wantErr bool
+	}{
+		{"Single credential without a list", dbgen.DiscoveryProfile{CredentialProfileID: 1}, []int64{1}, false},
+		{"Order kept, unusable skipped", dbgen.DiscoveryProfile{CredentialProfileIds: []int64{4, 2, 3}}, []int64{4}, false},
+		{"List capped at the limit", dbgen.DiscoveryProfile{CredentialProfileIds: []int64{5, 1, 3, 4}}, []int64{5, 1}, false},
+		{"No usable credential", dbgen.DiscoveryProfile{CredentialProfileIds: []int64{2, 3}}, nil, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			candidates, err := w.loadCredentialCandidates(context.Background(), tc.profile, slog.Default())
+			if tc.wantErr {
+				if err == nil {
+					t.Fatal("Expected an error when no credential is usable")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if len(candidates) != len(tc.wantIDs) {
+				t.Fatalf("Expected %d candidates, got %d", len(tc.wantIDs), len(candidates))
+			}
+			for i, c := range candidates {
+				if c.profile.ID != tc.wantIDs[i] {
+					t.Errorf("Candidate %d: expected credential %d, got %d", i, tc.wantIDs[i], c.profile.ID)
+				}
+				if c.plugin == nil || c.plugin.Protocol != c.profile.Protocol {
+					t.Errorf("Candidate %d: expected a %s plugin, got %+v", i, c.profile.Protocol, c.plugin)
+				}
+				if c.creds == nil || c.creds.Username != "nms" {
+					t.Errorf("Candidate %d: expected decrypted credentials", i)
+				}
+			}
+		})
+	}
+}
+
+func TestFirstValidCredentialShortCircuits(t *testing.T) {
+	candidates := []credentialCandidate{
+		{profile: dbgen.CredentialProfile{ID: 1}, plugin: &globals.PluginInfo{Protocol: "ssh"}},
+		{profile: dbgen.CredentialProfile{ID: 2}, plugin: &globals.PluginInfo{Protocol: "ssh"}},
+		{profile: dbgen.CredentialProfile{ID: 3}, plugin: &globals.PluginInfo{Protocol: "ssh"}},
+	}
+
+	var tried []int64
+	validate := func(works int64) func(credentialCandidate) (*globals.PluginInfo, string, bool) {
+		return func(c credentialCandidate) (*globals.PluginInfo, string, bool) {
+			tried = append(tried, c.profile.ID)
+			return c.plugin, "host", c.profile.ID == works
+		}
+	}
+
+	winner, _, hostname, ok := firstValidCredential(context.Background(), candidates, validate(2))
+	if !ok || winner.profile.ID != 2 || hostname != "host" {
+		t.Fatalf("Expected credential 2 to win, got %d (ok=%v)", winner.profile.ID, ok)
+	}
+	if len(tried) != 2 {
+		t.Errorf("Expected attempts to stop after the first success, tried %v", tried)
+	}
+
+	tried = nil
+	if _, _, _, ok := firstValidCredential(context.Background(), candidates, validate(0)); ok {
+		t.Error("Expected no winner when every handshake fails")
+	}
+	if len(tried) != 3 {
+		t.Errorf("Expected every credential tried, tried %v", tried)
+	}
+
+	tried = nil
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, _, _, ok := firstValidCredential(ctx, candidates, validate(1)); ok || len(tried) != 0 {
+		t.Errorf("Expected no attempts after cancellation, tried %v", tried)
+	}
+}
+
+func TestValidateTargetProtocolLimits(t *testing.T) {
+	limits := map[string]int{"ssh": 2, "snmp-v2c": 5}
+
+	var mu sync.Mutex
+	inFlight := map[string]int{}
+	peak := map[string]int{}
+	counting := func(protocol string) handshakeFunc {
+		return func(target string, port int, creds *auth2.Credentials, timeout time.Duration) (*HandshakeResult, error) {
+			mu.Lock()
+			inFlight[protocol]++
+			if inFlight[protocol] > peak[protocol] {
+				peak[protocol] = inFlight[protocol]
+			}
+			mu.Unlock()
+
+			time.Sleep(10 * time.Millisecond)
+
+			mu.Lock()
+			inFlight[protocol]--
+			mu.Unlock()
+			return &HandshakeResult{Success: true}, nil
+		}
+	}
+
+	saved := handshakes
+	handshakes = map[string]handshakeFunc{"ssh": counting("ssh"), "snmp-v2c": counting("snmp-v2c")}
+	defer func() { handshakes = saved }()
+
+	w := &Worker{protocolSems: newProtocolSems(limits)}
+	logger := slog.New(slog.DiscardHandler)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		for protocol := range limits {
+			plugin := &globals.PluginInfo{Protocol: protocol}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if _, _, ok := w.validateTarget(context.Background(), "192.0.2.1", 1, nil, time.Second, []*globals.PluginInfo{plugin}, nil, logger); !ok {
+					t.Errorf("Expected %s handshake to succeed", protocol)
+				}
+			}()
+		}
+	}
+	wg.Wait()
+
+	for protocol, limit := range limits {
+		if peak[protocol] > limit {
+			t.Errorf("Expected at most %d concurrent %s handshakes, got %d", limit, protocol, peak[protocol])
+		}
+		if peak[protocol] < 2 {
+			t.Errorf("Expected %s handshakes to run concurrently, peak was %d", protocol, peak[protocol])
+		}
+	}
+
+	// A cancelled run gives up waiting for a slot
+	w.protocolSems["ssh"] <- struct{}{}
+	w.protocolSems["ssh"] <- struct{}{}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, _, ok := w.validateTarget(ctx, "192.0.2.1", 1, nil, time.Second, []*globals.PluginInfo{{Protocol: "ssh"}}, nil, logger); ok {
+		t.Error("Expected no validation once the context is cancelled")
+	}
+}
+
+func TestExecuteDiscoveryTriesEachPort(t *testing.T) {
+	globals.SetGlobalConfigForTests(&globals.Config{
+		Discovery: globals.DiscoveryConfig{MaxTargets: 8},
+		Channel:   globals.EventBusConfig{DiscoveryEventsChannelSize: 10},
+	})
+
+	authService, err := auth2.NewService(
+		"0123456789abcdef0123456789abcdef", "0123456789abcdef0123456789abcdef", "admin", "admin", time.Hour,
+	)
+	if err != nil {
+		t.Fatalf("Failed to create auth service: %v", err)
+	}
+	encrypted, err := authService.Encrypt([]byte(`{"username":"nms","password":"secret"}`))
+	if err != nil {
+		t.Fatalf("Failed to encrypt credentials: %v", err)
+	}
+	q := newFakeQuerier()
+	q.credentials = map[int64]dbgen.CredentialProfile{
+		1: {ID: 1, Protocol: "ssh", Payload: []byte(encrypted)},
+	}
+
+	// .1 answers on 2222 only, .2 on both ports, .3 on neither
+	listening := map[string]bool{"192.0.2.1:2222": true, "192.0.2.2:22": true, "192.0.2.2:2222": true}
+	var mu sync.Mutex
+	var probed []string
+	saved := handshakes
+	handshakes = map[string]handshakeFunc{
+		"ssh": func(target string, port int, creds *auth2.Credentials, timeout time.Duration) (*HandshakeResult, error) {
+			addr := fmt.Sprintf("%s:%d", target, port)
+			mu.Lock()
+			probed = append(probed, addr)
+			mu.Unlock()
+			return &HandshakeResult{Success: listening[addr]}, nil
+		},
+	}
+	defer func() { handshakes = saved }()
+
+	events := globals.NewEventChannels()
+	w := NewWorker(events, q, poller.NewPluginManager(t.TempDir(), time.Second, 0, 0),
+		auth2.NewCredentialService(authService, q), authService, slog.New(slog.DiscardHandler))
+	logger := slog.New(slog.DiscardHandler)
+
+	profile := dbgen.DiscoveryProfile{ID: 1, TargetValue: "192.0.2.1-192.0.2.3", Port: 22, Ports: []int32{22, 2222}, CredentialProfileID: 1}
+	found, total, err := w.executeDiscovery(context.Background(), profile, 0, nil, nil, logger)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if found != 2 || total != 3 {
+		t.Errorf("Expected 2 of 3 addresses validated, got %d of %d", found, total)
+	}
+
+	ports := make(map[string]int)
+	for len(events.DeviceValidated) > 0 {
+		event := <-events.DeviceValidated
+		ports[event.IP] = event.Port
+	}
+	if ports["192.0.2.1"] != 2222 || ports["192.0.2.2"] != 22 || len(ports) != 2 {
+		t.Errorf("Expected .1 on 2222 and .2 on 22, got %v", ports)
+	}
+	if slices.Contains(probed, "192.0.2.2:2222") {
+		t.Error("Expected probing to stop at the first port that validates")
+	}
+
+	// 3 addresses on 3 ports exceed 8 probes
+	profile.Ports = []int32{22, 2222, 8022}
+	if _, _, err := w.executeDiscovery(context.Background(), profile, 0, nil, nil, logger); err == nil {
+		t.Error("Expected address×port combinations over max_targets to fail the run")
+	}
+}
+
+func TestExecuteDiscoveryAutoDetect(t *testing.T) {
+	authService, err := auth2.NewService(
+		"0123456789abcdef0123456789abcdef", "0123456789abcdef0123456789abcdef", "admin", "admin", time.Hour,
+	)
+	if err != nil {
+		t.Fatalf("Failed to create auth service: %v", err)
+	}
+	login, err := authService.Encrypt([]byte(`{"username":"nms","password":"secret"}`))
+	if err != nil {
+		t.Fatalf("Failed to encrypt credentials: %v", err)
+	}
+	community, err := authService.Encrypt([]byte(`{"community":"public"}`))
+	if err != nil {
+		t.Fatalf("Failed to encrypt credentials: %v", err)
+	}
+	q := newFakeQuerier()
+	q.credentials = map[int64]dbgen.CredentialProfile{
+		1: {ID: 1, Protocol: "ssh", Payload: []byte(login)},
+		2: {ID: 2, Protocol: "snmp-v2c", Payload: []byte(community)},
+	}
+
+	// .1 answers WinRM only, .2 SSH, .3 nothing
+	answers := map[string]string{"192.0.2.1": "windows-winrm", "192.0.2.2": "ssh"}
+	var mu sync.Mutex
+	probes := make(map[string]int)
+	fake := func(protocol string) handshakeFunc {
+		return func(target string, port int, creds *auth2.Credentials, timeout time.Duration) (*HandshakeResult, error) {
+			mu.Lock()
+			probes[target]++
+			mu.Unlock()
+			return &HandshakeResult{Success: answers[target] == protocol}, nil
+		}
+	}
+	saved := handshakes
+	handshakes = map[string]handshakeFunc{
+		"ssh":           fake("ssh"),
+		"windows-winrm": fake("windows-winrm"),
+		"snmp-v2c":      fake("snmp-v2c"),
+	}
+	defer func() { handshakes = saved }()
+
+	profile := dbgen.DiscoveryProfile{ID: 1, TargetValue: "192.0.2.1-192.0.2.3", CredentialProfileIds: []int64{1, 2}}
+
+	testCases := []struct {
+		name        string
+		autoDetect  bool
+		maxAttempts int
+		want        map[string]string // IP -> detected protocol
+		maxProbes   int
+	}{
+		{"Disabled tries declared protocols only", false, 0, map[string]string{"192.0.2.2": "ssh"}, 2},
+		{"Finds a credential over another protocol", true, 0, map[string]string{"192.0.2.1": "windows-winrm", "192.0.2.2": "ssh"}, 3},
+		{"Attempts bounded per IP", true, 2, map[string]string{"192.0.2.2": "ssh"}, 2},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			globals.SetGlobalConfigForTests(&globals.Config{
+				Discovery: globals.DiscoveryConfig{
+					MaxTargets:            8,
+					AutoDetectProtocols:   tc.autoDetect,
+					AutoDetectMaxAttempts: tc.maxAttempts,
+				},
+				Channel: globals.EventBusConfig{DiscoveryEventsChannelSize: 10},
+			})
+			clear(probes)
+
+			events := globals.NewEventChannels()
+			w := NewWorker(events, q, poller.NewPluginManager(t.TempDir(), time.Second, 0, 0),
+				auth2.NewCredentialService(authService, q), authService, slog.New(slog.DiscardHandler))
+			if _, _, err := w.executeDiscovery(context.Background(), profile, 0, nil, nil, slog.New(slog.DiscardHandler)); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			got := make(map[string]string)
+			for len(events.DeviceValidated) > 0 {
+				event := <-events.DeviceValidated
+				got[event.IP] = event.Protocol
+				if event.Plugin.Protocol != event.Protocol {
+					t.Errorf("%s: expected the %s plugin, got %s", event.IP, event.Protocol, event.Plugin.Protocol)
+				}
+				if event.CredentialProfile.ID != 1 {
+					t.Errorf("%s: expected credential 1, got %d", event.IP, event.CredentialProfile.ID)
+				}
+			}
+			if !maps.Equal(got, tc.want) {
+				t.Errorf("Expected detected protocols %v, got %v", tc.want, got)
+			}
+			if probes["192.0.2.3"] > tc.maxProbes {
+				t.Errorf("Expected at most %d handshakes for an unresponsive IP, got %d", tc.maxProbes, probes["192.0.2.3"])
+			}
+		})
+	}
+}
+
+func TestDeviceRecorder(t *testing.T) {
+	testCases := []struct {
+		name     string
+		outcomes []error // nil records the device; errDropped skips its event
+		cancel   bool
+		want     bool
+	}{
+		{"No devices", nil, false, true},
+		{"All recorded", []error{nil, nil}, false, true},
+		{"One failed", []error{nil, errors.New("insert failed")}, false, false},
+		{"One dropped", []error{nil, errDropped}, false, false},
+		{"Cancelled while pending", nil, true, false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := &deviceRecorder{}
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			if tc.cancel {
+				r.add() // never settled
+				cancel()
+			}
+			for _, outcome := range tc.outcomes {
+				event := globals.DeviceValidatedEvent{Recorded: r.add()}
+				if outcome == errDropped {
+					r.skip(event)
+					continue
+				}
+				go func() {
+					event.Recorded(outcome)
+					event.Recorded(outcome) // repeated calls are ignored
+				}()
+			}
+			if got := r.wait(ctx); got != tc.want {
+				t.Errorf("Expected wait to report %v, got %v", tc.want, got)
+			}
+		})
+	}
+
+	var nilRecorder *deviceRecorder
+	if nilRecorder.add() != nil || !nilRecorder.wait(context.Background()) {
+		t.Error("Expected a nil recorder to track nothing")
+	}
+}
+
+// errDropped marks a TestDeviceRecorder device whose event is never delivered
+var errDropped = errors.New("dropped")
@@ -0,0 +1,48 @@
+package globals
+
+import (
+	"runtime/debug"
+	"time"
+)
+
+// Version is the server version; release builds override it with
+// -ldflags "-X github.com/nmslite/nmslite/internal/globals.Version=<version>"
+var Version = "1.0.0"
+
+// startedAt is when the process started, for uptime reporting
+var startedAt = time.Now()
+
+// BuildInfo describes the running binary
+type BuildInfo struct {
+	Version   string `json:"version"`
+	GoVersion string `json:"go_version"`
+	Revision  string `json:"revision,omitempty"`   // VCS commit, when built from a checkout
+	BuildTime string `json:"build_time,omitempty"` // VCS commit time
+	Modified  bool   `json:"modified,omitempty"`   // built from a dirty tree
+}
+
+// GetBuildInfo returns the version and the VCS details embedded by the Go toolchain
+func GetBuildInfo() BuildInfo {
+	info := BuildInfo{Version: Version}
+	bi, ok := debug.ReadBuildInfo()
+	if !ok {
+		return info
+	}
+	info.GoVersion = bi.GoVersion
+	for _, s := range bi.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			info.Revision = s.Value
+		case "vcs.time":
+			info.BuildTime = s.Value
+		case "vcs.modified":
+			info.Modified = s.Value == "true"
+		}
+	}
+	return info
+}
+
+// Uptime returns how long the process has been running
+func Uptime() time.Duration {
+	return time.Since(startedAt)
+}
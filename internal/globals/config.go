@@ -6,9 +6,13 @@ import (
 	"io"
 	"log"
 	"log/slog"
+	"net"
+	"net/netip"
 	"net/url"
 	"os"
+	"path"
 	"slices"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -29,6 +33,8 @@ type Config struct {
 	Plugins   PluginsConfig   `yaml:"pluginManager"`
 	Channel   EventBusConfig  `yaml:"channel"`
 	Logging   LoggingConfig   `yaml:"logging"`
+	RateLimit RateLimitConfig `yaml:"rate_limit"`
+	Traps     TrapConfig      `yaml:"traps"`
 }
 
 type ServerConfig struct {
@@ -36,6 +42,20 @@ type ServerConfig struct {
 	Port           int    `yaml:"port"`
 	ReadTimeoutMS  int    `yaml:"read_timeout_ms"`
 	WriteTimeoutMS int    `yaml:"write_timeout_ms"`
+
+	// ShutdownTimeoutMS bounds graceful shutdown: HTTP drain and in-flight poll batches
+	ShutdownTimeoutMS int `yaml:"shutdown_timeout_ms"`
+
+	// MaxBodyBytes caps request bodies (0 = 1 MiB, negative disables)
+	MaxBodyBytes int64 `yaml:"max_body_bytes"`
+	// BulkMaxBodyBytes replaces MaxBodyBytes on bulk endpoints such as metric ingestion
+	// and batch metric queries (0 = 16 MiB, negative disables)
+	BulkMaxBodyBytes int64 `yaml:"bulk_max_body_bytes"`
+
+	// InstanceID names this server among others sharing the database; it must be unique
+	// and stable across restarts (empty = the hostname). Discovery jobs record it so a
+	// restart fails only its own interrupted runs.
+	InstanceID string `yaml:"instance_id"`
 }
 
 type TLSConfig struct {
@@ -69,6 +89,35 @@ type DatabaseConfig struct {
 	DBName   string     `yaml:"dbname"`
 	SSLMode  string     `yaml:"ssl_mode"`
 	Pool     PoolConfig `yaml:"pool"`
+
+	// DiscoveryPool is a separate, smaller pool for discovery and provisioning writes so a
+	// large discovery run cannot starve the scheduler's reads on Pool. Zero values fall back
+	// to Pool's settings, except max_conns which defaults to 10.
+	DiscoveryPool PoolConfig `yaml:"discovery_pool"`
+
+	// Replica is an optional read replica for metrics and history reads. Those reads retry
+	// on the primary when the replica connection fails. Disabled while host is empty.
+	Replica ReplicaConfig `yaml:"replica"`
+
+	// QueryTimeoutMS bounds each read query issued by API handlers
+	QueryTimeoutMS int `yaml:"query_timeout_ms"`
+	// WriteTimeoutMS bounds multi-statement writes issued by API handlers, such as bulk provisioning
+	WriteTimeoutMS int `yaml:"write_timeout_ms"`
+
+	// BreakerFailureThreshold is how many consecutive failed API reads open the DB circuit breaker,
+	// and how many consecutive replica connection failures send replica reads to the primary (0 = 5)
+	BreakerFailureThreshold int `yaml:"breaker_failure_threshold"`
+	// BreakerCooldownSeconds is how long an open breaker fails reads fast before probing, and how
+	// long a failing replica is skipped (0 = 30)
+	BreakerCooldownSeconds int `yaml:"breaker_cooldown_seconds"`
+}
+
+// ReplicaConfig locates a read replica; credentials, dbname and ssl_mode are the primary's
+type ReplicaConfig struct {
+	Host string `yaml:"host"`
+	Port int    `yaml:"port"` // 0 = the primary's port
+	// Pool settings for the replica; zero values fall back to the main pool's
+	Pool PoolConfig `yaml:"pool"`
 }
 
 type AuthConfig struct {
@@ -87,6 +136,11 @@ type PollerConfig struct {
 	BatchFlushIntervalMS int `yaml:"batch_flush_interval_ms"`
 	PluginTimeoutMS      int `yaml:"plugin_timeout_ms"`
 	DownThreshold        int `yaml:"down_threshold"`
+
+	// BatchedLiveness runs liveness probes on a fixed pool of LivenessPoolSize workers fed
+	// through a queue of LivenessBatchSize targets, instead of a goroutine per monitor
+	// gated by scheduler.liveness_workers (default false)
+	BatchedLiveness bool `yaml:"batched_liveness"`
 }
 
 type SchedulerConfig struct {
@@ -96,6 +150,59 @@ type SchedulerConfig struct {
 	LivenessTimeoutMS int `yaml:"liveness_timeout_ms"`
 	PluginTimeoutMS   int `yaml:"plugin_timeout_ms"`
 	DownThreshold     int `yaml:"down_threshold"`
+
+	// LivenessMethod is the default probe: "tcp" (default), "icmp" or "none"
+	LivenessMethod string `yaml:"liveness_method"`
+	// ProtocolLivenessMethods overrides LivenessMethod per plugin/protocol ID
+	ProtocolLivenessMethods map[string]string `yaml:"protocol_liveness_methods"`
+
+	// ArchiveAfterHours moves monitors down for longer than this to "archived" (0 disables)
+	ArchiveAfterHours int `yaml:"archive_after_hours"`
+	// ArchiveIntervalMinutes is how often the archive reaper runs
+	ArchiveIntervalMinutes int `yaml:"archive_interval_minutes"`
+	// StateHistoryRetentionDays prunes state transitions older than this
+	// (0 = 365, negative keeps them forever)
+	StateHistoryRetentionDays int `yaml:"state_history_retention_days"`
+	// CredentialCacheTTLMinutes drops decrypted credentials unused for this long (default 15)
+	CredentialCacheTTLMinutes int `yaml:"credential_cache_ttl_minutes"`
+
+	// MinPollingIntervalSeconds and MaxPollingIntervalSeconds bound a monitor's
+	// polling_interval_seconds (0 = 10 and 86400)
+	MinPollingIntervalSeconds int `yaml:"min_polling_interval_seconds"`
+	MaxPollingIntervalSeconds int `yaml:"max_polling_interval_seconds"`
+
+	// LivenessKeepAliveSeconds is the TCP keep-alive period for liveness probes
+	// (0 = OS default, negative disables)
+	LivenessKeepAliveSeconds int `yaml:"liveness_keepalive_seconds"`
+	// LivenessSourceAddress binds liveness probes to a local IP so they egress a specific
+	// interface on multi-homed hosts ("" = OS routing). Only targets of the same address
+	// family are bound.
+	LivenessSourceAddress string `yaml:"liveness_source_address"`
+
+	// InitialPollDelay sets when a newly added monitor first polls: "immediate" (default)
+	// on the next tick, "fixed" after InitialPollDelaySeconds, or "spread" at a random
+	// point within its polling interval so a burst of new monitors is staggered
+	InitialPollDelay        string `yaml:"initial_poll_delay"`
+	InitialPollDelaySeconds int    `yaml:"initial_poll_delay_seconds"`
+
+	// MaxInFlightPolls caps monitors being polled at once across all plugins; dispatch
+	// waits for a free slot once it is reached (0 = unlimited)
+	MaxInFlightPolls int `yaml:"max_in_flight_polls"`
+
+	// DuplicateMonitorPolicy applies when a monitor is created for an IP and plugin that
+	// already have one: "warn" (default) creates it and logs a warning, "reject" refuses it
+	// with 409 and "allow" creates it silently. Auto-provisioning skips such devices
+	// unless the policy is "allow".
+	DuplicateMonitorPolicy string `yaml:"duplicate_monitor_policy"`
+
+	// StaleAfterIntervals marks a reachable monitor "stale" once its polls have returned no
+	// metrics for this many polling intervals (0 = 3, negative disables)
+	StaleAfterIntervals int `yaml:"stale_after_intervals"`
+
+	// InvalidateWorkers is how many goroutines apply cache invalidations (monitor updates and
+	// deletes) off the tick loop, so a burst of edits does not delay polling (0 = 1). Workers
+	// decode pushed rows in parallel; only the schedule changes themselves are serialized.
+	InvalidateWorkers int `yaml:"invalidate_workers"`
 }
 
 type MetricsConfig struct {
@@ -104,18 +211,130 @@ type MetricsConfig struct {
 	RetentionDays         int `yaml:"retention_days"`
 	CompressionAfterHours int `yaml:"compression_after_hours"`
 	MaxBufferSize         int `yaml:"max_buffer_size"`
-	MaxMetricAgeMinutes   int `yaml:"max_metric_age_minutes"`
+
+	// TimestampPolicy picks the time each metric is stored at: "plugin" (default) keeps the
+	// timestamp the plugin reported, "server" replaces it with the time the result arrived,
+	// and "reject" keeps it but drops metrics more than MaxMetricAgeMinutes from server time
+	TimestampPolicy     string `yaml:"timestamp_policy"`
+	MaxMetricAgeMinutes int    `yaml:"max_metric_age_minutes"` // 0 = 5
+
+	// Retention worker settings
+	RetentionBatchSize       int `yaml:"retention_batch_size"`
+	RetentionIntervalMinutes int `yaml:"retention_interval_minutes"`
+
+	// Rollup worker settings. RollupAfterHours opts in to downsampling: raw points older than
+	// this become hourly aggregates and are deleted (0 = disabled, raw points are kept until
+	// retention). It is separate from CompressionAfterHours, which is lossless compression.
+	RollupAfterHours      int `yaml:"rollup_after_hours"`
+	RollupIntervalMinutes int `yaml:"rollup_interval_minutes"`
+	// RollupRetentionDays purges hourly aggregates older than this (0 = 365, negative keeps forever)
+	RollupRetentionDays int `yaml:"rollup_retention_days"`
+
+	// PipelineCheckIntervalSeconds is how often the end-to-end pipeline check confirms that
+	// metrics are still being written (0 = 60, negative disables)
+	PipelineCheckIntervalSeconds int `yaml:"pipeline_check_interval_seconds"`
+
+	// NonFinitePolicy handles NaN/Inf values from plugins: "drop" (default) discards them,
+	// "tag" also records a "<name>.invalid" gauge of 1 so the bad reading stays visible
+	NonFinitePolicy string `yaml:"non_finite_policy"`
+
+	// SlowQueryThresholdMS logs metrics API queries slower than this at warn (0 = 1000, negative disables)
+	SlowQueryThresholdMS int `yaml:"slow_query_threshold_ms"`
+
+	// IncludeMetrics and ExcludeMetrics are glob patterns (e.g. "system.cpu.*") applied to
+	// metric names before they are written. With includes set only matching names are kept;
+	// excludes then drop matching names. Both empty keeps everything.
+	IncludeMetrics []string `yaml:"include_metrics"`
+	ExcludeMetrics []string `yaml:"exclude_metrics"`
 }
 
 type DiscoveryConfig struct {
 	MaxDiscoveryWorkers  int `yaml:"max_discovery_workers"`
 	DefaultPortTimeoutMS int `yaml:"default_port_timeout_ms"`
 	HandshakeTimeoutMS   int `yaml:"handshake_timeout_ms"`
+
+	// ScheduleTickSeconds is how often recurring discovery profiles are checked
+	ScheduleTickSeconds int `yaml:"schedule_tick_seconds"`
+	// MinScheduleIntervalSeconds is the shortest interval_seconds a profile may use
+	MinScheduleIntervalSeconds int `yaml:"min_schedule_interval_seconds"`
+
+	// ProvisionWorkers bounds how many validated devices are provisioned concurrently
+	ProvisionWorkers int `yaml:"provision_workers"`
+
+	// SNMPRetries is the default number of SNMP request retries (credentials may override).
+	// Unset uses 2; 0 disables retries.
+	SNMPRetries *int `yaml:"snmp_retries"`
+	// SNMPTimeoutMS is the default per-attempt SNMP timeout; 0 uses handshake_timeout_ms
+	SNMPTimeoutMS int `yaml:"snmp_timeout_ms"`
+
+	// SkipIPv6SubnetRouter excludes the subnet-router anycast address when expanding IPv6 CIDRs
+	SkipIPv6SubnetRouter bool `yaml:"skip_ipv6_subnet_router"`
+
+	// MaxTargets is the most addresses one profile's target may expand to (0 = 65536)
+	MaxTargets int `yaml:"max_targets"`
+
+	// IdempotencyTTLSeconds is how long a run request's Idempotency-Key is remembered (0 = 300)
+	IdempotencyTTLSeconds int `yaml:"idempotency_ttl_seconds"`
+
+	// MaxCredentialsPerProfile bounds how many credential profiles discovery tries per IP (0 = 5)
+	MaxCredentialsPerProfile int `yaml:"max_credentials_per_profile"`
+
+	// HostKeyCheckIntervalSeconds is how often opted-in SSH monitors have their host key verified (0 = 3600)
+	HostKeyCheckIntervalSeconds int `yaml:"host_key_check_interval_seconds"`
+
+	// ProtocolHandshakeLimits caps concurrent handshakes per protocol ID, within
+	// max_discovery_workers (missing or 0 = no per-protocol cap)
+	ProtocolHandshakeLimits map[string]int `yaml:"protocol_handshake_limits"`
+
+	// RunHistoryLimit is how many finished runs, with their summaries, are kept per profile (0 = 50)
+	RunHistoryLimit int `yaml:"run_history_limit"`
+
+	// CredentialTestWorkers bounds the live handshakes one credential test runs at once (0 = 10)
+	CredentialTestWorkers int `yaml:"credential_test_workers"`
+	// CredentialTestTimeoutMS is the deadline of each credential test handshake (0 = handshake_timeout_ms)
+	CredentialTestTimeoutMS int `yaml:"credential_test_timeout_ms"`
+
+	// AutoDetectProtocols also tries each credential over the other protocols its fields fit
+	// (a username/password over both SSH and WinRM), provisioning whichever answers
+	AutoDetectProtocols bool `yaml:"auto_detect_protocols"`
+	// AutoDetectMaxAttempts bounds the handshakes auto-detection makes per IP (0 = 8)
+	AutoDetectMaxAttempts int `yaml:"auto_detect_max_attempts"`
 }
 
 type PluginsConfig struct {
 	Directory           string `yaml:"directory"`
 	ScanIntervalSeconds int    `yaml:"scan_interval_seconds"`
+
+	// MaxOutputBytes bounds a plugin's stdout; larger output kills the plugin
+	MaxOutputBytes int64 `yaml:"max_output_bytes"`
+
+	// SelfTest runs each plugin once at startup with an empty batch to catch broken
+	// binaries (missing exec bit, wrong architecture) before the first poll
+	SelfTest          bool `yaml:"self_test"`
+	SelfTestTimeoutMS int  `yaml:"self_test_timeout_ms"`
+	// SelfTestUnregister drops plugins that fail the self-test instead of only logging
+	SelfTestUnregister bool `yaml:"self_test_unregister"`
+
+	// CompressionMinTasks gzip-frames stdin/stdout for batches of at least this many tasks,
+	// for plugins whose manifest declares "compression": "gzip" (0 = 100, negative disables)
+	CompressionMinTasks int `yaml:"compression_min_tasks"`
+
+	// SpawnRetries retries starting a plugin process that failed transiently (EAGAIN,
+	// out of file descriptors) before failing the batch (0 = 2, negative disables);
+	// SpawnBackoffMS is the first delay between attempts, doubled each time (0 = 50)
+	SpawnRetries   int `yaml:"spawn_retries"`
+	SpawnBackoffMS int `yaml:"spawn_backoff_ms"`
+
+	// CPULimitSeconds and MemoryLimitMB cap each plugin process's CPU time and resident
+	// memory; a plugin over either is killed and its batch fails (0 = unlimited). Enforced
+	// on Linux only, elsewhere only the plugin timeout applies. Daemon plugins get the
+	// memory limit only, since their CPU time accumulates across batches.
+	CPULimitSeconds int `yaml:"cpu_limit_seconds"`
+	MemoryLimitMB   int `yaml:"memory_limit_mb"`
+
+	// DisableDaemons runs every plugin once per batch, even those whose manifest declares
+	// "daemon": true and would otherwise be kept running between polls
+	DisableDaemons bool `yaml:"disable_daemons"`
 }
 
 type EventBusConfig struct {
@@ -125,13 +344,128 @@ type EventBusConfig struct {
 	StateSignalChannelSize     int `yaml:"state_signal_channel_size"`
 	DiscoveryEventsChannelSize int `yaml:"discovery_events_channel_size"`
 	DeviceValidatedChannelSize int `yaml:"device_validated_channel_size"`
+
+	// CacheEventSendTimeoutMS is how long a committed monitor change waits for room on the
+	// cache_invalidate channel before the event is dropped (0 = 5000)
+	CacheEventSendTimeoutMS int `yaml:"cache_event_send_timeout_ms"`
+
+	// Slow-consumer detection: a channel at least SlowConsumerHighWaterPercent full for
+	// SlowConsumerSustainSeconds is reported as having a stuck consumer. Fill is sampled
+	// every SlowConsumerSampleIntervalMS. Zero values use the defaults (80%, 30s, 1000ms).
+	SlowConsumerHighWaterPercent int `yaml:"slow_consumer_high_water_percent"`
+	SlowConsumerSustainSeconds   int `yaml:"slow_consumer_sustain_seconds"`
+	SlowConsumerSampleIntervalMS int `yaml:"slow_consumer_sample_interval_ms"`
+
+	// RecordDroppedEvents keeps the last DroppedEventsBufferSize events dropped on a full
+	// channel in memory, for GET /api/v1/admin/events/dropped. Off by default because it
+	// retains event data.
+	RecordDroppedEvents     bool `yaml:"record_dropped_events"`
+	DroppedEventsBufferSize int  `yaml:"dropped_events_buffer_size"`
+}
+
+// SlowConsumerHighWater returns the fill ratio above which a channel counts as backed up
+func (c *EventBusConfig) SlowConsumerHighWater() float64 {
+	if c.SlowConsumerHighWaterPercent > 0 {
+		return float64(c.SlowConsumerHighWaterPercent) / 100
+	}
+	return 0.8
+}
+
+// CacheEventSendTimeout returns how long a cache invalidation send may wait for room
+func (c *EventBusConfig) CacheEventSendTimeout() time.Duration {
+	if c.CacheEventSendTimeoutMS > 0 {
+		return time.Duration(c.CacheEventSendTimeoutMS) * time.Millisecond
+	}
+	return 5 * time.Second
+}
+
+// SlowConsumerSustain returns how long a channel must stay backed up before it is reported
+func (c *EventBusConfig) SlowConsumerSustain() time.Duration {
+	if c.SlowConsumerSustainSeconds > 0 {
+		return time.Duration(c.SlowConsumerSustainSeconds) * time.Second
+	}
+	return 30 * time.Second
+}
+
+// SlowConsumerSampleInterval returns how often channel fill is sampled
+func (c *EventBusConfig) SlowConsumerSampleInterval() time.Duration {
+	if c.SlowConsumerSampleIntervalMS > 0 {
+		return time.Duration(c.SlowConsumerSampleIntervalMS) * time.Millisecond
+	}
+	return time.Second
+}
+
+// DroppedEventsBuffer returns how many dropped events are kept (0 when recording is off)
+func (c *EventBusConfig) DroppedEventsBuffer() int {
+	if !c.RecordDroppedEvents {
+		return 0
+	}
+	if c.DroppedEventsBufferSize > 0 {
+		return c.DroppedEventsBufferSize
+	}
+	return 100
+}
+
+// RateLimitConfig defines per-user (or per-IP) token-bucket limits for the API
+type RateLimitConfig struct {
+	Enabled           bool              `yaml:"enabled"`
+	RequestsPerSecond float64           `yaml:"requests_per_second"`
+	Burst             int               `yaml:"burst"`
+	IdleTTLSeconds    int               `yaml:"idle_ttl_seconds"`
+	Routes            []RouteLimitEntry `yaml:"routes"`
+}
+
+// RouteLimitEntry overrides the default limit for a single endpoint
+type RouteLimitEntry struct {
+	Method            string  `yaml:"method"`
+	Path              string  `yaml:"path"`
+	RequestsPerSecond float64 `yaml:"requests_per_second"`
+	Burst             int     `yaml:"burst"`
+}
+
+// TrapConfig controls the SNMP trap listener that triggers immediate re-polls
+type TrapConfig struct {
+	Enabled       bool   `yaml:"enabled"`
+	ListenAddress string `yaml:"listen_address"`
+	// Port is the UDP port traps are received on (0 = 162; binding below 1024 needs privileges)
+	Port int `yaml:"port"`
+	// Community, when set, drops v1/v2c traps carrying a different community string
+	Community string `yaml:"community"`
+	// RepollCooldownSeconds ignores further traps from a device re-polled this recently (0 = 10)
+	RepollCooldownSeconds int `yaml:"repoll_cooldown_seconds"`
 }
 
 type LoggingConfig struct {
-	Level    string `yaml:"level"`
-	Format   string `yaml:"format"`
+	Level  string `yaml:"level"`
+	Format string `yaml:"format"`
+	// Output is "stdout", "file" or "both"; file output goes to FilePath
 	Output   string `yaml:"output"`
 	FilePath string `yaml:"file_path"`
+
+	// MaxSizeMB rotates the log file once it reaches this size (0 = 100)
+	MaxSizeMB int `yaml:"max_size_mb"`
+	// MaxBackups is how many rotated files to keep (0 keeps all)
+	MaxBackups int `yaml:"max_backups"`
+	// MaxAgeDays removes rotated files older than this (0 keeps all)
+	MaxAgeDays int `yaml:"max_age_days"`
+
+	// DebugSampleEvery keeps 1 in N scheduler debug records per message (0 or 1 logs all).
+	// Info, warnings and errors are never sampled.
+	DebugSampleEvery int `yaml:"debug_sample_every"`
+
+	// ComponentLevels overrides Level for loggers tagged with a "component" attribute
+	// (e.g. scheduler: debug, api: warn); unlisted components use Level
+	ComponentLevels map[string]string `yaml:"component_levels"`
+
+	AccessLog AccessLogConfig `yaml:"access_log"`
+}
+
+// AccessLogConfig controls the HTTP access log middleware
+type AccessLogConfig struct {
+	// Level for successful and 4xx requests ("debug", "info", ...); 5xx always log at warn
+	Level string `yaml:"level"`
+	// SkipPaths are exact request paths that are never logged (e.g. health checks)
+	SkipPaths []string `yaml:"skip_paths"`
 }
 
 // Load reads configuration from file and applies environment variable overrides
@@ -160,6 +494,10 @@ func Load(configPath string) (*Config, error) {
 	return cfg, nil
 }
 
+// PortRangeMessage is the validation message for a port where 0 selects the protocol
+// default; the API handlers and Validate share it so the wording stays the same
+const PortRangeMessage = "port must be between 1 and 65535, or omitted for the protocol default"
+
 // Validate ensures all required configuration values are set
 func (c *Config) Validate() error {
 	// Required auth fields in production
@@ -186,6 +524,57 @@ func (c *Config) Validate() error {
 		return fmt.Errorf("database host and dbname are required")
 	}
 
+	if c.Scheduler.LivenessSourceAddress != "" {
+		if _, err := netip.ParseAddr(c.Scheduler.LivenessSourceAddress); err != nil {
+			return fmt.Errorf("scheduler.liveness_source_address must be an IP address, got %q", c.Scheduler.LivenessSourceAddress)
+		}
+	}
+
+	switch c.Scheduler.InitialPollDelay {
+	case "", "immediate", "fixed", "spread":
+	default:
+		return fmt.Errorf("scheduler.initial_poll_delay must be immediate, fixed or spread, got %q", c.Scheduler.InitialPollDelay)
+	}
+	if c.Scheduler.InitialPollDelaySeconds < 0 {
+		return fmt.Errorf("scheduler.initial_poll_delay_seconds must not be negative, got %d", c.Scheduler.InitialPollDelaySeconds)
+	}
+	switch c.Scheduler.DuplicateMonitorPolicy {
+	case "", "warn", "reject", "allow":
+	default:
+		return fmt.Errorf("scheduler.duplicate_monitor_policy must be warn, reject or allow, got %q", c.Scheduler.DuplicateMonitorPolicy)
+	}
+	if c.Channel.SlowConsumerHighWaterPercent < 0 || c.Channel.SlowConsumerHighWaterPercent > 100 {
+		return fmt.Errorf("channel.slow_consumer_high_water_percent must be between 0 and 100, got %d", c.Channel.SlowConsumerHighWaterPercent)
+	}
+
+	if c.Discovery.SNMPRetries != nil && *c.Discovery.SNMPRetries < 0 {
+		return fmt.Errorf("discovery.snmp_retries must not be negative, got %d", *c.Discovery.SNMPRetries)
+	}
+
+	if c.Scheduler.MaxInFlightPolls < 0 {
+		return fmt.Errorf("scheduler.max_in_flight_polls must not be negative, got %d", c.Scheduler.MaxInFlightPolls)
+	}
+
+	if c.Traps.Enabled && (c.Traps.Port < 0 || c.Traps.Port > 65535) {
+		return fmt.Errorf("traps.%s, got %d", PortRangeMessage, c.Traps.Port)
+	}
+
+	switch c.Metrics.NonFinitePolicy {
+	case "", "drop", "tag":
+	default:
+		return fmt.Errorf("metrics.non_finite_policy must be drop or tag, got %q", c.Metrics.NonFinitePolicy)
+	}
+	switch c.Metrics.TimestampPolicy {
+	case "", "plugin", "server", "reject":
+	default:
+		return fmt.Errorf("metrics.timestamp_policy must be plugin, server or reject, got %q", c.Metrics.TimestampPolicy)
+	}
+	for _, pattern := range slices.Concat(c.Metrics.IncludeMetrics, c.Metrics.ExcludeMetrics) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("metrics filter pattern %q is invalid: %w", pattern, err)
+		}
+	}
+
 	return nil
 }
 
@@ -202,6 +591,11 @@ func applyEnvOverrides(cfg *Config) {
 		cfg.Database.Password = v
 	}
 
+	// Server overrides
+	if v := os.Getenv("NMS_SERVER_INSTANCE_ID"); v != "" {
+		cfg.Server.InstanceID = v
+	}
+
 	// Auth overrides
 	if v := os.Getenv("NMS_AUTH_ADMIN_PASSWORD"); v != "" {
 		cfg.Auth.AdminPassword = v
@@ -244,11 +638,50 @@ func (s *ServerConfig) ReadTimeout() time.Duration {
 	return time.Duration(s.ReadTimeoutMS) * time.Millisecond
 }
 
+// ShutdownTimeout returns the graceful shutdown timeout as a duration
+func (s *ServerConfig) ShutdownTimeout() time.Duration {
+	if s.ShutdownTimeoutMS <= 0 {
+		return 30 * time.Second
+	}
+	return time.Duration(s.ShutdownTimeoutMS) * time.Millisecond
+}
+
+// MaxBodySize returns the request body cap in bytes (0 = unlimited)
+func (s *ServerConfig) MaxBodySize() int64 {
+	switch {
+	case s.MaxBodyBytes < 0:
+		return 0
+	case s.MaxBodyBytes == 0:
+		return 1 << 20
+	}
+	return s.MaxBodyBytes
+}
+
+// BulkMaxBodySize returns the request body cap for bulk endpoints in bytes (0 = unlimited)
+func (s *ServerConfig) BulkMaxBodySize() int64 {
+	switch {
+	case s.BulkMaxBodyBytes < 0:
+		return 0
+	case s.BulkMaxBodyBytes == 0:
+		return 16 << 20
+	}
+	return s.BulkMaxBodyBytes
+}
+
 // WriteTimeout returns the write timeout as a duration
 func (s *ServerConfig) WriteTimeout() time.Duration {
 	return time.Duration(s.WriteTimeoutMS) * time.Millisecond
 }
 
+// Instance returns InstanceID, or the hostname when unset ("" if that is unknown too)
+func (s *ServerConfig) Instance() string {
+	if s.InstanceID != "" {
+		return s.InstanceID
+	}
+	hostname, _ := os.Hostname()
+	return hostname
+}
+
 // ConnString returns the PostgreSQL connection string in postgres:// URL format
 func (d *DatabaseConfig) ConnString() string {
 	u := &url.URL{
@@ -267,6 +700,21 @@ func (d *DatabaseConfig) ConnString() string {
 	return u.String()
 }
 
+// QueryTimeout returns the per-query timeout as a duration
+func (d *DatabaseConfig) QueryTimeout() time.Duration {
+	return time.Duration(d.QueryTimeoutMS) * time.Millisecond
+}
+
+// WriteTimeout returns the API write timeout as a duration
+func (d *DatabaseConfig) WriteTimeout() time.Duration {
+	return time.Duration(d.WriteTimeoutMS) * time.Millisecond
+}
+
+// BreakerCooldown returns the DB circuit breaker cooldown as a duration
+func (d *DatabaseConfig) BreakerCooldown() time.Duration {
+	return time.Duration(d.BreakerCooldownSeconds) * time.Second
+}
+
 // ApplyDefaults sets default values for pool configuration
 func (p *PoolConfig) ApplyDefaults() {
 	// Unified pool defaults - balanced for all operations
@@ -287,6 +735,61 @@ func (p *PoolConfig) ApplyDefaults() {
 	}
 }
 
+// DiscoveryPoolConfig returns the discovery pool settings with unset values taken from the main pool
+func (d *DatabaseConfig) DiscoveryPoolConfig() PoolConfig {
+	p := d.DiscoveryPool
+	if p.MaxConns <= 0 {
+		p.MaxConns = 10
+	}
+	if p.MinConns <= 0 {
+		p.MinConns = min(d.Pool.MinConns, p.MaxConns)
+	}
+	if p.MaxConnLifetimeMinutes <= 0 {
+		p.MaxConnLifetimeMinutes = d.Pool.MaxConnLifetimeMinutes
+	}
+	if p.MaxConnIdleTimeMinutes <= 0 {
+		p.MaxConnIdleTimeMinutes = d.Pool.MaxConnIdleTimeMinutes
+	}
+	if p.HealthCheckPeriodSeconds <= 0 {
+		p.HealthCheckPeriodSeconds = d.Pool.HealthCheckPeriodSeconds
+	}
+	return p
+}
+
+// ReplicaEnabled reports whether a read replica is configured
+func (d *DatabaseConfig) ReplicaEnabled() bool {
+	return d.Replica.Host != ""
+}
+
+// ReplicaPort returns the replica port, defaulting to the primary's
+func (d *DatabaseConfig) ReplicaPort() int {
+	if d.Replica.Port > 0 {
+		return d.Replica.Port
+	}
+	return d.Port
+}
+
+// ReplicaPoolConfig returns the replica pool settings with unset values taken from the main pool
+func (d *DatabaseConfig) ReplicaPoolConfig() PoolConfig {
+	p := d.Replica.Pool
+	if p.MaxConns <= 0 {
+		p.MaxConns = d.Pool.MaxConns
+	}
+	if p.MinConns <= 0 {
+		p.MinConns = min(d.Pool.MinConns, p.MaxConns)
+	}
+	if p.MaxConnLifetimeMinutes <= 0 {
+		p.MaxConnLifetimeMinutes = d.Pool.MaxConnLifetimeMinutes
+	}
+	if p.MaxConnIdleTimeMinutes <= 0 {
+		p.MaxConnIdleTimeMinutes = d.Pool.MaxConnIdleTimeMinutes
+	}
+	if p.HealthCheckPeriodSeconds <= 0 {
+		p.HealthCheckPeriodSeconds = d.Pool.HealthCheckPeriodSeconds
+	}
+	return p
+}
+
 // MaxConnLifetime returns the max connection lifetime as a duration
 func (p *PoolConfig) MaxConnLifetime() time.Duration {
 	return time.Duration(p.MaxConnLifetimeMinutes) * time.Minute
@@ -307,10 +810,40 @@ func (a *AuthConfig) JWTExpiry() time.Duration {
 	return time.Duration(a.JWTExpiryHours) * time.Hour
 }
 
+// IdleTTL returns how long an unused rate-limit bucket is kept as a duration
+func (r *RateLimitConfig) IdleTTL() time.Duration {
+	return time.Duration(r.IdleTTLSeconds) * time.Second
+}
+
+// Addr returns the host:port the trap listener binds to
+func (t *TrapConfig) Addr() string {
+	port := t.Port
+	if port <= 0 {
+		port = 162
+	}
+	return net.JoinHostPort(t.ListenAddress, strconv.Itoa(port))
+}
+
+// RepollCooldown returns the minimum time between trap-triggered re-polls of one monitor
+func (t *TrapConfig) RepollCooldown() time.Duration {
+	if t.RepollCooldownSeconds <= 0 {
+		return 10 * time.Second
+	}
+	return time.Duration(t.RepollCooldownSeconds) * time.Second
+}
+
 // IsLogLevelValid checks if the log level is valid
 func (l *LoggingConfig) IsLogLevelValid() bool {
 	validLevels := []string{"debug", "info", "warn", "error"}
-	return slices.Contains(validLevels, strings.ToLower(l.Level))
+	if !slices.Contains(validLevels, strings.ToLower(l.Level)) {
+		return false
+	}
+	for _, level := range l.ComponentLevels {
+		if !slices.Contains(validLevels, strings.ToLower(level)) {
+			return false
+		}
+	}
+	return true
 }
 
 // TickInterval returns the tick interval as a duration
@@ -323,19 +856,294 @@ func (s *SchedulerConfig) LivenessTimeout() time.Duration {
 	return time.Duration(s.LivenessTimeoutMS) * time.Millisecond
 }
 
+// SelfTestTimeout returns the startup self-test timeout per plugin as a duration
+func (p *PluginsConfig) SelfTestTimeout() time.Duration {
+	return time.Duration(p.SelfTestTimeoutMS) * time.Millisecond
+}
+
+// GzipMinTasks returns the smallest batch sent gzip-framed, or 0 when compression is off
+func (p *PluginsConfig) GzipMinTasks() int {
+	switch {
+	case p.CompressionMinTasks < 0:
+		return 0
+	case p.CompressionMinTasks == 0:
+		return 100
+	}
+	return p.CompressionMinTasks
+}
+
+// SpawnRetry returns how many times a failed plugin spawn is retried and the first backoff
+func (p *PluginsConfig) SpawnRetry() (int, time.Duration) {
+	retries := p.SpawnRetries
+	switch {
+	case retries < 0:
+		retries = 0
+	case retries == 0:
+		retries = 2
+	}
+	backoff := time.Duration(p.SpawnBackoffMS) * time.Millisecond
+	if backoff <= 0 {
+		backoff = 50 * time.Millisecond
+	}
+	return retries, backoff
+}
+
+// ResourceLimits returns the per-plugin CPU time and memory limits (0 = unlimited)
+func (p *PluginsConfig) ResourceLimits() (time.Duration, int64) {
+	return time.Duration(max(p.CPULimitSeconds, 0)) * time.Second, int64(max(p.MemoryLimitMB, 0)) << 20
+}
+
 // PluginTimeout returns the plugin timeout as a duration
 func (s *SchedulerConfig) PluginTimeout() time.Duration {
 	return time.Duration(s.PluginTimeoutMS) * time.Millisecond
 }
 
+// ArchiveAfter returns how long a monitor may stay down before it is archived
+func (s *SchedulerConfig) ArchiveAfter() time.Duration {
+	return time.Duration(s.ArchiveAfterHours) * time.Hour
+}
+
+// ArchiveInterval returns how often the archive reaper runs as a duration
+func (s *SchedulerConfig) ArchiveInterval() time.Duration {
+	return time.Duration(s.ArchiveIntervalMinutes) * time.Minute
+}
+
+// StateHistoryRetention returns how long state transitions are kept (0 = forever)
+func (s *SchedulerConfig) StateHistoryRetention() time.Duration {
+	switch {
+	case s.StateHistoryRetentionDays < 0:
+		return 0
+	case s.StateHistoryRetentionDays == 0:
+		return 365 * 24 * time.Hour
+	}
+	return time.Duration(s.StateHistoryRetentionDays) * 24 * time.Hour
+}
+
+// CredentialCacheTTL returns how long decrypted credentials stay cached after last use
+func (s *SchedulerConfig) CredentialCacheTTL() time.Duration {
+	if s.CredentialCacheTTLMinutes <= 0 {
+		return 15 * time.Minute
+	}
+	return time.Duration(s.CredentialCacheTTLMinutes) * time.Minute
+}
+
+// StaleAfter returns how many polling intervals without metrics mark a monitor stale
+// (0 = staleness detection disabled)
+func (s *SchedulerConfig) StaleAfter() int {
+	switch {
+	case s.StaleAfterIntervals < 0:
+		return 0
+	case s.StaleAfterIntervals == 0:
+		return 3
+	}
+	return s.StaleAfterIntervals
+}
+
+// InvalidateConcurrency returns how many goroutines apply cache invalidations
+func (s *SchedulerConfig) InvalidateConcurrency() int {
+	if s.InvalidateWorkers <= 0 {
+		return 1
+	}
+	return s.InvalidateWorkers
+}
+
+// PollingIntervalBounds returns the shortest and longest allowed monitor polling interval
+func (s *SchedulerConfig) PollingIntervalBounds() (time.Duration, time.Duration) {
+	lo, hi := 10*time.Second, 24*time.Hour
+	if s.MinPollingIntervalSeconds > 0 {
+		lo = time.Duration(s.MinPollingIntervalSeconds) * time.Second
+	}
+	if s.MaxPollingIntervalSeconds > 0 {
+		hi = time.Duration(s.MaxPollingIntervalSeconds) * time.Second
+	}
+	return lo, max(lo, hi)
+}
+
+// LivenessPoolWorkers returns the batched liveness pool size (0 = fallback)
+func (p *PollerConfig) LivenessPoolWorkers(fallback int) int {
+	if p.LivenessPoolSize <= 0 {
+		return fallback
+	}
+	return p.LivenessPoolSize
+}
+
+// LivenessQueueSize returns how many targets may wait for a pool worker (0 = pool size)
+func (p *PollerConfig) LivenessQueueSize(workers int) int {
+	if p.LivenessBatchSize <= 0 {
+		return workers
+	}
+	return p.LivenessBatchSize
+}
+
+// DuplicateMonitors returns the duplicate monitor policy, "warn" when unset
+func (s *SchedulerConfig) DuplicateMonitors() string {
+	if s.DuplicateMonitorPolicy == "" {
+		return "warn"
+	}
+	return s.DuplicateMonitorPolicy
+}
+
+// LivenessKeepAlive returns the keep-alive period for liveness probes; negative disables it
+func (s *SchedulerConfig) LivenessKeepAlive() time.Duration {
+	return time.Duration(s.LivenessKeepAliveSeconds) * time.Second
+}
+
+// LivenessSource returns the local address liveness probes bind to, or the zero Addr
+func (s *SchedulerConfig) LivenessSource() netip.Addr {
+	addr, err := netip.ParseAddr(s.LivenessSourceAddress)
+	if err != nil {
+		return netip.Addr{}
+	}
+	return addr.Unmap()
+}
+
+// RetentionPeriod returns the metric retention period as a duration
+func (m *MetricsConfig) RetentionPeriod() time.Duration {
+	return time.Duration(m.RetentionDays) * 24 * time.Hour
+}
+
+// RetentionInterval returns how often the retention worker runs as a duration
+func (m *MetricsConfig) RetentionInterval() time.Duration {
+	return time.Duration(m.RetentionIntervalMinutes) * time.Minute
+}
+
+// RollupAfter returns the age after which raw metrics are rolled up as a duration (0 = disabled)
+func (m *MetricsConfig) RollupAfter() time.Duration {
+	return time.Duration(m.RollupAfterHours) * time.Hour
+}
+
+// RollupInterval returns how often the rollup worker runs as a duration
+func (m *MetricsConfig) RollupInterval() time.Duration {
+	return time.Duration(m.RollupIntervalMinutes) * time.Minute
+}
+
+// RollupRetention returns how long hourly rollups are kept (0 = forever)
+func (m *MetricsConfig) RollupRetention() time.Duration {
+	switch {
+	case m.RollupRetentionDays < 0:
+		return 0
+	case m.RollupRetentionDays == 0:
+		return 365 * 24 * time.Hour
+	}
+	return time.Duration(m.RollupRetentionDays) * 24 * time.Hour
+}
+
+// PipelineCheckInterval returns how often the metrics pipeline check runs; 0 disables it
+func (m *MetricsConfig) PipelineCheckInterval() time.Duration {
+	switch {
+	case m.PipelineCheckIntervalSeconds < 0:
+		return 0
+	case m.PipelineCheckIntervalSeconds == 0:
+		return time.Minute
+	}
+	return time.Duration(m.PipelineCheckIntervalSeconds) * time.Second
+}
+
+// MaxMetricAge returns how far a metric's timestamp may be from server time under the
+// "reject" timestamp policy
+func (m *MetricsConfig) MaxMetricAge() time.Duration {
+	if m.MaxMetricAgeMinutes <= 0 {
+		return 5 * time.Minute
+	}
+	return time.Duration(m.MaxMetricAgeMinutes) * time.Minute
+}
+
+// SlowQueryThreshold returns the duration above which metrics queries are logged; 0 disables logging
+func (m *MetricsConfig) SlowQueryThreshold() time.Duration {
+	switch {
+	case m.SlowQueryThresholdMS < 0:
+		return 0
+	case m.SlowQueryThresholdMS == 0:
+		return time.Second
+	}
+	return time.Duration(m.SlowQueryThresholdMS) * time.Millisecond
+}
+
+// ScheduleTickInterval returns the discovery schedule check interval as a duration
+func (d *DiscoveryConfig) ScheduleTickInterval() time.Duration {
+	return time.Duration(d.ScheduleTickSeconds) * time.Second
+}
+
+// IdempotencyTTL returns how long run request idempotency keys are remembered
+func (d *DiscoveryConfig) IdempotencyTTL() time.Duration {
+	if d.IdempotencyTTLSeconds <= 0 {
+		return 5 * time.Minute
+	}
+	return time.Duration(d.IdempotencyTTLSeconds) * time.Second
+}
+
+// CredentialLimit returns how many credential profiles a discovery profile may list
+func (d *DiscoveryConfig) CredentialLimit() int {
+	if d.MaxCredentialsPerProfile <= 0 {
+		return 5
+	}
+	return d.MaxCredentialsPerProfile
+}
+
+// HostKeyCheckInterval returns how often SSH host keys of opted-in monitors are verified
+func (d *DiscoveryConfig) HostKeyCheckInterval() time.Duration {
+	if d.HostKeyCheckIntervalSeconds <= 0 {
+		return time.Hour
+	}
+	return time.Duration(d.HostKeyCheckIntervalSeconds) * time.Second
+}
+
+// RunHistory returns how many finished discovery runs are kept per profile
+func (d *DiscoveryConfig) RunHistory() int {
+	if d.RunHistoryLimit <= 0 {
+		return 50
+	}
+	return d.RunHistoryLimit
+}
+
+// CredentialTestConcurrency returns how many credential test handshakes may run at once
+func (d *DiscoveryConfig) CredentialTestConcurrency() int {
+	if d.CredentialTestWorkers <= 0 {
+		return 10
+	}
+	return d.CredentialTestWorkers
+}
+
+// CredentialTestTimeout returns the deadline of each credential test handshake
+func (d *DiscoveryConfig) CredentialTestTimeout() time.Duration {
+	if d.CredentialTestTimeoutMS > 0 {
+		return time.Duration(d.CredentialTestTimeoutMS) * time.Millisecond
+	}
+	if d.HandshakeTimeoutMS > 0 {
+		return time.Duration(d.HandshakeTimeoutMS) * time.Millisecond
+	}
+	return 5 * time.Second
+}
+
+// SNMPRetryCount returns the default SNMP request retries (unset = 2)
+func (d *DiscoveryConfig) SNMPRetryCount() int {
+	if d.SNMPRetries == nil {
+		return 2
+	}
+	return *d.SNMPRetries
+}
+
+// AutoDetectAttempts returns how many handshakes protocol auto-detection makes per IP
+func (d *DiscoveryConfig) AutoDetectAttempts() int {
+	if d.AutoDetectMaxAttempts <= 0 {
+		return 8
+	}
+	return d.AutoDetectMaxAttempts
+}
+
 // DumpExampleConfig writes an example configuration to the provided writer
 func DumpExampleConfig(w io.Writer) error {
+	snmpRetries := 2
 	example := &Config{
 		Server: ServerConfig{
 			Host:           "0.0.0.0",
 			Port:           8080,
 			ReadTimeoutMS:  30000,
 			WriteTimeoutMS: 30000,
+
+			ShutdownTimeoutMS: 30000,
+			MaxBodyBytes:      1 << 20,
+			BulkMaxBodyBytes:  16 << 20,
 		},
 		TLS: TLSConfig{
 			Enabled:  false,
@@ -363,6 +1171,18 @@ func DumpExampleConfig(w io.Writer) error {
 				MaxConnIdleTimeMinutes:   20,
 				HealthCheckPeriodSeconds: 45,
 			},
+			DiscoveryPool: PoolConfig{
+				MaxConns:                 10,
+				MinConns:                 2,
+				MaxConnLifetimeMinutes:   90,
+				MaxConnIdleTimeMinutes:   20,
+				HealthCheckPeriodSeconds: 45,
+			},
+			QueryTimeoutMS: 5000,
+			WriteTimeoutMS: 20000,
+
+			BreakerFailureThreshold: 5,
+			BreakerCooldownSeconds:  30,
 		},
 		Auth: AuthConfig{
 			AdminUsername:  "admin",
@@ -387,6 +1207,23 @@ func DumpExampleConfig(w io.Writer) error {
 			LivenessTimeoutMS: 2000,
 			PluginTimeoutMS:   60000,
 			DownThreshold:     3,
+			LivenessMethod:    "tcp",
+			ProtocolLivenessMethods: map[string]string{
+				"snmp-v1":  "icmp",
+				"snmp-v2c": "icmp",
+				"snmp-v3":  "icmp",
+			},
+			ArchiveAfterHours:         168,
+			ArchiveIntervalMinutes:    60,
+			StateHistoryRetentionDays: 365,
+			CredentialCacheTTLMinutes: 15,
+			MinPollingIntervalSeconds: 10,
+			MaxPollingIntervalSeconds: 86400,
+			InitialPollDelay:          "immediate",
+			MaxInFlightPolls:          5000,
+			DuplicateMonitorPolicy:    "warn",
+			StaleAfterIntervals:       3,
+			InvalidateWorkers:         1,
 		},
 		Metrics: MetricsConfig{
 			BatchSize:             100,
@@ -394,16 +1231,73 @@ func DumpExampleConfig(w io.Writer) error {
 			RetentionDays:         90,
 			CompressionAfterHours: 1,
 			MaxBufferSize:         10000,
-			MaxMetricAgeMinutes:   5,
+
+			TimestampPolicy:     "plugin",
+			MaxMetricAgeMinutes: 5,
+
+			RetentionBatchSize:       10000,
+			RetentionIntervalMinutes: 60,
+
+			RollupIntervalMinutes: 15,
+			RollupRetentionDays:   365,
+
+			PipelineCheckIntervalSeconds: 60,
+
+			NonFinitePolicy: "drop",
+
+			SlowQueryThresholdMS: 1000,
 		},
 		Discovery: DiscoveryConfig{
 			MaxDiscoveryWorkers:  100,
 			DefaultPortTimeoutMS: 1000,
 			HandshakeTimeoutMS:   5000,
+
+			ScheduleTickSeconds:        30,
+			MinScheduleIntervalSeconds: 300,
+
+			ProvisionWorkers: 4,
+
+			SNMPRetries:   &snmpRetries,
+			SNMPTimeoutMS: 2000,
+
+			SkipIPv6SubnetRouter: true,
+
+			MaxTargets: 65536,
+
+			IdempotencyTTLSeconds: 300,
+
+			MaxCredentialsPerProfile: 5,
+
+			HostKeyCheckIntervalSeconds: 3600,
+
+			ProtocolHandshakeLimits: map[string]int{
+				"snmp-v1":       200,
+				"snmp-v2c":      200,
+				"snmp-v3":       200,
+				"ssh":           50,
+				"windows-winrm": 50,
+			},
+
+			RunHistoryLimit: 50,
+
+			CredentialTestWorkers:   10,
+			CredentialTestTimeoutMS: 5000,
+
+			AutoDetectProtocols:   false,
+			AutoDetectMaxAttempts: 8,
 		},
 		Plugins: PluginsConfig{
 			Directory:           "./plugin_bins/",
 			ScanIntervalSeconds: 60,
+			MaxOutputBytes:      16 << 20,
+			SelfTest:            true,
+			SelfTestTimeoutMS:   5000,
+			CompressionMinTasks: 100,
+			SpawnRetries:        2,
+			SpawnBackoffMS:      50,
+			CPULimitSeconds:     0,
+			MemoryLimitMB:       0,
+			DisableDaemons:      false,
 		},
 		Channel: EventBusConfig{
 			PollJobsChannelSize:        100,
@@ -412,12 +1306,46 @@ func DumpExampleConfig(w io.Writer) error {
 			StateSignalChannelSize:     50,
 			DiscoveryEventsChannelSize: 50,
 			DeviceValidatedChannelSize: 100,
+
+			SlowConsumerHighWaterPercent: 80,
+			SlowConsumerSustainSeconds:   30,
+			SlowConsumerSampleIntervalMS: 1000,
+
+			RecordDroppedEvents:     false,
+			DroppedEventsBufferSize: 100,
 		},
 		Logging: LoggingConfig{
 			Level:    "info",
 			Format:   "json",
 			Output:   "stdout",
 			FilePath: "/var/log/nms/nms.log",
+
+			MaxSizeMB:  100,
+			MaxBackups: 5,
+			MaxAgeDays: 30,
+
+			DebugSampleEvery: 1,
+
+			AccessLog: AccessLogConfig{
+				Level:     "info",
+				SkipPaths: []string{"/health", "/metrics"},
+			},
+		},
+		RateLimit: RateLimitConfig{
+			Enabled:           true,
+			RequestsPerSecond: 20,
+			Burst:             40,
+			IdleTTLSeconds:    600,
+			Routes: []RouteLimitEntry{
+				{Method: "POST", Path: "/api/v1/metrics/query", RequestsPerSecond: 2, Burst: 5},
+				{Method: "POST", Path: "/api/v1/login", RequestsPerSecond: 0.2, Burst: 5},
+			},
+		},
+		Traps: TrapConfig{
+			Enabled:               false,
+			ListenAddress:         "0.0.0.0",
+			Port:                  162,
+			RepollCooldownSeconds: 10,
 		},
 	}
 
@@ -469,7 +1397,13 @@ func DumpExampleConfig(w io.Writer) error {
 # 2. Database:
 #    - Ensure PostgreSQL is running and accessible
 #    - Create the database before starting the application
-#    - Configure connection pools based on your workload
+#    - Configure connection pools based on your workload; the scheduler, API and
+#      metrics writes share "pool", discovery and provisioning use "discovery_pool"
+#    - Keep pool.max_conns + discovery_pool.max_conns below PostgreSQL's max_connections
+#    - discovery_pool writes one validated device at a time, so 5-10 connections
+#      are enough; raise it only if large provisioning bursts queue on the pool
+#    - Set replica.host to send metrics and history reads to a read replica; they
+#      retry on the primary when the replica is unreachable
 #
 # 3. Performance:
 #    - Adjust worker pool sizes based on your hardware
@@ -538,38 +1472,77 @@ func SetGlobalConfigForTests(cfg *Config) {
 	globalConfig = cfg
 }
 
-// InitLogger initializes the global logger based on configuration
-func InitLogger(cfg LoggingConfig) *slog.Logger {
-	var handler slog.Handler
-
-	// Set log level
-	var level slog.Level
-	switch cfg.Level {
+// ParseLogLevel maps a config level name to a slog.Level, defaulting to info
+func ParseLogLevel(name string) slog.Level {
+	switch name {
 	case "debug":
-		level = slog.LevelDebug
+		return slog.LevelDebug
 	case "info":
-		level = slog.LevelInfo
+		return slog.LevelInfo
 	case "warn":
-		level = slog.LevelWarn
+		return slog.LevelWarn
 	case "error":
-		level = slog.LevelError
+		return slog.LevelError
 	default:
-		level = slog.LevelInfo
+		return slog.LevelInfo
 	}
+}
 
+// InitLogger initializes the global logger based on configuration.
+// It fails if file output is configured and the log file cannot be opened for writing.
+func InitLogger(cfg LoggingConfig) (*slog.Logger, error) {
+	var handler slog.Handler
+
+	level := ParseLogLevel(strings.ToLower(cfg.Level))
 	opts := &slog.HandlerOptions{
-		Level: level,
+		Level: minLevel(level, cfg.ComponentLevels),
+	}
+
+	out, err := logOutput(cfg)
+	if err != nil {
+		return nil, err
 	}
 
 	// Set format
 	if cfg.Format == "json" {
-		handler = slog.NewJSONHandler(os.Stdout, opts)
+		handler = slog.NewJSONHandler(out, opts)
 	} else {
-		handler = slog.NewTextHandler(os.Stdout, opts)
+		handler = slog.NewTextHandler(out, opts)
 	}
+	handler = NewComponentLevelHandler(handler, level, cfg.ComponentLevels)
 
 	logger := slog.New(handler)
 	slog.SetDefault(logger)
 
-	return logger
+	return logger, nil
+}
+
+// logOutput returns the writer for the configured output ("stdout" when empty)
+func logOutput(cfg LoggingConfig) (io.Writer, error) {
+	output := strings.ToLower(cfg.Output)
+	switch output {
+	case "", "stdout":
+		return os.Stdout, nil
+	case "file", "both":
+	default:
+		return nil, fmt.Errorf("invalid logging output %q (want stdout, file or both)", cfg.Output)
+	}
+
+	if cfg.FilePath == "" {
+		return nil, fmt.Errorf("logging file_path is required for %s output", output)
+	}
+	maxSizeMB := cfg.MaxSizeMB
+	if maxSizeMB <= 0 {
+		maxSizeMB = 100
+	}
+	file, err := openRotatingFile(cfg.FilePath, int64(maxSizeMB)<<20, cfg.MaxBackups,
+		time.Duration(cfg.MaxAgeDays)*24*time.Hour)
+	if err != nil {
+		return nil, err
+	}
+
+	if output == "both" {
+		return io.MultiWriter(os.Stdout, file), nil
+	}
+	return file, nil
 }
@@ -0,0 +1,131 @@
+package globals
+
+import (
+	"sync"
+	"time"
+)
+
+// Event channel names, as reported in ChannelStats and DroppedEvent
+const (
+	ChannelDiscoveryRequest  = "discovery_request"
+	ChannelDiscoveryStatus   = "discovery_status"
+	ChannelDeviceValidated   = "device_validated"
+	ChannelDiscoveryProgress = "discovery_progress"
+	ChannelMonitorState      = "monitor_state"
+	ChannelHostKeyChanged    = "host_key_changed"
+	ChannelCacheInvalidate   = "cache_invalidate"
+	ChannelPollNow           = "poll_now"
+)
+
+// Reasons an event is dropped
+const (
+	DropChannelFull    = "channel_full"
+	DropTimeout        = "timeout"         // the producer gave up waiting for room
+	DropSubscriberFull = "subscriber_full" // a stream subscriber's buffer; the channel is the event type
+)
+
+// DroppedEvent is an event a producer could not deliver
+type DroppedEvent struct {
+	Channel   string    `json:"channel"`
+	Reason    string    `json:"reason"`
+	DroppedAt time.Time `json:"dropped_at"`
+	// Event is the payload, with credential and target ciphertext left out
+	Event any `json:"event"`
+}
+
+// dropRecorder counts dropped events per channel and, when enabled, keeps the last
+// size of them in a ring buffer. The zero value counts only.
+type dropRecorder struct {
+	mu     sync.Mutex
+	size   int
+	ring   []DroppedEvent
+	next   int // ring index the next event is written to once the ring is full
+	counts map[string]int64
+}
+
+// RecordDropped notes that event was dropped from the named channel. Producers call it
+// wherever they give up on a send; it never blocks on the channel.
+func (ec *EventChannels) RecordDropped(channel, reason string, event any) {
+	r := &ec.drops
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.counts == nil {
+		r.counts = make(map[string]int64)
+	}
+	r.counts[channel]++
+	if r.size <= 0 {
+		return
+	}
+
+	dropped := DroppedEvent{Channel: channel, Reason: reason, DroppedAt: time.Now(), Event: droppedPayload(event)}
+	if len(r.ring) < r.size {
+		r.ring = append(r.ring, dropped)
+		return
+	}
+	r.ring[r.next] = dropped
+	r.next = (r.next + 1) % r.size
+}
+
+// DroppedEvents returns the recorded dropped events, oldest first, and whether recording
+// is enabled (channel.record_dropped_events)
+func (ec *EventChannels) DroppedEvents() ([]DroppedEvent, bool) {
+	r := &ec.drops
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	events := make([]DroppedEvent, 0, len(r.ring))
+	events = append(events, r.ring[r.next:]...)
+	events = append(events, r.ring[:r.next]...)
+	return events, r.size > 0
+}
+
+// droppedCount returns how many events the named channel has dropped since startup
+func (r *dropRecorder) droppedCount(channel string) int64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.counts[channel]
+}
+
+// droppedDevice is the recorded form of a DeviceValidatedEvent, without the profiles'
+// encrypted target and credential payloads
+type droppedDevice struct {
+	DiscoveryProfileID  int64  `json:"discovery_profile_id"`
+	CredentialProfileID int64  `json:"credential_profile_id"`
+	Protocol            string `json:"protocol"`
+	JobID               int64  `json:"job_id,omitempty"`
+	IP                  string `json:"ip"`
+	Port                int    `json:"port"`
+	Hostname            string `json:"hostname,omitempty"`
+}
+
+// droppedInvalidate is the recorded form of a CacheInvalidateEvent, without the monitor
+// rows and their credential payloads
+type droppedInvalidate struct {
+	UpdateType string  `json:"update_type"`
+	MonitorIDs []int64 `json:"monitor_ids"`
+	Seq        uint64  `json:"seq,omitempty"`
+}
+
+// droppedPayload returns what is kept of a dropped event
+func droppedPayload(event any) any {
+	switch e := event.(type) {
+	case DeviceValidatedEvent:
+		return droppedDevice{
+			DiscoveryProfileID:  e.DiscoveryProfile.ID,
+			CredentialProfileID: e.CredentialProfile.ID,
+			Protocol:            e.Protocol,
+			JobID:               e.JobID,
+			IP:                  e.IP,
+			Port:                e.Port,
+			Hostname:            e.Hostname,
+		}
+	case CacheInvalidateEvent:
+		ids := append([]int64(nil), e.MonitorIDs...)
+		for _, row := range e.Monitors {
+			ids = append(ids, row.ID)
+		}
+		return droppedInvalidate{UpdateType: e.UpdateType, MonitorIDs: ids, Seq: e.Seq}
+	}
+	return event
+}
@@ -0,0 +1,145 @@
+package globals
+
+import (
+	"encoding/json"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/nmslite/nmslite/internal/database/dbgen"
+)
+
+func TestDroppedEventRecorder(t *testing.T) {
+	testCases := []struct {
+		name       string
+		channel    EventBusConfig
+		drops      int
+		wantEvents []int64 // monitor IDs of the recorded events, oldest first
+	}{
+		{"Disabled counts only", EventBusConfig{DroppedEventsBufferSize: 3}, 5, nil},
+		{"Fewer drops than the buffer", EventBusConfig{RecordDroppedEvents: true, DroppedEventsBufferSize: 3}, 2, []int64{0, 1}},
+		{"Oldest replaced once full", EventBusConfig{RecordDroppedEvents: true, DroppedEventsBufferSize: 3}, 5, []int64{2, 3, 4}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			SetGlobalConfigForTests(&Config{Channel: tc.channel})
+			ec := NewEventChannels()
+
+			for i := range tc.drops {
+				ec.RecordDropped(ChannelMonitorState, DropChannelFull, MonitorStateEvent{MonitorID: int64(i), EventType: "down"})
+			}
+
+			events, enabled := ec.DroppedEvents()
+			if enabled != tc.channel.RecordDroppedEvents {
+				t.Errorf("Expected enabled=%v, got %v", tc.channel.RecordDroppedEvents, enabled)
+			}
+			if len(events) != len(tc.wantEvents) {
+				t.Fatalf("Expected %d recorded events, got %d", len(tc.wantEvents), len(events))
+			}
+			for i, e := range events {
+				state, ok := e.Event.(MonitorStateEvent)
+				if !ok || state.MonitorID != tc.wantEvents[i] {
+					t.Errorf("Event %d: expected monitor %d, got %+v", i, tc.wantEvents[i], e.Event)
+				}
+				if e.Channel != ChannelMonitorState || e.Reason != DropChannelFull || e.DroppedAt.IsZero() {
+					t.Errorf("Event %d: expected channel, reason and time, got %+v", i, e)
+				}
+			}
+
+			for _, c := range ec.ChannelStats() {
+				want := int64(0)
+				if c.Name == ChannelMonitorState {
+					want = int64(tc.drops)
+				}
+				if c.Dropped != want {
+					t.Errorf("%s: expected %d dropped, got %d", c.Name, want, c.Dropped)
+				}
+			}
+		})
+	}
+}
+
+func TestFanOutRecordsSubscriberDrops(t *testing.T) {
+	SetGlobalConfigForTests(&Config{Channel: EventBusConfig{RecordDroppedEvents: true, DroppedEventsBufferSize: 3}})
+	ec := NewEventChannels()
+	events, cancel := ec.Subscribe(1, StreamMonitorState)
+	defer cancel()
+
+	for i := range 3 {
+		ec.publish(StreamEvent{Type: StreamMonitorState, Data: MonitorStateEvent{MonitorID: int64(i)}})
+	}
+
+	if got := len(events); got != 1 {
+		t.Errorf("Expected 1 delivered event, got %d", got)
+	}
+	dropped, _ := ec.DroppedEvents()
+	if len(dropped) != 2 {
+		t.Fatalf("Expected 2 recorded drops, got %d", len(dropped))
+	}
+	for _, e := range dropped {
+		if e.Channel != ChannelMonitorState || e.Reason != DropSubscriberFull {
+			t.Errorf("Expected a subscriber drop on %s, got %+v", ChannelMonitorState, e)
+		}
+	}
+}
+
+func TestDroppedEventRedaction(t *testing.T) {
+	SetGlobalConfigForTests(&Config{Channel: EventBusConfig{RecordDroppedEvents: true}})
+	ec := NewEventChannels()
+
+	ec.RecordDropped(ChannelDeviceValidated, DropChannelFull, DeviceValidatedEvent{
+		DiscoveryProfile:  dbgen.DiscoveryProfile{ID: 3, TargetValue: "ciphertext-target"},
+		CredentialProfile: dbgen.CredentialProfile{ID: 7, Payload: []byte(`"ciphertext-credential"`)},
+		Protocol:          "ssh",
+		IP:                "192.0.2.1",
+		Port:              22,
+	})
+	ec.RecordDropped(ChannelCacheInvalidate, DropTimeout, CacheInvalidateEvent{
+		UpdateType: "update",
+		Monitors:   []dbgen.GetMonitorWithCredentialsRow{{ID: 9, Payload: []byte(`"ciphertext-credential"`)}},
+		Seq:        4,
+	})
+
+	events, _ := ec.DroppedEvents()
+	body, err := json.Marshal(events)
+	if err != nil {
+		t.Fatalf("Failed to encode dropped events: %v", err)
+	}
+	if strings.Contains(string(body), "ciphertext") {
+		t.Errorf("Expected encrypted payloads to be left out, got %s", body)
+	}
+	for _, want := range []string{`"credential_profile_id":7`, `"ip":"192.0.2.1"`, `"monitor_ids":[9]`, `"reason":"timeout"`} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("Expected %s in %s", want, body)
+		}
+	}
+}
+
+func TestDroppedEventRecorderConcurrent(t *testing.T) {
+	SetGlobalConfigForTests(&Config{Channel: EventBusConfig{RecordDroppedEvents: true, DroppedEventsBufferSize: 10}})
+	ec := NewEventChannels()
+
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 100 {
+				ec.RecordDropped(ChannelPollNow, DropChannelFull, PollNowEvent{Reason: "snmp_trap"})
+				ec.DroppedEvents()
+			}
+		}()
+	}
+	wg.Wait()
+
+	events, _ := ec.DroppedEvents()
+	if len(events) != 10 {
+		t.Errorf("Expected the buffer to hold 10 events, got %d", len(events))
+	}
+	for _, c := range ec.ChannelStats() {
+		if c.Name == ChannelPollNow && c.Dropped != 800 {
+			t.Errorf("Expected 800 dropped, got %d", c.Dropped)
+		}
+	}
+}
@@ -2,6 +2,7 @@
 package globals
 
 import (
+	"sync/atomic"
 	"time"
 
 	"github.com/nmslite/nmslite/internal/api/auth"
@@ -11,17 +12,51 @@ import (
 
 // PluginInfo represents a loaded plugin with its metadata and runtime path
 type PluginInfo struct {
-	Name       string `json:"name"`
-	Protocol   string `json:"protocol"`
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Version     string `json:"version,omitempty"`
+	Protocol    string `json:"protocol"`
+	DefaultPort int    `json:"default_port,omitempty"`
+	// Collectors lists the metric groups a monitor may select; empty means the plugin
+	// does not support selection and always collects everything
+	Collectors []string `json:"collectors,omitempty"`
+	// Compression is the stdin/stdout framing the plugin can read and write besides
+	// plain JSON: "gzip" or empty
+	Compression string `json:"compression,omitempty"`
+	// Daemon marks a plugin that can stay running and take batches as JSON lines on
+	// stdin (see docs/plugin-daemon-protocol.md) instead of being spawned per batch
+	Daemon     bool   `json:"daemon,omitempty"`
 	BinaryPath string `json:"-"`
 }
 
+// PluginStats summarizes a plugin's executions since startup
+type PluginStats struct {
+	Protocol    string `json:"protocol"`
+	Invocations int64  `json:"invocations"`
+	Successes   int64  `json:"successes"`
+	Failures    int64  `json:"failures"`
+	Timeouts    int64  `json:"timeouts"`
+	// LimitKills counts executions killed for exceeding plugins.cpu_limit_seconds or memory_limit_mb
+	LimitKills int64 `json:"limit_kills"`
+	// DaemonRestarts counts daemon-mode plugin processes restarted after exiting
+	DaemonRestarts   int64           `json:"daemon_restarts,omitempty"`
+	AvgLatencyMS     float64         `json:"avg_latency_ms"`
+	LatencyHistogram []LatencyBucket `json:"latency_histogram"`
+}
+
+// LatencyBucket is a cumulative histogram bucket: executions that took at most LE
+type LatencyBucket struct {
+	LE    string `json:"le"` // upper bound, e.g. "500ms" or "+Inf"
+	Count int64  `json:"count"`
+}
+
 // PollTask represents a single polling task
 type PollTask struct {
 	RequestID   string           `json:"request_id"`
 	Target      string           `json:"target"`
 	Port        int              `json:"port"`
 	Credentials auth.Credentials `json:"credentials"`
+	Collectors  []string         `json:"collectors,omitempty"` // empty runs every collector
 }
 
 // PollResult represents polling result
@@ -37,17 +72,29 @@ type PollResult struct {
 // DiscoveryRequestEvent is published when a discovery begins execution
 type DiscoveryRequestEvent struct {
 	ProfileID int64
+	JobID     int64 // discovery_jobs row tracking this run; 0 lets the worker create one
 	StartedAt time.Time
 }
 
 // DiscoveryStatusEvent is published when a discovery finishes
 // DiscoveryStatusEvent is published when a discovery finishes
 type DiscoveryStatusEvent struct {
-	ProfileID    int64
-	Status       string // "success", "partial", "failed"
-	DevicesFound int
-	StartedAt    time.Time
-	CompletedAt  time.Time
+	ProfileID    int64     `json:"profile_id"`
+	JobID        int64     `json:"job_id,omitempty"`
+	Status       string    `json:"status"` // "success", "partial", "failed"
+	DevicesFound int       `json:"devices_found"`
+	StartedAt    time.Time `json:"started_at"`
+	CompletedAt  time.Time `json:"completed_at"`
+}
+
+// DiscoveryProgressEvent is published periodically while a discovery validates its targets
+type DiscoveryProgressEvent struct {
+	ProfileID int64     `json:"profile_id"`
+	JobID     int64     `json:"job_id,omitempty"`
+	Processed int       `json:"processed"`
+	Total     int       `json:"total"`
+	Validated int       `json:"validated"`
+	Timestamp time.Time `json:"timestamp"`
 }
 
 // DeviceValidatedEvent - published when protocol handshake succeeds
@@ -55,19 +102,45 @@ type DeviceValidatedEvent struct {
 	DiscoveryProfile  dbgen.DiscoveryProfile
 	CredentialProfile dbgen.CredentialProfile
 	Plugin            *PluginInfo
-	IP                string
-	Port              int
-	Hostname          string
+	// Protocol is the protocol the handshake succeeded on; with auto-detection it may
+	// differ from CredentialProfile.Protocol
+	Protocol string
+	// JobID is the discovery run that validated the device (0 when untracked)
+	JobID    int64
+	IP       string
+	Port     int
+	Hostname string
+	// Recorded, when set, is called once with the outcome of recording the device:
+	// nil after its discovered_devices row is committed
+	Recorded func(err error)
 }
 
 // MonitorStateEvent is published when a monitor state changes
 // MonitorStateEvent is published when a monitor state changes
 type MonitorStateEvent struct {
-	MonitorID int64
-	IP        string
-	EventType string // "down", "recovered"
-	Failures  int    // only used when EventType == "down"
-	Timestamp time.Time
+	MonitorID int64     `json:"monitor_id"`
+	IP        string    `json:"ip"`
+	EventType string    `json:"event_type"`         // "down", "recovered", "degraded", "stale", "fresh", "archived"
+	Failures  int       `json:"failures,omitempty"` // consecutive failures for "down" and "degraded"
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// HostKeyChangedEvent is a security alert: a monitored device presented an SSH host key
+// other than the one trusted for it (a rebuild, or possibly an impersonating host)
+type HostKeyChangedEvent struct {
+	MonitorID           int64     `json:"monitor_id"`
+	IP                  string    `json:"ip"`
+	Port                int       `json:"port"`
+	KnownFingerprint    string    `json:"known_fingerprint"`
+	ObservedFingerprint string    `json:"observed_fingerprint"`
+	Timestamp           time.Time `json:"timestamp"`
+}
+
+// PollNowEvent asks the scheduler to poll monitors immediately instead of waiting for
+// their next interval (e.g. after an SNMP linkDown trap)
+type PollNowEvent struct {
+	MonitorIDs []int64 `json:"monitor_ids"`
+	Reason     string  `json:"reason"` // e.g. "snmp_trap"
 }
 
 // CacheInvalidateEvent signals cache entries need refresh
@@ -76,6 +149,19 @@ type CacheInvalidateEvent struct {
 	UpdateType string                               // "update", "delete"
 	Monitors   []dbgen.GetMonitorWithCredentialsRow // For "update"
 	MonitorIDs []int64                              // For "delete"
+	// Seq orders events for the same monitor (from NextCacheInvalidateSeq; 0 = unordered).
+	// The scheduler ignores an event older than one it already applied for that monitor.
+	Seq uint64
+}
+
+// cacheInvalidateSeq is the last sequence number handed out by NextCacheInvalidateSeq
+var cacheInvalidateSeq atomic.Uint64
+
+// NextCacheInvalidateSeq returns a new CacheInvalidateEvent sequence number. Take it
+// before reading the rows an "update" carries and after committing a "delete", so an
+// update read before a delete always sorts before it.
+func NextCacheInvalidateSeq() uint64 {
+	return cacheInvalidateSeq.Add(1)
 }
 
 // EventChannels provides typed channels for all system events
@@ -85,12 +171,30 @@ type EventChannels struct {
 	DiscoveryStatus  chan DiscoveryStatusEvent
 	DeviceValidated  chan DeviceValidatedEvent
 
+	// DiscoveryProgress carries per-run progress, consumed by the fan-out only
+	DiscoveryProgress chan DiscoveryProgressEvent
+
 	// Monitor state events
 	MonitorState chan MonitorStateEvent
 
+	// Security events
+	HostKeyChanged chan HostKeyChangedEvent
+
 	// Cache events
 	CacheInvalidate chan CacheInvalidateEvent
 
+	// Scheduler signals
+	PollNow chan PollNowEvent
+
+	// Subscribers fed by RunFanOut
+	fanOut fanOut
+
+	// Fill samples taken by RunSlowConsumerWatch
+	watch channelWatch
+
+	// Events producers could not deliver, see RecordDropped
+	drops dropRecorder
+
 	// Graceful shutdown
 	done chan struct{}
 }
@@ -105,12 +209,16 @@ func NewEventChannels() *EventChannels {
 	}
 
 	return &EventChannels{
-		DiscoveryRequest: make(chan DiscoveryRequestEvent, discoverySize),
-		DiscoveryStatus:  make(chan DiscoveryStatusEvent, discoverySize),
-		DeviceValidated:  make(chan DeviceValidatedEvent, discoverySize),
-		MonitorState:     make(chan MonitorStateEvent, cfg.StateSignalChannelSize),
-		CacheInvalidate:  make(chan CacheInvalidateEvent, cfg.CacheEventsChannelSize),
-		done:             make(chan struct{}),
+		DiscoveryRequest:  make(chan DiscoveryRequestEvent, discoverySize),
+		DiscoveryStatus:   make(chan DiscoveryStatusEvent, discoverySize),
+		DeviceValidated:   make(chan DeviceValidatedEvent, discoverySize),
+		DiscoveryProgress: make(chan DiscoveryProgressEvent, discoverySize),
+		MonitorState:      make(chan MonitorStateEvent, cfg.StateSignalChannelSize),
+		HostKeyChanged:    make(chan HostKeyChangedEvent, discoverySize),
+		CacheInvalidate:   make(chan CacheInvalidateEvent, cfg.CacheEventsChannelSize),
+		PollNow:           make(chan PollNowEvent, discoverySize),
+		drops:             dropRecorder{size: cfg.DroppedEventsBuffer()},
+		done:              make(chan struct{}),
 	}
 }
 
@@ -122,8 +230,11 @@ func (ec *EventChannels) Close() error {
 	close(ec.DiscoveryRequest)
 	close(ec.DiscoveryStatus)
 	close(ec.DeviceValidated)
+	close(ec.DiscoveryProgress)
 	close(ec.MonitorState)
+	close(ec.HostKeyChanged)
 	close(ec.CacheInvalidate)
+	close(ec.PollNow)
 
 	return nil
 }
@@ -0,0 +1,156 @@
+package globals
+
+import (
+	"context"
+	"sync"
+)
+
+// Stream event types delivered to fan-out subscribers
+const (
+	StreamMonitorState      = "monitor_state"
+	StreamDiscoveryStatus   = "discovery_status"
+	StreamDiscoveryProgress = "discovery_progress"
+	StreamHostKeyChanged    = "host_key_changed"
+)
+
+// StreamEventTypes lists every event type a subscriber can filter on
+var StreamEventTypes = []string{StreamMonitorState, StreamDiscoveryStatus, StreamDiscoveryProgress, StreamHostKeyChanged}
+
+// StreamEvent is a single event delivered to a fan-out subscriber
+type StreamEvent struct {
+	Type string
+	Data any
+}
+
+// subscriber receives events of the listed types (all types when empty)
+type subscriber struct {
+	ch    chan StreamEvent
+	types map[string]bool
+}
+
+// fanOut copies state events to any number of subscribers.
+// The zero value is ready to use.
+type fanOut struct {
+	mu     sync.RWMutex
+	subs   map[uint64]*subscriber
+	nextID uint64
+	closed bool
+}
+
+// Subscribe registers a subscriber for the given event types (all types when none are given).
+// The returned channel is closed by the cancel func or when the fan-out stops.
+// Delivery is best-effort: events are dropped while the subscriber's buffer is full.
+func (ec *EventChannels) Subscribe(buffer int, types ...string) (<-chan StreamEvent, func()) {
+	if buffer <= 0 {
+		buffer = 64
+	}
+	sub := &subscriber{ch: make(chan StreamEvent, buffer)}
+	if len(types) > 0 {
+		sub.types = make(map[string]bool, len(types))
+		for _, t := range types {
+			sub.types[t] = true
+		}
+	}
+
+	f := &ec.fanOut
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.closed {
+		close(sub.ch)
+		return sub.ch, func() {}
+	}
+	if f.subs == nil {
+		f.subs = make(map[uint64]*subscriber)
+	}
+	id := f.nextID
+	f.nextID++
+	f.subs[id] = sub
+
+	var once sync.Once
+	return sub.ch, func() {
+		once.Do(func() {
+			f.mu.Lock()
+			defer f.mu.Unlock()
+			if _, ok := f.subs[id]; ok {
+				delete(f.subs, id)
+				close(sub.ch)
+			}
+		})
+	}
+}
+
+// RunFanOut consumes the MonitorState, DiscoveryStatus, DiscoveryProgress and HostKeyChanged
+// channels and publishes each event to matching subscribers. It must be the only consumer of
+// those channels. All subscriber channels are closed when it returns.
+func (ec *EventChannels) RunFanOut(ctx context.Context) error {
+	defer ec.fanOut.closeAll()
+
+	monitorState, discoveryStatus, discoveryProgress := ec.MonitorState, ec.DiscoveryStatus, ec.DiscoveryProgress
+	hostKeyChanged := ec.HostKeyChanged
+	for monitorState != nil || discoveryStatus != nil || discoveryProgress != nil || hostKeyChanged != nil {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ec.Done():
+			return nil
+		case event, ok := <-monitorState:
+			if !ok {
+				monitorState = nil
+				continue
+			}
+			ec.publish(StreamEvent{Type: StreamMonitorState, Data: event})
+		case event, ok := <-discoveryStatus:
+			if !ok {
+				discoveryStatus = nil
+				continue
+			}
+			ec.publish(StreamEvent{Type: StreamDiscoveryStatus, Data: event})
+		case event, ok := <-discoveryProgress:
+			if !ok {
+				discoveryProgress = nil
+				continue
+			}
+			ec.publish(StreamEvent{Type: StreamDiscoveryProgress, Data: event})
+		case event, ok := <-hostKeyChanged:
+			if !ok {
+				hostKeyChanged = nil
+				continue
+			}
+			ec.publish(StreamEvent{Type: StreamHostKeyChanged, Data: event})
+		}
+	}
+	return nil
+}
+
+// publish delivers an event to every matching subscriber without blocking. An event a
+// subscriber has no room for is recorded as dropped from the channel it came from.
+func (ec *EventChannels) publish(event StreamEvent) {
+	f := &ec.fanOut
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	for _, sub := range f.subs {
+		if sub.types != nil && !sub.types[event.Type] {
+			continue
+		}
+		select {
+		case sub.ch <- event:
+		default:
+			// Slow subscriber, drop rather than stall the producers
+			ec.RecordDropped(event.Type, DropSubscriberFull, event.Data)
+		}
+	}
+}
+
+// closeAll closes every subscriber channel and rejects new subscriptions
+func (f *fanOut) closeAll() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.closed = true
+	for id, sub := range f.subs {
+		delete(f.subs, id)
+		close(sub.ch)
+	}
+}
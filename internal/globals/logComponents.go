@@ -0,0 +1,63 @@
+package globals
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+)
+
+// componentLevelHandler filters records by the level configured for the logger's
+// "component" attribute, falling back to the global level. The component must be set
+// with Logger.With; a component passed as a per-call attribute is not consulted.
+type componentLevelHandler struct {
+	next   slog.Handler
+	levels map[string]slog.Level
+	level  slog.Level // effective level for this handler's component
+}
+
+// NewComponentLevelHandler wraps next so each component logs at its own level.
+// next must accept every level that any component may use (see minLevel).
+func NewComponentLevelHandler(next slog.Handler, global slog.Level, components map[string]string) slog.Handler {
+	if len(components) == 0 {
+		return next
+	}
+	levels := make(map[string]slog.Level, len(components))
+	for name, level := range components {
+		levels[strings.ToLower(name)] = ParseLogLevel(strings.ToLower(level))
+	}
+	return &componentLevelHandler{next: next, levels: levels, level: global}
+}
+
+// minLevel is the most verbose of the global and component levels
+func minLevel(global slog.Level, components map[string]string) slog.Level {
+	lowest := global
+	for _, level := range components {
+		lowest = min(lowest, ParseLogLevel(strings.ToLower(level)))
+	}
+	return lowest
+}
+
+func (h *componentLevelHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return level >= h.level && h.next.Enabled(ctx, level)
+}
+
+func (h *componentLevelHandler) Handle(ctx context.Context, r slog.Record) error {
+	return h.next.Handle(ctx, r)
+}
+
+func (h *componentLevelHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	level := h.level
+	for _, a := range attrs {
+		if a.Key != "component" {
+			continue
+		}
+		if l, ok := h.levels[strings.ToLower(a.Value.String())]; ok {
+			level = l
+		}
+	}
+	return &componentLevelHandler{next: h.next.WithAttrs(attrs), levels: h.levels, level: level}
+}
+
+func (h *componentLevelHandler) WithGroup(name string) slog.Handler {
+	return &componentLevelHandler{next: h.next.WithGroup(name), levels: h.levels, level: h.level}
+}
@@ -0,0 +1,43 @@
+package globals
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestComponentLevels(t *testing.T) {
+	var buf bytes.Buffer
+	components := map[string]string{"scheduler": "debug", "api": "warn"}
+	base := slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: minLevel(slog.LevelInfo, components)})
+	logger := slog.New(NewComponentLevelHandler(base, slog.LevelInfo, components))
+
+	scheduler := logger.With("component", "scheduler")
+	api := logger.With("component", "api")
+	other := logger.With("component", "rollup")
+
+	testCases := []struct {
+		name   string
+		logger *slog.Logger
+		level  slog.Level
+		want   bool
+	}{
+		{"Scheduler debug", scheduler, slog.LevelDebug, true},
+		{"API info", api, slog.LevelInfo, false},
+		{"API warn", api, slog.LevelWarn, true},
+		{"Unlisted component debug", other, slog.LevelDebug, false},
+		{"Unlisted component info", other, slog.LevelInfo, true},
+		{"Untagged debug", logger, slog.LevelDebug, false},
+		{"Grouped scheduler debug", scheduler.WithGroup("poll"), slog.LevelDebug, true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			buf.Reset()
+			tc.logger.Log(t.Context(), tc.level, "probe")
+			if got := strings.Contains(buf.String(), "probe"); got != tc.want {
+				t.Errorf("Expected logged=%v, got %v (%q)", tc.want, got, buf.String())
+			}
+		})
+	}
+}
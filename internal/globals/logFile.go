@@ -0,0 +1,119 @@
+package globals
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// backupTimeFormat is appended to rotated log file names; it sorts chronologically
+const backupTimeFormat = "2006-01-02T15-04-05.000"
+
+// rotatingFile is an append-only log file that is renamed to <path>.<time> once it
+// would exceed maxBytes. Old backups beyond maxBackups or older than maxAge are removed.
+type rotatingFile struct {
+	path       string
+	maxBytes   int64
+	maxBackups int           // 0 keeps all
+	maxAge     time.Duration // 0 keeps all
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+}
+
+// openRotatingFile creates the log directory if needed and opens path for appending,
+// failing if it is not writable.
+func openRotatingFile(path string, maxBytes int64, maxBackups int, maxAge time.Duration) (*rotatingFile, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("create log directory: %w", err)
+	}
+	rf := &rotatingFile{path: path, maxBytes: maxBytes, maxBackups: maxBackups, maxAge: maxAge}
+	if err := rf.open(); err != nil {
+		return nil, err
+	}
+	return rf, nil
+}
+
+func (rf *rotatingFile) open() error {
+	f, err := os.OpenFile(rf.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return fmt.Errorf("open log file: %w", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("stat log file: %w", err)
+	}
+	rf.file, rf.size = f, info.Size()
+	return nil
+}
+
+// Write appends p, rotating first if p would push the file past maxBytes.
+// A single record larger than maxBytes is still written to a fresh file.
+func (rf *rotatingFile) Write(p []byte) (int, error) {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+
+	if rf.maxBytes > 0 && rf.size > 0 && rf.size+int64(len(p)) > rf.maxBytes {
+		if err := rf.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := rf.file.Write(p)
+	rf.size += int64(n)
+	return n, err
+}
+
+// rotate renames the current file to a timestamped backup and starts a new one. Caller holds mu.
+func (rf *rotatingFile) rotate() error {
+	if err := rf.file.Close(); err != nil {
+		return fmt.Errorf("close log file: %w", err)
+	}
+	backup := rf.path + "." + time.Now().Format(backupTimeFormat)
+	if err := os.Rename(rf.path, backup); err != nil {
+		return fmt.Errorf("rotate log file: %w", err)
+	}
+	if err := rf.open(); err != nil {
+		return err
+	}
+	rf.prune()
+	return nil
+}
+
+// prune removes backups beyond maxBackups and older than maxAge. Errors are ignored;
+// a stale backup is not worth failing a log write over.
+func (rf *rotatingFile) prune() {
+	matches, err := filepath.Glob(rf.path + ".*")
+	if err != nil {
+		return
+	}
+
+	backups := make([]string, 0, len(matches))
+	for _, m := range matches {
+		if _, err := time.Parse(backupTimeFormat, strings.TrimPrefix(m, rf.path+".")); err == nil {
+			backups = append(backups, m)
+		}
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(backups))) // newest first
+
+	cutoff := time.Now().Add(-rf.maxAge)
+	for i, b := range backups {
+		stamp, _ := time.ParseInLocation(backupTimeFormat, strings.TrimPrefix(b, rf.path+"."), time.Local)
+		if (rf.maxBackups > 0 && i >= rf.maxBackups) || (rf.maxAge > 0 && stamp.Before(cutoff)) {
+			os.Remove(b)
+		}
+	}
+}
+
+// Close closes the current log file
+func (rf *rotatingFile) Close() error {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+	return rf.file.Close()
+}
@@ -0,0 +1,86 @@
+package globals
+
+import (
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestInitLoggerWritesToFile(t *testing.T) {
+	prev := slog.Default()
+	t.Cleanup(func() { slog.SetDefault(prev) })
+
+	path := filepath.Join(t.TempDir(), "logs", "nms.log")
+	logger, err := InitLogger(LoggingConfig{Level: "info", Format: "json", Output: "file", FilePath: path})
+	if err != nil {
+		t.Fatalf("InitLogger failed: %v", err)
+	}
+	logger.Info("hello from the file logger", "answer", 42)
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read log file: %v", err)
+	}
+	if !strings.Contains(string(data), `"msg":"hello from the file logger"`) {
+		t.Errorf("Expected record in log file, got %q", data)
+	}
+}
+
+func TestInitLoggerRejectsBadOutput(t *testing.T) {
+	prev := slog.Default()
+	t.Cleanup(func() { slog.SetDefault(prev) })
+
+	dir := t.TempDir()
+	blocker := filepath.Join(dir, "not-a-dir")
+	if err := os.WriteFile(blocker, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		name string
+		cfg  LoggingConfig
+	}{
+		{"Unknown output", LoggingConfig{Output: "syslog"}},
+		{"Missing file path", LoggingConfig{Output: "file"}},
+		{"Unwritable path", LoggingConfig{Output: "both", FilePath: filepath.Join(blocker, "nms.log")}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := InitLogger(tc.cfg); err == nil {
+				t.Error("Expected InitLogger to fail")
+			}
+		})
+	}
+}
+
+func TestRotatingFileRotatesAndPrunes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "nms.log")
+	rf, err := openRotatingFile(path, 100, 2, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rf.Close()
+
+	line := []byte(strings.Repeat("x", 59) + "\n")
+	for i := 0; i < 5; i++ {
+		if _, err := rf.Write(line); err != nil {
+			t.Fatalf("Write %d failed: %v", i, err)
+		}
+		time.Sleep(2 * time.Millisecond) // distinct backup timestamps
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size() != int64(len(line)) {
+		t.Errorf("Expected current file to hold one record, got %d bytes", info.Size())
+	}
+	backups, _ := filepath.Glob(path + ".*")
+	if len(backups) != 2 {
+		t.Errorf("Expected 2 backups to be kept, got %v", backups)
+	}
+}
@@ -0,0 +1,68 @@
+package globals
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+)
+
+// samplingState is shared by a sampling handler and every handler derived from it
+type samplingState struct {
+	every  uint64
+	counts sync.Map // message -> *atomic.Uint64
+}
+
+// samplingHandler passes through one in every N debug records per message.
+// Info and above are never sampled.
+type samplingHandler struct {
+	next  slog.Handler
+	state *samplingState
+}
+
+// NewSamplingHandler wraps next so only the 1st, (N+1)th, (2N+1)th, ... debug record with a
+// given message is logged. every <= 1 returns next unchanged.
+func NewSamplingHandler(next slog.Handler, every int) slog.Handler {
+	if every <= 1 {
+		return next
+	}
+	return &samplingHandler{next: next, state: &samplingState{every: uint64(every)}}
+}
+
+// SampleDebug returns a logger whose debug records are sampled per message (see NewSamplingHandler)
+func SampleDebug(logger *slog.Logger, every int) *slog.Logger {
+	if every <= 1 {
+		return logger
+	}
+	return slog.New(NewSamplingHandler(logger.Handler(), every))
+}
+
+func (h *samplingHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+func (h *samplingHandler) Handle(ctx context.Context, r slog.Record) error {
+	if r.Level >= slog.LevelInfo {
+		return h.next.Handle(ctx, r)
+	}
+
+	c, ok := h.state.counts.Load(r.Message)
+	if !ok {
+		c, _ = h.state.counts.LoadOrStore(r.Message, new(atomic.Uint64))
+	}
+	if (c.(*atomic.Uint64).Add(1)-1)%h.state.every != 0 {
+		return nil
+	}
+
+	r = r.Clone()
+	r.AddAttrs(slog.Uint64("sample_every", h.state.every))
+	return h.next.Handle(ctx, r)
+}
+
+func (h *samplingHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &samplingHandler{next: h.next.WithAttrs(attrs), state: h.state}
+}
+
+func (h *samplingHandler) WithGroup(name string) slog.Handler {
+	return &samplingHandler{next: h.next.WithGroup(name), state: h.state}
+}
@@ -0,0 +1,45 @@
+package globals
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestSampleDebug(t *testing.T) {
+	var buf bytes.Buffer
+	base := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	logger := SampleDebug(base, 10).With("component", "scheduler")
+
+	for i := 0; i < 25; i++ {
+		logger.Debug("monitor rescheduled", "monitor_id", i)
+		logger.Debug("skipping poll")
+		logger.Warn("monitor poll failed")
+	}
+
+	out := buf.String()
+	testCases := []struct {
+		msg  string
+		want int
+	}{
+		{"msg=\"monitor rescheduled\"", 3},
+		{"msg=\"skipping poll\"", 3},
+		{"msg=\"monitor poll failed\"", 25},
+	}
+	for _, tc := range testCases {
+		if got := strings.Count(out, tc.msg); got != tc.want {
+			t.Errorf("Expected %d records for %s, got %d", tc.want, tc.msg, got)
+		}
+	}
+	if !strings.Contains(out, "monitor_id=10 sample_every=10") {
+		t.Errorf("Expected the 11th record to be kept and tagged, got:\n%s", out)
+	}
+}
+
+func TestSampleDebugDisabled(t *testing.T) {
+	base := slog.Default()
+	if SampleDebug(base, 1) != base || SampleDebug(base, 0) != base {
+		t.Error("Sampling of 0 or 1 should return the logger unchanged")
+	}
+}
@@ -0,0 +1,89 @@
+package globals
+
+import "time"
+
+// Types the poller reports to the API. They live here so api/common can describe the
+// poller's interfaces without importing it.
+
+// MetricRecord represents a metric ready for the metric sink (key-value format)
+type MetricRecord struct {
+	MonitorID int64
+	Timestamp time.Time
+	Name      string
+	Value     float64
+	Type      string            // "gauge", "counter", "derive"
+	Unit      string            // e.g. "bytes", "percent"; empty is stored as NULL
+	Tags      map[string]string // plugin tags merged over monitor tags; empty is stored as NULL
+}
+
+// EffectiveMonitorConfig is the configuration the scheduler polls a monitor with, once
+// every column default, config fallback and plugin manifest default has been applied
+type EffectiveMonitorConfig struct {
+	MonitorID int64  `json:"monitor_id"`
+	PluginID  string `json:"plugin_id"`
+	// Executor is what polls the monitor: "plugin" (a loaded plugin binary), "collector"
+	// (an in-process collector) or "none" (every poll fails with "plugin not found")
+	Executor string `json:"executor"`
+
+	Port int `json:"port"`
+	// PortSource is where Port comes from: "monitor", "plugin_manifest",
+	// "protocol_default" or "none" when nothing provides one (port 0)
+	PortSource string `json:"port_source"`
+
+	PollingIntervalSeconds int `json:"polling_interval_seconds"`
+	// PollingIntervalSource is "monitor", "default" (unset, 60 seconds) or "clamped" when
+	// the monitor's interval lies outside the configured bounds
+	PollingIntervalSource string `json:"polling_interval_source"`
+
+	DownThreshold int `json:"down_threshold"`
+	// StaleAfterIntervals is 0 when staleness detection is disabled
+	StaleAfterIntervals int    `json:"stale_after_intervals"`
+	LivenessMethod      string `json:"liveness_method"`
+	LivenessTimeoutMS   int64  `json:"liveness_timeout_ms"`
+	PluginTimeoutMS     int64  `json:"plugin_timeout_ms"`
+
+	// Collectors are the metric groups polled. With no selection on the monitor
+	// (AllCollectors) this is every collector the plugin manifest lists.
+	Collectors          []string          `json:"collectors"`
+	AllCollectors       bool              `json:"all_collectors"`
+	KeepPollingWhenDown bool              `json:"keep_polling_when_down"`
+	Tags                map[string]string `json:"tags"`
+
+	// Scheduled reports whether the scheduler is polling the monitor now; NextPollAt is
+	// its next deadline
+	Scheduled  bool       `json:"scheduled"`
+	NextPollAt *time.Time `json:"next_poll_at,omitempty"`
+}
+
+// Values of PipelineHealth.Status
+const (
+	PipelineDisabled = "disabled" // metrics.pipeline_check_interval_seconds is negative
+	PipelineUnknown  = "unknown"  // not checked yet, or the last check failed
+	PipelineOK       = "ok"
+	PipelineIdle     = "idle"     // no reachable monitors, so no metrics are expected
+	PipelineDegraded = "degraded" // reachable monitors, but no metric written within the window
+)
+
+// PipelineHealth is the result of the latest metrics pipeline check
+type PipelineHealth struct {
+	Status    string     `json:"status"`
+	CheckedAt *time.Time `json:"checked_at,omitempty"`
+	// PolledMonitors counts reachable monitors, which should be producing metrics
+	PolledMonitors int64 `json:"polled_monitors"`
+	// LatestMetric is the newest stored metric's timestamp, unset when there are none
+	LatestMetric *time.Time `json:"latest_metric,omitempty"`
+	// WindowSeconds is how old LatestMetric may be before the pipeline is degraded
+	WindowSeconds int64  `json:"window_seconds"`
+	Error         string `json:"error,omitempty"`
+}
+
+// SchedulerSnapshot is a point-in-time view of the scheduler's live state
+type SchedulerSnapshot struct {
+	Running         bool           `json:"running"`
+	TrackedMonitors int            `json:"tracked_monitors"`
+	HeapSize        int            `json:"heap_size"`
+	NextDue         *time.Time     `json:"next_due"`
+	PollingMonitors []int64        `json:"polling_monitors"`
+	StaleMonitors   []int64        `json:"stale_monitors"`
+	InFlightBatches map[string]int `json:"in_flight_batches"` // keyed by plugin ID
+}
@@ -0,0 +1,120 @@
+package globals
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// ChannelStats is one event channel's buffer usage and slow-consumer history
+type ChannelStats struct {
+	Name     string `json:"name"`
+	Length   int    `json:"length"`
+	Capacity int    `json:"capacity"`
+	// Slow is set while the channel has stayed above the high-water mark for the
+	// configured sustain period
+	Slow bool `json:"slow"`
+	// SlowWarnings counts the times the channel has been reported slow since startup
+	SlowWarnings int64 `json:"slow_warnings"`
+	// Dropped counts the events producers could not deliver on the channel since startup
+	Dropped int64 `json:"dropped"`
+}
+
+// channelWatch tracks how long each channel has been above the high-water mark.
+// The zero value is ready to use.
+type channelWatch struct {
+	mu       sync.Mutex
+	above    map[string]time.Time // when the channel last crossed the high-water mark
+	slow     map[string]bool
+	warnings map[string]int64
+}
+
+// channelFill returns the current length and capacity of every buffered event channel
+func (ec *EventChannels) channelFill() []ChannelStats {
+	return []ChannelStats{
+		{Name: ChannelDiscoveryRequest, Length: len(ec.DiscoveryRequest), Capacity: cap(ec.DiscoveryRequest)},
+		{Name: ChannelDiscoveryStatus, Length: len(ec.DiscoveryStatus), Capacity: cap(ec.DiscoveryStatus)},
+		{Name: ChannelDeviceValidated, Length: len(ec.DeviceValidated), Capacity: cap(ec.DeviceValidated)},
+		{Name: ChannelDiscoveryProgress, Length: len(ec.DiscoveryProgress), Capacity: cap(ec.DiscoveryProgress)},
+		{Name: ChannelMonitorState, Length: len(ec.MonitorState), Capacity: cap(ec.MonitorState)},
+		{Name: ChannelHostKeyChanged, Length: len(ec.HostKeyChanged), Capacity: cap(ec.HostKeyChanged)},
+		{Name: ChannelCacheInvalidate, Length: len(ec.CacheInvalidate), Capacity: cap(ec.CacheInvalidate)},
+		{Name: ChannelPollNow, Length: len(ec.PollNow), Capacity: cap(ec.PollNow)},
+	}
+}
+
+// ChannelStats returns the buffer usage and slow-consumer state of every event channel
+func (ec *EventChannels) ChannelStats() []ChannelStats {
+	stats := ec.channelFill()
+
+	w := &ec.watch
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for i := range stats {
+		stats[i].Slow = w.slow[stats[i].Name]
+		stats[i].SlowWarnings = w.warnings[stats[i].Name]
+		stats[i].Dropped = ec.drops.droppedCount(stats[i].Name)
+	}
+	return stats
+}
+
+// RunSlowConsumerWatch samples channel fill on the configured interval and warns, naming
+// the channel, when one stays above the high-water mark long enough that its consumer is
+// probably stuck and events are about to be dropped. It returns when ctx is cancelled or
+// the channels are closed.
+func (ec *EventChannels) RunSlowConsumerWatch(ctx context.Context) error {
+	cfg := GetConfig().Channel
+	ticker := time.NewTicker(cfg.SlowConsumerSampleInterval())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ec.Done():
+			return nil
+		case now := <-ticker.C:
+			ec.sampleChannels(now, cfg.SlowConsumerHighWater(), cfg.SlowConsumerSustain())
+		}
+	}
+}
+
+// sampleChannels records one fill sample per channel, warning once per sustained episode
+func (ec *EventChannels) sampleChannels(now time.Time, highWater float64, sustain time.Duration) {
+	w := &ec.watch
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.above == nil {
+		w.above = make(map[string]time.Time)
+		w.slow = make(map[string]bool)
+		w.warnings = make(map[string]int64)
+	}
+
+	for _, c := range ec.channelFill() {
+		if c.Capacity == 0 || float64(c.Length)/float64(c.Capacity) < highWater {
+			if w.slow[c.Name] {
+				slog.Info("Event channel consumer caught up", "channel", c.Name, "length", c.Length, "capacity", c.Capacity)
+			}
+			delete(w.above, c.Name)
+			delete(w.slow, c.Name)
+			continue
+		}
+
+		since, ok := w.above[c.Name]
+		if !ok {
+			w.above[c.Name] = now
+			since = now
+		}
+		if !w.slow[c.Name] && now.Sub(since) >= sustain {
+			w.slow[c.Name] = true
+			w.warnings[c.Name]++
+			slog.Warn("Event channel consumer is falling behind",
+				"channel", c.Name,
+				"length", c.Length,
+				"capacity", c.Capacity,
+				"above_high_water_for", now.Sub(since).Round(time.Second),
+			)
+		}
+	}
+}
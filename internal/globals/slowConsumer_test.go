@@ -0,0 +1,74 @@
+package globals
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSlowConsumerDetection(t *testing.T) {
+	SetGlobalConfigForTests(&Config{Channel: EventBusConfig{StateSignalChannelSize: 10, CacheEventsChannelSize: 10}})
+	ec := NewEventChannels()
+
+	stateOf := func() ChannelStats {
+		for _, c := range ec.ChannelStats() {
+			if c.Name == "monitor_state" {
+				return c
+			}
+		}
+		t.Fatal("monitor_state channel not reported")
+		return ChannelStats{}
+	}
+
+	// 9 of 10 buffered: above an 80% high-water mark
+	for range 9 {
+		ec.MonitorState <- MonitorStateEvent{}
+	}
+	start := time.Now()
+	const sustain = 30 * time.Second
+
+	steps := []struct {
+		name         string
+		after        time.Duration
+		wantSlow     bool
+		wantWarnings int64
+	}{
+		{"Just crossed", 0, false, 0},
+		{"Not yet sustained", 10 * time.Second, false, 0},
+		{"Sustained", sustain, true, 1},
+		{"Still slow, warned once", 45 * time.Second, true, 1},
+	}
+	for _, step := range steps {
+		ec.sampleChannels(start.Add(step.after), 0.8, sustain)
+		got := stateOf()
+		if got.Slow != step.wantSlow || got.SlowWarnings != step.wantWarnings {
+			t.Errorf("%s: Expected slow=%v warnings=%d, got slow=%v warnings=%d",
+				step.name, step.wantSlow, step.wantWarnings, got.Slow, got.SlowWarnings)
+		}
+	}
+	if got := stateOf(); got.Length != 9 || got.Capacity != 10 {
+		t.Errorf("Expected length 9 of 10, got %d of %d", got.Length, got.Capacity)
+	}
+
+	// The consumer catches up, then falls behind again: a new episode warns again
+	for range 5 {
+		<-ec.MonitorState
+	}
+	ec.sampleChannels(start.Add(time.Minute), 0.8, sustain)
+	if got := stateOf(); got.Slow {
+		t.Error("Expected the channel to recover once drained below the high-water mark")
+	}
+	for range 5 {
+		ec.MonitorState <- MonitorStateEvent{}
+	}
+	ec.sampleChannels(start.Add(2*time.Minute), 0.8, sustain)
+	ec.sampleChannels(start.Add(3*time.Minute), 0.8, sustain)
+	if got := stateOf(); !got.Slow || got.SlowWarnings != 2 {
+		t.Errorf("Expected a second warning, got slow=%v warnings=%d", got.Slow, got.SlowWarnings)
+	}
+
+	for _, c := range ec.ChannelStats() {
+		if c.Name != "monitor_state" && c.Slow {
+			t.Errorf("Expected only monitor_state to be slow, got %s", c.Name)
+		}
+	}
+}
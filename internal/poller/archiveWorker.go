@@ -0,0 +1,105 @@
+package poller
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/nmslite/nmslite/internal/database/dbgen"
+	"github.com/nmslite/nmslite/internal/globals"
+)
+
+// ArchiveWorker periodically moves monitors that have been down too long to "archived".
+// Archived monitors are never loaded by the scheduler, so probing stops entirely
+// until they are restored.
+type ArchiveWorker struct {
+	querier dbgen.Querier
+	events  *globals.EventChannels
+	logger  *slog.Logger
+
+	archiveAfter time.Duration
+	interval     time.Duration
+}
+
+// NewArchiveWorker creates a new ArchiveWorker instance
+func NewArchiveWorker(querier dbgen.Querier, events *globals.EventChannels) *ArchiveWorker {
+	cfg := &globals.GetConfig().Scheduler
+
+	interval := cfg.ArchiveInterval()
+	if interval <= 0 {
+		interval = time.Hour
+	}
+
+	return &ArchiveWorker{
+		querier:      querier,
+		events:       events,
+		logger:       slog.Default().With("component", "archive"),
+		archiveAfter: cfg.ArchiveAfter(),
+		interval:     interval,
+	}
+}
+
+// Enabled reports whether archiving is configured
+func (aw *ArchiveWorker) Enabled() bool {
+	return aw.archiveAfter > 0
+}
+
+// Run starts the archive loop and blocks until context is cancelled
+func (aw *ArchiveWorker) Run(ctx context.Context) error {
+	if !aw.Enabled() {
+		aw.logger.Info("archive worker disabled")
+		return nil
+	}
+
+	aw.logger.Info("archive worker starting",
+		"archive_after", aw.archiveAfter,
+		"interval", aw.interval,
+	)
+
+	ticker := time.NewTicker(aw.interval)
+	defer ticker.Stop()
+
+	aw.archive(ctx)
+
+	for {
+		select {
+		case <-ctx.Done():
+			aw.logger.Info("archive worker shutting down")
+			return ctx.Err()
+		case <-ticker.C:
+			aw.archive(ctx)
+		}
+	}
+}
+
+// archive archives long-down monitors and emits an "archived" state event for each
+func (aw *ArchiveWorker) archive(ctx context.Context) {
+	archived, err := aw.querier.ArchiveDownMonitors(ctx, time.Now().Add(-aw.archiveAfter))
+	if err != nil {
+		if ctx.Err() == nil {
+			aw.logger.Error("failed to archive down monitors", "error", err)
+		}
+		return
+	}
+
+	now := time.Now()
+	for _, m := range archived {
+		aw.logger.Info("monitor archived after prolonged outage",
+			"monitor_id", m.ID,
+			"ip", m.IpAddress.String(),
+		)
+
+		event := globals.MonitorStateEvent{
+			MonitorID: m.ID,
+			IP:        m.IpAddress.String(),
+			EventType: "archived",
+			Timestamp: now,
+		}
+		select {
+		case aw.events.MonitorState <- event:
+		default:
+			aw.logger.Warn("failed to emit monitor archived event: channel full", "monitor_id", m.ID)
+			aw.events.RecordDropped(globals.ChannelMonitorState, globals.DropChannelFull, event)
+		}
+	}
+}
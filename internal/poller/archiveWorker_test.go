@@ -0,0 +1,49 @@
+package poller
+
+import (
+	"context"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/nmslite/nmslite/internal/globals"
+)
+
+func TestArchiveWorkerEmitsEvents(t *testing.T) {
+	q := newFakeQuerier().addMonitor(4, "192.0.2.4", "down").addMonitor(5, "192.0.2.5", "down")
+	// Monitor 4 went down two days ago and was edited since; monitor 5 is stale but only just went down
+	m := q.monitors[4]
+	m.DownSince.Time = time.Now().Add(-48 * time.Hour)
+	q.monitors[4] = m
+	m = q.monitors[5]
+	m.UpdatedAt.Time = time.Now().Add(-48 * time.Hour)
+	q.monitors[5] = m
+	events := &globals.EventChannels{MonitorState: make(chan globals.MonitorStateEvent, 1)}
+	aw := &ArchiveWorker{
+		querier:      q,
+		events:       events,
+		logger:       slog.Default(),
+		archiveAfter: 24 * time.Hour,
+	}
+
+	aw.archive(context.Background())
+
+	if age := time.Since(lastArgs[time.Time](q, "ArchiveDownMonitors")); age < 24*time.Hour || age > 25*time.Hour {
+		t.Errorf("Expected cutoff ~24h ago, got %v ago", age)
+	}
+
+	select {
+	case event := <-events.MonitorState:
+		if event.MonitorID != 4 || event.EventType != "archived" || event.IP != "192.0.2.4" {
+			t.Errorf("Unexpected event: %+v", event)
+		}
+	default:
+		t.Fatal("Expected an archived event")
+	}
+	if !q.monitors[4].ArchivedAt.Valid {
+		t.Error("Expected the archived monitor to record when it was archived")
+	}
+	if len(events.MonitorState) != 0 || q.monitors[5].Status.String != "down" {
+		t.Error("Expected a monitor down for less than a day to stay down")
+	}
+}
@@ -5,36 +5,27 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
+	"slices"
 	"sync"
 	"time"
 
-	"github.com/jackc/pgx/v5"
-	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/nmslite/nmslite/internal/globals"
 )
 
-// MetricRecord represents a metric ready for database insertion (key-value format)
-type MetricRecord struct {
-	MonitorID int64
-	Timestamp time.Time
-	Name      string
-	Value     float64
-	Type      string // "gauge", "counter", "derive"
-}
-
-// BatchWriter handles bulk metric writes using pgx COPY protocol
+// BatchWriter batches metric writes to a MetricSink, retrying failed batches
 type BatchWriter struct {
-	pool   *pgxpool.Pool
+	sink   MetricSink
 	logger *slog.Logger
 	cfg    *globals.MetricsConfig
 
 	// Buffering and flow control
-	submitCh      chan MetricRecord
-	requeueBuffer []MetricRecord
+	submitCh      chan globals.MetricRecord
+	requeueBuffer []globals.MetricRecord
 	bufferMu      sync.Mutex
 
 	// Batch management
-	currentBatch []MetricRecord
+	currentBatch []globals.MetricRecord
 	batchMu      sync.Mutex
 	lastFlush    time.Time
 
@@ -44,10 +35,19 @@ type BatchWriter struct {
 
 	// Lifecycle management
 	wg sync.WaitGroup
+	// submitMu guards closed; Submit holds it for reading so Shutdown never misses a
+	// record that is being queued, and Run joins wg under it so Shutdown never misses Run
+	submitMu sync.RWMutex
+	closed   bool
+	// stopCh is closed by Shutdown to stop Run without a flush of its own
+	stopCh chan struct{}
 }
 
-// NewBatchWriter creates a new BatchWriter instance
-func NewBatchWriter(pool *pgxpool.Pool) *BatchWriter {
+// ErrBatchWriterClosed is returned by Submit once Shutdown has been called
+var ErrBatchWriterClosed = errors.New("batch writer is shut down")
+
+// NewBatchWriter creates a BatchWriter that stores metrics in sink
+func NewBatchWriter(sink MetricSink) *BatchWriter {
 	cfg := &globals.GetConfig().Metrics
 	logger := slog.Default()
 
@@ -66,20 +66,28 @@ func NewBatchWriter(pool *pgxpool.Pool) *BatchWriter {
 	maxConsecutiveFails := 5
 	submitChannelSize := batchSize * 2
 
-	return &BatchWriter{
-		pool:                pool,
+	bw := &BatchWriter{
+		sink:                sink,
 		logger:              logger,
 		cfg:                 cfg,
-		submitCh:            make(chan MetricRecord, submitChannelSize),
-		requeueBuffer:       make([]MetricRecord, 0, maxBufferSize),
-		currentBatch:        make([]MetricRecord, 0, batchSize),
+		submitCh:            make(chan globals.MetricRecord, submitChannelSize),
+		stopCh:              make(chan struct{}),
+		requeueBuffer:       make([]globals.MetricRecord, 0, maxBufferSize),
+		currentBatch:        make([]globals.MetricRecord, 0, batchSize),
 		lastFlush:           time.Now(),
 		maxConsecutiveFails: maxConsecutiveFails,
 	}
+	return bw
 }
 
 // Submit adds a metric record to the batch queue with backpressure
-func (bw *BatchWriter) Submit(ctx context.Context, record MetricRecord) error {
+func (bw *BatchWriter) Submit(ctx context.Context, record globals.MetricRecord) error {
+	bw.submitMu.RLock()
+	defer bw.submitMu.RUnlock()
+	if bw.closed {
+		return ErrBatchWriterClosed
+	}
+
 	select {
 	case bw.submitCh <- record:
 		return nil
@@ -88,16 +96,42 @@ func (bw *BatchWriter) Submit(ctx context.Context, record MetricRecord) error {
 	}
 }
 
-// Run starts the batch writer's main processing loop
+// QueueDepth returns how many records are waiting to be written: queued submissions,
+// the batch being assembled and records requeued after a failed write
+func (bw *BatchWriter) QueueDepth() int {
+	depth := len(bw.submitCh)
+
+	bw.batchMu.Lock()
+	depth += len(bw.currentBatch)
+	bw.batchMu.Unlock()
+
+	bw.bufferMu.Lock()
+	depth += len(bw.requeueBuffer)
+	bw.bufferMu.Unlock()
+
+	return depth
+}
+
+// Run starts the batch writer's main processing loop. It returns ErrBatchWriterClosed
+// at once if Shutdown has already been called.
 func (bw *BatchWriter) Run(ctx context.Context) error {
+	// Joining wg under the lock Shutdown closes with means Shutdown either waits for this
+	// Run or has already closed, never a Wait racing this Add. A read lock, as Submit
+	// calls blocked on a full queue hold it until Run consumes.
+	bw.submitMu.RLock()
+	if bw.closed {
+		bw.submitMu.RUnlock()
+		return ErrBatchWriterClosed
+	}
+	bw.wg.Add(1)
+	bw.submitMu.RUnlock()
+	defer bw.wg.Done()
+
 	bw.logger.Info("batch writer starting",
 		"batch_size", bw.cfg.BatchSize,
 		"flush_interval_ms", bw.cfg.FlushIntervalMS,
 	)
 
-	bw.wg.Add(1)
-	defer bw.wg.Done()
-
 	flushInterval := time.Duration(bw.cfg.FlushIntervalMS) * time.Millisecond
 	flushTicker := time.NewTicker(flushInterval)
 	defer flushTicker.Stop()
@@ -111,6 +145,10 @@ func (bw *BatchWriter) Run(ctx context.Context) error {
 			}
 			return ctx.Err()
 
+		case <-bw.stopCh:
+			// Shutdown drains and flushes what is left
+			return nil
+
 		case record := <-bw.submitCh:
 			bw.batchMu.Lock()
 			bw.currentBatch = append(bw.currentBatch, record)
@@ -137,7 +175,53 @@ func (bw *BatchWriter) Run(ctx context.Context) error {
 	}
 }
 
-// flush writes the current batch to the database
+// Shutdown stops accepting submissions, waits for Run to return, then drains the queued
+// records and writes them, together with any requeued ones, in a final flush bounded by
+// ctx. It returns how many records could not be persisted; those are lost.
+func (bw *BatchWriter) Shutdown(ctx context.Context) (int, error) {
+	// Waits for in-flight Submit calls, which Run is still consuming
+	bw.submitMu.Lock()
+	if bw.closed {
+		bw.submitMu.Unlock()
+		return 0, ErrBatchWriterClosed
+	}
+	bw.closed = true
+	bw.submitMu.Unlock()
+
+	close(bw.stopCh)
+	bw.wg.Wait()
+
+	bw.batchMu.Lock()
+	for drained := false; !drained; {
+		select {
+		case record := <-bw.submitCh:
+			bw.currentBatch = append(bw.currentBatch, record)
+		default:
+			drained = true
+		}
+	}
+	batch := bw.currentBatch
+	bw.currentBatch = nil
+	bw.batchMu.Unlock()
+
+	bw.bufferMu.Lock()
+	batch = append(bw.requeueBuffer, batch...)
+	bw.requeueBuffer = nil
+	bw.bufferMu.Unlock()
+
+	dropped, unwritten, err := bw.writeBatch(ctx, batch)
+	unflushed := dropped + len(unwritten)
+	bw.logger.Info("batch writer shut down",
+		"flushed", len(batch)-unflushed,
+		"unflushed", unflushed,
+	)
+	if err != nil {
+		return unflushed, fmt.Errorf("final flush: %w", err)
+	}
+	return unflushed, nil
+}
+
+// flush writes the current batch to the sink
 func (bw *BatchWriter) flush(ctx context.Context) error {
 	bw.batchMu.Lock()
 	if len(bw.currentBatch) == 0 {
@@ -146,37 +230,45 @@ func (bw *BatchWriter) flush(ctx context.Context) error {
 	}
 
 	batch := bw.currentBatch
-	bw.currentBatch = make([]MetricRecord, 0, bw.cfg.BatchSize)
+	bw.currentBatch = make([]globals.MetricRecord, 0, bw.cfg.BatchSize)
 	bw.batchMu.Unlock()
 
 	bw.bufferMu.Lock()
 	if len(bw.requeueBuffer) > 0 {
 		requeuedCount := len(bw.requeueBuffer)
 		batch = append(bw.requeueBuffer, batch...)
-		bw.requeueBuffer = make([]MetricRecord, 0, bw.cfg.BatchSize*10)
+		bw.requeueBuffer = make([]globals.MetricRecord, 0, bw.cfg.BatchSize*10)
 		bw.logger.Info("including requeued items in flush", "requeued_count", requeuedCount)
 	}
 	bw.bufferMu.Unlock()
 
 	startTime := time.Now()
-	err := bw.writeBatch(ctx, batch)
+	dropped, unwritten, err := bw.writeBatch(ctx, batch)
 	duration := time.Since(startTime)
 
+	if dropped > 0 {
+		bw.logger.Warn("dropped metrics rejected by the sink",
+			"dropped_count", dropped,
+			"batch_size", len(batch),
+		)
+	}
+
 	if err != nil {
 		bw.logger.Error("batch write failed",
 			"error", err,
 			"batch_size", len(batch),
+			"unwritten", len(unwritten),
 			"duration_ms", duration.Milliseconds(),
 		)
 
 		bw.consecutiveFailures++
 
 		if bw.consecutiveFailures < bw.maxConsecutiveFails {
-			bw.requeue(batch)
+			bw.requeue(unwritten)
 		} else {
 			bw.logger.Error("max consecutive failures reached, dropping batch",
 				"consecutive_failures", bw.consecutiveFailures,
-				"dropped_count", len(batch),
+				"dropped_count", len(unwritten),
 			)
 		}
 
@@ -194,56 +286,60 @@ func (bw *BatchWriter) flush(ctx context.Context) error {
 	return nil
 }
 
-// writeBatch performs the actual database write using COPY protocol
-func (bw *BatchWriter) writeBatch(ctx context.Context, batch []MetricRecord) error {
+// writeBatch writes batch to the sink in one call. If the sink rejects it because of the
+// data (e.g. a NaN or an oversized name), the batch is split in halves and retried to
+// isolate the offending records, which are dropped while the rest are persisted.
+// On any other error, unwritten holds the records that still need a retry.
+func (bw *BatchWriter) writeBatch(ctx context.Context, batch []globals.MetricRecord) (dropped int, unwritten []globals.MetricRecord, err error) {
 	if len(batch) == 0 {
-		return nil
+		return 0, nil, nil
 	}
 
-	tx, err := bw.pool.Begin(ctx)
-	if err != nil {
-		return fmt.Errorf("failed to begin transaction: %w", err)
+	err = bw.sink.WriteMetrics(ctx, batch)
+	if err == nil {
+		return 0, nil, nil
 	}
-	defer func() {
-		if err := tx.Rollback(ctx); err != nil && !errors.Is(err, pgx.ErrTxClosed) {
-			bw.logger.Warn("failed to rollback transaction", "error", err)
-		}
-	}()
-
-	// Use COPY protocol for bulk insert - key-value format with type
-	copyCount, err := tx.Conn().CopyFrom(
-		ctx,
-		pgx.Identifier{"metrics"},
-		[]string{"timestamp", "device_id", "name", "value", "type"},
-		pgx.CopyFromSlice(len(batch), func(i int) ([]interface{}, error) {
-			record := batch[i]
-			return []interface{}{
-				record.Timestamp,
-				record.MonitorID,
-				record.Name,
-				record.Value,
-				record.Type,
-			}, nil
-		}),
-	)
-
-	if err != nil {
-		return fmt.Errorf("COPY operation failed: %w", err)
+	if !isRecordError(err) {
+		return 0, batch, err
 	}
 
-	if copyCount != int64(len(batch)) {
-		return fmt.Errorf("COPY count mismatch: expected %d, got %d", len(batch), copyCount)
+	if len(batch) == 1 {
+		bw.logger.Debug("dropping metric rejected by the sink",
+			"monitor_id", batch[0].MonitorID,
+			"name", batch[0].Name,
+			"error", err,
+		)
+		return 1, nil, nil
 	}
 
-	if err := tx.Commit(ctx); err != nil {
-		return fmt.Errorf("failed to commit transaction: %w", err)
+	mid := len(batch) / 2
+	dropped, unwritten, err = bw.writeBatch(ctx, batch[:mid])
+	if err != nil {
+		return dropped, slices.Concat(unwritten, batch[mid:]), err
 	}
+	rightDropped, unwritten, err := bw.writeBatch(ctx, batch[mid:])
+	return dropped + rightDropped, unwritten, err
+}
 
-	return nil
+// isRecordError reports whether err was caused by the records being written (data
+// exceptions and constraint violations) rather than by the backend or connection
+func isRecordError(err error) bool {
+	if errors.Is(err, ErrMetricsRejected) {
+		return true
+	}
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) || len(pgErr.Code) < 2 {
+		return false
+	}
+	switch pgErr.Code[:2] {
+	case "22", "23":
+		return true
+	}
+	return false
 }
 
 // requeue adds failed batch back to the buffer for retry
-func (bw *BatchWriter) requeue(batch []MetricRecord) {
+func (bw *BatchWriter) requeue(batch []globals.MetricRecord) {
 	bw.bufferMu.Lock()
 	defer bw.bufferMu.Unlock()
 
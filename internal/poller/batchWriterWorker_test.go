@@ -0,0 +1,227 @@
+package poller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/nmslite/nmslite/internal/globals"
+)
+
+// fakeSink persists batches in memory, rejecting any batch that contains a poison record
+type fakeSink struct {
+	written []string
+	calls   int
+	// failAfter makes every call from this one on fail with a connection error (0 = never)
+	failAfter int
+}
+
+func (c *fakeSink) WriteMetrics(ctx context.Context, batch []globals.MetricRecord) error {
+	c.calls++
+	if c.failAfter > 0 && c.calls >= c.failAfter {
+		return errors.New("connection reset by peer")
+	}
+	for _, r := range batch {
+		if r.Name == "poison" {
+			return &pgconn.PgError{Code: "22P02", Message: "invalid input syntax"}
+		}
+	}
+	for _, r := range batch {
+		c.written = append(c.written, r.Name)
+	}
+	return nil
+}
+
+func newTestBatchWriter(sink MetricSink) *BatchWriter {
+	return &BatchWriter{
+		logger:              slog.Default(),
+		cfg:                 &globals.MetricsConfig{BatchSize: 100},
+		maxConsecutiveFails: 5,
+		sink:                sink,
+		submitCh:            make(chan globals.MetricRecord, 10),
+		stopCh:              make(chan struct{}),
+	}
+}
+
+func records(names ...string) []globals.MetricRecord {
+	batch := make([]globals.MetricRecord, len(names))
+	for i, name := range names {
+		batch[i] = globals.MetricRecord{MonitorID: 1, Name: name}
+	}
+	return batch
+}
+
+func TestWriteBatchIsolatesPoisonRecords(t *testing.T) {
+	testCases := []struct {
+		name        string
+		batch       []string
+		wantWritten []string
+		wantDropped int
+	}{
+		{"Clean batch in one COPY", []string{"a", "b", "c"}, []string{"a", "b", "c"}, 0},
+		{"One poison record", []string{"a", "poison", "b", "c", "d"}, []string{"a", "b", "c", "d"}, 1},
+		{"Several poison records", []string{"poison", "a", "b", "poison", "c", "poison"}, []string{"a", "b", "c"}, 3},
+		{"Only poison", []string{"poison"}, nil, 1},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := &fakeSink{}
+			bw := newTestBatchWriter(c)
+
+			dropped, unwritten, err := bw.writeBatch(context.Background(), records(tc.batch...))
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if dropped != tc.wantDropped {
+				t.Errorf("Expected %d dropped, got %d", tc.wantDropped, dropped)
+			}
+			if len(unwritten) != 0 {
+				t.Errorf("Expected nothing left to retry, got %d", len(unwritten))
+			}
+			slices.Sort(c.written)
+			if !slices.Equal(c.written, tc.wantWritten) {
+				t.Errorf("Expected %v written, got %v", tc.wantWritten, c.written)
+			}
+		})
+	}
+}
+
+func TestWriteBatchRequeuesOnlyUnwrittenAfterTransientError(t *testing.T) {
+	// Call 1: full batch hits the poison record. Call 2: left half succeeds.
+	// Call 3 onwards: the database goes away.
+	c := &fakeSink{failAfter: 3}
+	bw := newTestBatchWriter(c)
+	bw.currentBatch = records("a", "b", "poison", "c")
+
+	if err := bw.flush(context.Background()); err == nil {
+		t.Fatal("Expected the transient error to be reported")
+	}
+
+	if !slices.Equal(c.written, []string{"a", "b"}) {
+		t.Errorf("Expected the left half to be persisted, got %v", c.written)
+	}
+	var requeued []string
+	for _, r := range bw.requeueBuffer {
+		requeued = append(requeued, r.Name)
+	}
+	if !slices.Equal(requeued, []string{"poison", "c"}) {
+		t.Errorf("Expected only unwritten records requeued, got %v", requeued)
+	}
+}
+
+func TestBatchWriterShutdownReportsUnflushed(t *testing.T) {
+	testCases := []struct {
+		name          string
+		failAfter     int
+		wantUnflushed int
+		wantErr       bool
+	}{
+		{"Only the poison record lost", 0, 1, false},
+		// Call 1: full batch hits the poison record. Call 2: left half succeeds.
+		// Call 3 onwards: the database goes away.
+		{"Database lost during final flush", 3, 3, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := &fakeSink{failAfter: tc.failAfter}
+			bw := newTestBatchWriter(c)
+			bw.requeueBuffer = records("a")
+
+			for _, r := range records("b", "poison", "c", "d") {
+				if err := bw.Submit(context.Background(), r); err != nil {
+					t.Fatalf("Unexpected submit error: %v", err)
+				}
+			}
+
+			unflushed, err := bw.Shutdown(context.Background())
+			if (err != nil) != tc.wantErr {
+				t.Errorf("Expected error %v, got %v", tc.wantErr, err)
+			}
+			if unflushed != tc.wantUnflushed {
+				t.Errorf("Expected %d unflushed, got %d", tc.wantUnflushed, unflushed)
+			}
+			if len(c.written)+unflushed != 5 {
+				t.Errorf("Expected every record written or counted, got %d written and %d unflushed", len(c.written), unflushed)
+			}
+
+			if err := bw.Submit(context.Background(), records("e")[0]); !errors.Is(err, ErrBatchWriterClosed) {
+				t.Errorf("Expected ErrBatchWriterClosed after shutdown, got %v", err)
+			}
+			if err := bw.Run(context.Background()); !errors.Is(err, ErrBatchWriterClosed) {
+				t.Errorf("Expected Run to refuse to start after shutdown, got %v", err)
+			}
+		})
+	}
+}
+
+func TestBatchWriterShutdownWaitsForRun(t *testing.T) {
+	bw := newTestBatchWriter(&fakeSink{})
+	done := make(chan error, 1)
+	go func() { done <- bw.Run(context.Background()) }()
+
+	// Whether Shutdown lands before or after Run joins, Run is never left running
+	if _, err := bw.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Unexpected shutdown error: %v", err)
+	}
+	select {
+	case err := <-done:
+		if err != nil && !errors.Is(err, ErrBatchWriterClosed) {
+			t.Errorf("Expected Run to stop cleanly, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected Run to return after Shutdown")
+	}
+}
+
+// rejectingSink stores metrics in memory but rejects batches holding a poison record the
+// way a non-PostgreSQL backend would
+type rejectingSink struct {
+	MemorySink
+}
+
+func (s *rejectingSink) WriteMetrics(ctx context.Context, batch []globals.MetricRecord) error {
+	for _, r := range batch {
+		if r.Name == "poison" {
+			return fmt.Errorf("unsupported value for %s: %w", r.Name, ErrMetricsRejected)
+		}
+	}
+	return s.MemorySink.WriteMetrics(ctx, batch)
+}
+
+func TestBatchWriterWritesThroughSink(t *testing.T) {
+	globals.SetGlobalConfigForTests(&globals.Config{Metrics: globals.MetricsConfig{BatchSize: 2, FlushIntervalMS: 60000}})
+	sink := &rejectingSink{}
+	bw := NewBatchWriter(sink)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_ = bw.Run(context.Background())
+	}()
+
+	for _, r := range records("a", "b", "poison", "c", "d") {
+		if err := bw.Submit(context.Background(), r); err != nil {
+			t.Fatalf("Unexpected submit error: %v", err)
+		}
+	}
+	if _, err := bw.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Unexpected shutdown error: %v", err)
+	}
+	<-done
+
+	var written []string
+	for _, r := range sink.Records() {
+		written = append(written, r.Name)
+	}
+	// The poison record is isolated and dropped, by a flush or by the final one
+	if !slices.Equal(written, []string{"a", "b", "c", "d"}) {
+		t.Errorf("Expected a, b, c, d written in order, got %v", written)
+	}
+}
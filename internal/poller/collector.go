@@ -0,0 +1,72 @@
+package poller
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+	"sync"
+
+	"github.com/google/uuid"
+	"github.com/nmslite/nmslite/internal/api/auth"
+	"github.com/nmslite/nmslite/internal/globals"
+)
+
+// Collector polls a protocol in-process. The scheduler uses it for monitors whose
+// protocol has no plugin binary loaded, so their metrics take the same path as plugin
+// output. A failed poll returns an error; results are expected to be successes.
+// monitorID identifies the monitor polled, for per-monitor state such as a pinned host key.
+type Collector interface {
+	Collect(ctx context.Context, monitorID int64, target string, port int, creds auth.Credentials) ([]globals.PollResult, error)
+}
+
+// RegisterCollector makes c poll monitors of protocol while no plugin binary is loaded
+// for it; a loaded plugin always takes precedence. Must be called before Run.
+func (s *SchedulerImpl) RegisterCollector(protocol string, c Collector) {
+	if s.collectors == nil {
+		s.collectors = make(map[string]Collector)
+	}
+	s.collectors[protocol] = c
+}
+
+// CollectorProtocols returns the protocols polled by registered collectors, sorted
+func (s *SchedulerImpl) CollectorProtocols() []string {
+	return slices.Sorted(maps.Keys(s.collectors))
+}
+
+// collectBatch polls live monitors with an internal collector, concurrently and within the
+// plugin timeout, settling each monitor with its own result.
+func (s *SchedulerImpl) collectBatch(ctx context.Context, logger *slog.Logger, collector Collector, monitors []*ScheduledMonitor) {
+	collectCtx, cancel := context.WithTimeout(ctx, s.config.PluginTimeout())
+	defer cancel()
+
+	var wg sync.WaitGroup
+	for _, sm := range monitors {
+		cred, err := s.ensureCredentials(sm)
+		if err != nil {
+			s.handleFailure(sm, fmt.Sprintf("credential error: %v", err))
+			continue
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			results, err := collector.Collect(collectCtx, sm.Monitor.ID, sm.Monitor.IpAddress.String(), s.monitorPort(sm, cred.UseHTTPS), cred)
+			if err != nil {
+				s.handleFailure(sm, fmt.Sprintf("collector error: %v", err))
+				return
+			}
+
+			requestID := uuid.New().String()
+			for i := range results {
+				results[i].RequestID = requestID
+			}
+			s.handleSuccess(ctx, sm, results)
+		}()
+	}
+	wg.Wait()
+
+	logger.Debug("internal collector batch complete", "monitor_count", len(monitors))
+}
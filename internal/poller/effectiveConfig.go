@@ -0,0 +1,105 @@
+package poller
+
+import (
+	"time"
+
+	"github.com/nmslite/nmslite/internal/database/dbgen"
+	"github.com/nmslite/nmslite/internal/globals"
+	"github.com/nmslite/nmslite/internal/protocols"
+)
+
+// EffectiveConfig resolves the configuration m is polled with, using the same resolution
+// the scheduler applies when polling. Monitors the scheduler does not track (e.g. paused)
+// are resolved as they would be once polled, except that their credentials are not loaded,
+// so an unset port resolves to the plain (non-TLS) default.
+func (s *SchedulerImpl) EffectiveConfig(m dbgen.Monitor) globals.EffectiveMonitorConfig {
+	interval, intervalSource := s.resolvePollInterval(&m)
+	cfg := globals.EffectiveMonitorConfig{
+		MonitorID:              m.ID,
+		PluginID:               m.PluginID,
+		Executor:               "none",
+		PollingIntervalSeconds: int(interval / time.Second),
+		PollingIntervalSource:  intervalSource,
+		DownThreshold:          s.config.DownThreshold,
+		StaleAfterIntervals:    s.config.StaleAfter(),
+		LivenessMethod:         resolveLivenessMethod(s.config, m.PluginID),
+		LivenessTimeoutMS:      s.config.LivenessTimeout().Milliseconds(),
+		PluginTimeoutMS:        s.config.PluginTimeout().Milliseconds(),
+		Collectors:             m.Collectors,
+		KeepPollingWhenDown:    m.KeepPollingWhenDown,
+		Tags:                   s.parseMonitorTags(m.ID, m.Tags),
+	}
+	s.heapMu.Lock()
+	sm, scheduled := s.monitors[m.ID]
+	s.heapMu.Unlock()
+	cfg.Port, cfg.PortSource = s.resolvePort(&m, scheduled && s.usesTLS(sm))
+
+	// A loaded plugin takes precedence over an in-process collector, as when polling
+	var manifestCollectors []string
+	if plugin, ok := s.plugin(m.PluginID); ok {
+		cfg.Executor = "plugin"
+		manifestCollectors = plugin.Collectors
+	} else if s.collectors[m.PluginID] != nil {
+		cfg.Executor = "collector"
+	}
+	if len(cfg.Collectors) == 0 {
+		cfg.AllCollectors = true
+		cfg.Collectors = manifestCollectors
+	}
+	if cfg.Collectors == nil {
+		cfg.Collectors = []string{}
+	}
+
+	s.heapMu.Lock()
+	if sm, ok := s.monitors[m.ID]; ok {
+		cfg.Scheduled = true
+		next := sm.NextPollDeadline
+		cfg.NextPollAt = &next
+	}
+	s.heapMu.Unlock()
+
+	return cfg
+}
+
+// resolvePort returns the port a monitor is polled on and where it comes from: the
+// monitor's own port, its plugin manifest's default_port, or the protocol's well-known
+// (TLS, with tls) port
+func (s *SchedulerImpl) resolvePort(m *dbgen.Monitor, tls bool) (int, string) {
+	if m.Port.Valid && m.Port.Int32 > 0 {
+		return int(m.Port.Int32), "monitor"
+	}
+	// The value is whatever monitorPort polls on; only the source is worked out here
+	port := s.pluginManager.DefaultPort(m.PluginID, tls)
+	registry := protocols.GetRegistry()
+	switch {
+	case port == 0:
+		return 0, "none"
+	case port == registry.DefaultPort(m.PluginID) || (tls && port == registry.DefaultTLSPort(m.PluginID)):
+		return port, "protocol_default"
+	default:
+		return port, "plugin_manifest"
+	}
+}
+
+// resolvePollInterval returns a monitor's polling interval and where it comes from,
+// 60 seconds if unset. Rows written before the API enforced bounds are clamped to them,
+// so a 0 or 1 second interval cannot spin the scheduler.
+func (s *SchedulerImpl) resolvePollInterval(m *dbgen.Monitor) (time.Duration, string) {
+	interval, source := 60*time.Second, "default"
+	if m.PollingIntervalSeconds.Valid {
+		interval, source = time.Duration(m.PollingIntervalSeconds.Int32)*time.Second, "monitor"
+	}
+	lo, hi := s.config.PollingIntervalBounds()
+	if clamped := min(max(interval, lo), hi); clamped != interval {
+		return clamped, "clamped"
+	}
+	return interval, source
+}
+
+// plugin returns the plugin binary loaded for pluginID, if any
+func (s *SchedulerImpl) plugin(pluginID string) (*globals.PluginInfo, bool) {
+	if s.pluginManager == nil {
+		return nil, false
+	}
+	return s.pluginManager.Get(pluginID)
+}
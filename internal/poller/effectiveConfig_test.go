@@ -0,0 +1,113 @@
+package poller
+
+import (
+	"log/slog"
+	"net/netip"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/nmslite/nmslite/internal/database/dbgen"
+	"github.com/nmslite/nmslite/internal/globals"
+)
+
+func TestEffectiveConfig(t *testing.T) {
+	pm := NewPluginManager("", time.Minute, 0, 0)
+	pm.plugins["custom"] = &globals.PluginInfo{Protocol: "custom", DefaultPort: 2222, Collectors: []string{"cpu", "memory"}}
+	s := &SchedulerImpl{
+		config: &globals.SchedulerConfig{
+			DownThreshold:           3,
+			LivenessMethod:          "tcp",
+			ProtocolLivenessMethods: map[string]string{"snmp-v2c": "icmp"},
+			PluginTimeoutMS:         30000,
+		},
+		logger:        slog.Default(),
+		pluginManager: pm,
+		collectors:    map[string]Collector{"ssh": &fakeCollector{}},
+		monitors:      make(map[int64]*ScheduledMonitor),
+	}
+
+	interval := func(secs int32) pgtype.Int4 { return pgtype.Int4{Int32: secs, Valid: true} }
+	testCases := []struct {
+		name           string
+		monitor        dbgen.Monitor
+		wantExecutor   string
+		wantPort       int
+		wantPortSource string
+		wantInterval   int
+		wantSource     string
+		wantLiveness   string
+		wantCollectors []string
+	}{
+		{"Plugin manifest defaults", dbgen.Monitor{ID: 1, PluginID: "custom"},
+			"plugin", 2222, "plugin_manifest", 60, "default", "tcp", []string{"cpu", "memory"}},
+		{"Monitor overrides", dbgen.Monitor{ID: 2, PluginID: "custom", Port: pgtype.Int4{Int32: 2200, Valid: true}, PollingIntervalSeconds: interval(120), Collectors: []string{"cpu"}},
+			"plugin", 2200, "monitor", 120, "monitor", "tcp", []string{"cpu"}},
+		{"Collector with protocol port", dbgen.Monitor{ID: 3, PluginID: "ssh", PollingIntervalSeconds: interval(1)},
+			"collector", 22, "protocol_default", 10, "clamped", "tcp", []string{}},
+		{"Protocol liveness override", dbgen.Monitor{ID: 4, PluginID: "snmp-v2c"},
+			"none", 161, "protocol_default", 60, "default", "icmp", []string{}},
+		{"Unknown plugin", dbgen.Monitor{ID: 5, PluginID: "nothing"},
+			"none", 0, "none", 60, "default", "tcp", []string{}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := s.EffectiveConfig(tc.monitor)
+
+			if cfg.Executor != tc.wantExecutor {
+				t.Errorf("Expected executor %q, got %q", tc.wantExecutor, cfg.Executor)
+			}
+			if cfg.Port != tc.wantPort || cfg.PortSource != tc.wantPortSource {
+				t.Errorf("Expected port %d from %s, got %d from %s", tc.wantPort, tc.wantPortSource, cfg.Port, cfg.PortSource)
+			}
+			if cfg.PollingIntervalSeconds != tc.wantInterval || cfg.PollingIntervalSource != tc.wantSource {
+				t.Errorf("Expected interval %ds (%s), got %ds (%s)", tc.wantInterval, tc.wantSource, cfg.PollingIntervalSeconds, cfg.PollingIntervalSource)
+			}
+			if cfg.LivenessMethod != tc.wantLiveness {
+				t.Errorf("Expected liveness %q, got %q", tc.wantLiveness, cfg.LivenessMethod)
+			}
+			if !slices.Equal(cfg.Collectors, tc.wantCollectors) {
+				t.Errorf("Expected collectors %v, got %v", tc.wantCollectors, cfg.Collectors)
+			}
+			if cfg.DownThreshold != 3 || cfg.StaleAfterIntervals != 3 || cfg.PluginTimeoutMS != 30000 {
+				t.Errorf("Expected config thresholds, got %+v", cfg)
+			}
+		})
+	}
+
+	// The resolution is the one polling uses, and tracked monitors report their deadline
+	row := dbgen.GetMonitorWithCredentialsRow{
+		ID:                     6,
+		IpAddress:              netip.MustParseAddr("192.0.2.1"),
+		PluginID:               "ssh",
+		PollingIntervalSeconds: interval(1),
+		Status:                 pgtype.Text{String: "active", Valid: true},
+	}
+	s.updateMonitorCacheFromRow(row)
+	sm := s.monitors[6]
+	cfg := s.EffectiveConfig(*sm.Monitor)
+	if !cfg.Scheduled || cfg.NextPollAt == nil || !cfg.NextPollAt.Equal(sm.NextPollDeadline) {
+		t.Errorf("Expected the tracked monitor's next deadline, got %+v", cfg)
+	}
+	if cfg.Port != s.monitorPort(sm, s.usesTLS(sm)) || time.Duration(cfg.PollingIntervalSeconds)*time.Second != s.pollInterval(sm) {
+		t.Errorf("Expected the same port and interval as polling, got %+v", cfg)
+	}
+	if cfg := s.EffectiveConfig(dbgen.Monitor{ID: 7, PluginID: "ssh"}); cfg.Scheduled || cfg.NextPollAt != nil {
+		t.Errorf("Expected an untracked monitor to be unscheduled, got %+v", cfg)
+	}
+
+	// A tracked WinRM monitor whose credentials select HTTPS defaults to the TLS port
+	s.updateMonitorCacheFromRow(dbgen.GetMonitorWithCredentialsRow{
+		ID:        8,
+		IpAddress: netip.MustParseAddr("192.0.2.2"),
+		PluginID:  "windows-winrm",
+		Status:    pgtype.Text{String: "active", Valid: true},
+	})
+	useTLS := true
+	s.monitors[8].UseTLS = &useTLS
+	if cfg := s.EffectiveConfig(*s.monitors[8].Monitor); cfg.Port != 5986 || cfg.PortSource != "protocol_default" {
+		t.Errorf("Expected port 5986 from protocol_default over HTTPS, got %d from %s", cfg.Port, cfg.PortSource)
+	}
+}
@@ -0,0 +1,292 @@
+package poller
+
+import (
+	"context"
+	"maps"
+	"net/netip"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/nmslite/nmslite/internal/database/dbgen"
+)
+
+// fakeQuerier is the in-memory database behind the poller tests. Tests fill the tables
+// directly; queries read and write them the way the SQL does. Queries no test needs panic
+// via the nil embedded interface.
+type fakeQuerier struct {
+	dbgen.Querier
+
+	mu sync.Mutex
+
+	monitors    map[int64]dbgen.Monitor
+	credentials map[int64]dbgen.CredentialProfile
+	history     []dbgen.MonitorStateHistory
+	metrics     []dbgen.Metric
+	rollups     []dbgen.MetricsRollup
+
+	// fail makes the named queries return the error instead of running
+	fail map[string]error
+
+	// calls counts queries and args keeps the arguments of the latest call, by name
+	calls map[string]int
+	args  map[string]any
+}
+
+func newFakeQuerier() *fakeQuerier {
+	return &fakeQuerier{
+		monitors:    make(map[int64]dbgen.Monitor),
+		credentials: make(map[int64]dbgen.CredentialProfile),
+		fail:        make(map[string]error),
+		calls:       make(map[string]int),
+		args:        make(map[string]any),
+	}
+}
+
+// lastArgs returns the arguments of the latest call to query
+func lastArgs[T any](q *fakeQuerier, query string) T {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	arg, _ := q.args[query].(T)
+	return arg
+}
+
+// read locks the tables and records the call. The caller unlocks.
+func (q *fakeQuerier) read(query string, arg any) error {
+	q.mu.Lock()
+	q.calls[query]++
+	q.args[query] = arg
+	if err := q.fail[query]; err != nil {
+		q.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// addMonitor stores a live ssh monitor at ip with the given status, polled every 60s
+func (q *fakeQuerier) addMonitor(id int64, ip, status string) *fakeQuerier {
+	q.monitors[id] = dbgen.Monitor{
+		ID:                     id,
+		IpAddress:              netip.MustParseAddr(ip),
+		PluginID:               "ssh",
+		PollingIntervalSeconds: pgtype.Int4{Int32: 60, Valid: true},
+		Status:                 pgtype.Text{String: status, Valid: true},
+		CreatedAt:              pgtype.Timestamptz{Time: time.Now(), Valid: true},
+		UpdatedAt:              pgtype.Timestamptz{Time: time.Now(), Valid: true},
+	}
+	m := q.monitors[id]
+	trackOutage(&m)
+	q.monitors[id] = m
+	return q
+}
+
+// trackOutage mirrors the down_since/archived_at CASE expressions of the status updates
+func trackOutage(m *dbgen.Monitor) {
+	now := pgtype.Timestamptz{Time: time.Now(), Valid: true}
+	switch m.Status.String {
+	case "down", "archived":
+		if !m.DownSince.Valid {
+			m.DownSince = now
+		}
+	default:
+		m.DownSince = pgtype.Timestamptz{}
+	}
+	if m.Status.String != "archived" {
+		m.ArchivedAt = pgtype.Timestamptz{}
+	} else if !m.ArchivedAt.Valid {
+		m.ArchivedAt = now
+	}
+}
+
+// liveMonitors returns the monitors that are not deleted and match, by ID
+func (q *fakeQuerier) liveMonitors(match func(dbgen.Monitor) bool) []dbgen.Monitor {
+	var monitors []dbgen.Monitor
+	for _, id := range slices.Sorted(maps.Keys(q.monitors)) {
+		if m := q.monitors[id]; !m.DeletedAt.Valid && match(m) {
+			monitors = append(monitors, m)
+		}
+	}
+	return monitors
+}
+
+// reachable reports whether a monitor is expected to produce metrics
+func reachable(m dbgen.Monitor) bool {
+	return m.Status.String == "active" || m.Status.String == "stale"
+}
+
+// Monitors
+
+func (q *fakeQuerier) ListActiveMonitorsWithCredentials(ctx context.Context) ([]dbgen.ListActiveMonitorsWithCredentialsRow, error) {
+	if err := q.read("ListActiveMonitorsWithCredentials", nil); err != nil {
+		return nil, err
+	}
+	defer q.mu.Unlock()
+	var rows []dbgen.ListActiveMonitorsWithCredentialsRow
+	for _, m := range q.liveMonitors(func(m dbgen.Monitor) bool {
+		return reachable(m) || (m.Status.String == "down" && m.KeepPollingWhenDown)
+	}) {
+		c, ok := q.credentials[m.CredentialProfileID]
+		if !ok {
+			continue
+		}
+		rows = append(rows, dbgen.ListActiveMonitorsWithCredentialsRow{
+			ID:                     m.ID,
+			DisplayName:            m.DisplayName,
+			Hostname:               m.Hostname,
+			IpAddress:              m.IpAddress,
+			PluginID:               m.PluginID,
+			CredentialProfileID:    m.CredentialProfileID,
+			DiscoveryProfileID:     m.DiscoveryProfileID,
+			Port:                   m.Port,
+			PollingIntervalSeconds: m.PollingIntervalSeconds,
+			Status:                 m.Status,
+			CreatedAt:              m.CreatedAt,
+			UpdatedAt:              m.UpdatedAt,
+			Collectors:             m.Collectors,
+			KeepPollingWhenDown:    m.KeepPollingWhenDown,
+			Tags:                   m.Tags,
+			Payload:                c.Payload,
+		})
+	}
+	return rows, nil
+}
+
+func (q *fakeQuerier) ListActiveMonitorIDsByIP(ctx context.Context, ip netip.Addr) ([]int64, error) {
+	if err := q.read("ListActiveMonitorIDsByIP", ip); err != nil {
+		return nil, err
+	}
+	defer q.mu.Unlock()
+	var ids []int64
+	for _, m := range q.liveMonitors(func(m dbgen.Monitor) bool { return m.IpAddress == ip && reachable(m) }) {
+		ids = append(ids, m.ID)
+	}
+	return ids, nil
+}
+
+func (q *fakeQuerier) GetPolledMonitorSummary(ctx context.Context) (dbgen.GetPolledMonitorSummaryRow, error) {
+	if err := q.read("GetPolledMonitorSummary", nil); err != nil {
+		return dbgen.GetPolledMonitorSummaryRow{}, err
+	}
+	defer q.mu.Unlock()
+	var summary dbgen.GetPolledMonitorSummaryRow
+	for _, m := range q.liveMonitors(reachable) {
+		interval := int32(60)
+		if m.PollingIntervalSeconds.Valid {
+			interval = m.PollingIntervalSeconds.Int32
+		}
+		if summary.Monitors == 0 || interval < summary.ShortestIntervalSeconds {
+			summary.ShortestIntervalSeconds = interval
+		}
+		summary.Monitors++
+	}
+	return summary, nil
+}
+
+func (q *fakeQuerier) UpdateMonitorStatus(ctx context.Context, arg dbgen.UpdateMonitorStatusParams) error {
+	if err := q.read("UpdateMonitorStatus", arg); err != nil {
+		return err
+	}
+	defer q.mu.Unlock()
+	m, ok := q.monitors[arg.ID]
+	if !ok || m.DeletedAt.Valid {
+		return nil
+	}
+	m.Status = arg.Status
+	trackOutage(&m)
+	m.UpdatedAt = pgtype.Timestamptz{Time: time.Now(), Valid: true}
+	q.monitors[arg.ID] = m
+	return nil
+}
+
+func (q *fakeQuerier) ArchiveDownMonitors(ctx context.Context, downBefore time.Time) ([]dbgen.ArchiveDownMonitorsRow, error) {
+	if err := q.read("ArchiveDownMonitors", downBefore); err != nil {
+		return nil, err
+	}
+	defer q.mu.Unlock()
+	var rows []dbgen.ArchiveDownMonitorsRow
+	for _, m := range q.liveMonitors(func(m dbgen.Monitor) bool {
+		return m.Status.String == "down" && !m.KeepPollingWhenDown && m.DownSince.Valid && m.DownSince.Time.Before(downBefore)
+	}) {
+		m.Status = pgtype.Text{String: "archived", Valid: true}
+		m.ArchivedAt = pgtype.Timestamptz{Time: time.Now(), Valid: true}
+		m.UpdatedAt = m.ArchivedAt
+		q.monitors[m.ID] = m
+		rows = append(rows, dbgen.ArchiveDownMonitorsRow{ID: m.ID, IpAddress: m.IpAddress})
+	}
+	return rows, nil
+}
+
+// Monitor state history and metrics
+
+func (q *fakeQuerier) InsertMonitorStateChange(ctx context.Context, arg dbgen.InsertMonitorStateChangeParams) error {
+	if err := q.read("InsertMonitorStateChange", arg); err != nil {
+		return err
+	}
+	defer q.mu.Unlock()
+	q.history = append(q.history, dbgen.MonitorStateHistory{
+		ID:         int64(len(q.history) + 1),
+		MonitorID:  arg.MonitorID,
+		EventType:  arg.EventType,
+		Failures:   arg.Failures,
+		OccurredAt: arg.OccurredAt,
+	})
+	return nil
+}
+
+func (q *fakeQuerier) DeleteMonitorStateHistoryBefore(ctx context.Context, cutoff time.Time) (int64, error) {
+	if err := q.read("DeleteMonitorStateHistoryBefore", cutoff); err != nil {
+		return 0, err
+	}
+	defer q.mu.Unlock()
+	kept := slices.DeleteFunc(q.history, func(h dbgen.MonitorStateHistory) bool { return h.OccurredAt.Before(cutoff) })
+	deleted := len(q.history) - len(kept)
+	q.history = kept
+	return int64(deleted), nil
+}
+
+// deleteOlder removes up to limit rows stamped before cutoff, returning the kept rows and
+// how many were deleted
+func deleteOlder[T any](rows []T, at func(T) time.Time, cutoff time.Time, limit int32) ([]T, int64) {
+	var deleted int64
+	kept := slices.DeleteFunc(rows, func(row T) bool {
+		if deleted < int64(limit) && at(row).Before(cutoff) {
+			deleted++
+			return true
+		}
+		return false
+	})
+	return kept, deleted
+}
+
+func (q *fakeQuerier) DeleteMetricsOlderThan(ctx context.Context, arg dbgen.DeleteMetricsOlderThanParams) (int64, error) {
+	if err := q.read("DeleteMetricsOlderThan", arg); err != nil {
+		return 0, err
+	}
+	defer q.mu.Unlock()
+	var deleted int64
+	q.metrics, deleted = deleteOlder(q.metrics, func(m dbgen.Metric) time.Time { return m.Timestamp }, arg.Cutoff, arg.LimitCount)
+	return deleted, nil
+}
+
+func (q *fakeQuerier) DeleteMetricRollupsOlderThan(ctx context.Context, arg dbgen.DeleteMetricRollupsOlderThanParams) (int64, error) {
+	if err := q.read("DeleteMetricRollupsOlderThan", arg); err != nil {
+		return 0, err
+	}
+	defer q.mu.Unlock()
+	var deleted int64
+	q.rollups, deleted = deleteOlder(q.rollups, func(r dbgen.MetricsRollup) time.Time { return r.Bucket }, arg.Cutoff, arg.LimitCount)
+	return deleted, nil
+}
+
+func (q *fakeQuerier) GetNewestMetricTimestamp(ctx context.Context) (time.Time, error) {
+	if err := q.read("GetNewestMetricTimestamp", nil); err != nil {
+		return time.Time{}, err
+	}
+	defer q.mu.Unlock()
+	if len(q.metrics) == 0 {
+		return time.Time{}, pgx.ErrNoRows
+	}
+	return slices.MaxFunc(q.metrics, func(a, b dbgen.Metric) int { return a.Timestamp.Compare(b.Timestamp) }).Timestamp, nil
+}
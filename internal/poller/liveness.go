@@ -0,0 +1,279 @@
+package poller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"os"
+	"sync"
+	"sync/atomic"
+
+	"github.com/nmslite/nmslite/internal/globals"
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+// Liveness methods selectable globally or per protocol
+const (
+	LivenessTCP  = "tcp"  // TCP connect to the monitor's port
+	LivenessICMP = "icmp" // ICMP echo (for devices only reachable over UDP, e.g. SNMP)
+	LivenessNone = "none" // Skip liveness, always poll
+)
+
+// errICMPUnavailable is returned when the process cannot open an ICMP socket
+var errICMPUnavailable = errors.New("icmp socket unavailable")
+
+// resolveLivenessMethod returns the liveness method for a plugin/protocol.
+// Per-protocol overrides win over the scheduler default, which defaults to TCP.
+func resolveLivenessMethod(cfg *globals.SchedulerConfig, pluginID string) string {
+	if method, ok := cfg.ProtocolLivenessMethods[pluginID]; ok && isValidLivenessMethod(method) {
+		return method
+	}
+	if isValidLivenessMethod(cfg.LivenessMethod) {
+		return cfg.LivenessMethod
+	}
+	return LivenessTCP
+}
+
+func isValidLivenessMethod(method string) bool {
+	switch method {
+	case LivenessTCP, LivenessICMP, LivenessNone:
+		return true
+	}
+	return false
+}
+
+// livenessResult is the outcome of one monitor's liveness probe
+type livenessResult struct {
+	sm    *ScheduledMonitor
+	alive bool
+}
+
+// livenessCheck probes a single monitor
+type livenessCheck func(ctx context.Context, sm *ScheduledMonitor) bool
+
+// checkLivenessEach probes every monitor on its own goroutine, at most cap(sem) at a time
+func checkLivenessEach(ctx context.Context, sem chan struct{}, monitors []*ScheduledMonitor, check livenessCheck) []livenessResult {
+	resultsChan := make(chan livenessResult, len(monitors))
+
+	var wg sync.WaitGroup
+	for _, sm := range monitors {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			select {
+			case sem <- struct{}{}:
+				defer func() { <-sem }()
+			case <-ctx.Done():
+				// Buffered to len(monitors), so this never blocks
+				resultsChan <- livenessResult{sm: sm}
+				return
+			}
+
+			resultsChan <- livenessResult{sm: sm, alive: check(ctx, sm)}
+		}()
+	}
+	wg.Wait()
+	close(resultsChan)
+
+	results := make([]livenessResult, 0, len(monitors))
+	for result := range resultsChan {
+		results = append(results, result)
+	}
+	return results
+}
+
+// livenessJob is one monitor queued to a livenessPool
+type livenessJob struct {
+	ctx     context.Context
+	index   int
+	sm      *ScheduledMonitor
+	results chan<- livenessJobResult
+}
+
+type livenessJobResult struct {
+	index int
+	alive bool
+}
+
+// livenessPool probes monitors on a fixed set of workers, so a batch of thousands of
+// monitors does not start (and tear down) a goroutine per monitor every tick
+type livenessPool struct {
+	jobs chan livenessJob
+}
+
+// newLivenessPool starts workers that run check until ctx ends. Up to queue jobs wait
+// for a free worker before check blocks its caller.
+func newLivenessPool(ctx context.Context, workers, queue int, check livenessCheck) *livenessPool {
+	p := &livenessPool{jobs: make(chan livenessJob, queue)}
+	for range workers {
+		go func() {
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case job := <-p.jobs:
+					alive := job.ctx.Err() == nil && check(job.ctx, job.sm)
+					// Buffered to the batch size, so this never blocks
+					job.results <- livenessJobResult{index: job.index, alive: alive}
+				}
+			}
+		}()
+	}
+	return p
+}
+
+// check probes monitors on the pool. Monitors not probed by the time ctx ends (or the
+// pool stops) are reported as not alive.
+func (p *livenessPool) check(ctx context.Context, monitors []*ScheduledMonitor) []livenessResult {
+	results := make(chan livenessJobResult, len(monitors))
+	alive := make([]bool, len(monitors))
+
+	queued := 0
+enqueue:
+	for i, sm := range monitors {
+		select {
+		case p.jobs <- livenessJob{ctx: ctx, index: i, sm: sm, results: results}:
+			queued++
+		case <-ctx.Done():
+			break enqueue
+		}
+	}
+
+collect:
+	for range queued {
+		select {
+		case r := <-results:
+			alive[r.index] = r.alive
+		case <-ctx.Done():
+			break collect
+		}
+	}
+
+	out := make([]livenessResult, len(monitors))
+	for i, sm := range monitors {
+		out[i] = livenessResult{sm: sm, alive: alive[i]}
+	}
+	return out
+}
+
+// newLivenessDialer builds the dialer for a TCP probe of target. The connect timeout
+// comes from the probe's context; the configured source address is bound only when it
+// has the target's address family, since the other family could never connect.
+func newLivenessDialer(cfg *globals.SchedulerConfig, target netip.Addr) *net.Dialer {
+	dialer := &net.Dialer{KeepAlive: cfg.LivenessKeepAlive()}
+	if src := cfg.LivenessSource(); src.IsValid() && src.Is4() == target.Unmap().Is4() {
+		dialer.LocalAddr = &net.TCPAddr{IP: src.AsSlice()}
+	}
+	return dialer
+}
+
+// icmpSeq is shared across pings so concurrent probes can tell their replies apart
+var icmpSeq atomic.Uint32
+
+// pingICMP sends a single ICMP echo and waits for the matching reply until ctx expires.
+// It tries a raw socket first and falls back to an unprivileged datagram socket.
+// The echo is sent from source when it is valid and of the same address family.
+// Returns errICMPUnavailable if neither can be opened (e.g. missing CAP_NET_RAW).
+func pingICMP(ctx context.Context, addr, source netip.Addr) (bool, error) {
+	addr = addr.Unmap()
+
+	rawNetwork, udpNetwork, listenAddr := "ip4:icmp", "udp4", "0.0.0.0"
+	var echoType, replyType icmp.Type = ipv4.ICMPTypeEcho, ipv4.ICMPTypeEchoReply
+	proto := 1 // ICMP for IPv4
+	if addr.Is6() {
+		rawNetwork, udpNetwork, listenAddr = "ip6:ipv6-icmp", "udp6", "::"
+		echoType, replyType = ipv6.ICMPTypeEchoRequest, ipv6.ICMPTypeEchoReply
+		proto = 58 // ICMPv6
+	}
+	if source.IsValid() && source.Is4() == addr.Is4() {
+		listenAddr = source.String()
+	}
+
+	privileged := true
+	conn, err := icmp.ListenPacket(rawNetwork, listenAddr)
+	if err != nil {
+		privileged = false
+		conn, err = icmp.ListenPacket(udpNetwork, listenAddr)
+	}
+	if err != nil {
+		if errors.Is(err, os.ErrPermission) {
+			return false, fmt.Errorf("%w: %v", errICMPUnavailable, err)
+		}
+		return false, err
+	}
+	defer conn.Close()
+
+	var dst net.Addr = &net.IPAddr{IP: addr.AsSlice()}
+	if !privileged {
+		dst = &net.UDPAddr{IP: addr.AsSlice()}
+	}
+
+	seq := int(icmpSeq.Add(1) & 0xffff)
+	msg := icmp.Message{
+		Type: echoType,
+		Code: 0,
+		Body: &icmp.Echo{
+			ID:   os.Getpid() & 0xffff, // rewritten by the kernel for datagram sockets
+			Seq:  seq,
+			Data: []byte("nmslite-liveness"),
+		},
+	}
+	payload, err := msg.Marshal(nil)
+	if err != nil {
+		return false, err
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		if err := conn.SetDeadline(deadline); err != nil {
+			return false, err
+		}
+	}
+
+	if _, err := conn.WriteTo(payload, dst); err != nil {
+		return false, err
+	}
+
+	buf := make([]byte, 1500)
+	for {
+		n, peer, err := conn.ReadFrom(buf)
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				return false, nil
+			}
+			return false, err
+		}
+
+		if !peerMatches(peer, addr) {
+			continue
+		}
+
+		reply, err := icmp.ParseMessage(proto, buf[:n])
+		if err != nil || reply.Type != replyType {
+			continue
+		}
+		if echo, ok := reply.Body.(*icmp.Echo); ok && echo.Seq == seq {
+			return true, nil
+		}
+	}
+}
+
+// peerMatches reports whether a reply came from the probed address
+func peerMatches(peer net.Addr, addr netip.Addr) bool {
+	var ip net.IP
+	switch p := peer.(type) {
+	case *net.IPAddr:
+		ip = p.IP
+	case *net.UDPAddr:
+		ip = p.IP
+	default:
+		return false
+	}
+	peerAddr, ok := netip.AddrFromSlice(ip)
+	return ok && peerAddr.Unmap() == addr
+}
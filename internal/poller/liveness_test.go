@@ -0,0 +1,260 @@
+package poller
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"net/netip"
+	"runtime"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/nmslite/nmslite/internal/database/dbgen"
+	"github.com/nmslite/nmslite/internal/globals"
+)
+
+func TestResolveLivenessMethod(t *testing.T) {
+	cfg := &globals.SchedulerConfig{
+		LivenessMethod: "tcp",
+		ProtocolLivenessMethods: map[string]string{
+			"snmp-v2c": "icmp",
+			"ssh":      "none",
+			"snmp-v3":  "bogus",
+		},
+	}
+
+	testCases := []struct {
+		name     string
+		cfg      *globals.SchedulerConfig
+		pluginID string
+		expected string
+	}{
+		{"Protocol override to ICMP", cfg, "snmp-v2c", LivenessICMP},
+		{"Protocol override to none", cfg, "ssh", LivenessNone},
+		{"Invalid override falls back to default", cfg, "snmp-v3", LivenessTCP},
+		{"Unlisted protocol uses default", cfg, "windows-winrm", LivenessTCP},
+		{"Global ICMP default", &globals.SchedulerConfig{LivenessMethod: "icmp"}, "windows-winrm", LivenessICMP},
+		{"Empty config defaults to TCP", &globals.SchedulerConfig{}, "snmp-v2c", LivenessTCP},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := resolveLivenessMethod(tc.cfg, tc.pluginID); got != tc.expected {
+				t.Errorf("Expected %q, got %q", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestScheduledMonitorLivenessMethod(t *testing.T) {
+	s := &SchedulerImpl{
+		config: &globals.SchedulerConfig{
+			ProtocolLivenessMethods: map[string]string{"snmp-v2c": "icmp"},
+		},
+		logger:   slog.Default(),
+		monitors: make(map[int64]*ScheduledMonitor),
+	}
+
+	row := func(id int64, pluginID string) dbgen.GetMonitorWithCredentialsRow {
+		return dbgen.GetMonitorWithCredentialsRow{
+			ID:        id,
+			IpAddress: netip.MustParseAddr("192.0.2.1"),
+			PluginID:  pluginID,
+			Status:    pgtype.Text{String: "active", Valid: true},
+		}
+	}
+
+	s.updateMonitorCacheFromRow(row(1, "snmp-v2c"))
+	s.updateMonitorCacheFromRow(row(2, "windows-winrm"))
+
+	if got := s.monitors[1].LivenessMethod; got != LivenessICMP {
+		t.Errorf("Expected SNMP monitor to use %q, got %q", LivenessICMP, got)
+	}
+	if got := s.monitors[2].LivenessMethod; got != LivenessTCP {
+		t.Errorf("Expected WinRM monitor to use %q, got %q", LivenessTCP, got)
+	}
+
+	// Re-pushing with a different plugin re-resolves the method
+	s.updateMonitorCacheFromRow(row(1, "windows-winrm"))
+	if got := s.monitors[1].LivenessMethod; got != LivenessTCP {
+		t.Errorf("Expected updated monitor to use %q, got %q", LivenessTCP, got)
+	}
+}
+
+func TestCheckLivenessTCPSourceAddress(t *testing.T) {
+	ln, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer ln.Close()
+
+	peers := make(chan netip.Addr, 4)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			peers <- conn.RemoteAddr().(*net.TCPAddr).AddrPort().Addr().Unmap()
+			conn.Close()
+		}
+	}()
+	port := int32(ln.Addr().(*net.TCPAddr).Port)
+
+	testCases := []struct {
+		name      string
+		source    string
+		wantAlive bool
+		wantPeer  string
+	}{
+		{"Unbound uses OS routing", "", true, "127.0.0.1"},
+		{"Bound to a local address", "127.0.0.2", true, "127.0.0.2"},
+		{"Other family is not bound", "::1", true, "127.0.0.1"},
+		{"Address not on this host", "192.0.2.1", false, ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			s := &SchedulerImpl{
+				config: &globals.SchedulerConfig{
+					LivenessTimeoutMS:     500,
+					LivenessSourceAddress: tc.source,
+				},
+				logger: slog.Default(),
+			}
+			sm := &ScheduledMonitor{Monitor: &dbgen.Monitor{
+				ID:        1,
+				IpAddress: netip.MustParseAddr("127.0.0.1"),
+				Port:      pgtype.Int4{Int32: port, Valid: true},
+			}}
+
+			if alive := s.checkLivenessTCP(context.Background(), sm); alive != tc.wantAlive {
+				t.Fatalf("Expected alive=%v, got %v", tc.wantAlive, alive)
+			}
+			if !tc.wantAlive {
+				return
+			}
+			select {
+			case peer := <-peers:
+				if peer.String() != tc.wantPeer {
+					t.Errorf("Expected probe from %s, got %s", tc.wantPeer, peer)
+				}
+			case <-time.After(time.Second):
+				t.Error("Expected the listener to accept the probe")
+			}
+		})
+	}
+}
+
+func TestLivenessPoolCheck(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var running, peak atomic.Int32
+	pool := newLivenessPool(ctx, 4, 2, func(ctx context.Context, sm *ScheduledMonitor) bool {
+		n := running.Add(1)
+		defer running.Add(-1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		time.Sleep(time.Millisecond)
+		return sm.Monitor.ID%2 == 0
+	})
+
+	monitors := make([]*ScheduledMonitor, 50)
+	for i := range monitors {
+		monitors[i] = &ScheduledMonitor{Monitor: &dbgen.Monitor{ID: int64(i)}}
+	}
+
+	results := pool.check(ctx, monitors)
+	if len(results) != len(monitors) {
+		t.Fatalf("Expected %d results, got %d", len(monitors), len(results))
+	}
+	for i, r := range results {
+		if r.sm != monitors[i] || r.alive != (r.sm.Monitor.ID%2 == 0) {
+			t.Errorf("Unexpected result for monitor %d: alive=%v", r.sm.Monitor.ID, r.alive)
+		}
+	}
+	if p := peak.Load(); p > 4 {
+		t.Errorf("Expected at most 4 concurrent probes, got %d", p)
+	}
+}
+
+func TestLivenessPoolCheckCancelled(t *testing.T) {
+	poolCtx, stopPool := context.WithCancel(context.Background())
+	defer stopPool()
+	// The probe outlives the batch, as one ignoring its context would
+	release := make(chan struct{})
+	defer close(release)
+	pool := newLivenessPool(poolCtx, 1, 1, func(ctx context.Context, sm *ScheduledMonitor) bool {
+		<-release
+		return true
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	monitors := []*ScheduledMonitor{
+		{Monitor: &dbgen.Monitor{ID: 1}},
+		{Monitor: &dbgen.Monitor{ID: 2}},
+		{Monitor: &dbgen.Monitor{ID: 3}},
+	}
+	results := pool.check(ctx, monitors)
+	if len(results) != len(monitors) {
+		t.Fatalf("Expected %d results, got %d", len(monitors), len(results))
+	}
+	for _, r := range results {
+		if r.alive {
+			t.Errorf("Expected monitor %d to be reported down after cancellation", r.sm.Monitor.ID)
+		}
+	}
+}
+
+// BenchmarkLivenessBatch compares peak goroutine counts for one 5000-monitor batch:
+// a goroutine per monitor versus the fixed pool used by batched liveness
+func BenchmarkLivenessBatch(b *testing.B) {
+	const batchSize, workers = 5000, 100
+
+	monitors := make([]*ScheduledMonitor, batchSize)
+	for i := range monitors {
+		monitors[i] = &ScheduledMonitor{Monitor: &dbgen.Monitor{ID: int64(i)}}
+	}
+
+	var peak atomic.Int64
+	check := func(ctx context.Context, sm *ScheduledMonitor) bool {
+		n := int64(runtime.NumGoroutine())
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		return true
+	}
+
+	b.Run("goroutine-per-monitor", func(b *testing.B) {
+		peak.Store(0)
+		sem := make(chan struct{}, workers)
+		for b.Loop() {
+			checkLivenessEach(context.Background(), sem, monitors, check)
+		}
+		b.ReportMetric(float64(peak.Load()), "peak-goroutines")
+	})
+
+	b.Run("pool", func(b *testing.B) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		pool := newLivenessPool(ctx, workers, 50, check)
+
+		peak.Store(0)
+		for b.Loop() {
+			pool.check(ctx, monitors)
+		}
+		b.ReportMetric(float64(peak.Load()), "peak-goroutines")
+	})
+}
@@ -0,0 +1,54 @@
+package poller
+
+import (
+	"path"
+
+	"github.com/nmslite/nmslite/internal/globals"
+)
+
+// MetricFilter keeps or drops metrics by name using glob patterns (path.Match syntax).
+// Metric names are dotted, so "system.cpu.*" matches every name under system.cpu.
+type MetricFilter struct {
+	include []string
+	exclude []string
+}
+
+// NewMetricFilter creates a filter from include and exclude patterns; patterns are
+// checked by Config.Validate, and a malformed one never matches
+func NewMetricFilter(include, exclude []string) *MetricFilter {
+	return &MetricFilter{include: include, exclude: exclude}
+}
+
+// Allows reports whether name passes the filter: it must match an include pattern when
+// any are set, and must match no exclude pattern
+func (f *MetricFilter) Allows(name string) bool {
+	if len(f.include) > 0 && !matchesAny(f.include, name) {
+		return false
+	}
+	return !matchesAny(f.exclude, name)
+}
+
+// Apply removes the records the filter does not allow and returns the kept records
+// along with how many were removed
+func (f *MetricFilter) Apply(records []globals.MetricRecord) ([]globals.MetricRecord, int) {
+	if len(f.include) == 0 && len(f.exclude) == 0 {
+		return records, 0
+	}
+	kept := records[:0]
+	for _, record := range records {
+		if f.Allows(record.Name) {
+			kept = append(kept, record)
+		}
+	}
+	return kept, len(records) - len(kept)
+}
+
+// matchesAny reports whether name matches one of patterns
+func matchesAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
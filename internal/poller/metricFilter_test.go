@@ -0,0 +1,60 @@
+package poller
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestMetricFilter(t *testing.T) {
+	names := []string{
+		"system.cpu.usage",
+		"system.cpu.core.0.usage",
+		"system.cpu.core.127.usage",
+		"system.memory.used_bytes",
+		"network.eth0.bytes_recv",
+	}
+
+	testCases := []struct {
+		name         string
+		include      []string
+		exclude      []string
+		wantKept     []string
+		wantFiltered int
+	}{
+		{"No patterns keeps everything", nil, nil, names, 0},
+		{
+			"Include only", []string{"system.cpu.*"}, nil,
+			[]string{"system.cpu.usage", "system.cpu.core.0.usage", "system.cpu.core.127.usage"}, 2,
+		},
+		{
+			"Exclude only", nil, []string{"system.cpu.core.*"},
+			[]string{"system.cpu.usage", "system.memory.used_bytes", "network.eth0.bytes_recv"}, 2,
+		},
+		{
+			"Include and exclude", []string{"system.*"}, []string{"system.cpu.core.*"},
+			[]string{"system.cpu.usage", "system.memory.used_bytes"}, 3,
+		},
+		{
+			"Several includes", []string{"system.memory.*", "network.*.bytes_*"}, nil,
+			[]string{"system.memory.used_bytes", "network.eth0.bytes_recv"}, 3,
+		},
+		{"Exact name excluded", nil, []string{"system.cpu.usage"}, names[1:], 1},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			kept, filtered := NewMetricFilter(tc.include, tc.exclude).Apply(records(names...))
+
+			var keptNames []string
+			for _, r := range kept {
+				keptNames = append(keptNames, r.Name)
+			}
+			if !slices.Equal(keptNames, tc.wantKept) {
+				t.Errorf("Expected %v kept, got %v", tc.wantKept, keptNames)
+			}
+			if filtered != tc.wantFiltered {
+				t.Errorf("Expected %d filtered, got %d", tc.wantFiltered, filtered)
+			}
+		})
+	}
+}
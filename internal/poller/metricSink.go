@@ -0,0 +1,111 @@
+package poller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sync"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/nmslite/nmslite/internal/globals"
+)
+
+// MetricSink is the storage backend BatchWriter writes through. PostgresSink, the
+// default, COPYs into the metrics table; other backends (a TSDB, remote write, a file)
+// only need to implement WriteMetrics.
+type MetricSink interface {
+	// WriteMetrics stores batch atomically: on error none of it is stored. Errors caused
+	// by the records themselves must wrap ErrMetricsRejected (PostgreSQL data errors are
+	// recognized as such) so BatchWriter can isolate and drop the offending records; any
+	// other error is treated as transient and the batch is retried.
+	WriteMetrics(ctx context.Context, batch []globals.MetricRecord) error
+}
+
+// ErrMetricsRejected marks a sink error caused by the records rather than the backend
+var ErrMetricsRejected = errors.New("metrics rejected by sink")
+
+// PostgresSink writes metrics to the metrics table with the COPY protocol
+type PostgresSink struct {
+	pool   *pgxpool.Pool
+	logger *slog.Logger
+}
+
+// NewPostgresSink creates a sink writing through pool
+func NewPostgresSink(pool *pgxpool.Pool) *PostgresSink {
+	return &PostgresSink{pool: pool, logger: slog.Default()}
+}
+
+// WriteMetrics copies batch into the metrics table in a single transaction
+func (s *PostgresSink) WriteMetrics(ctx context.Context, batch []globals.MetricRecord) error {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		if err := tx.Rollback(ctx); err != nil && !errors.Is(err, pgx.ErrTxClosed) {
+			s.logger.Warn("failed to rollback transaction", "error", err)
+		}
+	}()
+
+	// Use COPY protocol for bulk insert - key-value format with type
+	copyCount, err := tx.Conn().CopyFrom(
+		ctx,
+		pgx.Identifier{"metrics"},
+		[]string{"timestamp", "device_id", "name", "value", "type", "unit", "tags"},
+		pgx.CopyFromSlice(len(batch), func(i int) ([]interface{}, error) {
+			record := batch[i]
+			var tags interface{}
+			if len(record.Tags) > 0 {
+				tags = record.Tags
+			}
+			return []interface{}{
+				record.Timestamp,
+				record.MonitorID,
+				record.Name,
+				record.Value,
+				record.Type,
+				pgtype.Text{String: record.Unit, Valid: record.Unit != ""},
+				tags,
+			}, nil
+		}),
+	)
+
+	if err != nil {
+		return fmt.Errorf("COPY operation failed: %w", err)
+	}
+
+	if copyCount != int64(len(batch)) {
+		return fmt.Errorf("COPY count mismatch: expected %d, got %d", len(batch), copyCount)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// MemorySink keeps written metrics in memory, for tests and dry runs
+type MemorySink struct {
+	mu      sync.Mutex
+	records []globals.MetricRecord
+}
+
+// WriteMetrics appends batch to the sink
+func (s *MemorySink) WriteMetrics(ctx context.Context, batch []globals.MetricRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records = append(s.records, batch...)
+	return nil
+}
+
+// Records returns a copy of everything written so far, in write order
+func (s *MemorySink) Records() []globals.MetricRecord {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.records)
+}
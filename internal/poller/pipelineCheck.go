@@ -0,0 +1,167 @@
+package poller
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/nmslite/nmslite/internal/database/dbgen"
+	"github.com/nmslite/nmslite/internal/globals"
+)
+
+// PipelineCheck periodically confirms that metrics make it from polls into storage.
+// While reachable monitors exist, the newest stored metric must be no older than their
+// shortest polling interval times scheduler.stale_after_intervals. This catches a stalled
+// BatchWriter or every plugin failing, which the liveness and database checks miss.
+type PipelineCheck struct {
+	querier dbgen.Querier
+	logger  *slog.Logger
+
+	interval  time.Duration
+	intervals int // polling intervals without a stored metric before degraded
+	lo, hi    time.Duration
+
+	now     func() time.Time
+	started time.Time
+
+	mu     sync.RWMutex
+	health globals.PipelineHealth
+}
+
+// NewPipelineCheck creates a new PipelineCheck instance
+func NewPipelineCheck(querier dbgen.Querier) *PipelineCheck {
+	cfg := globals.GetConfig()
+
+	intervals := cfg.Scheduler.StaleAfter()
+	if intervals <= 0 {
+		intervals = 3
+	}
+	lo, hi := cfg.Scheduler.PollingIntervalBounds()
+
+	pc := &PipelineCheck{
+		querier:   querier,
+		logger:    slog.Default().With("component", "pipeline_check"),
+		interval:  cfg.Metrics.PipelineCheckInterval(),
+		intervals: intervals,
+		lo:        lo,
+		hi:        hi,
+		now:       time.Now,
+		started:   time.Now(),
+		health:    globals.PipelineHealth{Status: globals.PipelineUnknown},
+	}
+	if !pc.Enabled() {
+		pc.health.Status = globals.PipelineDisabled
+	}
+	return pc
+}
+
+// Enabled reports whether the check is configured to run
+func (pc *PipelineCheck) Enabled() bool {
+	return pc.interval > 0
+}
+
+// PipelineHealth returns the result of the latest check
+func (pc *PipelineCheck) PipelineHealth() globals.PipelineHealth {
+	pc.mu.RLock()
+	defer pc.mu.RUnlock()
+	return pc.health
+}
+
+// Run starts the check loop and blocks until context is cancelled
+func (pc *PipelineCheck) Run(ctx context.Context) error {
+	if !pc.Enabled() {
+		pc.logger.Info("pipeline check disabled")
+		return nil
+	}
+
+	pc.logger.Info("pipeline check starting",
+		"interval", pc.interval,
+		"window_intervals", pc.intervals,
+	)
+
+	ticker := time.NewTicker(pc.interval)
+	defer ticker.Stop()
+
+	pc.check(ctx)
+
+	for {
+		select {
+		case <-ctx.Done():
+			pc.logger.Info("pipeline check shutting down")
+			return ctx.Err()
+		case <-ticker.C:
+			pc.check(ctx)
+		}
+	}
+}
+
+// check compares the newest stored metric against the window implied by the reachable
+// monitors and records the result
+func (pc *PipelineCheck) check(ctx context.Context) {
+	now := pc.now()
+	health := globals.PipelineHealth{Status: globals.PipelineUnknown, CheckedAt: &now}
+	defer func() {
+		// A check cut short by shutdown says nothing about the pipeline
+		if ctx.Err() == nil {
+			pc.record(health)
+		}
+	}()
+
+	summary, err := pc.querier.GetPolledMonitorSummary(ctx)
+	if err != nil {
+		health.Error = err.Error()
+		return
+	}
+	health.PolledMonitors = summary.Monitors
+	if summary.Monitors == 0 {
+		health.Status = globals.PipelineIdle
+		return
+	}
+
+	// Stored intervals outside the bounds are clamped by the scheduler too
+	shortest := min(max(time.Duration(summary.ShortestIntervalSeconds)*time.Second, pc.lo), pc.hi)
+	window := shortest * time.Duration(pc.intervals)
+	health.WindowSeconds = int64(window.Seconds())
+
+	latest, err := pc.querier.GetNewestMetricTimestamp(ctx)
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+	case err != nil:
+		health.Error = err.Error()
+		return
+	default:
+		health.LatestMetric = &latest
+	}
+
+	health.Status = globals.PipelineOK
+	// Monitors get a full window after startup to produce their first metrics
+	stale := health.LatestMetric == nil || now.Sub(latest) > window
+	if stale && now.Sub(pc.started) > window {
+		health.Status = globals.PipelineDegraded
+	}
+}
+
+// record stores the result of a check and logs status changes
+func (pc *PipelineCheck) record(health globals.PipelineHealth) {
+	pc.mu.Lock()
+	previous := pc.health.Status
+	pc.health = health
+	pc.mu.Unlock()
+
+	switch {
+	case health.Error != "":
+		pc.logger.Warn("pipeline check failed", "error", health.Error)
+	case health.Status == previous:
+	case health.Status == globals.PipelineDegraded:
+		pc.logger.Error("no metrics written recently despite reachable monitors",
+			"polled_monitors", health.PolledMonitors,
+			"latest_metric", health.LatestMetric,
+			"window_seconds", health.WindowSeconds,
+		)
+	case previous == globals.PipelineDegraded:
+		pc.logger.Info("metrics are being written again", "status", health.Status)
+	}
+}
@@ -0,0 +1,91 @@
+package poller
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/nmslite/nmslite/internal/database/dbgen"
+	"github.com/nmslite/nmslite/internal/globals"
+)
+
+func TestPipelineCheck(t *testing.T) {
+	globals.SetGlobalConfigForTests(&globals.Config{Metrics: globals.MetricsConfig{PipelineCheckIntervalSeconds: 30}})
+
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	polled := dbgen.GetPolledMonitorSummaryRow{Monitors: 5, ShortestIntervalSeconds: 60}
+
+	testCases := []struct {
+		name       string
+		summary    dbgen.GetPolledMonitorSummaryRow
+		latest     time.Time
+		latestErr  error
+		uptime     time.Duration
+		wantStatus string
+		wantWindow int64
+	}{
+		{"No reachable monitors", dbgen.GetPolledMonitorSummaryRow{}, time.Time{}, nil, time.Hour, globals.PipelineIdle, 0},
+		{"Recent metrics", polled, now.Add(-2 * time.Minute), nil, time.Hour, globals.PipelineOK, 180},
+		{"Metrics stopped", polled, now.Add(-4 * time.Minute), nil, time.Hour, globals.PipelineDegraded, 180},
+		{"No metrics ever written", polled, time.Time{}, nil, time.Hour, globals.PipelineDegraded, 180},
+		{"Just started", polled, now.Add(-time.Hour), nil, time.Minute, globals.PipelineOK, 180},
+		{"Interval below bounds is clamped", dbgen.GetPolledMonitorSummaryRow{Monitors: 1, ShortestIntervalSeconds: 1}, now.Add(-time.Minute), nil, time.Hour, globals.PipelineDegraded, 30},
+		{"Query failed", polled, time.Time{}, errors.New("connection refused"), time.Hour, globals.PipelineUnknown, 180},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			q := newFakeQuerier()
+			for id := int64(1); id <= tc.summary.Monitors; id++ {
+				q.addMonitor(id, "192.0.2.1", "active")
+				m := q.monitors[id]
+				m.PollingIntervalSeconds.Int32 = tc.summary.ShortestIntervalSeconds
+				q.monitors[id] = m
+			}
+			if !tc.latest.IsZero() {
+				q.metrics = []dbgen.Metric{{Timestamp: tc.latest.Add(-time.Minute)}, {Timestamp: tc.latest}}
+			}
+			if tc.latestErr != nil {
+				q.fail["GetNewestMetricTimestamp"] = tc.latestErr
+			}
+			pc := NewPipelineCheck(q)
+			pc.now = func() time.Time { return now }
+			pc.started = now.Add(-tc.uptime)
+
+			if got := pc.PipelineHealth().Status; got != globals.PipelineUnknown {
+				t.Errorf("Expected status %q before the first check, got %q", globals.PipelineUnknown, got)
+			}
+			pc.check(context.Background())
+
+			health := pc.PipelineHealth()
+			if health.Status != tc.wantStatus {
+				t.Errorf("Expected status %q, got %q (%+v)", tc.wantStatus, health.Status, health)
+			}
+			if health.WindowSeconds != tc.wantWindow {
+				t.Errorf("Expected window %ds, got %ds", tc.wantWindow, health.WindowSeconds)
+			}
+			if health.PolledMonitors != tc.summary.Monitors {
+				t.Errorf("Expected %d polled monitors, got %d", tc.summary.Monitors, health.PolledMonitors)
+			}
+			if (health.Error != "") != (tc.latestErr != nil) {
+				t.Errorf("Expected error %v, got %q", tc.latestErr, health.Error)
+			}
+		})
+	}
+}
+
+func TestPipelineCheckDisabled(t *testing.T) {
+	globals.SetGlobalConfigForTests(&globals.Config{Metrics: globals.MetricsConfig{PipelineCheckIntervalSeconds: -1}})
+
+	pc := NewPipelineCheck(newFakeQuerier())
+	if pc.Enabled() {
+		t.Error("Expected a negative interval to disable the check")
+	}
+	if err := pc.Run(context.Background()); err != nil {
+		t.Errorf("Expected a disabled check to return immediately, got %v", err)
+	}
+	if got := pc.PipelineHealth().Status; got != globals.PipelineDisabled {
+		t.Errorf("Expected status %q, got %q", globals.PipelineDisabled, got)
+	}
+}
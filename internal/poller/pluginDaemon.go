@@ -0,0 +1,427 @@
+package poller
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/nmslite/nmslite/internal/globals"
+)
+
+// PluginModeEnv tells a plugin how it was started: "daemon" when it is kept running and
+// reads batches as JSON lines (docs/plugin-daemon-protocol.md); unset for one batch per process
+const PluginModeEnv = "NMSLITE_PLUGIN_MODE"
+
+// daemonStopTimeout is how long a daemon may take to exit after its stdin is closed
+// before it is killed
+const daemonStopTimeout = 2 * time.Second
+
+// ErrPluginDaemonUnresponsive is returned when a daemon produced no output at all while a
+// batch sent to it timed out; the daemon is killed and restarted on the next batch
+var ErrPluginDaemonUnresponsive = errors.New("plugin daemon unresponsive")
+
+// daemonRequest is one batch written to a daemon's stdin, as a single line
+type daemonRequest struct {
+	ID    uint64             `json:"id"`
+	Tasks []globals.PollTask `json:"tasks"`
+}
+
+// daemonResponse is one line of a daemon's stdout, answering the request with the same ID
+type daemonResponse struct {
+	ID      uint64               `json:"id"`
+	Results []globals.PollResult `json:"results"`
+	Error   string               `json:"error,omitempty"`
+}
+
+// pluginDaemon keeps one daemon-mode plugin running, starting it on first use and again
+// whenever it has exited. Batches are multiplexed over the one process by request ID.
+type pluginDaemon struct {
+	m      *PluginManager
+	plugin *globals.PluginInfo
+	nextID atomic.Uint64
+
+	mu      sync.Mutex
+	proc    *daemonProcess
+	started bool // a process was started before, so the next one is a restart
+	closed  bool
+}
+
+// daemonProcess is one running instance of a daemon plugin
+type daemonProcess struct {
+	cmd     *exec.Cmd
+	cancel  context.CancelFunc
+	writeMu sync.Mutex
+	stdin   io.WriteCloser
+	stdout  *io.PipeReader
+	stderr  *io.PipeReader
+
+	mu      sync.Mutex
+	pending map[uint64]chan daemonResponse
+
+	// lastOutput is when the daemon last wrote a response line (Unix nanoseconds)
+	lastOutput atomic.Int64
+	stderrTail atomic.Value  // string, the last line written to stderr
+	stderrRead chan struct{} // closed once readStderr has consumed all of stderr
+
+	// done is closed once the process has exited; err then says why
+	done  chan struct{}
+	err   error
+	cause atomic.Pointer[error] // set when the core kills the process on purpose; the first cause wins
+}
+
+// daemonFor returns the running daemon for plugin, or nil if the plugin is run once per batch
+func (m *PluginManager) daemonFor(plugin *globals.PluginInfo) *pluginDaemon {
+	if !plugin.Daemon || m.daemonsDisabled {
+		return nil
+	}
+	m.daemonsMu.Lock()
+	defer m.daemonsMu.Unlock()
+
+	if d, ok := m.daemons[plugin.BinaryPath]; ok {
+		return d
+	}
+	d := &pluginDaemon{m: m, plugin: plugin}
+	m.daemons[plugin.BinaryPath] = d
+	return d
+}
+
+// Close stops every daemon-mode plugin: each gets its stdin closed and is killed if it
+// has not exited within daemonStopTimeout. Batches still running fail.
+func (m *PluginManager) Close() {
+	m.daemonsMu.Lock()
+	daemons := make([]*pluginDaemon, 0, len(m.daemons))
+	for _, d := range m.daemons {
+		daemons = append(daemons, d)
+	}
+	m.daemonsMu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, d := range daemons {
+		wg.Add(1)
+		go func(d *pluginDaemon) {
+			defer wg.Done()
+			d.stop()
+		}(d)
+	}
+	wg.Wait()
+}
+
+// poll sends tasks to the daemon and waits for its answer. The daemon is started (or
+// restarted) first if it is not running.
+func (d *pluginDaemon) poll(ctx context.Context, tasks []globals.PollTask) ([]globals.PollResult, error) {
+	proc, err := d.running(ctx)
+	if err != nil {
+		d.m.logger.Error("Plugin daemon start failed",
+			"protocol", d.plugin.Protocol,
+			"binary", d.plugin.BinaryPath,
+			"error", err,
+		)
+		return nil, err
+	}
+
+	id := d.nextID.Add(1)
+	line, err := json.Marshal(daemonRequest{ID: id, Tasks: tasks})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal tasks: %w", err)
+	}
+
+	reply := make(chan daemonResponse, 1)
+	if !proc.register(id, reply) {
+		return nil, proc.err
+	}
+	defer proc.unregister(id)
+
+	d.m.logger.Debug("Sending batch to plugin daemon", "protocol", d.plugin.Protocol, "id", id, "task_count", len(tasks))
+
+	sent := time.Now()
+	if err := proc.write(append(line, '\n')); err != nil {
+		// A broken pipe means the process is exiting; report why if it already has
+		select {
+		case <-proc.done:
+			return nil, proc.err
+		case <-time.After(100 * time.Millisecond):
+		}
+		return nil, fmt.Errorf("failed to write to plugin daemon: %w", err)
+	}
+
+	select {
+	case resp := <-reply:
+		if resp.Error != "" {
+			return nil, fmt.Errorf("plugin daemon failed batch: %s", resp.Error)
+		}
+		if resp.Results == nil {
+			resp.Results = []globals.PollResult{}
+		}
+		return resp.Results, nil
+	case <-proc.done:
+		return nil, proc.err
+	case <-ctx.Done():
+		// A daemon busy with other batches keeps running; one that has not written
+		// anything since this batch went out is presumed hung
+		if proc.lastOutput.Load() < sent.UnixNano() {
+			d.m.logger.Warn("Plugin daemon unresponsive, killing", "protocol", d.plugin.Protocol)
+			proc.kill(ErrPluginDaemonUnresponsive)
+		}
+		return nil, fmt.Errorf("plugin daemon batch %d: %w", id, ctx.Err())
+	}
+}
+
+// running returns the live process, starting a new one if there is none or it has exited
+func (d *pluginDaemon) running(ctx context.Context) (*daemonProcess, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.closed {
+		return nil, errors.New("plugin manager closed")
+	}
+	if d.proc != nil {
+		select {
+		case <-d.proc.done:
+		default:
+			return d.proc, nil
+		}
+	}
+
+	proc, err := d.start(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if d.started {
+		d.m.stats.recordRestart(d.plugin.Protocol)
+		d.m.logger.Warn("Restarted plugin daemon",
+			"protocol", d.plugin.Protocol,
+			"previous_exit", d.proc.err,
+		)
+	}
+	d.proc, d.started = proc, true
+	return proc, nil
+}
+
+// start launches the daemon, retrying transient spawn failures like a one-shot plugin.
+// The process outlives ctx, which only bounds the retries.
+func (d *pluginDaemon) start(ctx context.Context) (*daemonProcess, error) {
+	m := d.m
+	backoff := m.spawnBackoff
+	for attempt := 0; ; attempt++ {
+		runCtx, cancel := context.WithCancel(context.Background())
+		cmd := exec.CommandContext(runCtx, d.plugin.BinaryPath)
+		cmd.Dir = filepath.Dir(d.plugin.BinaryPath)
+		cmd.WaitDelay = time.Second
+		cmd.Env = append(os.Environ(), PluginModeEnv+"=daemon")
+
+		proc, err := newDaemonProcess(cmd, cancel)
+		if err == nil {
+			err = m.startFn(cmd)
+		}
+		if err == nil {
+			// CPU time accumulates over a daemon's life, so only the memory limit applies
+			guard := m.guardResources(runCtx, cancel, cmd.Process.Pid, d.plugin.Protocol, 0)
+			go proc.readStderr(d)
+			go proc.serve(m, d.plugin.Protocol, guard)
+			m.logger.Info("Started plugin daemon", "protocol", d.plugin.Protocol, "pid", cmd.Process.Pid)
+			return proc, nil
+		}
+		cancel()
+		err = fmt.Errorf("%w: %w", ErrPluginSpawn, err)
+
+		if attempt >= m.spawnRetries || !isTransientSpawnError(err) {
+			return nil, err
+		}
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) <= backoff {
+			return nil, err
+		}
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return nil, err
+		}
+		backoff *= 2
+	}
+}
+
+// stop closes the daemon's stdin, which asks it to exit, and kills it if it lingers
+func (d *pluginDaemon) stop() {
+	d.mu.Lock()
+	d.closed = true
+	proc := d.proc
+	d.mu.Unlock()
+	if proc == nil {
+		return
+	}
+
+	proc.writeMu.Lock()
+	proc.stdin.Close()
+	proc.writeMu.Unlock()
+
+	select {
+	case <-proc.done:
+	case <-time.After(daemonStopTimeout):
+		d.m.logger.Warn("Plugin daemon did not exit after stdin closed, killing", "protocol", d.plugin.Protocol)
+		proc.kill(errors.New("plugin manager closed"))
+		<-proc.done
+	}
+}
+
+// newDaemonProcess wires the pipes of a daemon command that has not been started yet.
+// stdout and stderr go through in-memory pipes, so cmd.Wait copies them and its
+// WaitDelay still applies when orphaned children hold them open.
+func newDaemonProcess(cmd *exec.Cmd, cancel context.CancelFunc) (*daemonProcess, error) {
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	p := &daemonProcess{
+		cmd:        cmd,
+		cancel:     cancel,
+		stdin:      stdin,
+		pending:    make(map[uint64]chan daemonResponse),
+		done:       make(chan struct{}),
+		stderrRead: make(chan struct{}),
+	}
+	var stdoutW, stderrW *io.PipeWriter
+	p.stdout, stdoutW = io.Pipe()
+	p.stderr, stderrW = io.Pipe()
+	cmd.Stdout, cmd.Stderr = stdoutW, stderrW
+	return p, nil
+}
+
+// serve reads response lines until the daemon exits, then records why it did and fails
+// every batch still waiting. Lines longer than the output limit kill the daemon.
+func (p *daemonProcess) serve(m *PluginManager, protocol string, guard *resourceGuard) {
+	waited := make(chan error, 1)
+	go func() {
+		err := p.cmd.Wait()
+		p.cmd.Stdout.(*io.PipeWriter).Close()
+		p.cmd.Stderr.(*io.PipeWriter).Close()
+		waited <- err
+	}()
+
+	reader := bufio.NewReader(p.stdout)
+	for {
+		line, err := readLimitedLine(reader, m.maxOutputBytes)
+		if errors.Is(err, ErrPluginOutputExceeded) {
+			m.logger.Warn("Plugin daemon killed: output exceeded limit", "protocol", protocol, "limit_bytes", m.maxOutputBytes)
+			p.kill(fmt.Errorf("%w (%d bytes)", ErrPluginOutputExceeded, m.maxOutputBytes))
+			break
+		}
+		if err != nil {
+			break
+		}
+
+		var resp daemonResponse
+		if err := json.Unmarshal(line, &resp); err != nil {
+			m.logger.Warn("Plugin daemon killed: malformed response", "protocol", protocol, "error", err)
+			p.kill(fmt.Errorf("failed to parse plugin daemon output: %w, output: %s", err, line))
+			break
+		}
+		p.lastOutput.Store(time.Now().UnixNano())
+
+		p.mu.Lock()
+		reply, ok := p.pending[resp.ID]
+		delete(p.pending, resp.ID)
+		p.mu.Unlock()
+		if !ok {
+			// The batch already timed out
+			m.logger.Debug("Discarding late plugin daemon response", "protocol", protocol, "id", resp.ID)
+			continue
+		}
+		reply <- resp
+	}
+
+	// Keep draining so the process is never blocked writing while it is reaped
+	io.Copy(io.Discard, p.stdout)
+	waitErr := <-waited
+	guard.stop()
+	p.cancel()
+
+	var exitErr error
+	if cause := p.cause.Load(); cause != nil {
+		exitErr = *cause
+	} else if reason := m.resourceLimitExceeded(p.cmd.ProcessState, guard); reason != "" {
+		m.logger.Warn("Plugin daemon killed: resource limit exceeded", "protocol", protocol, "reason", reason)
+		exitErr = fmt.Errorf("%w: %s", ErrPluginResourceLimit, reason)
+	} else {
+		// Wait closed the stderr pipe, so its last line is on the way
+		<-p.stderrRead
+		stderr, _ := p.stderrTail.Load().(string)
+		exitErr = fmt.Errorf("plugin daemon exited: %v, stderr: %s", waitErr, stderr)
+	}
+
+	p.mu.Lock()
+	p.err = exitErr
+	p.pending = nil
+	close(p.done)
+	p.mu.Unlock()
+}
+
+// readStderr logs the daemon's stderr line by line and keeps the last line for errors
+func (p *daemonProcess) readStderr(d *pluginDaemon) {
+	defer close(p.stderrRead)
+	scanner := bufio.NewScanner(p.stderr)
+	scanner.Buffer(make([]byte, 0, 4096), maxStderrBytes)
+	for scanner.Scan() {
+		p.stderrTail.Store(scanner.Text())
+		d.m.logger.Debug("Plugin daemon stderr", "protocol", d.plugin.Protocol, "line", scanner.Text())
+	}
+	// An overlong line stops the scanner; keep the pipe flowing regardless
+	io.Copy(io.Discard, p.stderr)
+}
+
+// register adds a batch awaiting a response; it fails once the process has exited
+func (p *daemonProcess) register(id uint64, reply chan daemonResponse) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.pending == nil {
+		return false
+	}
+	p.pending[id] = reply
+	return true
+}
+
+func (p *daemonProcess) unregister(id uint64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.pending, id)
+}
+
+// write sends one request line; lines from concurrent batches never interleave
+func (p *daemonProcess) write(line []byte) error {
+	p.writeMu.Lock()
+	defer p.writeMu.Unlock()
+	_, err := p.stdin.Write(line)
+	return err
+}
+
+// kill stops the process, reporting cause to the batches waiting on it
+func (p *daemonProcess) kill(cause error) {
+	p.cause.CompareAndSwap(nil, &cause)
+	p.cancel()
+}
+
+// readLimitedLine reads one newline-terminated line of at most limit bytes
+func readLimitedLine(r *bufio.Reader, limit int64) ([]byte, error) {
+	var line []byte
+	for {
+		chunk, err := r.ReadSlice('\n')
+		if int64(len(line)+len(chunk)) > limit {
+			return nil, ErrPluginOutputExceeded
+		}
+		line = append(line, chunk...)
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return line, nil
+	}
+}
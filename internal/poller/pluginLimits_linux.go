@@ -0,0 +1,63 @@
+package poller
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strconv"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// resourceLimitsSupported reports whether plugin CPU and memory limits are enforced here
+const resourceLimitsSupported = true
+
+// applyCPULimit caps a started process's CPU time with RLIMIT_CPU. The kernel sends
+// SIGXCPU at the limit and SIGKILL a second later if the process survives it.
+func applyCPULimit(pid int, limit time.Duration) error {
+	secs := uint64((limit + time.Second - 1) / time.Second)
+	return unix.Prlimit(pid, unix.RLIMIT_CPU, &unix.Rlimit{Cur: secs, Max: secs + 1}, nil)
+}
+
+// killedForCPU reports whether an exited process was stopped by its CPU limit: SIGXCPU
+// at the soft limit, or SIGKILL at the hard limit
+func killedForCPU(state *os.ProcessState, limit time.Duration) bool {
+	ws, ok := state.Sys().(syscall.WaitStatus)
+	if !ok || !ws.Signaled() {
+		return false
+	}
+	switch ws.Signal() {
+	case syscall.SIGXCPU:
+		return true
+	case syscall.SIGKILL:
+		return state.UserTime()+state.SystemTime() >= limit
+	}
+	return false
+}
+
+// processRSS returns a running process's resident set size in bytes
+func processRSS(pid int) (int64, error) {
+	data, err := os.ReadFile("/proc/" + strconv.Itoa(pid) + "/statm")
+	if err != nil {
+		return 0, err
+	}
+	fields := bytes.Fields(data)
+	if len(fields) < 2 {
+		return 0, fmt.Errorf("unexpected statm format: %q", data)
+	}
+	pages, err := strconv.ParseInt(string(fields[1]), 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	return pages * int64(os.Getpagesize()), nil
+}
+
+// peakRSS returns the largest resident set size an exited process reached, in bytes
+func peakRSS(state *os.ProcessState) int64 {
+	if usage, ok := state.SysUsage().(*syscall.Rusage); ok {
+		return usage.Maxrss << 10 // kilobytes on Linux
+	}
+	return 0
+}
@@ -0,0 +1,30 @@
+//go:build !linux
+
+package poller
+
+import (
+	"errors"
+	"os"
+	"time"
+)
+
+// resourceLimitsSupported reports whether plugin CPU and memory limits are enforced here
+const resourceLimitsSupported = false
+
+var errResourceLimitsUnsupported = errors.New("plugin resource limits are not supported on this platform")
+
+func applyCPULimit(pid int, limit time.Duration) error {
+	return errResourceLimitsUnsupported
+}
+
+func killedForCPU(state *os.ProcessState, limit time.Duration) bool {
+	return false
+}
+
+func processRSS(pid int) (int64, error) {
+	return 0, errResourceLimitsUnsupported
+}
+
+func peakRSS(state *os.ProcessState) int64 {
+	return 0
+}
@@ -0,0 +1,115 @@
+package poller
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/nmslite/nmslite/internal/globals"
+)
+
+// latencyBuckets are the upper bounds of the plugin latency histogram
+var latencyBuckets = []time.Duration{
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	2500 * time.Millisecond,
+	5 * time.Second,
+	10 * time.Second,
+	30 * time.Second,
+	60 * time.Second,
+}
+
+// pluginCounters holds one plugin's counters; all fields are updated atomically
+type pluginCounters struct {
+	invocations atomic.Int64
+	successes   atomic.Int64
+	failures    atomic.Int64
+	timeouts    atomic.Int64
+	limitKills  atomic.Int64
+	restarts    atomic.Int64 // daemon restarts, counted apart from executions
+	totalNanos  atomic.Int64
+	buckets     []atomic.Int64 // len(latencyBuckets)+1, last is +Inf; not cumulative
+}
+
+// pluginStats tracks execution metrics per protocol.
+// The map is only locked when a protocol is first seen; recording is lock-free.
+type pluginStats struct {
+	counters sync.Map // protocol -> *pluginCounters
+}
+
+func (s *pluginStats) get(protocol string) *pluginCounters {
+	if c, ok := s.counters.Load(protocol); ok {
+		return c.(*pluginCounters)
+	}
+	c, _ := s.counters.LoadOrStore(protocol, &pluginCounters{
+		buckets: make([]atomic.Int64, len(latencyBuckets)+1),
+	})
+	return c.(*pluginCounters)
+}
+
+// record counts one execution; ctx is the execution context, used to tell timeouts apart
+func (s *pluginStats) record(ctx context.Context, protocol string, duration time.Duration, err error) {
+	c := s.get(protocol)
+	c.invocations.Add(1)
+	c.totalNanos.Add(int64(duration))
+
+	switch {
+	case err == nil:
+		c.successes.Add(1)
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		c.timeouts.Add(1)
+	case errors.Is(err, ErrPluginResourceLimit):
+		c.limitKills.Add(1)
+	default:
+		c.failures.Add(1)
+	}
+
+	bucket := sort.Search(len(latencyBuckets), func(i int) bool { return duration <= latencyBuckets[i] })
+	c.buckets[bucket].Add(1)
+}
+
+// recordRestart counts a daemon-mode plugin process started in place of one that exited
+func (s *pluginStats) recordRestart(protocol string) {
+	s.get(protocol).restarts.Add(1)
+}
+
+// snapshot returns the current stats for every protocol seen so far
+func (s *pluginStats) snapshot() map[string]globals.PluginStats {
+	result := make(map[string]globals.PluginStats)
+	s.counters.Range(func(key, value any) bool {
+		protocol, c := key.(string), value.(*pluginCounters)
+
+		stats := globals.PluginStats{
+			Protocol:         protocol,
+			Invocations:      c.invocations.Load(),
+			Successes:        c.successes.Load(),
+			Failures:         c.failures.Load(),
+			Timeouts:         c.timeouts.Load(),
+			LimitKills:       c.limitKills.Load(),
+			DaemonRestarts:   c.restarts.Load(),
+			LatencyHistogram: make([]globals.LatencyBucket, 0, len(c.buckets)),
+		}
+		if stats.Invocations > 0 {
+			stats.AvgLatencyMS = float64(c.totalNanos.Load()) / float64(stats.Invocations) / float64(time.Millisecond)
+		}
+
+		var cumulative int64
+		for i := range c.buckets {
+			cumulative += c.buckets[i].Load()
+			le := "+Inf"
+			if i < len(latencyBuckets) {
+				le = latencyBuckets[i].String()
+			}
+			stats.LatencyHistogram = append(stats.LatencyHistogram, globals.LatencyBucket{LE: le, Count: cumulative})
+		}
+
+		result[protocol] = stats
+		return true
+	})
+	return result
+}
@@ -2,38 +2,161 @@ package poller
 
 import (
 	"bytes"
+	"compress/gzip"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log/slog"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"sync"
+	"syscall"
 	"time"
 
 	"github.com/nmslite/nmslite/internal/globals"
+	"github.com/nmslite/nmslite/internal/protocols"
 )
 
+// defaultMaxOutputBytes caps plugin stdout when no limit is configured
+const defaultMaxOutputBytes = 16 << 20 // 16 MiB
+
+// maxStderrBytes caps how much plugin stderr is kept for error messages
+const maxStderrBytes = 64 << 10
+
+// IPCEncodingEnv tells a plugin how this invocation's stdin and stdout are framed. It is
+// set to "gzip" only for plugins declaring that compression; unset means plain JSON.
+const IPCEncodingEnv = "NMSLITE_IPC_ENCODING"
+
+// ErrPluginOutputExceeded is returned when a plugin writes more stdout than allowed
+var ErrPluginOutputExceeded = errors.New("plugin output exceeded limit")
+
+// ErrPluginResourceLimit is returned when a plugin is killed for exceeding its CPU time
+// or memory limit
+var ErrPluginResourceLimit = errors.New("plugin exceeded resource limit")
+
+// pluginMemoryCheckInterval is how often a running plugin's memory use is sampled
+const pluginMemoryCheckInterval = 50 * time.Millisecond
+
+// ErrPluginSpawn wraps failures to start the plugin process, as opposed to errors from a
+// plugin that ran
+var ErrPluginSpawn = errors.New("plugin spawn failed")
+
 // PluginManager manages plugin loading and execution
 type PluginManager struct {
-	pluginDir string
-	plugins   map[string]*globals.PluginInfo // keyed by Protocol (e.g. "ssh", "winrm")
-	mu        sync.RWMutex
-	logger    *slog.Logger
-	timeout   time.Duration
+	pluginDir      string
+	plugins        map[string]*globals.PluginInfo // keyed by Protocol (e.g. "ssh", "winrm")
+	mu             sync.RWMutex
+	logger         *slog.Logger
+	timeout        time.Duration
+	maxOutputBytes int64
+	gzipMinTasks   int
+	stats          pluginStats
+
+	// Transient spawn failures are retried spawnRetries times, waiting spawnBackoff and
+	// doubling it after each attempt
+	spawnRetries int
+	spawnBackoff time.Duration
+	// cpuLimit and memoryLimit bound each plugin process (0 = unlimited), see SetResourceLimits
+	cpuLimit    time.Duration
+	memoryLimit int64
+	// startFn starts a prepared command ((*exec.Cmd).Start outside tests)
+	startFn func(cmd *exec.Cmd) error
+
+	// Plugins whose manifest declares "daemon": true are kept running, one process per
+	// binary, unless daemonsDisabled; see pluginDaemon.go
+	daemonsDisabled bool
+	daemonsMu       sync.Mutex
+	daemons         map[string]*pluginDaemon
 }
 
-// NewPluginManager creates a new plugin manager
-func NewPluginManager(pluginDir string, timeout time.Duration) *PluginManager {
+// NewPluginManager creates a new plugin manager.
+// maxOutputBytes bounds plugin stdout; <= 0 uses a 16 MiB default.
+// Batches of at least gzipMinTasks go gzip-framed to plugins that support it; <= 0 never.
+func NewPluginManager(pluginDir string, timeout time.Duration, maxOutputBytes int64, gzipMinTasks int) *PluginManager {
+	if maxOutputBytes <= 0 {
+		maxOutputBytes = defaultMaxOutputBytes
+	}
+	// Until SetSpawnRetry, spawns follow the configuration defaults
+	spawnRetries, spawnBackoff := (&globals.PluginsConfig{}).SpawnRetry()
 	return &PluginManager{
-		pluginDir: pluginDir,
-		plugins:   make(map[string]*globals.PluginInfo),
-		logger:    slog.Default().With("component", "plugin_manager"),
-		timeout:   timeout,
+		pluginDir:      pluginDir,
+		plugins:        make(map[string]*globals.PluginInfo),
+		logger:         slog.Default().With("component", "plugin_manager"),
+		timeout:        timeout,
+		maxOutputBytes: maxOutputBytes,
+		gzipMinTasks:   gzipMinTasks,
+		spawnRetries:   spawnRetries,
+		spawnBackoff:   spawnBackoff,
+		startFn:        (*exec.Cmd).Start,
+		daemons:        make(map[string]*pluginDaemon),
 	}
 }
 
+// SetSpawnRetry sets how many times a plugin process that failed to start with a
+// transient error (EAGAIN, out of memory or file descriptors, text file busy) is retried,
+// and the first delay between attempts. Retries never outlast the poll's deadline.
+func (m *PluginManager) SetSpawnRetry(retries int, backoff time.Duration) {
+	m.spawnRetries = max(retries, 0)
+	m.spawnBackoff = backoff
+}
+
+// SetDaemonsEnabled controls whether plugins declaring daemon mode are kept running
+// between batches (the default) or spawned once per batch like every other plugin
+func (m *PluginManager) SetDaemonsEnabled(enabled bool) {
+	m.daemonsDisabled = !enabled
+}
+
+// SetResourceLimits caps each plugin process's CPU time and resident memory (0 = no
+// limit). A plugin exceeding either is killed and its batch fails with
+// ErrPluginResourceLimit. Limits are enforced on Linux only; elsewhere they are ignored
+// with a warning and only the plugin timeout applies.
+func (m *PluginManager) SetResourceLimits(cpu time.Duration, memoryBytes int64) {
+	if !resourceLimitsSupported && (cpu > 0 || memoryBytes > 0) {
+		m.logger.Warn("Plugin resource limits are not supported on this platform; only the plugin timeout applies")
+		return
+	}
+	m.cpuLimit = max(cpu, 0)
+	m.memoryLimit = max(memoryBytes, 0)
+}
+
+// limitedBuffer buffers up to limit bytes. On overflow it calls onExceed (to kill the
+// process) and fails the write, so output is never buffered unboundedly.
+type limitedBuffer struct {
+	buf      bytes.Buffer
+	limit    int64
+	exceeded bool
+	onExceed func()
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if b.exceeded || int64(b.buf.Len()+len(p)) > b.limit {
+		if !b.exceeded {
+			b.exceeded = true
+			if b.onExceed != nil {
+				b.onExceed()
+			}
+		}
+		return 0, ErrPluginOutputExceeded
+	}
+	return b.buf.Write(p)
+}
+
+// truncatingBuffer keeps the first limit bytes and silently drops the rest
+type truncatingBuffer struct {
+	buf   bytes.Buffer
+	limit int
+}
+
+func (b *truncatingBuffer) Write(p []byte) (int, error) {
+	if room := b.limit - b.buf.Len(); room > 0 {
+		b.buf.Write(p[:min(len(p), room)])
+	}
+	return len(p), nil
+}
+
 // Scan scans the plugin directory and loads all plugins, indexed by Protocol
 func (m *PluginManager) Scan() error {
 	m.mu.Lock()
@@ -69,8 +192,14 @@ func (m *PluginManager) Scan() error {
 		}
 
 		var pluginMeta struct {
-			Name     string `json:"name"`
-			Protocol string `json:"protocol"`
+			ID          string   `json:"id"`
+			Name        string   `json:"name"`
+			Version     string   `json:"version"`
+			Protocol    string   `json:"protocol"`
+			DefaultPort int      `json:"default_port"`
+			Collectors  []string `json:"collectors"`
+			Compression string   `json:"compression"`
+			Daemon      bool     `json:"daemon"`
 		}
 		if err := json.Unmarshal(manifestData, &pluginMeta); err != nil {
 			m.logger.Warn("Failed to parse manifest", "plugin", pluginName, "error", err)
@@ -90,11 +219,22 @@ func (m *PluginManager) Scan() error {
 			continue
 		}
 
+		// Manifest id is optional; the directory name identifies the plugin otherwise
+		if pluginMeta.ID == "" {
+			pluginMeta.ID = pluginName
+		}
+
 		// Register plugin
 		info := &globals.PluginInfo{
-			Name:       pluginMeta.Name,
-			Protocol:   pluginMeta.Protocol,
-			BinaryPath: absBinaryPath,
+			ID:          pluginMeta.ID,
+			Name:        pluginMeta.Name,
+			Version:     pluginMeta.Version,
+			Protocol:    pluginMeta.Protocol,
+			DefaultPort: pluginMeta.DefaultPort,
+			Collectors:  pluginMeta.Collectors,
+			Compression: pluginMeta.Compression,
+			Daemon:      pluginMeta.Daemon,
+			BinaryPath:  absBinaryPath,
 		}
 
 		// Enforce 1:1 Protocol mapping (last one wins if duplicate, or error? User said 1:1)
@@ -127,6 +267,24 @@ func (m *PluginManager) Get(protocol string) (*globals.PluginInfo, bool) {
 	return plugin, ok
 }
 
+// DefaultPort returns the port to use for a protocol when none is configured: the
+// plugin manifest's default_port if set, otherwise the protocol's well-known port.
+// With tls (credentials selecting HTTPS) the protocol's well-known TLS port comes first,
+// as manifests declare the plain port. A nil manager only consults the protocol registry.
+func (m *PluginManager) DefaultPort(protocol string, tls bool) int {
+	if tls {
+		if port := protocols.GetRegistry().DefaultTLSPort(protocol); port > 0 {
+			return port
+		}
+	}
+	if m != nil {
+		if plugin, ok := m.Get(protocol); ok && plugin.DefaultPort > 0 {
+			return plugin.DefaultPort
+		}
+	}
+	return protocols.GetRegistry().DefaultPort(protocol)
+}
+
 // List returns all registered plugins
 func (m *PluginManager) List() []*globals.PluginInfo {
 	m.mu.RLock()
@@ -139,6 +297,73 @@ func (m *PluginManager) List() []*globals.PluginInfo {
 	return result
 }
 
+// SelfTest runs every registered plugin with an empty task batch and checks that it
+// answers with a JSON result array within timeout. Failures are returned by protocol;
+// with unregister set, failing plugins are also removed so nothing is polled with them.
+func (m *PluginManager) SelfTest(ctx context.Context, timeout time.Duration, unregister bool) map[string]error {
+	if timeout <= 0 {
+		timeout = m.timeout
+	}
+	plugins := m.List()
+
+	var (
+		mu       sync.Mutex
+		wg       sync.WaitGroup
+		failures = make(map[string]error)
+	)
+	for _, plugin := range plugins {
+		wg.Add(1)
+		go func(plugin *globals.PluginInfo) {
+			defer wg.Done()
+
+			testCtx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+
+			start := time.Now()
+			_, err := m.execute(testCtx, plugin, []globals.PollTask{})
+			if err == nil {
+				m.logger.Debug("Plugin self-test passed", "protocol", plugin.Protocol, "duration", time.Since(start))
+				return
+			}
+			if testCtx.Err() == context.DeadlineExceeded {
+				err = fmt.Errorf("no response within %v: %w", timeout, err)
+			}
+			m.logger.Error("Plugin self-test failed",
+				"protocol", plugin.Protocol,
+				"name", plugin.Name,
+				"path", plugin.BinaryPath,
+				"error", err,
+			)
+
+			mu.Lock()
+			failures[plugin.Protocol] = err
+			mu.Unlock()
+		}(plugin)
+	}
+	wg.Wait()
+
+	if unregister && len(failures) > 0 {
+		m.mu.Lock()
+		for protocol := range failures {
+			// A concurrent Scan may have replaced the entry; only drop the one tested
+			for _, plugin := range plugins {
+				if plugin.Protocol == protocol && m.plugins[protocol] == plugin {
+					delete(m.plugins, protocol)
+					m.logger.Warn("Unregistered plugin after failed self-test", "protocol", protocol)
+				}
+			}
+		}
+		m.mu.Unlock()
+	}
+
+	return failures
+}
+
+// Stats returns execution metrics per protocol for plugins invoked since startup
+func (m *PluginManager) Stats() map[string]globals.PluginStats {
+	return m.stats.snapshot()
+}
+
 // Poll executes a batch of tasks using the plugin associated with the given protocol
 func (m *PluginManager) Poll(ctx context.Context, protocol string, tasks []globals.PollTask) ([]globals.PollResult, error) {
 	plugin, ok := m.Get(protocol)
@@ -146,42 +371,258 @@ func (m *PluginManager) Poll(ctx context.Context, protocol string, tasks []globa
 		return nil, fmt.Errorf("no plugin found for protocol: %s", protocol)
 	}
 
+	start := time.Now()
+	results, err := m.execute(ctx, plugin, tasks)
+	m.stats.record(ctx, protocol, time.Since(start), err)
+
+	return results, err
+}
+
+// execute runs the plugin binary with tasks on stdin and parses its results from stdout.
+// Daemon-mode plugins get the batch as one line on their long-running process instead.
+func (m *PluginManager) execute(ctx context.Context, plugin *globals.PluginInfo, tasks []globals.PollTask) ([]globals.PollResult, error) {
+	if daemon := m.daemonFor(plugin); daemon != nil {
+		return daemon.poll(ctx, tasks)
+	}
+	protocol := plugin.Protocol
+
 	// Marshal tasks to JSON
 	inputData, err := json.Marshal(tasks)
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal tasks: %w", err)
 	}
 
-	// Prepare command
-	cmd := exec.CommandContext(ctx, plugin.BinaryPath)
-	cmd.Dir = filepath.Dir(plugin.BinaryPath) // Run in plugin directory
+	useGzip := m.useGzip(plugin, len(tasks))
+	if useGzip {
+		if inputData, err = gzipBytes(inputData); err != nil {
+			return nil, fmt.Errorf("failed to compress tasks: %w", err)
+		}
+	}
 
-	// Pipe input
-	cmd.Stdin = bytes.NewReader(inputData)
-	var stdout, stderr bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
+	// Cancelling runCtx kills the plugin, e.g. when its output exceeds the limit
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
 
-	m.logger.Debug("Executing plugin", "protocol", protocol, "task_count", len(tasks))
+	m.logger.Debug("Executing plugin", "protocol", protocol, "task_count", len(tasks), "gzip", useGzip)
 
 	// Execute
 	start := time.Now()
-	if err := cmd.Run(); err != nil {
-		return nil, fmt.Errorf("plugin execution failed: %w, stderr: %s", err, stderr.String())
+	cmd, stdout, stderr, err := m.spawn(runCtx, cancel, plugin, inputData, useGzip)
+	if err != nil {
+		m.logger.Error("Plugin spawn failed",
+			"protocol", protocol,
+			"binary", plugin.BinaryPath,
+			"error", err,
+		)
+		return nil, err
+	}
+	guard := m.guardResources(runCtx, cancel, cmd.Process.Pid, protocol, m.cpuLimit)
+	err = cmd.Wait()
+	guard.stop()
+	if reason := m.resourceLimitExceeded(cmd.ProcessState, guard); reason != "" {
+		m.logger.Warn("Plugin killed: resource limit exceeded",
+			"protocol", protocol,
+			"reason", reason,
+		)
+		return nil, fmt.Errorf("%w: %s", ErrPluginResourceLimit, reason)
+	}
+	if stdout.exceeded {
+		m.logger.Warn("Plugin killed: output exceeded limit",
+			"protocol", protocol,
+			"limit_bytes", m.maxOutputBytes,
+		)
+		return nil, fmt.Errorf("%w (%d bytes)", ErrPluginOutputExceeded, m.maxOutputBytes)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("plugin execution failed: %w, stderr: %s", err, stderr.buf.String())
 	}
 	duration := time.Since(start)
 
 	m.logger.Debug("Plugin execution completed",
 		"protocol", protocol,
 		"duration", duration,
-		"stderr_len", stderr.Len(),
+		"stderr_len", stderr.buf.Len(),
 	)
 
+	output := stdout.buf.Bytes()
+	if useGzip {
+		if output, err = gunzipLimited(output, m.maxOutputBytes); err != nil {
+			return nil, fmt.Errorf("failed to decompress plugin output: %w", err)
+		}
+	}
+
 	// Unmarshal output
 	var results []globals.PollResult
-	if err := json.Unmarshal(stdout.Bytes(), &results); err != nil {
-		return nil, fmt.Errorf("failed to parse plugin output: %w, output: %s", err, stdout.String())
+	if err := json.Unmarshal(output, &results); err != nil {
+		return nil, fmt.Errorf("failed to parse plugin output: %w, output: %s", err, output)
 	}
 
 	return results, nil
 }
+
+// spawn starts the plugin process, retrying transient start failures with backoff while
+// runCtx allows. A failed Cmd cannot be restarted, so each attempt prepares a new one.
+func (m *PluginManager) spawn(runCtx context.Context, cancel context.CancelFunc, plugin *globals.PluginInfo, inputData []byte, useGzip bool) (*exec.Cmd, *limitedBuffer, *truncatingBuffer, error) {
+	backoff := m.spawnBackoff
+	for attempt := 0; ; attempt++ {
+		cmd := exec.CommandContext(runCtx, plugin.BinaryPath)
+		cmd.Dir = filepath.Dir(plugin.BinaryPath) // Run in plugin directory
+		cmd.WaitDelay = time.Second               // Don't hang on pipes held open by orphaned children
+		if useGzip {
+			cmd.Env = append(os.Environ(), IPCEncodingEnv+"=gzip")
+		}
+
+		// Pipe input
+		cmd.Stdin = bytes.NewReader(inputData)
+		stdout := &limitedBuffer{limit: m.maxOutputBytes, onExceed: cancel}
+		stderr := &truncatingBuffer{limit: maxStderrBytes}
+		cmd.Stdout = stdout
+		cmd.Stderr = stderr
+
+		err := m.startFn(cmd)
+		if err == nil {
+			return cmd, stdout, stderr, nil
+		}
+		err = fmt.Errorf("%w: %w", ErrPluginSpawn, err)
+
+		if attempt >= m.spawnRetries || !isTransientSpawnError(err) {
+			return nil, nil, nil, err
+		}
+		if deadline, ok := runCtx.Deadline(); ok && time.Until(deadline) <= backoff {
+			return nil, nil, nil, err
+		}
+
+		m.logger.Warn("Plugin spawn failed, retrying",
+			"protocol", plugin.Protocol,
+			"attempt", attempt+1,
+			"backoff", backoff,
+			"error", err,
+		)
+		select {
+		case <-time.After(backoff):
+		case <-runCtx.Done():
+			return nil, nil, nil, err
+		}
+		backoff *= 2
+	}
+}
+
+// resourceGuard enforces a running plugin's resource limits
+type resourceGuard struct {
+	cpuLimit time.Duration // applied to the process, 0 if none
+	done     chan struct{}
+	// memoryKilled is closed when the plugin was killed for exceeding its memory limit
+	memoryKilled chan struct{}
+}
+
+// guardResources applies cpuLimit (0 = none) to a started plugin and, with a memory limit,
+// samples its resident memory until stop, killing it through cancel once over the limit
+func (m *PluginManager) guardResources(runCtx context.Context, cancel context.CancelFunc, pid int, protocol string, cpuLimit time.Duration) *resourceGuard {
+	g := &resourceGuard{cpuLimit: cpuLimit, done: make(chan struct{}), memoryKilled: make(chan struct{})}
+
+	if cpuLimit > 0 {
+		if err := applyCPULimit(pid, cpuLimit); err != nil {
+			m.logger.Warn("Failed to apply plugin CPU limit", "protocol", protocol, "error", err)
+		}
+	}
+	if m.memoryLimit <= 0 {
+		return g
+	}
+
+	go func() {
+		ticker := time.NewTicker(pluginMemoryCheckInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-g.done:
+				return
+			case <-runCtx.Done():
+				return
+			case <-ticker.C:
+				// The process may have just exited; only a readable size over the limit counts
+				if rss, err := processRSS(pid); err == nil && rss > m.memoryLimit {
+					close(g.memoryKilled)
+					cancel()
+					return
+				}
+			}
+		}
+	}()
+	return g
+}
+
+// stop ends memory sampling once the plugin has exited
+func (g *resourceGuard) stop() {
+	close(g.done)
+}
+
+// resourceLimitExceeded describes the limit an exited plugin broke, or returns "" if none.
+// Memory peaks between samples count too, so the limit does not depend on timing.
+func (m *PluginManager) resourceLimitExceeded(state *os.ProcessState, g *resourceGuard) string {
+	select {
+	case <-g.memoryKilled:
+		return fmt.Sprintf("memory over %d bytes", m.memoryLimit)
+	default:
+	}
+	if state == nil {
+		return ""
+	}
+	if m.memoryLimit > 0 {
+		if peak := peakRSS(state); peak > m.memoryLimit {
+			return fmt.Sprintf("memory peaked at %d bytes, limit %d", peak, m.memoryLimit)
+		}
+	}
+	if g.cpuLimit > 0 && killedForCPU(state, g.cpuLimit) {
+		used := state.UserTime() + state.SystemTime()
+		return fmt.Sprintf("CPU time %v, limit %v", used.Round(time.Millisecond), g.cpuLimit)
+	}
+	return ""
+}
+
+// isTransientSpawnError reports whether starting a process failed for a reason that may
+// clear on its own: fork pressure, exhausted memory or descriptors, or a binary being replaced
+func isTransientSpawnError(err error) bool {
+	for _, errno := range []syscall.Errno{syscall.EAGAIN, syscall.ENOMEM, syscall.EMFILE, syscall.ENFILE, syscall.ETXTBSY} {
+		if errors.Is(err, errno) {
+			return true
+		}
+	}
+	return false
+}
+
+// useGzip reports whether a batch of taskCount tasks goes gzip-framed to plugin
+func (m *PluginManager) useGzip(plugin *globals.PluginInfo, taskCount int) bool {
+	return plugin.Compression == "gzip" && m.gzipMinTasks > 0 && taskCount >= m.gzipMinTasks
+}
+
+// gzipBytes compresses data in memory
+func gzipBytes(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(data); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// gunzipLimited decompresses plugin output, applying the output limit to the decompressed
+// size as well so a small compressed payload cannot expand without bound
+func gunzipLimited(data []byte, limit int64) ([]byte, error) {
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+
+	out, err := io.ReadAll(io.LimitReader(zr, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(out)) > limit {
+		return nil, fmt.Errorf("%w (%d bytes decompressed)", ErrPluginOutputExceeded, limit)
+	}
+	return out, nil
+}
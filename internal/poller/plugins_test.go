@@ -0,0 +1,536 @@
+package poller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/nmslite/nmslite/internal/globals"
+)
+
+// writePlugin installs a shell-script plugin for protocol "test" and returns its manager
+func writePlugin(t *testing.T, script string, maxOutputBytes int64) *PluginManager {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "plugin.sh")
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+script+"\n"), 0o755); err != nil {
+		t.Fatalf("Failed to write plugin: %v", err)
+	}
+
+	m := NewPluginManager(filepath.Dir(path), time.Minute, maxOutputBytes, 0)
+	m.plugins["test"] = &globals.PluginInfo{Protocol: "test", BinaryPath: path}
+	return m
+}
+
+func TestPluginPollOutputLimit(t *testing.T) {
+	// Spews output forever; only the limit can stop it before the test deadline
+	m := writePlugin(t, "exec yes '[{\"request_id\":\"1\",\"status\":\"success\"}]'", 64<<10)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	start := time.Now()
+	_, err := m.Poll(ctx, "test", []globals.PollTask{{RequestID: "1"}})
+	if !errors.Is(err, ErrPluginOutputExceeded) {
+		t.Fatalf("Expected ErrPluginOutputExceeded, got %v", err)
+	}
+	if ctx.Err() != nil {
+		t.Fatalf("Plugin was not killed before the deadline (took %v)", time.Since(start))
+	}
+}
+
+func TestPluginPollWithinLimit(t *testing.T) {
+	m := writePlugin(t, "cat >/dev/null; echo '[{\"request_id\":\"1\",\"status\":\"success\"}]'", 64<<10)
+
+	results, err := m.Poll(context.Background(), "test", []globals.PollTask{{RequestID: "1"}})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(results) != 1 || results[0].RequestID != "1" {
+		t.Errorf("Unexpected results: %+v", results)
+	}
+}
+
+func TestPluginPollStats(t *testing.T) {
+	m := writePlugin(t, "cat >/dev/null; echo '[{\"request_id\":\"1\",\"status\":\"success\"}]'", 0)
+	tasks := []globals.PollTask{{RequestID: "1"}}
+
+	for i := 0; i < 2; i++ {
+		if _, err := m.Poll(context.Background(), "test", tasks); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	// Same protocol, now hanging until the deadline
+	slow := writePlugin(t, "exec sleep 5", 0)
+	m.plugins["test"] = slow.plugins["test"]
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := m.Poll(ctx, "test", tasks); err == nil {
+		t.Fatal("Expected timeout error")
+	}
+
+	// Unknown protocols are not counted
+	m.Poll(context.Background(), "missing", tasks)
+
+	stats := m.Stats()
+	if _, ok := stats["missing"]; ok {
+		t.Error("Unknown protocol should not have stats")
+	}
+
+	s := stats["test"]
+	if s.Invocations != 3 || s.Successes != 2 || s.Timeouts != 1 || s.Failures != 0 {
+		t.Errorf("Unexpected counters: %+v", s)
+	}
+	last := s.LatencyHistogram[len(s.LatencyHistogram)-1]
+	if last.LE != "+Inf" || last.Count != 3 {
+		t.Errorf("Expected cumulative +Inf bucket of 3, got %+v", last)
+	}
+	if s.AvgLatencyMS <= 0 {
+		t.Errorf("Expected positive average latency, got %v", s.AvgLatencyMS)
+	}
+}
+
+func TestPluginResourceLimits(t *testing.T) {
+	if !resourceLimitsSupported {
+		t.Skip("plugin resource limits are not enforced on this platform")
+	}
+
+	testCases := []struct {
+		name     string
+		script   string
+		cpu      time.Duration
+		memoryMB int64
+		wantKill bool
+	}{
+		// Burns CPU forever; only the CPU limit can stop it before the test deadline
+		{"CPU burner", "while :; do :; done", time.Second, 0, true},
+		// Holds ~64 MiB in a shell variable, then idles
+		{"Memory hog", "x=$(head -c 67108864 /dev/zero | tr '\\0' a); sleep 10", 0, 16, true},
+		{"Within limits", "cat >/dev/null; echo '[{\"request_id\":\"1\",\"status\":\"success\"}]'", time.Second, 64, false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			m := writePlugin(t, tc.script, 0)
+			m.SetResourceLimits(tc.cpu, tc.memoryMB<<20)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+
+			start := time.Now()
+			_, err := m.Poll(ctx, "test", []globals.PollTask{{RequestID: "1"}})
+			if !tc.wantKill {
+				if err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+				return
+			}
+			if !errors.Is(err, ErrPluginResourceLimit) {
+				t.Fatalf("Expected ErrPluginResourceLimit, got %v", err)
+			}
+			if ctx.Err() != nil {
+				t.Fatalf("Plugin was not killed before the deadline (took %v)", time.Since(start))
+			}
+			if s := m.Stats()["test"]; s.LimitKills != 1 || s.Failures != 0 {
+				t.Errorf("Expected the kill counted as a limit kill, got %+v", s)
+			}
+		})
+	}
+}
+
+func TestPluginSelfTest(t *testing.T) {
+	testCases := []struct {
+		name       string
+		script     string
+		mode       os.FileMode
+		unregister bool
+		wantFail   bool
+	}{
+		{"Responds with empty array", "cat >/dev/null; echo '[]'", 0o755, true, false},
+		{"Invalid JSON output", "cat >/dev/null; echo 'ready'", 0o755, false, true},
+		{"Missing exec bit", "echo '[]'", 0o644, true, true},
+		{"Hangs past timeout", "exec sleep 5", 0o755, true, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			m := writePlugin(t, tc.script, 0)
+			if err := os.Chmod(m.plugins["test"].BinaryPath, tc.mode); err != nil {
+				t.Fatalf("Failed to chmod plugin: %v", err)
+			}
+
+			start := time.Now()
+			failures := m.SelfTest(context.Background(), 200*time.Millisecond, tc.unregister)
+			if elapsed := time.Since(start); elapsed > 3*time.Second {
+				t.Errorf("Self-test did not honor its timeout (took %v)", elapsed)
+			}
+
+			if _, failed := failures["test"]; failed != tc.wantFail {
+				t.Fatalf("Expected failure=%v, got %v", tc.wantFail, failures)
+			}
+			_, registered := m.Get("test")
+			if wantRegistered := !(tc.wantFail && tc.unregister); registered != wantRegistered {
+				t.Errorf("Expected registered=%v, got %v", wantRegistered, registered)
+			}
+		})
+	}
+}
+
+func TestPluginPollCompression(t *testing.T) {
+	const reply = `[{"request_id":"1","status":"success"}]`
+	// Each plugin exits 3 if it is handed the wrong framing
+	plain := `[ -z "$NMSLITE_IPC_ENCODING" ] || exit 3; grep -q '"request_id":"1"' || exit 4; echo '` + reply + `'`
+	gzipped := `[ "$NMSLITE_IPC_ENCODING" = gzip ] || exit 3; gzip -dc | grep -q '"request_id":"1"' || exit 4; echo '` + reply + `' | gzip -c`
+	plainOrGzip := `if [ "$NMSLITE_IPC_ENCODING" = gzip ]; then ` + gzipped + `; else ` + plain + `; fi`
+
+	testCases := []struct {
+		name        string
+		script      string
+		compression string
+		tasks       int
+	}{
+		{"Plain plugin, large batch", plain, "", 5},
+		{"Gzip plugin, large batch", gzipped, "gzip", 5},
+		{"Gzip plugin, small batch", plainOrGzip, "gzip", 1},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			m := writePlugin(t, tc.script, 0)
+			m.gzipMinTasks = 3
+			m.plugins["test"].Compression = tc.compression
+
+			tasks := make([]globals.PollTask, tc.tasks)
+			for i := range tasks {
+				tasks[i].RequestID = strconv.Itoa(i + 1)
+			}
+
+			results, err := m.Poll(context.Background(), "test", tasks)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if len(results) != 1 || results[0].RequestID != "1" {
+				t.Errorf("Unexpected results: %+v", results)
+			}
+		})
+	}
+}
+
+func TestPluginPollCompressedOutputLimit(t *testing.T) {
+	// 1 MiB of zeros compresses to about 1 KiB, well under the stdout limit
+	m := writePlugin(t, "cat >/dev/null; head -c 1048576 /dev/zero | gzip -c", 64<<10)
+	m.gzipMinTasks = 1
+	m.plugins["test"].Compression = "gzip"
+
+	_, err := m.Poll(context.Background(), "test", []globals.PollTask{{RequestID: "1"}})
+	if !errors.Is(err, ErrPluginOutputExceeded) {
+		t.Fatalf("Expected ErrPluginOutputExceeded, got %v", err)
+	}
+}
+
+func TestPluginManagerDefaultPort(t *testing.T) {
+	m := NewPluginManager(t.TempDir(), time.Minute, 0, 0)
+	m.plugins["windows-winrm"] = &globals.PluginInfo{Protocol: "windows-winrm", DefaultPort: 15985}
+	m.plugins["snmp-v2c"] = &globals.PluginInfo{Protocol: "snmp-v2c"}
+
+	testCases := []struct {
+		name     string
+		manager  *PluginManager
+		protocol string
+		tls      bool
+		want     int
+	}{
+		{"Manifest default", m, "windows-winrm", false, 15985},
+		{"TLS port over the manifest default", m, "windows-winrm", true, 5986},
+		{"Manifest without default_port", m, "snmp-v2c", false, 161},
+		{"Protocol without a plugin", m, "ssh", false, 22},
+		{"Protocol without a TLS port", m, "ssh", true, 22},
+		{"Unknown protocol", m, "test", false, 0},
+		{"Nil manager", nil, "windows-winrm", false, 5985},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := tc.manager.DefaultPort(tc.protocol, tc.tls); got != tc.want {
+				t.Errorf("Expected default port %d, got %d", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestPluginPollRetriesTransientSpawnFailure(t *testing.T) {
+	testCases := []struct {
+		name      string
+		startErr  error
+		failures  int
+		wantErr   bool
+		wantStart int
+	}{
+		{"Succeeds after EAGAIN", syscall.EAGAIN, 2, false, 3},
+		{"Gives up after retries", syscall.EMFILE, 5, true, 3},
+		{"Permanent error is not retried", syscall.EACCES, 1, true, 1},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			m := writePlugin(t, "cat >/dev/null; echo '[{\"request_id\":\"1\",\"status\":\"success\"}]'", 0)
+			m.SetSpawnRetry(2, time.Millisecond)
+			starts := 0
+			m.startFn = func(cmd *exec.Cmd) error {
+				starts++
+				if starts <= tc.failures {
+					return &os.PathError{Op: "fork/exec", Path: cmd.Path, Err: tc.startErr}
+				}
+				return cmd.Start()
+			}
+
+			results, err := m.Poll(context.Background(), "test", []globals.PollTask{{RequestID: "1"}})
+			if starts != tc.wantStart {
+				t.Errorf("Expected %d start attempts, got %d", tc.wantStart, starts)
+			}
+			if tc.wantErr {
+				if !errors.Is(err, ErrPluginSpawn) || !errors.Is(err, tc.startErr) {
+					t.Errorf("Expected a spawn error wrapping %v, got %v", tc.startErr, err)
+				}
+				return
+			}
+			if err != nil || len(results) != 1 {
+				t.Errorf("Expected one result after retrying, got %v (err %v)", results, err)
+			}
+		})
+	}
+}
+
+func TestPluginSpawnRetryStopsAtDeadline(t *testing.T) {
+	m := writePlugin(t, "cat >/dev/null; echo '[]'", 0)
+	m.SetSpawnRetry(10, time.Second)
+	starts := 0
+	m.startFn = func(cmd *exec.Cmd) error {
+		starts++
+		return syscall.EAGAIN
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	_, err := m.Poll(ctx, "test", nil)
+	if !errors.Is(err, ErrPluginSpawn) {
+		t.Fatalf("Expected ErrPluginSpawn, got %v", err)
+	}
+	if starts != 1 {
+		t.Errorf("Expected no retry when the backoff outlasts the deadline, got %d attempts", starts)
+	}
+}
+
+// daemonReply is a shell fragment answering the request in $line with one result whose
+// request_id is the daemon's PID
+const daemonReply = `id=$(printf '%s' "$line" | sed 's/^{"id":\([0-9]*\).*/\1/')
+echo "{\"id\":$id,\"results\":[{\"request_id\":\"$$\",\"status\":\"success\"}]}"`
+
+// writeDaemonPlugin installs a shell-script plugin for protocol "test" that declares
+// daemon mode, and stops its daemon when the test ends
+func writeDaemonPlugin(t *testing.T, script string, maxOutputBytes int64) *PluginManager {
+	t.Helper()
+	m := writePlugin(t, script, maxOutputBytes)
+	m.plugins["test"].Daemon = true
+	t.Cleanup(m.Close)
+	return m
+}
+
+// daemonProc returns the manager's current daemon process for protocol "test"
+func daemonProc(t *testing.T, m *PluginManager) *daemonProcess {
+	t.Helper()
+	m.daemonsMu.Lock()
+	d := m.daemons[m.plugins["test"].BinaryPath]
+	m.daemonsMu.Unlock()
+	if d == nil {
+		t.Fatal("Expected a daemon to have been started")
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.proc
+}
+
+// waitExited fails the test unless proc exits within a few seconds
+func waitExited(t *testing.T, proc *daemonProcess) {
+	t.Helper()
+	select {
+	case <-proc.done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the daemon process to exit")
+	}
+}
+
+func TestPluginDaemonReusesProcess(t *testing.T) {
+	m := writeDaemonPlugin(t, `[ "$NMSLITE_PLUGIN_MODE" = daemon ] || exit 3
+while IFS= read -r line; do
+`+daemonReply+`
+done`, 0)
+	tasks := []globals.PollTask{{RequestID: "1"}}
+
+	first, err := m.Poll(context.Background(), "test", tasks)
+	if err != nil || len(first) != 1 {
+		t.Fatalf("Expected one result, got %v (err %v)", first, err)
+	}
+
+	// Concurrent batches share the process and each gets its own answer
+	var wg sync.WaitGroup
+	pids := make(chan string, 10)
+	for i := 0; i < cap(pids); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results, err := m.Poll(context.Background(), "test", tasks)
+			if err != nil || len(results) != 1 {
+				t.Errorf("Expected one result, got %v (err %v)", results, err)
+				return
+			}
+			pids <- results[0].RequestID
+		}()
+	}
+	wg.Wait()
+	close(pids)
+	for pid := range pids {
+		if pid != first[0].RequestID {
+			t.Errorf("Expected every batch to reach daemon %s, got %s", first[0].RequestID, pid)
+		}
+	}
+
+	m.Close()
+	waitExited(t, daemonProc(t, m))
+	if _, err := m.Poll(context.Background(), "test", tasks); err == nil {
+		t.Error("Expected polls to fail after Close")
+	}
+}
+
+func TestPluginDaemonRestartsAfterExit(t *testing.T) {
+	// Answers a single batch, then exits
+	m := writeDaemonPlugin(t, "IFS= read -r line\n"+daemonReply, 0)
+	tasks := []globals.PollTask{{RequestID: "1"}}
+
+	first, err := m.Poll(context.Background(), "test", tasks)
+	if err != nil || len(first) != 1 {
+		t.Fatalf("Expected one result, got %v (err %v)", first, err)
+	}
+	waitExited(t, daemonProc(t, m))
+
+	second, err := m.Poll(context.Background(), "test", tasks)
+	if err != nil || len(second) != 1 {
+		t.Fatalf("Expected the restarted daemon to answer, got %v (err %v)", second, err)
+	}
+	if second[0].RequestID == first[0].RequestID {
+		t.Error("Expected a new daemon process after the first exited")
+	}
+	if restarts := m.Stats()["test"].DaemonRestarts; restarts != 1 {
+		t.Errorf("Expected 1 daemon restart, got %d", restarts)
+	}
+}
+
+func TestPluginDaemonFailures(t *testing.T) {
+	tests := []struct {
+		name    string
+		script  string
+		timeout time.Duration
+		wantErr error  // matched with errors.Is when set
+		wantMsg string // otherwise contained in the error
+		exits   bool   // the daemon is gone afterwards
+	}{
+		{
+			name:    "unresponsive daemon is killed",
+			script:  "IFS= read -r line; exec sleep 30",
+			timeout: 200 * time.Millisecond,
+			wantErr: context.DeadlineExceeded,
+			exits:   true,
+		},
+		{
+			name:    "overlong response line",
+			script:  "IFS= read -r line; head -c 1048576 /dev/zero | tr '\\0' x; sleep 30",
+			wantErr: ErrPluginOutputExceeded,
+			exits:   true,
+		},
+		{
+			name:    "crash mid-batch",
+			script:  "IFS= read -r line; echo boom >&2; exit 1",
+			wantMsg: "boom",
+			exits:   true,
+		},
+		{
+			name:    "batch error",
+			script:  `while IFS= read -r line; do id=$(printf '%s' "$line" | sed 's/^{"id":\([0-9]*\).*/\1/'); echo "{\"id\":$id,\"error\":\"bad input\"}"; done`,
+			wantMsg: "bad input",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			m := writeDaemonPlugin(t, tc.script, 64<<10)
+			ctx := context.Background()
+			if tc.timeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, tc.timeout)
+				defer cancel()
+			}
+
+			_, err := m.Poll(ctx, "test", []globals.PollTask{{RequestID: "1"}})
+			switch {
+			case err == nil:
+				t.Fatal("Expected an error")
+			case tc.wantErr != nil && !errors.Is(err, tc.wantErr):
+				t.Errorf("Expected %v, got %v", tc.wantErr, err)
+			case tc.wantMsg != "" && !strings.Contains(err.Error(), tc.wantMsg):
+				t.Errorf("Expected error containing %q, got %v", tc.wantMsg, err)
+			}
+
+			proc := daemonProc(t, m)
+			if tc.exits {
+				waitExited(t, proc)
+				return
+			}
+			select {
+			case <-proc.done:
+				t.Error("Expected the daemon to keep running")
+			default:
+			}
+		})
+	}
+}
+
+func TestDaemonProcessKillKeepsFirstCause(t *testing.T) {
+	var cancels int
+	p := &daemonProcess{cancel: func() { cancels++ }}
+
+	// A batch timeout racing an oversized line kills with causes of different types
+	p.kill(ErrPluginDaemonUnresponsive)
+	p.kill(fmt.Errorf("%w: line too long", ErrPluginOutputExceeded))
+
+	if cause := p.cause.Load(); cause == nil || !errors.Is(*cause, ErrPluginDaemonUnresponsive) {
+		t.Errorf("Expected the first cause to be kept, got %v", cause)
+	}
+	if cancels != 2 {
+		t.Errorf("Expected every kill to cancel the process, got %d", cancels)
+	}
+}
+
+func TestPluginDaemonsDisabled(t *testing.T) {
+	// Plugins declaring daemon mode must still handle one batch per process
+	m := writeDaemonPlugin(t, `if [ "$NMSLITE_PLUGIN_MODE" = daemon ]; then exit 3; fi
+cat >/dev/null; echo '[{"request_id":"1","status":"success"}]'`, 0)
+	m.SetDaemonsEnabled(false)
+
+	results, err := m.Poll(context.Background(), "test", []globals.PollTask{{RequestID: "1"}})
+	if err != nil || len(results) != 1 {
+		t.Fatalf("Expected a one-shot result, got %v (err %v)", results, err)
+	}
+	if len(m.daemons) != 0 {
+		t.Error("Expected no daemon to be started")
+	}
+}
@@ -4,28 +4,72 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
+	"maps"
+	"math"
+	"sync/atomic"
 	"time"
 
 	"github.com/nmslite/nmslite/internal/globals"
 	// plugins "github.com/nmslite/nmslite/internal/plugins" - REMOVED
 )
 
+// ResultWriter persists the results of a successful poll.
+// tags are the monitor's static tags, to be merged into every metric written.
+// Write returns an error when metrics could not be handed off for persistence.
+type ResultWriter interface {
+	Write(ctx context.Context, monitorID int64, tags map[string]string, results []globals.PollResult) error
+}
+
+// NonFiniteTag is the metrics.non_finite_policy that records a marker for each NaN/Inf value
+const NonFiniteTag = "tag"
+
+// invalidMetricSuffix names the marker recorded in place of a non-finite value
+const invalidMetricSuffix = ".invalid"
+
+// Metric timestamp policies (metrics.timestamp_policy)
+const (
+	TimestampPlugin = "plugin" // keep the timestamp the plugin reported
+	TimestampServer = "server" // store every metric at the time its result arrived
+	TimestampReject = "reject" // keep plugin timestamps, dropping those too far from server time
+)
+
+// filterReportInterval is how often the number of filtered metrics is logged
+const filterReportInterval = time.Minute
+
 // PollResultWriter handles writing poll results to the database via BatchWriter
 type PollResultWriter struct {
-	logger      *slog.Logger
-	batchWriter *BatchWriter
+	logger          *slog.Logger
+	batchWriter     *BatchWriter
+	nonFinitePolicy string
+	timestampPolicy string
+	maxMetricAge    time.Duration
+	filter          *MetricFilter
+
+	// Metrics dropped by filter since the last summary, logged every filterReportInterval
+	filtered      atomic.Int64
+	nextFilterLog atomic.Int64 // unix nanoseconds
 }
 
 // NewPollResultWriter creates a new PollResultWriter
 func NewPollResultWriter(batchWriter *BatchWriter) *PollResultWriter {
-	return &PollResultWriter{
-		batchWriter: batchWriter,
-		logger:      slog.Default(),
+	cfg := globals.GetConfig().Metrics
+	w := &PollResultWriter{
+		batchWriter:     batchWriter,
+		logger:          slog.Default(),
+		nonFinitePolicy: cfg.NonFinitePolicy,
+		timestampPolicy: cfg.TimestampPolicy,
+		maxMetricAge:    cfg.MaxMetricAge(),
+		filter:          NewMetricFilter(cfg.IncludeMetrics, cfg.ExcludeMetrics),
 	}
+	w.nextFilterLog.Store(time.Now().Add(filterReportInterval).UnixNano())
+	return w
 }
 
-// Write processes poll results and submits metrics to BatchWriter for bulk insertion
-func (w *PollResultWriter) Write(ctx context.Context, monitorID int64, results []globals.PollResult) {
+// Write processes poll results and submits metrics to BatchWriter for bulk insertion,
+// merging monitorTags into each metric's tags (see MergeTags).
+// Submit only fails once ctx is done, so the first failure stops the write and is
+// returned along with how many metrics were lost.
+func (w *PollResultWriter) Write(ctx context.Context, monitorID int64, monitorTags map[string]string, results []globals.PollResult) error {
 	timestamp := time.Now()
 
 	for _, result := range results {
@@ -47,7 +91,7 @@ func (w *PollResultWriter) Write(ctx context.Context, monitorID int64, results [
 			continue
 		}
 
-		metrics, err := parseMetricsFromPlugin(monitorID, timestamp, result.Metrics)
+		metrics, err := parseMetricsFromPlugin(monitorID, w.collectedAt(monitorID, result, timestamp), result.Metrics)
 		if err != nil {
 			w.logger.Error("failed to parse metrics",
 				"monitor_id", monitorID,
@@ -57,13 +101,41 @@ func (w *PollResultWriter) Write(ctx context.Context, monitorID int64, results [
 			continue
 		}
 
+		metrics, skewed := ApplyTimestampPolicy(metrics, w.timestampPolicy, w.maxMetricAge, timestamp)
+		if skewed > 0 {
+			w.logger.Warn("dropped metrics with timestamps too far from server time",
+				"monitor_id", monitorID,
+				"request_id", result.RequestID,
+				"dropped_count", skewed,
+				"max_metric_age", w.maxMetricAge,
+			)
+		}
+
+		metrics, invalid := sanitizeMetrics(metrics, w.nonFinitePolicy)
+		if len(invalid) > 0 {
+			w.logger.Warn("discarded non-finite metric values",
+				"monitor_id", monitorID,
+				"request_id", result.RequestID,
+				"names", invalid,
+				"policy", w.nonFinitePolicy,
+			)
+		}
+
+		var filtered int
+		metrics, filtered = w.filter.Apply(metrics)
+		w.recordFiltered(filtered)
+
+		for i := range metrics {
+			metrics[i].Tags = MergeTags(monitorTags, metrics[i].Tags)
+		}
+
 		w.logger.Debug("parsed metrics from plugin",
 			"monitor_id", monitorID,
 			"request_id", result.RequestID,
 			"metric_count", len(metrics),
 		)
 
-		for _, record := range metrics {
+		for i, record := range metrics {
 			if err := w.batchWriter.Submit(ctx, record); err != nil {
 				w.logger.Error("failed to submit metric to batch writer",
 					"monitor_id", monitorID,
@@ -71,7 +143,7 @@ func (w *PollResultWriter) Write(ctx context.Context, monitorID int64, results [
 					"name", record.Name,
 					"error", err,
 				)
-				continue
+				return fmt.Errorf("submitted %d of %d metrics: %w", i, len(metrics), err)
 			}
 
 			w.logger.Debug("metric submitted to batch writer",
@@ -87,20 +159,57 @@ func (w *PollResultWriter) Write(ctx context.Context, monitorID int64, results [
 			"metrics_submitted", len(metrics),
 		)
 	}
+	return nil
+}
+
+// recordFiltered counts metrics dropped by the name filter and logs the total once per
+// filterReportInterval, so a noisy plugin does not log on every poll
+func (w *PollResultWriter) recordFiltered(n int) {
+	if n > 0 {
+		w.filtered.Add(int64(n))
+	}
+	next := w.nextFilterLog.Load()
+	now := time.Now()
+	if now.UnixNano() < next || !w.nextFilterLog.CompareAndSwap(next, now.Add(filterReportInterval).UnixNano()) {
+		return
+	}
+	if total := w.filtered.Swap(0); total > 0 {
+		w.logger.Info("metrics dropped by name filter",
+			"filtered_count", total,
+			"interval", filterReportInterval,
+		)
+	}
+}
+
+// MergeTags combines a monitor's static tags with the tags a plugin reported for one
+// metric. The plugin's tags take precedence on key conflicts: they describe the specific
+// series (an interface, a disk) while monitor tags describe the device as a whole.
+// Neither input is modified.
+func MergeTags(monitorTags, pluginTags map[string]string) map[string]string {
+	if len(monitorTags) == 0 {
+		return pluginTags
+	}
+	if len(pluginTags) == 0 {
+		return monitorTags
+	}
+	merged := make(map[string]string, len(monitorTags)+len(pluginTags))
+	maps.Copy(merged, monitorTags)
+	maps.Copy(merged, pluginTags)
+	return merged
 }
 
 // parseMetricsFromPlugin converts plugin output to typed MetricRecord
 // raw is expected to be an array of metric objects from the plugin
-func parseMetricsFromPlugin(monitorID int64, timestamp time.Time, raw []interface{}) ([]MetricRecord, error) {
+func parseMetricsFromPlugin(monitorID int64, timestamp time.Time, raw []interface{}) ([]globals.MetricRecord, error) {
 	if raw == nil {
 		return nil, fmt.Errorf("raw metrics data is nil")
 	}
 
 	if len(raw) == 0 {
-		return []MetricRecord{}, nil
+		return []globals.MetricRecord{}, nil
 	}
 
-	metrics := make([]MetricRecord, 0, len(raw))
+	metrics := make([]globals.MetricRecord, 0, len(raw))
 
 	for i, item := range raw {
 		metricMap, ok := item.(map[string]interface{})
@@ -119,9 +228,112 @@ func parseMetricsFromPlugin(monitorID int64, timestamp time.Time, raw []interfac
 	return metrics, nil
 }
 
+// sanitizeMetrics removes records whose value is NaN or ±Inf, which PostgreSQL would reject
+// or store as NaN and poison aggregates with. It returns the kept records and the names of
+// the removed ones. Under the tag policy each removed record is replaced by a
+// "<name>.invalid" gauge of 1, leaving the original series untouched.
+func sanitizeMetrics(records []globals.MetricRecord, policy string) ([]globals.MetricRecord, []string) {
+	var invalid []string
+	kept := records[:0]
+	for _, record := range records {
+		if isFinite(record.Value) {
+			kept = append(kept, record)
+			continue
+		}
+		invalid = append(invalid, record.Name)
+		if policy == NonFiniteTag {
+			kept = append(kept, globals.MetricRecord{
+				MonitorID: record.MonitorID,
+				Timestamp: record.Timestamp,
+				Name:      record.Name + invalidMetricSuffix,
+				Value:     1,
+				Type:      "gauge",
+				Tags:      record.Tags,
+			})
+		}
+	}
+	return kept, invalid
+}
+
+// collectedAt returns the default time for a result's metrics: the result-level timestamp
+// the plugin reported, or received when the policy is "server" or the plugin sent none.
+// Metrics carrying their own timestamp keep it either way.
+func (w *PollResultWriter) collectedAt(monitorID int64, result globals.PollResult, received time.Time) time.Time {
+	if w.timestampPolicy == TimestampServer || result.Timestamp == "" {
+		return received
+	}
+	collected, err := time.Parse(time.RFC3339, result.Timestamp)
+	if err != nil {
+		w.logger.Warn("ignoring invalid poll result timestamp",
+			"monitor_id", monitorID,
+			"request_id", result.RequestID,
+			"timestamp", result.Timestamp,
+			"error", err,
+		)
+		return received
+	}
+	return collected
+}
+
+// ApplyTimestampPolicy applies a metrics.timestamp_policy to records received at now. Under
+// "server" every record is moved to now; under "reject" records whose timestamp is more
+// than maxAge before or after now are removed. It returns the kept records and how many
+// were removed.
+func ApplyTimestampPolicy(records []globals.MetricRecord, policy string, maxAge time.Duration, now time.Time) ([]globals.MetricRecord, int) {
+	switch policy {
+	case TimestampServer:
+		for i := range records {
+			records[i].Timestamp = now.UTC()
+		}
+	case TimestampReject:
+		kept := records[:0]
+		for _, record := range records {
+			if !TimestampRejected(record.Timestamp, policy, maxAge, now) {
+				kept = append(kept, record)
+			}
+		}
+		return kept, len(records) - len(kept)
+	}
+	return records, 0
+}
+
+// TimestampRejected reports whether ApplyTimestampPolicy removes a record stamped ts
+func TimestampRejected(ts time.Time, policy string, maxAge time.Duration, now time.Time) bool {
+	return policy == TimestampReject && ts.Sub(now).Abs() > maxAge
+}
+
+// isFinite reports whether v is neither NaN nor ±Inf
+func isFinite(v float64) bool {
+	return !math.IsNaN(v) && !math.IsInf(v, 0)
+}
+
+// ParseMetricRecords validates externally pushed metrics, which use the same record shape
+// plugins emit: {"name", "value", "type"?, "unit"?, "tags"?, "timestamp"?}. Unlike plugin output,
+// the type must be one of gauge, counter or derive, and NaN/Inf values are rejected.
+func ParseMetricRecords(monitorID int64, timestamp time.Time, raw []interface{}) ([]globals.MetricRecord, error) {
+	records, err := parseMetricsFromPlugin(monitorID, timestamp, raw)
+	if err != nil {
+		return nil, err
+	}
+	for i, record := range records {
+		if !isFinite(record.Value) {
+			return nil, fmt.Errorf("metric at index %d (%s) has non-finite value %v", i, record.Name, record.Value)
+		}
+		switch record.Type {
+		case "gauge", "counter", "derive":
+		default:
+			return nil, fmt.Errorf("metric at index %d has invalid type %q (want gauge, counter or derive)", i, record.Type)
+		}
+	}
+	return records, nil
+}
+
+// maxUnitLength matches the width of the metrics.unit column
+const maxUnitLength = 20
+
 // parseMetricFromMap converts a map to a MetricRecord struct
-func parseMetricFromMap(data map[string]interface{}, monitorID int64, defaultTimestamp time.Time) (MetricRecord, error) {
-	record := MetricRecord{
+func parseMetricFromMap(data map[string]interface{}, monitorID int64, defaultTimestamp time.Time) (globals.MetricRecord, error) {
+	record := globals.MetricRecord{
 		Timestamp: defaultTimestamp,
 		MonitorID: monitorID,
 		Type:      "gauge", // Default type
@@ -146,6 +358,32 @@ func parseMetricFromMap(data map[string]interface{}, monitorID int64, defaultTim
 		record.Type = metricType
 	}
 
+	// Parse unit (optional, stored as NULL when absent)
+	if unit, ok := data["unit"].(string); ok {
+		if len(unit) > maxUnitLength {
+			return record, fmt.Errorf("'unit' longer than %d characters", maxUnitLength)
+		}
+		record.Unit = unit
+	}
+
+	// Parse tags (optional): an object of string values
+	if raw, ok := data["tags"]; ok && raw != nil {
+		obj, ok := raw.(map[string]interface{})
+		if !ok {
+			return record, fmt.Errorf("'tags' must be an object, got %T", raw)
+		}
+		if len(obj) > 0 {
+			record.Tags = make(map[string]string, len(obj))
+		}
+		for key, val := range obj {
+			str, ok := val.(string)
+			if !ok {
+				return record, fmt.Errorf("tag %q must be a string, got %T", key, val)
+			}
+			record.Tags[key] = str
+		}
+	}
+
 	// Parse timestamp (optional, use default if not provided)
 	if ts, ok := data["timestamp"].(string); ok {
 		parsedTime, err := time.Parse(time.RFC3339, ts)
@@ -0,0 +1,343 @@
+package poller
+
+import (
+	"context"
+	"maps"
+	"math"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/nmslite/nmslite/internal/globals"
+)
+
+func TestSanitizeMetrics(t *testing.T) {
+	testCases := []struct {
+		name        string
+		policy      string
+		values      map[string]float64
+		wantKept    []string
+		wantInvalid []string
+	}{
+		{"All finite", "", map[string]float64{"a": 1, "b": 0}, []string{"a", "b"}, nil},
+		{"NaN dropped", "drop", map[string]float64{"a": 1, "b": math.NaN()}, []string{"a"}, []string{"b"}},
+		{"Inf dropped by default", "", map[string]float64{"a": math.Inf(1), "b": math.Inf(-1), "c": 2}, []string{"c"}, []string{"a", "b"}},
+		{"NaN tagged", NonFiniteTag, map[string]float64{"a": 1, "b": math.NaN()}, []string{"a", "b.invalid"}, []string{"b"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var batch []globals.MetricRecord
+			for name, value := range tc.values {
+				batch = append(batch, globals.MetricRecord{MonitorID: 1, Name: name, Value: value, Type: "gauge"})
+			}
+
+			kept, invalid := sanitizeMetrics(batch, tc.policy)
+
+			var keptNames []string
+			for _, r := range kept {
+				if !isFinite(r.Value) {
+					t.Errorf("Expected only finite values kept, got %s=%v", r.Name, r.Value)
+				}
+				if r.Name == "b.invalid" && r.Value != 1 {
+					t.Errorf("Expected invalid marker value 1, got %v", r.Value)
+				}
+				keptNames = append(keptNames, r.Name)
+			}
+			slices.Sort(keptNames)
+			slices.Sort(invalid)
+			if !slices.Equal(keptNames, tc.wantKept) {
+				t.Errorf("Expected kept %v, got %v", tc.wantKept, keptNames)
+			}
+			if !slices.Equal(invalid, tc.wantInvalid) {
+				t.Errorf("Expected invalid %v, got %v", tc.wantInvalid, invalid)
+			}
+		})
+	}
+}
+
+func TestApplyTimestampPolicy(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	timestamps := map[string]time.Time{
+		"current": now.Add(-30 * time.Second),
+		"stale":   now.Add(-time.Hour),
+		"future":  now.Add(10 * time.Minute), // clock-skewed device
+		"edge":    now.Add(-5 * time.Minute),
+	}
+
+	testCases := []struct {
+		policy      string
+		wantKept    []string
+		wantDropped int
+		wantServer  bool // every kept record is moved to now
+	}{
+		{TimestampPlugin, []string{"current", "edge", "future", "stale"}, 0, false},
+		{"", []string{"current", "edge", "future", "stale"}, 0, false},
+		{TimestampServer, []string{"current", "edge", "future", "stale"}, 0, true},
+		{TimestampReject, []string{"current", "edge"}, 2, false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.policy, func(t *testing.T) {
+			var batch []globals.MetricRecord
+			for name, ts := range timestamps {
+				batch = append(batch, globals.MetricRecord{MonitorID: 1, Name: name, Timestamp: ts})
+			}
+
+			kept, dropped := ApplyTimestampPolicy(batch, tc.policy, 5*time.Minute, now)
+
+			var names []string
+			for _, r := range kept {
+				names = append(names, r.Name)
+				want := timestamps[r.Name]
+				if tc.wantServer {
+					want = now
+				}
+				if !r.Timestamp.Equal(want) {
+					t.Errorf("%s: Expected timestamp %v, got %v", r.Name, want, r.Timestamp)
+				}
+			}
+			slices.Sort(names)
+			if !slices.Equal(names, tc.wantKept) {
+				t.Errorf("Expected kept %v, got %v", tc.wantKept, names)
+			}
+			if dropped != tc.wantDropped {
+				t.Errorf("Expected %d dropped, got %d", tc.wantDropped, dropped)
+			}
+		})
+	}
+}
+
+func TestParseMetricRecordsRejectsNonFinite(t *testing.T) {
+	testCases := []struct {
+		name    string
+		value   interface{}
+		wantErr bool
+	}{
+		{"Finite number", 42.5, false},
+		{"NaN", math.NaN(), true},
+		{"Positive Inf", math.Inf(1), true},
+		{"NaN string", "NaN", true},
+		{"Inf string", "-Inf", true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			raw := []interface{}{
+				map[string]interface{}{"name": "system.memory.usage_percent", "value": tc.value, "type": "gauge"},
+			}
+
+			_, err := ParseMetricRecords(1, time.Now(), raw)
+			if tc.wantErr && err == nil {
+				t.Error("Expected non-finite value to be rejected")
+			}
+			if !tc.wantErr && err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestParseMetricUnit(t *testing.T) {
+	testCases := []struct {
+		name     string
+		unit     interface{}
+		wantUnit string
+		wantErr  bool
+	}{
+		{"Unit given", "bytes", "bytes", false},
+		{"No unit", nil, "", false},
+		{"Unit too long", "bytes per fortnight per core", "", true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			metric := map[string]interface{}{"name": "system.memory.used_bytes", "value": 1.0}
+			if tc.unit != nil {
+				metric["unit"] = tc.unit
+			}
+
+			records, err := parseMetricsFromPlugin(1, time.Now(), []interface{}{metric})
+			if tc.wantErr {
+				if err == nil {
+					t.Error("Expected an oversized unit to be rejected")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if records[0].Unit != tc.wantUnit {
+				t.Errorf("Expected unit %q, got %q", tc.wantUnit, records[0].Unit)
+			}
+		})
+	}
+}
+
+func TestMergeTags(t *testing.T) {
+	testCases := []struct {
+		name        string
+		monitorTags map[string]string
+		pluginTags  map[string]string
+		want        map[string]string
+	}{
+		{"No tags", nil, nil, nil},
+		{"Monitor tags only", map[string]string{"dc": "east"}, nil, map[string]string{"dc": "east"}},
+		{"Plugin tags only", nil, map[string]string{"iface": "eth0"}, map[string]string{"iface": "eth0"}},
+		{"Disjoint keys", map[string]string{"dc": "east"}, map[string]string{"iface": "eth0"}, map[string]string{"dc": "east", "iface": "eth0"}},
+		{"Plugin wins on conflict", map[string]string{"dc": "east", "env": "prod"}, map[string]string{"env": "staging"}, map[string]string{"dc": "east", "env": "staging"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			monitorBefore := maps.Clone(tc.monitorTags)
+
+			got := MergeTags(tc.monitorTags, tc.pluginTags)
+			if !maps.Equal(got, tc.want) {
+				t.Errorf("Expected %v, got %v", tc.want, got)
+			}
+			if !maps.Equal(tc.monitorTags, monitorBefore) {
+				t.Errorf("Expected monitor tags unchanged, got %v", tc.monitorTags)
+			}
+		})
+	}
+}
+
+func TestParseMetricTags(t *testing.T) {
+	testCases := []struct {
+		name     string
+		tags     interface{}
+		wantTags map[string]string
+		wantErr  bool
+	}{
+		{"Tags given", map[string]interface{}{"iface": "eth0"}, map[string]string{"iface": "eth0"}, false},
+		{"No tags", nil, nil, false},
+		{"Empty tags", map[string]interface{}{}, nil, false},
+		{"Not an object", "iface=eth0", nil, true},
+		{"Non-string value", map[string]interface{}{"index": 3.0}, nil, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			metric := map[string]interface{}{"name": "net.rx_bytes", "value": 1.0}
+			if tc.tags != nil {
+				metric["tags"] = tc.tags
+			}
+
+			records, err := parseMetricsFromPlugin(1, time.Now(), []interface{}{metric})
+			if tc.wantErr {
+				if err == nil {
+					t.Error("Expected invalid tags to be rejected")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !maps.Equal(records[0].Tags, tc.wantTags) {
+				t.Errorf("Expected tags %v, got %v", tc.wantTags, records[0].Tags)
+			}
+		})
+	}
+}
+
+func TestPollResultWriterMergesMonitorTags(t *testing.T) {
+	globals.SetGlobalConfigForTests(&globals.Config{Metrics: globals.MetricsConfig{BatchSize: 10, FlushIntervalMS: 60000}})
+	sink := &MemorySink{}
+	bw := NewBatchWriter(sink)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_ = bw.Run(context.Background())
+	}()
+
+	results := []globals.PollResult{{
+		Status: "success",
+		Metrics: []interface{}{
+			map[string]interface{}{"name": "system.cpu.usage", "value": 12.0},
+			map[string]interface{}{"name": "net.rx_bytes", "value": 5.0, "tags": map[string]interface{}{"iface": "eth0", "env": "lab"}},
+		},
+	}}
+	monitorTags := map[string]string{"dc": "east", "env": "prod"}
+
+	if err := NewPollResultWriter(bw).Write(context.Background(), 1, monitorTags, results); err != nil {
+		t.Fatalf("Unexpected write error: %v", err)
+	}
+	if _, err := bw.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Unexpected shutdown error: %v", err)
+	}
+	<-done
+
+	want := map[string]map[string]string{
+		"system.cpu.usage": {"dc": "east", "env": "prod"},
+		"net.rx_bytes":     {"dc": "east", "env": "lab", "iface": "eth0"},
+	}
+	records := sink.Records()
+	if len(records) != len(want) {
+		t.Fatalf("Expected %d records, got %d", len(want), len(records))
+	}
+	for _, r := range records {
+		if !maps.Equal(r.Tags, want[r.Name]) {
+			t.Errorf("%s: Expected tags %v, got %v", r.Name, want[r.Name], r.Tags)
+		}
+	}
+}
+
+func TestPollResultWriterUsesResultTimestamp(t *testing.T) {
+	collected := time.Now().Add(-time.Hour).Truncate(time.Second)
+
+	testCases := []struct {
+		name        string
+		policy      string
+		wantRecords int
+		wantOld     bool
+	}{
+		{name: "plugin keeps result time", policy: TimestampPlugin, wantRecords: 1, wantOld: true},
+		{name: "reject drops old result", policy: TimestampReject, wantRecords: 0},
+		{name: "server uses arrival time", policy: TimestampServer, wantRecords: 1},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			globals.SetGlobalConfigForTests(&globals.Config{Metrics: globals.MetricsConfig{
+				BatchSize:           10,
+				FlushIntervalMS:     60000,
+				TimestampPolicy:     tc.policy,
+				MaxMetricAgeMinutes: 5,
+			}})
+			sink := &MemorySink{}
+			bw := NewBatchWriter(sink)
+
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				_ = bw.Run(context.Background())
+			}()
+
+			results := []globals.PollResult{{
+				Status:    "success",
+				Timestamp: collected.UTC().Format(time.RFC3339),
+				Metrics:   []interface{}{map[string]interface{}{"name": "system.cpu.usage", "value": 12.0}},
+			}}
+			if err := NewPollResultWriter(bw).Write(context.Background(), 1, nil, results); err != nil {
+				t.Fatalf("Unexpected write error: %v", err)
+			}
+			if _, err := bw.Shutdown(context.Background()); err != nil {
+				t.Fatalf("Unexpected shutdown error: %v", err)
+			}
+			<-done
+
+			records := sink.Records()
+			if len(records) != tc.wantRecords {
+				t.Fatalf("Expected %d records, got %d", tc.wantRecords, len(records))
+			}
+			if tc.wantRecords == 0 {
+				return
+			}
+			if got := records[0].Timestamp.Equal(collected); got != tc.wantOld {
+				t.Errorf("Expected result timestamp used = %v, got timestamp %v", tc.wantOld, records[0].Timestamp)
+			}
+		})
+	}
+}
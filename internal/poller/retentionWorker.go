@@ -0,0 +1,127 @@
+package poller
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/nmslite/nmslite/internal/database/dbgen"
+	"github.com/nmslite/nmslite/internal/globals"
+)
+
+// RetentionWorker periodically deletes metrics older than the configured retention period,
+// and hourly rollups older than the rollup retention period
+type RetentionWorker struct {
+	querier dbgen.Querier
+	logger  *slog.Logger
+
+	retention       time.Duration
+	rollupRetention time.Duration // 0 keeps rollups forever
+	interval        time.Duration
+	batchSize       int32
+}
+
+// NewRetentionWorker creates a new RetentionWorker instance
+func NewRetentionWorker(querier dbgen.Querier) *RetentionWorker {
+	cfg := &globals.GetConfig().Metrics
+
+	// Set defaults if not configured
+	retention := cfg.RetentionPeriod()
+	if retention <= 0 {
+		retention = 90 * 24 * time.Hour
+	}
+
+	interval := cfg.RetentionInterval()
+	if interval <= 0 {
+		interval = time.Hour
+	}
+
+	batchSize := cfg.RetentionBatchSize
+	if batchSize <= 0 {
+		batchSize = 10000
+	}
+
+	return &RetentionWorker{
+		querier:         querier,
+		logger:          slog.Default().With("component", "retention"),
+		retention:       retention,
+		rollupRetention: cfg.RollupRetention(),
+		interval:        interval,
+		batchSize:       int32(batchSize),
+	}
+}
+
+// Run starts the retention loop and blocks until context is cancelled
+func (rw *RetentionWorker) Run(ctx context.Context) error {
+	rw.logger.Info("retention worker starting",
+		"retention", rw.retention,
+		"rollup_retention", rw.rollupRetention,
+		"interval", rw.interval,
+		"batch_size", rw.batchSize,
+	)
+
+	ticker := time.NewTicker(rw.interval)
+	defer ticker.Stop()
+
+	// Purge once at startup so a long-stopped server catches up immediately
+	rw.purge(ctx)
+
+	for {
+		select {
+		case <-ctx.Done():
+			rw.logger.Info("retention worker shutting down")
+			return ctx.Err()
+		case <-ticker.C:
+			rw.purge(ctx)
+		}
+	}
+}
+
+// purge deletes expired metrics and rollups
+func (rw *RetentionWorker) purge(ctx context.Context) {
+	rw.purgeTable(ctx, "metrics", rw.retention, func(cutoff time.Time) (int64, error) {
+		return rw.querier.DeleteMetricsOlderThan(ctx, dbgen.DeleteMetricsOlderThanParams{
+			Cutoff:     cutoff,
+			LimitCount: rw.batchSize,
+		})
+	})
+	if rw.rollupRetention <= 0 {
+		return
+	}
+	rw.purgeTable(ctx, "metrics_rollup", rw.rollupRetention, func(cutoff time.Time) (int64, error) {
+		return rw.querier.DeleteMetricRollupsOlderThan(ctx, dbgen.DeleteMetricRollupsOlderThanParams{
+			Cutoff:     cutoff,
+			LimitCount: rw.batchSize,
+		})
+	})
+}
+
+// purgeTable deletes rows older than retention in bounded batches until none remain or
+// ctx is cancelled
+func (rw *RetentionWorker) purgeTable(ctx context.Context, table string, retention time.Duration, deleteBatch func(cutoff time.Time) (int64, error)) {
+	cutoff := time.Now().Add(-retention)
+	startTime := time.Now()
+
+	var total int64
+	for ctx.Err() == nil {
+		deleted, err := deleteBatch(cutoff)
+		if err != nil {
+			if ctx.Err() == nil {
+				rw.logger.Error("failed to delete expired rows", "table", table, "error", err, "deleted_so_far", total)
+			}
+			break
+		}
+
+		total += deleted
+		if deleted < int64(rw.batchSize) {
+			break
+		}
+	}
+
+	rw.logger.Info("retention purge finished",
+		"table", table,
+		"cutoff", cutoff,
+		"deleted", total,
+		"duration_ms", time.Since(startTime).Milliseconds(),
+	)
+}
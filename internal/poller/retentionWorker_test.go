@@ -0,0 +1,65 @@
+package poller
+
+import (
+	"context"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/nmslite/nmslite/internal/database/dbgen"
+)
+
+func TestRetentionWorkerPurge(t *testing.T) {
+	testCases := []struct {
+		name            string
+		rollupRetention time.Duration
+		wantRollups     int
+		wantRollupCalls int
+	}{
+		// 5 expired rollups in batches of 2 take three deletes, the last one short
+		{"Expired rollups purged", 365 * 24 * time.Hour, 1, 3},
+		{"Rollups kept forever", 0, 6, 0},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			now := time.Now()
+			q := newFakeQuerier()
+			q.metrics = []dbgen.Metric{
+				{DeviceID: 1, Name: "cpu", Timestamp: now.Add(-100 * 24 * time.Hour)},
+				{DeviceID: 1, Name: "cpu", Timestamp: now.Add(-time.Hour)},
+			}
+			for i := range 5 {
+				q.rollups = append(q.rollups, dbgen.MetricsRollup{DeviceID: 1, Name: "cpu", Bucket: now.Add(-time.Duration(400+i) * 24 * time.Hour)})
+			}
+			// Older than raw retention but still within rollup retention
+			q.rollups = append(q.rollups, dbgen.MetricsRollup{DeviceID: 1, Name: "cpu", Bucket: now.Add(-100 * 24 * time.Hour)})
+			rw := &RetentionWorker{
+				querier:         q,
+				logger:          slog.Default(),
+				retention:       90 * 24 * time.Hour,
+				rollupRetention: tc.rollupRetention,
+				batchSize:       2,
+			}
+
+			rw.purge(context.Background())
+
+			if len(q.metrics) != 1 || !q.metrics[0].Timestamp.Equal(now.Add(-time.Hour)) {
+				t.Errorf("Expected only the recent raw metric to remain, got %+v", q.metrics)
+			}
+			if len(q.rollups) != tc.wantRollups {
+				t.Errorf("Expected %d rollups to remain, got %d", tc.wantRollups, len(q.rollups))
+			}
+			if got := q.calls["DeleteMetricRollupsOlderThan"]; got != tc.wantRollupCalls {
+				t.Errorf("Expected %d rollup deletes, got %d", tc.wantRollupCalls, got)
+			}
+			if tc.wantRollupCalls == 0 {
+				return
+			}
+			cutoff := lastArgs[dbgen.DeleteMetricRollupsOlderThanParams](q, "DeleteMetricRollupsOlderThan").Cutoff
+			if age := time.Since(cutoff); age < 365*24*time.Hour || age > 365*24*time.Hour+time.Minute {
+				t.Errorf("Expected rollup cutoff ~365d ago, got %v ago", age)
+			}
+		})
+	}
+}
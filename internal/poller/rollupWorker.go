@@ -0,0 +1,161 @@
+package poller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/nmslite/nmslite/internal/database/dbgen"
+	"github.com/nmslite/nmslite/internal/globals"
+)
+
+// RollupWorker downsamples raw metrics older than RollupAfterHours into hourly
+// min/avg/max aggregates in metrics_rollup, then deletes the raw points.
+type RollupWorker struct {
+	pool   *pgxpool.Pool
+	logger *slog.Logger
+
+	threshold time.Duration
+	interval  time.Duration
+}
+
+// NewRollupWorker creates a new RollupWorker instance
+func NewRollupWorker(pool *pgxpool.Pool) *RollupWorker {
+	cfg := &globals.GetConfig().Metrics
+
+	interval := cfg.RollupInterval()
+	if interval <= 0 {
+		interval = 15 * time.Minute
+	}
+
+	return &RollupWorker{
+		pool:      pool,
+		logger:    slog.Default().With("component", "rollup"),
+		threshold: cfg.RollupAfter(),
+		interval:  interval,
+	}
+}
+
+// Enabled reports whether rollup is configured (RollupAfterHours > 0)
+func (rw *RollupWorker) Enabled() bool {
+	return rw.threshold > 0
+}
+
+// Run starts the rollup loop and blocks until context is cancelled
+func (rw *RollupWorker) Run(ctx context.Context) error {
+	if !rw.Enabled() {
+		rw.logger.Info("rollup disabled, rollup_after_hours not set")
+		return nil
+	}
+
+	rw.logger.Info("rollup worker starting",
+		"threshold", rw.threshold,
+		"interval", rw.interval,
+	)
+
+	ticker := time.NewTicker(rw.interval)
+	defer ticker.Stop()
+
+	rw.rollup(ctx)
+
+	for {
+		select {
+		case <-ctx.Done():
+			rw.logger.Info("rollup worker shutting down")
+			return ctx.Err()
+		case <-ticker.C:
+			rw.rollup(ctx)
+		}
+	}
+}
+
+// rollup processes complete hours older than the threshold, oldest first, one hour per transaction
+func (rw *RollupWorker) rollup(ctx context.Context) {
+	// Only whole hours are rolled up so a bucket is never split across runs
+	cutoff := time.Now().Add(-rw.threshold).Truncate(time.Hour)
+	q := dbgen.New(rw.pool)
+	startTime := time.Now()
+
+	var hours, buckets, deleted int64
+	for ctx.Err() == nil {
+		oldest, err := q.GetOldestMetricTimestampBefore(ctx, cutoff)
+		if errors.Is(err, pgx.ErrNoRows) {
+			break
+		}
+		if err != nil {
+			if ctx.Err() == nil {
+				rw.logger.Error("failed to find oldest raw metric", "error", err)
+			}
+			break
+		}
+
+		hourStart := oldest.Truncate(time.Hour)
+		hourEnd := hourStart.Add(time.Hour)
+
+		b, d, err := rw.rollupHour(ctx, hourStart, hourEnd)
+		if err != nil {
+			if ctx.Err() == nil {
+				rw.logger.Error("failed to roll up metrics",
+					"error", err,
+					"hour", hourStart,
+				)
+			}
+			break
+		}
+
+		hours++
+		buckets += b
+		deleted += d
+	}
+
+	if hours > 0 {
+		rw.logger.Info("rollup finished",
+			"cutoff", cutoff,
+			"hours", hours,
+			"buckets", buckets,
+			"raw_deleted", deleted,
+			"duration_ms", time.Since(startTime).Milliseconds(),
+		)
+	}
+}
+
+// rollupHour aggregates and deletes raw points in [start, end) atomically
+func (rw *RollupWorker) rollupHour(ctx context.Context, start, end time.Time) (int64, int64, error) {
+	tx, err := rw.pool.Begin(ctx)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		if err := tx.Rollback(ctx); err != nil && !errors.Is(err, pgx.ErrTxClosed) {
+			rw.logger.Warn("failed to rollback transaction", "error", err)
+		}
+	}()
+
+	qtx := dbgen.New(tx)
+
+	buckets, err := qtx.RollupMetricsRange(ctx, dbgen.RollupMetricsRangeParams{
+		StartTime: start,
+		EndTime:   end,
+	})
+	if err != nil {
+		return 0, 0, fmt.Errorf("rollup insert failed: %w", err)
+	}
+
+	deleted, err := qtx.DeleteMetricsInRange(ctx, dbgen.DeleteMetricsInRangeParams{
+		StartTime: start,
+		EndTime:   end,
+	})
+	if err != nil {
+		return 0, 0, fmt.Errorf("raw delete failed: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return buckets, deleted, nil
+}
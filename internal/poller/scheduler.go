@@ -1,12 +1,17 @@
 package poller
 
 import (
+	"bytes"
 	"container/heap"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
-	"net"
+	"math/rand/v2"
+	"slices"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/google/uuid"
@@ -20,18 +25,58 @@ import (
 type HeapItem struct {
 	MonitorID        int64
 	NextPollDeadline time.Time
+	Index            int // position in the heap, maintained by PriorityQueue; -1 once popped
 }
 
 // ScheduledMonitor holds the runtime state for a monitor (stored in map, not heap)
 type ScheduledMonitor struct {
 	Monitor             *dbgen.Monitor
 	ConsecutiveFailures int
-	NextPollDeadline    time.Time
-	IsPolling           bool // True if a poll is currently in progress
+	// ConsecutiveWriteFailures counts successful polls in a row whose metrics were not persisted
+	ConsecutiveWriteFailures int
+	// LastMetricAt is when a poll last returned metrics (or tracking or a recovery began);
+	// Stale is set once successful polls have returned none for StaleAfter intervals
+	// (both protected by SchedulerImpl.heapMu)
+	LastMetricAt     time.Time
+	Stale            bool
+	NextPollDeadline time.Time
+	IsPolling        bool   // True if a poll is currently in progress
+	LivenessMethod   string // tcp, icmp or none (resolved from plugin ID)
+	// Tags are the monitor's static tags, parsed from Monitor.Tags and merged into every
+	// metric it writes. Replaced, never mutated, so a poll may keep using an old map
+	// (protected by SchedulerImpl.heapMu).
+	Tags map[string]string
+
+	// heapItem is this monitor's queue entry, reused so deadlines are fixed in place
+	// (protected by SchedulerImpl.heapMu)
+	heapItem *HeapItem
 
 	// Crypto/Cache (protected by SchedulerImpl.heapMu)
 	EncryptedCredentials []byte            // Raw JSON from DB (eager loaded)
-	Credentials          *auth.Credentials // Decrypted on demand
+	Credentials          *auth.Credentials // Decrypted on demand, dropped after CredentialCacheTTL idle
+	CredentialsLastUsed  time.Time         // Last time Credentials was handed to a poll
+	// UseTLS caches the credentials' use_https flag once known (nil until then). It is not
+	// secret, so it survives eviction and is only reset when the payload changes.
+	UseTLS *bool
+}
+
+// replaceCredentials swaps in a new encrypted payload and drops everything derived from
+// the old one. Caller must hold heapMu.
+func (sm *ScheduledMonitor) replaceCredentials(payload []byte) {
+	sm.EncryptedCredentials = payload
+	sm.UseTLS = nil
+	sm.clearCredentials()
+}
+
+// clearCredentials wipes and drops the cached plaintext credentials.
+// Go strings cannot be overwritten in place, so this releases the only references
+// and leaves the memory for the GC. Caller must hold heapMu.
+func (sm *ScheduledMonitor) clearCredentials() {
+	if sm.Credentials != nil {
+		*sm.Credentials = auth.Credentials{}
+		sm.Credentials = nil
+	}
+	sm.CredentialsLastUsed = time.Time{}
 }
 
 // PriorityQueue implements heap.Interface for *HeapItem
@@ -42,16 +87,22 @@ func (pq PriorityQueue) Len() int {
 }
 
 func (pq PriorityQueue) Less(i, j int) bool {
-	// Earlier deadlines have higher priority
-	return pq[i].NextPollDeadline.Before(pq[j].NextPollDeadline)
+	// Earlier deadlines have higher priority; ties break on MonitorID for a stable total order
+	if !pq[i].NextPollDeadline.Equal(pq[j].NextPollDeadline) {
+		return pq[i].NextPollDeadline.Before(pq[j].NextPollDeadline)
+	}
+	return pq[i].MonitorID < pq[j].MonitorID
 }
 
 func (pq PriorityQueue) Swap(i, j int) {
 	pq[i], pq[j] = pq[j], pq[i]
+	pq[i].Index = i
+	pq[j].Index = j
 }
 
 func (pq *PriorityQueue) Push(x interface{}) {
 	item := x.(*HeapItem)
+	item.Index = len(*pq)
 	*pq = append(*pq, item)
 }
 
@@ -60,19 +111,44 @@ func (pq *PriorityQueue) Pop() interface{} {
 	n := len(old)
 	item := old[n-1]
 	old[n-1] = nil // avoid memory leak
+	item.Index = -1
 	*pq = old[0 : n-1]
 	return item
 }
 
+// scheduleUnlocked sets a monitor's next deadline, moving its existing heap entry in place
+// or pushing it if it is not queued. Caller must hold heapMu lock.
+func (s *SchedulerImpl) scheduleUnlocked(sm *ScheduledMonitor, deadline time.Time) {
+	sm.NextPollDeadline = deadline
+
+	item := sm.heapItem
+	if item == nil {
+		item = &HeapItem{MonitorID: sm.Monitor.ID, Index: -1}
+		sm.heapItem = item
+	}
+	item.NextPollDeadline = deadline
+
+	if item.Index >= 0 && item.Index < len(s.heap) && s.heap[item.Index] == item {
+		heap.Fix(&s.heap, item.Index)
+		return
+	}
+	heap.Push(&s.heap, item)
+}
+
 // SchedulerImpl manages the scheduling and execution of monitor polling tasks
 type SchedulerImpl struct {
 	// Dependencies
 	events        *globals.EventChannels
 	querier       dbgen.Querier
 	pluginManager *PluginManager
-	credService   *auth.CredentialService
-	resultWriter  *PollResultWriter
-	logger        *slog.Logger
+	// collectors poll protocols in-process when no plugin binary is loaded for them
+	collectors   map[string]Collector
+	credService  *auth.CredentialService
+	resultWriter ResultWriter
+	logger       *slog.Logger
+
+	// writeFailures counts successful polls whose metrics could not be persisted
+	writeFailures atomic.Int64
 
 	// Configuration
 	config *globals.SchedulerConfig
@@ -81,16 +157,62 @@ type SchedulerImpl struct {
 	heap     PriorityQueue
 	heapMu   sync.Mutex
 	monitors map[int64]*ScheduledMonitor
+	// invalidated records the last sequenced cache invalidation applied per monitor, so a
+	// late, older update cannot undo a delete (protected by heapMu)
+	invalidated map[int64]invalidateMark
 
 	// Semaphores for concurrency control
 	livenessSem chan struct{}
 	pluginSem   chan struct{}
+	// pollSlots holds one token per monitor being polled, capping polls in flight across
+	// all plugins (nil = unlimited); inFlightPolls counts them either way
+	pollSlots     chan struct{}
+	inFlightPolls atomic.Int64
+
+	// livenessPool replaces the per-monitor liveness goroutines when batched liveness is
+	// on; it is started by Run and nil otherwise
+	livenessPool    *livenessPool
+	batchedLiveness bool
+	livenessWorkers int
+	livenessQueue   int
+
+	// icmpUnavailableOnce logs the missing raw-socket privilege warning only once
+	icmpUnavailableOnce sync.Once
 
 	// Lifecycle management
 	running bool
 	runMu   sync.Mutex
 	done    chan struct{}
 	wg      sync.WaitGroup
+
+	// shutdownTimeout bounds how long shutdown waits for in-flight batches
+	shutdownTimeout time.Duration
+
+	// inFlight tracks dispatched plugin batches so a forced drain can report them
+	inFlightMu  sync.Mutex
+	inFlight    map[uint64]inFlightBatch
+	nextBatchID uint64
+
+	// now reads the clock for deadline math (time.Now when nil; tests simulate clock
+	// jumps with it)
+	now func() time.Time
+}
+
+// invalidateMark is the last sequenced cache invalidation applied to a monitor
+type invalidateMark struct {
+	Seq     uint64
+	Applied time.Time
+}
+
+// invalidateMarkTTL is how long an invalidateMark is kept. Out-of-order events come from
+// requests racing each other, so they arrive well within it.
+const invalidateMarkTTL = time.Minute
+
+// inFlightBatch describes a plugin batch that has been dispatched but not finished
+type inFlightBatch struct {
+	PluginID string
+	Monitors int
+	Started  time.Time
 }
 
 // NewSchedulerImpl creates a new SchedulerImpl instance
@@ -99,22 +221,33 @@ func NewSchedulerImpl(
 	events *globals.EventChannels,
 	pluginManager *PluginManager,
 	credService *auth.CredentialService,
-	resultWriter *PollResultWriter,
+	resultWriter ResultWriter,
 ) *SchedulerImpl {
 	cfg := &globals.GetConfig().Scheduler
+	pollerCfg := globals.GetConfig().Poller
+	livenessWorkers := pollerCfg.LivenessPoolWorkers(cfg.LivenessWorkers)
 	return &SchedulerImpl{
 		querier:       querier,
 		events:        events,
 		pluginManager: pluginManager,
 		credService:   credService,
 		resultWriter:  resultWriter,
-		logger:        slog.Default().With("component", "scheduler"),
+		logger:        globals.SampleDebug(slog.Default().With("component", "scheduler"), globals.GetConfig().Logging.DebugSampleEvery),
 		config:        cfg,
 		livenessSem:   make(chan struct{}, cfg.LivenessWorkers),
 		pluginSem:     make(chan struct{}, cfg.PluginWorkers),
-		heap:          make(PriorityQueue, 0),
-		monitors:      make(map[int64]*ScheduledMonitor),
-		done:          make(chan struct{}),
+		pollSlots:     newPollSlots(cfg.MaxInFlightPolls),
+
+		batchedLiveness: pollerCfg.BatchedLiveness,
+		livenessWorkers: livenessWorkers,
+		livenessQueue:   pollerCfg.LivenessQueueSize(livenessWorkers),
+
+		heap:        make(PriorityQueue, 0),
+		monitors:    make(map[int64]*ScheduledMonitor),
+		invalidated: make(map[int64]invalidateMark),
+		done:        make(chan struct{}),
+
+		shutdownTimeout: globals.GetConfig().Server.ShutdownTimeout(),
 	}
 }
 
@@ -140,9 +273,30 @@ func (s *SchedulerImpl) Run(ctx context.Context) error {
 		return fmt.Errorf("failed to load monitors: %w", err)
 	}
 
+	if s.batchedLiveness {
+		s.livenessPool = newLivenessPool(ctx, s.livenessWorkers, s.livenessQueue, s.checkLiveness)
+		s.logger.Info("batched liveness enabled", "workers", s.livenessWorkers, "queue", s.livenessQueue)
+	}
+
+	// Cache invalidations are applied off the tick loop, so a burst of edits cannot delay polling
+	for range s.config.InvalidateConcurrency() {
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.runInvalidations(ctx)
+		}()
+	}
+
 	ticker := time.NewTicker(s.config.TickInterval())
 	defer ticker.Stop()
 
+	credTTL := s.config.CredentialCacheTTL()
+	credSweep := time.NewTicker(max(credTTL/2, time.Second))
+	defer credSweep.Stop()
+
+	// Set to nil once the channel closes so the select stops receiving from it
+	pollNow := s.events.PollNow
+
 	for {
 		select {
 		case <-ctx.Done():
@@ -155,26 +309,116 @@ func (s *SchedulerImpl) Run(ctx context.Context) error {
 			return nil
 		case <-ticker.C:
 			s.tick(ctx)
-		case event := <-s.events.CacheInvalidate:
-			s.logger.Info("received cache invalidation event",
-				"type", event.UpdateType,
-				"update_count", len(event.Monitors),
-				"delete_count", len(event.MonitorIDs),
-			)
-			if event.UpdateType == "update" {
-				for _, row := range event.Monitors {
-					s.updateMonitorCacheFromRow(row)
-				}
-			} else if event.UpdateType == "delete" {
-				for _, id := range event.MonitorIDs {
-					s.removeMonitorFromCache(id)
-				}
+		case now := <-credSweep.C:
+			if evicted := s.evictIdleCredentials(now.Add(-credTTL)); evicted > 0 {
+				s.logger.Debug("evicted idle decrypted credentials", "count", evicted)
+			}
+			s.pruneInvalidateMarks(now.Add(-invalidateMarkTTL))
+		case event, ok := <-pollNow:
+			if !ok {
+				pollNow = nil
+				continue
+			}
+			if due := s.PollNow(event.MonitorIDs); due > 0 {
+				s.logger.Info("monitors scheduled for immediate poll",
+					"reason", event.Reason,
+					"count", due,
+				)
+			}
+		}
+	}
+}
+
+// runInvalidations applies cache invalidation events until the scheduler stops
+func (s *SchedulerImpl) runInvalidations(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.done:
+			return
+		case event, ok := <-s.events.CacheInvalidate:
+			if !ok {
+				return
+			}
+			s.applyCacheInvalidate(event)
+		}
+	}
+}
+
+// applyCacheInvalidate applies an update or delete to the scheduler cache. Sequenced
+// events are applied in sequence order per monitor: one older than the last applied for
+// that monitor is dropped, so an update read before a delete cannot re-add the monitor,
+// whichever of the two is received first. Safe to call from several goroutines.
+func (s *SchedulerImpl) applyCacheInvalidate(event globals.CacheInvalidateEvent) {
+	s.logger.Info("received cache invalidation event",
+		"type", event.UpdateType,
+		"update_count", len(event.Monitors),
+		"delete_count", len(event.MonitorIDs),
+		"seq", event.Seq,
+	)
+
+	// Rows are converted before taking heapMu, so concurrent workers serialize only on
+	// the map and heap changes
+	updates := make([]monitorUpdate, len(event.Monitors))
+	for i, row := range event.Monitors {
+		updates[i] = s.prepareMonitorUpdate(row)
+	}
+
+	s.heapMu.Lock()
+	defer s.heapMu.Unlock()
+
+	switch event.UpdateType {
+	case "update":
+		for _, u := range updates {
+			if s.claimInvalidateUnlocked(u.row.ID, event.Seq) {
+				s.updateMonitorCacheUnlocked(u)
+			}
+		}
+	case "delete":
+		for _, id := range event.MonitorIDs {
+			if s.claimInvalidateUnlocked(id, event.Seq) {
+				s.removeMonitorUnlocked(id)
 			}
 		}
 	}
 }
 
-// LoadActiveMonitors loads all active monitors from the database at startup
+// claimInvalidateUnlocked reports whether an event with seq may be applied to a monitor,
+// recording it as the monitor's latest. Unsequenced events always apply.
+// Caller must hold heapMu lock.
+func (s *SchedulerImpl) claimInvalidateUnlocked(id int64, seq uint64) bool {
+	if seq == 0 {
+		return true
+	}
+	if mark, ok := s.invalidated[id]; ok && mark.Seq > seq {
+		s.logger.Info("ignored out-of-order cache invalidation",
+			"monitor_id", id,
+			"seq", seq,
+			"applied_seq", mark.Seq,
+		)
+		return false
+	}
+	s.invalidated[id] = invalidateMark{Seq: seq, Applied: time.Now()}
+	return true
+}
+
+// pruneInvalidateMarks forgets invalidation sequence marks applied before cutoff
+func (s *SchedulerImpl) pruneInvalidateMarks(cutoff time.Time) {
+	s.heapMu.Lock()
+	defer s.heapMu.Unlock()
+
+	for id, mark := range s.invalidated {
+		if mark.Applied.Before(cutoff) {
+			delete(s.invalidated, id)
+		}
+	}
+}
+
+// LoadActiveMonitors loads all active monitors from the database. At startup it fills the
+// cache; called again on a running scheduler it reconciles the cache with the database:
+// known monitors keep their schedule, new ones are due immediately and monitors no
+// longer active are dropped.
 func (s *SchedulerImpl) LoadActiveMonitors(ctx context.Context) error {
 	s.logger.Info("Loading active monitors from database")
 
@@ -184,8 +428,14 @@ func (s *SchedulerImpl) LoadActiveMonitors(ctx context.Context) error {
 		return fmt.Errorf("failed to query monitors: %w", err)
 	}
 
-	activeCount := 0
+	s.heapMu.Lock()
+	defer s.heapMu.Unlock()
+
+	active := make(map[int64]struct{}, len(rows))
+	added := 0
 	for _, row := range rows {
+		active[row.ID] = struct{}{}
+
 		// Convert sqlc row to dbgen.Monitor
 		m := &dbgen.Monitor{
 			ID:                     row.ID,
@@ -200,36 +450,114 @@ func (s *SchedulerImpl) LoadActiveMonitors(ctx context.Context) error {
 			Status:                 row.Status,
 			CreatedAt:              row.CreatedAt,
 			UpdatedAt:              row.UpdatedAt,
+			Collectors:             row.Collectors,
+			KeepPollingWhenDown:    row.KeepPollingWhenDown,
+			Tags:                   row.Tags,
+		}
+
+		if sm, exists := s.monitors[m.ID]; exists {
+			sm.Monitor = m
+			sm.Tags = s.parseMonitorTags(m.ID, m.Tags)
+			sm.LivenessMethod = resolveLivenessMethod(s.config, m.PluginID)
+			if !bytes.Equal(sm.EncryptedCredentials, row.Payload) {
+				sm.replaceCredentials(row.Payload) // Force re-decryption
+			}
+			continue
 		}
 
-		now := time.Now()
 		sm := &ScheduledMonitor{
 			Monitor:              m,
 			EncryptedCredentials: row.Payload, // Already joined from credential_profiles
-			NextPollDeadline:     now,
+			LivenessMethod:       resolveLivenessMethod(s.config, m.PluginID),
+			Tags:                 s.parseMonitorTags(m.ID, m.Tags),
 		}
+		s.restoreStateUnlocked(sm)
 		s.monitors[m.ID] = sm
-		heap.Push(&s.heap, &HeapItem{
-			MonitorID:        m.ID,
-			NextPollDeadline: now,
-		})
-		activeCount++
+		s.scheduleUnlocked(sm, s.initialDeadline(sm, s.clock()))
+		added++
+	}
+
+	removed := 0
+	for id, sm := range s.monitors {
+		if _, ok := active[id]; !ok {
+			s.untrackUnlocked(sm)
+			removed++
+		}
 	}
 
 	s.logger.Info("Active monitors loaded",
-		"active_monitors", activeCount,
+		"active_monitors", len(rows),
+		"added", added,
+		"removed", removed,
 	)
 
 	return nil
 }
 
+// Snapshot returns the scheduler's current state. It is safe to call while Run is active.
+func (s *SchedulerImpl) Snapshot() globals.SchedulerSnapshot {
+	s.runMu.Lock()
+	snap := globals.SchedulerSnapshot{
+		Running:         s.running,
+		PollingMonitors: []int64{},
+		StaleMonitors:   []int64{},
+		InFlightBatches: make(map[string]int),
+	}
+	s.runMu.Unlock()
+
+	s.heapMu.Lock()
+	snap.TrackedMonitors = len(s.monitors)
+	snap.HeapSize = len(s.heap)
+	if len(s.heap) > 0 {
+		next := s.heap[0].NextPollDeadline
+		snap.NextDue = &next
+	}
+	for id, sm := range s.monitors {
+		if sm.IsPolling {
+			snap.PollingMonitors = append(snap.PollingMonitors, id)
+		}
+		if sm.Stale {
+			snap.StaleMonitors = append(snap.StaleMonitors, id)
+		}
+	}
+	s.heapMu.Unlock()
+	slices.Sort(snap.PollingMonitors)
+	slices.Sort(snap.StaleMonitors)
+
+	s.inFlightMu.Lock()
+	for _, b := range s.inFlight {
+		snap.InFlightBatches[b.PluginID]++
+	}
+	s.inFlightMu.Unlock()
+
+	return snap
+}
+
+// PollNow moves the given monitors' next poll deadline to now so the next tick polls them.
+// Untracked monitors and those already being polled are skipped. Returns how many were moved.
+func (s *SchedulerImpl) PollNow(monitorIDs []int64) int {
+	s.heapMu.Lock()
+	defer s.heapMu.Unlock()
+
+	now := s.clock()
+	due := 0
+	for _, id := range monitorIDs {
+		sm, exists := s.monitors[id]
+		if !exists || sm.IsPolling {
+			continue
+		}
+		if sm.NextPollDeadline.After(now) {
+			s.scheduleUnlocked(sm, now)
+		}
+		due++
+	}
+	return due
+}
+
 // tick processes all monitors that are due for polling
 func (s *SchedulerImpl) tick(ctx context.Context) {
-	now := time.Now()
-	nextTick := now.Add(s.config.TickInterval())
-
 	// Step 1: Dequeue all due monitors
-	dueMonitors := s.dequeueDueMonitors(nextTick)
+	dueMonitors := s.dueMonitors(s.clock())
 
 	if len(dueMonitors) == 0 {
 		return
@@ -241,6 +569,24 @@ func (s *SchedulerImpl) tick(ctx context.Context) {
 	s.processMonitors(ctx, dueMonitors)
 }
 
+// clock returns the current time for deadline math. Readings from time.Now carry the
+// monotonic clock, which NTP corrections do not step, and deadlines derived from them
+// with Add and compared with Before/After keep it. Deadlines must not go through
+// Round(0), UTC, In or the database, which strip it.
+func (s *SchedulerImpl) clock() time.Time {
+	if s.now != nil {
+		return s.now()
+	}
+	return time.Now()
+}
+
+// dueMonitors dequeues every monitor due before the tick after now. Deadlines carry the
+// monotonic clock (see clock), which wall-clock steps do not move, so they need no
+// correction; monitors left overdue by a stall are caught up by rescheduleUnlocked.
+func (s *SchedulerImpl) dueMonitors(now time.Time) []*ScheduledMonitor {
+	return s.dequeueDueMonitors(now.Add(s.config.TickInterval()))
+}
+
 // dequeueDueMonitors removes all monitors due before nextTick from the heap,
 // reschedules them for the future, and returns the list of monitors to process.
 func (s *SchedulerImpl) dequeueDueMonitors(nextTick time.Time) []*ScheduledMonitor {
@@ -256,10 +602,10 @@ func (s *SchedulerImpl) dequeueDueMonitors(nextTick time.Time) []*ScheduledMonit
 		}
 		heap.Pop(&s.heap)
 
-		// Lookup in map - if missing, skip (deleted/down monitor)
+		// Lookup in map - if missing, skip (deleted/down/paused monitor)
 		sm, exists := s.monitors[heapItem.MonitorID]
-		if !exists {
-			// Stale entry - monitor was deleted or marked down
+		if !exists || sm.heapItem != heapItem {
+			// Stale entry - monitor was deleted, marked down or paused (and possibly re-added)
 			continue
 		}
 
@@ -300,33 +646,203 @@ func (s *SchedulerImpl) processMonitors(ctx context.Context, monitors []*Schedul
 		pluginBatches[sm.Monitor.PluginID] = append(pluginBatches[sm.Monitor.PluginID], sm)
 	}
 
-	// Dispatch batches
+	// Dispatch batches, each once it holds a poll slot per monitor
 	for pluginID, batch := range pluginBatches {
 		pluginID := pluginID
 		batch := batch
-		s.wg.Add(1)
-		go func() {
-			defer s.wg.Done()
+		slots, err := s.acquirePolls(ctx, len(batch))
+		if err != nil {
+			s.logger.Warn("dispatch cancelled while waiting for poll slots", "plugin_id", pluginID, "monitors", len(batch), "error", err)
+			s.clearPolling(batch)
+			continue
+		}
+		s.goBatch(pluginID, len(batch), func() {
+			defer s.releasePolls(len(batch), slots)
 			s.processPluginBatch(ctx, pluginID, batch)
-		}()
+		})
+	}
+}
+
+// newPollSlots creates the global poll slot semaphore, nil when limit is 0 (unlimited)
+func newPollSlots(limit int) chan struct{} {
+	if limit <= 0 {
+		return nil
 	}
+	return make(chan struct{}, limit)
 }
 
-// checkLiveness performs a TCP SYN probe to verify the monitor is reachable
+// errSchedulerStopping ends a wait for poll slots when the scheduler is stopped
+var errSchedulerStopping = errors.New("scheduler stopping")
+
+// acquirePolls counts n polls as in flight, first taking a slot for each when a cap is
+// set. A batch larger than the cap takes every slot. Only the tick loop acquires, so
+// partial acquisitions cannot deadlock each other. The wait ends, giving back the slots
+// taken, when ctx is done or the scheduler is stopped, so a full cap cannot hold the tick
+// loop past shutdown. It returns how many slots were taken.
+func (s *SchedulerImpl) acquirePolls(ctx context.Context, n int) (int, error) {
+	slots := 0
+	if s.pollSlots != nil {
+		slots = min(n, cap(s.pollSlots))
+		if len(s.pollSlots)+slots > cap(s.pollSlots) {
+			s.logger.Warn("max in-flight polls reached, delaying dispatch",
+				"in_flight", s.inFlightPolls.Load(),
+				"max_in_flight", cap(s.pollSlots),
+			)
+		}
+		for i := 0; i < slots; i++ {
+			var err error
+			select {
+			case s.pollSlots <- struct{}{}:
+				continue
+			case <-ctx.Done():
+				err = ctx.Err()
+			case <-s.done:
+				err = errSchedulerStopping
+			}
+			for ; i > 0; i-- {
+				<-s.pollSlots
+			}
+			return 0, err
+		}
+	}
+	s.inFlightPolls.Add(int64(n))
+	return slots, nil
+}
+
+// releasePolls undoes acquirePolls once a batch of n polls has finished
+func (s *SchedulerImpl) releasePolls(n, slots int) {
+	s.inFlightPolls.Add(-int64(n))
+	for range slots {
+		<-s.pollSlots
+	}
+}
+
+// InFlightPolls returns how many monitors are being polled right now
+func (s *SchedulerImpl) InFlightPolls() int64 {
+	return s.inFlightPolls.Load()
+}
+
+// MaxInFlightPolls returns the global in-flight poll cap, 0 when unlimited
+func (s *SchedulerImpl) MaxInFlightPolls() int {
+	return cap(s.pollSlots)
+}
+
+// clearPolling releases monitors that were picked for a poll that never started; they
+// were already rescheduled when dequeued
+func (s *SchedulerImpl) clearPolling(monitors []*ScheduledMonitor) {
+	s.heapMu.Lock()
+	defer s.heapMu.Unlock()
+	for _, sm := range monitors {
+		sm.IsPolling = false
+	}
+}
+
+// goBatch runs fn on a worker goroutine, tracked by wg and the in-flight set
+func (s *SchedulerImpl) goBatch(pluginID string, monitors int, fn func()) {
+	s.inFlightMu.Lock()
+	if s.inFlight == nil {
+		s.inFlight = make(map[uint64]inFlightBatch)
+	}
+	s.nextBatchID++
+	id := s.nextBatchID
+	s.inFlight[id] = inFlightBatch{PluginID: pluginID, Monitors: monitors, Started: time.Now()}
+	s.inFlightMu.Unlock()
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		defer func() {
+			s.inFlightMu.Lock()
+			delete(s.inFlight, id)
+			s.inFlightMu.Unlock()
+		}()
+		fn()
+	}()
+}
+
+// checkLiveness verifies the monitor is reachable using its configured liveness method
 func (s *SchedulerImpl) checkLiveness(ctx context.Context, sm *ScheduledMonitor) bool {
-	// Get port value, default to 0 if null
-	port := int32(0)
-	if sm.Monitor.Port.Valid {
-		port = sm.Monitor.Port.Int32
+	switch sm.LivenessMethod {
+	case LivenessNone:
+		return true
+	case LivenessICMP:
+		return s.checkLivenessICMP(ctx, sm)
+	default:
+		return s.checkLivenessTCP(ctx, sm)
+	}
+}
+
+// checkLivenessICMP sends an ICMP echo to the monitor. If the process lacks the
+// privileges to open an ICMP socket, liveness is skipped (logged once).
+func (s *SchedulerImpl) checkLivenessICMP(ctx context.Context, sm *ScheduledMonitor) bool {
+	livenessCtx, cancel := context.WithTimeout(ctx, s.config.LivenessTimeout())
+	defer cancel()
+
+	alive, err := pingICMP(livenessCtx, sm.Monitor.IpAddress, s.config.LivenessSource())
+	if errors.Is(err, errICMPUnavailable) {
+		s.icmpUnavailableOnce.Do(func() {
+			s.logger.Warn("icmp liveness unavailable, skipping liveness for icmp monitors",
+				"error", err,
+			)
+		})
+		return true
+	}
+	if err != nil || !alive {
+		s.logger.Debug("liveness check failed",
+			"monitor_id", sm.Monitor.ID,
+			"method", LivenessICMP,
+			"target", sm.Monitor.IpAddress.String(),
+			"error", err,
+		)
+		return false
 	}
+	return true
+}
 
-	target := fmt.Sprintf("%s:%d", sm.Monitor.IpAddress.String(), port)
+// monitorPort returns the monitor's port, falling back to its plugin's default when unset.
+// tls reports whether the monitor's credentials select a TLS transport.
+func (s *SchedulerImpl) monitorPort(sm *ScheduledMonitor, tls bool) int {
+	if sm.Monitor.Port.Valid && sm.Monitor.Port.Int32 > 0 {
+		return int(sm.Monitor.Port.Int32)
+	}
+	return s.pluginManager.DefaultPort(sm.Monitor.PluginID, tls)
+}
+
+// usesTLS reports whether sm's credentials select a TLS transport (WinRM use_https), which
+// moves its default port. Monitors with an explicit port never need to know. The flag is
+// read from UseTLS; until a poll has cached it the payload is decrypted just for the flag
+// and wiped straight away, so liveness probes and config lookups never keep plaintext
+// resident or refresh CredentialsLastUsed. Credentials that cannot be decrypted count as plain.
+func (s *SchedulerImpl) usesTLS(sm *ScheduledMonitor) bool {
+	s.heapMu.Lock()
+	defer s.heapMu.Unlock()
+
+	if sm.Monitor.Port.Valid && sm.Monitor.Port.Int32 > 0 {
+		return false
+	}
+	if sm.UseTLS == nil {
+		if len(sm.EncryptedCredentials) == 0 {
+			return false
+		}
+		decrypted, err := s.credService.DecryptContainer(sm.EncryptedCredentials)
+		if err != nil {
+			return false
+		}
+		useTLS := decrypted.UseHTTPS
+		*decrypted = auth.Credentials{}
+		sm.UseTLS = &useTLS
+	}
+	return *sm.UseTLS
+}
+
+// checkLivenessTCP performs a TCP SYN probe to verify the monitor is reachable
+func (s *SchedulerImpl) checkLivenessTCP(ctx context.Context, sm *ScheduledMonitor) bool {
+	target := fmt.Sprintf("%s:%d", sm.Monitor.IpAddress.String(), s.monitorPort(sm, s.usesTLS(sm)))
 
 	livenessCtx, cancel := context.WithTimeout(ctx, s.config.LivenessTimeout())
 	defer cancel()
 
-	dialer := &net.Dialer{}
-	conn, err := dialer.DialContext(livenessCtx, "tcp", target)
+	conn, err := newLivenessDialer(s.config, sm.Monitor.IpAddress).DialContext(livenessCtx, "tcp", target)
 	if err != nil {
 		s.logger.Debug("liveness check failed",
 			"monitor_id", sm.Monitor.ID,
@@ -341,7 +857,8 @@ func (s *SchedulerImpl) checkLiveness(ctx context.Context, sm *ScheduledMonitor)
 }
 
 // processPluginBatch processes a batch of monitors for the same plugin.
-// It performs liveness checks in parallel, then calls the plugin once with all tasks.
+// It performs liveness checks in parallel, then calls the plugin once with all tasks, or
+// the protocol's internal collector per monitor when no plugin binary is loaded.
 // This is the only path for monitor polling - single monitors are just batches of 1.
 func (s *SchedulerImpl) processPluginBatch(ctx context.Context, pluginID string, monitors []*ScheduledMonitor) {
 	logger := s.logger.With("plugin_id", pluginID, "batch_size", len(monitors))
@@ -351,8 +868,9 @@ func (s *SchedulerImpl) processPluginBatch(ctx context.Context, pluginID string,
 	// Note: The user said "plugins are one to one mapped to the protocol".
 	// The DB column is still 'plugin_id'. We assume here that for the scheduler grouping,
 	// checking existence via Get(pluginID) is correct if pluginID == protocol.
-	_, ok := s.pluginManager.Get(pluginID)
-	if !ok {
+	_, external := s.pluginManager.Get(pluginID)
+	collector := s.collectors[pluginID]
+	if !external && collector == nil {
 		logger.Error("plugin not found")
 		for _, sm := range monitors {
 			s.handleFailure(sm, fmt.Sprintf("plugin not found: %s", pluginID))
@@ -360,42 +878,17 @@ func (s *SchedulerImpl) processPluginBatch(ctx context.Context, pluginID string,
 		return
 	}
 
-	// Phase 1: Parallel liveness checks
-	type livenessResult struct {
-		sm    *ScheduledMonitor
-		alive bool
-	}
-	resultsChan := make(chan livenessResult, len(monitors))
-
-	var livenessWg sync.WaitGroup
-	for _, sm := range monitors {
-		sm := sm
-		livenessWg.Add(1)
-		go func() {
-			defer livenessWg.Done()
-
-			// Acquire liveness semaphore
-			select {
-			case s.livenessSem <- struct{}{}:
-				defer func() { <-s.livenessSem }()
-			case <-ctx.Done():
-				resultsChan <- livenessResult{sm: sm, alive: false}
-				// We rely on results loop to handle failure, but resultsChan read might be interrupted if we return early?
-				// Wait, if ctx is done, resultChan send might block if buffer full?
-				// Buffer size is len(monitors). Safe.
-				return
-			}
-
-			alive := s.checkLiveness(ctx, sm)
-			resultsChan <- livenessResult{sm: sm, alive: alive}
-		}()
+	// Phase 1: Parallel liveness checks, on the shared pool when batched liveness is on
+	var liveness []livenessResult
+	if s.livenessPool != nil {
+		liveness = s.livenessPool.check(ctx, monitors)
+	} else {
+		liveness = checkLivenessEach(ctx, s.livenessSem, monitors, s.checkLiveness)
 	}
-	livenessWg.Wait()
-	close(resultsChan)
 
 	// Collect live monitors
 	var liveMonitors []*ScheduledMonitor
-	for result := range resultsChan {
+	for _, result := range liveness {
 		if result.alive {
 			liveMonitors = append(liveMonitors, result.sm)
 		} else {
@@ -423,30 +916,31 @@ func (s *SchedulerImpl) processPluginBatch(ctx context.Context, pluginID string,
 		return
 	}
 
+	// Protocols without a plugin binary are polled in-process
+	if !external {
+		s.collectBatch(ctx, logger, collector, liveMonitors)
+		return
+	}
+
 	// Phase 2: Build batch of poll tasks
 	tasks := make([]globals.PollTask, 0, len(liveMonitors))
 	monitorByRequestID := make(map[string]*ScheduledMonitor, len(liveMonitors))
 
 	for _, sm := range liveMonitors {
-		// Lazy load credentials
+		// Lazy load credentials (a copy, so a concurrent eviction cannot wipe it mid-poll)
 		cred, err := s.ensureCredentials(sm)
 		if err != nil {
 			s.handleFailure(sm, fmt.Sprintf("credential error: %v", err))
 			continue
 		}
 
-		// Get port value
-		port := 0
-		if sm.Monitor.Port.Valid {
-			port = int(sm.Monitor.Port.Int32)
-		}
-
 		requestID := uuid.New().String()
 		tasks = append(tasks, globals.PollTask{
 			RequestID:   requestID,
 			Target:      sm.Monitor.IpAddress.String(),
-			Port:        port,
-			Credentials: *cred,
+			Port:        s.monitorPort(sm, cred.UseHTTPS),
+			Credentials: cred,
+			Collectors:  sm.Monitor.Collectors,
 		})
 		monitorByRequestID[requestID] = sm
 	}
@@ -473,13 +967,33 @@ func (s *SchedulerImpl) processPluginBatch(ctx context.Context, pluginID string,
 	}
 
 	// Phase 4: Handle individual results
-	handledRequests := make(map[string]bool)
+	s.handleBatchResults(ctx, logger, monitorByRequestID, results)
+
+	logger.Debug("plugin batch complete", "result_count", len(results))
+}
+
+// handleBatchResults applies a plugin's results to the monitors they answer. Each task is
+// settled exactly once: the first result for a RequestID wins, later duplicates and results
+// for unknown RequestIDs are ignored, so a buggy plugin can neither write a monitor's
+// metrics twice nor return more results than tasks it was sent. Tasks with no result fail.
+func (s *SchedulerImpl) handleBatchResults(ctx context.Context, logger *slog.Logger, monitorByRequestID map[string]*ScheduledMonitor, results []globals.PollResult) {
+	handledRequests := make(map[string]bool, len(monitorByRequestID))
+	duplicates, unknown := 0, 0
 	for _, result := range results {
 		sm, ok := monitorByRequestID[result.RequestID]
 		if !ok {
+			unknown++
 			logger.Warn("received result for unknown request", "request_id", result.RequestID)
 			continue
 		}
+		if handledRequests[result.RequestID] {
+			duplicates++
+			logger.Warn("ignoring duplicate result for request",
+				"request_id", result.RequestID,
+				"monitor_id", sm.Monitor.ID,
+			)
+			continue
+		}
 
 		handledRequests[result.RequestID] = true
 
@@ -490,57 +1004,86 @@ func (s *SchedulerImpl) processPluginBatch(ctx context.Context, pluginID string,
 		}
 	}
 
+	if duplicates > 0 || unknown > 0 {
+		logger.Warn("plugin returned unexpected results",
+			"tasks", len(monitorByRequestID),
+			"results", len(results),
+			"duplicates", duplicates,
+			"unknown", unknown,
+		)
+	}
+
 	// Fail any tasks that got no result
 	for reqID, sm := range monitorByRequestID {
 		if !handledRequests[reqID] {
 			s.handleFailure(sm, "plugin execution returned no result")
 		}
 	}
-
-	logger.Debug("plugin batch complete", "result_count", len(results))
 }
 
-// ensureCredentials lazily loads and caches credentials for a monitor.
+// ensureCredentials lazily loads and caches credentials for a monitor and returns a copy.
+// Credentials evicted by evictIdleCredentials are simply decrypted again.
 // Caller should NOT hold heapMu - this function manages its own locking.
-func (s *SchedulerImpl) ensureCredentials(sm *ScheduledMonitor) (*auth.Credentials, error) {
+func (s *SchedulerImpl) ensureCredentials(sm *ScheduledMonitor) (auth.Credentials, error) {
 	s.heapMu.Lock()
-	cred := sm.Credentials
-	if cred != nil {
-		s.heapMu.Unlock()
-		return cred, nil
-	}
+	defer s.heapMu.Unlock()
 
-	if len(sm.EncryptedCredentials) == 0 {
-		s.heapMu.Unlock()
-		return nil, fmt.Errorf("missing encrypted credentials")
-	}
+	if sm.Credentials == nil {
+		if len(sm.EncryptedCredentials) == 0 {
+			return auth.Credentials{}, fmt.Errorf("missing encrypted credentials")
+		}
 
-	// Decrypt locally without DB call
-	decrypted, err := s.credService.DecryptContainer(sm.EncryptedCredentials)
-	if err != nil {
-		s.heapMu.Unlock()
-		return nil, fmt.Errorf("decryption error: %w", err)
+		// Decrypt locally without DB call
+		decrypted, err := s.credService.DecryptContainer(sm.EncryptedCredentials)
+		if err != nil {
+			return auth.Credentials{}, fmt.Errorf("decryption error: %w", err)
+		}
+		sm.Credentials = decrypted
+		useTLS := decrypted.UseHTTPS
+		sm.UseTLS = &useTLS
 	}
-	sm.Credentials = decrypted
-	s.heapMu.Unlock()
 
-	return decrypted, nil
+	sm.CredentialsLastUsed = time.Now()
+	return *sm.Credentials, nil
+}
+
+// evictIdleCredentials wipes decrypted credentials not used since cutoff.
+// Returns the number of monitors whose credentials were evicted.
+func (s *SchedulerImpl) evictIdleCredentials(cutoff time.Time) int {
+	s.heapMu.Lock()
+	defer s.heapMu.Unlock()
+
+	evicted := 0
+	for _, sm := range s.monitors {
+		if sm.Credentials != nil && sm.CredentialsLastUsed.Before(cutoff) {
+			sm.clearCredentials()
+			evicted++
+		}
+	}
+	return evicted
 }
 
 // handleSuccess processes a successful poll result
 func (s *SchedulerImpl) handleSuccess(ctx context.Context, sm *ScheduledMonitor, results []globals.PollResult) {
 	s.heapMu.Lock()
-	wasDown := sm.ConsecutiveFailures >= s.config.DownThreshold
+	// A monitor paused or deleted mid-poll keeps its results but gets no state transitions
+	current, tracked := s.monitors[sm.Monitor.ID]
+	tracked = tracked && current == sm
+	wasDown := tracked && sm.ConsecutiveFailures >= s.config.DownThreshold
 	sm.ConsecutiveFailures = 0
 	sm.IsPolling = false
+	tags := sm.Tags
+	staleChanged, lastMetricAt := s.trackStalenessUnlocked(sm, tracked, wasDown, countMetrics(results))
 	s.heapMu.Unlock()
 
 	// Write results using result writer
-	s.resultWriter.Write(ctx, sm.Monitor.ID, results)
+	writeErr := s.resultWriter.Write(ctx, sm.Monitor.ID, tags, results)
+	s.recordWriteResult(sm, tracked, writeErr)
 
 	s.logger.Info("monitor poll succeeded",
 		"monitor_id", sm.Monitor.ID,
 		"result_count", len(results),
+		"persisted", writeErr == nil,
 	)
 
 	// Handle recovery if monitor was down
@@ -549,14 +1092,15 @@ func (s *SchedulerImpl) handleSuccess(ctx context.Context, sm *ScheduledMonitor,
 		s.updateMonitorStatus(context.Background(), sm.Monitor.ID, "active")
 
 		// Emit recovery event for external consumers
-		select {
-		case s.events.MonitorState <- globals.MonitorStateEvent{
+		event := globals.MonitorStateEvent{
 			MonitorID: sm.Monitor.ID,
 			IP:        sm.Monitor.IpAddress.String(),
 			EventType: "recovered",
 			Failures:  0,
 			Timestamp: time.Now(),
-		}:
+		}
+		select {
+		case s.events.MonitorState <- event:
 			s.logger.Info("monitor recovered",
 				"monitor_id", sm.Monitor.ID,
 				"ip_address", sm.Monitor.IpAddress.String(),
@@ -565,10 +1109,151 @@ func (s *SchedulerImpl) handleSuccess(ctx context.Context, sm *ScheduledMonitor,
 			s.logger.Warn("failed to emit monitor recovered event: channel full",
 				"monitor_id", sm.Monitor.ID,
 			)
+			s.events.RecordDropped(globals.ChannelMonitorState, globals.DropChannelFull, event)
+		}
+	}
+
+	if staleChanged {
+		s.reportStaleness(sm, lastMetricAt)
+	}
+}
+
+// countMetrics returns how many metrics a poll returned across its results
+func countMetrics(results []globals.PollResult) int {
+	n := 0
+	for _, result := range results {
+		n += len(result.Metrics)
+	}
+	return n
+}
+
+// trackStalenessUnlocked updates a successful poll's staleness: a monitor whose liveness
+// passes but whose polls return no metrics for StaleAfter polling intervals turns stale,
+// and the first poll with metrics clears it. A recovery restarts the clock, since polls
+// failing liveness are not expected to return data. Reports whether Stale changed and
+// when metrics last arrived. Caller must hold heapMu lock.
+func (s *SchedulerImpl) trackStalenessUnlocked(sm *ScheduledMonitor, tracked, wasDown bool, metrics int) (bool, time.Time) {
+	now := time.Now()
+	lastMetricAt := sm.LastMetricAt
+	if metrics > 0 || wasDown {
+		sm.LastMetricAt = now
+	}
+	if !tracked {
+		return false, lastMetricAt
+	}
+
+	staleAfter := s.config.StaleAfter()
+	switch {
+	case sm.Stale && metrics > 0:
+		sm.Stale = false
+		return true, lastMetricAt
+	case !sm.Stale && staleAfter > 0 && metrics == 0 &&
+		now.Sub(sm.LastMetricAt) >= time.Duration(staleAfter)*s.pollInterval(sm):
+		sm.Stale = true
+		return true, lastMetricAt
+	}
+	return false, lastMetricAt
+}
+
+// reportStaleness records a staleness change: "stale" when the monitor stopped producing
+// data, "fresh" when metrics arrive again. The status reflects it ("stale" or "active").
+func (s *SchedulerImpl) reportStaleness(sm *ScheduledMonitor, lastMetricAt time.Time) {
+	s.heapMu.Lock()
+	stale := sm.Stale
+	s.heapMu.Unlock()
+
+	status, eventType := "active", "fresh"
+	if stale {
+		status, eventType = "stale", "stale"
+	}
+	s.updateMonitorStatus(context.Background(), sm.Monitor.ID, status)
+
+	event := globals.MonitorStateEvent{
+		MonitorID: sm.Monitor.ID,
+		IP:        sm.Monitor.IpAddress.String(),
+		EventType: eventType,
+		Timestamp: time.Now(),
+	}
+	select {
+	case s.events.MonitorState <- event:
+		if stale {
+			s.logger.Warn("monitor is stale: polls succeed but return no metrics",
+				"monitor_id", sm.Monitor.ID,
+				"last_metric_at", lastMetricAt,
+			)
+		} else {
+			s.logger.Info("monitor metrics resumed",
+				"monitor_id", sm.Monitor.ID,
+				"stale_since", lastMetricAt,
+			)
+		}
+	default:
+		s.logger.Warn("failed to emit monitor "+eventType+" event: channel full",
+			"monitor_id", sm.Monitor.ID,
+		)
+		s.events.RecordDropped(globals.ChannelMonitorState, globals.DropChannelFull, event)
+	}
+}
+
+// recordWriteResult tracks metrics that were polled but not persisted. The poll itself
+// still counts as a success; after DownThreshold failed writes in a row the monitor is
+// reported as "degraded" once, until a write succeeds again.
+func (s *SchedulerImpl) recordWriteResult(sm *ScheduledMonitor, tracked bool, err error) {
+	if err != nil {
+		s.writeFailures.Add(1)
+	}
+
+	s.heapMu.Lock()
+	prev := sm.ConsecutiveWriteFailures
+	if err != nil {
+		sm.ConsecutiveWriteFailures++
+	} else {
+		sm.ConsecutiveWriteFailures = 0
+	}
+	failures := sm.ConsecutiveWriteFailures
+	s.heapMu.Unlock()
+
+	if err == nil {
+		if prev >= s.config.DownThreshold {
+			s.logger.Info("monitor metrics persisting again",
+				"monitor_id", sm.Monitor.ID,
+				"failed_writes", prev,
+			)
 		}
+		return
+	}
+
+	s.logger.Error("monitor poll succeeded but metrics were not persisted",
+		"monitor_id", sm.Monitor.ID,
+		"consecutive_write_failures", failures,
+		"error", err,
+	)
+
+	if !tracked || failures != s.config.DownThreshold {
+		return
+	}
+	event := globals.MonitorStateEvent{
+		MonitorID: sm.Monitor.ID,
+		IP:        sm.Monitor.IpAddress.String(),
+		EventType: "degraded",
+		Failures:  failures,
+		Timestamp: time.Now(),
+	}
+	select {
+	case s.events.MonitorState <- event:
+	default:
+		s.logger.Warn("failed to emit monitor degraded event: channel full",
+			"monitor_id", sm.Monitor.ID,
+		)
+		s.events.RecordDropped(globals.ChannelMonitorState, globals.DropChannelFull, event)
 	}
 }
 
+// WriteFailures returns how many successful polls had metrics that were not persisted
+func (s *SchedulerImpl) WriteFailures() int64 {
+	return s.writeFailures.Load()
+}
+
 // handleFailure processes a failed poll attempt
 func (s *SchedulerImpl) handleFailure(sm *ScheduledMonitor, reason string) {
 	s.heapMu.Lock()
@@ -582,6 +1267,10 @@ func (s *SchedulerImpl) handleFailure(sm *ScheduledMonitor, reason string) {
 	wasUp := sm.ConsecutiveFailures < s.config.DownThreshold
 	sm.ConsecutiveFailures++
 	sm.IsPolling = false
+	if wasUp && sm.ConsecutiveFailures >= s.config.DownThreshold {
+		// "down" replaces "stale"; a recovery starts over as "active"
+		sm.Stale = false
+	}
 
 	s.logger.Warn("monitor poll failed",
 		"monitor_id", sm.Monitor.ID,
@@ -591,8 +1280,11 @@ func (s *SchedulerImpl) handleFailure(sm *ScheduledMonitor, reason string) {
 
 	// Check if threshold reached
 	if wasUp && sm.ConsecutiveFailures >= s.config.DownThreshold {
-		// Stop tracking (stops future polling)
-		delete(s.monitors, sm.Monitor.ID)
+		// Stop tracking (stops future polling), unless the monitor observes through outages;
+		// it then stays queued and recovers on its next successful poll
+		if !sm.Monitor.KeepPollingWhenDown {
+			s.untrackUnlocked(sm)
+		}
 
 		s.heapMu.Unlock()
 
@@ -600,14 +1292,15 @@ func (s *SchedulerImpl) handleFailure(sm *ScheduledMonitor, reason string) {
 		s.updateMonitorStatus(context.Background(), sm.Monitor.ID, "down")
 
 		// Emit event for external consumers
-		select {
-		case s.events.MonitorState <- globals.MonitorStateEvent{
+		event := globals.MonitorStateEvent{
 			MonitorID: sm.Monitor.ID,
 			IP:        sm.Monitor.IpAddress.String(),
 			EventType: "down",
 			Failures:  sm.ConsecutiveFailures,
 			Timestamp: time.Now(),
-		}:
+		}
+		select {
+		case s.events.MonitorState <- event:
 			s.logger.Warn("monitor is down",
 				"monitor_id", sm.Monitor.ID,
 				"ip_address", sm.Monitor.IpAddress.String(),
@@ -617,29 +1310,70 @@ func (s *SchedulerImpl) handleFailure(sm *ScheduledMonitor, reason string) {
 			s.logger.Warn("failed to emit monitor down event: channel full",
 				"monitor_id", sm.Monitor.ID,
 			)
+			s.events.RecordDropped(globals.ChannelMonitorState, globals.DropChannelFull, event)
 		}
 	} else {
 		s.heapMu.Unlock()
 	}
 }
 
-// rescheduleUnlocked computes the next poll deadline and adds monitor back to heap.
+// restoreStateUnlocked starts a newly tracked monitor in its stored state. One already
+// down starts at the down threshold, so its next failure emits no second "down" and a
+// success recovers it; one already stale emits no second "stale" and recovers with data.
 // Caller must hold heapMu lock.
-func (s *SchedulerImpl) rescheduleUnlocked(sm *ScheduledMonitor) {
-	// Get polling interval, default to 60 seconds if null
-	intervalSeconds := int32(60)
-	if sm.Monitor.PollingIntervalSeconds.Valid {
-		intervalSeconds = sm.Monitor.PollingIntervalSeconds.Int32
+func (s *SchedulerImpl) restoreStateUnlocked(sm *ScheduledMonitor) {
+	sm.LastMetricAt = time.Now()
+	switch sm.Monitor.Status.String {
+	case "down":
+		sm.ConsecutiveFailures = s.config.DownThreshold
+	case "stale":
+		sm.Stale = true
 	}
+}
 
-	interval := time.Duration(intervalSeconds) * time.Second
-	sm.NextPollDeadline = sm.NextPollDeadline.Add(interval)
+// untrackUnlocked drops a monitor from the cache, removes its heap entry and wipes its
+// credentials, so removed monitors leave nothing behind in the queue.
+// Caller must hold heapMu lock.
+func (s *SchedulerImpl) untrackUnlocked(sm *ScheduledMonitor) {
+	if current, ok := s.monitors[sm.Monitor.ID]; ok && current == sm {
+		delete(s.monitors, sm.Monitor.ID)
+	}
+	if item := sm.heapItem; item != nil && item.Index >= 0 && item.Index < len(s.heap) && s.heap[item.Index] == item {
+		heap.Remove(&s.heap, item.Index)
+	}
+	sm.clearCredentials()
+}
 
-	// Push HeapItem (ID + deadline) to heap
-	heap.Push(&s.heap, &HeapItem{
-		MonitorID:        sm.Monitor.ID,
-		NextPollDeadline: sm.NextPollDeadline,
-	})
+// pollInterval returns the monitor's polling interval, see resolvePollInterval
+func (s *SchedulerImpl) pollInterval(sm *ScheduledMonitor) time.Duration {
+	interval, _ := s.resolvePollInterval(sm.Monitor)
+	return interval
+}
+
+// initialDeadline returns when a newly added monitor first polls under the configured
+// scheduler.initial_poll_delay policy. Later deadlines follow from this one.
+func (s *SchedulerImpl) initialDeadline(sm *ScheduledMonitor, now time.Time) time.Time {
+	switch s.config.InitialPollDelay {
+	case "fixed":
+		return now.Add(time.Duration(s.config.InitialPollDelaySeconds) * time.Second)
+	case "spread":
+		return now.Add(rand.N(s.pollInterval(sm)))
+	default:
+		return now
+	}
+}
+
+// rescheduleUnlocked computes the next poll deadline and adds monitor back to heap.
+// Caller must hold heapMu lock.
+func (s *SchedulerImpl) rescheduleUnlocked(sm *ScheduledMonitor) {
+	interval := s.pollInterval(sm)
+	next := sm.NextPollDeadline.Add(interval)
+	// A monitor a whole interval behind (the scheduler stalled, or the clock jumped
+	// forward) skips the polls it missed instead of polling every tick to catch up
+	if now := s.clock(); next.Before(now) {
+		next = now.Add(interval)
+	}
+	s.scheduleUnlocked(sm, next)
 
 	s.logger.Debug("monitor rescheduled",
 		"monitor_id", sm.Monitor.ID,
@@ -650,80 +1384,177 @@ func (s *SchedulerImpl) rescheduleUnlocked(sm *ScheduledMonitor) {
 
 // updateMonitorCacheFromRow updates a monitor in the cache from a pushed DB row
 func (s *SchedulerImpl) updateMonitorCacheFromRow(row dbgen.GetMonitorWithCredentialsRow) {
+	u := s.prepareMonitorUpdate(row)
 	s.heapMu.Lock()
 	defer s.heapMu.Unlock()
+	s.updateMonitorCacheUnlocked(u)
+}
+
+// monitorUpdate is a pushed monitor row with what the cache derives from it, worked out
+// by prepareMonitorUpdate without holding heapMu
+type monitorUpdate struct {
+	row      dbgen.GetMonitorWithCredentialsRow
+	monitor  dbgen.Monitor
+	tags     map[string]string
+	liveness string
+}
 
+// prepareMonitorUpdate converts a pushed row for updateMonitorCacheUnlocked
+func (s *SchedulerImpl) prepareMonitorUpdate(row dbgen.GetMonitorWithCredentialsRow) monitorUpdate {
+	return monitorUpdate{
+		row: row,
+		monitor: dbgen.Monitor{
+			ID:                     row.ID,
+			DisplayName:            row.DisplayName,
+			Hostname:               row.Hostname,
+			IpAddress:              row.IpAddress,
+			PluginID:               row.PluginID,
+			CredentialProfileID:    row.CredentialProfileID,
+			DiscoveryProfileID:     row.DiscoveryProfileID,
+			Port:                   row.Port,
+			PollingIntervalSeconds: row.PollingIntervalSeconds,
+			Status:                 row.Status,
+			CreatedAt:              row.CreatedAt,
+			UpdatedAt:              row.UpdatedAt,
+			Collectors:             row.Collectors,
+			KeepPollingWhenDown:    row.KeepPollingWhenDown,
+			Tags:                   row.Tags,
+		},
+		tags:     s.parseMonitorTags(row.ID, row.Tags),
+		liveness: resolveLivenessMethod(s.config, row.PluginID),
+	}
+}
+
+// updateMonitorCacheUnlocked applies a prepared row to the cache. Caller must hold heapMu lock.
+func (s *SchedulerImpl) updateMonitorCacheUnlocked(u monitorUpdate) {
+	row := u.row
 	// Check status
-	if row.Status.String != "active" {
-		if _, exists := s.monitors[row.ID]; exists {
-			delete(s.monitors, row.ID)
+	switch row.Status.String {
+	case "active", "stale":
+	case "down":
+		if !row.KeepPollingWhenDown {
+			if sm, exists := s.monitors[row.ID]; exists {
+				s.untrackUnlocked(sm)
+				s.logger.Info("removed inactive monitor from scheduler cache", "monitor_id", row.ID)
+			}
+			return
+		}
+	case "paused":
+		// Paused is operator intent, not a failure: drop from the schedule without
+		// touching failure counters or emitting state events. Resuming (status back
+		// to "active") re-adds it below with fresh state, so no "recovered" event fires.
+		if sm, exists := s.monitors[row.ID]; exists {
+			s.untrackUnlocked(sm)
+			s.logger.Info("paused monitor removed from scheduler cache", "monitor_id", row.ID)
+		}
+		return
+	default:
+		if sm, exists := s.monitors[row.ID]; exists {
+			s.untrackUnlocked(sm)
 			s.logger.Info("removed inactive monitor from scheduler cache", "monitor_id", row.ID)
 		}
 		return
 	}
 
-	// Reconstruct object
-	monitor := dbgen.Monitor{
-		ID:                     row.ID,
-		DisplayName:            row.DisplayName,
-		Hostname:               row.Hostname,
-		IpAddress:              row.IpAddress,
-		PluginID:               row.PluginID,
-		CredentialProfileID:    row.CredentialProfileID,
-		DiscoveryProfileID:     row.DiscoveryProfileID,
-		Port:                   row.Port,
-		PollingIntervalSeconds: row.PollingIntervalSeconds,
-		Status:                 row.Status,
-		CreatedAt:              row.CreatedAt,
-		UpdatedAt:              row.UpdatedAt,
-	}
-
 	// Update or Create
 	sm, exists := s.monitors[row.ID]
 	if !exists {
-		now := time.Now()
-		sm = &ScheduledMonitor{
-			NextPollDeadline: now, // Schedule immediately
-		}
+		sm = &ScheduledMonitor{}
 		s.monitors[row.ID] = sm
-		heap.Push(&s.heap, &HeapItem{
-			MonitorID:        row.ID,
-			NextPollDeadline: now,
-		})
 	}
 
+	monitor := u.monitor
 	sm.Monitor = &monitor
-	sm.EncryptedCredentials = row.Payload
-	sm.Credentials = nil // Force re-decryption
+	if !exists {
+		s.restoreStateUnlocked(sm)
+		s.scheduleUnlocked(sm, s.initialDeadline(sm, s.clock()))
+	}
+	sm.LivenessMethod = u.liveness
+	sm.Tags = u.tags
+	sm.replaceCredentials(row.Payload) // Force re-decryption
 
 	s.logger.Info("updated monitor in scheduler cache", "monitor_id", row.ID)
 }
 
+// parseMonitorTags decodes a monitor's tags column. Tags are validated by the API, so a
+// malformed value is logged and the monitor polls without tags rather than not at all.
+func (s *SchedulerImpl) parseMonitorTags(monitorID int64, raw json.RawMessage) map[string]string {
+	if len(raw) == 0 {
+		return nil
+	}
+	var tags map[string]string
+	if err := json.Unmarshal(raw, &tags); err != nil {
+		s.logger.Warn("ignoring invalid monitor tags", "monitor_id", monitorID, "error", err)
+		return nil
+	}
+	if len(tags) == 0 {
+		return nil
+	}
+	return tags
+}
+
 // removeMonitorFromCache removes a monitor from the cache
 func (s *SchedulerImpl) removeMonitorFromCache(id int64) {
 	s.heapMu.Lock()
 	defer s.heapMu.Unlock()
+	s.removeMonitorUnlocked(id)
+}
 
-	if _, exists := s.monitors[id]; exists {
-		delete(s.monitors, id)
+// removeMonitorUnlocked is removeMonitorFromCache. Caller must hold heapMu lock.
+func (s *SchedulerImpl) removeMonitorUnlocked(id int64) {
+	if sm, exists := s.monitors[id]; exists {
+		s.untrackUnlocked(sm)
 		s.logger.Info("removed monitor from scheduler cache", "monitor_id", id)
 	}
 }
 
-// shutdown performs graceful shutdown of the scheduler
+// shutdown performs graceful shutdown of the scheduler. Workers get up to shutdownTimeout
+// to finish; batches still running after that are reported and abandoned.
 func (s *SchedulerImpl) shutdown() {
-	s.logger.Info("shutting down scheduler, waiting for workers to complete")
+	s.logger.Info("shutting down scheduler, waiting for workers to complete", "timeout", s.shutdownTimeout)
 
-	// Wait for all workers to complete
-	s.wg.Wait()
+	drained := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(drained)
+	}()
+
+	timer := time.NewTimer(s.shutdownTimeout)
+	defer timer.Stop()
+
+	forced := false
+	select {
+	case <-drained:
+	case <-timer.C:
+		forced = true
+		s.reportInFlight()
+	}
 
 	s.runMu.Lock()
 	s.running = false
 	s.runMu.Unlock()
 
+	if forced {
+		s.logger.Warn("scheduler shutdown timed out, abandoning in-flight batches", "timeout", s.shutdownTimeout)
+		return
+	}
 	s.logger.Info("scheduler shutdown complete")
 }
 
+// reportInFlight logs every plugin batch that has not finished yet
+func (s *SchedulerImpl) reportInFlight() {
+	s.inFlightMu.Lock()
+	defer s.inFlightMu.Unlock()
+
+	for _, b := range s.inFlight {
+		s.logger.Warn("plugin batch still in flight at shutdown deadline",
+			"plugin_id", b.PluginID,
+			"monitors", b.Monitors,
+			"running_for", time.Since(b.Started),
+		)
+	}
+}
+
 // updateMonitorStatus updates the monitor's status in the database
 func (s *SchedulerImpl) updateMonitorStatus(ctx context.Context, monitorID int64, status string) {
 	err := s.querier.UpdateMonitorStatus(ctx, dbgen.UpdateMonitorStatusParams{
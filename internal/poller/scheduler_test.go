@@ -0,0 +1,1102 @@
+package poller
+
+import (
+	"bytes"
+	"container/heap"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/netip"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/nmslite/nmslite/internal/api/auth"
+	"github.com/nmslite/nmslite/internal/database/dbgen"
+	"github.com/nmslite/nmslite/internal/globals"
+)
+
+func TestUpdateMonitorCachePauseResume(t *testing.T) {
+	s := &SchedulerImpl{
+		config:   &globals.SchedulerConfig{DownThreshold: 3},
+		logger:   slog.Default(),
+		monitors: make(map[int64]*ScheduledMonitor),
+	}
+
+	row := func(status string) dbgen.GetMonitorWithCredentialsRow {
+		return dbgen.GetMonitorWithCredentialsRow{
+			ID:        1,
+			IpAddress: netip.MustParseAddr("192.0.2.1"),
+			PluginID:  "ssh",
+			Status:    pgtype.Text{String: status, Valid: true},
+		}
+	}
+
+	s.updateMonitorCacheFromRow(row("active"))
+	sm, ok := s.monitors[1]
+	if !ok {
+		t.Fatal("Active monitor should be scheduled")
+	}
+	sm.ConsecutiveFailures = 2
+
+	s.updateMonitorCacheFromRow(row("paused"))
+	if _, ok := s.monitors[1]; ok {
+		t.Fatal("Paused monitor should be removed from the schedule")
+	}
+
+	s.updateMonitorCacheFromRow(row("active"))
+	resumed, ok := s.monitors[1]
+	if !ok {
+		t.Fatal("Resumed monitor should be scheduled again")
+	}
+	if resumed.ConsecutiveFailures != 0 {
+		t.Errorf("Resumed monitor should start with no failures, got %d", resumed.ConsecutiveFailures)
+	}
+	if resumed == sm {
+		t.Error("Resumed monitor should not reuse the pre-pause state")
+	}
+}
+
+func TestMonitorPortFallsBackToDefault(t *testing.T) {
+	s := &SchedulerImpl{}
+
+	testCases := []struct {
+		name     string
+		pluginID string
+		port     pgtype.Int4
+		tls      bool
+		want     int
+	}{
+		{"Explicit port", "ssh", pgtype.Int4{Int32: 2222, Valid: true}, false, 2222},
+		{"Null port", "ssh", pgtype.Int4{}, false, 22},
+		{"Zero port", "windows-winrm", pgtype.Int4{Int32: 0, Valid: true}, false, 5985},
+		{"WinRM over HTTPS", "windows-winrm", pgtype.Int4{}, true, 5986},
+		{"Explicit port over HTTPS", "windows-winrm", pgtype.Int4{Int32: 15986, Valid: true}, true, 15986},
+		{"No TLS port", "ssh", pgtype.Int4{}, true, 22},
+		{"SNMP", "snmp-v3", pgtype.Int4{}, false, 161},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			sm := &ScheduledMonitor{Monitor: &dbgen.Monitor{PluginID: tc.pluginID, Port: tc.port}}
+			if got := s.monitorPort(sm, tc.tls); got != tc.want {
+				t.Errorf("Expected port %d, got %d", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestPollIntervalClampedToBounds(t *testing.T) {
+	s := &SchedulerImpl{config: &globals.SchedulerConfig{MinPollingIntervalSeconds: 10, MaxPollingIntervalSeconds: 3600}}
+
+	testCases := []struct {
+		name     string
+		interval pgtype.Int4
+		want     time.Duration
+	}{
+		{"Unset", pgtype.Int4{}, time.Minute},
+		{"Within bounds", pgtype.Int4{Int32: 300, Valid: true}, 5 * time.Minute},
+		{"Zero", pgtype.Int4{Int32: 0, Valid: true}, 10 * time.Second},
+		{"Below minimum", pgtype.Int4{Int32: 1, Valid: true}, 10 * time.Second},
+		{"Above maximum", pgtype.Int4{Int32: 86400, Valid: true}, time.Hour},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			sm := &ScheduledMonitor{Monitor: &dbgen.Monitor{PollingIntervalSeconds: tc.interval}}
+			if got := s.pollInterval(sm); got != tc.want {
+				t.Errorf("Expected interval %v, got %v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestCredentialCacheEviction(t *testing.T) {
+	authService, err := auth.NewService(
+		"0123456789abcdef0123456789abcdef", "0123456789abcdef0123456789abcdef", "admin", "admin", time.Hour,
+	)
+	if err != nil {
+		t.Fatalf("Failed to create auth service: %v", err)
+	}
+	encrypted, err := authService.Encrypt([]byte(`{"username":"nms","password":"secret"}`))
+	if err != nil {
+		t.Fatalf("Failed to encrypt credentials: %v", err)
+	}
+
+	s := &SchedulerImpl{
+		config:      &globals.SchedulerConfig{},
+		logger:      slog.Default(),
+		credService: auth.NewCredentialService(authService, nil),
+		monitors:    make(map[int64]*ScheduledMonitor),
+	}
+	idle := &ScheduledMonitor{EncryptedCredentials: []byte(encrypted)}
+	busy := &ScheduledMonitor{EncryptedCredentials: []byte(encrypted)}
+	s.monitors[1], s.monitors[2] = idle, busy
+
+	for _, sm := range []*ScheduledMonitor{idle, busy} {
+		if cred, err := s.ensureCredentials(sm); err != nil || cred.Password != "secret" {
+			t.Fatalf("Expected decrypted credentials, got %+v (err: %v)", cred, err)
+		}
+	}
+
+	cached := idle.Credentials
+	idle.CredentialsLastUsed = time.Now().Add(-time.Hour)
+
+	if evicted := s.evictIdleCredentials(time.Now().Add(-time.Minute)); evicted != 1 {
+		t.Fatalf("Expected 1 eviction, got %d", evicted)
+	}
+	if idle.Credentials != nil || cached.Password != "" {
+		t.Error("Idle credentials should be wiped and dropped")
+	}
+	if busy.Credentials == nil {
+		t.Error("Recently used credentials should stay cached")
+	}
+
+	// A poll right after eviction decrypts again
+	if cred, err := s.ensureCredentials(idle); err != nil || cred.Password != "secret" {
+		t.Errorf("Expected re-decrypted credentials, got %+v (err: %v)", cred, err)
+	}
+}
+
+func TestPriorityQueueDeterministicOrder(t *testing.T) {
+	deadline := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	pq := PriorityQueue{}
+	for _, id := range []int64{5, 3, 9, 1, 7} {
+		heap.Push(&pq, &HeapItem{MonitorID: id, NextPollDeadline: deadline})
+	}
+	heap.Push(&pq, &HeapItem{MonitorID: 8, NextPollDeadline: deadline.Add(-time.Second)})
+
+	var got []int64
+	for pq.Len() > 0 {
+		item := heap.Pop(&pq).(*HeapItem)
+		if item.Index != -1 {
+			t.Errorf("Popped item %d should have index -1, got %d", item.MonitorID, item.Index)
+		}
+		got = append(got, item.MonitorID)
+	}
+
+	want := []int64{8, 1, 3, 5, 7, 9}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("Expected pop order %v, got %v", want, got)
+		}
+	}
+}
+
+func TestScheduleUpdatesDeadlineInPlace(t *testing.T) {
+	s := &SchedulerImpl{
+		config:   &globals.SchedulerConfig{},
+		logger:   slog.Default(),
+		monitors: make(map[int64]*ScheduledMonitor),
+	}
+
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	for id := int64(1); id <= 3; id++ {
+		sm := &ScheduledMonitor{Monitor: &dbgen.Monitor{ID: id}}
+		s.monitors[id] = sm
+		s.scheduleUnlocked(sm, now.Add(time.Duration(id)*time.Second))
+	}
+
+	// Move monitor 3 to the front, then monitor 1 to the back
+	s.scheduleUnlocked(s.monitors[3], now)
+	s.scheduleUnlocked(s.monitors[1], now.Add(time.Minute))
+
+	if len(s.heap) != 3 {
+		t.Fatalf("Expected heap to keep 3 entries, got %d", len(s.heap))
+	}
+	for i, item := range s.heap {
+		if item.Index != i {
+			t.Errorf("Heap item %d has index %d, expected %d", item.MonitorID, item.Index, i)
+		}
+	}
+
+	due := s.dequeueDueMonitors(now.Add(30 * time.Second))
+	if len(due) != 2 || due[0].Monitor.ID != 3 || due[1].Monitor.ID != 2 {
+		t.Fatalf("Expected monitors 3 then 2 to be due, got %v", due)
+	}
+	if len(s.heap) != 3 {
+		t.Errorf("Rescheduled monitors should reuse their entries, heap has %d", len(s.heap))
+	}
+}
+
+func TestPollNowMovesDeadlines(t *testing.T) {
+	s := &SchedulerImpl{
+		config:   &globals.SchedulerConfig{},
+		logger:   slog.Default(),
+		monitors: make(map[int64]*ScheduledMonitor),
+	}
+
+	later := time.Now().Add(time.Hour)
+	for id := int64(1); id <= 3; id++ {
+		sm := &ScheduledMonitor{Monitor: &dbgen.Monitor{ID: id}}
+		s.monitors[id] = sm
+		s.scheduleUnlocked(sm, later)
+	}
+	s.monitors[2].IsPolling = true
+
+	if due := s.PollNow([]int64{1, 2, 9}); due != 1 {
+		t.Fatalf("Expected 1 monitor moved, got %d", due)
+	}
+
+	due := s.dequeueDueMonitors(time.Now())
+	if len(due) != 1 || due[0].Monitor.ID != 1 {
+		t.Fatalf("Expected only monitor 1 to be due, got %v", due)
+	}
+	if !s.monitors[2].NextPollDeadline.Equal(later) {
+		t.Errorf("Monitor being polled should keep its deadline, got %v", s.monitors[2].NextPollDeadline)
+	}
+}
+
+func TestSchedulerClockJumps(t *testing.T) {
+	testCases := []struct {
+		name string
+		jump time.Duration // wall-clock step at 90s of elapsed time
+		// Real seconds at which the monitor is dequeued; a monitor is picked up on the
+		// tick before its deadline
+		want []int
+	}{
+		{"No jump", 0, []int{0, 59, 119, 179}},
+		{"Forward jump polls once, then resumes the interval", time.Hour, []int{0, 59, 90, 149}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// Wall-clock readings without a monotonic component, as a clock step would leave them
+			start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+			var elapsed time.Duration
+			wall := func() time.Time {
+				if elapsed >= 90*time.Second {
+					return start.Add(elapsed + tc.jump)
+				}
+				return start.Add(elapsed)
+			}
+
+			s := &SchedulerImpl{
+				config:   &globals.SchedulerConfig{TickIntervalMS: 1000},
+				logger:   slog.Default(),
+				monitors: make(map[int64]*ScheduledMonitor),
+				now:      wall,
+			}
+			sm := &ScheduledMonitor{Monitor: &dbgen.Monitor{
+				ID:                     1,
+				PollingIntervalSeconds: pgtype.Int4{Int32: 60, Valid: true},
+			}}
+			s.monitors[1] = sm
+			s.scheduleUnlocked(sm, wall())
+
+			var polled []int
+			for ; elapsed < 200*time.Second; elapsed += time.Second {
+				if due := s.dueMonitors(wall()); len(due) > 0 {
+					polled = append(polled, int(elapsed/time.Second))
+				}
+			}
+			if !slices.Equal(polled, tc.want) {
+				t.Errorf("Expected polls at %v s, got %v", tc.want, polled)
+			}
+		})
+	}
+}
+
+func TestHeapStaysProportionalUnderChurn(t *testing.T) {
+	s := &SchedulerImpl{
+		config:   &globals.SchedulerConfig{DownThreshold: 1},
+		logger:   slog.Default(),
+		monitors: make(map[int64]*ScheduledMonitor),
+	}
+
+	row := func(id int64, status string) dbgen.GetMonitorWithCredentialsRow {
+		return dbgen.GetMonitorWithCredentialsRow{
+			ID:        id,
+			IpAddress: netip.MustParseAddr("192.0.2.1"),
+			PluginID:  "ssh",
+			Status:    pgtype.Text{String: status, Valid: true},
+		}
+	}
+
+	for round := 0; round < 100; round++ {
+		for id := int64(1); id <= 10; id++ {
+			s.updateMonitorCacheFromRow(row(id, "active"))
+		}
+		s.updateMonitorCacheFromRow(row(3, "paused"))
+		s.updateMonitorCacheFromRow(row(4, "archived"))
+		s.removeMonitorFromCache(5)
+		s.removeMonitorFromCache(6)
+	}
+
+	if len(s.monitors) != 6 {
+		t.Fatalf("Expected 6 live monitors, got %d", len(s.monitors))
+	}
+	if len(s.heap) != len(s.monitors) {
+		t.Errorf("Expected heap size %d to match live monitors, got %d", len(s.monitors), len(s.heap))
+	}
+	for id, sm := range s.monitors {
+		if item := sm.heapItem; item == nil || s.heap[item.Index] != item {
+			t.Errorf("Monitor %d is not queued at its tracked index", id)
+		}
+	}
+}
+
+func TestCacheInvalidateOrdering(t *testing.T) {
+	row := func(id int64) dbgen.GetMonitorWithCredentialsRow {
+		return dbgen.GetMonitorWithCredentialsRow{
+			ID:        id,
+			IpAddress: netip.MustParseAddr("192.0.2.1"),
+			PluginID:  "ssh",
+			Status:    pgtype.Text{String: "active", Valid: true},
+		}
+	}
+	update := func(seq uint64) globals.CacheInvalidateEvent {
+		return globals.CacheInvalidateEvent{UpdateType: "update", Monitors: []dbgen.GetMonitorWithCredentialsRow{row(1)}, Seq: seq}
+	}
+	remove := func(seq uint64) globals.CacheInvalidateEvent {
+		return globals.CacheInvalidateEvent{UpdateType: "delete", MonitorIDs: []int64{1}, Seq: seq}
+	}
+
+	testCases := []struct {
+		name        string
+		events      []globals.CacheInvalidateEvent
+		wantTracked bool
+	}{
+		{"Update then delete", []globals.CacheInvalidateEvent{update(1), remove(2)}, false},
+		{"Delete received before an older update", []globals.CacheInvalidateEvent{remove(2), update(1)}, false},
+		{"Update after delete", []globals.CacheInvalidateEvent{remove(1), update(2)}, true},
+		{"Older update after newer update", []globals.CacheInvalidateEvent{update(2), update(1)}, true},
+		{"Unsequenced update after delete", []globals.CacheInvalidateEvent{remove(2), update(0)}, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			s := &SchedulerImpl{
+				config:      &globals.SchedulerConfig{DownThreshold: 1},
+				logger:      slog.Default(),
+				monitors:    make(map[int64]*ScheduledMonitor),
+				invalidated: make(map[int64]invalidateMark),
+			}
+			for _, event := range tc.events {
+				s.applyCacheInvalidate(event)
+			}
+			if _, tracked := s.monitors[1]; tracked != tc.wantTracked {
+				t.Errorf("Expected tracked=%v, got %v", tc.wantTracked, tracked)
+			}
+			if len(s.heap) != len(s.monitors) {
+				t.Errorf("Expected heap size %d to match live monitors, got %d", len(s.monitors), len(s.heap))
+			}
+		})
+	}
+}
+
+func TestCacheInvalidateWorkersKeepOrder(t *testing.T) {
+	events := &globals.EventChannels{CacheInvalidate: make(chan globals.CacheInvalidateEvent, 1000)}
+	s := &SchedulerImpl{
+		config:      &globals.SchedulerConfig{DownThreshold: 1},
+		logger:      slog.New(slog.NewTextHandler(io.Discard, nil)),
+		events:      events,
+		monitors:    make(map[int64]*ScheduledMonitor),
+		invalidated: make(map[int64]invalidateMark),
+		done:        make(chan struct{}),
+	}
+
+	// Each monitor gets an update and a delete, received in either order; the delete is
+	// newer for even IDs, so only odd IDs stay tracked
+	for id := int64(1); id <= 200; id++ {
+		older, newer := uint64(2*id), uint64(2*id+1)
+		updateSeq, deleteSeq := newer, older
+		if id%2 == 0 {
+			updateSeq, deleteSeq = older, newer
+		}
+		upd := globals.CacheInvalidateEvent{
+			UpdateType: "update",
+			Monitors: []dbgen.GetMonitorWithCredentialsRow{{
+				ID:        id,
+				IpAddress: netip.MustParseAddr("192.0.2.1"),
+				PluginID:  "ssh",
+				Status:    pgtype.Text{String: "active", Valid: true},
+			}},
+			Seq: updateSeq,
+		}
+		del := globals.CacheInvalidateEvent{UpdateType: "delete", MonitorIDs: []int64{id}, Seq: deleteSeq}
+		if id%3 == 0 {
+			upd, del = del, upd
+		}
+		events.CacheInvalidate <- upd
+		events.CacheInvalidate <- del
+	}
+	close(events.CacheInvalidate)
+
+	var wg sync.WaitGroup
+	for range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.runInvalidations(context.Background())
+		}()
+	}
+	wg.Wait()
+
+	for id := int64(1); id <= 200; id++ {
+		if _, tracked := s.monitors[id]; tracked != (id%2 == 1) {
+			t.Errorf("Monitor %d: expected tracked=%v, got %v", id, id%2 == 1, tracked)
+		}
+	}
+	if len(s.heap) != len(s.monitors) {
+		t.Errorf("Expected heap size %d to match live monitors, got %d", len(s.monitors), len(s.heap))
+	}
+}
+
+// failingWriter fails every write while fail is set
+type failingWriter struct {
+	fail   bool
+	writes int
+}
+
+func (w *failingWriter) Write(ctx context.Context, monitorID int64, tags map[string]string, results []globals.PollResult) error {
+	w.writes++
+	if w.fail {
+		return errors.New("submit cancelled")
+	}
+	return nil
+}
+
+func TestHandleSuccessReportsWriteFailures(t *testing.T) {
+	writer := &failingWriter{fail: true}
+	events := &globals.EventChannels{MonitorState: make(chan globals.MonitorStateEvent, 10)}
+	s := &SchedulerImpl{
+		config:       &globals.SchedulerConfig{DownThreshold: 2},
+		logger:       slog.Default(),
+		events:       events,
+		resultWriter: writer,
+		monitors:     make(map[int64]*ScheduledMonitor),
+	}
+	s.updateMonitorCacheFromRow(dbgen.GetMonitorWithCredentialsRow{
+		ID:        1,
+		IpAddress: netip.MustParseAddr("192.0.2.1"),
+		PluginID:  "ssh",
+		Status:    pgtype.Text{String: "active", Valid: true},
+	})
+	sm := s.monitors[1]
+
+	for i := 0; i < 3; i++ {
+		s.handleSuccess(context.Background(), sm, nil)
+	}
+
+	if got := s.WriteFailures(); got != 3 {
+		t.Errorf("Expected 3 write failures, got %d", got)
+	}
+	if len(events.MonitorState) != 1 {
+		t.Fatalf("Expected exactly one degraded event, got %d", len(events.MonitorState))
+	}
+	if event := <-events.MonitorState; event.EventType != "degraded" || event.Failures != 2 {
+		t.Errorf("Expected degraded event after 2 failures, got %+v", event)
+	}
+	if sm.ConsecutiveFailures != 0 {
+		t.Errorf("Write failures must not count as poll failures, got %d", sm.ConsecutiveFailures)
+	}
+
+	writer.fail = false
+	s.handleSuccess(context.Background(), sm, nil)
+	if sm.ConsecutiveWriteFailures != 0 {
+		t.Errorf("Successful write should reset the streak, got %d", sm.ConsecutiveWriteFailures)
+	}
+	if s.WriteFailures() != 3 {
+		t.Errorf("Successful write should not change the total, got %d", s.WriteFailures())
+	}
+}
+
+// countingWriter counts result writes per monitor
+type countingWriter struct {
+	writes map[int64]int
+}
+
+func (w *countingWriter) Write(ctx context.Context, monitorID int64, tags map[string]string, results []globals.PollResult) error {
+	w.writes[monitorID]++
+	return nil
+}
+
+func TestHandleBatchResultsIgnoresDuplicatesAndUnknown(t *testing.T) {
+	writer := &countingWriter{writes: make(map[int64]int)}
+	s := &SchedulerImpl{
+		config:       &globals.SchedulerConfig{DownThreshold: 3},
+		logger:       slog.Default(),
+		events:       &globals.EventChannels{MonitorState: make(chan globals.MonitorStateEvent, 10)},
+		resultWriter: writer,
+		monitors:     make(map[int64]*ScheduledMonitor),
+	}
+	for id := int64(1); id <= 3; id++ {
+		s.updateMonitorCacheFromRow(dbgen.GetMonitorWithCredentialsRow{
+			ID:        id,
+			IpAddress: netip.MustParseAddr("192.0.2.1"),
+			PluginID:  "ssh",
+			Status:    pgtype.Text{String: "active", Valid: true},
+		})
+		s.monitors[id].IsPolling = true
+	}
+	tasks := map[string]*ScheduledMonitor{"a": s.monitors[1], "b": s.monitors[2], "c": s.monitors[3]}
+
+	results := []globals.PollResult{
+		{RequestID: "a", Status: "success"},
+		{RequestID: "a", Status: "success"},               // duplicate success
+		{RequestID: "b", Status: "failed", Error: "boom"}, // settles b as failed
+		{RequestID: "b", Status: "success"},               // duplicate must not flip b to success
+		{RequestID: "zzz", Status: "success"},             // unknown
+		{RequestID: "yyy", Status: "success"},             // unknown, beyond the task count
+	}
+	s.handleBatchResults(context.Background(), s.logger, tasks, results)
+
+	if writer.writes[1] != 1 {
+		t.Errorf("Expected monitor 1 written once, got %d", writer.writes[1])
+	}
+	if writer.writes[2] != 0 || s.monitors[2].ConsecutiveFailures != 1 {
+		t.Errorf("Expected monitor 2 failed once and never written, got %d writes, %d failures",
+			writer.writes[2], s.monitors[2].ConsecutiveFailures)
+	}
+	if s.monitors[3].ConsecutiveFailures != 1 {
+		t.Errorf("Expected monitor 3 failed for a missing result, got %d failures", s.monitors[3].ConsecutiveFailures)
+	}
+	for id, sm := range s.monitors {
+		if sm.IsPolling {
+			t.Errorf("Monitor %d left polling", id)
+		}
+	}
+}
+
+func TestShutdownAbandonsStuckBatch(t *testing.T) {
+	var logs bytes.Buffer
+	s := &SchedulerImpl{
+		config:          &globals.SchedulerConfig{},
+		logger:          slog.New(slog.NewTextHandler(&logs, nil)),
+		monitors:        make(map[int64]*ScheduledMonitor),
+		shutdownTimeout: 100 * time.Millisecond,
+		running:         true,
+	}
+
+	// A batch that never completes, e.g. a plugin ignoring its kill signal
+	stuck := make(chan struct{})
+	defer close(stuck)
+	s.goBatch("ssh", 3, func() { <-stuck })
+
+	// A batch that finishes promptly is not reported
+	s.goBatch("snmp", 1, func() {})
+
+	done := make(chan struct{})
+	go func() {
+		s.shutdown()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("shutdown blocked past its deadline")
+	}
+
+	if s.running {
+		t.Error("Scheduler should be marked stopped after a forced drain")
+	}
+	out := logs.String()
+	if !strings.Contains(out, "plugin batch still in flight") || !strings.Contains(out, "plugin_id=ssh") {
+		t.Errorf("Expected the stuck batch to be reported, got logs:\n%s", out)
+	}
+	if strings.Contains(out, "plugin_id=snmp") {
+		t.Errorf("Finished batch should not be reported, got logs:\n%s", out)
+	}
+}
+
+func TestLoadActiveMonitorsReloadAndSnapshot(t *testing.T) {
+	q := newFakeQuerier()
+	add := func(id int64, payload string) {
+		q.addMonitor(id, "192.0.2.1", "active")
+		m := q.monitors[id]
+		m.CredentialProfileID = id
+		q.monitors[id] = m
+		q.credentials[id] = dbgen.CredentialProfile{ID: id, Protocol: "ssh", Payload: []byte(payload)}
+	}
+	add(1, "a")
+	add(2, "b")
+	s := &SchedulerImpl{
+		config:   &globals.SchedulerConfig{},
+		logger:   slog.Default(),
+		querier:  q,
+		monitors: make(map[int64]*ScheduledMonitor),
+	}
+
+	if err := s.LoadActiveMonitors(context.Background()); err != nil {
+		t.Fatalf("Initial load failed: %v", err)
+	}
+	kept := s.monitors[1]
+	kept.IsPolling = true
+	kept.Credentials = &auth.Credentials{Username: "cached"}
+	deadline := kept.NextPollDeadline.Add(time.Hour)
+	s.scheduleUnlocked(kept, deadline)
+	s.goBatch("ssh", 1, func() {})
+	s.wg.Wait()
+
+	// Monitor 2 went inactive, monitor 3 is new, monitor 1 is unchanged
+	m := q.monitors[2]
+	m.Status.String = "down"
+	q.monitors[2] = m
+	add(3, "c")
+	if err := s.LoadActiveMonitors(context.Background()); err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+
+	if s.monitors[1] != kept || !kept.NextPollDeadline.Equal(deadline) {
+		t.Error("Reload should keep an existing monitor's state and schedule")
+	}
+	if kept.Credentials == nil {
+		t.Error("Reload should keep cached credentials when the payload is unchanged")
+	}
+	if _, ok := s.monitors[2]; ok {
+		t.Error("Reload should drop monitors that are no longer active")
+	}
+	if _, ok := s.monitors[3]; !ok {
+		t.Error("Reload should add newly active monitors")
+	}
+
+	snap := s.Snapshot()
+	if snap.TrackedMonitors != 2 || snap.HeapSize != 2 {
+		t.Errorf("Expected 2 tracked monitors in a heap of 2, got %d and %d", snap.TrackedMonitors, snap.HeapSize)
+	}
+	if snap.NextDue == nil || !snap.NextDue.Equal(s.monitors[3].NextPollDeadline) {
+		t.Errorf("Expected next due to be the new monitor's deadline, got %v", snap.NextDue)
+	}
+	if len(snap.PollingMonitors) != 1 || snap.PollingMonitors[0] != 1 {
+		t.Errorf("Expected monitor 1 polling, got %v", snap.PollingMonitors)
+	}
+	if len(snap.InFlightBatches) != 0 {
+		t.Errorf("Expected no batches in flight after they finished, got %v", snap.InFlightBatches)
+	}
+}
+
+func TestKeepPollingWhenDown(t *testing.T) {
+	q := newFakeQuerier().addMonitor(1, "192.0.2.1", "active").addMonitor(2, "192.0.2.1", "active")
+	events := &globals.EventChannels{MonitorState: make(chan globals.MonitorStateEvent, 10)}
+	s := &SchedulerImpl{
+		config:       &globals.SchedulerConfig{DownThreshold: 2},
+		logger:       slog.Default(),
+		events:       events,
+		querier:      q,
+		resultWriter: &countingWriter{writes: make(map[int64]int)},
+		monitors:     make(map[int64]*ScheduledMonitor),
+	}
+	row := func(id int64, status string, keepPolling bool) dbgen.GetMonitorWithCredentialsRow {
+		return dbgen.GetMonitorWithCredentialsRow{
+			ID:                     id,
+			IpAddress:              netip.MustParseAddr("192.0.2.1"),
+			PluginID:               "ssh",
+			PollingIntervalSeconds: pgtype.Int4{Int32: 60, Valid: true},
+			Status:                 pgtype.Text{String: status, Valid: true},
+			KeepPollingWhenDown:    keepPolling,
+		}
+	}
+	s.updateMonitorCacheFromRow(row(1, "active", true))
+	s.updateMonitorCacheFromRow(row(2, "active", false))
+
+	// pollDue polls the given monitors on the next tick
+	pollDue := func(ids ...int64) []*ScheduledMonitor {
+		s.PollNow(ids)
+		return s.dequeueDueMonitors(time.Now())
+	}
+
+	for i := 0; i < 2; i++ {
+		for _, sm := range pollDue(1, 2) {
+			s.handleFailure(sm, "liveness check failed")
+		}
+	}
+
+	if q.monitors[1].Status.String != "down" || q.monitors[2].Status.String != "down" {
+		t.Fatalf("Expected both monitors marked down, got %q and %q", q.monitors[1].Status.String, q.monitors[2].Status.String)
+	}
+	if len(events.MonitorState) != 2 {
+		t.Fatalf("Expected a down event per monitor, got %d", len(events.MonitorState))
+	}
+	<-events.MonitorState
+	<-events.MonitorState
+	if _, ok := s.monitors[2]; ok {
+		t.Error("Monitor without the flag should stop being polled when down")
+	}
+
+	// The observe-only monitor is still dequeued, and further failures stay quiet
+	due := pollDue(1, 2)
+	if len(due) != 1 || due[0].Monitor.ID != 1 {
+		t.Fatalf("Expected the down monitor to keep being polled, got %d due", len(due))
+	}
+	s.handleFailure(due[0], "liveness check failed")
+	if len(events.MonitorState) != 0 {
+		t.Errorf("Expected no repeated down event, got %+v", <-events.MonitorState)
+	}
+
+	due = pollDue(1)
+	if len(due) != 1 {
+		t.Fatalf("Expected the down monitor to keep being polled, got %d due", len(due))
+	}
+	s.handleSuccess(context.Background(), due[0], nil)
+	if q.monitors[1].Status.String != "active" {
+		t.Errorf("Expected recovery to mark the monitor active, got %q", q.monitors[1].Status.String)
+	}
+	if event := <-events.MonitorState; event.EventType != "recovered" {
+		t.Errorf("Expected a recovered event, got %+v", event)
+	}
+
+	// Already down when (re)loaded: tracked, and counted as down
+	s.updateMonitorCacheFromRow(row(3, "down", true))
+	s.updateMonitorCacheFromRow(row(4, "down", false))
+	if sm, ok := s.monitors[3]; !ok || sm.ConsecutiveFailures != 2 {
+		t.Error("Down monitor with the flag should be scheduled as down")
+	}
+	if _, ok := s.monitors[4]; ok {
+		t.Error("Down monitor without the flag should not be scheduled")
+	}
+}
+
+func TestStaleMonitor(t *testing.T) {
+	q := newFakeQuerier().addMonitor(1, "192.0.2.1", "active")
+	events := &globals.EventChannels{MonitorState: make(chan globals.MonitorStateEvent, 10)}
+	s := &SchedulerImpl{
+		config:       &globals.SchedulerConfig{DownThreshold: 2, StaleAfterIntervals: 2},
+		logger:       slog.Default(),
+		events:       events,
+		querier:      q,
+		resultWriter: &countingWriter{writes: make(map[int64]int)},
+		monitors:     make(map[int64]*ScheduledMonitor),
+	}
+	row := func(id int64, status string) dbgen.GetMonitorWithCredentialsRow {
+		return dbgen.GetMonitorWithCredentialsRow{
+			ID:                     id,
+			IpAddress:              netip.MustParseAddr("192.0.2.1"),
+			PluginID:               "ssh",
+			PollingIntervalSeconds: pgtype.Int4{Int32: 60, Valid: true},
+			Status:                 pgtype.Text{String: status, Valid: true},
+		}
+	}
+	withMetrics := []globals.PollResult{{
+		Status:  "success",
+		Metrics: []interface{}{map[string]interface{}{"name": "system.uptime_seconds", "value": 1.0}},
+	}}
+	expectEvent := func(want string) {
+		t.Helper()
+		select {
+		case event := <-events.MonitorState:
+			if event.EventType != want {
+				t.Errorf("Expected a %s event, got %+v", want, event)
+			}
+		default:
+			t.Errorf("Expected a %s event, got none", want)
+		}
+	}
+
+	s.updateMonitorCacheFromRow(row(1, "active"))
+	sm := s.monitors[1]
+
+	// Within 2 intervals of the last metric an empty poll is not stale yet
+	sm.LastMetricAt = time.Now().Add(-90 * time.Second)
+	s.handleSuccess(context.Background(), sm, nil)
+	if sm.Stale || len(events.MonitorState) != 0 {
+		t.Fatalf("Expected no staleness after 1.5 intervals, got stale=%v events=%d", sm.Stale, len(events.MonitorState))
+	}
+
+	sm.LastMetricAt = time.Now().Add(-3 * time.Minute)
+	s.handleSuccess(context.Background(), sm, nil)
+	if q.monitors[1].Status.String != "stale" {
+		t.Errorf("Expected the monitor marked stale, got %q", q.monitors[1].Status.String)
+	}
+	expectEvent("stale")
+
+	s.handleSuccess(context.Background(), sm, nil)
+	if len(events.MonitorState) != 0 {
+		t.Errorf("Expected no repeated stale event, got %+v", <-events.MonitorState)
+	}
+
+	s.handleSuccess(context.Background(), sm, withMetrics)
+	if q.monitors[1].Status.String != "active" || sm.Stale {
+		t.Errorf("Expected metrics to mark the monitor active again, got %q", q.monitors[1].Status.String)
+	}
+	expectEvent("fresh")
+
+	// Already stale when (re)loaded: stays tracked and needs data to turn fresh
+	s.updateMonitorCacheFromRow(row(2, "stale"))
+	if sm, ok := s.monitors[2]; !ok || !sm.Stale {
+		t.Fatal("Stale monitor should be scheduled as stale")
+	}
+	s.handleSuccess(context.Background(), s.monitors[2], withMetrics)
+	expectEvent("fresh")
+
+	// Going down replaces stale
+	s.updateMonitorCacheFromRow(row(3, "stale"))
+	sm = s.monitors[3]
+	s.handleFailure(sm, "liveness check failed")
+	s.handleFailure(sm, "liveness check failed")
+	expectEvent("down")
+	if sm.Stale {
+		t.Error("Expected a down monitor to no longer be stale")
+	}
+
+	// Detection can be turned off
+	s.config.StaleAfterIntervals = -1
+	s.updateMonitorCacheFromRow(row(4, "active"))
+	s.monitors[4].LastMetricAt = time.Now().Add(-time.Hour)
+	s.handleSuccess(context.Background(), s.monitors[4], nil)
+	if len(events.MonitorState) != 0 {
+		t.Errorf("Expected no stale event with detection disabled, got %+v", <-events.MonitorState)
+	}
+}
+
+// fakeCollector returns one metric per poll, or fails for the targets in fail
+type fakeCollector struct {
+	mu     sync.Mutex
+	polled []string
+	fail   map[string]bool
+}
+
+func (c *fakeCollector) Collect(ctx context.Context, monitorID int64, target string, port int, creds auth.Credentials) ([]globals.PollResult, error) {
+	c.mu.Lock()
+	c.polled = append(c.polled, fmt.Sprintf("%s:%d/%s", target, port, creds.Username))
+	c.mu.Unlock()
+	if c.fail[target] {
+		return nil, errors.New("unreachable")
+	}
+	return []globals.PollResult{{
+		Status:  "success",
+		Metrics: []interface{}{map[string]interface{}{"name": "system.uptime_seconds", "value": 1.0}},
+	}}, nil
+}
+
+func TestProcessPluginBatchUsesInternalCollector(t *testing.T) {
+	writer := &countingWriter{writes: make(map[int64]int)}
+	s := &SchedulerImpl{
+		config:        &globals.SchedulerConfig{DownThreshold: 3},
+		logger:        slog.Default(),
+		pluginManager: NewPluginManager(t.TempDir(), time.Second, 0, 0),
+		resultWriter:  writer,
+		livenessSem:   make(chan struct{}, 4),
+		pluginSem:     make(chan struct{}, 1),
+		monitors:      make(map[int64]*ScheduledMonitor),
+	}
+	collector := &fakeCollector{fail: map[string]bool{"192.0.2.2": true}}
+	s.RegisterCollector("ssh", collector)
+
+	track := func(id int64, ip, pluginID string) *ScheduledMonitor {
+		sm := &ScheduledMonitor{
+			Monitor:        &dbgen.Monitor{ID: id, IpAddress: netip.MustParseAddr(ip), PluginID: pluginID},
+			LivenessMethod: LivenessNone,
+			Credentials:    &auth.Credentials{Username: "nms"},
+			IsPolling:      true,
+		}
+		s.monitors[id] = sm
+		return sm
+	}
+	ok := track(1, "192.0.2.1", "ssh")
+	failing := track(2, "192.0.2.2", "ssh")
+	unknown := track(3, "192.0.2.3", "telnet")
+
+	s.processPluginBatch(context.Background(), "ssh", []*ScheduledMonitor{ok, failing})
+	s.processPluginBatch(context.Background(), "telnet", []*ScheduledMonitor{unknown})
+
+	if len(collector.polled) != 2 || !slices.Contains(collector.polled, "192.0.2.1:22/nms") {
+		t.Errorf("Expected both ssh monitors collected on the default port, got %v", collector.polled)
+	}
+	if writer.writes[1] != 1 || writer.writes[2] != 0 {
+		t.Errorf("Expected metrics written only for the successful poll, got %v", writer.writes)
+	}
+	if ok.ConsecutiveFailures != 0 || ok.IsPolling {
+		t.Errorf("Expected monitor 1 to succeed, got %d failures (polling=%v)", ok.ConsecutiveFailures, ok.IsPolling)
+	}
+	if failing.ConsecutiveFailures != 1 || failing.IsPolling {
+		t.Errorf("Expected monitor 2 to fail once, got %d failures (polling=%v)", failing.ConsecutiveFailures, failing.IsPolling)
+	}
+	if unknown.ConsecutiveFailures != 1 {
+		t.Errorf("Expected a protocol with neither plugin nor collector to fail, got %d failures", unknown.ConsecutiveFailures)
+	}
+}
+
+func TestInitialPollDelay(t *testing.T) {
+	testCases := []struct {
+		name    string
+		policy  string
+		seconds int
+		wantMin time.Duration
+		wantMax time.Duration
+	}{
+		{"Default polls immediately", "", 0, 0, 0},
+		{"Immediate", "immediate", 30, 0, 0},
+		{"Fixed delay", "fixed", 30, 30 * time.Second, 30 * time.Second},
+		{"Spread within the interval", "spread", 0, 0, 5 * time.Minute},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			check := func(source string, sm *ScheduledMonitor, before, after time.Time) {
+				t.Helper()
+				if sm.NextPollDeadline.Before(before.Add(tc.wantMin)) || sm.NextPollDeadline.After(after.Add(tc.wantMax)) {
+					t.Errorf("%s: expected first poll in [%v, %v] after now, got %v",
+						source, tc.wantMin, tc.wantMax, sm.NextPollDeadline.Sub(before))
+				}
+			}
+
+			q := newFakeQuerier()
+			q.monitors[1] = dbgen.Monitor{
+				ID:                     1,
+				IpAddress:              netip.MustParseAddr("192.0.2.1"),
+				PluginID:               "ssh",
+				CredentialProfileID:    1,
+				PollingIntervalSeconds: pgtype.Int4{Int32: 300, Valid: true},
+				Status:                 pgtype.Text{String: "active", Valid: true},
+			}
+			q.credentials[1] = dbgen.CredentialProfile{ID: 1, Protocol: "ssh"}
+			s := &SchedulerImpl{
+				config:   &globals.SchedulerConfig{InitialPollDelay: tc.policy, InitialPollDelaySeconds: tc.seconds},
+				logger:   slog.Default(),
+				querier:  q,
+				monitors: make(map[int64]*ScheduledMonitor),
+			}
+
+			before := time.Now()
+			if err := s.LoadActiveMonitors(context.Background()); err != nil {
+				t.Fatalf("Load failed: %v", err)
+			}
+			check("LoadActiveMonitors", s.monitors[1], before, time.Now())
+
+			before = time.Now()
+			s.updateMonitorCacheFromRow(dbgen.GetMonitorWithCredentialsRow{
+				ID:                     2,
+				IpAddress:              netip.MustParseAddr("192.0.2.2"),
+				PluginID:               "ssh",
+				PollingIntervalSeconds: pgtype.Int4{Int32: 300, Valid: true},
+				Status:                 pgtype.Text{String: "active", Valid: true},
+			})
+			check("updateMonitorCacheFromRow", s.monitors[2], before, time.Now())
+		})
+	}
+}
+
+func TestDispatchWaitsForPollSlots(t *testing.T) {
+	s := &SchedulerImpl{
+		config:    &globals.SchedulerConfig{},
+		logger:    slog.Default(),
+		pollSlots: newPollSlots(2),
+	}
+
+	held, err := s.acquirePolls(context.Background(), 3)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if held != 2 || s.InFlightPolls() != 3 {
+		t.Fatalf("Expected an oversized batch to take every slot, got %d slots and %d in flight", held, s.InFlightPolls())
+	}
+
+	acquired := make(chan int, 1)
+	go func() {
+		slots, _ := s.acquirePolls(context.Background(), 1)
+		acquired <- slots
+	}()
+	select {
+	case <-acquired:
+		t.Fatal("Dispatch should wait while the cap is reached")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	s.releasePolls(3, held)
+	select {
+	case slots := <-acquired:
+		if slots != 1 || s.InFlightPolls() != 1 {
+			t.Errorf("Expected 1 slot and 1 poll in flight, got %d and %d", slots, s.InFlightPolls())
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Dispatch should resume once slots are freed")
+	}
+
+	// A cancelled wait gives back the slots it took
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := s.acquirePolls(ctx, 2); err == nil {
+		t.Fatal("Expected the wait to end with the context")
+	}
+	if len(s.pollSlots) != 1 || s.InFlightPolls() != 1 {
+		t.Errorf("Expected only the first poll to hold a slot, got %d slots and %d in flight", len(s.pollSlots), s.InFlightPolls())
+	}
+
+	// Stopping the scheduler ends the wait too
+	s.done = make(chan struct{})
+	stopped := make(chan error, 1)
+	go func() {
+		_, err := s.acquirePolls(context.Background(), 2)
+		stopped <- err
+	}()
+	close(s.done)
+	select {
+	case err := <-stopped:
+		if !errors.Is(err, errSchedulerStopping) {
+			t.Errorf("Expected errSchedulerStopping, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected the wait to end when the scheduler stops")
+	}
+	if len(s.pollSlots) != 1 {
+		t.Errorf("Expected the stopped wait to give back its slots, got %d held", len(s.pollSlots))
+	}
+}
+
+func TestUsesTLSKeepsCredentialsEvicted(t *testing.T) {
+	authService, err := auth.NewService(
+		"0123456789abcdef0123456789abcdef", "0123456789abcdef0123456789abcdef", "admin", "admin", time.Hour,
+	)
+	if err != nil {
+		t.Fatalf("Failed to create auth service: %v", err)
+	}
+	encrypted, err := authService.Encrypt([]byte(`{"username":"nms","password":"secret","use_https":true}`))
+	if err != nil {
+		t.Fatalf("Failed to encrypt credentials: %v", err)
+	}
+
+	s := &SchedulerImpl{
+		config:      &globals.SchedulerConfig{LivenessTimeoutMS: 100},
+		logger:      slog.Default(),
+		credService: auth.NewCredentialService(authService, nil),
+		monitors:    make(map[int64]*ScheduledMonitor),
+	}
+	defaultPort := &ScheduledMonitor{
+		Monitor:              &dbgen.Monitor{ID: 1, IpAddress: netip.MustParseAddr("127.0.0.1")},
+		EncryptedCredentials: []byte(encrypted),
+	}
+	explicitPort := &ScheduledMonitor{
+		Monitor: &dbgen.Monitor{
+			ID:        2,
+			IpAddress: netip.MustParseAddr("127.0.0.1"),
+			Port:      pgtype.Int4{Int32: 5986, Valid: true},
+		},
+		EncryptedCredentials: []byte(encrypted),
+	}
+	s.monitors[1], s.monitors[2] = defaultPort, explicitPort
+
+	for range 3 {
+		if !s.usesTLS(defaultPort) {
+			t.Fatal("Expected use_https credentials to select TLS")
+		}
+		s.usesTLS(explicitPort)
+		s.checkLivenessTCP(context.Background(), explicitPort)
+	}
+
+	for _, sm := range []*ScheduledMonitor{defaultPort, explicitPort} {
+		if sm.Credentials != nil || !sm.CredentialsLastUsed.IsZero() {
+			t.Errorf("Monitor %d: port lookups should not keep credentials resident", sm.Monitor.ID)
+		}
+	}
+	if explicitPort.UseTLS != nil {
+		t.Error("An explicit port should not need the credentials at all")
+	}
+
+	// A new payload forgets the cached flag
+	plain, err := authService.Encrypt([]byte(`{"username":"nms","password":"secret"}`))
+	if err != nil {
+		t.Fatalf("Failed to encrypt credentials: %v", err)
+	}
+	defaultPort.replaceCredentials([]byte(plain))
+	if s.usesTLS(defaultPort) {
+		t.Error("Expected the replaced credentials to select plain HTTP")
+	}
+}
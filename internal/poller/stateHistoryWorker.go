@@ -0,0 +1,108 @@
+package poller
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/nmslite/nmslite/internal/database/dbgen"
+	"github.com/nmslite/nmslite/internal/globals"
+)
+
+// stateHistoryBuffer is how many transitions may queue while an insert is in flight.
+// The worker is a fan-out subscriber, so a full buffer drops history rows rather than
+// stalling the scheduler.
+const stateHistoryBuffer = 256
+
+// StateHistoryWorker records every monitor state transition in monitor_state_history
+// and prunes rows older than the configured retention.
+type StateHistoryWorker struct {
+	querier dbgen.Querier
+	events  *globals.EventChannels
+	logger  *slog.Logger
+
+	retention time.Duration
+	interval  time.Duration
+}
+
+// NewStateHistoryWorker creates a new StateHistoryWorker instance
+func NewStateHistoryWorker(querier dbgen.Querier, events *globals.EventChannels) *StateHistoryWorker {
+	return &StateHistoryWorker{
+		querier:   querier,
+		events:    events,
+		logger:    slog.Default().With("component", "state_history"),
+		retention: globals.GetConfig().Scheduler.StateHistoryRetention(),
+		interval:  time.Hour,
+	}
+}
+
+// Run subscribes to monitor state events and blocks until context is cancelled.
+// It relies on RunFanOut for delivery.
+func (hw *StateHistoryWorker) Run(ctx context.Context) error {
+	transitions, unsubscribe := hw.events.Subscribe(stateHistoryBuffer, globals.StreamMonitorState)
+	defer unsubscribe()
+
+	hw.logger.Info("state history worker starting", "retention", hw.retention)
+
+	ticker := time.NewTicker(hw.interval)
+	defer ticker.Stop()
+
+	hw.prune(ctx)
+
+	for {
+		select {
+		case <-ctx.Done():
+			hw.logger.Info("state history worker shutting down")
+			return ctx.Err()
+		case event, ok := <-transitions:
+			if !ok {
+				return nil
+			}
+			if state, ok := event.Data.(globals.MonitorStateEvent); ok {
+				hw.record(ctx, state)
+			}
+		case <-ticker.C:
+			hw.prune(ctx)
+		}
+	}
+}
+
+// record stores a single transition; failures are logged and the row is dropped
+func (hw *StateHistoryWorker) record(ctx context.Context, event globals.MonitorStateEvent) {
+	occurredAt := event.Timestamp
+	if occurredAt.IsZero() {
+		occurredAt = time.Now()
+	}
+
+	err := hw.querier.InsertMonitorStateChange(ctx, dbgen.InsertMonitorStateChangeParams{
+		MonitorID:  event.MonitorID,
+		EventType:  event.EventType,
+		Failures:   int32(event.Failures),
+		OccurredAt: occurredAt.UTC(),
+	})
+	if err != nil && ctx.Err() == nil {
+		hw.logger.Error("failed to record monitor state change",
+			"monitor_id", event.MonitorID,
+			"event_type", event.EventType,
+			"error", err,
+		)
+	}
+}
+
+// prune deletes transitions older than the retention period (no-op when kept forever)
+func (hw *StateHistoryWorker) prune(ctx context.Context) {
+	if hw.retention <= 0 {
+		return
+	}
+
+	deleted, err := hw.querier.DeleteMonitorStateHistoryBefore(ctx, time.Now().UTC().Add(-hw.retention))
+	if err != nil {
+		if ctx.Err() == nil {
+			hw.logger.Error("failed to prune monitor state history", "error", err)
+		}
+		return
+	}
+	if deleted > 0 {
+		hw.logger.Info("pruned monitor state history", "deleted", deleted)
+	}
+}
@@ -0,0 +1,53 @@
+package poller
+
+import (
+	"context"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/nmslite/nmslite/internal/globals"
+)
+
+func TestStateHistoryWorkerRecord(t *testing.T) {
+	q := newFakeQuerier()
+	hw := &StateHistoryWorker{querier: q, logger: slog.Default()}
+
+	loc := time.FixedZone("UTC+5", 5*3600)
+	at := time.Date(2025, 3, 1, 10, 0, 0, 0, loc)
+	hw.record(context.Background(), globals.MonitorStateEvent{MonitorID: 7, EventType: "down", Failures: 3, Timestamp: at})
+	hw.record(context.Background(), globals.MonitorStateEvent{MonitorID: 7, EventType: "recovered"})
+
+	if len(q.history) != 2 {
+		t.Fatalf("Expected 2 inserts, got %d", len(q.history))
+	}
+	down := q.history[0]
+	if down.MonitorID != 7 || down.EventType != "down" || down.Failures != 3 {
+		t.Errorf("Unexpected row: %+v", down)
+	}
+	if !down.OccurredAt.Equal(at) || down.OccurredAt.Location() != time.UTC {
+		t.Errorf("Expected %v stored as UTC, got %v", at, down.OccurredAt)
+	}
+	if age := time.Since(q.history[1].OccurredAt); age < 0 || age > time.Minute {
+		t.Errorf("Expected missing timestamp to default to now, got %v", q.history[1].OccurredAt)
+	}
+}
+
+func TestStateHistoryWorkerPrune(t *testing.T) {
+	q := newFakeQuerier()
+	hw := &StateHistoryWorker{querier: q, logger: slog.Default(), retention: 30 * 24 * time.Hour}
+
+	hw.prune(context.Background())
+	if got := q.calls["DeleteMonitorStateHistoryBefore"]; got != 1 {
+		t.Fatalf("Expected 1 prune, got %d", got)
+	}
+	if age := time.Since(lastArgs[time.Time](q, "DeleteMonitorStateHistoryBefore")); age < 30*24*time.Hour || age > 30*24*time.Hour+time.Minute {
+		t.Errorf("Expected cutoff ~30d ago, got %v ago", age)
+	}
+
+	hw.retention = 0
+	hw.prune(context.Background())
+	if got := q.calls["DeleteMonitorStateHistoryBefore"]; got != 1 {
+		t.Errorf("Expected no prune when history is kept forever, got %d", got)
+	}
+}
@@ -0,0 +1,194 @@
+package poller
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/netip"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gosnmp/gosnmp"
+	"github.com/nmslite/nmslite/internal/database/dbgen"
+	"github.com/nmslite/nmslite/internal/globals"
+)
+
+// snmpTrapOID is the varbind carrying a v2c/v3 notification's type (e.g. linkDown)
+const snmpTrapOID = ".1.3.6.1.6.3.1.1.4.1.0"
+
+// trapSourceQueueSize bounds trap sources waiting for their monitors to be resolved
+const trapSourceQueueSize = 256
+
+// TrapListener receives SNMP traps and asks the scheduler to re-poll the monitors of the
+// sending device right away. Traps from addresses with no active monitor are counted and
+// otherwise ignored.
+type TrapListener struct {
+	querier  dbgen.Querier
+	events   *globals.EventChannels
+	logger   *slog.Logger
+	addr     string
+	cfg      globals.TrapConfig
+	cooldown time.Duration
+
+	// sources hands trap senders from the receive loop to the resolver
+	sources chan netip.Addr
+
+	// lastRepoll records when each source last triggered a re-poll
+	lastRepollMu sync.Mutex
+	lastRepoll   map[netip.Addr]time.Time
+
+	// unknownSources counts traps from addresses with no active monitor
+	unknownSources atomic.Int64
+}
+
+// NewTrapListener creates a trap listener from the traps config
+func NewTrapListener(querier dbgen.Querier, events *globals.EventChannels) *TrapListener {
+	cfg := globals.GetConfig().Traps
+	return &TrapListener{
+		querier:    querier,
+		events:     events,
+		logger:     slog.Default().With("component", "traps"),
+		addr:       cfg.Addr(),
+		cfg:        cfg,
+		cooldown:   cfg.RepollCooldown(),
+		sources:    make(chan netip.Addr, trapSourceQueueSize),
+		lastRepoll: make(map[netip.Addr]time.Time),
+	}
+}
+
+// Run listens for traps until ctx is cancelled. It returns early if the address cannot be bound.
+func (tl *TrapListener) Run(ctx context.Context) error {
+	params := *gosnmp.Default
+	listener := gosnmp.NewTrapListener()
+	listener.Params = &params
+	listener.OnNewTrap = tl.handleTrap
+
+	errCh := make(chan error, 1)
+	go func() { errCh <- listener.Listen(tl.addr) }()
+
+	resolverCtx, stopResolver := context.WithCancel(ctx)
+	defer stopResolver()
+	go tl.resolve(resolverCtx)
+
+	listening := listener.Listening()
+	for {
+		select {
+		case err := <-errCh:
+			return fmt.Errorf("trap listener on %s: %w", tl.addr, err)
+		case <-listening:
+			listening = nil
+			tl.logger.Info("trap listener started", "addr", tl.addr)
+		case <-ctx.Done():
+			listener.Close()
+			tl.logger.Info("trap listener shutting down", "unknown_sources", tl.unknownSources.Load())
+			return ctx.Err()
+		}
+	}
+}
+
+// UnknownSources returns how many traps came from addresses with no active monitor
+func (tl *TrapListener) UnknownSources() int64 {
+	return tl.unknownSources.Load()
+}
+
+// handleTrap runs on the receive loop, so it only filters the trap and queues its source
+func (tl *TrapListener) handleTrap(packet *gosnmp.SnmpPacket, from *net.UDPAddr) {
+	source, ok := netip.AddrFromSlice(from.IP)
+	if !ok {
+		return
+	}
+	source = source.Unmap()
+
+	if tl.cfg.Community != "" && packet.Version != gosnmp.Version3 && packet.Community != tl.cfg.Community {
+		tl.logger.Debug("trap dropped, community mismatch", "source", source.String())
+		return
+	}
+
+	if !tl.allowRepoll(source, time.Now()) {
+		tl.logger.Debug("trap ignored, device re-polled recently", "source", source.String(), "trap", trapName(packet))
+		return
+	}
+	tl.logger.Debug("trap received", "source", source.String(), "trap", trapName(packet))
+
+	select {
+	case tl.sources <- source:
+	default:
+		tl.logger.Warn("trap queue full, trap dropped", "source", source.String())
+	}
+}
+
+// allowRepoll reports whether source may trigger a re-poll now, recording it if so
+func (tl *TrapListener) allowRepoll(source netip.Addr, now time.Time) bool {
+	tl.lastRepollMu.Lock()
+	defer tl.lastRepollMu.Unlock()
+
+	if last, ok := tl.lastRepoll[source]; ok && now.Sub(last) < tl.cooldown {
+		return false
+	}
+	tl.lastRepoll[source] = now
+
+	// Keep the map from growing with every address that ever sent a trap
+	if len(tl.lastRepoll) > trapSourceQueueSize*4 {
+		for addr, last := range tl.lastRepoll {
+			if now.Sub(last) >= tl.cooldown {
+				delete(tl.lastRepoll, addr)
+			}
+		}
+	}
+	return true
+}
+
+// resolve maps queued trap sources to monitors and signals the scheduler
+func (tl *TrapListener) resolve(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case source := <-tl.sources:
+			tl.repoll(ctx, source)
+		}
+	}
+}
+
+// repoll asks the scheduler to poll every active monitor of source now
+func (tl *TrapListener) repoll(ctx context.Context, source netip.Addr) {
+	ids, err := tl.querier.ListActiveMonitorIDsByIP(ctx, source)
+	if err != nil {
+		if ctx.Err() == nil {
+			tl.logger.Error("failed to resolve trap source", "source", source.String(), "error", err)
+		}
+		return
+	}
+	if len(ids) == 0 {
+		tl.unknownSources.Add(1)
+		tl.logger.Debug("trap from unknown source ignored", "source", source.String())
+		return
+	}
+
+	event := globals.PollNowEvent{MonitorIDs: ids, Reason: "snmp_trap"}
+	select {
+	case tl.events.PollNow <- event:
+	case <-ctx.Done():
+	default:
+		tl.logger.Warn("PollNow channel full, trap re-poll dropped", "source", source.String())
+		tl.events.RecordDropped(globals.ChannelPollNow, globals.DropChannelFull, event)
+	}
+}
+
+// trapName describes a trap for logging: the notification OID for v2c/v3, the generic
+// trap number for v1
+func trapName(packet *gosnmp.SnmpPacket) string {
+	if packet.Version == gosnmp.Version1 {
+		return fmt.Sprintf("generic-%d", packet.GenericTrap)
+	}
+	for _, v := range packet.Variables {
+		if v.Name == snmpTrapOID {
+			if oid, ok := v.Value.(string); ok {
+				return oid
+			}
+		}
+	}
+	return "unknown"
+}
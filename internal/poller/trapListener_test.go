@@ -0,0 +1,87 @@
+package poller
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"net/netip"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/gosnmp/gosnmp"
+	"github.com/nmslite/nmslite/internal/globals"
+)
+
+func TestTrapListenerRepoll(t *testing.T) {
+	known := netip.MustParseAddr("192.0.2.10")
+	unknown := netip.MustParseAddr("192.0.2.99")
+
+	tl := &TrapListener{
+		querier:    newFakeQuerier().addMonitor(7, known.String(), "stale").addMonitor(3, known.String(), "active").addMonitor(4, known.String(), "down"),
+		events:     &globals.EventChannels{PollNow: make(chan globals.PollNowEvent, 4)},
+		logger:     slog.Default(),
+		cfg:        globals.TrapConfig{Community: "traps"},
+		cooldown:   time.Minute,
+		sources:    make(chan netip.Addr, 4),
+		lastRepoll: make(map[netip.Addr]time.Time),
+	}
+
+	linkDown := &gosnmp.SnmpPacket{
+		Version:   gosnmp.Version2c,
+		Community: "traps",
+		Variables: []gosnmp.SnmpPDU{{Name: snmpTrapOID, Type: gosnmp.ObjectIdentifier, Value: ".1.3.6.1.6.3.1.1.5.3"}},
+	}
+	wrongCommunity := &gosnmp.SnmpPacket{Version: gosnmp.Version2c, Community: "public"}
+
+	// IPv4-mapped addresses are matched as plain IPv4
+	tl.handleTrap(linkDown, &net.UDPAddr{IP: net.ParseIP("192.0.2.10")})
+	tl.handleTrap(linkDown, &net.UDPAddr{IP: net.ParseIP("192.0.2.10")}) // within cooldown
+	tl.handleTrap(wrongCommunity, &net.UDPAddr{IP: net.ParseIP("192.0.2.99")})
+	tl.handleTrap(linkDown, &net.UDPAddr{IP: unknown.AsSlice()})
+
+	if len(tl.sources) != 2 {
+		t.Fatalf("Expected 2 queued sources, got %d", len(tl.sources))
+	}
+	for len(tl.sources) > 0 {
+		tl.repoll(context.Background(), <-tl.sources)
+	}
+
+	if got := tl.UnknownSources(); got != 1 {
+		t.Errorf("Expected 1 unknown source, got %d", got)
+	}
+	select {
+	case event := <-tl.events.PollNow:
+		if !slices.Equal(event.MonitorIDs, []int64{3, 7}) || event.Reason != "snmp_trap" {
+			t.Errorf("Unexpected poll event: %+v", event)
+		}
+	default:
+		t.Fatal("Expected a poll event for the known source")
+	}
+	if len(tl.events.PollNow) != 0 {
+		t.Errorf("Expected a single poll event, got %d more", len(tl.events.PollNow))
+	}
+}
+
+func TestTrapName(t *testing.T) {
+	testCases := []struct {
+		name   string
+		packet *gosnmp.SnmpPacket
+		want   string
+	}{
+		{"v1 generic trap", &gosnmp.SnmpPacket{Version: gosnmp.Version1, SnmpTrap: gosnmp.SnmpTrap{GenericTrap: 2}}, "generic-2"},
+		{"v2c linkUp", &gosnmp.SnmpPacket{
+			Version:   gosnmp.Version2c,
+			Variables: []gosnmp.SnmpPDU{{Name: snmpTrapOID, Type: gosnmp.ObjectIdentifier, Value: ".1.3.6.1.6.3.1.1.5.4"}},
+		}, ".1.3.6.1.6.3.1.1.5.4"},
+		{"v2c without trap OID", &gosnmp.SnmpPacket{Version: gosnmp.Version2c}, "unknown"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := trapName(tc.packet); got != tc.want {
+				t.Errorf("Expected %q, got %q", tc.want, got)
+			}
+		})
+	}
+}
@@ -1,6 +1,9 @@
 package protocols
 
 import (
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"strings"
 
@@ -12,6 +15,27 @@ type WinRMCredentials struct {
 	Username string `json:"username" validate:"required,min=1"`
 	Password string `json:"password" validate:"required,min=1"`
 	Domain   string `json:"domain,omitempty"`
+
+	// Optional HTTPS transport (port 5986 by convention). Without use_https the
+	// connection is plain HTTP and the TLS options below do not apply.
+	UseHTTPS           bool   `json:"use_https,omitempty"`
+	InsecureSkipVerify bool   `json:"insecure_skip_verify,omitempty"`
+	CACert             string `json:"ca_cert,omitempty"` // PEM, trusted instead of the system roots
+}
+
+// Validate implements custom validation for WinRM credentials
+// TLS options require use_https, and a CA certificate is pointless when verification is skipped
+func (w *WinRMCredentials) Validate() error {
+	if !w.UseHTTPS && (w.InsecureSkipVerify || w.CACert != "") {
+		return fmt.Errorf("insecure_skip_verify and ca_cert require use_https")
+	}
+	if w.InsecureSkipVerify && w.CACert != "" {
+		return fmt.Errorf("ca_cert cannot be combined with insecure_skip_verify")
+	}
+	if w.CACert != "" && !x509.NewCertPool().AppendCertsFromPEM([]byte(w.CACert)) {
+		return fmt.Errorf("ca_cert must contain at least one PEM-encoded certificate")
+	}
+	return nil
 }
 
 // SSHCredentials represents credentials for SSH access
@@ -31,9 +55,13 @@ func (s *SSHCredentials) Validate() error {
 	return nil
 }
 
-// SNMPCredentials represents credentials for SNMP v2c access
+// SNMPCredentials represents credentials for SNMP v1 and v2c access
 type SNMPCredentials struct {
 	Community string `json:"community" validate:"required,min=1"`
+
+	// Optional transport overrides for UDP-lossy networks
+	Retries   *int `json:"retries,omitempty" validate:"omitempty,min=0,max=10"`
+	TimeoutMS int  `json:"timeout_ms,omitempty" validate:"omitempty,min=1,max=60000"`
 }
 
 // SNMPv3Credentials represents credentials for SNMP v3 access with USM
@@ -44,6 +72,44 @@ type SNMPv3Credentials struct {
 	AuthPassword  string `json:"auth_password,omitempty"`
 	PrivProtocol  string `json:"priv_protocol,omitempty" validate:"omitempty,oneof=DES AES AES192 AES256"`
 	PrivPassword  string `json:"priv_password,omitempty"`
+
+	// Optional scoped-PDU context for devices with multiple SNMP contexts.
+	// Empty values keep the defaults (default context, engine ID from discovery).
+	ContextName     string `json:"context_name,omitempty" validate:"omitempty,max=255"`
+	ContextEngineID string `json:"context_engine_id,omitempty"` // hex, e.g. "80001f8880..."
+
+	// Optional transport overrides for UDP-lossy networks
+	Retries   *int `json:"retries,omitempty" validate:"omitempty,min=0,max=10"`
+	TimeoutMS int  `json:"timeout_ms,omitempty" validate:"omitempty,min=1,max=60000"`
+}
+
+// Validate implements custom validation for SNMP v3 credentials
+func (s *SNMPv3Credentials) Validate() error {
+	if _, err := DecodeEngineID(s.ContextEngineID); err != nil {
+		return &ValidationErrors{
+			Errors: []ValidationError{{Field: "context_engine_id", Message: "context_engine_id " + err.Error()}},
+		}
+	}
+	return nil
+}
+
+// DecodeEngineID converts a hex SNMP engine ID (optional "0x" prefix) to its raw
+// octet string. An empty ID decodes to "" so the engine ID is discovered instead.
+func DecodeEngineID(engineID string) (string, error) {
+	engineID = strings.TrimPrefix(strings.TrimPrefix(engineID, "0x"), "0X")
+	if engineID == "" {
+		return "", nil
+	}
+
+	raw, err := hex.DecodeString(engineID)
+	if err != nil {
+		return "", fmt.Errorf("must be a hex string")
+	}
+	// RFC 3411: SnmpEngineID is 5..32 octets
+	if len(raw) < 5 || len(raw) > 32 {
+		return "", fmt.Errorf("must be 5 to 32 octets, got %d", len(raw))
+	}
+	return string(raw), nil
 }
 
 // Global validator instance
@@ -86,9 +152,13 @@ func ValidateCredentialStruct(creds interface{}) error {
 		return validationErrs
 	}
 
-	// Check for custom Validate method
+	// Check for custom Validate method; errors that already name their field pass through
 	if v, ok := creds.(interface{ Validate() error }); ok {
 		if err := v.Validate(); err != nil {
+			var fieldErrs *ValidationErrors
+			if errors.As(err, &fieldErrs) {
+				return fieldErrs
+			}
 			return &ValidationErrors{
 				Errors: []ValidationError{{Field: "_custom", Message: err.Error()}},
 			}
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"reflect"
+	"strconv"
 	"strings"
 	"sync"
 )
@@ -20,6 +21,10 @@ type Registry struct {
 type Protocol struct {
 	ID   string `json:"id"`
 	Name string `json:"name"`
+	// DefaultPort is used when a monitor or discovery profile does not set a port
+	DefaultPort int `json:"default_port"`
+	// TLSDefaultPort replaces DefaultPort when the credentials select TLS (WinRM use_https)
+	TLSDefaultPort int `json:"tls_default_port,omitempty"`
 }
 
 var (
@@ -48,26 +53,38 @@ func newRegistry() *Registry {
 func (r *Registry) initializeProtocols() {
 	// WinRM Protocol
 	r.registerProtocol(&Protocol{
-		ID:   "windows-winrm",
-		Name: "Windows Server (WinRM)",
+		ID:             "windows-winrm",
+		Name:           "Windows Server (WinRM)",
+		DefaultPort:    5985,
+		TLSDefaultPort: 5986,
 	}, reflect.TypeOf(WinRMCredentials{}))
 
 	// SSH Protocol
 	r.registerProtocol(&Protocol{
-		ID:   "ssh",
-		Name: "Linux/Unix (SSH)",
+		ID:          "ssh",
+		Name:        "Linux/Unix (SSH)",
+		DefaultPort: 22,
 	}, reflect.TypeOf(SSHCredentials{}))
 
+	// SNMP v1 Protocol
+	r.registerProtocol(&Protocol{
+		ID:          "snmp-v1",
+		Name:        "SNMP v1",
+		DefaultPort: 161,
+	}, reflect.TypeOf(SNMPCredentials{}))
+
 	// SNMP v2c Protocol
 	r.registerProtocol(&Protocol{
-		ID:   "snmp-v2c",
-		Name: "SNMP v2c",
+		ID:          "snmp-v2c",
+		Name:        "SNMP v2c",
+		DefaultPort: 161,
 	}, reflect.TypeOf(SNMPCredentials{}))
 
 	// SNMP v3 Protocol
 	r.registerProtocol(&Protocol{
-		ID:   "snmp-v3",
-		Name: "SNMP v3",
+		ID:          "snmp-v3",
+		Name:        "SNMP v3",
+		DefaultPort: 161,
 	}, reflect.TypeOf(SNMPv3Credentials{}))
 }
 
@@ -91,6 +108,28 @@ func (r *Registry) GetProtocol(id string) (*Protocol, error) {
 	return protocol, nil
 }
 
+// DefaultPort returns the well-known port of a protocol, or 0 if it is unknown
+func (r *Registry) DefaultPort(id string) int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if protocol, exists := r.protocols[id]; exists {
+		return protocol.DefaultPort
+	}
+	return 0
+}
+
+// DefaultTLSPort returns the well-known TLS port of a protocol, or 0 if it has none
+func (r *Registry) DefaultTLSPort(id string) int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if protocol, exists := r.protocols[id]; exists {
+		return protocol.TLSDefaultPort
+	}
+	return 0
+}
+
 // ListProtocols returns all registered protocols
 func (r *Registry) ListProtocols() []*Protocol {
 	r.mu.RLock()
@@ -157,3 +196,74 @@ func (r *Registry) GetCredentialType(protocolID string) (reflect.Type, error) {
 	}
 	return credType, nil
 }
+
+// CredentialField describes one field of a protocol's credential payload
+type CredentialField struct {
+	Name     string   `json:"name"`
+	Type     string   `json:"type"`
+	Required bool     `json:"required"`
+	Enum     []string `json:"enum,omitempty"`
+
+	// MinLength is the minimum string length (from validate "min"), 0 if unconstrained
+	MinLength int `json:"min_length,omitempty"`
+}
+
+// CredentialFields describes a protocol's credential struct, derived from its json and validate tags
+func (r *Registry) CredentialFields(protocolID string) ([]CredentialField, error) {
+	credType, err := r.GetCredentialType(protocolID)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := make([]CredentialField, 0, credType.NumField())
+	for i := 0; i < credType.NumField(); i++ {
+		sf := credType.Field(i)
+		if !sf.IsExported() {
+			continue
+		}
+
+		name, _, _ := strings.Cut(sf.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = toSnakeCase(sf.Name)
+		}
+
+		field := CredentialField{Name: name, Type: jsonTypeName(sf.Type)}
+		for _, rule := range strings.Split(sf.Tag.Get("validate"), ",") {
+			switch {
+			case rule == "required":
+				field.Required = true
+			case strings.HasPrefix(rule, "oneof="):
+				field.Enum = strings.Fields(strings.TrimPrefix(rule, "oneof="))
+			case strings.HasPrefix(rule, "min=") && field.Type == "string":
+				field.MinLength, _ = strconv.Atoi(strings.TrimPrefix(rule, "min="))
+			}
+		}
+		fields = append(fields, field)
+	}
+	return fields, nil
+}
+
+// jsonTypeName maps a Go type to its JSON type name
+func jsonTypeName(t reflect.Type) string {
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "integer"
+	case reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Slice, reflect.Array:
+		return "array"
+	case reflect.Map, reflect.Struct:
+		return "object"
+	default:
+		return "string"
+	}
+}
@@ -1,9 +1,17 @@
 package protocols
 
 import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
 	"encoding/json"
+	"encoding/pem"
 	"errors"
+	"math/big"
 	"testing"
+	"time"
 )
 
 func TestRegistryInitialization(t *testing.T) {
@@ -23,6 +31,7 @@ func TestRegistryInitialization(t *testing.T) {
 	expected := map[string]bool{
 		"windows-winrm": false,
 		"ssh":           false,
+		"snmp-v1":       false,
 		"snmp-v2c":      false,
 		"snmp-v3":       false,
 	}
@@ -41,6 +50,30 @@ func TestRegistryInitialization(t *testing.T) {
 	}
 }
 
+func TestDefaultPort(t *testing.T) {
+	registry := GetRegistry()
+
+	testCases := []struct {
+		protocolID string
+		want       int
+	}{
+		{"windows-winrm", 5985},
+		{"ssh", 22},
+		{"snmp-v1", 161},
+		{"snmp-v2c", 161},
+		{"snmp-v3", 161},
+		{"invalid-protocol", 0},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.protocolID, func(t *testing.T) {
+			if got := registry.DefaultPort(tc.protocolID); got != tc.want {
+				t.Errorf("Expected default port %d, got %d", tc.want, got)
+			}
+		})
+	}
+}
+
 func TestGetProtocol(t *testing.T) {
 	registry := GetRegistry()
 
@@ -89,6 +122,7 @@ func TestGetCredentialType(t *testing.T) {
 		{"WinRM Credential Type", "windows-winrm", true},
 		{"SSH Credential Type", "ssh", true},
 		{"SNMP Credential Type", "snmp-v2c", true},
+		{"SNMP v1 Credential Type", "snmp-v1", true},
 		{"Invalid Credential Type", "invalid", false},
 	}
 
@@ -123,6 +157,8 @@ func toJSON(t *testing.T, data map[string]any) json.RawMessage {
 }
 
 func TestValidateWinRMCredentials(t *testing.T) {
+	caCert := testCACert(t)
+
 	testCases := []struct {
 		name      string
 		creds     map[string]any
@@ -148,6 +184,31 @@ func TestValidateWinRMCredentials(t *testing.T) {
 			map[string]any{"username": "", "password": "pass123"},
 			true,
 		},
+		{
+			"HTTPS with CA certificate",
+			map[string]any{"username": "admin", "password": "pass123", "use_https": true, "ca_cert": caCert},
+			false,
+		},
+		{
+			"HTTPS skipping verification",
+			map[string]any{"username": "admin", "password": "pass123", "use_https": true, "insecure_skip_verify": true},
+			false,
+		},
+		{
+			"TLS option without HTTPS",
+			map[string]any{"username": "admin", "password": "pass123", "insecure_skip_verify": true},
+			true,
+		},
+		{
+			"CA certificate with skipped verification",
+			map[string]any{"username": "admin", "password": "pass123", "use_https": true, "insecure_skip_verify": true, "ca_cert": caCert},
+			true,
+		},
+		{
+			"CA certificate not PEM",
+			map[string]any{"username": "admin", "password": "pass123", "use_https": true, "ca_cert": "not a certificate"},
+			true,
+		},
 	}
 
 	registry := GetRegistry()
@@ -235,17 +296,19 @@ func TestValidateSNMPCredentials(t *testing.T) {
 
 	registry := GetRegistry()
 
-	for _, tc := range testCases {
-		t.Run(tc.name, func(t *testing.T) {
-			_, err := registry.ValidateCredentials("snmp-v2c", toJSON(t, tc.creds))
+	for _, protocol := range []string{"snmp-v1", "snmp-v2c"} {
+		for _, tc := range testCases {
+			t.Run(protocol+"/"+tc.name, func(t *testing.T) {
+				_, err := registry.ValidateCredentials(protocol, toJSON(t, tc.creds))
 
-			if tc.shouldErr && err == nil {
-				t.Error("Expected validation error, but got none")
-			}
-			if !tc.shouldErr && err != nil {
-				t.Errorf("Expected no error, but got: %v", err)
-			}
-		})
+				if tc.shouldErr && err == nil {
+					t.Error("Expected validation error, but got none")
+				}
+				if !tc.shouldErr && err != nil {
+					t.Errorf("Expected no error, but got: %v", err)
+				}
+			})
+		}
 	}
 }
 
@@ -285,3 +348,119 @@ func TestInvalidProtocolValidation(t *testing.T) {
 		t.Error("Expected error for invalid protocol, but got none")
 	}
 }
+
+func TestCredentialFields(t *testing.T) {
+	registry := GetRegistry()
+
+	fields, err := registry.CredentialFields("snmp-v3")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	byName := make(map[string]CredentialField, len(fields))
+	for _, f := range fields {
+		byName[f.Name] = f
+	}
+
+	if f := byName["security_name"]; !f.Required || f.Type != "string" {
+		t.Errorf("security_name should be a required string, got %+v", f)
+	}
+	if f := byName["security_level"]; len(f.Enum) != 3 || f.Enum[0] != "noAuthNoPriv" {
+		t.Errorf("security_level should enumerate USM levels, got %+v", f)
+	}
+	if f, ok := byName["auth_password"]; !ok || f.Required {
+		t.Errorf("auth_password should be optional, got %+v", f)
+	}
+
+	if _, err := registry.CredentialFields("telnet"); err == nil {
+		t.Error("Expected error for unknown protocol")
+	}
+}
+
+func TestCredentialSchema(t *testing.T) {
+	registry := GetRegistry()
+
+	testCases := []struct {
+		name         string
+		protocolID   string
+		wantRequired []string
+		wantAnyOf    bool
+	}{
+		{"WinRM", "windows-winrm", []string{"username", "password"}, false},
+		{"SSH password or key", "ssh", []string{"username"}, true},
+		{"SNMP v2c", "snmp-v2c", []string{"community"}, false},
+		{"SNMP v3", "snmp-v3", []string{"security_name", "security_level"}, false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			schema, err := registry.CredentialSchema(tc.protocolID)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			// Round-trip through JSON to check the wire format
+			data, err := json.Marshal(schema)
+			if err != nil {
+				t.Fatalf("Failed to marshal schema: %v", err)
+			}
+			var doc struct {
+				Type                 string                     `json:"type"`
+				Required             []string                   `json:"required"`
+				AdditionalProperties bool                       `json:"additionalProperties"`
+				Properties           map[string]json.RawMessage `json:"properties"`
+				AnyOf                []json.RawMessage          `json:"anyOf"`
+			}
+			if err := json.Unmarshal(data, &doc); err != nil {
+				t.Fatalf("Failed to unmarshal schema: %v", err)
+			}
+
+			if doc.Type != "object" || doc.AdditionalProperties {
+				t.Errorf("Expected closed object schema, got type=%q additionalProperties=%v", doc.Type, doc.AdditionalProperties)
+			}
+			if len(doc.Required) != len(tc.wantRequired) {
+				t.Fatalf("Expected required %v, got %v", tc.wantRequired, doc.Required)
+			}
+			for i, name := range tc.wantRequired {
+				if doc.Required[i] != name {
+					t.Errorf("Expected required %v, got %v", tc.wantRequired, doc.Required)
+				}
+			}
+			if (len(doc.AnyOf) > 0) != tc.wantAnyOf {
+				t.Errorf("Expected anyOf present=%v, got %d entries", tc.wantAnyOf, len(doc.AnyOf))
+			}
+		})
+	}
+
+	schema, _ := registry.CredentialSchema("snmp-v3")
+	level := schema["properties"].(map[string]any)["security_level"].(map[string]any)
+	if enum, ok := level["enum"].([]string); !ok || len(enum) != 3 {
+		t.Errorf("Expected security_level enum, got %v", level["enum"])
+	}
+
+	if _, err := registry.CredentialSchema("telnet"); err == nil {
+		t.Error("Expected error for unknown protocol")
+	}
+}
+
+// testCACert returns a self-signed PEM certificate
+func testCACert(t *testing.T) string {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+}
@@ -0,0 +1,72 @@
+package protocols
+
+import "reflect"
+
+// jsonSchemaDialect is the JSON Schema draft the generated documents declare
+const jsonSchemaDialect = "https://json-schema.org/draft/2020-12/schema"
+
+// schemaConstrainer lets a credential struct add cross-field rules that its
+// validate tags cannot express (mirrors the custom Validate method).
+type schemaConstrainer interface {
+	schemaConstraints() map[string]any
+}
+
+// schemaConstraints mirrors SSHCredentials.Validate: password or private_key is required
+func (s *SSHCredentials) schemaConstraints() map[string]any {
+	return map[string]any{
+		"anyOf": []any{
+			map[string]any{"required": []string{"password"}},
+			map[string]any{"required": []string{"private_key"}},
+		},
+	}
+}
+
+// CredentialSchema returns a JSON Schema document for a protocol's credential payload.
+// It matches ValidateCredentials: unknown fields are rejected, required and enum
+// constraints come from validate tags.
+func (r *Registry) CredentialSchema(protocolID string) (map[string]any, error) {
+	protocol, err := r.GetProtocol(protocolID)
+	if err != nil {
+		return nil, err
+	}
+
+	fields, err := r.CredentialFields(protocolID)
+	if err != nil {
+		return nil, err
+	}
+
+	properties := make(map[string]any, len(fields))
+	required := make([]string, 0, len(fields))
+	for _, f := range fields {
+		prop := map[string]any{"type": f.Type}
+		if len(f.Enum) > 0 {
+			prop["enum"] = f.Enum
+		}
+		if f.MinLength > 0 {
+			prop["minLength"] = f.MinLength
+		}
+		properties[f.Name] = prop
+
+		if f.Required {
+			required = append(required, f.Name)
+		}
+	}
+
+	schema := map[string]any{
+		"$schema":              jsonSchemaDialect,
+		"title":                protocol.Name,
+		"type":                 "object",
+		"properties":           properties,
+		"required":             required,
+		"additionalProperties": false,
+	}
+
+	credType, _ := r.GetCredentialType(protocolID)
+	if c, ok := reflect.New(credType).Interface().(schemaConstrainer); ok {
+		for k, v := range c.schemaConstraints() {
+			schema[k] = v
+		}
+	}
+
+	return schema, nil
+}
@@ -2,6 +2,7 @@ package protocols
 
 import (
 	"encoding/json"
+	"errors"
 	"strings"
 	"testing"
 )
@@ -68,3 +69,50 @@ func TestStrictValidation(t *testing.T) {
 		})
 	}
 }
+
+func TestSNMPv3ContextValidation(t *testing.T) {
+	registry := GetRegistry()
+	base := `"security_name": "monitor", "security_level": "noAuthNoPriv"`
+
+	tests := []struct {
+		name        string
+		payload     string
+		expectError bool
+	}{
+		{"Without context (existing profiles)", `{` + base + `}`, false},
+		{"Context name only", `{` + base + `, "context_name": "vlan-10"}`, false},
+		{"Context engine ID", `{` + base + `, "context_engine_id": "80001f888056565656"}`, false},
+		{"Context engine ID with 0x prefix", `{` + base + `, "context_engine_id": "0x80001f888056565656"}`, false},
+		{"Context engine ID not hex", `{` + base + `, "context_engine_id": "not-hex"}`, true},
+		{"Context engine ID too short", `{` + base + `, "context_engine_id": "8000"}`, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := registry.ValidateCredentials("snmp-v3", json.RawMessage(tt.payload))
+			if tt.expectError {
+				var validationErrs *ValidationErrors
+				if !errors.As(err, &validationErrs) || len(validationErrs.Errors) != 1 || validationErrs.Errors[0].Field != "context_engine_id" {
+					t.Errorf("expected a context_engine_id validation error, got %v", err)
+				}
+			}
+			if !tt.expectError && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestDecodeEngineID(t *testing.T) {
+	raw, err := DecodeEngineID("0x8000000001")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if raw != "\x80\x00\x00\x00\x01" {
+		t.Errorf("expected raw octets, got %q", raw)
+	}
+
+	if raw, err := DecodeEngineID(""); err != nil || raw != "" {
+		t.Errorf("empty engine ID should decode to empty, got %q, %v", raw, err)
+	}
+}
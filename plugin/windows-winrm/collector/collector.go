@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"log"
 	"regexp"
+	"slices"
 	"strings"
 
 	"github.com/nmslite/plugins/windows-winrm/models"
@@ -37,46 +38,44 @@ func executeWMIQuery[T any](client *winrm.Client, script string, singleFallback
 	return results, nil
 }
 
-// Collect runs all metric collectors and returns combined results
+// namedCollector pairs a collector with the name monitors select it by
+type namedCollector struct {
+	name    string
+	collect func(*winrm.Client) ([]models.Metric, error)
+}
+
+// collectors lists every collector in run order; names match the manifest's "collectors"
+var collectors = []namedCollector{
+	{"cpu", CollectCPU},
+	{"memory", CollectMemory},
+	{"disk", CollectDisk},
+	{"network", CollectNetwork},
+}
+
+// Collect runs the requested collectors (all of them when selected is empty) and returns
+// combined results. Unknown names are logged and skipped.
 // Uses partial success strategy - if one collector fails, others continue
-func Collect(client *winrm.Client) ([]models.Metric, error) {
+func Collect(client *winrm.Client, selected []string) ([]models.Metric, error) {
 	var allMetrics []models.Metric
 	var errors []string
 
-	// Collect CPU metrics
-	cpuMetrics, err := CollectCPU(client)
-	if err != nil {
-		log.Printf("[WARN] CPU collection failed for %s: %v", client.Target(), err)
-		errors = append(errors, fmt.Sprintf("cpu: %v", err))
-	} else {
-		allMetrics = append(allMetrics, cpuMetrics...)
-	}
-
-	// Collect Memory metrics
-	memMetrics, err := CollectMemory(client)
-	if err != nil {
-		log.Printf("[WARN] Memory collection failed for %s: %v", client.Target(), err)
-		errors = append(errors, fmt.Sprintf("memory: %v", err))
-	} else {
-		allMetrics = append(allMetrics, memMetrics...)
-	}
-
-	// Collect Disk metrics
-	diskMetrics, err := CollectDisk(client)
-	if err != nil {
-		log.Printf("[WARN] Disk collection failed for %s: %v", client.Target(), err)
-		errors = append(errors, fmt.Sprintf("disk: %v", err))
-	} else {
-		allMetrics = append(allMetrics, diskMetrics...)
+	for _, name := range selected {
+		if !slices.ContainsFunc(collectors, func(c namedCollector) bool { return c.name == name }) {
+			log.Printf("[WARN] Unknown collector %q requested for %s", name, client.Target())
+		}
 	}
 
-	// Collect Network metrics
-	netMetrics, err := CollectNetwork(client)
-	if err != nil {
-		log.Printf("[WARN] Network collection failed for %s: %v", client.Target(), err)
-		errors = append(errors, fmt.Sprintf("network: %v", err))
-	} else {
-		allMetrics = append(allMetrics, netMetrics...)
+	for _, c := range collectors {
+		if len(selected) > 0 && !slices.Contains(selected, c.name) {
+			continue
+		}
+		metrics, err := c.collect(client)
+		if err != nil {
+			log.Printf("[WARN] %s collection failed for %s: %v", c.name, client.Target(), err)
+			errors = append(errors, fmt.Sprintf("%s: %v", c.name, err))
+		} else {
+			allMetrics = append(allMetrics, metrics...)
+		}
 	}
 
 	// If all collectors failed, return error
@@ -116,6 +115,7 @@ func CollectCPU(client *winrm.Client) ([]models.Metric, error) {
 				Name:  "system.cpu.usage",
 				Value: float64(cpu.PercentProcessorTime),
 				Type:  "gauge",
+				Unit:  "percent",
 			})
 		} else {
 			// Per-core CPU usage
@@ -123,6 +123,7 @@ func CollectCPU(client *winrm.Client) ([]models.Metric, error) {
 				Name:  fmt.Sprintf("system.cpu.%s.usage", cpu.Name),
 				Value: float64(cpu.PercentProcessorTime),
 				Type:  "gauge",
+				Unit:  "percent",
 			})
 		}
 	}
@@ -157,14 +158,20 @@ func CollectMemory(client *winrm.Client) ([]models.Metric, error) {
 	totalBytes := float64(mem.TotalVisibleMemorySize) * 1024
 	freeBytes := float64(mem.FreePhysicalMemory) * 1024
 	usedBytes := totalBytes - freeBytes
-	usagePercent := (usedBytes / totalBytes) * 100
-
-	return []models.Metric{
-		{Name: "system.memory.total_bytes", Value: totalBytes, Type: "gauge"},
-		{Name: "system.memory.used_bytes", Value: usedBytes, Type: "gauge"},
-		{Name: "system.memory.free_bytes", Value: freeBytes, Type: "gauge"},
-		{Name: "system.memory.usage_percent", Value: usagePercent, Type: "gauge"},
-	}, nil
+
+	metrics := []models.Metric{
+		{Name: "system.memory.total_bytes", Value: totalBytes, Type: "gauge", Unit: "bytes"},
+		{Name: "system.memory.used_bytes", Value: usedBytes, Type: "gauge", Unit: "bytes"},
+		{Name: "system.memory.free_bytes", Value: freeBytes, Type: "gauge", Unit: "bytes"},
+	}
+	// A zero total (e.g. a partial WMI answer) would make the percentage NaN, which
+	// encoding/json refuses to marshal, failing the whole plugin output
+	if totalBytes > 0 {
+		usagePercent := (usedBytes / totalBytes) * 100
+		metrics = append(metrics, models.Metric{Name: "system.memory.usage_percent", Value: usagePercent, Type: "gauge", Unit: "percent"})
+	}
+
+	return metrics, nil
 }
 
 // -------------------------------------------------------------------------
@@ -204,10 +211,10 @@ func CollectDisk(client *winrm.Client) ([]models.Metric, error) {
 
 		// Per-disk metrics
 		metrics = append(metrics,
-			models.Metric{Name: fmt.Sprintf("system.disk.%s.total_bytes", deviceName), Value: totalBytes, Type: "gauge"},
-			models.Metric{Name: fmt.Sprintf("system.disk.%s.used_bytes", deviceName), Value: usedBytes, Type: "gauge"},
-			models.Metric{Name: fmt.Sprintf("system.disk.%s.free_bytes", deviceName), Value: freeBytes, Type: "gauge"},
-			models.Metric{Name: fmt.Sprintf("system.disk.%s.usage_percent", deviceName), Value: usagePercent, Type: "gauge"},
+			models.Metric{Name: fmt.Sprintf("system.disk.%s.total_bytes", deviceName), Value: totalBytes, Type: "gauge", Unit: "bytes"},
+			models.Metric{Name: fmt.Sprintf("system.disk.%s.used_bytes", deviceName), Value: usedBytes, Type: "gauge", Unit: "bytes"},
+			models.Metric{Name: fmt.Sprintf("system.disk.%s.free_bytes", deviceName), Value: freeBytes, Type: "gauge", Unit: "bytes"},
+			models.Metric{Name: fmt.Sprintf("system.disk.%s.usage_percent", deviceName), Value: usagePercent, Type: "gauge", Unit: "percent"},
 		)
 
 		// Accumulate for aggregates
@@ -220,10 +227,10 @@ func CollectDisk(client *winrm.Client) ([]models.Metric, error) {
 		aggUsed := aggTotal - aggFree
 		aggUsagePercent := (aggUsed / aggTotal) * 100
 		metrics = append(metrics,
-			models.Metric{Name: "system.disk.total_bytes", Value: aggTotal, Type: "gauge"},
-			models.Metric{Name: "system.disk.used_bytes", Value: aggUsed, Type: "gauge"},
-			models.Metric{Name: "system.disk.free_bytes", Value: aggFree, Type: "gauge"},
-			models.Metric{Name: "system.disk.usage_percent", Value: aggUsagePercent, Type: "gauge"},
+			models.Metric{Name: "system.disk.total_bytes", Value: aggTotal, Type: "gauge", Unit: "bytes"},
+			models.Metric{Name: "system.disk.used_bytes", Value: aggUsed, Type: "gauge", Unit: "bytes"},
+			models.Metric{Name: "system.disk.free_bytes", Value: aggFree, Type: "gauge", Unit: "bytes"},
+			models.Metric{Name: "system.disk.usage_percent", Value: aggUsagePercent, Type: "gauge", Unit: "percent"},
 		)
 	}
 
@@ -262,12 +269,12 @@ func CollectNetwork(client *winrm.Client) ([]models.Metric, error) {
 
 		// Per-interface metrics
 		metrics = append(metrics,
-			models.Metric{Name: fmt.Sprintf("network.%s.bytes_recv_per_sec", ifaceName), Value: float64(net.BytesReceivedPersec), Type: "gauge"},
-			models.Metric{Name: fmt.Sprintf("network.%s.bytes_sent_per_sec", ifaceName), Value: float64(net.BytesSentPersec), Type: "gauge"},
+			models.Metric{Name: fmt.Sprintf("network.%s.bytes_recv_per_sec", ifaceName), Value: float64(net.BytesReceivedPersec), Type: "gauge", Unit: "bytes/s"},
+			models.Metric{Name: fmt.Sprintf("network.%s.bytes_sent_per_sec", ifaceName), Value: float64(net.BytesSentPersec), Type: "gauge", Unit: "bytes/s"},
 		)
 		if linkSpeedBytes > 0 {
 			metrics = append(metrics,
-				models.Metric{Name: fmt.Sprintf("network.%s.bandwidth_bytes", ifaceName), Value: linkSpeedBytes, Type: "gauge"},
+				models.Metric{Name: fmt.Sprintf("network.%s.bandwidth_bytes", ifaceName), Value: linkSpeedBytes, Type: "gauge", Unit: "bytes/s"},
 			)
 		}
 
@@ -279,12 +286,12 @@ func CollectNetwork(client *winrm.Client) ([]models.Metric, error) {
 
 	// Aggregate network metrics
 	metrics = append(metrics,
-		models.Metric{Name: "network.bytes_recv_per_sec", Value: aggRecv, Type: "gauge"},
-		models.Metric{Name: "network.bytes_sent_per_sec", Value: aggSent, Type: "gauge"},
+		models.Metric{Name: "network.bytes_recv_per_sec", Value: aggRecv, Type: "gauge", Unit: "bytes/s"},
+		models.Metric{Name: "network.bytes_sent_per_sec", Value: aggSent, Type: "gauge", Unit: "bytes/s"},
 	)
 	if aggBandwidth > 0 {
 		metrics = append(metrics,
-			models.Metric{Name: "network.bandwidth_bytes", Value: aggBandwidth, Type: "gauge"},
+			models.Metric{Name: "network.bandwidth_bytes", Value: aggBandwidth, Type: "gauge", Unit: "bytes/s"},
 		)
 	}
 
@@ -0,0 +1,128 @@
+// Package ipc reads the task batch from the core and writes results back. The core sets
+// NMSLITE_IPC_ENCODING=gzip for large batches when the manifest declares
+// "compression": "gzip"; both directions are then gzip-framed, otherwise plain JSON.
+//
+// With "daemon": true in the manifest the core may instead start the plugin once with
+// NMSLITE_PLUGIN_MODE=daemon and stream batches to it as JSON lines, see Serve and
+// docs/plugin-daemon-protocol.md in the core repository.
+package ipc
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// EncodingEnv names the variable carrying the framing chosen by the core
+const EncodingEnv = "NMSLITE_IPC_ENCODING"
+
+// ModeEnv names the variable the core sets to "daemon" when it keeps the plugin running
+const ModeEnv = "NMSLITE_PLUGIN_MODE"
+
+// Daemon reports whether the plugin was started in daemon mode
+func Daemon() bool {
+	return os.Getenv(ModeEnv) == "daemon"
+}
+
+// Request is one batch in daemon mode
+type Request struct {
+	ID    uint64          `json:"id"`
+	Tasks json.RawMessage `json:"tasks"`
+}
+
+// Response answers the Request with the same ID, with either results or an error
+type Response struct {
+	ID      uint64 `json:"id"`
+	Results any    `json:"results,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// Serve runs the daemon-mode loop: it reads one Request per line from r and writes one
+// Response per line to w. Batches are handled concurrently, so responses may come back
+// out of order. Serve returns once r is closed and every batch has been answered.
+func Serve(r io.Reader, w io.Writer, handle func(tasks json.RawMessage) (any, error)) error {
+	var (
+		wg       sync.WaitGroup
+		writeMu  sync.Mutex
+		enc      = json.NewEncoder(w) // Encode terminates each value with a newline
+		writeErr error
+	)
+	reply := func(resp Response) {
+		writeMu.Lock()
+		defer writeMu.Unlock()
+		if err := enc.Encode(resp); err != nil && writeErr == nil {
+			writeErr = err
+		}
+	}
+
+	reader := bufio.NewReader(r)
+	var readErr error
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 {
+			var req Request
+			if err := json.Unmarshal(line, &req); err != nil {
+				// Without an ID the core cannot be answered; it times the batch out
+				readErr = fmt.Errorf("parse request: %w", err)
+				break
+			}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				results, err := handle(req.Tasks)
+				if err != nil {
+					reply(Response{ID: req.ID, Error: err.Error()})
+					return
+				}
+				reply(Response{ID: req.ID, Results: results})
+			}()
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			readErr = err
+			break
+		}
+	}
+
+	wg.Wait()
+	if readErr != nil {
+		return readErr
+	}
+	return writeErr
+}
+
+// Gzip reports whether this invocation is gzip-framed
+func Gzip() bool {
+	return os.Getenv(EncodingEnv) == "gzip"
+}
+
+// ReadInput reads the whole task batch from r, decompressing it if needed
+func ReadInput(r io.Reader) ([]byte, error) {
+	if !Gzip() {
+		return io.ReadAll(r)
+	}
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("gzip input: %w", err)
+	}
+	defer zr.Close()
+	return io.ReadAll(zr)
+}
+
+// WriteOutput encodes v as JSON to w, compressing it if needed
+func WriteOutput(w io.Writer, v any) error {
+	if !Gzip() {
+		return json.NewEncoder(w).Encode(v)
+	}
+	zw := gzip.NewWriter(w)
+	if err := json.NewEncoder(zw).Encode(v); err != nil {
+		return err
+	}
+	return zw.Close()
+}
@@ -0,0 +1,51 @@
+package ipc
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestServe(t *testing.T) {
+	input := `{"id":1,"tasks":[{"request_id":"a"}]}
+{"id":2,"tasks":"not a list"}
+{"id":3,"tasks":[]}
+`
+	var out bytes.Buffer
+	err := Serve(strings.NewReader(input), &out, func(tasks json.RawMessage) (any, error) {
+		var list []map[string]string
+		if err := json.Unmarshal(tasks, &list); err != nil {
+			return nil, errors.New("bad tasks")
+		}
+		return list, nil
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// Responses may come back in any order
+	got := make(map[uint64]string)
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		var resp struct {
+			ID      uint64          `json:"id"`
+			Results json.RawMessage `json:"results"`
+			Error   string          `json:"error"`
+		}
+		if err := json.Unmarshal([]byte(line), &resp); err != nil {
+			t.Fatalf("Response %q is not one JSON line: %v", line, err)
+		}
+		got[resp.ID] = string(resp.Results) + resp.Error
+	}
+
+	want := map[uint64]string{1: `[{"request_id":"a"}]`, 2: "bad tasks", 3: "[]"}
+	for id, expected := range want {
+		if got[id] != expected {
+			t.Errorf("Expected response %d to be %s, got %q", id, expected, got[id])
+		}
+	}
+	if len(got) != len(want) {
+		t.Errorf("Expected %d responses, got %d", len(want), len(got))
+	}
+}
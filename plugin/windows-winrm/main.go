@@ -2,12 +2,12 @@ package main
 
 import (
 	"encoding/json"
-	"io"
 	"log"
 	"os"
 	"time"
 
 	"github.com/nmslite/plugins/windows-winrm/collector"
+	"github.com/nmslite/plugins/windows-winrm/ipc"
 	"github.com/nmslite/plugins/windows-winrm/models"
 	"github.com/nmslite/plugins/windows-winrm/winrm"
 )
@@ -23,8 +23,15 @@ func main() {
 	log.SetOutput(os.Stderr)
 	log.SetFlags(log.Ldate | log.Ltime | log.Lshortfile)
 
-	// Read all input from STDIN
-	input, err := io.ReadAll(os.Stdin)
+	// In daemon mode the core keeps this process running and streams batches to it;
+	// clients then stay cached across batches, not just within one
+	if ipc.Daemon() {
+		serveDaemon()
+		return
+	}
+
+	// Read all input from STDIN (gzip-framed when the core asks for it)
+	input, err := ipc.ReadInput(os.Stdin)
 	if err != nil {
 		log.Fatalf("Failed to read STDIN: %v", err)
 	}
@@ -40,29 +47,55 @@ func main() {
 		log.Fatalf("Failed to parse input JSON: %v", err)
 	}
 
-	// Process each task
-	outputs := make([]models.PluginOutput, len(tasks))
-	for i, task := range tasks {
-		outputs[i] = processTask(task)
-	}
+	// Process each task; tasks for the same target and credentials share a client
+	pool := winrm.NewPool(winrm.SessionTTL(), DefaultTimeout)
+	defer pool.Close()
+	outputs := processBatch(pool, tasks)
 
-	// Write JSON array to STDOUT
-	encoder := json.NewEncoder(os.Stdout)
-	if err := encoder.Encode(outputs); err != nil {
+	// Write JSON array to STDOUT, framed the same way as the input
+	if err := ipc.WriteOutput(os.Stdout, outputs); err != nil {
 		log.Fatalf("Failed to write output JSON: %v", err)
 	}
 }
 
+// serveDaemon answers batches from STDIN until the core closes it
+func serveDaemon() {
+	pool := winrm.NewPool(winrm.SessionTTL(), DefaultTimeout)
+	defer pool.Close()
+
+	err := ipc.Serve(os.Stdin, os.Stdout, func(input json.RawMessage) (any, error) {
+		var tasks []models.PluginInput
+		if err := json.Unmarshal(input, &tasks); err != nil {
+			return nil, err
+		}
+		// Expired clients of targets no longer polled would otherwise stay cached
+		pool.Prune()
+		return processBatch(pool, tasks), nil
+	})
+	if err != nil {
+		log.Printf("Daemon stopped: %v", err)
+	}
+}
+
+// processBatch polls every task in order
+func processBatch(pool *winrm.Pool, tasks []models.PluginInput) []models.PluginOutput {
+	outputs := make([]models.PluginOutput, len(tasks))
+	for i, task := range tasks {
+		outputs[i] = processTask(pool, task)
+	}
+	return outputs
+}
+
 // processTask handles a single polling task
-func processTask(task models.PluginInput) models.PluginOutput {
-	// Default port if not specified
+func processTask(pool *winrm.Pool, task models.PluginInput) models.PluginOutput {
+	// Default port for the transport if not specified
 	port := task.Port
 	if port == 0 {
-		port = 5985
+		port = winrm.DefaultPort(task.Credentials)
 	}
 
-	// Create WinRM client
-	client, err := winrm.NewClient(task.Target, port, task.Credentials, DefaultTimeout)
+	// Get a WinRM client, reusing one already authenticated to this target
+	client, reused, err := pool.Get(task.Target, port, task.Credentials)
 	if err != nil {
 		return models.PluginOutput{
 			RequestID: task.RequestID,
@@ -70,10 +103,22 @@ func processTask(task models.PluginInput) models.PluginOutput {
 			Error:     "WinRM connection failed: " + err.Error(),
 		}
 	}
-	defer client.Close()
 
-	// Collect all metrics
-	metrics, err := collector.Collect(client)
+	// Collect the requested metrics (all when the monitor selects none)
+	metrics, err := collector.Collect(client, task.Collectors)
+	if winrm.IsAuthFailure(err) {
+		// Never keep a rejected session; a reused one may just have gone stale on the
+		// server, so retry it once with a fresh client
+		pool.Invalidate(task.Target, port, task.Credentials)
+		if reused {
+			if client, _, err = pool.Get(task.Target, port, task.Credentials); err == nil {
+				metrics, err = collector.Collect(client, task.Collectors)
+			}
+			if winrm.IsAuthFailure(err) {
+				pool.Invalidate(task.Target, port, task.Credentials)
+			}
+		}
+	}
 	if err != nil {
 		return models.PluginOutput{
 			RequestID: task.RequestID,
@@ -6,6 +6,7 @@ type PluginInput struct {
 	Target      string      `json:"target"`
 	Port        int         `json:"port"`
 	Credentials Credentials `json:"credentials"`
+	Collectors  []string    `json:"collectors,omitempty"` // Empty runs every collector
 }
 
 // Credentials holds authentication details for WinRM connection
@@ -13,6 +14,11 @@ type Credentials struct {
 	Username string `json:"username"`
 	Password string `json:"password"`
 	Domain   string `json:"domain,omitempty"`
+
+	// HTTPS transport; plain HTTP when UseHTTPS is false
+	UseHTTPS           bool   `json:"use_https,omitempty"`
+	InsecureSkipVerify bool   `json:"insecure_skip_verify,omitempty"`
+	CACert             string `json:"ca_cert,omitempty"` // PEM
 }
 
 // PluginOutput represents the result sent back to the core via STDOUT
@@ -29,4 +35,5 @@ type Metric struct {
 	Name  string  `json:"name"` // Hierarchical: "system.cpu.usage"
 	Value float64 `json:"value"`
 	Type  string  `json:"type,omitempty"` // "gauge", "counter", "derive" - defaults to "gauge"
+	Unit  string  `json:"unit,omitempty"` // "bytes", "percent", "bytes/s", ... - empty when dimensionless
 }
@@ -15,19 +15,40 @@ type Client struct {
 	target string
 }
 
+// Conventional WinRM listener ports
+const (
+	DefaultHTTPPort  = 5985
+	DefaultHTTPSPort = 5986
+)
+
+// DefaultPort returns the conventional listener port for the transport creds select
+func DefaultPort(creds models.Credentials) int {
+	if creds.UseHTTPS {
+		return DefaultHTTPSPort
+	}
+	return DefaultHTTPPort
+}
+
 // NewClient creates a WinRM client based on the provided credentials
 // - If domain is empty, uses Basic Auth
 // - If domain is provided, uses NTLM Auth
-// - Port mapping: 5985 for HTTP, 5986 for HTTPS
+// - Connects to port as given; callers default it with DefaultPort
+// - HTTPS (creds.UseHTTPS) verifies the certificate against creds.CACert (system roots if empty)
+// unless creds.InsecureSkipVerify is set
 func NewClient(target string, port int, creds models.Credentials, timeout time.Duration) (*Client, error) {
+	var caCert []byte
+	if creds.CACert != "" {
+		caCert = []byte(creds.CACert)
+	}
+
 	endpoint := winrm.NewEndpoint(
 		target,
 		port,
-		false, // https - use HTTP for WinRM
-		true,  // insecure - skip certificate verification
-		nil,   // CA certificate
-		nil,   // client certificate
-		nil,   // client key
+		creds.UseHTTPS,
+		creds.InsecureSkipVerify,
+		caCert, // CA certificate (PEM)
+		nil,    // client certificate
+		nil,    // client key
 		timeout,
 	)
 
@@ -98,8 +119,8 @@ func (c *Client) Target() string {
 	return c.target
 }
 
-// Close is a no-op for the WinRM client as connections are per-request
-// Kept for interface consistency
+// Close is a no-op: shells are opened and deleted per command, and idle keep-alive
+// connections end with the process. Kept for interface consistency
 func (c *Client) Close() {
-	// WinRM connections are stateless/per-request, no cleanup needed
+	// No shell is held between commands, no cleanup needed
 }
@@ -0,0 +1,136 @@
+package winrm
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nmslite/plugins/windows-winrm/models"
+)
+
+// SessionTTLEnv sets how long an authenticated client is reused, as a Go duration
+// ("5m"); "0" creates a fresh client for every task
+const SessionTTLEnv = "NMSLITE_WINRM_SESSION_TTL"
+
+// DefaultSessionTTL is used when SessionTTLEnv is unset or invalid
+const DefaultSessionTTL = 5 * time.Minute
+
+// SessionTTL returns the client reuse TTL configured through SessionTTLEnv
+func SessionTTL() time.Duration {
+	value := os.Getenv(SessionTTLEnv)
+	if value == "" {
+		return DefaultSessionTTL
+	}
+	ttl, err := time.ParseDuration(value)
+	if err != nil || ttl < 0 {
+		return DefaultSessionTTL
+	}
+	return ttl
+}
+
+// Pool caches clients by target and credentials, so the tasks of a batch (and of later
+// batches, while the plugin runs) reuse keep-alive connections, TLS sessions and NTLM
+// authentication instead of repeating them for every poll
+type Pool struct {
+	ttl     time.Duration
+	timeout time.Duration
+	dial    func(target string, port int, creds models.Credentials, timeout time.Duration) (*Client, error)
+
+	mu      sync.Mutex
+	clients map[string]pooledClient
+}
+
+// pooledClient is a cached client and when it stops being reused
+type pooledClient struct {
+	client  *Client
+	expires time.Time
+}
+
+// NewPool creates a pool that reuses clients for ttl (0 disables reuse) and creates
+// them with the given connection timeout
+func NewPool(ttl, timeout time.Duration) *Pool {
+	return &Pool{
+		ttl:     ttl,
+		timeout: timeout,
+		dial:    NewClient,
+		clients: make(map[string]pooledClient),
+	}
+}
+
+// Get returns a client for the target, reusing a cached one that has not expired.
+// reused reports whether it came from the cache.
+func (p *Pool) Get(target string, port int, creds models.Credentials) (client *Client, reused bool, err error) {
+	key := poolKey(target, port, creds)
+	now := time.Now()
+
+	p.mu.Lock()
+	if cached, ok := p.clients[key]; ok {
+		if now.Before(cached.expires) {
+			p.mu.Unlock()
+			return cached.client, true, nil
+		}
+		delete(p.clients, key)
+	}
+	p.mu.Unlock()
+
+	client, err = p.dial(target, port, creds, p.timeout)
+	if err != nil || p.ttl <= 0 {
+		return client, false, err
+	}
+
+	p.mu.Lock()
+	p.clients[key] = pooledClient{client: client, expires: now.Add(p.ttl)}
+	p.mu.Unlock()
+	return client, false, nil
+}
+
+// Invalidate drops the cached client for the target, so the next Get authenticates afresh
+func (p *Pool) Invalidate(target string, port int, creds models.Credentials) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.clients, poolKey(target, port, creds))
+}
+
+// Prune drops cached clients past their TTL, which Get only does for the target it is asked for
+func (p *Pool) Prune() {
+	now := time.Now()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for key, cached := range p.clients {
+		if !now.Before(cached.expires) {
+			cached.client.Close()
+			delete(p.clients, key)
+		}
+	}
+}
+
+// Close drops every cached client
+func (p *Pool) Close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for key, cached := range p.clients {
+		cached.client.Close()
+		delete(p.clients, key)
+	}
+}
+
+// poolKey identifies a client by endpoint and a hash of the credentials, so a changed
+// password or transport setting never reuses the old session
+func poolKey(target string, port int, creds models.Credentials) string {
+	raw, _ := json.Marshal(creds)
+	return fmt.Sprintf("%s:%d/%x", target, port, sha256.Sum256(raw))
+}
+
+// IsAuthFailure reports whether err is the server rejecting the client's authentication
+func IsAuthFailure(err error) bool {
+	if err == nil {
+		return false
+	}
+	// The winrm library reports HTTP statuses only in the error text
+	msg := err.Error()
+	return strings.Contains(msg, "http response error: 401") || strings.Contains(msg, "http error 401")
+}
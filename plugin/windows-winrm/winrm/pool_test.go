@@ -0,0 +1,156 @@
+package winrm
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/nmslite/plugins/windows-winrm/models"
+)
+
+// Minimal WS-Management responses for one command: open shell, run, receive output, delete
+const (
+	soapEnvelope = `<s:Envelope xmlns:s="http://www.w3.org/2003/05/soap-envelope" xmlns:a="http://schemas.xmlsoap.org/ws/2004/08/addressing" xmlns:w="http://schemas.dmtf.org/wbem/wsman/1/wsman.xsd" xmlns:rsp="http://schemas.microsoft.com/wbem/wsman/1/windows/shell">%s</s:Envelope>`
+
+	createShellBody = `<s:Header><w:SelectorSet><w:Selector Name="ShellId">11111111-1111-1111-1111-111111111111</w:Selector></w:SelectorSet></s:Header><s:Body/>`
+	commandBody     = `<s:Header><a:Action>http://schemas.microsoft.com/wbem/wsman/1/windows/shell/CommandResponse</a:Action></s:Header><s:Body><rsp:CommandResponse><rsp:CommandId>22222222-2222-2222-2222-222222222222</rsp:CommandId></rsp:CommandResponse></s:Body>`
+	receiveBody     = `<s:Body><rsp:ReceiveResponse><rsp:Stream Name="stdout" CommandId="22222222-2222-2222-2222-222222222222">NDI=</rsp:Stream><rsp:CommandState CommandId="22222222-2222-2222-2222-222222222222" State="http://schemas.microsoft.com/wbem/wsman/1/windows/shell/CommandState/Done"><rsp:ExitCode>0</rsp:ExitCode></rsp:CommandState></rsp:ReceiveResponse></s:Body>`
+)
+
+// fakeWinRM serves the WS-Management calls of one command over HTTPS, rejecting requests
+// without the given password. It counts new TLS connections.
+func fakeWinRM(tb testing.TB, password *atomic.Value) (*httptest.Server, *atomic.Int64) {
+	tb.Helper()
+	var conns atomic.Int64
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, pass, ok := r.BasicAuth(); !ok || pass != password.Load().(string) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/soap+xml;charset=UTF-8")
+		var reply string
+		switch {
+		case strings.Contains(string(body), "transfer/Create"):
+			reply = createShellBody
+		case strings.Contains(string(body), "shell/Command<"):
+			reply = commandBody
+		case strings.Contains(string(body), "shell/Receive"):
+			reply = receiveBody
+		default: // Signal, Delete
+			reply = "<s:Body/>"
+		}
+		fmt.Fprintf(w, soapEnvelope, reply)
+	}))
+	srv.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			conns.Add(1)
+		}
+	}
+	srv.StartTLS()
+	tb.Cleanup(srv.Close)
+	return srv, &conns
+}
+
+// endpointOf splits a test server URL into host and port
+func endpointOf(tb testing.TB, srv *httptest.Server) (string, int) {
+	tb.Helper()
+	u, err := url.Parse(srv.URL)
+	if err != nil {
+		tb.Fatalf("Failed to parse server URL: %v", err)
+	}
+	port, _ := strconv.Atoi(u.Port())
+	return u.Hostname(), port
+}
+
+func TestPoolReuseAndInvalidate(t *testing.T) {
+	var password atomic.Value
+	password.Store("secret")
+	srv, _ := fakeWinRM(t, &password)
+	host, port := endpointOf(t, srv)
+	creds := models.Credentials{Username: "nms", Password: "secret", UseHTTPS: true, InsecureSkipVerify: true}
+
+	pool := NewPool(time.Minute, 5*time.Second)
+	first, reused, err := pool.Get(host, port, creds)
+	if err != nil || reused {
+		t.Fatalf("Expected a fresh client, got reused=%v err=%v", reused, err)
+	}
+	if out, err := first.RunPowerShellRaw("hostname"); err != nil || out != "42" {
+		t.Fatalf("Expected output 42, got %q (err %v)", out, err)
+	}
+
+	second, reused, _ := pool.Get(host, port, creds)
+	if !reused || second != first {
+		t.Error("Expected the cached client for the same target and credentials")
+	}
+	other := creds
+	other.Password = "rotated"
+	if _, reused, _ := pool.Get(host, port, other); reused {
+		t.Error("Expected changed credentials not to reuse the cached client")
+	}
+
+	// The server starts rejecting the session: the failure is recognised and dropped
+	password.Store("changed")
+	_, err = second.RunPowerShellRaw("hostname")
+	if !IsAuthFailure(err) {
+		t.Fatalf("Expected an auth failure, got %v", err)
+	}
+	pool.Invalidate(host, port, creds)
+	if _, reused, _ := pool.Get(host, port, creds); reused {
+		t.Error("Expected an invalidated client not to be reused")
+	}
+
+	if _, reused, _ := NewPool(0, time.Second).Get(host, port, creds); reused {
+		t.Error("Expected a zero TTL to disable reuse")
+	}
+
+	short := NewPool(time.Nanosecond, time.Second)
+	short.Get(host, port, creds)
+	short.Prune()
+	if len(short.clients) != 0 {
+		t.Error("Expected Prune to drop expired clients")
+	}
+}
+
+// BenchmarkPoll compares a poll on a fresh client, which opens a new TLS connection,
+// with one on a pooled client that reuses its keep-alive connection
+func BenchmarkPoll(b *testing.B) {
+	var password atomic.Value
+	password.Store("secret")
+	srv, conns := fakeWinRM(b, &password)
+	host, port := endpointOf(b, srv)
+	creds := models.Credentials{Username: "nms", Password: "secret", UseHTTPS: true, InsecureSkipVerify: true}
+
+	for _, bc := range []struct {
+		name string
+		ttl  time.Duration
+	}{
+		{"fresh", 0},
+		{"pooled", time.Hour},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			pool := NewPool(bc.ttl, 5*time.Second)
+			defer pool.Close()
+			start := conns.Load()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				client, _, err := pool.Get(host, port, creds)
+				if err != nil {
+					b.Fatal(err)
+				}
+				if _, err := client.RunPowerShellRaw("hostname"); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.ReportMetric(float64(conns.Load()-start)/float64(b.N), "conns/op")
+		})
+	}
+}